@@ -0,0 +1,14 @@
+output "resource_group_name" {
+  description = "Resource group of the state storage account"
+  value       = azurerm_resource_group.state.name
+}
+
+output "storage_account_name" {
+  description = "Name of the state storage account"
+  value       = azurerm_storage_account.state.name
+}
+
+output "container_name" {
+  description = "Name of the blob container holding state"
+  value       = azurerm_storage_container.state.name
+}
@@ -0,0 +1,32 @@
+variable "project" {
+  description = "Project name used for tagging"
+  type        = string
+}
+
+variable "location" {
+  description = "Azure region for the state storage account"
+  type        = string
+  default     = "eastus"
+}
+
+variable "resource_group_name" {
+  description = "Resource group for the state storage account"
+  type        = string
+  default     = "rg-tfstate"
+}
+
+variable "storage_account_name" {
+  description = "Globally unique storage account name, e.g. sttfstate<suffix>"
+  type        = string
+
+  validation {
+    condition     = can(regex("^[a-z0-9]{3,24}$", var.storage_account_name))
+    error_message = "storage_account_name must be 3-24 lower-case letters and digits."
+  }
+}
+
+variable "container_name" {
+  description = "Blob container holding the state files"
+  type        = string
+  default     = "tfstate"
+}
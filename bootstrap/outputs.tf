@@ -1,6 +1,6 @@
 output "state_bucket_name" {
   description = "Name of the S3 bucket for Terraform state"
-  value       = aws_s3_bucket.state.id
+  value       = aws_s3_bucket.state.bucket
 }
 
 output "state_bucket_arn" {
@@ -17,3 +17,13 @@ output "lock_table_arn" {
   description = "ARN of the DynamoDB table for state locking"
   value       = aws_dynamodb_table.lock.arn
 }
+
+output "region" {
+  description = "AWS region of the state bucket and lock table"
+  value       = var.region
+}
+
+output "kms_key_arn" {
+  description = "KMS key ARN the state bucket encrypts with (null for the AWS managed key)"
+  value       = var.kms_key_arn
+}
@@ -8,3 +8,9 @@ variable "region" {
   type        = string
   default     = "us-east-1"
 }
+
+variable "kms_key_arn" {
+  description = "KMS key ARN for state bucket encryption. Null uses the AWS managed aws/s3 key."
+  type        = string
+  default     = null
+}
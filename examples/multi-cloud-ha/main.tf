@@ -26,11 +26,13 @@ module "aws_vpc" {
   project     = var.project
   environment = "prod"
 
-  vpc_cidr           = "10.0.0.0/16"
+  # Address space is laid out with tests/cmd/netplan and must not overlap
+  # environments/*, which this example would be peered with.
+  vpc_cidr           = "10.16.0.0/16"
   availability_zones = ["us-east-1a", "us-east-1b"]
 
-  public_subnet_cidrs  = ["10.0.1.0/24", "10.0.2.0/24"]
-  private_subnet_cidrs = ["10.0.10.0/24", "10.0.11.0/24"]
+  public_subnet_cidrs  = ["10.16.0.0/24", "10.16.1.0/24"]
+  private_subnet_cidrs = ["10.16.4.0/24", "10.16.5.0/24"]
 
   enable_nat_gateway = true
   single_nat_gateway = true
@@ -58,14 +60,14 @@ module "azure_vnet" {
   resource_group_name = azurerm_resource_group.secondary.name
   location          = "eastus"
 
-  address_space = ["10.1.0.0/16"]
+  address_space = ["10.17.0.0/16"]
 
   subnets = {
     "public" = {
-      address_prefixes = ["10.1.1.0/24"]
+      address_prefixes = ["10.17.0.0/24"]
     }
     "private" = {
-      address_prefixes = ["10.1.10.0/24"]
+      address_prefixes = ["10.17.1.0/24"]
     }
   }
 
@@ -89,10 +91,9 @@ module "gcp_vpc" {
   network_name = "ha-vpc"
 
   subnets = {
-    "us-central1" = {
-      "main" = {
-        ip_cidr_range = "10.2.1.0/24"
-      }
+    "main" = {
+      region        = "us-central1"
+      ip_cidr_range = "10.18.0.0/24"
     }
   }
 
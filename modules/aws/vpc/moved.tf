@@ -0,0 +1,24 @@
+# Generated by tests/cmd/movedgen. Keep these blocks for at least one
+# release so every consumer's state is moved before they are removed.
+#
+# aws_route_table_association.private moved from count to for_each over
+# local.private_subnet_route_table_index (keys "0", "1", ...). Up to three
+# private subnets are possible, one per availability zone.
+
+# Matched by attributes subnet_id, route_table_id.
+moved {
+  from = aws_route_table_association.private[0]
+  to   = aws_route_table_association.private["0"]
+}
+
+# Matched by attributes subnet_id, route_table_id.
+moved {
+  from = aws_route_table_association.private[1]
+  to   = aws_route_table_association.private["1"]
+}
+
+# Matched by attributes subnet_id, route_table_id.
+moved {
+  from = aws_route_table_association.private[2]
+  to   = aws_route_table_association.private["2"]
+}
@@ -13,6 +13,12 @@ output "cluster_endpoint" {
   value       = google_container_cluster.this.endpoint
 }
 
+output "cluster_ca_certificate" {
+  description = "Base64 encoded CA certificate of the GKE API server"
+  value       = google_container_cluster.this.master_auth[0].cluster_ca_certificate
+  sensitive   = true
+}
+
 output "cluster_master_version" {
   description = "Master version of the cluster"
   value       = google_container_cluster.this.master_version
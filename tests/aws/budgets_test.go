@@ -37,8 +37,8 @@ func TestBudgetsSmokeTest(t *testing.T) {
 		NoColor: true,
 	}
 
-	defer terraform.Destroy(t, tfOpts)
-	terraform.InitAndApply(t, tfOpts)
+	defer destroy(t, tfOpts)
+	initAndApply(t, tfOpts)
 
 	monthlyBudgetName := terraform.Output(t, tfOpts, "monthly_budget_name")
 	assert.NotEmpty(t, monthlyBudgetName, "monthly_budget_name output must not be empty")
@@ -8,7 +8,6 @@ import (
 
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/require"
 )
 
 // TestDynamoDBLockOutputs validates the dynamodb-lock module creates a table
@@ -45,9 +44,8 @@ func TestDynamoDBLockOutputs(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, opts)
-	_, err := terraform.InitAndApplyE(t, opts)
-	require.NoError(t, err, "terraform apply failed for dynamodb-lock module")
+	defer destroy(t, opts)
+	initAndApply(t, opts)
 
 	outName := terraform.Output(t, opts, "table_name")
 	outARN := terraform.Output(t, opts, "table_arn")
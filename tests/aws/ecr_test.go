@@ -51,8 +51,8 @@ func TestEcrSmokeTest(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, opts)
-	terraform.InitAndApply(t, opts)
+	defer destroy(t, opts)
+	initAndApply(t, opts)
 
 	// --- Validate outputs ---
 
@@ -0,0 +1,192 @@
+package aws_test
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/awsverify"
+	"github.com/yourorg/tf-modules/tests/internal/charts"
+	"github.com/yourorg/tf-modules/tests/internal/helmcheck"
+	"github.com/yourorg/tf-modules/tests/internal/kubeverify"
+)
+
+// kindReleaseOnly lists releases whose controllers cannot become Ready
+// outside AWS. They are installed without waiting and checked only for the
+// release Helm recorded, not for running workloads.
+var kindReleaseOnly = map[string]string{
+	"external_dns":             "needs Route53",
+	"karpenter":                "checks EC2 connectivity at startup",
+	"node_termination_handler": "needs EC2 instance metadata",
+}
+
+// TestEksAddonsKind installs modules/aws/eks-addons into a kind cluster.
+// Charts come from the mirror chartmirror syncs into testdata/charts; the
+// IAM roles, SQS queue and EventBridge rules the module creates go to
+// LocalStack.
+// The EFS CSI driver is an EKS managed add-on and is not exercised.
+//
+// Each enable_* flag is first planned on its own and must produce exactly
+// its helm_release at the pinned chart version. With every flag on, the
+// planned values are rendered and checked offline by helmcheck. The flags
+// are then applied together and each release must be deployed at that
+// version, with its workloads Ready unless listed in kindReleaseOnly.
+//
+// Run with:
+//
+//	kind create cluster --name tfmodules
+//	kind get kubeconfig --name tfmodules > /tmp/kind.kubeconfig
+//	KIND_KUBECONFIG=/tmp/kind.kubeconfig LOCALSTACK_ENDPOINT=http://localhost:4566 \
+//	  go test ./aws/ -run EksAddonsKind -v -timeout 40m
+func TestEksAddonsKind(t *testing.T) {
+	kubeconfig := os.Getenv("KIND_KUBECONFIG")
+	endpoint := awsverify.LocalStackEndpoint()
+	if kubeconfig == "" || endpoint == "" {
+		t.Skipf("Skipping kind tests (KIND_KUBECONFIG and %s must be set)", awsverify.EnvLocalStackEndpoint)
+	}
+
+	const module = "../../modules/aws/eks-addons"
+	const mirror = "../testdata/charts"
+	const schemas = "../testdata/kubernetes"
+
+	releases, err := charts.Discover(module)
+	require.NoError(t, err)
+	problems, err := charts.Check(mirror, releases)
+	require.NoError(t, err)
+	require.Empty(t, problems, "the chart mirror is out of date; run go run ./cmd/chartmirror sync")
+
+	srv := httptest.NewServer(http.FileServer(http.Dir(mirror)))
+	defer srv.Close()
+
+	cluster, err := kubeverify.ReadKubeconfig(kubeconfig)
+	require.NoError(t, err)
+	client, err := kubeverify.NewClient(cluster)
+	require.NoError(t, err)
+
+	// vars enables the releases for which enabled returns true.
+	vars := func(enabled func(charts.Release) bool) map[string]interface{} {
+		v := map[string]interface{}{
+			"project":                fmt.Sprintf("test-%s", uniqueID(t)),
+			"environment":            "dev",
+			"cluster_name":           cluster.Name,
+			"cluster_endpoint":       cluster.Server,
+			"cluster_ca_certificate": base64.StdEncoding.EncodeToString(cluster.CAData),
+			"region":                 testRegion,
+			"oidc_provider_arn":      "arn:aws:iam::000000000000:oidc-provider/oidc.eks.us-east-1.amazonaws.com/id/KIND",
+			"oidc_provider_url":      "https://oidc.eks.us-east-1.amazonaws.com/id/KIND",
+			"vpc_id":                 "vpc-0kind",
+			"route53_zone_ids":       []string{"Z0KIND00000000"},
+			"enable_efs_csi_driver":  false,
+		}
+		for _, r := range releases {
+			v[r.Flag] = enabled(r)
+		}
+		return v
+	}
+
+	// The provider block and chart override go into isolate's private copy.
+	opts := &terraform.Options{TerraformDir: "../../modules/aws/eks-addons", Vars: vars(func(charts.Release) bool { return false })}
+	isolate(t, opts)
+	dir := opts.TerraformDir
+	require.NoError(t, awsverify.WriteLocalStackProvider(dir, endpoint, testRegion))
+	noWait := map[string]bool{}
+	for r := range kindReleaseOnly {
+		noWait[r] = true
+	}
+	require.NoError(t, charts.WriteOverride(dir, charts.Override{
+		Kubeconfig: kubeconfig,
+		MirrorURL:  srv.URL,
+		Releases:   releases,
+		NoWait:     noWait,
+	}))
+
+	t.Run("flags", func(t *testing.T) {
+		for _, r := range releases {
+			r := r
+			t.Run(r.Flag, func(t *testing.T) {
+				planOpts := *opts
+				planOpts.Vars = vars(func(o charts.Release) bool { return o.Flag == r.Flag })
+				plan := planAndShow(t, &planOpts)
+
+				var planned []string
+				for addr := range plan.ResourcePlannedValuesMap {
+					if strings.HasPrefix(addr, "helm_release.") {
+						planned = append(planned, addr)
+					}
+				}
+				require.Equal(t, []string{r.Address() + "[0]"}, planned)
+
+				values := plan.ResourcePlannedValuesMap[r.Address()+"[0]"].AttributeValues
+				assert.Equal(t, r.Name, values["name"])
+				assert.Equal(t, r.Namespace, values["namespace"])
+				assert.Equal(t, r.Chart, values["chart"])
+				assert.Equal(t, srv.URL, values["repository"])
+				assert.Equal(t, strings.TrimPrefix(r.Version, "v"), strings.TrimPrefix(fmt.Sprint(values["version"]), "v"),
+					"%s should pin %s", r.Address(), r.VersionVar)
+			})
+		}
+	})
+
+	opts.Vars = vars(func(charts.Release) bool { return true })
+
+	// Render every release offline first, for each Kubernetes version with
+	// a vendored schema, so chart and values problems show up before apply.
+	t.Run("values", func(t *testing.T) {
+		plan := planAndShow(t, opts)
+		versions, err := helmcheck.SchemaVersions(schemas)
+		require.NoError(t, err)
+		for _, v := range versions {
+			res, err := helmcheck.Run(&plan.RawPlan, helmcheck.Options{Charts: mirror, Schemas: schemas, KubeVersion: v})
+			require.NoError(t, err)
+			for _, p := range res.Problems {
+				t.Errorf("Kubernetes %s: %v", v, p)
+			}
+		}
+	})
+
+	tagRun(t, opts)
+	track(t, opts)
+	defer destroy(t, opts)
+	terraform.Apply(t, opts)
+	checkIdempotent(t, opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
+	defer cancel()
+	for _, r := range releases {
+		deployed, err := client.HelmReleases(ctx, r.Namespace)
+		require.NoError(t, err)
+		var got *kubeverify.HelmRelease
+		for i := range deployed {
+			if deployed[i].Name == r.Name {
+				got = &deployed[i]
+			}
+		}
+		if !assert.NotNil(t, got, "%s: no Helm release %s in %s", r.Address(), r.Name, r.Namespace) {
+			continue
+		}
+		assert.Equal(t, "deployed", got.Status, r.Address())
+		assert.Equal(t, r.Chart, got.Chart, r.Address())
+		assert.Equal(t, strings.TrimPrefix(r.Version, "v"), strings.TrimPrefix(got.ChartVersion, "v"), r.Address())
+
+		if reason, ok := kindReleaseOnly[r.Resource]; ok {
+			t.Logf("%s: not waiting for workloads on kind (%s)", r.Address(), reason)
+			continue
+		}
+		problems, err := kubeverify.Poll(ctx, 10*time.Second,
+			client.Workloads(r.Namespace, "app.kubernetes.io/instance="+r.Name))
+		require.NoError(t, err)
+		for _, p := range problems {
+			t.Errorf("%s: %v", r.Address(), p)
+		}
+	}
+}
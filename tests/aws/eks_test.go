@@ -14,6 +14,10 @@ import (
 // with the expected outputs. This is a smoke test — it validates cluster
 // creation and outputs, not full functionality.
 //
+// After apply it also checks nodes, kube-system pods, managed addons and
+// Pod Security labels through the Kubernetes API, which needs the AWS CLI
+// for aws eks get-token.
+//
 // This test creates real AWS resources and takes ~10 minutes.
 // Skip with: SKIP_EKS_TESTS=true go test ./aws/...
 func TestEksSmokeTest(t *testing.T) {
@@ -32,19 +36,23 @@ func TestEksSmokeTest(t *testing.T) {
 	uid := uniqueID(t)
 	project := fmt.Sprintf("test-%s", uid)
 
+	lease := leaseCIDR(t)
+	subnets, err := lease.Tiers(2, "public", "private")
+	require.NoError(t, err)
+
 	// First create a VPC for the cluster
 	vpcOpts := &terraform.Options{
 		TerraformDir: "../../modules/aws/vpc",
 		Vars: map[string]interface{}{
 			"project":     project,
 			"environment": "dev",
-			"vpc_cidr":    "10.200.0.0/16",
+			"vpc_cidr":    lease.CIDR(),
 			"availability_zones": []string{
 				fmt.Sprintf("%sa", region),
 				fmt.Sprintf("%sb", region),
 			},
-			"public_subnet_cidrs":  []string{"10.200.1.0/24", "10.200.2.0/24"},
-			"private_subnet_cidrs": []string{"10.200.10.0/24", "10.200.11.0/24"},
+			"public_subnet_cidrs":  subnets["public"],
+			"private_subnet_cidrs": subnets["private"],
 			"enable_nat_gateway":   true,
 			"single_nat_gateway":   true,
 		},
@@ -53,8 +61,8 @@ func TestEksSmokeTest(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, vpcOpts)
-	terraform.InitAndApply(t, vpcOpts)
+	defer destroy(t, vpcOpts)
+	initAndApply(t, vpcOpts)
 
 	vpcID := terraform.Output(t, vpcOpts, "vpc_id")
 	privateSubnetIDs := terraform.OutputList(t, vpcOpts, "private_subnet_ids")
@@ -84,14 +92,20 @@ func TestEksSmokeTest(t *testing.T) {
 			"enable_cluster_autoscaler_irsa": true,
 			// Disable all logs in tests to reduce cost
 			"enabled_cluster_log_types": []string{},
+			"pod_security_standards": map[string]string{
+				"apps": "restricted",
+			},
 		},
 		EnvVars: map[string]string{
 			"AWS_DEFAULT_REGION": region,
 		},
 	}
 
-	defer terraform.Destroy(t, eksOpts)
-	terraform.InitAndApply(t, eksOpts)
+	// EKS recreates the control plane log group if the cluster logs while
+	// it is being deleted.
+	watchLogGroups(t, region, fmt.Sprintf("/aws/eks/%s-dev-eks/", project))
+	defer destroy(t, eksOpts)
+	initAndApply(t, eksOpts)
 
 	// --- Validate EKS outputs ---
 
@@ -114,4 +128,8 @@ func TestEksSmokeTest(t *testing.T) {
 	caRoleARN := terraform.Output(t, eksOpts, "cluster_autoscaler_role_arn")
 	assert.NotEmpty(t, caRoleARN, "cluster_autoscaler_role_arn should be set when enable_cluster_autoscaler_irsa=true")
 	assert.Contains(t, caRoleARN, ":role/", "cluster_autoscaler_role_arn should be a valid IAM role ARN")
+
+	// --- Validate the cluster from the Kubernetes side ---
+
+	verifyEKSCluster(t, eksOpts, region, 1)
 }
@@ -37,8 +37,8 @@ func TestGuarddutyOutputs(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, opts)
-	terraform.InitAndApply(t, opts)
+	defer destroy(t, opts)
+	initAndApply(t, opts)
 
 	// GuardDuty detector outputs should be populated
 	detectorID := terraform.Output(t, opts, "detector_id")
@@ -75,8 +75,8 @@ func TestGuarddutyKubernetes(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, opts)
-	terraform.InitAndApply(t, opts)
+	defer destroy(t, opts)
+	initAndApply(t, opts)
 
 	detectorID := terraform.Output(t, opts, "detector_id")
 	require.NotEmpty(t, detectorID)
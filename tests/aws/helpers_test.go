@@ -1,10 +1,28 @@
 package aws_test
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/awsverify"
+	"github.com/yourorg/tf-modules/tests/internal/cidr"
+	"github.com/yourorg/tf-modules/tests/internal/idempotency"
+	"github.com/yourorg/tf-modules/tests/internal/kubeverify"
+	"github.com/yourorg/tf-modules/tests/internal/leftover"
+	"github.com/yourorg/tf-modules/tests/internal/teardown"
+	"github.com/yourorg/tf-modules/tests/internal/workdir"
 )
 
 func init() {
@@ -18,5 +36,387 @@ func uniqueID(t *testing.T) string {
 	return fmt.Sprintf("%d", rand.Intn(9000)+1000) //nolint:gosec
 }
 
+// leaseCIDR leases an address block for t from the shared pool so parallel
+// tests, including those in other packages, never reuse a range. The block
+// is released when t and its deferred destroys finish.
+func leaseCIDR(t *testing.T) *cidr.Lease {
+	t.Helper()
+	alloc, err := cidr.DefaultAllocator()
+	require.NoError(t, err)
+	lease, err := alloc.Lease(t.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if err := lease.Release(); err != nil {
+			t.Logf("releasing %s: %v", lease.CIDR(), err)
+		}
+	})
+	return lease
+}
+
+// verifyVPC queries EC2 for what an applied modules/aws/vpc actually built
+// and reports every routing, endpoint and flow log mismatch against the
+// module's outputs and opts.Vars.
+func verifyVPC(t *testing.T, opts *terraform.Options, region string) {
+	t.Helper()
+	boolVar := func(name string, def bool) bool {
+		if v, ok := opts.Vars[name].(bool); ok {
+			return v
+		}
+		return def
+	}
+	trafficType, _ := opts.Vars["flow_logs_traffic_type"].(string)
+
+	want := awsverify.VPC{
+		ID:                  terraform.Output(t, opts, "vpc_id"),
+		PublicSubnetIDs:     terraform.OutputList(t, opts, "public_subnet_ids"),
+		PrivateSubnetIDs:    terraform.OutputList(t, opts, "private_subnet_ids"),
+		InternetGatewayID:   terraform.Output(t, opts, "internet_gateway_id"),
+		EnableNATGateway:    boolVar("enable_nat_gateway", false),
+		SingleNATGateway:    boolVar("single_nat_gateway", true),
+		ECREndpoints:        boolVar("enable_ecr_vpc_endpoints", false),
+		S3Endpoint:          boolVar("enable_s3_vpc_endpoint", false),
+		SSMEndpoints:        boolVar("enable_ssm_vpc_endpoints", false),
+		FlowLogs:            boolVar("enable_flow_logs", false),
+		FlowLogsTrafficType: trafficType,
+	}
+
+	client, err := awsverify.NewEC2Client(region)
+	require.NoError(t, err)
+	problems, err := awsverify.Verify(context.Background(), client, want)
+	require.NoError(t, err)
+	for _, p := range problems {
+		t.Error(p)
+	}
+}
+
+// verifyEKSCluster checks an applied modules/aws/eks from the Kubernetes
+// side: at least nodes Ready nodes, healthy kube-system pods, managed addons
+// at the versions requested in opts.Vars, and the pod_security_standards
+// levels enforced once the module's psa_namespace_labels output is applied.
+func verifyEKSCluster(t *testing.T, opts *terraform.Options, region string, nodes int) {
+	t.Helper()
+	cluster, err := kubeverify.EKS(
+		terraform.Output(t, opts, "cluster_name"),
+		terraform.Output(t, opts, "cluster_endpoint"),
+		terraform.Output(t, opts, "cluster_certificate_authority"),
+		region,
+	)
+	require.NoError(t, err)
+	client, err := kubeverify.NewClient(cluster)
+	require.NoError(t, err)
+
+	// Null versions mean "latest": checked for rollout but not version.
+	addons := map[string]string{}
+	if enabled, ok := opts.Vars["enable_managed_addons"].(bool); !ok || enabled {
+		for name, v := range map[string]string{
+			"vpc-cni":    "vpc_cni_version",
+			"coredns":    "coredns_version",
+			"kube-proxy": "kube_proxy_version",
+		} {
+			addons[name], _ = opts.Vars[v].(string)
+		}
+		if versions, ok := opts.Vars["managed_addon_versions"].(map[string]string); ok {
+			for name, v := range versions {
+				addons[name] = v
+			}
+		}
+	}
+	levels, _ := opts.Vars["pod_security_standards"].(map[string]string)
+	labels := terraform.OutputMap(t, opts, "psa_namespace_labels")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	// Apply what the module tells callers to apply; PodSecurity then
+	// compares the result with the levels asked for.
+	require.NoError(t, client.ApplyNamespaceLabels(ctx, labels))
+	for _, check := range []kubeverify.Check{
+		client.NodesReady(nodes),
+		client.SystemPods,
+		client.AddonVersions(addons),
+		client.PodSecurity(levels),
+	} {
+		problems, err := kubeverify.Poll(ctx, 15*time.Second, check)
+		require.NoError(t, err)
+		for _, p := range problems {
+			t.Error(p)
+		}
+	}
+}
+
+var isolated sync.Map // *terraform.Options -> true
+
+// isolate points opts at a private copy of its module, made with
+// workdir.Copy so relative module sources still resolve, and runs
+// terraform init there against the provider plugin cache every test
+// shares (.history/plugin-cache, or TF_PLUGIN_CACHE_DIR). Parallel tests
+// applying the same module then never share .terraform or a local state
+// file. A module already copied outside the repository, e.g. with
+// files.CopyTerraformFolderToTemp, is initialised where it is. The copy is
+// removed after the test unless its fixture is still in the run manifest,
+// where tests/cmd/cleanup needs it. Isolating opts again does nothing.
+func isolate(t *testing.T, opts *terraform.Options) {
+	t.Helper()
+	if _, done := isolated.LoadOrStore(opts, true); done {
+		return
+	}
+	root, err := filepath.Abs("../..")
+	require.NoError(t, err)
+	dir, err := filepath.Abs(opts.TerraformDir)
+	require.NoError(t, err)
+	if rel, err := filepath.Rel(root, dir); err == nil && !strings.HasPrefix(rel, "..") {
+		parent, err := os.MkdirTemp("", "tf-modules-aws-")
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			if _, ok := tracked.Load(opts); ok {
+				t.Logf("keeping %s for go run ./cmd/cleanup", parent)
+				return
+			}
+			os.RemoveAll(parent)
+		})
+		opts.TerraformDir, err = workdir.Copy(root, dir, parent)
+		require.NoError(t, err)
+	}
+
+	cache, err := workdir.PluginCache("../.history/plugin-cache")
+	require.NoError(t, err)
+	opts.EnvVars = workdir.Env(opts.EnvVars, cache)
+	unlock, err := workdir.LockCache(cache)
+	require.NoError(t, err)
+	defer unlock()
+	terraform.Init(t, opts)
+}
+
+// initAndApply moves opts to its own working copy (see isolate), tags it
+// with the test's run tag (see tagRun), records it in the run manifest (see
+// track) and applies it, then plans again and fails the test on anything
+// the plan would still change; see checkIdempotent.
+func initAndApply(t *testing.T, opts *terraform.Options, allow ...idempotency.Allowance) {
+	t.Helper()
+	isolate(t, opts)
+	tagRun(t, opts)
+	track(t, opts)
+	terraform.Apply(t, opts)
+	checkIdempotent(t, opts, allow...)
+}
+
+// skipWithoutAWSCredentials skips t when no AWS credentials resolve for
+// region. Tests that only plan need it when the module reads data sources
+// such as aws_caller_identity.
+func skipWithoutAWSCredentials(t *testing.T, region string) {
+	t.Helper()
+	sess, err := awsverify.NewSession(region)
+	if err == nil {
+		_, err = sess.Config.Credentials.Get()
+	}
+	if err != nil {
+		t.Skipf("Skipping: no AWS credentials (%v)", err)
+	}
+}
+
+// checkIdempotent plans opts right after an apply and reports every
+// resource or output it would still change, with the attribute paths that
+// keep changing. Perpetual diffs the module's entry in
+// internal/idempotency/allowlist.yaml, or allow, accepts are skipped; set
+// SKIP_IDEMPOTENCY_CHECK to skip the plan while triaging.
+func checkIdempotent(t *testing.T, opts *terraform.Options, allow ...idempotency.Allowance) {
+	t.Helper()
+	if os.Getenv("SKIP_IDEMPOTENCY_CHECK") != "" {
+		t.Log("Skipping idempotency check (SKIP_IDEMPOTENCY_CHECK is set)")
+		return
+	}
+	module, err := idempotency.Module("../..", opts.TerraformDir, "aws")
+	require.NoError(t, err)
+	allowlist, err := idempotency.DefaultAllowlist()
+	require.NoError(t, err)
+
+	plan := planAndShow(t, opts)
+	findings, unused := idempotency.Check(&plan.RawPlan, append(allowlist[module], allow...))
+	for _, a := range unused {
+		t.Logf("idempotency allowance %s %s (%s) matched nothing and can be removed", a.Address, a.Path, a.Reason)
+	}
+	for _, f := range findings {
+		t.Errorf("%s is not idempotent: %s", module, f)
+	}
+}
+
+// planAndShow plans opts, which isolate has initialised, into a temporary
+// plan file and returns the plan. It does not run init, which would write
+// to the shared plugin cache without workdir.LockCache, and leaves opts
+// unchanged.
+func planAndShow(t *testing.T, opts *terraform.Options) *terraform.PlanStruct {
+	t.Helper()
+	planOpts := *opts
+	planOpts.Logger = logger.Discard
+	planOpts.PlanFilePath = filepath.Join(t.TempDir(), "tfplan")
+	terraform.Plan(t, &planOpts)
+	return terraform.ShowWithStruct(t, &planOpts)
+}
+
+// manifest is this binary's run manifest; see track.
+var (
+	manifestOnce sync.Once
+	manifest     *teardown.Run
+	manifestErr  error
+	stopWatch    func()
+	tracked      sync.Map // *terraform.Options -> fixture ID
+)
+
+// TestMain stops watching for signals and the deadline once every test has
+// run, and releases the run manifest.
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if stopWatch != nil {
+		stopWatch()
+		manifest.Close()
+	}
+	os.Exit(code)
+}
+
+// track records opts in the run manifest under .history/manifests before it
+// is applied, so it is still destroyed when go test -timeout expires or the
+// run is interrupted and the deferred destroys never run: on SIGINT or
+// SIGTERM, shortly before the deadline (teardown.Reserve), or by
+// tests/cmd/cleanup afterwards. Destroy tracked options with destroy.
+// Tracking opts again records its current vars.
+func track(t *testing.T, opts *terraform.Options) {
+	t.Helper()
+	manifestOnce.Do(func() {
+		reserve, err := teardown.Reserve()
+		if err != nil {
+			manifestErr = err
+			return
+		}
+		manifest, manifestErr = teardown.NewRun(teardown.Dir("../.history/manifests"), "aws")
+		if manifestErr == nil {
+			deadline, _ := t.Deadline()
+			stopWatch = manifest.Watch(deadline, reserve)
+		}
+	})
+	require.NoError(t, manifestErr)
+
+	untrack(t, opts)
+	f, err := manifest.Add(teardown.Fixture{
+		Test:     t.Name(),
+		Dir:      opts.TerraformDir,
+		Vars:     opts.Vars,
+		VarFiles: opts.VarFiles,
+		Env:      opts.EnvVars,
+		Tag:      runFor(t).tag,
+	})
+	require.NoError(t, err)
+	tracked.Store(opts, f.ID)
+}
+
+// untrack drops opts from the run manifest once it has been destroyed.
+func untrack(t *testing.T, opts *terraform.Options) {
+	t.Helper()
+	if id, ok := tracked.LoadAndDelete(opts); ok {
+		if err := manifest.Remove(id.(int)); err != nil {
+			t.Logf("updating %s: %v", manifest.Path(), err)
+		}
+	}
+}
+
+// destroy is terraform.Destroy for options recorded with track.
+func destroy(t *testing.T, opts *terraform.Options) {
+	t.Helper()
+	terraform.Destroy(t, opts)
+	untrack(t, opts)
+}
+
+// leftoverWait is how long the leftover check waits for the Resource Groups
+// Tagging API to stop listing resources destroy deleted.
+const leftoverWait = 3 * time.Minute
+
+// testRun is what a test's leftover check looks for.
+type testRun struct {
+	mu  sync.Mutex
+	tag string
+	// prefixes holds the log group prefixes to check, by region; every
+	// region the test applied in has an entry.
+	prefixes map[string][]string
+}
+
+var testRuns sync.Map
+
+// runFor returns t's run, registering its leftover check on first use.
+func runFor(t *testing.T) *testRun {
+	t.Helper()
+	v, loaded := testRuns.LoadOrStore(t.Name(), &testRun{
+		tag:      leftover.RunTag(t.Name(), uniqueID(t)+strconv.FormatInt(time.Now().Unix(), 36)),
+		prefixes: map[string][]string{},
+	})
+	run := v.(*testRun)
+	if !loaded {
+		t.Cleanup(func() {
+			testRuns.Delete(t.Name())
+			checkLeftovers(t, run)
+		})
+	}
+	return run
+}
+
+// tagRun adds the test's run tag, leftover.TagKey, to the tags input of
+// opts. Once the test and its deferred destroys finish, the Resource Groups
+// Tagging API is asked, in every region the test tagged something in, for
+// whatever still carries the tag; see checkLeftovers.
+func tagRun(t *testing.T, opts *terraform.Options) {
+	t.Helper()
+	run := runFor(t)
+	vars, err := leftover.Tag(opts.Vars, run.tag)
+	require.NoError(t, err)
+	opts.Vars = vars
+
+	region := opts.EnvVars["AWS_DEFAULT_REGION"]
+	if region == "" {
+		region = testRegion
+	}
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	if _, ok := run.prefixes[region]; !ok {
+		run.prefixes[region] = nil
+	}
+}
+
+// watchLogGroups adds the log groups under prefix in region to the test's
+// leftover check, tagged or not, for log groups a service recreates after
+// Terraform deleted them.
+func watchLogGroups(t *testing.T, region, prefix string) {
+	t.Helper()
+	run := runFor(t)
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	run.prefixes[region] = append(run.prefixes[region], prefix)
+}
+
+// checkLeftovers fails the test on anything left of run after destroy. With
+// PURGE_LEFTOVERS set, log groups and detached network interfaces are
+// deleted and only logged. Set SKIP_LEFTOVER_CHECK to skip it.
+func checkLeftovers(t *testing.T, run *testRun) {
+	if os.Getenv("SKIP_LEFTOVER_CHECK") != "" {
+		return
+	}
+	purge := os.Getenv("PURGE_LEFTOVERS") != ""
+	ctx, cancel := context.WithTimeout(context.Background(), leftoverWait)
+	defer cancel()
+	for region, prefixes := range run.prefixes {
+		sess, err := awsverify.NewSession(region)
+		if err != nil {
+			t.Errorf("checking leftovers in %s: %v", region, err)
+			continue
+		}
+		left, purged, err := leftover.Check(ctx, leftover.NewAWS(sess, run.tag, prefixes...), 15*time.Second, purge)
+		if err != nil {
+			t.Errorf("checking leftovers in %s: %v", region, err)
+		}
+		for _, r := range purged {
+			t.Logf("purged after destroy: %s", r)
+		}
+		for _, r := range left {
+			t.Errorf("left over after destroy (%s=%s): %s", leftover.TagKey, run.tag, r)
+		}
+	}
+}
+
 // testRegion is the AWS region used for all integration tests.
 const testRegion = "us-east-1"
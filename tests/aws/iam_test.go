@@ -8,10 +8,14 @@ import (
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/ghoidc"
 )
 
 // TestIamOidcProviderOutputs validates the IAM module creates the GitHub OIDC
-// provider and CI roles, returning expected ARN outputs.
+// provider and CI roles, returning expected ARN outputs, and that only the
+// listed repositories can assume the plan role and only apply_branch the
+// apply role, both as planned and once the policies are known.
 func TestIamOidcProviderOutputs(t *testing.T) {
 	t.Parallel()
 
@@ -22,25 +26,29 @@ func TestIamOidcProviderOutputs(t *testing.T) {
 
 	uid := uniqueID(t)
 	project := fmt.Sprintf("test-%s", uid)
+	repos := []string{fmt.Sprintf("test-org/test-repo-%s", uid)}
 
 	opts := &terraform.Options{
 		TerraformDir: "../../modules/aws/iam",
 		Vars: map[string]interface{}{
-			"project":     project,
-			"environment": "dev",
-			"github_org":  "test-org",
-			"github_repositories": []string{
-				fmt.Sprintf("test-org/test-repo-%s", uid),
-			},
-			"apply_branch": "main",
+			"project":             project,
+			"environment":         "dev",
+			"github_org":          "test-org",
+			"github_repositories": repos,
+			"apply_branch":        "main",
 		},
 		EnvVars: map[string]string{
 			"AWS_DEFAULT_REGION": region,
 		},
 	}
 
-	defer terraform.Destroy(t, opts)
-	terraform.InitAndApply(t, opts)
+	isolate(t, opts)
+	t.Run("trust", func(t *testing.T) { checkOidcTrust(t, opts, repos, "main") })
+
+	defer destroy(t, opts)
+	initAndApply(t, opts)
+
+	t.Run("trust after apply", func(t *testing.T) { checkOidcTrust(t, opts, repos, "main") })
 
 	// OIDC provider should exist
 	oidcArn := terraform.Output(t, opts, "oidc_provider_arn")
@@ -58,3 +66,19 @@ func TestIamOidcProviderOutputs(t *testing.T) {
 	assert.Contains(t, applyRoleArn, project, "apply role ARN should include project name")
 	assert.NotEqual(t, planRoleArn, applyRoleArn, "plan and apply roles should be distinct")
 }
+
+// checkOidcTrust simulates GitHub tokens against the planned plan and apply
+// role trust policies of the isolated opts and fails on every finding.
+func checkOidcTrust(t *testing.T, opts *terraform.Options, repos []string, branch string) {
+	plan := planAndShow(t, opts)
+	roles, err := ghoidc.Roles(&plan.RawPlan)
+	require.NoError(t, err)
+	res := ghoidc.Analyze(roles, []ghoidc.Expectation{
+		{Role: "aws_iam_role.plan", Repositories: repos},
+		{Role: "aws_iam_role.apply", Repositories: repos, Branch: branch},
+	})
+	require.NotEmpty(t, res.Cases)
+	for _, f := range res.Findings {
+		t.Error(f)
+	}
+}
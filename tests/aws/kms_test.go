@@ -3,11 +3,14 @@ package aws_test
 import (
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/keypolicy"
 )
 
 // TestKmsKeyOutputs validates the KMS module creates keys and returns
@@ -39,8 +42,8 @@ func TestKmsKeyOutputs(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, opts)
-	terraform.InitAndApply(t, opts)
+	defer destroy(t, opts)
+	initAndApply(t, opts)
 
 	// Logs key outputs should be populated
 	logsKeyArn := terraform.Output(t, opts, "logs_key_arn")
@@ -54,3 +57,100 @@ func TestKmsKeyOutputs(t *testing.T) {
 	stateKeyArn := terraform.Output(t, opts, "state_key_arn")
 	assert.Empty(t, stateKeyArn, "state_key_arn should be empty when enable_state_key=false")
 }
+
+// TestKmsKeyPolicies plans every combination of the key toggles and checks
+// that exactly the enabled keys and aliases are planned, that the account
+// root administers each key, that only the logs key admits CloudWatch Logs
+// and CloudTrail, and that rotation and the deletion window follow the
+// inputs. Nothing is applied, but the plans read data.aws_caller_identity,
+// so the test needs AWS credentials.
+func TestKmsKeyPolicies(t *testing.T) {
+	t.Parallel()
+
+	region := testRegion
+	if r := os.Getenv("AWS_REGION"); r != "" {
+		region = r
+	}
+	skipWithoutAWSCredentials(t, region)
+
+	uid := uniqueID(t)
+	project := fmt.Sprintf("test-%s", uid)
+	// isolate initialises a private copy once, away from TestKmsKeyOutputs,
+	// which runs in parallel on the same module; every case plans a copy of
+	// these options there.
+	module := &terraform.Options{
+		TerraformDir: "../../modules/aws/kms",
+		EnvVars: map[string]string{
+			"AWS_DEFAULT_REGION": region,
+		},
+	}
+	isolate(t, module)
+
+	// The rotation and deletion window settings vary across the cases so
+	// that each combination of keys also checks the settings reach every
+	// key.
+	for _, tc := range []struct {
+		logs, state, general bool
+		rotation             bool
+		window               int
+	}{
+		{logs: false, state: false, general: false, rotation: true, window: 7},
+		{logs: true, state: false, general: false, rotation: true, window: 30},
+		{logs: false, state: true, general: false, rotation: false, window: 7},
+		{logs: false, state: false, general: true, rotation: false, window: 30},
+		{logs: true, state: true, general: false, rotation: true, window: 7},
+		{logs: true, state: false, general: true, rotation: false, window: 7},
+		{logs: false, state: true, general: true, rotation: true, window: 30},
+		{logs: true, state: true, general: true, rotation: false, window: 30},
+	} {
+		logs, state, general := tc.logs, tc.state, tc.general
+		rotation, window := tc.rotation, tc.window
+
+		t.Run(fmt.Sprintf("logs=%t,state=%t,general=%t,rotation=%t,window=%d", logs, state, general, rotation, window), func(t *testing.T) {
+			opts := *module
+			opts.Vars = map[string]interface{}{
+				"project":                 project,
+				"environment":             "dev",
+				"enable_logs_key":         logs,
+				"enable_state_key":        state,
+				"enable_general_key":      general,
+				"deletion_window_in_days": window,
+				"enable_key_rotation":     rotation,
+			}
+			plan := planAndShow(t, &opts)
+
+			var want, planned []string
+			for name, enabled := range map[string]bool{"logs": logs, "state": state, "general": general} {
+				if enabled {
+					want = append(want, "aws_kms_key."+name+"[0]", "aws_kms_alias."+name+"[0]")
+				}
+			}
+			for addr := range plan.ResourcePlannedValuesMap {
+				if strings.HasPrefix(addr, "aws_kms_") {
+					planned = append(planned, addr)
+				}
+			}
+			assert.ElementsMatch(t, want, planned)
+
+			account := keypolicy.Account(&plan.RawPlan)
+			require.NotEmpty(t, account, "plan should read data.aws_caller_identity")
+			found, err := keypolicy.Keys(&plan.RawPlan)
+			require.NoError(t, err)
+			for _, k := range found {
+				require.NotNil(t, k.Policy, "%s policy should be known at plan time", k.Address)
+			}
+			findings := keypolicy.Check(found, keypolicy.Want{
+				Account: account,
+				Services: map[string][]string{
+					"logs.amazonaws.com":       {"aws_kms_key.logs"},
+					"cloudtrail.amazonaws.com": {"aws_kms_key.logs"},
+				},
+				Rotation:       rotation,
+				DeletionWindow: window,
+			})
+			for _, f := range findings {
+				t.Error(f)
+			}
+		})
+	}
+}
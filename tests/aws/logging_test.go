@@ -40,8 +40,8 @@ func TestLoggingSmokeTest(t *testing.T) {
 		NoColor: true,
 	}
 
-	defer terraform.Destroy(t, tfOpts)
-	terraform.InitAndApply(t, tfOpts)
+	defer destroy(t, tfOpts)
+	initAndApply(t, tfOpts)
 
 	logGroupName := terraform.Output(t, tfOpts, "log_group_name")
 	assert.NotEmpty(t, logGroupName, "log_group_name output must not be empty")
@@ -84,8 +84,8 @@ func TestLoggingWithCloudTrail(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, opts)
-	terraform.InitAndApply(t, opts)
+	defer destroy(t, opts)
+	initAndApply(t, opts)
 
 	// CloudTrail trail should be created
 	trailArn := terraform.Output(t, opts, "cloudtrail_arn")
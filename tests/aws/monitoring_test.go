@@ -35,8 +35,8 @@ func TestMonitoringSmokeTest(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, opts)
-	terraform.InitAndApply(t, opts)
+	defer destroy(t, opts)
+	initAndApply(t, opts)
 
 	// SNS topic should always be created
 	snsTopicArn := terraform.Output(t, opts, "sns_topic_arn")
@@ -35,8 +35,8 @@ func TestS3StateBucketEncryption(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, opts)
-	terraform.InitAndApply(t, opts)
+	defer destroy(t, opts)
+	initAndApply(t, opts)
 
 	// Bucket ID and name outputs should match the input
 	bucketID := terraform.Output(t, opts, "bucket_id")
@@ -38,8 +38,8 @@ func TestSecurityHubOutputs(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, opts)
-	terraform.InitAndApply(t, opts)
+	defer destroy(t, opts)
+	initAndApply(t, opts)
 
 	// Security Hub account should be enabled
 	hubArn := terraform.Output(t, opts, "hub_arn")
@@ -77,8 +77,8 @@ func TestSecurityHubCIS(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, opts)
-	terraform.InitAndApply(t, opts)
+	defer destroy(t, opts)
+	initAndApply(t, opts)
 
 	hubArn := terraform.Output(t, opts, "hub_arn")
 	require.NotEmpty(t, hubArn)
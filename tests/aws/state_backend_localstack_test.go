@@ -0,0 +1,180 @@
+package aws_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/awsverify"
+	"github.com/yourorg/tf-modules/tests/internal/tfstate"
+)
+
+// TestStateBackendLocalStack applies s3-state and dynamodb-lock, then uses
+// them as the backend of a scratch configuration the way environments/* do.
+// It checks that state lands under <environment>/<component>/terraform.tfstate,
+// that bucket versioning keeps the previous state, and that an apply
+// started while another holds the lock is refused.
+//
+// Run with: LOCALSTACK_ENDPOINT=http://localhost:4566 go test ./aws/ -run LocalStack
+func TestStateBackendLocalStack(t *testing.T) {
+	endpoint := awsverify.LocalStackEndpoint()
+	if endpoint == "" {
+		t.Skipf("Skipping LocalStack tests (%s not set)", awsverify.EnvLocalStackEndpoint)
+	}
+
+	t.Parallel()
+
+	region := testRegion
+	uid := uniqueID(t)
+
+	stateOpts := &terraform.Options{
+		TerraformDir: "../../modules/aws/s3-state",
+		Vars: map[string]interface{}{
+			"bucket_name":   fmt.Sprintf("tf-state-test-%s", uid),
+			"force_destroy": true,
+		},
+	}
+	isolateLocalStack(t, stateOpts, endpoint, region)
+	defer destroy(t, stateOpts)
+	initAndApply(t, stateOpts)
+
+	lockOpts := &terraform.Options{
+		TerraformDir: "../../modules/aws/dynamodb-lock",
+		Vars: map[string]interface{}{
+			"table_name":               fmt.Sprintf("tf-lock-test-%s", uid),
+			"enable_delete_protection": false,
+		},
+	}
+	isolateLocalStack(t, lockOpts, endpoint, region)
+	defer destroy(t, lockOpts)
+	initAndApply(t, lockOpts)
+
+	backend := tfstate.S3Backend{
+		Bucket:    terraform.Output(t, stateOpts, "bucket_id"),
+		Key:       tfstate.Key("dev", "backend-e2e-"+uid),
+		Region:    region,
+		LockTable: terraform.Output(t, lockOpts, "table_name"),
+		Endpoint:  endpoint,
+	}
+	// Terratest passes -lock=false unless Lock is set. isolate initialises
+	// the copy with the local backend; the first apply below re-initialises
+	// it against the S3 backend before any state exists.
+	backendOpts := &terraform.Options{TerraformDir: "../testdata/backend", Lock: true}
+	isolate(t, backendOpts)
+	require.NoError(t, tfstate.WriteBackend(backendOpts.TerraformDir, backend))
+	scratch := func(revision string, holdSeconds int) *terraform.Options {
+		opts := *backendOpts
+		opts.Vars = map[string]interface{}{"revision": revision, "hold_seconds": holdSeconds}
+		return &opts
+	}
+
+	sess, err := awsverify.NewSession(region)
+	require.NoError(t, err)
+	s3Client, db := s3.New(sess), dynamodb.New(sess)
+	ctx := context.Background()
+
+	defer terraform.Destroy(t, scratch("destroy", 0))
+	terraform.InitAndApply(t, scratch("1", 0))
+
+	t.Run("key", func(t *testing.T) {
+		out, err := s3Client.ListObjectsV2WithContext(ctx, &s3.ListObjectsV2Input{Bucket: aws.String(backend.Bucket)})
+		require.NoError(t, err)
+		var keys []string
+		for _, o := range out.Contents {
+			keys = append(keys, aws.StringValue(o.Key))
+		}
+		require.Equal(t, []string{backend.Key}, keys)
+		env, component, err := tfstate.ParseKey(keys[0])
+		require.NoError(t, err)
+		assert.Equal(t, "dev", env)
+		assert.Equal(t, "backend-e2e-"+uid, component)
+	})
+
+	terraform.Apply(t, scratch("2", 0))
+
+	t.Run("versioning", func(t *testing.T) {
+		out, err := s3Client.ListObjectVersionsWithContext(ctx, &s3.ListObjectVersionsInput{
+			Bucket: aws.String(backend.Bucket),
+			Prefix: aws.String(backend.Key),
+		})
+		require.NoError(t, err)
+		versions := out.Versions
+		require.GreaterOrEqual(t, len(versions), 2, "both applies should leave a version of %s", backend.Key)
+		sort.Slice(versions, func(i, j int) bool {
+			return aws.TimeValue(versions[i].LastModified).After(aws.TimeValue(versions[j].LastModified))
+		})
+		assert.True(t, aws.BoolValue(versions[0].IsLatest))
+
+		latest := stateRevision(t, s3Client, backend, versions[0].VersionId)
+		previous := stateRevision(t, s3Client, backend, versions[1].VersionId)
+		assert.Equal(t, "2", latest)
+		assert.Equal(t, "1", previous)
+	})
+
+	t.Run("lock", func(t *testing.T) {
+		// The deferred wait keeps the holding apply from outliving the
+		// subtest when a check below fails.
+		held := make(chan struct{})
+		var heldErr error
+		go func() {
+			defer close(held)
+			_, heldErr = terraform.ApplyE(t, scratch("3", 30))
+		}()
+		defer func() { <-held }()
+
+		waitCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+		defer cancel()
+		lock, err := tfstate.WaitForLock(waitCtx, db, backend, time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, "OperationTypeApply", lock.Operation)
+
+		_, err = terraform.ApplyE(t, scratch("4", 0))
+		require.Error(t, err, "an apply during another apply should fail")
+		assert.Contains(t, err.Error(), "Error acquiring the state lock")
+		assert.Contains(t, err.Error(), lock.ID, "the error should name the lock holding the state")
+
+		<-held
+		require.NoError(t, heldErr, "the apply holding the lock should succeed")
+		lock, err = tfstate.GetLock(ctx, db, backend)
+		require.NoError(t, err)
+		assert.Nil(t, lock, "the lock should be released after apply")
+		assert.Equal(t, "3", terraform.Output(t, scratch("3", 0), "revision"))
+	})
+}
+
+// isolateLocalStack moves opts to its private copy (see isolate) and adds a
+// provider block there that targets endpoint.
+func isolateLocalStack(t *testing.T, opts *terraform.Options, endpoint, region string) {
+	t.Helper()
+	isolate(t, opts)
+	require.NoError(t, awsverify.WriteLocalStackProvider(opts.TerraformDir, endpoint, region))
+}
+
+// stateRevision reads one version of the state object and returns its
+// revision output.
+func stateRevision(t *testing.T, client *s3.S3, b tfstate.S3Backend, versionID *string) string {
+	t.Helper()
+	out, err := client.GetObject(&s3.GetObjectInput{Bucket: aws.String(b.Bucket), Key: aws.String(b.Key), VersionId: versionID})
+	require.NoError(t, err)
+	defer out.Body.Close()
+	data, err := io.ReadAll(out.Body)
+	require.NoError(t, err)
+	var state struct {
+		Outputs map[string]struct {
+			Value interface{} `json:"value"`
+		} `json:"outputs"`
+	}
+	require.NoError(t, json.Unmarshal(data, &state))
+	return fmt.Sprint(state.Outputs["revision"].Value)
+}
@@ -0,0 +1,150 @@
+package aws_test
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/awsverify"
+	"github.com/yourorg/tf-modules/tests/internal/tfstate"
+)
+
+// TestStateMigrateLocalStack moves the testdata state from a local file to
+// an S3 key and from there to another key, using s3-state and
+// dynamodb-lock as the backend. It checks that the copies verify, that
+// locks are released afterwards, that a held lock stops the move and that
+// an older state never replaces a newer one.
+//
+// Run with: LOCALSTACK_ENDPOINT=http://localhost:4566 go test ./aws/ -run LocalStack
+func TestStateMigrateLocalStack(t *testing.T) {
+	endpoint := awsverify.LocalStackEndpoint()
+	if endpoint == "" {
+		t.Skipf("Skipping LocalStack tests (%s not set)", awsverify.EnvLocalStackEndpoint)
+	}
+
+	t.Parallel()
+
+	region := testRegion
+	uid := uniqueID(t)
+
+	stateOpts := &terraform.Options{
+		TerraformDir: "../../modules/aws/s3-state",
+		Vars: map[string]interface{}{
+			"bucket_name":   fmt.Sprintf("tf-state-migrate-%s", uid),
+			"force_destroy": true,
+		},
+	}
+	isolateLocalStack(t, stateOpts, endpoint, region)
+	defer destroy(t, stateOpts)
+	initAndApply(t, stateOpts)
+
+	lockOpts := &terraform.Options{
+		TerraformDir: "../../modules/aws/dynamodb-lock",
+		Vars: map[string]interface{}{
+			"table_name":               fmt.Sprintf("tf-lock-migrate-%s", uid),
+			"enable_delete_protection": false,
+		},
+	}
+	isolateLocalStack(t, lockOpts, endpoint, region)
+	defer destroy(t, lockOpts)
+	initAndApply(t, lockOpts)
+
+	sess, err := awsverify.NewSession(region)
+	require.NoError(t, err)
+	db := dynamodb.New(sess)
+	store := func(component string) *tfstate.S3Store {
+		return &tfstate.S3Store{S3: s3.New(sess), DynamoDB: db, Backend: tfstate.S3Backend{
+			Bucket:    terraform.Output(t, stateOpts, "bucket_id"),
+			Key:       tfstate.Key("dev", component),
+			Region:    region,
+			LockTable: terraform.Output(t, lockOpts, "table_name"),
+		}}
+	}
+	ctx := context.Background()
+	backups := t.TempDir()
+
+	fixture, err := os.ReadFile("../testdata/state/terraform.tfstate")
+	require.NoError(t, err)
+	local := &tfstate.LocalStore{Path: filepath.Join(t.TempDir(), "terraform.tfstate")}
+	require.NoError(t, os.WriteFile(local.Path, fixture, 0o644))
+	first, second := store("migrate-a-"+uid), store("migrate-b-"+uid)
+
+	assertUnlocked := func(t *testing.T, s *tfstate.S3Store) {
+		t.Helper()
+		lock, err := tfstate.GetLock(ctx, db, s.Backend)
+		require.NoError(t, err)
+		assert.Nil(t, lock, "%s should be unlocked", s)
+	}
+
+	t.Run("local to s3", func(t *testing.T) {
+		res, err := tfstate.Migrate(ctx, local, first, tfstate.MigrateOptions{BackupDir: backups})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(12), res.Serial)
+		assert.Equal(t, 2, res.Resources)
+		assert.Equal(t, 3, res.Instances)
+		require.Len(t, res.Backups, 1)
+
+		got, err := first.Get(ctx)
+		require.NoError(t, err, "the object should match its digest item")
+		assert.Equal(t, fixture, got)
+		assertUnlocked(t, first)
+		_, err = os.Stat(local.Path)
+		assert.NoError(t, err, "the source is kept without DeleteSource")
+
+		res, err = tfstate.Migrate(ctx, local, first, tfstate.MigrateOptions{BackupDir: backups})
+		require.NoError(t, err)
+		assert.True(t, res.Unchanged, "migrating again should change nothing")
+	})
+
+	t.Run("s3 to s3", func(t *testing.T) {
+		res, err := tfstate.Migrate(ctx, first, second, tfstate.MigrateOptions{BackupDir: backups, DeleteSource: true})
+		require.NoError(t, err)
+		assert.True(t, res.SourceDeleted)
+
+		got, err := second.Get(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, fixture, got)
+		got, err = first.Get(ctx)
+		require.NoError(t, err)
+		assert.Nil(t, got, "the source should be deleted")
+		assertUnlocked(t, first)
+		assertUnlocked(t, second)
+	})
+
+	t.Run("locked", func(t *testing.T) {
+		held := tfstate.NewLockInfo("OperationTypeApply", "", second.String())
+		require.NoError(t, second.Lock(ctx, held))
+		defer func() { require.NoError(t, second.Unlock(ctx, held.ID)) }()
+
+		_, err := tfstate.Migrate(ctx, local, second, tfstate.MigrateOptions{BackupDir: backups, Force: true})
+		var locked *tfstate.LockedError
+		require.ErrorAs(t, err, &locked)
+		require.NotNil(t, locked.Lock)
+		assert.Equal(t, held.ID, locked.Lock.ID)
+		_, err = os.Stat(filepath.Join(filepath.Dir(local.Path), ".terraform.tfstate.lock.info"))
+		assert.ErrorIs(t, err, fs.ErrNotExist, "the source lock should be released")
+	})
+
+	t.Run("older serial", func(t *testing.T) {
+		older := filepath.Join(t.TempDir(), "terraform.tfstate")
+		require.NoError(t, os.WriteFile(older, []byte(
+			`{"version":4,"serial":11,"lineage":"3f1c2a9e-7b4d-4e21-9c55-0d8f6a2b1e47","resources":[]}`), 0o644))
+
+		_, err := tfstate.Migrate(ctx, &tfstate.LocalStore{Path: older}, second, tfstate.MigrateOptions{BackupDir: backups})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "holds serial 12")
+		got, err := second.Get(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, fixture, got, "the newer state should be kept")
+		assertUnlocked(t, second)
+	})
+}
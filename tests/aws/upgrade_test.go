@@ -0,0 +1,167 @@
+package aws_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/awsverify"
+	"github.com/yourorg/tf-modules/tests/internal/upgrade"
+)
+
+// The upgrade tests apply a module from the previous release tag, then plan
+// the same state against the working tree and fail on any replace or
+// destroy not allowed below. They run against LocalStack when
+// LOCALSTACK_ENDPOINT is set and against AWS otherwise, and skip when no
+// earlier v* tag is available (set UPGRADE_FROM_REF to pick one).
+//
+// Run with: LOCALSTACK_ENDPOINT=http://localhost:4566 go test ./aws/ -run Upgrade
+
+// TestModuleUpgrades runs checkUpgrade for each module in the table, as a
+// parallel subtest named after the module. Add a module with the inputs
+// its smallest apply needs; modules without a release yet are skipped.
+func TestModuleUpgrades(t *testing.T) {
+	skipUpgrade(t)
+
+	region := upgradeRegion()
+	for _, tc := range []struct {
+		module string
+		opts   terraform.Options
+		vars   func(t *testing.T) map[string]interface{}
+	}{
+		{
+			module: "vpc",
+			opts:   terraform.Options{TerraformDir: "../../modules/aws/vpc"},
+			vars: func(t *testing.T) map[string]interface{} {
+				lease := leaseCIDR(t)
+				subnets, err := lease.Tiers(2, "public", "private")
+				require.NoError(t, err)
+				return map[string]interface{}{
+					"project":     fmt.Sprintf("test-%s", uniqueID(t)),
+					"environment": "dev",
+					"vpc_cidr":    lease.CIDR(),
+					"availability_zones": []string{
+						fmt.Sprintf("%sa", region),
+						fmt.Sprintf("%sb", region),
+					},
+					"public_subnet_cidrs":  subnets["public"],
+					"private_subnet_cidrs": subnets["private"],
+					"enable_nat_gateway":   true,
+					"single_nat_gateway":   false,
+				}
+			},
+		},
+		{
+			module: "s3-state",
+			opts:   terraform.Options{TerraformDir: "../../modules/aws/s3-state"},
+			vars: func(t *testing.T) map[string]interface{} {
+				return map[string]interface{}{
+					"bucket_name":   fmt.Sprintf("tf-state-upgrade-%s", uniqueID(t)),
+					"force_destroy": true,
+				}
+			},
+		},
+		{
+			module: "dynamodb-lock",
+			opts:   terraform.Options{TerraformDir: "../../modules/aws/dynamodb-lock"},
+			vars: func(t *testing.T) map[string]interface{} {
+				return map[string]interface{}{
+					"table_name":               fmt.Sprintf("tf-lock-upgrade-%s", uniqueID(t)),
+					"enable_delete_protection": false,
+				}
+			},
+		},
+	} {
+		tc := tc
+		t.Run(tc.module, func(t *testing.T) {
+			t.Parallel()
+			opts := tc.opts
+			opts.Vars = tc.vars(t)
+			opts.EnvVars = map[string]string{"AWS_DEFAULT_REGION": region}
+			checkUpgrade(t, &opts, nil)
+		})
+	}
+}
+
+func skipUpgrade(t *testing.T) {
+	t.Helper()
+	if os.Getenv("SKIP_UPGRADE_TESTS") != "" {
+		t.Skip("Skipping upgrade tests (SKIP_UPGRADE_TESTS is set)")
+	}
+}
+
+func upgradeRegion() string {
+	if r := os.Getenv("AWS_REGION"); r != "" && awsverify.LocalStackEndpoint() == "" {
+		return r
+	}
+	return testRegion
+}
+
+// checkUpgrade applies the module in opts.TerraformDir as it was at the
+// previous release, with previousVars if its inputs differed, then plans
+// the working tree's module over that state. Every replace or destroy not
+// covered by allow fails the test; allowances nothing needed are logged so
+// they can be dropped.
+func checkUpgrade(t *testing.T, opts *terraform.Options, previousVars map[string]interface{}, allow ...upgrade.Allowance) {
+	t.Helper()
+
+	repo, err := upgrade.RepoRoot(".")
+	require.NoError(t, err)
+	ref, err := upgrade.PreviousRelease(repo)
+	require.NoError(t, err)
+	if ref == "" {
+		t.Skipf("Skipping upgrade test (no earlier v* tag; fetch tags or set %s)", upgrade.EnvFromRef)
+	}
+	head, err := filepath.Abs(opts.TerraformDir)
+	require.NoError(t, err)
+	module, err := filepath.Rel(repo, head)
+	require.NoError(t, err)
+	ok, err := upgrade.HasPath(repo, ref, module)
+	require.NoError(t, err)
+	if !ok {
+		t.Skipf("Skipping upgrade test (%s is not in %s)", module, ref)
+	}
+
+	// The whole modules tree is exported so relative sources resolve.
+	work := t.TempDir()
+	require.NoError(t, upgrade.Export(repo, ref, "modules", work))
+	previous := filepath.Join(work, module)
+	root := filepath.Join(work, "root")
+	require.NoError(t, os.MkdirAll(root, 0o755))
+	if endpoint := awsverify.LocalStackEndpoint(); endpoint != "" {
+		require.NoError(t, awsverify.WriteLocalStackProvider(root, endpoint, opts.EnvVars["AWS_DEFAULT_REGION"]))
+	}
+	tagRun(t, opts)
+	if previousVars == nil {
+		previousVars = opts.Vars
+	}
+	rootOpts := &terraform.Options{TerraformDir: root, EnvVars: opts.EnvVars, Lock: true}
+
+	require.NoError(t, upgrade.WriteRoot(root, previous, previousVars))
+	defer func() {
+		// Destroy with whichever module last initialised; if HEAD's
+		// cannot, fall back to the release's.
+		if _, err := terraform.DestroyE(t, rootOpts); err != nil {
+			require.NoError(t, upgrade.WriteRoot(root, previous, previousVars))
+			terraform.Init(t, rootOpts)
+			terraform.Destroy(t, rootOpts)
+		}
+		untrack(t, rootOpts)
+	}()
+	track(t, rootOpts)
+	terraform.InitAndApply(t, rootOpts)
+
+	require.NoError(t, upgrade.WriteRoot(root, head, opts.Vars))
+	plan := terraform.InitAndPlanAndShowWithStructNoLogTempPlanFile(t, rootOpts)
+	findings, unused := upgrade.Check(&plan.RawPlan, allow)
+	for _, a := range unused {
+		t.Logf("allowance %s (%s) matched nothing and can be removed", a.Address, a.Reason)
+	}
+	for _, f := range findings {
+		t.Errorf("upgrading %s from %s: %s", module, ref, f)
+	}
+}
@@ -0,0 +1,67 @@
+package aws_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/awsverify"
+)
+
+// TestVpcLocalStack applies the VPC module with every routing and endpoint
+// feature on (per-AZ NAT, ECR/S3/SSM endpoints, flow logs) and verifies the
+// result through the EC2 API. It only runs against LocalStack, where NAT
+// gateways and interface endpoints cost nothing.
+//
+// Run with: LOCALSTACK_ENDPOINT=http://localhost:4566 go test ./aws/ -run LocalStack
+func TestVpcLocalStack(t *testing.T) {
+	endpoint := awsverify.LocalStackEndpoint()
+	if endpoint == "" {
+		t.Skipf("Skipping LocalStack tests (%s not set)", awsverify.EnvLocalStackEndpoint)
+	}
+
+	t.Parallel()
+
+	region := testRegion
+	uid := uniqueID(t)
+
+	lease := leaseCIDR(t)
+	subnets, err := lease.Tiers(2, "public", "private")
+	require.NoError(t, err)
+
+	opts := &terraform.Options{
+		TerraformDir: "../../modules/aws/vpc",
+		Vars: map[string]interface{}{
+			"project":     fmt.Sprintf("test-%s", uid),
+			"environment": "dev",
+			"vpc_cidr":    lease.CIDR(),
+			"availability_zones": []string{
+				fmt.Sprintf("%sa", region),
+				fmt.Sprintf("%sb", region),
+			},
+			"public_subnet_cidrs":      subnets["public"],
+			"private_subnet_cidrs":     subnets["private"],
+			"enable_nat_gateway":       true,
+			"single_nat_gateway":       false,
+			"enable_ecr_vpc_endpoints": true,
+			"enable_s3_vpc_endpoint":   true,
+			"enable_ssm_vpc_endpoints": true,
+			"enable_flow_logs":         true,
+			"flow_logs_destination":    "cloud-watch-logs",
+			"flow_logs_traffic_type":   "REJECT",
+			"flow_logs_cloudwatch_log_group_name": fmt.Sprintf(
+				"arn:aws:logs:%s:000000000000:log-group:/vpc/test-%s", region, uid),
+		},
+	}
+
+	// The provider goes into the private copy isolate makes.
+	isolate(t, opts)
+	require.NoError(t, awsverify.WriteLocalStackProvider(opts.TerraformDir, endpoint, region))
+
+	defer destroy(t, opts)
+	initAndApply(t, opts)
+
+	verifyVPC(t, opts, region)
+}
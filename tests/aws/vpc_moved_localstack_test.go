@@ -0,0 +1,119 @@
+package aws_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/awsverify"
+	"github.com/yourorg/tf-modules/tests/internal/moved"
+)
+
+// countAssociations is aws_route_table_association.private as it was before
+// the for_each refactor (C177).
+const countAssociations = `resource "aws_route_table_association" "private" {
+  count = local.private_subnet_count
+
+  subnet_id      = aws_subnet.private[count.index].id
+  route_table_id = aws_route_table.private[var.single_nat_gateway ? 0 : count.index].id
+}`
+
+// TestVpcMovedLocalStack applies the VPC module as it was before the
+// private route table associations moved from count to for_each, then
+// plans the current module over that state. Without moved.tf the plan
+// recreates the associations and internal/moved pairs every one of them;
+// with it, nothing is recreated.
+//
+// Run with: LOCALSTACK_ENDPOINT=http://localhost:4566 go test ./aws/ -run LocalStack
+func TestVpcMovedLocalStack(t *testing.T) {
+	endpoint := awsverify.LocalStackEndpoint()
+	if endpoint == "" {
+		t.Skipf("Skipping LocalStack tests (%s not set)", awsverify.EnvLocalStackEndpoint)
+	}
+
+	t.Parallel()
+
+	region := testRegion
+	uid := uniqueID(t)
+
+	lease := leaseCIDR(t)
+	subnets, err := lease.Tiers(2, "public", "private")
+	require.NoError(t, err)
+	opts := &terraform.Options{
+		TerraformDir: "../../modules/aws/vpc",
+		Vars: map[string]interface{}{
+			"project":     fmt.Sprintf("test-%s", uid),
+			"environment": "dev",
+			"vpc_cidr":    lease.CIDR(),
+			"availability_zones": []string{
+				fmt.Sprintf("%sa", region),
+				fmt.Sprintf("%sb", region),
+			},
+			"public_subnet_cidrs":  subnets["public"],
+			"private_subnet_cidrs": subnets["private"],
+			"enable_nat_gateway":   true,
+			"single_nat_gateway":   false,
+		},
+	}
+	// The test rewrites main.tf and moved.tf, so it works in isolate's
+	// private copy of the module.
+	isolate(t, opts)
+	dir := opts.TerraformDir
+	require.NoError(t, awsverify.WriteLocalStackProvider(dir, endpoint, region))
+
+	current, err := os.ReadFile(filepath.Join(dir, "main.tf"))
+	require.NoError(t, err)
+	movedTF, err := os.ReadFile(filepath.Join(dir, "moved.tf"))
+	require.NoError(t, err)
+	forEach := `resource "aws_route_table_association" "private" {
+  for_each = local.private_subnet_route_table_index
+
+  subnet_id      = aws_subnet.private[each.key].id
+  route_table_id = aws_route_table.private[each.value].id
+}`
+	require.Contains(t, string(current), forEach, "the association block changed; update countAssociations")
+	writeConfig := func(main string, withMoved bool) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(main), 0o644))
+		if withMoved {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "moved.tf"), movedTF, 0o644))
+		} else {
+			require.NoError(t, os.Remove(filepath.Join(dir, "moved.tf")))
+		}
+	}
+
+	writeConfig(strings.Replace(string(current), forEach, countAssociations, 1), false)
+	defer destroy(t, opts)
+	initAndApply(t, opts)
+
+	t.Run("generate", func(t *testing.T) {
+		writeConfig(string(current), false)
+		plan := planAndShow(t, opts)
+		require.Error(t, moved.Verify(&plan.RawPlan), "without moved blocks the refactor recreates the associations")
+
+		res := moved.Match(moved.FromPlan(&plan.RawPlan))
+		assert.Empty(t, res.UnmatchedOld)
+		assert.Empty(t, res.UnmatchedNew)
+		require.Len(t, res.Moves, 2)
+		for i, m := range res.Moves {
+			assert.Equal(t, fmt.Sprintf("aws_route_table_association.private[%d]", i), m.From)
+			assert.Equal(t, fmt.Sprintf("aws_route_table_association.private[%q]", fmt.Sprint(i)), m.To)
+			assert.Equal(t, "attributes subnet_id, route_table_id", m.By)
+
+			hcl, err := moved.HCL([]moved.Move{m}, "")
+			require.NoError(t, err)
+			assert.Contains(t, string(movedTF), strings.TrimPrefix(hcl, moved.Header), "moved.tf should hold the generated block")
+		}
+	})
+
+	t.Run("verify", func(t *testing.T) {
+		writeConfig(string(current), true)
+		plan := planAndShow(t, opts)
+		assert.NoError(t, moved.Verify(&plan.RawPlan))
+	})
+}
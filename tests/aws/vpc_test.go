@@ -24,18 +24,22 @@ func TestVpcHappyPath(t *testing.T) {
 	uid := uniqueID(t)
 	project := fmt.Sprintf("test-%s", uid)
 
+	lease := leaseCIDR(t)
+	subnets, err := lease.Tiers(2, "public", "private")
+	require.NoError(t, err)
+
 	opts := &terraform.Options{
 		TerraformDir: "../../modules/aws/vpc",
 		Vars: map[string]interface{}{
 			"project":     project,
 			"environment": "dev",
-			"vpc_cidr":    "10.100.0.0/16",
+			"vpc_cidr":    lease.CIDR(),
 			"availability_zones": []string{
 				fmt.Sprintf("%sa", region),
 				fmt.Sprintf("%sb", region),
 			},
-			"public_subnet_cidrs":  []string{"10.100.1.0/24", "10.100.2.0/24"},
-			"private_subnet_cidrs": []string{"10.100.10.0/24", "10.100.11.0/24"},
+			"public_subnet_cidrs":  subnets["public"],
+			"private_subnet_cidrs": subnets["private"],
 			"enable_nat_gateway":   false,
 			"single_nat_gateway":   true,
 			"tags": map[string]string{
@@ -47,8 +51,8 @@ func TestVpcHappyPath(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, opts)
-	terraform.InitAndApply(t, opts)
+	defer destroy(t, opts)
+	initAndApply(t, opts)
 
 	// --- Validate outputs ---
 
@@ -56,7 +60,7 @@ func TestVpcHappyPath(t *testing.T) {
 	require.NotEmpty(t, vpcID, "vpc_id output should not be empty")
 
 	vpcCIDR := terraform.Output(t, opts, "vpc_cidr")
-	assert.Equal(t, "10.100.0.0/16", vpcCIDR)
+	assert.Equal(t, lease.CIDR(), vpcCIDR)
 
 	// Validate public subnets
 	publicSubnetIDs := terraform.OutputList(t, opts, "public_subnet_ids")
@@ -67,9 +71,12 @@ func TestVpcHappyPath(t *testing.T) {
 	assert.Len(t, privateSubnetIDs, 2, "expected 2 private subnets")
 
 	// Validate subnets are in the correct VPC
+	vpcSubnets := map[string]bool{}
+	for _, subnet := range aws.GetSubnetsForVpc(t, vpcID, region) {
+		vpcSubnets[subnet.Id] = true
+	}
 	for _, subnetID := range append(publicSubnetIDs, privateSubnetIDs...) {
-		subnet := aws.GetSubnetById(t, subnetID, region)
-		assert.Equal(t, vpcID, subnet.VpcId, "subnet should belong to the created VPC")
+		assert.True(t, vpcSubnets[subnetID], "subnet %s should belong to the created VPC", subnetID)
 	}
 
 	// Validate IGW exists
@@ -93,4 +100,8 @@ func TestVpcHappyPath(t *testing.T) {
 
 	// Re-assert private subnet count explicitly for regression protection
 	assert.Equal(t, 2, len(privateSubnetIDs), "private subnet count must remain 2")
+
+	// Validate what EC2 reports: IGW default route on public subnets, no
+	// default route on private subnets, no endpoints or flow logs.
+	verifyVPC(t, opts, region)
 }
@@ -41,8 +41,8 @@ func TestWafOutputs(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, opts)
-	terraform.InitAndApply(t, opts)
+	defer destroy(t, opts)
+	initAndApply(t, opts)
 
 	// WAF Web ACL outputs should be populated
 	webAclID := terraform.Output(t, opts, "web_acl_id")
@@ -83,8 +83,8 @@ func TestWafRegionalScope(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, opts)
-	terraform.InitAndApply(t, opts)
+	defer destroy(t, opts)
+	initAndApply(t, opts)
 
 	webAclID := terraform.Output(t, opts, "web_acl_id")
 	require.NotEmpty(t, webAclID)
@@ -38,13 +38,17 @@ func TestAksSmokeTest(t *testing.T) {
 			"location":    location,
 		},
 	}
-	defer terraform.Destroy(t, rgOpts)
-	terraform.InitAndApply(t, rgOpts)
+	defer destroy(t, rgOpts)
+	initAndApply(t, rgOpts)
 
 	rgName := terraform.Output(t, rgOpts, "name")
 	require.NotEmpty(t, rgName)
 
 	// VNet
+	lease := leaseCIDR(t)
+	subnets, err := lease.Tiers(1, "aks-system")
+	require.NoError(t, err)
+
 	vnetOpts := &terraform.Options{
 		TerraformDir: "../../modules/azure/vnet",
 		Vars: map[string]interface{}{
@@ -52,16 +56,16 @@ func TestAksSmokeTest(t *testing.T) {
 			"environment":         "dev",
 			"resource_group_name": rgName,
 			"location":            location,
-			"address_space":       []string{"10.60.0.0/16"},
+			"address_space":       []string{lease.CIDR()},
 			"subnets": map[string]interface{}{
 				"aks-system": map[string]interface{}{
-					"address_prefixes": []string{"10.60.1.0/24"},
+					"address_prefixes": subnets["aks-system"],
 				},
 			},
 		},
 	}
-	defer terraform.Destroy(t, vnetOpts)
-	terraform.InitAndApply(t, vnetOpts)
+	defer destroy(t, vnetOpts)
+	initAndApply(t, vnetOpts)
 
 	subnetIDs := terraform.OutputMap(t, vnetOpts, "subnet_ids")
 	systemSubnetID := subnetIDs["aks-system"]
@@ -82,8 +86,8 @@ func TestAksSmokeTest(t *testing.T) {
 			"system_node_pool_max_count":    2,
 		},
 	}
-	defer terraform.Destroy(t, aksOpts)
-	terraform.InitAndApply(t, aksOpts)
+	defer destroy(t, aksOpts)
+	initAndApply(t, aksOpts)
 
 	clusterName := terraform.Output(t, aksOpts, "cluster_name")
 	assert.Equal(t, fmt.Sprintf("aks-%s-dev", project), clusterName)
@@ -101,4 +105,7 @@ func TestAksSmokeTest(t *testing.T) {
 	// Validate user_node_pool_ids is an empty map when no user pools are configured
 	nodePoolIDs := terraform.OutputMap(t, aksOpts, "user_node_pool_ids")
 	assert.Empty(t, nodePoolIDs, "user_node_pool_ids should be an empty map when user_node_pools is not configured")
+
+	// Validate the cluster from the Kubernetes side
+	verifyAKSCluster(t, aksOpts, 1)
 }
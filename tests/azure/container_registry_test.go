@@ -40,8 +40,8 @@ func TestContainerRegistrySmokeTest(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, rgOpts)
-	terraform.InitAndApply(t, rgOpts)
+	defer destroy(t, rgOpts)
+	initAndApply(t, rgOpts)
 
 	rgName := terraform.Output(t, rgOpts, "resource_group_name")
 	require.NotEmpty(t, rgName)
@@ -58,8 +58,8 @@ func TestContainerRegistrySmokeTest(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, acrOpts)
-	terraform.InitAndApply(t, acrOpts)
+	defer destroy(t, acrOpts)
+	initAndApply(t, acrOpts)
 
 	// --- Validate outputs ---
 
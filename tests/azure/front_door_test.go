@@ -49,9 +49,8 @@ func TestFrontDoorOutputs(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, opts)
-	_, err := terraform.InitAndApplyE(t, opts)
-	require.NoError(t, err, "terraform apply failed for azure/front-door module")
+	defer destroy(t, opts)
+	initAndApply(t, opts)
 
 	// Profile outputs should be populated
 	profileID := terraform.Output(t, opts, "profile_id")
@@ -100,9 +99,8 @@ func TestFrontDoorMinimal(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, opts)
-	_, err := terraform.InitAndApplyE(t, opts)
-	require.NoError(t, err, "terraform apply should succeed with minimal config")
+	defer destroy(t, opts)
+	initAndApply(t, opts)
 
 	profileID := terraform.Output(t, opts, "profile_id")
 	require.NotEmpty(t, profileID)
@@ -1,10 +1,27 @@
 package azure_test
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/cidr"
+	"github.com/yourorg/tf-modules/tests/internal/idempotency"
+	"github.com/yourorg/tf-modules/tests/internal/kubeverify"
+	"github.com/yourorg/tf-modules/tests/internal/leftover"
+	"github.com/yourorg/tf-modules/tests/internal/teardown"
+	"github.com/yourorg/tf-modules/tests/internal/workdir"
 )
 
 func init() {
@@ -17,5 +34,272 @@ func uniqueID(t *testing.T) string {
 	return fmt.Sprintf("%d", rand.Intn(9000)+1000) //nolint:gosec
 }
 
+// leaseCIDR leases an address block for t from the shared pool so parallel
+// tests, including those in other packages, never reuse a range. The block
+// is released when t and its deferred destroys finish.
+func leaseCIDR(t *testing.T) *cidr.Lease {
+	t.Helper()
+	alloc, err := cidr.DefaultAllocator()
+	require.NoError(t, err)
+	lease, err := alloc.Lease(t.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if err := lease.Release(); err != nil {
+			t.Logf("releasing %s: %v", lease.CIDR(), err)
+		}
+	})
+	return lease
+}
+
+// verifyAKSCluster checks an applied modules/azure/aks from the Kubernetes
+// side using its kube_config output: at least nodes Ready nodes and
+// healthy kube-system pods.
+func verifyAKSCluster(t *testing.T, opts *terraform.Options, nodes int) {
+	t.Helper()
+	cluster, err := kubeverify.ParseKubeconfig([]byte(terraform.Output(t, opts, "kube_config")))
+	require.NoError(t, err)
+	client, err := kubeverify.NewClient(cluster)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	for _, check := range []kubeverify.Check{
+		client.NodesReady(nodes),
+		client.SystemPods,
+	} {
+		problems, err := kubeverify.Poll(ctx, 15*time.Second, check)
+		require.NoError(t, err)
+		for _, p := range problems {
+			t.Error(p)
+		}
+	}
+}
+
+var isolated sync.Map // *terraform.Options -> true
+
+// isolate points opts at a private copy of its module, made with
+// workdir.Copy so relative module sources still resolve, and runs
+// terraform init there against the provider plugin cache every test
+// shares (.history/plugin-cache, or TF_PLUGIN_CACHE_DIR). Parallel tests
+// applying the same module then never share .terraform or a local state
+// file. A module already copied outside the repository, e.g. with
+// files.CopyTerraformFolderToTemp, is initialised where it is. The copy is
+// removed after the test unless its fixture is still in the run manifest,
+// where tests/cmd/cleanup needs it. Isolating opts again does nothing.
+func isolate(t *testing.T, opts *terraform.Options) {
+	t.Helper()
+	if _, done := isolated.LoadOrStore(opts, true); done {
+		return
+	}
+	root, err := filepath.Abs("../..")
+	require.NoError(t, err)
+	dir, err := filepath.Abs(opts.TerraformDir)
+	require.NoError(t, err)
+	if rel, err := filepath.Rel(root, dir); err == nil && !strings.HasPrefix(rel, "..") {
+		parent, err := os.MkdirTemp("", "tf-modules-azure-")
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			if _, ok := tracked.Load(opts); ok {
+				t.Logf("keeping %s for go run ./cmd/cleanup", parent)
+				return
+			}
+			os.RemoveAll(parent)
+		})
+		opts.TerraformDir, err = workdir.Copy(root, dir, parent)
+		require.NoError(t, err)
+	}
+
+	cache, err := workdir.PluginCache("../.history/plugin-cache")
+	require.NoError(t, err)
+	opts.EnvVars = workdir.Env(opts.EnvVars, cache)
+	unlock, err := workdir.LockCache(cache)
+	require.NoError(t, err)
+	defer unlock()
+	terraform.Init(t, opts)
+}
+
+// initAndApply moves opts to its own working copy (see isolate), tags it
+// with the test's run tag (see tagRun), records it in the run manifest (see
+// track) and applies it, then plans again and fails the test on anything
+// the plan would still change; see checkIdempotent.
+func initAndApply(t *testing.T, opts *terraform.Options, allow ...idempotency.Allowance) {
+	t.Helper()
+	isolate(t, opts)
+	tagRun(t, opts)
+	track(t, opts)
+	terraform.Apply(t, opts)
+	checkIdempotent(t, opts, allow...)
+}
+
+// checkIdempotent plans opts right after an apply and reports every
+// resource or output it would still change, with the attribute paths that
+// keep changing. Perpetual diffs the module's entry in
+// internal/idempotency/allowlist.yaml, or allow, accepts are skipped; set
+// SKIP_IDEMPOTENCY_CHECK to skip the plan while triaging.
+func checkIdempotent(t *testing.T, opts *terraform.Options, allow ...idempotency.Allowance) {
+	t.Helper()
+	if os.Getenv("SKIP_IDEMPOTENCY_CHECK") != "" {
+		t.Log("Skipping idempotency check (SKIP_IDEMPOTENCY_CHECK is set)")
+		return
+	}
+	module, err := idempotency.Module("../..", opts.TerraformDir, "azure")
+	require.NoError(t, err)
+	allowlist, err := idempotency.DefaultAllowlist()
+	require.NoError(t, err)
+
+	plan := planAndShow(t, opts)
+	findings, unused := idempotency.Check(&plan.RawPlan, append(allowlist[module], allow...))
+	for _, a := range unused {
+		t.Logf("idempotency allowance %s %s (%s) matched nothing and can be removed", a.Address, a.Path, a.Reason)
+	}
+	for _, f := range findings {
+		t.Errorf("%s is not idempotent: %s", module, f)
+	}
+}
+
+// planAndShow plans opts, which isolate has initialised, into a temporary
+// plan file and returns the plan. It does not run init, which would write
+// to the shared plugin cache without workdir.LockCache, and leaves opts
+// unchanged.
+func planAndShow(t *testing.T, opts *terraform.Options) *terraform.PlanStruct {
+	t.Helper()
+	planOpts := *opts
+	planOpts.Logger = logger.Discard
+	planOpts.PlanFilePath = filepath.Join(t.TempDir(), "tfplan")
+	terraform.Plan(t, &planOpts)
+	return terraform.ShowWithStruct(t, &planOpts)
+}
+
+// manifest is this binary's run manifest; see track.
+var (
+	manifestOnce sync.Once
+	manifest     *teardown.Run
+	manifestErr  error
+	stopWatch    func()
+	tracked      sync.Map // *terraform.Options -> fixture ID
+)
+
+// TestMain stops watching for signals and the deadline once every test has
+// run, and releases the run manifest.
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if stopWatch != nil {
+		stopWatch()
+		manifest.Close()
+	}
+	os.Exit(code)
+}
+
+// track records opts in the run manifest under .history/manifests before it
+// is applied, so it is still destroyed when go test -timeout expires or the
+// run is interrupted and the deferred destroys never run: on SIGINT or
+// SIGTERM, shortly before the deadline (teardown.Reserve), or by
+// tests/cmd/cleanup afterwards. Destroy tracked options with destroy.
+// Tracking opts again records its current vars.
+func track(t *testing.T, opts *terraform.Options) {
+	t.Helper()
+	manifestOnce.Do(func() {
+		reserve, err := teardown.Reserve()
+		if err != nil {
+			manifestErr = err
+			return
+		}
+		manifest, manifestErr = teardown.NewRun(teardown.Dir("../.history/manifests"), "azure")
+		if manifestErr == nil {
+			deadline, _ := t.Deadline()
+			stopWatch = manifest.Watch(deadline, reserve)
+		}
+	})
+	require.NoError(t, manifestErr)
+
+	untrack(t, opts)
+	f, err := manifest.Add(teardown.Fixture{
+		Test:     t.Name(),
+		Dir:      opts.TerraformDir,
+		Vars:     opts.Vars,
+		VarFiles: opts.VarFiles,
+		Env:      opts.EnvVars,
+		Tag:      runTag(t),
+	})
+	require.NoError(t, err)
+	tracked.Store(opts, f.ID)
+}
+
+// untrack drops opts from the run manifest once it has been destroyed.
+func untrack(t *testing.T, opts *terraform.Options) {
+	t.Helper()
+	if id, ok := tracked.LoadAndDelete(opts); ok {
+		if err := manifest.Remove(id.(int)); err != nil {
+			t.Logf("updating %s: %v", manifest.Path(), err)
+		}
+	}
+}
+
+// destroy is terraform.Destroy for options recorded with track.
+func destroy(t *testing.T, opts *terraform.Options) {
+	t.Helper()
+	terraform.Destroy(t, opts)
+	untrack(t, opts)
+}
+
+// leftoverWait is how long the leftover check waits for Resource Graph to
+// stop listing resources destroy deleted.
+const leftoverWait = 3 * time.Minute
+
+var runTags sync.Map
+
+// tagRun adds the test's run tag, leftover.TagKey, to the tags input of
+// opts. The first call for a test registers a check that, once the test
+// and its deferred destroys finish, asks Resource Graph and the deleted
+// Key Vault list for whatever still carries the tag; see checkLeftovers.
+func tagRun(t *testing.T, opts *terraform.Options) {
+	t.Helper()
+	v, loaded := runTags.LoadOrStore(t.Name(), leftover.RunTag(t.Name(), uniqueID(t)+strconv.FormatInt(time.Now().Unix(), 36)))
+	tag := v.(string)
+	if !loaded {
+		t.Cleanup(func() {
+			runTags.Delete(t.Name())
+			checkLeftovers(t, tag)
+		})
+	}
+	vars, err := leftover.Tag(opts.Vars, tag)
+	require.NoError(t, err)
+	opts.Vars = vars
+}
+
+// runTag returns the run tag tagRun gave the test, if any.
+func runTag(t *testing.T) string {
+	v, _ := runTags.Load(t.Name())
+	tag, _ := v.(string)
+	return tag
+}
+
+// checkLeftovers fails the test on anything left of the run tagged tag
+// after destroy. With PURGE_LEFTOVERS set, soft-deleted Key Vaults without
+// purge protection are purged and only logged. Set SKIP_LEFTOVER_CHECK to
+// skip it.
+func checkLeftovers(t *testing.T, tag string) {
+	if os.Getenv("SKIP_LEFTOVER_CHECK") != "" {
+		return
+	}
+	finder, err := leftover.NewAzure(tag)
+	if err != nil {
+		t.Errorf("checking leftovers: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), leftoverWait)
+	defer cancel()
+	left, purged, err := leftover.Check(ctx, finder, 15*time.Second, os.Getenv("PURGE_LEFTOVERS") != "")
+	if err != nil {
+		t.Errorf("checking leftovers: %v", err)
+	}
+	for _, r := range purged {
+		t.Logf("purged after destroy: %s", r)
+	}
+	for _, r := range left {
+		t.Errorf("left over after destroy (%s=%s): %s", leftover.TagKey, tag, r)
+	}
+}
+
 // testLocation is the Azure region used for all integration tests.
 const testLocation = "eastus"
@@ -40,8 +40,8 @@ func TestKeyVaultSmokeTest(t *testing.T) {
 		},
 		NoColor: true,
 	}
-	defer terraform.Destroy(t, rgOpts)
-	terraform.InitAndApply(t, rgOpts)
+	defer destroy(t, rgOpts)
+	initAndApply(t, rgOpts)
 
 	rgName := terraform.Output(t, rgOpts, "name")
 	require.NotEmpty(t, rgName)
@@ -65,8 +65,8 @@ func TestKeyVaultSmokeTest(t *testing.T) {
 		},
 		NoColor: true,
 	}
-	defer terraform.Destroy(t, kvOpts)
-	terraform.InitAndApply(t, kvOpts)
+	defer destroy(t, kvOpts)
+	initAndApply(t, kvOpts)
 
 	kvID := terraform.Output(t, kvOpts, "id")
 	assert.NotEmpty(t, kvID, "id output must not be empty")
@@ -46,9 +46,8 @@ func TestAzureMonitoringAlertOutputs(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, rgOpts)
-	_, err := terraform.InitAndApplyE(t, rgOpts)
-	require.NoError(t, err, "terraform apply failed for resource-group module")
+	defer destroy(t, rgOpts)
+	initAndApply(t, rgOpts)
 
 	rgName := terraform.Output(t, rgOpts, "name")
 	require.NotEmpty(t, rgName, "resource group name should not be empty")
@@ -67,9 +66,8 @@ func TestAzureMonitoringAlertOutputs(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, monOpts)
-	_, err = terraform.InitAndApplyE(t, monOpts)
-	require.NoError(t, err, "terraform apply failed for azure/monitoring module")
+	defer destroy(t, monOpts)
+	initAndApply(t, monOpts)
 
 	cpuAlertID := terraform.Output(t, monOpts, "cpu_alert_id")
 	memAlertID := terraform.Output(t, monOpts, "memory_alert_id")
@@ -38,13 +38,15 @@ func TestPrivateDnsSmokeTest(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, rgOpts)
-	terraform.InitAndApply(t, rgOpts)
+	defer destroy(t, rgOpts)
+	initAndApply(t, rgOpts)
 
 	rgName := terraform.Output(t, rgOpts, "resource_group_name")
 	require.NotEmpty(t, rgName)
 
 	// Create a VNet to link to the DNS zone
+	lease := leaseCIDR(t)
+
 	vnetOpts := &terraform.Options{
 		TerraformDir: "../../modules/azure/vnet",
 		Vars: map[string]interface{}{
@@ -52,13 +54,13 @@ func TestPrivateDnsSmokeTest(t *testing.T) {
 			"environment":         "dev",
 			"resource_group_name": rgName,
 			"location":            testLocation,
-			"address_space":       []string{"10.100.0.0/16"},
+			"address_space":       []string{lease.CIDR()},
 			"subnets":             map[string]interface{}{},
 		},
 	}
 
-	defer terraform.Destroy(t, vnetOpts)
-	terraform.InitAndApply(t, vnetOpts)
+	defer destroy(t, vnetOpts)
+	initAndApply(t, vnetOpts)
 
 	vnetID := terraform.Output(t, vnetOpts, "vnet_id")
 	require.NotEmpty(t, vnetID)
@@ -77,8 +79,8 @@ func TestPrivateDnsSmokeTest(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, dnsOpts)
-	terraform.InitAndApply(t, dnsOpts)
+	defer destroy(t, dnsOpts)
+	initAndApply(t, dnsOpts)
 
 	// --- Validate outputs ---
 
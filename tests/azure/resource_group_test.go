@@ -8,7 +8,6 @@ import (
 
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/require"
 )
 
 // TestResourceGroupOutputs validates the azure/resource-group module creates
@@ -39,9 +38,8 @@ func TestResourceGroupOutputs(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, opts)
-	_, err := terraform.InitAndApplyE(t, opts)
-	require.NoError(t, err, "terraform apply failed for azure/resource-group module")
+	defer destroy(t, opts)
+	initAndApply(t, opts)
 
 	outName := terraform.Output(t, opts, "name")
 	outLocation := terraform.Output(t, opts, "location")
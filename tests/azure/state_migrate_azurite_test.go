@@ -0,0 +1,161 @@
+package azure_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/awsverify"
+	"github.com/yourorg/tf-modules/tests/internal/tfstate"
+)
+
+// TestStateMigrateAzurite moves the testdata state from a local file to a
+// blob and between blob keys on Azurite, locking them with leases as the
+// azurerm backend does. With LocalStack available too it also moves the
+// state from S3 to a blob and back.
+//
+// Run with: AZURITE_BLOB_ENDPOINT=http://127.0.0.1:10000/devstoreaccount1 go test ./azure/ -run Azurite
+func TestStateMigrateAzurite(t *testing.T) {
+	endpoint := os.Getenv(tfstate.EnvAzuriteEndpoint)
+	if endpoint == "" {
+		t.Skipf("Skipping Azurite tests (%s not set)", tfstate.EnvAzuriteEndpoint)
+	}
+
+	t.Parallel()
+
+	ctx := context.Background()
+	uid := uniqueID(t)
+	blob := tfstate.AzureBlob{Account: tfstate.AzuriteAccount, Key: tfstate.AzuriteKey, Endpoint: endpoint}
+	container := "tfstate" + uid
+	require.NoError(t, blob.CreateContainer(ctx, container))
+	store := func(component string) *tfstate.AzureStore {
+		return &tfstate.AzureStore{Blob: blob, Container: container, Key: tfstate.Key("dev", component)}
+	}
+	backups := t.TempDir()
+
+	fixture, err := os.ReadFile("../testdata/state/terraform.tfstate")
+	require.NoError(t, err)
+	local := &tfstate.LocalStore{Path: filepath.Join(t.TempDir(), "terraform.tfstate")}
+	require.NoError(t, os.WriteFile(local.Path, fixture, 0o644))
+	first, second := store("migrate-a"), store("migrate-b")
+
+	// assertUnlocked takes and releases the lock with a fresh client.
+	assertUnlocked := func(t *testing.T, s *tfstate.AzureStore) {
+		t.Helper()
+		other := &tfstate.AzureStore{Blob: s.Blob, Container: s.Container, Key: s.Key}
+		info := tfstate.NewLockInfo(tfstate.MigrateOperation, "", other.String())
+		require.NoError(t, other.Lock(ctx, info), "%s should be unlocked", s)
+		require.NoError(t, other.Unlock(ctx, info.ID))
+	}
+
+	t.Run("local to blob", func(t *testing.T) {
+		res, err := tfstate.Migrate(ctx, local, first, tfstate.MigrateOptions{BackupDir: backups, DeleteSource: true})
+		require.NoError(t, err)
+		assert.Equal(t, 2, res.Resources)
+		assert.Equal(t, 3, res.Instances)
+
+		got, err := first.Get(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, fixture, got)
+		assertUnlocked(t, first)
+	})
+
+	t.Run("blob to blob", func(t *testing.T) {
+		res, err := tfstate.Migrate(ctx, first, second, tfstate.MigrateOptions{BackupDir: backups})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(12), res.Serial)
+
+		got, err := second.Get(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, fixture, got)
+		assertUnlocked(t, first)
+		assertUnlocked(t, second)
+	})
+
+	t.Run("leased", func(t *testing.T) {
+		holder := store("migrate-b")
+		held := tfstate.NewLockInfo("OperationTypeApply", "", holder.String())
+		require.NoError(t, holder.Lock(ctx, held))
+		defer func() { require.NoError(t, holder.Unlock(ctx, held.ID)) }()
+
+		_, err := tfstate.Migrate(ctx, first, second, tfstate.MigrateOptions{BackupDir: backups, Force: true})
+		var locked *tfstate.LockedError
+		require.ErrorAs(t, err, &locked)
+		require.NotNil(t, locked.Lock, "the lock info should be read from the blob metadata")
+		assert.Equal(t, held.ID, locked.Lock.ID)
+		assertUnlocked(t, first)
+	})
+
+	t.Run("s3 and blob", func(t *testing.T) {
+		if awsverify.LocalStackEndpoint() == "" {
+			t.Skipf("Skipping S3 migration (%s not set)", awsverify.EnvLocalStackEndpoint)
+		}
+		s3Store := localStackStore(t, uid)
+		third := store("migrate-c")
+
+		require.NoError(t, s3Store.Put(ctx, fixture))
+		_, err := tfstate.Migrate(ctx, s3Store, third, tfstate.MigrateOptions{BackupDir: backups, DeleteSource: true})
+		require.NoError(t, err)
+		got, err := s3Store.Get(ctx)
+		require.NoError(t, err)
+		assert.Nil(t, got, "the S3 source should be deleted")
+
+		_, err = tfstate.Migrate(ctx, third, s3Store, tfstate.MigrateOptions{BackupDir: backups})
+		require.NoError(t, err)
+		got, err = s3Store.Get(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, fixture, got)
+		lock, err := tfstate.GetLock(ctx, s3Store.DynamoDB, s3Store.Backend)
+		require.NoError(t, err)
+		assert.Nil(t, lock)
+	})
+}
+
+// localStackStore creates a bucket and lock table on LocalStack with the
+// SDK, removing them when t finishes, and returns a store in them.
+func localStackStore(t *testing.T, uid string) *tfstate.S3Store {
+	t.Helper()
+	const region = "us-east-1"
+	sess, err := awsverify.NewSession(region)
+	require.NoError(t, err)
+	s3Client, db := s3.New(sess), dynamodb.New(sess)
+	bucket, table := fmt.Sprintf("tf-state-azurite-%s", uid), fmt.Sprintf("tf-lock-azurite-%s", uid)
+
+	_, err = s3Client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String(bucket)})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		out, err := s3Client.ListObjectsV2(&s3.ListObjectsV2Input{Bucket: aws.String(bucket)})
+		if err == nil {
+			for _, o := range out.Contents {
+				s3Client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: o.Key}) //nolint:errcheck
+			}
+		}
+		s3Client.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String(bucket)}) //nolint:errcheck
+	})
+
+	_, err = db.CreateTable(&dynamodb.CreateTableInput{
+		TableName:            aws.String(table),
+		BillingMode:          aws.String(dynamodb.BillingModePayPerRequest),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{{AttributeName: aws.String("LockID"), AttributeType: aws.String("S")}},
+		KeySchema:            []*dynamodb.KeySchemaElement{{AttributeName: aws.String("LockID"), KeyType: aws.String("HASH")}},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		db.DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String(table)}) //nolint:errcheck
+	})
+
+	return &tfstate.S3Store{S3: s3Client, DynamoDB: db, Backend: tfstate.S3Backend{
+		Bucket:    bucket,
+		Key:       tfstate.Key("dev", "migrate-c"),
+		Region:    region,
+		LockTable: table,
+	}}
+}
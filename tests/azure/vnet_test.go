@@ -32,10 +32,14 @@ func TestVnetEgressDenyRule(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, rgOpts)
-	terraform.InitAndApply(t, rgOpts)
+	defer destroy(t, rgOpts)
+	initAndApply(t, rgOpts)
 	rgName := terraform.Output(t, rgOpts, "name")
 
+	lease := leaseCIDR(t)
+	subnets, err := lease.Tiers(1, "restricted")
+	require.NoError(t, err)
+
 	vnetOpts := &terraform.Options{
 		TerraformDir: "../../modules/azure/vnet",
 		Vars: map[string]interface{}{
@@ -43,18 +47,18 @@ func TestVnetEgressDenyRule(t *testing.T) {
 			"environment":         "dev",
 			"resource_group_name": rgName,
 			"location":            location,
-			"address_space":       []string{"10.60.0.0/16"},
+			"address_space":       []string{lease.CIDR()},
 			"subnets": map[string]interface{}{
 				"restricted": map[string]interface{}{
-					"address_prefixes":       []string{"10.60.1.0/24"},
+					"address_prefixes":       subnets["restricted"],
 					"deny_outbound_internet": true,
 				},
 			},
 		},
 	}
 
-	defer terraform.Destroy(t, vnetOpts)
-	terraform.InitAndApply(t, vnetOpts)
+	defer destroy(t, vnetOpts)
+	initAndApply(t, vnetOpts)
 
 	// NSG and subnet IDs should exist for the restricted subnet
 	nsgIDs := terraform.OutputMap(t, vnetOpts, "nsg_ids")
@@ -84,12 +88,16 @@ func TestVnetHappyPath(t *testing.T) {
 		},
 	}
 
-	defer terraform.Destroy(t, rgOpts)
-	terraform.InitAndApply(t, rgOpts)
+	defer destroy(t, rgOpts)
+	initAndApply(t, rgOpts)
 
 	rgName := terraform.Output(t, rgOpts, "name")
 	require.NotEmpty(t, rgName, "resource group name should not be empty")
 
+	lease := leaseCIDR(t)
+	subnets, err := lease.Tiers(1, "app")
+	require.NoError(t, err)
+
 	vnetOpts := &terraform.Options{
 		TerraformDir: "../../modules/azure/vnet",
 		Vars: map[string]interface{}{
@@ -97,17 +105,17 @@ func TestVnetHappyPath(t *testing.T) {
 			"environment":         "dev",
 			"resource_group_name": rgName,
 			"location":            location,
-			"address_space":       []string{"10.50.0.0/16"},
+			"address_space":       []string{lease.CIDR()},
 			"subnets": map[string]interface{}{
 				"app": map[string]interface{}{
-					"address_prefixes": []string{"10.50.1.0/24"},
+					"address_prefixes": subnets["app"],
 				},
 			},
 		},
 	}
 
-	defer terraform.Destroy(t, vnetOpts)
-	terraform.InitAndApply(t, vnetOpts)
+	defer destroy(t, vnetOpts)
+	initAndApply(t, vnetOpts)
 
 	// Validate outputs
 	vnetID := terraform.Output(t, vnetOpts, "vnet_id")
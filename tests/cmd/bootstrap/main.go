@@ -0,0 +1,239 @@
+// Command bootstrap plans or applies the remote state bootstrap config and
+// writes the backend.tf of every environment from its outputs.
+//
+// Usage (from tests/):
+//
+//	go run ./cmd/bootstrap -var project=tfmodules -var region=us-east-1
+//	go run ./cmd/bootstrap -var project=tfmodules -var region=us-east-1 -apply -write
+//	go run ./cmd/bootstrap -cloud azure -var project=tfmodules -var storage_account_name=sttfstate1234 -apply -write
+//
+// -cloud aws uses bootstrap/ (S3 bucket, DynamoDB lock table and optional
+// KMS key); -cloud azure uses bootstrap/azure (resource group, storage
+// account and container). Without -apply the bootstrap config is only
+// planned and the backend values come from its planned outputs. Each
+// environment gets the key <environment>/<component>/terraform.tfstate.
+// The command always prints a diff of the backend files it would change;
+// -write, which needs -apply, writes them. Empty placeholder backend
+// blocks in the environments are removed. Re-running it with the same
+// outputs changes nothing.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+	"github.com/yourorg/tf-modules/tests/internal/tfstate"
+)
+
+type vars []string
+
+func (v *vars) String() string { return strings.Join(*v, ",") }
+
+func (v *vars) Set(s string) error {
+	if !strings.Contains(s, "=") {
+		return fmt.Errorf("want name=value, got %q", s)
+	}
+	*v = append(*v, s)
+	return nil
+}
+
+type options struct {
+	cloud        string
+	bootstrapDir string
+	vars         vars
+	apply        bool
+	write        bool
+	envDir       string
+	environments string
+	component    string
+	terraform    string
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.cloud, "cloud", "aws", "backend to bootstrap: aws or azure")
+	flag.StringVar(&o.bootstrapDir, "bootstrap-dir", "", "bootstrap config (default: ../bootstrap, or ../bootstrap/azure for -cloud azure)")
+	flag.Var(&o.vars, "var", "bootstrap variable as name=value (repeatable)")
+	flag.BoolVar(&o.apply, "apply", false, "apply the bootstrap config instead of planning it")
+	flag.BoolVar(&o.write, "write", false, "write the backend files (needs -apply)")
+	flag.StringVar(&o.envDir, "environments-dir", "../environments", "directory holding one root module per environment")
+	flag.StringVar(&o.environments, "environments", strings.Join(tfstate.Environments, ","), "comma-separated environments to configure")
+	flag.StringVar(&o.component, "component", "platform", "component part of the state key")
+	flag.StringVar(&o.terraform, "terraform", "terraform", "terraform or tofu binary")
+	flag.Parse()
+
+	if err := run(o, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "bootstrap:", err)
+		os.Exit(1)
+	}
+}
+
+func run(o options, w, log io.Writer) error {
+	if o.write && !o.apply {
+		return errors.New("-write needs -apply, so backends never point at resources that do not exist yet")
+	}
+	dir := o.bootstrapDir
+	var backend func(key string) tfstate.Backend
+	switch o.cloud {
+	case "aws":
+		if dir == "" {
+			dir = "../bootstrap"
+		}
+	case "azure":
+		if dir == "" {
+			dir = "../bootstrap/azure"
+		}
+	default:
+		return fmt.Errorf("unknown -cloud %q", o.cloud)
+	}
+
+	tf := runner{bin: o.terraform, dir: dir, log: log}
+	if err := tf.run(nil, "init", "-input=false"); err != nil {
+		return err
+	}
+	var outputs map[string]interface{}
+	var err error
+	if o.apply {
+		outputs, err = tf.applyOutputs(o.vars)
+	} else {
+		outputs, err = tf.plannedOutputs(o.vars)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch o.cloud {
+	case "aws":
+		b, err := tfstate.S3BackendFromOutputs(outputs)
+		if err != nil {
+			return err
+		}
+		backend = func(key string) tfstate.Backend { b.Key = key; return b }
+	case "azure":
+		b, err := tfstate.AzureBackendFromOutputs(outputs)
+		if err != nil {
+			return err
+		}
+		backend = func(key string) tfstate.Backend { b.Key = key; return b }
+	}
+
+	pending := 0
+	for _, env := range strings.Split(o.environments, ",") {
+		env = strings.TrimSpace(env)
+		key := tfstate.Key(env, o.component)
+		if _, _, err := tfstate.ParseKey(key); err != nil {
+			return err
+		}
+		changes, err := tfstate.PlanBackend(filepath.Join(o.envDir, env), backend(key))
+		if err != nil {
+			return err
+		}
+		for _, c := range changes {
+			if !c.Changed() {
+				continue
+			}
+			pending++
+			fmt.Fprint(w, c.Diff())
+			if o.write {
+				if err := c.Write(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	switch {
+	case pending == 0:
+		fmt.Fprintln(log, "backend files are up to date")
+	case o.write:
+		fmt.Fprintf(log, "wrote %d file(s)\n", pending)
+	default:
+		fmt.Fprintf(log, "%d file(s) would change; re-run with -apply -write to write them\n", pending)
+	}
+	return nil
+}
+
+// runner runs terraform in the bootstrap config, sending its progress to
+// log so that stdout carries only the diff.
+type runner struct {
+	bin string
+	dir string
+	log io.Writer
+}
+
+func (r runner) run(stdout io.Writer, args ...string) error {
+	cmd := exec.Command(r.bin, append([]string{"-chdir=" + r.dir}, args...)...)
+	cmd.Stdout, cmd.Stderr = r.log, r.log
+	if stdout != nil {
+		cmd.Stdout = stdout
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %w", r.bin, args[0], err)
+	}
+	return nil
+}
+
+func varArgs(vs vars) []string {
+	var args []string
+	for _, v := range vs {
+		args = append(args, "-var", v)
+	}
+	return args
+}
+
+func (r runner) applyOutputs(vs vars) (map[string]interface{}, error) {
+	if err := r.run(nil, append([]string{"apply", "-input=false", "-auto-approve"}, varArgs(vs)...)...); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := r.run(&out, "output", "-json"); err != nil {
+		return nil, err
+	}
+	var raw map[string]struct {
+		Value interface{} `json:"value"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &raw); err != nil {
+		return nil, fmt.Errorf("terraform output: %w", err)
+	}
+	outputs := make(map[string]interface{}, len(raw))
+	for name, o := range raw {
+		outputs[name] = o.Value
+	}
+	return outputs, nil
+}
+
+func (r runner) plannedOutputs(vs vars) (map[string]interface{}, error) {
+	tmp, err := os.MkdirTemp("", "bootstrap-plan")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	planFile := filepath.Join(tmp, "tfplan")
+	if err := r.run(nil, append([]string{"plan", "-input=false", "-out=" + planFile}, varArgs(vs)...)...); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := r.run(&out, "show", "-json", planFile); err != nil {
+		return nil, err
+	}
+	plan, err := planjson.Parse(out.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	outputs := map[string]interface{}{}
+	if plan.PlannedValues != nil {
+		for name, o := range plan.PlannedValues.Outputs {
+			outputs[name] = o.Value
+		}
+	}
+	return outputs, nil
+}
@@ -0,0 +1,132 @@
+// Command chartmirror keeps the local Helm chart mirror in
+// testdata/charts in step with the helm_release resources of the modules
+// under test.
+//
+// Usage (from tests/):
+//
+//	go run ./cmd/chartmirror sync
+//	go run ./cmd/chartmirror check
+//	go run ./cmd/chartmirror sync -dir testdata/charts ../modules/aws/eks-addons
+//
+// sync downloads each chart version a module pins (classic repositories
+// and oci:// registries), verifies it against the upstream digest, and
+// writes it with a Helm index.yaml; charts no release uses are removed.
+// check reports missing, stale or altered archives without network access
+// and exits 2 if there are any. Run sync and commit testdata/charts after
+// changing a chart version variable.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/yourorg/tf-modules/tests/internal/charts"
+)
+
+var errOutOfDate = errors.New("chart mirror is out of date")
+
+// defaultModules are the modules whose charts the mirror holds.
+var defaultModules = []string{"../modules/aws/eks-addons"}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(1)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "sync":
+		err = sync(os.Args[2:], os.Stdout)
+	case "check":
+		err = check(os.Args[2:], os.Stdout)
+	default:
+		usage()
+		os.Exit(1)
+	}
+	switch {
+	case errors.Is(err, errOutOfDate):
+		fmt.Fprintln(os.Stderr, "chartmirror:", err)
+		os.Exit(2)
+	case errors.Is(err, flag.ErrHelp):
+		os.Exit(1)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "chartmirror:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: chartmirror sync|check [-dir testdata/charts] [module dirs]")
+}
+
+// parse handles the flags both subcommands share and returns the mirror
+// directory and the releases of the given (or default) modules.
+func parse(name string, args []string) (string, []charts.Release, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	dir := fs.String("dir", "testdata/charts", "mirror directory")
+	if err := fs.Parse(args); err != nil {
+		return "", nil, err
+	}
+	modules := fs.Args()
+	if len(modules) == 0 {
+		modules = defaultModules
+	}
+	var releases []charts.Release
+	for _, m := range modules {
+		rs, err := charts.Discover(m)
+		if err != nil {
+			return "", nil, err
+		}
+		releases = append(releases, rs...)
+	}
+	return *dir, releases, nil
+}
+
+func sync(args []string, w io.Writer) error {
+	dir, releases, err := parse("sync", args)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	res, err := charts.Sync(ctx, dir, releases, charts.HTTPFetcher{Client: &http.Client{Timeout: 2 * time.Minute}})
+	if err != nil {
+		return err
+	}
+	for _, c := range res.Fetched {
+		fmt.Fprintln(w, "fetched", c)
+	}
+	for _, c := range res.Kept {
+		fmt.Fprintln(w, "kept   ", c)
+	}
+	for _, f := range res.Pruned {
+		fmt.Fprintln(w, "pruned ", f)
+	}
+	return nil
+}
+
+func check(args []string, w io.Writer) error {
+	dir, releases, err := parse("check", args)
+	if err != nil {
+		return err
+	}
+	problems, err := charts.Check(dir, releases)
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		fmt.Fprintln(w, p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %d problems; run go run ./cmd/chartmirror sync", errOutOfDate, len(problems))
+	}
+	fmt.Fprintf(w, "%d charts in %s match the modules\n", len(releases), dir)
+	return nil
+}
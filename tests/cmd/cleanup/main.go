@@ -0,0 +1,191 @@
+// Command cleanup destroys the fixtures test binaries left in their run
+// manifests, when they were killed before they could.
+//
+// Usage (from tests/):
+//
+//	go run ./cmd/cleanup -list
+//	go run ./cmd/cleanup
+//	go run ./cmd/cleanup -forget -timeout 90m
+//
+// The aws and azure tests record every fixture they apply in a manifest
+// under .history/manifests (TEST_MANIFEST_DIR) and remove it once
+// destroyed; see internal/teardown. cleanup destroys what is still
+// recorded, newest first, in every manifest whose binary is no longer
+// running, with the same vars and environment the test used, and deletes
+// the manifests it empties. Manifests of running binaries are skipped.
+// A fixture whose working directory is gone cannot be destroyed this way;
+// -forget drops it from its manifest and prints its run tag so its
+// resources can be found and deleted by hand. -list only prints the
+// manifests. Ctrl-C interrupts terraform cleanly, as -timeout does.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/yourorg/tf-modules/tests/internal/leftover"
+	"github.com/yourorg/tf-modules/tests/internal/teardown"
+)
+
+type options struct {
+	dir       string
+	list      bool
+	format    string
+	forget    bool
+	timeout   time.Duration
+	terraform string
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.dir, "dir", teardown.Dir(".history/manifests"), "manifest directory (default $TEST_MANIFEST_DIR or .history/manifests)")
+	flag.BoolVar(&o.list, "list", false, "list the manifests and their fixtures instead of destroying them")
+	flag.StringVar(&o.format, "format", "text", "-list output format: text or json")
+	flag.BoolVar(&o.forget, "forget", false, "drop fixtures whose working directory is gone, printing their run tag")
+	flag.DurationVar(&o.timeout, "timeout", 60*time.Minute, "time allowed for all destroys")
+	flag.StringVar(&o.terraform, "terraform", "terraform", "terraform or tofu binary")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, o.timeout)
+	defer cancel()
+
+	if err := run(ctx, o, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "cleanup:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, o options, w, log io.Writer) error {
+	paths, err := teardown.List(o.dir)
+	if err != nil {
+		return err
+	}
+	if o.list {
+		return list(paths, o.format, w)
+	}
+
+	var errs []error
+	for _, path := range paths {
+		r, err := teardown.Open(path)
+		if errors.Is(err, teardown.ErrInUse) {
+			fmt.Fprintf(w, "%s: skipped, in use by a running test binary\n", path)
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		m := r.Manifest()
+		fmt.Fprintf(w, "%s: %d fixture(s) from %s\n", path, len(m.Fixtures), m.Owner())
+		if o.forget {
+			if err := forget(r, w); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		r.Terraform, r.Log = o.terraform, log
+		if err := r.Teardown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+		if left := len(r.Manifest().Fixtures); left > 0 {
+			fmt.Fprintf(w, "%s: %d fixture(s) not destroyed\n", path, left)
+		} else {
+			fmt.Fprintf(w, "%s: done\n", path)
+		}
+		if err := r.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		if errors.Is(err, teardown.ErrDirGone) && !o.forget {
+			fmt.Fprintln(log, "cleanup: rerun with -forget to drop fixtures whose working directory is gone")
+		}
+		return err
+	}
+	return nil
+}
+
+// forget drops r's fixtures whose working directory no longer exists.
+func forget(r *teardown.Run, w io.Writer) error {
+	for _, f := range r.Manifest().Fixtures {
+		if _, err := os.Stat(f.Dir); !errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err := r.Remove(f.ID); err != nil {
+			return err
+		}
+		if f.Tag != "" {
+			fmt.Fprintf(w, "forgot %s: its resources are tagged %s=%s\n", f, leftover.TagKey, f.Tag)
+		} else {
+			fmt.Fprintf(w, "forgot %s\n", f)
+		}
+	}
+	return nil
+}
+
+type listed struct {
+	Path  string `json:"path"`
+	InUse bool   `json:"in_use"`
+	teardown.Manifest
+}
+
+func list(paths []string, format string, w io.Writer) error {
+	var out []listed
+	for _, path := range paths {
+		l := listed{Path: path}
+		r, err := teardown.Open(path)
+		switch {
+		case errors.Is(err, teardown.ErrInUse):
+			l.InUse = true
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if err := json.Unmarshal(data, &l.Manifest); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		case err != nil:
+			return err
+		default:
+			l.Manifest = r.Manifest()
+			r.Close()
+		}
+		out = append(out, l)
+	}
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	case "text":
+		if len(out) == 0 {
+			fmt.Fprintln(w, "no manifests")
+		}
+		for _, l := range out {
+			state := ""
+			if l.InUse {
+				state = ", running"
+			}
+			fmt.Fprintf(w, "%s (%s%s)\n", l.Path, l.Owner(), state)
+			for _, f := range l.Fixtures {
+				fmt.Fprintf(w, "  %s  applied %s", f, f.Applied.Format(time.RFC3339))
+				if f.Tag != "" {
+					fmt.Fprintf(w, "  %s=%s", leftover.TagKey, f.Tag)
+				}
+				fmt.Fprintln(w)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown -format %q", format)
+	}
+}
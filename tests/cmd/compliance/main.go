@@ -0,0 +1,148 @@
+// Command compliance evaluates a Terraform plan against the controls in
+// docs/compliance-checklist.md and prints a per-control report.
+//
+// Usage (from tests/):
+//
+//	go run ./cmd/compliance -plan plan.json
+//	go run ./cmd/compliance -plan plan.json -environment prod -format markdown
+//	go run ./cmd/compliance -plan plan.json -root ../environments/prod -format sarif > compliance.sarif
+//
+// -root is the directory the plan was created in; SARIF and JUnit output
+// use it to resolve findings to file and line. It exits 2 when any control
+// fails.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/yourorg/tf-modules/tests/internal/compliance"
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+	"github.com/yourorg/tf-modules/tests/internal/report"
+)
+
+var tool = report.Tool{Name: "tf-modules-compliance", InformationURI: "https://github.com/yourorg/tf-modules"}
+
+var errFailed = errors.New("one or more controls failed")
+
+type options struct {
+	plan        string
+	checklist   string
+	environment string
+	format      string
+	repo        string
+	root        string
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.plan, "plan", "", "plan JSON from terraform show -json (required)")
+	flag.StringVar(&o.checklist, "checklist", "../docs/compliance-checklist.md", "compliance checklist markdown")
+	flag.StringVar(&o.environment, "environment", "", "environment for prod-scoped controls (default: from tags or the environment variable)")
+	flag.StringVar(&o.format, "format", "text", "output format: text, markdown, json, sarif or junit")
+	flag.StringVar(&o.repo, "repo", "..", "repository root; SARIF paths are relative to it")
+	flag.StringVar(&o.root, "root", "", "root module directory the plan was created in, for source locations")
+	flag.Parse()
+
+	if o.plan == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	err := run(o, os.Stdout)
+	switch {
+	case errors.Is(err, errFailed):
+		fmt.Fprintln(os.Stderr, "compliance:", err)
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "compliance:", err)
+		os.Exit(1)
+	}
+}
+
+func run(o options, w io.Writer) error {
+	checklist, err := compliance.LoadChecklist(o.checklist)
+	if err != nil {
+		return err
+	}
+	plan, err := planjson.Load(o.plan)
+	if err != nil {
+		return err
+	}
+
+	rules := compliance.DefaultRules()
+	result := compliance.Run(compliance.NewContext(plan, o.environment), checklist, rules)
+
+	var idx *report.SourceIndex
+	if o.root != "" {
+		idx = report.NewSourceIndex(o.repo, o.root, plan)
+	}
+
+	switch o.format {
+	case "text":
+		printText(w, result)
+	case "markdown":
+		printMarkdown(w, result)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+	case "sarif":
+		if err := report.WriteSARIF(w, tool, compliance.ReportRules(rules), result.ReportFindings(idx)); err != nil {
+			return err
+		}
+	case "junit":
+		if err := report.FindingsJUnit(tool, compliance.ReportRules(rules), result.ReportFindings(idx)).Write(w); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown -format %q", o.format)
+	}
+
+	if result.Failed() {
+		return errFailed
+	}
+	return nil
+}
+
+func printText(w io.Writer, result *compliance.Report) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range result.Controls {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Status, c.ID, c.Text)
+		for _, f := range c.Findings {
+			if f.Status == compliance.StatusPass {
+				continue
+			}
+			fmt.Fprintf(tw, "\t\t  %s %s: %s\n", f.Status, f.Address, f.Message)
+		}
+	}
+	for _, f := range result.Unmapped {
+		fmt.Fprintf(tw, "%s\t%s\t%s: %s (control not in checklist)\n", f.Status, f.Control, f.Address, f.Message)
+	}
+	tw.Flush()
+}
+
+func printMarkdown(w io.Writer, result *compliance.Report) {
+	fmt.Fprintln(w, "| Control | Section | Status | Details |")
+	fmt.Fprintln(w, "|---------|---------|--------|---------|")
+	for _, c := range result.Controls {
+		details := ""
+		for _, f := range c.Findings {
+			if f.Status == compliance.StatusPass {
+				continue
+			}
+			if details != "" {
+				details += "<br>"
+			}
+			details += fmt.Sprintf("`%s`: %s", f.Address, f.Message)
+		}
+		fmt.Fprintf(w, "| %s | %s | %s | %s |\n", c.ID, c.Section, c.Status, details)
+	}
+}
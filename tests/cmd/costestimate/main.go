@@ -0,0 +1,293 @@
+// Command costestimate prints an offline monthly cost estimate for a
+// Terraform plan, broken down by module, and compares it with any
+// aws_budgets_budget the plan declares.
+//
+// Usage (from tests/):
+//
+//	terraform -chdir=../environments/prod plan -out=tfplan
+//	terraform -chdir=../environments/prod show -json tfplan > prod.json
+//	go run ./cmd/costestimate -plan prod.json
+//	go run ./cmd/costestimate -plan prod.json -base prod-main.json
+//	go run ./cmd/costestimate -plan prod.json -root ../environments/prod -format sarif > cost.sarif
+//
+// Prices come from the vendored table in internal/cost/prices, which holds
+// list prices for one region per cloud (us-east-1, eastus, us-central1).
+// The estimate warns about every planned region it has no prices for.
+// Usage-based SKUs (log ingestion, NAT data processing, ...) use the
+// table's default quantities unless overridden with -usage.
+//
+// -format sarif or junit reports an over-budget estimate as an error and
+// unpriced resources and regions as warnings; -root, the directory the plan
+// was created in, resolves them to source.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yourorg/tf-modules/tests/internal/cost"
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+	"github.com/yourorg/tf-modules/tests/internal/report"
+)
+
+var tool = report.Tool{Name: "tf-modules-costestimate", InformationURI: "https://github.com/yourorg/tf-modules"}
+
+// errOverBudget is returned when -fail-over-budget is set and the estimate
+// exceeds the budget.
+var errOverBudget = errors.New("estimate exceeds budget")
+
+type options struct {
+	plan, base     string
+	prices         string
+	priceVersion   string
+	usage          string
+	budget         float64
+	failOverBudget bool
+	format         string
+	repo           string
+	root           string
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.plan, "plan", "", "plan JSON from terraform show -json (required)")
+	flag.StringVar(&o.base, "base", "", "baseline plan JSON to diff against")
+	flag.StringVar(&o.prices, "prices", "", "price table file (default: newest vendored table)")
+	flag.StringVar(&o.priceVersion, "price-version", "", "vendored price table version, e.g. 2026-10")
+	flag.StringVar(&o.usage, "usage", "", "JSON file overriding usage quantities")
+	flag.Float64Var(&o.budget, "budget", 0, "monthly budget; defaults to the plan's aws_budgets_budget limit_amount")
+	flag.BoolVar(&o.failOverBudget, "fail-over-budget", false, "exit 2 when the estimate exceeds the budget")
+	flag.StringVar(&o.format, "format", "text", "output format: text, json, sarif or junit")
+	flag.StringVar(&o.repo, "repo", "..", "repository root; SARIF paths are relative to it")
+	flag.StringVar(&o.root, "root", "", "root module directory the plan was created in, for source locations")
+	flag.Parse()
+
+	if o.plan == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	err := run(o, os.Stdout)
+	switch {
+	case errors.Is(err, errOverBudget):
+		fmt.Fprintln(os.Stderr, "costestimate:", err)
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "costestimate:", err)
+		os.Exit(1)
+	}
+}
+
+func run(o options, w io.Writer) error {
+	table, err := loadTable(o)
+	if err != nil {
+		return err
+	}
+	var usage cost.Usage
+	if o.usage != "" {
+		if usage, err = cost.LoadUsage(o.usage); err != nil {
+			return err
+		}
+	}
+
+	est, warnings, err := estimateFile(o.plan, table, usage)
+	if err != nil {
+		return err
+	}
+	var base *cost.Estimate
+	if o.base != "" {
+		var baseWarnings []string
+		if base, baseWarnings, err = estimateFile(o.base, table, usage); err != nil {
+			return err
+		}
+		warnings = appendNew(warnings, baseWarnings...)
+	}
+
+	budget := o.budget
+	if budget == 0 {
+		budget = est.Budget()
+	}
+
+	switch o.format {
+	case "text":
+		printText(w, table, warnings, est, base, budget)
+	case "json":
+		if err := printJSON(w, table, warnings, est, base, budget); err != nil {
+			return err
+		}
+	case "sarif", "junit":
+		idx, err := sourceIndex(o)
+		if err != nil {
+			return err
+		}
+		findings := est.ReportFindings(budget, warnings, idx)
+		if o.format == "sarif" {
+			err = report.WriteSARIF(w, tool, cost.ReportRules(), findings)
+		} else {
+			err = report.FindingsJUnit(tool, cost.ReportRules(), findings).Write(w)
+		}
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown -format %q", o.format)
+	}
+
+	if o.failOverBudget && budget > 0 && est.Total() > budget {
+		return fmt.Errorf("%w: %.2f > %.2f %s", errOverBudget, est.Total(), budget, est.Currency)
+	}
+	return nil
+}
+
+func loadTable(o options) (*cost.Table, error) {
+	if o.prices != "" {
+		return cost.LoadTable(o.prices)
+	}
+	return cost.VendoredTable(o.priceVersion)
+}
+
+// estimateFile prices the plan at path and returns warnings for the
+// planned regions table has no prices for.
+func estimateFile(path string, table *cost.Table, usage cost.Usage) (*cost.Estimate, []string, error) {
+	plan, err := planjson.Load(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cost.EstimatePlan(planjson.Resources(plan), table, usage), table.RegionWarnings(cost.PlanRegions(plan)), nil
+}
+
+// sourceIndex indexes the modules under -root for -plan, or returns nil
+// without -root.
+func sourceIndex(o options) (*report.SourceIndex, error) {
+	if o.root == "" {
+		return nil, nil
+	}
+	plan, err := planjson.Load(o.plan)
+	if err != nil {
+		return nil, err
+	}
+	return report.NewSourceIndex(o.repo, o.root, plan), nil
+}
+
+// appendNew appends the items of add that list does not hold yet.
+func appendNew(list []string, add ...string) []string {
+	for _, s := range add {
+		found := false
+		for _, l := range list {
+			found = found || l == s
+		}
+		if !found {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// pricedRegions describes table.Regions, e.g. "aws us-east-1, azure eastus".
+func pricedRegions(table *cost.Table) string {
+	var out []string
+	for cloud, region := range table.Regions {
+		out = append(out, cloud+" "+region)
+	}
+	sort.Strings(out)
+	if len(out) == 0 {
+		return "no region"
+	}
+	return strings.Join(out, ", ")
+}
+
+func printText(w io.Writer, table *cost.Table, warnings []string, est, base *cost.Estimate, budget float64) {
+	fmt.Fprintf(w, "Monthly estimate (prices %s, %s list prices for %s)\n", est.PriceVersion, est.Currency, pricedRegions(table))
+	for _, s := range warnings {
+		fmt.Fprintf(w, "Warning: %s\n", s)
+	}
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, m := range est.ByModule() {
+		fmt.Fprintf(tw, "%s\t\t%10.2f\n", m.Module, m.Monthly)
+		for _, it := range m.Items {
+			fmt.Fprintf(tw, "  %s\t%s\t%10.2f\n", it.Address, it.Description, it.Monthly)
+		}
+	}
+	fmt.Fprintf(tw, "TOTAL\t\t%10.2f\n", est.Total())
+	tw.Flush()
+
+	if len(est.Unpriced) > 0 {
+		fmt.Fprintln(w, "\nNot priced:")
+		for _, u := range est.Unpriced {
+			fmt.Fprintf(w, "  %s: %s\n", u.Address, u.Reason)
+		}
+	}
+
+	if budget > 0 {
+		pct := est.Total() / budget * 100
+		status := "within budget"
+		if est.Total() > budget {
+			status = "OVER BUDGET"
+		}
+		fmt.Fprintf(w, "\nBudget: %.2f %s, estimate is %.0f%% (%s)\n", budget, est.Currency, pct, status)
+	}
+
+	if base != nil {
+		fmt.Fprintf(w, "\nChange vs base: %+.2f (%.2f -> %.2f)\n", est.Total()-base.Total(), base.Total(), est.Total())
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, d := range cost.Diff(base, est) {
+			fmt.Fprintf(tw, "  %s\t%10.2f\t->\t%10.2f\t(%+.2f)\n", d.Module, d.Before, d.After, d.Delta())
+		}
+		tw.Flush()
+	}
+}
+
+func printJSON(w io.Writer, table *cost.Table, warnings []string, est, base *cost.Estimate, budget float64) error {
+	type module struct {
+		Module  string          `json:"module"`
+		Monthly float64         `json:"monthly"`
+		Items   []cost.LineItem `json:"items"`
+	}
+	type delta struct {
+		Module string  `json:"module"`
+		Before float64 `json:"before"`
+		After  float64 `json:"after"`
+	}
+	out := struct {
+		PriceVersion string            `json:"price_version"`
+		PriceRegions map[string]string `json:"price_regions,omitempty"`
+		Warnings     []string          `json:"warnings,omitempty"`
+		Currency     string            `json:"currency"`
+		Total        float64           `json:"total"`
+		Budget       float64           `json:"budget,omitempty"`
+		Modules      []module          `json:"modules"`
+		Unpriced     []cost.Unpriced   `json:"unpriced,omitempty"`
+		BaseTotal    *float64          `json:"base_total,omitempty"`
+		Diff         []delta           `json:"diff,omitempty"`
+	}{
+		PriceVersion: est.PriceVersion,
+		PriceRegions: table.Regions,
+		Warnings:     warnings,
+		Currency:     est.Currency,
+		Total:        est.Total(),
+		Budget:       budget,
+		Unpriced:     est.Unpriced,
+	}
+	for _, m := range est.ByModule() {
+		out.Modules = append(out.Modules, module{Module: m.Module, Monthly: m.Monthly, Items: m.Items})
+	}
+	if base != nil {
+		t := base.Total()
+		out.BaseTotal = &t
+		for _, d := range cost.Diff(base, est) {
+			out.Diff = append(out.Diff, delta{Module: d.Module, Before: d.Before, After: d.After})
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
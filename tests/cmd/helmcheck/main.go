@@ -0,0 +1,222 @@
+// Command helmcheck renders the helm_release resources of a Terraform plan
+// from the local chart mirror and checks the manifests offline.
+//
+// Usage (from tests/):
+//
+//	go run ./cmd/helmcheck check -plan plan.json
+//	go run ./cmd/helmcheck check -plan plan.json -kube-version 1.29 -v
+//	go run ./cmd/helmcheck check -plan plan.json -root ../environments/prod -format sarif > helmcheck.sarif
+//	go run ./cmd/helmcheck schemas 1.28 1.29
+//
+// check merges each release's values and set blocks the way the Helm
+// provider does, renders the chart from testdata/charts, and reports
+// manifests that fail the Kubernetes OpenAPI schema, use deprecated or
+// removed APIs, and IAM-role-trusted service accounts missing the IRSA
+// annotation. The Kubernetes version comes from the planned aws_eks_cluster
+// or the kubernetes_version variable unless -kube-version is set. -format
+// sarif or junit reports one rule per check, and -root, the directory the
+// plan was created in, resolves each problem to its helm_release block. It
+// exits 2 when there are problems.
+//
+// schemas downloads api/openapi-spec/swagger.json for each minor version,
+// prunes it to what check reads and writes testdata/kubernetes/v<minor>.json.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/yourorg/tf-modules/tests/internal/helmcheck"
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+	"github.com/yourorg/tf-modules/tests/internal/report"
+)
+
+var tool = report.Tool{Name: "tf-modules-helmcheck", InformationURI: "https://github.com/yourorg/tf-modules"}
+
+var errProblems = errors.New("rendered manifests have problems")
+
+const defaultSource = "https://raw.githubusercontent.com/kubernetes/kubernetes/release-%s/api/openapi-spec/swagger.json"
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(1)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "check":
+		err = check(os.Args[2:], os.Stdout)
+	case "schemas":
+		err = schemas(os.Args[2:], os.Stdout)
+	default:
+		usage()
+		os.Exit(1)
+	}
+	switch {
+	case errors.Is(err, errProblems):
+		fmt.Fprintln(os.Stderr, "helmcheck:", err)
+		os.Exit(2)
+	case errors.Is(err, flag.ErrHelp):
+		os.Exit(1)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "helmcheck:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: helmcheck check -plan plan.json [-charts dir] [-schemas dir] [-kube-version 1.29] [-format text|sarif|junit] [-v]")
+	fmt.Fprintln(os.Stderr, "       helmcheck schemas [-dir testdata/kubernetes] [-source url-or-path] versions...")
+}
+
+func check(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	planPath := fs.String("plan", "", "plan JSON from terraform show -json (required)")
+	var o helmcheck.Options
+	fs.StringVar(&o.Charts, "charts", "testdata/charts", "chart mirror filled by go run ./cmd/chartmirror sync")
+	fs.StringVar(&o.Schemas, "schemas", "testdata/kubernetes", "pruned Kubernetes OpenAPI schemas")
+	fs.StringVar(&o.KubeVersion, "kube-version", "", "Kubernetes minor version (default: from the plan)")
+	verbose := fs.Bool("v", false, "list rendered objects and unset values")
+	format := fs.String("format", "text", "output format: text, sarif or junit")
+	repo := fs.String("repo", "..", "repository root; SARIF paths are relative to it")
+	root := fs.String("root", "", "root module directory the plan was created in, for source locations")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *planPath == "" {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	plan, err := planjson.Load(*planPath)
+	if err != nil {
+		return err
+	}
+	res, err := helmcheck.Run(plan, o)
+	if err != nil {
+		return err
+	}
+
+	var idx *report.SourceIndex
+	if *root != "" {
+		idx = report.NewSourceIndex(*repo, *root, plan)
+	}
+	switch *format {
+	case "text":
+	case "sarif":
+		if err := report.WriteSARIF(w, tool, helmcheck.ReportRules(), res.ReportFindings(idx)); err != nil {
+			return err
+		}
+		return problems(res)
+	case "junit":
+		if err := report.FindingsJUnit(tool, helmcheck.ReportRules(), res.ReportFindings(idx)).Write(w); err != nil {
+			return err
+		}
+		return problems(res)
+	default:
+		return fmt.Errorf("unknown -format %q", *format)
+	}
+
+	for _, r := range res.Releases {
+		fmt.Fprintf(w, "%s: %s %s, %d objects\n", r.Release.Address, r.Release.Chart, r.Release.Version, len(r.Manifests))
+		if !*verbose {
+			continue
+		}
+		for _, u := range r.Release.Unknown {
+			fmt.Fprintf(w, "  %s rendered as %q\n", u, helmcheck.UnknownValue)
+		}
+		for _, m := range r.Manifests {
+			fmt.Fprintf(w, "  %s %s (%s)\n", m.APIVersion(), m, m.Source)
+		}
+		if len(r.Unvalidated) > 0 {
+			fmt.Fprintf(w, "  not in the Kubernetes %s schema: %s\n", res.KubeVersion, strings.Join(r.Unvalidated, ", "))
+		}
+	}
+	for _, p := range res.Problems {
+		fmt.Fprintln(w, p)
+	}
+	if err := problems(res); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d releases render cleanly for Kubernetes %s\n", len(res.Releases), res.KubeVersion)
+	return nil
+}
+
+// problems returns errProblems with a count when res has any.
+func problems(res *helmcheck.Result) error {
+	if len(res.Problems) > 0 {
+		return fmt.Errorf("%w: %d problems for Kubernetes %s", errProblems, len(res.Problems), res.KubeVersion)
+	}
+	return nil
+}
+
+func schemas(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("schemas", flag.ContinueOnError)
+	dir := fs.String("dir", "testdata/kubernetes", "schema directory")
+	source := fs.String("source", defaultSource, "swagger.json URL or path; %s is replaced by the minor version")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	for _, arg := range fs.Args() {
+		version, err := helmcheck.MinorVersion(arg)
+		if err != nil {
+			return err
+		}
+		src := *source
+		if strings.Contains(src, "%s") {
+			src = fmt.Sprintf(src, version)
+		}
+		swagger, err := read(ctx, src)
+		if err != nil {
+			return fmt.Errorf("%s: %w", version, err)
+		}
+		pruned, err := helmcheck.PruneSpec(swagger)
+		if err != nil {
+			return fmt.Errorf("%s: %w", src, err)
+		}
+		path := helmcheck.SchemaFile(*dir, version)
+		if err := os.WriteFile(path, pruned, 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "wrote", path)
+	}
+	return nil
+}
+
+// read fetches an http(s) URL or reads a local file.
+func read(ctx context.Context, src string) ([]byte, error) {
+	if !strings.HasPrefix(src, "https://") && !strings.HasPrefix(src, "http://") {
+		return os.ReadFile(src)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", src, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
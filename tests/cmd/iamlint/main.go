@@ -0,0 +1,149 @@
+// Command iamlint lists the permissions a Terraform plan grants to IAM
+// roles and flags the ones broader than they need to be.
+//
+// Usage (from tests/):
+//
+//	terraform -chdir=../environments/dev plan -out=tfplan
+//	terraform -chdir=../environments/dev show -json tfplan > dev.json
+//	go run ./cmd/iamlint -plan dev.json -dir ../environments/dev
+//	go run ./cmd/iamlint -plan dev.json -dir ../environments/dev -format summary > iam-permissions.txt
+//	go run ./cmd/iamlint -plan dev.json -dir ../environments/dev -format sarif > iamlint.sarif
+//
+// Every aws_iam_role in the plan is collected with its inline policies,
+// aws_iam_role_policy resources and policy attachments. Policy JSON that
+// is unknown at plan time is read from the aws_iam_policy_document it
+// references or, with -dir, evaluated from the module source. Statements
+// are checked for Action "*", writes on any resource without a condition,
+// iam:PassRole without an iam:PassedToService condition, broad AWS managed
+// policies and privilege-escalation combinations. -format summary prints
+// one sorted line per role, action and resource, to diff between module
+// versions. -format sarif or junit reports one rule per check, resolved to
+// the policy or role block under -dir when it is set. It exits 2 when there
+// are error findings.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/yourorg/tf-modules/tests/internal/iamlint"
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+	"github.com/yourorg/tf-modules/tests/internal/report"
+)
+
+var tool = report.Tool{Name: "tf-modules-iamlint", InformationURI: "https://github.com/yourorg/tf-modules"}
+
+var errFindings = errors.New("IAM permission errors")
+
+type options struct {
+	plan   string
+	dir    string
+	format string
+	repo   string
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.plan, "plan", "", "plan JSON from terraform show -json (required)")
+	flag.StringVar(&o.dir, "dir", "", "directory the plan was made in, to evaluate policies unknown until apply from module source")
+	flag.StringVar(&o.format, "format", "text", "output format: text, summary, json, sarif or junit")
+	flag.StringVar(&o.repo, "repo", "..", "repository root; SARIF paths are relative to it")
+	flag.Parse()
+
+	if o.plan == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	err := run(o, os.Stdout)
+	switch {
+	case errors.Is(err, errFindings):
+		fmt.Fprintln(os.Stderr, "iamlint:", err)
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "iamlint:", err)
+		os.Exit(1)
+	}
+}
+
+func run(o options, w io.Writer) error {
+	plan, err := planjson.Load(o.plan)
+	if err != nil {
+		return err
+	}
+	roles, err := iamlint.Collect(plan, o.dir)
+	if err != nil {
+		return err
+	}
+	findings := iamlint.Lint(roles)
+
+	switch o.format {
+	case "text":
+		for _, r := range roles {
+			fmt.Fprintf(w, "%s (%s)\n", r.Address, r.Name)
+			for _, g := range r.Grants {
+				switch {
+				case g.Managed:
+					fmt.Fprintf(w, "  %s: %s (AWS managed)\n", g.Address, g.Name)
+				case g.Policy == nil:
+					fmt.Fprintf(w, "  %s: %s (unresolved)\n", g.Address, g.Name)
+				default:
+					fmt.Fprintf(w, "  %s: %s from %s\n", g.Address, g.Name, g.Source)
+				}
+			}
+		}
+		fmt.Fprintln(w)
+		for _, f := range findings {
+			fmt.Fprintf(w, "%-7s %s\n", f.Severity, f.Error())
+		}
+	case "summary":
+		for _, p := range iamlint.Summary(roles) {
+			fmt.Fprintln(w, p)
+		}
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		out := struct {
+			Findings    []iamlint.Finding    `json:"findings"`
+			Permissions []iamlint.Permission `json:"permissions"`
+		}{findings, iamlint.Summary(roles)}
+		if err := enc.Encode(out); err != nil {
+			return err
+		}
+	case "sarif":
+		if err := report.WriteSARIF(w, tool, iamlint.ReportRules(), iamlint.ReportFindings(findings, sourceIndex(o, plan))); err != nil {
+			return err
+		}
+	case "junit":
+		if err := report.FindingsJUnit(tool, iamlint.ReportRules(), iamlint.ReportFindings(findings, sourceIndex(o, plan))).Write(w); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown -format %q", o.format)
+	}
+
+	errs := 0
+	for _, f := range findings {
+		if f.Severity == iamlint.Error {
+			errs++
+		}
+	}
+	if errs > 0 {
+		return fmt.Errorf("%w: %d of %d findings", errFindings, errs, len(findings))
+	}
+	return nil
+}
+
+// sourceIndex resolves findings under -dir, or returns nil without it.
+func sourceIndex(o options, plan *tfjson.Plan) *report.SourceIndex {
+	if o.dir == "" {
+		return nil
+	}
+	return report.NewSourceIndex(o.repo, o.dir, plan)
+}
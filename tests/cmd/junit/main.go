@@ -0,0 +1,77 @@
+// Command junit converts `go test -json` output into JUnit XML.
+//
+// Usage (from tests/):
+//
+//	go test -json -timeout 60m ./aws/... | go run ./cmd/junit > junit.xml
+//	go run ./cmd/junit -in test.json -attach-dir logs/ -out junit.xml
+//
+// With -attach-dir, files named after a test (TestVpcHappyPath.log,
+// TestVpcHappyPath-apply.log) are attached to its case. It exits 1 when
+// any test failed, so it can stand in for go test's exit status in CI.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/yourorg/tf-modules/tests/internal/report"
+)
+
+var errFailed = errors.New("one or more tests failed")
+
+func main() {
+	in := flag.String("in", "-", "go test -json output (- for stdin)")
+	out := flag.String("out", "-", "JUnit XML output file (- for stdout)")
+	attachDir := flag.String("attach-dir", "", "directory of per-test log files to attach")
+	flag.Parse()
+
+	if err := run(*in, *out, *attachDir); err != nil {
+		fmt.Fprintln(os.Stderr, "junit:", err)
+		os.Exit(1)
+	}
+}
+
+func run(in, out, attachDir string) error {
+	var r io.Reader = os.Stdin
+	if in != "-" {
+		f, err := os.Open(in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	doc, err := report.ParseTestEvents(r)
+	if err != nil {
+		return err
+	}
+	if attachDir != "" {
+		if err := doc.AttachLogs(attachDir); err != nil {
+			return err
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if out != "-" {
+		f, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := doc.Write(w); err != nil {
+		return err
+	}
+
+	for _, s := range doc.Suites {
+		if s.Failures > 0 {
+			return errFailed
+		}
+	}
+	return nil
+}
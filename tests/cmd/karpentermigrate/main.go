@@ -0,0 +1,120 @@
+// Command karpentermigrate translates an environment's EKS managed node
+// groups into Karpenter NodePool and EC2NodeClass manifests, following
+// docs/karpenter-migration.md.
+//
+// Usage (from tests/):
+//
+//	go run ./cmd/karpentermigrate ../environments/prod
+//	go run ./cmd/karpentermigrate -format manifests ../environments/prod > karpenter.yaml
+//	go run ./cmd/karpentermigrate -format inputs ../environments/prod
+//
+// report (the default) compares each node group's capacity and monthly
+// list price with the NodePool limits that replace it, and lists the
+// settings Karpenter cannot express. manifests prints the YAML for step 2
+// of the guide; inputs prints the module arguments for steps 4 and 5. The
+// node_groups map is evaluated offline from literals, variable defaults,
+// terraform.tfvars and locals.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/yourorg/tf-modules/tests/internal/cost"
+	"github.com/yourorg/tf-modules/tests/internal/karpenter"
+)
+
+type options struct {
+	dir          string
+	module       string
+	format       string
+	priceVersion string
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.module, "module", "", "aws/eks module call name, when the root module has several")
+	flag.StringVar(&o.format, "format", "report", "output: report, manifests or inputs")
+	flag.StringVar(&o.priceVersion, "price-version", "", "vendored price table version, e.g. 2026-10")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: karpentermigrate [-module eks] [-format report|manifests|inputs] root-module-dir")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	o.dir = flag.Arg(0)
+
+	if err := run(o, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "karpentermigrate:", err)
+		os.Exit(1)
+	}
+}
+
+func run(o options, w io.Writer) error {
+	c, err := karpenter.Load(o.dir, o.module)
+	if err != nil {
+		return err
+	}
+	m := karpenter.Translate(c)
+
+	switch o.format {
+	case "report":
+		table, err := cost.VendoredTable(o.priceVersion)
+		if err != nil {
+			return err
+		}
+		printReport(w, m, table)
+	case "manifests":
+		out, err := m.Manifests()
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(out)
+		return err
+	case "inputs":
+		_, err := w.Write(m.Inputs())
+		return err
+	default:
+		return fmt.Errorf("unknown -format %q", o.format)
+	}
+	return nil
+}
+
+func printReport(w io.Writer, m *karpenter.Migration, table *cost.Table) {
+	c := m.Cluster
+	fmt.Fprintf(w, "module.%s (%s:%d), cluster %s\n\n", c.Module, c.File, c.Line, c.Name)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "NODE GROUP\tNODES min/desired/max\tDESIRED vCPU/GiB\tMAX vCPU/GiB\tNODEPOOL LIMITS\tMONTHLY desired/max (%s)\n", table.Currency)
+	for _, cp := range m.Compare(table) {
+		limits := "none"
+		if cp.LimitCPU != "" {
+			limits = fmt.Sprintf("cpu %s, memory %s", cp.LimitCPU, cp.LimitMemory)
+		}
+		monthly := "not priced"
+		if cp.Priced {
+			monthly = fmt.Sprintf("%.2f / %.2f", cp.DesiredMonthly, cp.MaxMonthly)
+		}
+		fmt.Fprintf(tw, "%s\t%d/%d/%d\t%d/%g\t%d/%g\t%s\t%s\n", cp.NodeGroup,
+			cp.MinNodes, cp.DesiredNodes, cp.MaxNodes,
+			cp.DesiredVCPU, cp.DesiredMemoryGiB, cp.MaxVCPU, cp.MaxMemoryGiB,
+			limits, monthly)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nPrices are %s list prices from table %s. With Karpenter you pay only for the nodes pending pods need, up to the limits.\n",
+		table.Regions["aws"], table.Version)
+
+	if len(m.Notes) > 0 {
+		fmt.Fprintln(w, "\nNot translated:")
+		for _, n := range m.Notes {
+			fmt.Fprintf(w, "  %s\n", n)
+		}
+	}
+	fmt.Fprintln(w, "\nRun with -format manifests for the NodePools and EC2NodeClasses and -format inputs for the module changes.")
+}
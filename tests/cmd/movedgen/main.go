@@ -0,0 +1,267 @@
+// Command movedgen generates the moved blocks, or terraform state mv
+// commands, that let a module refactor apply without destroying and
+// recreating resources.
+//
+// Usage (from tests/):
+//
+//	go run ./cmd/movedgen -plan plan.json -module module.vpc
+//	go run ./cmd/movedgen -old-state before.json -new-state after.json -format script
+//	go run ./cmd/movedgen -dir ../environments/dev -module module.vpc -out ../modules/aws/vpc/moved.tf -verify
+//
+// The old and new instances come from a plan (-plan, the output of
+// terraform show -json, or -dir to plan a root module first) or from two
+// states (-old-state, -new-state). Instances of the same type in the same
+// module are paired when their identifying attributes agree, with count
+// index and for_each key deciding between equal candidates; see
+// internal/moved. -module keeps only that module's resources and writes
+// addresses relative to it, as blocks inside the module need. -out writes
+// the result to a file instead of stdout, and -verify, which needs -dir
+// and -out, plans again with the blocks in place and fails if any
+// destroy/create pair remains. Instances that could not be paired are
+// listed on stderr.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/yourorg/tf-modules/tests/internal/moved"
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+)
+
+type vars []string
+
+func (v *vars) String() string { return strings.Join(*v, ",") }
+
+func (v *vars) Set(s string) error {
+	if !strings.Contains(s, "=") {
+		return fmt.Errorf("want name=value, got %q", s)
+	}
+	*v = append(*v, s)
+	return nil
+}
+
+type files []string
+
+func (f *files) String() string { return strings.Join(*f, ",") }
+
+func (f *files) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+type options struct {
+	plan      string
+	oldState  string
+	newState  string
+	dir       string
+	vars      vars
+	varFiles  files
+	module    string
+	format    string
+	out       string
+	verify    bool
+	terraform string
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.plan, "plan", "", "plan JSON from terraform show -json")
+	flag.StringVar(&o.oldState, "old-state", "", "state JSON from terraform show -json before the refactor")
+	flag.StringVar(&o.newState, "new-state", "", "state JSON from terraform show -json after the refactor")
+	flag.StringVar(&o.dir, "dir", "", "root module to plan instead of reading -plan")
+	flag.Var(&o.vars, "var", "variable for -dir as name=value (repeatable)")
+	flag.Var(&o.varFiles, "var-file", "variable file for -dir (repeatable)")
+	flag.StringVar(&o.module, "module", "", "module address to generate for, e.g. module.vpc (default: every module, with full addresses)")
+	flag.StringVar(&o.format, "format", "hcl", "output format: hcl, script or json")
+	flag.StringVar(&o.out, "out", "", "file to write instead of stdout")
+	flag.BoolVar(&o.verify, "verify", false, "plan -dir again with -out in place and fail if anything is still recreated")
+	flag.StringVar(&o.terraform, "terraform", "terraform", "terraform or tofu binary")
+	flag.Parse()
+
+	if err := run(o, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "movedgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(o options, w, log io.Writer) error {
+	sources := 0
+	for _, s := range []string{o.plan, o.oldState + o.newState, o.dir} {
+		if s != "" {
+			sources++
+		}
+	}
+	switch {
+	case sources != 1:
+		return errors.New("give exactly one of -plan, -old-state with -new-state, or -dir")
+	case (o.oldState == "") != (o.newState == ""):
+		return errors.New("-old-state and -new-state go together")
+	case o.verify && (o.dir == "" || o.out == ""):
+		return errors.New("-verify needs -dir and -out")
+	}
+
+	tf := runner{bin: o.terraform, dir: o.dir, log: log}
+	var old, created []moved.Instance
+	switch {
+	case o.plan != "":
+		plan, err := planjson.Load(o.plan)
+		if err != nil {
+			return err
+		}
+		old, created = moved.FromPlan(plan)
+	case o.dir != "":
+		if err := tf.run(nil, "init", "-input=false"); err != nil {
+			return err
+		}
+		plan, err := tf.plan(o)
+		if err != nil {
+			return err
+		}
+		old, created = moved.FromPlan(plan)
+	default:
+		before, err := loadState(o.oldState)
+		if err != nil {
+			return err
+		}
+		after, err := loadState(o.newState)
+		if err != nil {
+			return err
+		}
+		old, created = moved.FromStates(before, after)
+	}
+
+	res := moved.Match(inModule(old, o.module), inModule(created, o.module))
+	for _, in := range res.UnmatchedOld {
+		fmt.Fprintf(log, "unmatched: %s would be destroyed\n", in.Address)
+	}
+	for _, in := range res.UnmatchedNew {
+		fmt.Fprintf(log, "unmatched: %s would be created\n", in.Address)
+	}
+
+	var buf bytes.Buffer
+	switch o.format {
+	case "hcl":
+		hcl, err := moved.HCL(res.Moves, o.module)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(hcl)
+	case "script":
+		buf.WriteString(moved.Script(res.Moves))
+	case "json":
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res.Moves); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown -format %q", o.format)
+	}
+
+	if o.out == "" {
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+	if err := os.WriteFile(o.out, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(log, "wrote %d move(s) to %s\n", len(res.Moves), o.out)
+
+	if !o.verify {
+		return nil
+	}
+	plan, err := tf.plan(o)
+	if err != nil {
+		return err
+	}
+	if err := moved.Verify(plan); err != nil {
+		return err
+	}
+	fmt.Fprintln(log, "verified: the plan no longer recreates anything")
+	return nil
+}
+
+// inModule keeps the instances in module and its descendants.
+func inModule(in []moved.Instance, module string) []moved.Instance {
+	if module == "" {
+		return in
+	}
+	var out []moved.Instance
+	for _, i := range in {
+		if i.ModuleAddress == module || strings.HasPrefix(i.ModuleAddress, module+".") {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+func loadState(path string) (*tfjson.State, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s tfjson.State
+	if err := s.UnmarshalJSON(data); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// runner runs terraform in -dir, sending its progress to log so that
+// stdout carries only the generated blocks.
+type runner struct {
+	bin string
+	dir string
+	log io.Writer
+}
+
+func (r runner) run(stdout io.Writer, args ...string) error {
+	cmd := exec.Command(r.bin, append([]string{"-chdir=" + r.dir}, args...)...)
+	cmd.Stdout, cmd.Stderr = r.log, r.log
+	if stdout != nil {
+		cmd.Stdout = stdout
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %w", r.bin, args[0], err)
+	}
+	return nil
+}
+
+func (r runner) plan(o options) (*tfjson.Plan, error) {
+	tmp, err := os.MkdirTemp("", "movedgen-plan")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	planFile := filepath.Join(tmp, "tfplan")
+	args := []string{"plan", "-input=false", "-out=" + planFile}
+	for _, v := range o.vars {
+		args = append(args, "-var", v)
+	}
+	for _, f := range o.varFiles {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "-var-file="+abs)
+	}
+	if err := r.run(nil, args...); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := r.run(&out, "show", "-json", planFile); err != nil {
+		return nil, err
+	}
+	return planjson.Parse(out.Bytes())
+}
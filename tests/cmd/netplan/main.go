@@ -0,0 +1,214 @@
+// Command netplan lays out subnets for the aws/vpc, azure/vnet and
+// gcp/vpc-network modules and checks root modules for overlapping address
+// space.
+//
+// Usage (from tests/):
+//
+//	go run ./cmd/netplan plan -cloud aws -cidr 10.3.0.0/16 -zones us-east-1a,us-east-1b -tiers public:24,private:20
+//	go run ./cmd/netplan plan -cloud azure -cidr 10.4.0.0/16 -tiers aks-system:22,aks-user:20,endpoints:26
+//	go run ./cmd/netplan plan -cloud gcp -cidr 10.5.0.0/16 -zones us-central1 -tiers main:20
+//	go run ./cmd/netplan check
+//	go run ./cmd/netplan check -format sarif > netplan.sarif
+//
+// plan prints tfvars to stdout and refuses a parent CIDR that overlaps a
+// network in the -peers root modules. check lists overlapping networks
+// across the given root modules (default: environments/* and
+// examples/multi-cloud-ha, which would be peered with each other) and
+// exits 2 when any overlap; -format sarif or junit reports each overlap at
+// the attribute that declares it.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/yourorg/tf-modules/tests/internal/netplan"
+	"github.com/yourorg/tf-modules/tests/internal/report"
+)
+
+var tool = report.Tool{Name: "tf-modules-netplan", InformationURI: "https://github.com/yourorg/tf-modules"}
+
+var errOverlap = errors.New("overlapping address space")
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(1)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "plan":
+		err = plan(os.Args[2:], os.Stdout)
+	case "check":
+		err = check(os.Args[2:], os.Stdout)
+	default:
+		usage()
+		os.Exit(1)
+	}
+	switch {
+	case errors.Is(err, errOverlap):
+		fmt.Fprintln(os.Stderr, "netplan:", err)
+		os.Exit(2)
+	case errors.Is(err, flag.ErrHelp):
+		os.Exit(1)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "netplan:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: netplan plan|check [flags]")
+}
+
+// defaultPeers returns the root modules that share one routing domain.
+func defaultPeers(repo string) ([]string, error) {
+	envs, err := filepath.Glob(filepath.Join(repo, "environments", "*"))
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, e := range envs {
+		rel, err := filepath.Rel(repo, e)
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, filepath.ToSlash(rel))
+	}
+	sort.Strings(dirs)
+	return append(dirs, "examples/multi-cloud-ha"), nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func plan(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+	cloud := fs.String("cloud", "", "target module: aws, azure or gcp (required)")
+	parent := fs.String("cidr", "", "parent CIDR, e.g. 10.3.0.0/16 (required)")
+	zones := fs.String("zones", "", "comma-separated availability zones (aws) or regions (gcp)")
+	tiers := fs.String("tiers", "public:24,private:20", "comma-separated name:prefix tiers")
+	maxZones := fs.Int("max-zones", 0, "reserve room in each tier for this many zones (default: 3 for aws)")
+	reserve := fs.Float64("reserve", 0.25, "minimum fraction of the parent CIDR to leave free")
+	repo := fs.String("repo", "..", "repository root")
+	peers := fs.String("peers", "", "comma-separated root modules the network must not overlap (default: environments/* and examples/multi-cloud-ha; \"none\" to skip)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *cloud == "" || *parent == "" {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	prefix, err := netip.ParsePrefix(*parent)
+	if err != nil {
+		return err
+	}
+	ts, err := netplan.ParseTiers(*tiers)
+	if err != nil {
+		return err
+	}
+	layout, err := netplan.Plan(netplan.Request{
+		Cloud:    *cloud,
+		CIDR:     prefix,
+		Zones:    splitList(*zones),
+		Tiers:    ts,
+		MaxZones: *maxZones,
+		Reserve:  *reserve,
+	})
+	if err != nil {
+		return err
+	}
+
+	if *peers != "none" {
+		dirs := splitList(*peers)
+		if len(dirs) == 0 {
+			if dirs, err = defaultPeers(*repo); err != nil {
+				return err
+			}
+		}
+		nets, err := netplan.Discover(*repo, dirs...)
+		if err != nil {
+			return err
+		}
+		if hits := netplan.OverlapsWith(nets, layout.CIDR); len(hits) > 0 {
+			for _, n := range hits {
+				fmt.Fprintf(os.Stderr, "%s overlaps %s (%s:%d)\n", layout.CIDR, n, n.File, n.Line)
+			}
+			return errOverlap
+		}
+	}
+	return layout.WriteTFVars(w)
+}
+
+func check(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	repo := fs.String("repo", "..", "repository root")
+	format := fs.String("format", "text", "output format: text, sarif or junit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	dirs := fs.Args()
+	if len(dirs) == 0 {
+		var err error
+		if dirs, err = defaultPeers(*repo); err != nil {
+			return err
+		}
+	}
+
+	nets, err := netplan.Discover(*repo, dirs...)
+	if err != nil {
+		return err
+	}
+	overlaps := netplan.Overlaps(nets)
+	switch *format {
+	case "text":
+	case "sarif":
+		if err := report.WriteSARIF(w, tool, netplan.ReportRules(), netplan.ReportFindings(overlaps)); err != nil {
+			return err
+		}
+		return overlapErr(overlaps)
+	case "junit":
+		if err := report.FindingsJUnit(tool, netplan.ReportRules(), netplan.ReportFindings(overlaps)).Write(w); err != nil {
+			return err
+		}
+		return overlapErr(overlaps)
+	default:
+		return fmt.Errorf("unknown -format %q", *format)
+	}
+
+	for _, n := range nets {
+		var cidrs []string
+		for _, c := range n.CIDRs {
+			cidrs = append(cidrs, c.String())
+		}
+		fmt.Fprintf(w, "%-50s %s\n", n, strings.Join(cidrs, " "))
+	}
+	for _, o := range overlaps {
+		fmt.Fprintln(w, "OVERLAP", o)
+	}
+	return overlapErr(overlaps)
+}
+
+// overlapErr returns errOverlap when there are overlaps.
+func overlapErr(overlaps []netplan.Overlap) error {
+	if len(overlaps) > 0 {
+		return errOverlap
+	}
+	return nil
+}
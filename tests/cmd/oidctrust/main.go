@@ -0,0 +1,177 @@
+// Command oidctrust checks who can assume the GitHub Actions CI roles in a
+// Terraform plan by evaluating their trust policies against simulated OIDC
+// tokens.
+//
+// Usage (from tests/):
+//
+//	terraform -chdir=../modules/aws/iam plan -out=tfplan
+//	terraform -chdir=../modules/aws/iam show -json tfplan > iam.json
+//	go run ./cmd/oidctrust -plan iam.json
+//	go run ./cmd/oidctrust -plan iam.json -repos acme/infra,acme/app -apply-branch main -v
+//	go run ./cmd/oidctrust -plan iam.json -root ../modules/aws/iam -format sarif > oidctrust.sarif
+//
+// Each repository gets tokens for a push to the apply branch and to another
+// branch, a tag, a pull request and an environment job; lookalike
+// repositories and a token with GitHub's default audience are added. Only
+// -repos may assume the plan role, and only pushes to -apply-branch the
+// apply role. Every GitHub-trusting role is also checked for sub wildcards
+// that reach other repositories, missing sub or aud conditions, and
+// conditions on claims IAM does not pass. -repos and -apply-branch default
+// to the plan's github_repositories and apply_branch variables. -format
+// sarif or junit reports one rule per check, and -root, the directory the
+// plan was created in, resolves findings to the role's assume_role_policy.
+// It exits 2 when there are findings.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yourorg/tf-modules/tests/internal/ghoidc"
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+	"github.com/yourorg/tf-modules/tests/internal/report"
+)
+
+var tool = report.Tool{Name: "tf-modules-oidctrust", InformationURI: "https://github.com/yourorg/tf-modules"}
+
+var errFindings = errors.New("trust policy findings")
+
+type options struct {
+	plan        string
+	repos       string
+	applyBranch string
+	planRole    string
+	applyRole   string
+	format      string
+	repo        string
+	root        string
+	verbose     bool
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.plan, "plan", "", "plan JSON from terraform show -json (required)")
+	flag.StringVar(&o.repos, "repos", "", "comma-separated owner/name repositories allowed to assume the roles (default: github_repositories)")
+	flag.StringVar(&o.applyBranch, "apply-branch", "", "branch allowed to assume the apply role (default: apply_branch)")
+	flag.StringVar(&o.planRole, "plan-role", "aws_iam_role.plan", "address suffix of the plan role")
+	flag.StringVar(&o.applyRole, "apply-role", "aws_iam_role.apply", "address suffix of the apply role")
+	flag.StringVar(&o.format, "format", "text", "output format: text, sarif or junit")
+	flag.StringVar(&o.repo, "repo", "..", "repository root; SARIF paths are relative to it")
+	flag.StringVar(&o.root, "root", "", "root module directory the plan was created in, for source locations")
+	flag.BoolVar(&o.verbose, "v", false, "print every simulated token and decision")
+	flag.Parse()
+
+	if o.plan == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	err := run(o, os.Stdout)
+	switch {
+	case errors.Is(err, errFindings):
+		fmt.Fprintln(os.Stderr, "oidctrust:", err)
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "oidctrust:", err)
+		os.Exit(1)
+	}
+}
+
+func run(o options, w io.Writer) error {
+	plan, err := planjson.Load(o.plan)
+	if err != nil {
+		return err
+	}
+
+	var repos []string
+	if o.repos != "" {
+		repos = strings.Split(o.repos, ",")
+	} else if v, ok := planjson.Variable(plan, "github_repositories").([]interface{}); ok {
+		for _, r := range v {
+			repos = append(repos, fmt.Sprint(r))
+		}
+	}
+	branch := o.applyBranch
+	if branch == "" {
+		branch, _ = planjson.Variable(plan, "apply_branch").(string)
+	}
+	if len(repos) == 0 || branch == "" {
+		return fmt.Errorf("plan has no github_repositories or apply_branch variable; set -repos and -apply-branch")
+	}
+
+	roles, err := ghoidc.Roles(plan)
+	if err != nil {
+		return err
+	}
+	res := ghoidc.Analyze(roles, []ghoidc.Expectation{
+		{Role: o.planRole, Repositories: repos},
+		{Role: o.applyRole, Repositories: repos, Branch: branch},
+	})
+
+	var idx *report.SourceIndex
+	if o.root != "" {
+		idx = report.NewSourceIndex(o.repo, o.root, plan)
+	}
+	switch o.format {
+	case "text":
+	case "sarif":
+		if err := report.WriteSARIF(w, tool, ghoidc.ReportRules(), res.ReportFindings(idx)); err != nil {
+			return err
+		}
+		return findings(res)
+	case "junit":
+		if err := report.FindingsJUnit(tool, ghoidc.ReportRules(), res.ReportFindings(idx)).Write(w); err != nil {
+			return err
+		}
+		return findings(res)
+	default:
+		return fmt.Errorf("unknown -format %q", o.format)
+	}
+
+	for _, r := range res.Roles {
+		fmt.Fprintf(w, "%s (%s): trust policy from %s\n", r.Address, r.Name, r.Source)
+	}
+	if o.verbose {
+		fmt.Fprintln(w)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ROLE\tTOKEN\tDECISION\tEXPECTED")
+		for _, c := range res.Cases {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", c.Role, c.Token, decision(c.Decision.Allowed, c.Decision.Statement), decision(c.Want, ""))
+		}
+		tw.Flush()
+	}
+
+	fmt.Fprintln(w)
+	for _, f := range res.Findings {
+		fmt.Fprintln(w, f.Error())
+	}
+	if err := findings(res); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d simulated tokens: only %s can assume %s, and only pushes to %s can assume %s\n",
+		len(res.Cases), strings.Join(repos, ", "), o.planRole, branch, o.applyRole)
+	return nil
+}
+
+// findings returns errFindings with a count when res has any.
+func findings(res *ghoidc.Result) error {
+	if len(res.Findings) > 0 {
+		return fmt.Errorf("%w: %d findings", errFindings, len(res.Findings))
+	}
+	return nil
+}
+
+func decision(allowed bool, statement string) string {
+	if !allowed {
+		return "deny"
+	}
+	if statement == "" {
+		return "allow"
+	}
+	return "allow (" + statement + ")"
+}
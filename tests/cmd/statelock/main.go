@@ -0,0 +1,258 @@
+// Command statelock lists the Terraform state locks in a DynamoDB lock
+// table created by modules/aws/dynamodb-lock and releases the stale ones
+// that cancelled CI runs leave behind.
+//
+// Usage (from tests/):
+//
+//	go run ./cmd/statelock list -table acme-terraform-lock -repo acme/infra
+//	go run ./cmd/statelock release -table acme-terraform-lock -repo acme/infra
+//
+// A lock is stale when its TTL (-ttl-attribute) has passed, or when it was
+// taken on a CI runner and the GitHub Actions run executing at the time
+// has completed. Locks younger than -min-age, locks taken outside CI and
+// locks whose run cannot be looked up or found are kept.
+// release asks before deleting anything unless -yes is given, deletes a
+// lock only if it is still the one listed, and appends every attempt to
+// the -audit log. GITHUB_TOKEN authenticates the run lookup.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+
+	"github.com/yourorg/tf-modules/tests/internal/awsverify"
+	"github.com/yourorg/tf-modules/tests/internal/tfstate"
+)
+
+const defaultAudit = ".history/state-lock-releases.jsonl"
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(1)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "list":
+		err = list(os.Args[2:], os.Stdout)
+	case "release":
+		err = release(os.Args[2:], os.Stdin, os.Stdout)
+	default:
+		usage()
+		os.Exit(1)
+	}
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		os.Exit(1)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "statelock:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: statelock list|release [flags]")
+}
+
+// config holds the flags list and release share.
+type config struct {
+	table     string
+	region    string
+	ttl       string
+	repo      string
+	workflows string
+	minAge    time.Duration
+	ciUsers   string
+}
+
+func (c *config) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.table, "table", "", "DynamoDB lock table (required)")
+	fs.StringVar(&c.region, "region", firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"), "AWS region of the table")
+	fs.StringVar(&c.ttl, "ttl-attribute", tfstate.DefaultTTLAttribute, "TTL attribute of the table (empty if it has none)")
+	fs.StringVar(&c.repo, "repo", os.Getenv("GITHUB_REPOSITORY"), "GitHub repository whose runs take the locks (owner/name)")
+	fs.StringVar(&c.workflows, "workflows", "", "comma-separated workflow files to match runs against (default: every workflow)")
+	fs.DurationVar(&c.minAge, "min-age", time.Hour, "never treat locks younger than this as stale")
+	fs.StringVar(&c.ciUsers, "ci-users", "runner", "comma-separated Who users of CI runners")
+}
+
+func (c *config) assess(ctx context.Context) (tfstate.DynamoDBAPI, []tfstate.Assessment, error) {
+	if c.table == "" {
+		return nil, nil, errors.New("-table is required")
+	}
+	if c.region == "" {
+		return nil, nil, errors.New("-region is required (or set AWS_REGION)")
+	}
+	sess, err := awsverify.NewSession(c.region)
+	if err != nil {
+		return nil, nil, err
+	}
+	db := dynamodb.New(sess)
+	locks, err := tfstate.ListLocks(ctx, db, c.table, c.ttl)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var lookup tfstate.RunLookup
+	if c.repo != "" {
+		lookup = tfstate.GitHubRuns{Repo: c.repo, Token: os.Getenv("GITHUB_TOKEN"), Workflows: split(c.workflows)}
+	}
+	return db, tfstate.Assess(ctx, locks, lookup, tfstate.AssessOptions{
+		Now:     time.Now(),
+		MinAge:  c.minAge,
+		CIUsers: split(c.ciUsers),
+	}), nil
+}
+
+func list(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	var c config
+	c.register(fs)
+	format := fs.String("format", "text", "output format: text or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	_, as, err := c.assess(context.Background())
+	if err != nil {
+		return err
+	}
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(as)
+	case "text":
+		return table(w, as)
+	default:
+		return fmt.Errorf("unknown -format %q", *format)
+	}
+}
+
+func release(args []string, in io.Reader, w io.Writer) error {
+	fs := flag.NewFlagSet("release", flag.ContinueOnError)
+	var c config
+	c.register(fs)
+	yes := fs.Bool("yes", false, "release without asking")
+	audit := fs.String("audit", defaultAudit, "JSONL audit log of released locks")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	db, as, err := c.assess(ctx)
+	if err != nil {
+		return err
+	}
+	var stale []tfstate.Assessment
+	for _, a := range as {
+		if a.State == tfstate.StateStale {
+			stale = append(stale, a)
+		}
+	}
+	if len(stale) == 0 {
+		fmt.Fprintf(w, "no stale locks in %s\n", c.table)
+		return nil
+	}
+	if err := table(w, stale); err != nil {
+		return err
+	}
+	if !*yes {
+		fmt.Fprintf(w, "Release %d stale lock(s) from %s? [y/N] ", len(stale), c.table)
+		answer, _ := bufio.NewReader(in).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			fmt.Fprintln(w, "nothing released")
+			return nil
+		}
+	}
+
+	by := releasedBy()
+	var failed int
+	for _, a := range stale {
+		rec := tfstate.AuditRecord{
+			Time:       time.Now().UTC(),
+			Table:      c.table,
+			LockID:     a.Lock.LockID,
+			Lock:       a.Lock.Info,
+			Reason:     a.Reason,
+			ReleasedBy: by,
+			Result:     "released",
+		}
+		if a.Run != nil {
+			rec.RunURL = a.Run.URL
+		}
+		if err := tfstate.ReleaseLock(ctx, db, c.table, a.Lock); err != nil {
+			rec.Result = err.Error()
+			failed++
+		}
+		if err := tfstate.AppendAudit(*audit, rec); err != nil {
+			return fmt.Errorf("writing audit log: %w", err)
+		}
+		fmt.Fprintf(w, "%s: %s\n", a.Lock.LockID, rec.Result)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d locks not released", failed, len(stale))
+	}
+	return nil
+}
+
+func table(w io.Writer, as []tfstate.Assessment) error {
+	now := time.Now()
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATE\tLOCK\tOPERATION\tWHO\tAGE\tTTL\tREASON")
+	for _, a := range as {
+		ttl := "-"
+		if a.Lock.Expires != nil {
+			ttl = a.Lock.Expires.Format(time.RFC3339)
+		}
+		reason := a.Reason
+		if a.Run != nil {
+			reason += " " + a.Run.URL
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			a.State, a.Lock.LockID, strings.TrimPrefix(a.Lock.Info.Operation, "OperationType"),
+			a.Lock.Info.Who, a.Lock.Age(now).Round(time.Minute), ttl, reason)
+	}
+	return tw.Flush()
+}
+
+func releasedBy() string {
+	if actor := os.Getenv("GITHUB_ACTOR"); actor != "" {
+		return actor
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "unknown"
+}
+
+func split(s string) []string {
+	var out []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func firstEnv(names ...string) string {
+	for _, n := range names {
+		if v := os.Getenv(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
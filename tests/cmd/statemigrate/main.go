@@ -0,0 +1,169 @@
+// Command statemigrate moves Terraform state between S3 keys, between S3
+// and an Azure blob, or from a local file to either.
+//
+// Usage (from tests/):
+//
+//	go run ./cmd/statemigrate -from terraform.tfstate -to 's3://acme-tfstate/dev/platform/terraform.tfstate?region=us-east-1&lock_table=acme-terraform-lock'
+//	go run ./cmd/statemigrate -from 's3://acme-tfstate/dev/net/terraform.tfstate?region=us-east-1&lock_table=acme-terraform-lock' -to 's3://acme-tfstate/dev/platform/terraform.tfstate?region=us-east-1&lock_table=acme-terraform-lock' -delete-source
+//	go run ./cmd/statemigrate -from 's3://acme-tfstate/prod/platform/terraform.tfstate?region=us-east-1&lock_table=acme-terraform-lock' -to azurerm://sttfstate1234/tfstate/prod/platform/terraform.tfstate
+//
+// Stores are a local path, s3://bucket/key with the region, lock_table and
+// kms_key_id query parameters of the S3 backend, or
+// azurerm://account/container/key authenticated with ARM_ACCESS_KEY. An
+// optional endpoint query parameter points azurerm at another blob
+// endpoint; for devstoreaccount1 AZURITE_BLOB_ENDPOINT and the Azurite key
+// are used. LOCALSTACK_ENDPOINT points s3 at LocalStack.
+//
+// Both states are locked the way Terraform locks them for the whole move.
+// The source, and any state the destination already holds, is copied to
+// -backup-dir first. A destination holding state of another lineage, or a
+// serial not older than the source's, is refused unless -force is given.
+// The written state is read back and its lineage, serial and resource and
+// instance counts checked before -delete-source removes the source.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/yourorg/tf-modules/tests/internal/awsverify"
+	"github.com/yourorg/tf-modules/tests/internal/tfstate"
+)
+
+type options struct {
+	from         string
+	to           string
+	backupDir    string
+	deleteSource bool
+	force        bool
+	format       string
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.from, "from", "", "source state: a path, s3://bucket/key or azurerm://account/container/key")
+	flag.StringVar(&o.to, "to", "", "destination state, in the same forms as -from")
+	flag.StringVar(&o.backupDir, "backup-dir", ".history/state-backups", "directory receiving copies of the states before the move")
+	flag.BoolVar(&o.deleteSource, "delete-source", false, "delete the source state once the copy is verified")
+	flag.BoolVar(&o.force, "force", false, "overwrite destination state of another lineage or a newer serial")
+	flag.StringVar(&o.format, "format", "text", "output format: text or json")
+	flag.Parse()
+
+	if err := run(o, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "statemigrate:", err)
+		os.Exit(1)
+	}
+}
+
+func run(o options, w io.Writer) error {
+	if o.from == "" || o.to == "" {
+		return fmt.Errorf("-from and -to are required")
+	}
+	if o.format != "text" && o.format != "json" {
+		return fmt.Errorf("unknown -format %q", o.format)
+	}
+	src, err := openStore(o.from)
+	if err != nil {
+		return fmt.Errorf("-from: %w", err)
+	}
+	dst, err := openStore(o.to)
+	if err != nil {
+		return fmt.Errorf("-to: %w", err)
+	}
+
+	res, err := tfstate.Migrate(context.Background(), src, dst, tfstate.MigrateOptions{
+		BackupDir:    o.backupDir,
+		DeleteSource: o.deleteSource,
+		Force:        o.force,
+	})
+	if err != nil {
+		return err
+	}
+
+	if o.format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	}
+	verb := "migrated"
+	if res.Unchanged {
+		verb = "already migrated"
+	}
+	fmt.Fprintf(w, "%s %s to %s\n", verb, res.Source, res.Destination)
+	fmt.Fprintf(w, "  lineage %s serial %d, %d resources with %d instances\n", res.Lineage, res.Serial, res.Resources, res.Instances)
+	for _, b := range res.Backups {
+		fmt.Fprintf(w, "  backup %s\n", b)
+	}
+	if res.SourceDeleted {
+		fmt.Fprintf(w, "  deleted %s\n", res.Source)
+	}
+	return nil
+}
+
+// openStore parses a store argument.
+func openStore(arg string) (tfstate.Store, error) {
+	u, err := url.Parse(arg)
+	if err != nil || u.Scheme == "" || len(u.Scheme) == 1 {
+		// A plain path, including a Windows drive letter.
+		return &tfstate.LocalStore{Path: arg}, nil
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	q := u.Query()
+
+	switch u.Scheme {
+	case "file":
+		return &tfstate.LocalStore{Path: u.Path}, nil
+	case "s3":
+		if u.Host == "" || key == "" {
+			return nil, fmt.Errorf("want s3://bucket/key, got %q", arg)
+		}
+		region := q.Get("region")
+		if region == "" {
+			region = os.Getenv("AWS_REGION")
+		}
+		if region == "" {
+			return nil, fmt.Errorf("%s: no region parameter and AWS_REGION is not set", arg)
+		}
+		sess, err := awsverify.NewSession(region)
+		if err != nil {
+			return nil, err
+		}
+		return &tfstate.S3Store{
+			S3:       s3.New(sess),
+			DynamoDB: dynamodb.New(sess),
+			Backend: tfstate.S3Backend{
+				Bucket:    u.Host,
+				Key:       key,
+				Region:    region,
+				LockTable: q.Get("lock_table"),
+				KMSKeyID:  q.Get("kms_key_id"),
+			},
+		}, nil
+	case "azurerm":
+		container, key, ok := strings.Cut(key, "/")
+		if u.Host == "" || !ok || key == "" {
+			return nil, fmt.Errorf("want azurerm://account/container/key, got %q", arg)
+		}
+		blob := tfstate.AzureBlob{Account: u.Host, Key: os.Getenv("ARM_ACCESS_KEY"), Endpoint: q.Get("endpoint")}
+		if blob.Account == tfstate.AzuriteAccount {
+			blob.Key = tfstate.AzuriteKey
+			if blob.Endpoint == "" {
+				blob.Endpoint = os.Getenv(tfstate.EnvAzuriteEndpoint)
+			}
+		}
+		if blob.Key == "" {
+			return nil, fmt.Errorf("%s: ARM_ACCESS_KEY is not set", arg)
+		}
+		return &tfstate.AzureStore{Blob: blob, Container: container, Key: key}, nil
+	}
+	return nil, fmt.Errorf("unknown store scheme %q", u.Scheme)
+}
@@ -0,0 +1,271 @@
+// Command testhistory records harness runs into a JSONL history store and
+// reports flaky tests, median durations and regressions between runs.
+//
+// Usage (from tests/):
+//
+//	go test -json -timeout 60m ./aws/... | tee test.json | go run ./cmd/junit > junit.xml
+//	go run ./cmd/testhistory record -in test.json
+//	go run ./cmd/testhistory report -window 20
+//	go run ./cmd/testhistory diff -fail-on-regression
+//
+// record reads `go test -json` output and appends one record per test with
+// its outcome, duration, Terratest phase timings, region and error class.
+// diff compares the two most recent runs unless -base and -head are given,
+// and with -fail-on-regression exits 2 when a test newly failed, went
+// missing or slowed down.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yourorg/tf-modules/tests/internal/history"
+)
+
+// errRegressed is returned by diff when -fail-on-regression is set and
+// regressions were found.
+var errRegressed = errors.New("regressions found")
+
+const defaultStore = ".history/test-runs.jsonl"
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(1)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "record":
+		err = record(os.Args[2:])
+	case "report":
+		err = reportCmd(os.Args[2:], os.Stdout)
+	case "diff":
+		err = diff(os.Args[2:], os.Stdout)
+	default:
+		usage()
+		os.Exit(1)
+	}
+	switch {
+	case errors.Is(err, errRegressed):
+		fmt.Fprintln(os.Stderr, "testhistory:", err)
+		os.Exit(2)
+	case errors.Is(err, flag.ErrHelp):
+		os.Exit(1)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "testhistory:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: testhistory record|report|diff [flags]")
+}
+
+func record(args []string) error {
+	fs := flag.NewFlagSet("record", flag.ContinueOnError)
+	store := fs.String("store", defaultStore, "JSONL history store")
+	in := fs.String("in", "-", "go test -json output (- for stdin)")
+	runID := fs.String("run-id", "", "run identifier (default: $GITHUB_RUN_ID-$GITHUB_RUN_ATTEMPT or the current time)")
+	commit := fs.String("commit", os.Getenv("GITHUB_SHA"), "commit under test")
+	region := fs.String("region", firstEnv("AWS_DEFAULT_REGION", "AWS_REGION", "ARM_LOCATION"), "cloud region the run used")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	id := *runID
+	if id == "" {
+		id = defaultRunID()
+	}
+	recs, err := history.FromTestEvents(r, history.Run{ID: id, Commit: *commit, Region: *region})
+	if err != nil {
+		return err
+	}
+	if err := history.Append(*store, recs); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "recorded %d tests as run %s in %s\n", len(recs), id, *store)
+	return nil
+}
+
+func defaultRunID() string {
+	if id := os.Getenv("GITHUB_RUN_ID"); id != "" {
+		if attempt := os.Getenv("GITHUB_RUN_ATTEMPT"); attempt != "" {
+			return id + "-" + attempt
+		}
+		return id
+	}
+	return time.Now().UTC().Format("20060102T150405Z")
+}
+
+func firstEnv(names ...string) string {
+	for _, n := range names {
+		if v := os.Getenv(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func reportCmd(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	store := fs.String("store", defaultStore, "JSONL history store")
+	window := fs.Int("window", 20, "analyse the last N runs (0 for all)")
+	brokenStreak := fs.Int("broken-streak", 3, "consecutive trailing failures that mark a test broken rather than flaky")
+	all := fs.Bool("all", false, "include stable tests in text output")
+	format := fs.String("format", "text", "output format: text or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	recs, err := history.Load(*store)
+	if err != nil {
+		return err
+	}
+	stats := history.Analyze(recs, history.Options{Window: *window, BrokenStreak: *brokenStreak})
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	case "text":
+	default:
+		return fmt.Errorf("unknown -format %q", *format)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tTEST\tRUNS\tFAIL%\tFLIP%\tMIXED\tMEDIAN\tPHASES\tERRORS")
+	for _, s := range stats {
+		if s.Status == history.StatusStable && !*all {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%.0f\t%.0f\t%d\t%s\t%s\t%s\n",
+			s.Status, s.Test, s.Passes+s.Fails, s.FailRate*100, s.FlipRate*100, s.MixedCommits,
+			duration(s.MedianDuration), phases(s.MedianPhases), counts(s.ErrorClasses))
+	}
+	return tw.Flush()
+}
+
+func diff(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	store := fs.String("store", defaultStore, "JSONL history store")
+	base := fs.String("base", "", "base run ID (default: second most recent run)")
+	head := fs.String("head", "", "head run ID (default: most recent run)")
+	slowdown := fs.Float64("slowdown", 0.5, "report passing tests this fraction slower than in the base run")
+	minSlowdown := fs.Duration("min-slowdown", time.Minute, "ignore slowdowns shorter than this")
+	failOnRegression := fs.Bool("fail-on-regression", false, "exit 2 when a test newly failed, went missing or slowed down")
+	format := fs.String("format", "text", "output format: text or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	recs, err := history.Load(*store)
+	if err != nil {
+		return err
+	}
+	runs := history.Runs(recs)
+	if *head == "" {
+		if len(runs) < 1 {
+			return fmt.Errorf("no runs in %s", *store)
+		}
+		*head = runs[len(runs)-1].ID
+	}
+	if *base == "" {
+		for i := len(runs) - 1; i > 0; i-- {
+			if runs[i].ID == *head {
+				*base = runs[i-1].ID
+				break
+			}
+		}
+		if *base == "" {
+			return fmt.Errorf("no run before %s to compare with", *head)
+		}
+	}
+
+	regs := history.Compare(recs, *base, *head, history.Options{Slowdown: *slowdown, MinSlowdown: minSlowdown.Seconds()})
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(regs); err != nil {
+			return err
+		}
+	case "text":
+		fmt.Fprintf(w, "%s -> %s\n", *base, *head)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, r := range regs {
+			detail := ""
+			switch r.Kind {
+			case history.KindNewFailure:
+				detail = fmt.Sprintf("%s: %s", r.ErrorClass, r.Message)
+			case history.KindSlower:
+				detail = fmt.Sprintf("%s -> %s", duration(r.BaseDuration), duration(r.HeadDuration))
+			}
+			if r.Flaky {
+				detail += " (flaky)"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Kind, r.Test, strings.TrimSpace(detail))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown -format %q", *format)
+	}
+
+	if *failOnRegression {
+		for _, r := range regs {
+			if r.IsRegression() {
+				return errRegressed
+			}
+		}
+	}
+	return nil
+}
+
+func duration(seconds float64) string {
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+func phases(p map[string]float64) string {
+	var parts []string
+	for _, name := range []string{history.PhaseInit, history.PhaseApply, history.PhaseValidate, history.PhaseDestroy} {
+		if d, ok := p[name]; ok {
+			parts = append(parts, name+"="+duration(d))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func counts(m map[string]int) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%d", k, m[k]))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,111 @@
+// Command testselect prints the minimal go test -run expression per test
+// package for a list of changed files.
+//
+// Usage (from tests/):
+//
+//	git diff --name-only origin/main... | go run ./cmd/testselect
+//	go run ./cmd/testselect -changed changed.txt -format json
+//
+// Each text output line is "<package> <regex>", e.g.
+//
+//	./aws ^(TestEksSmokeTest|TestVpcHappyPath)$
+//
+// Packages with no selected tests are omitted; empty output means nothing
+// needs to run.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/yourorg/tf-modules/tests/internal/selection"
+)
+
+func main() {
+	repoRoot := flag.String("repo", "..", "path to the repository root")
+	testsDir := flag.String("tests", "tests", "test module directory, relative to -repo")
+	changedPath := flag.String("changed", "-", "file listing changed paths, one per line (- for stdin)")
+	format := flag.String("format", "text", "output format: text or json")
+	flag.Parse()
+
+	if err := run(*repoRoot, *testsDir, *changedPath, *format, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "testselect:", err)
+		os.Exit(1)
+	}
+}
+
+func run(repoRoot, testsDir, changedPath, format string, w io.Writer) error {
+	changed, err := readChanged(changedPath)
+	if err != nil {
+		return err
+	}
+
+	specs, err := selection.LoadSpecs(repoRoot, path.Join(repoRoot, testsDir))
+	if err != nil {
+		return err
+	}
+	modules, err := selection.LoadModuleGraph(repoRoot, "modules")
+	if err != nil {
+		return err
+	}
+	pkgs, err := selection.LoadGoGraph(repoRoot, path.Join(repoRoot, testsDir))
+	if err != nil {
+		return err
+	}
+
+	selected := selection.Select(specs, modules, pkgs, testsDir, changed)
+
+	switch format {
+	case "text":
+		for _, s := range selected {
+			fmt.Fprintf(w, "./%s %s\n", strings.TrimPrefix(s.Package, testsDir+"/"), s.RunRegex())
+		}
+	case "json":
+		type entry struct {
+			Package string   `json:"package"`
+			Tests   []string `json:"tests"`
+			Run     string   `json:"run"`
+		}
+		out := make([]entry, 0, len(selected))
+		for _, s := range selected {
+			out = append(out, entry{
+				Package: "./" + strings.TrimPrefix(s.Package, testsDir+"/"),
+				Tests:   s.Tests,
+				Run:     s.RunRegex(),
+			})
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	default:
+		return fmt.Errorf("unknown -format %q", format)
+	}
+	return nil
+}
+
+func readChanged(p string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if p != "-" {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var out []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" {
+			out = append(out, line)
+		}
+	}
+	return out, sc.Err()
+}
@@ -36,4 +36,14 @@ func TestGkeOutputs(t *testing.T) {
 	//
 	// clusterName := terraform.Output(t, opts, "cluster_name")
 	// require.NotEmpty(t, clusterName)
+	//
+	// Kubernetes-side checks (needs gke-gcloud-auth-plugin):
+	//
+	// cluster, err := kubeverify.GKE(clusterName,
+	//     terraform.Output(t, opts, "cluster_endpoint"),
+	//     terraform.Output(t, opts, "cluster_ca_certificate"))
+	// require.NoError(t, err)
+	// client, err := kubeverify.NewClient(cluster)
+	// require.NoError(t, err)
+	// problems, err := kubeverify.Poll(ctx, 15*time.Second, client.NodesReady(1))
 }
@@ -0,0 +1,293 @@
+package awsverify_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/awsverify"
+)
+
+// fakeEC2 answers the Describe calls the verifiers make from in-memory
+// state, applying only the filters they use.
+type fakeEC2 struct {
+	subnets     []*ec2.Subnet
+	routeTables []*ec2.RouteTable
+	nats        []*ec2.NatGateway
+	endpoints   []*ec2.VpcEndpoint
+	flowLogs    []*ec2.FlowLog
+}
+
+func filterValue(filters []*ec2.Filter, name string) string {
+	for _, f := range filters {
+		if aws.StringValue(f.Name) == name && len(f.Values) > 0 {
+			return aws.StringValue(f.Values[0])
+		}
+	}
+	return ""
+}
+
+func (f *fakeEC2) DescribeSubnetsWithContext(_ aws.Context, in *ec2.DescribeSubnetsInput, _ ...request.Option) (*ec2.DescribeSubnetsOutput, error) {
+	want := map[string]bool{}
+	for _, id := range aws.StringValueSlice(in.SubnetIds) {
+		want[id] = true
+	}
+	out := &ec2.DescribeSubnetsOutput{}
+	for _, s := range f.subnets {
+		if want[aws.StringValue(s.SubnetId)] {
+			out.Subnets = append(out.Subnets, s)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeEC2) DescribeRouteTablesWithContext(_ aws.Context, in *ec2.DescribeRouteTablesInput, _ ...request.Option) (*ec2.DescribeRouteTablesOutput, error) {
+	subnet := filterValue(in.Filters, "association.subnet-id")
+	main := filterValue(in.Filters, "association.main") == "true"
+	out := &ec2.DescribeRouteTablesOutput{}
+	for _, rt := range f.routeTables {
+		for _, a := range rt.Associations {
+			if (subnet != "" && aws.StringValue(a.SubnetId) == subnet) || (main && aws.BoolValue(a.Main)) {
+				out.RouteTables = append(out.RouteTables, rt)
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeEC2) DescribeNatGatewaysWithContext(_ aws.Context, in *ec2.DescribeNatGatewaysInput, _ ...request.Option) (*ec2.DescribeNatGatewaysOutput, error) {
+	state := filterValue(in.Filter, "state")
+	out := &ec2.DescribeNatGatewaysOutput{}
+	for _, n := range f.nats {
+		if state == "" || aws.StringValue(n.State) == state {
+			out.NatGateways = append(out.NatGateways, n)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeEC2) DescribeVpcEndpointsWithContext(aws.Context, *ec2.DescribeVpcEndpointsInput, ...request.Option) (*ec2.DescribeVpcEndpointsOutput, error) {
+	return &ec2.DescribeVpcEndpointsOutput{VpcEndpoints: f.endpoints}, nil
+}
+
+func (f *fakeEC2) DescribeFlowLogsWithContext(aws.Context, *ec2.DescribeFlowLogsInput, ...request.Option) (*ec2.DescribeFlowLogsOutput, error) {
+	return &ec2.DescribeFlowLogsOutput{FlowLogs: f.flowLogs}, nil
+}
+
+func subnet(id, az string) *ec2.Subnet {
+	return &ec2.Subnet{SubnetId: aws.String(id), AvailabilityZone: aws.String(az)}
+}
+
+func routeTable(id string, subnets []string, routes ...*ec2.Route) *ec2.RouteTable {
+	rt := &ec2.RouteTable{RouteTableId: aws.String(id), Routes: routes}
+	for _, s := range subnets {
+		rt.Associations = append(rt.Associations, &ec2.RouteTableAssociation{SubnetId: aws.String(s)})
+	}
+	return rt
+}
+
+func toIGW(id string) *ec2.Route {
+	return &ec2.Route{DestinationCidrBlock: aws.String("0.0.0.0/0"), GatewayId: aws.String(id), State: aws.String("active")}
+}
+
+func toNAT(id string) *ec2.Route {
+	return &ec2.Route{DestinationCidrBlock: aws.String("0.0.0.0/0"), NatGatewayId: aws.String(id), State: aws.String("active")}
+}
+
+func nat(id, subnet string) *ec2.NatGateway {
+	return &ec2.NatGateway{NatGatewayId: aws.String(id), SubnetId: aws.String(subnet), State: aws.String("available")}
+}
+
+func endpoint(id, service, typ string, subnets, routeTables []string) *ec2.VpcEndpoint {
+	return &ec2.VpcEndpoint{
+		VpcEndpointId:   aws.String(id),
+		ServiceName:     aws.String("com.amazonaws.us-east-1." + service),
+		VpcEndpointType: aws.String(typ),
+		State:           aws.String("available"),
+		SubnetIds:       aws.StringSlice(subnets),
+		RouteTableIds:   aws.StringSlice(routeTables),
+	}
+}
+
+// perAZ is a healthy two-AZ VPC with one NAT per AZ, every endpoint and an
+// ALL-traffic flow log.
+func perAZ() (*fakeEC2, awsverify.VPC) {
+	api := &fakeEC2{
+		subnets: []*ec2.Subnet{
+			subnet("pub-a", "us-east-1a"), subnet("pub-b", "us-east-1b"),
+			subnet("priv-a", "us-east-1a"), subnet("priv-b", "us-east-1b"),
+		},
+		routeTables: []*ec2.RouteTable{
+			routeTable("rt-pub", []string{"pub-a", "pub-b"}, toIGW("igw-1")),
+			routeTable("rt-a", []string{"priv-a"}, toNAT("nat-a")),
+			routeTable("rt-b", []string{"priv-b"}, toNAT("nat-b")),
+		},
+		nats: []*ec2.NatGateway{nat("nat-a", "pub-a"), nat("nat-b", "pub-b")},
+		endpoints: []*ec2.VpcEndpoint{
+			endpoint("vpce-1", "ecr.api", "Interface", []string{"priv-a", "priv-b"}, nil),
+			endpoint("vpce-2", "ecr.dkr", "Interface", []string{"priv-a", "priv-b"}, nil),
+			endpoint("vpce-3", "s3", "Gateway", nil, []string{"rt-a", "rt-b"}),
+			endpoint("vpce-4", "ssm", "Interface", []string{"priv-a", "priv-b"}, nil),
+			endpoint("vpce-5", "ssmmessages", "Interface", []string{"priv-a", "priv-b"}, nil),
+			endpoint("vpce-6", "ec2messages", "Interface", []string{"priv-a", "priv-b"}, nil),
+		},
+		flowLogs: []*ec2.FlowLog{{
+			FlowLogId:         aws.String("fl-1"),
+			FlowLogStatus:     aws.String("ACTIVE"),
+			DeliverLogsStatus: aws.String("SUCCESS"),
+			TrafficType:       aws.String("ALL"),
+		}},
+	}
+	v := awsverify.VPC{
+		ID:                "vpc-1",
+		PublicSubnetIDs:   []string{"pub-a", "pub-b"},
+		PrivateSubnetIDs:  []string{"priv-a", "priv-b"},
+		InternetGatewayID: "igw-1",
+		EnableNATGateway:  true,
+		ECREndpoints:      true,
+		S3Endpoint:        true,
+		SSMEndpoints:      true,
+		FlowLogs:          true,
+	}
+	return api, v
+}
+
+func messages(t *testing.T, problems []awsverify.Problem) string {
+	t.Helper()
+	var b strings.Builder
+	for _, p := range problems {
+		b.WriteString(p.Error())
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func TestVerifyHealthyVPC(t *testing.T) {
+	api, v := perAZ()
+	problems, err := awsverify.Verify(context.Background(), api, v)
+	require.NoError(t, err)
+	assert.Empty(t, problems, messages(t, problems))
+}
+
+func TestVerifyPublicRouting(t *testing.T) {
+	api, v := perAZ()
+	api.routeTables[0] = routeTable("rt-pub", []string{"pub-a", "pub-b"}, toNAT("nat-a"))
+
+	problems, err := awsverify.VerifyPublicRouting(context.Background(), api, v)
+	require.NoError(t, err)
+	require.Len(t, problems, 2)
+	assert.Contains(t, problems[0].Error(), "pub-a routes 0.0.0.0/0 to nat-a, want internet gateway igw-1")
+}
+
+func TestVerifyPublicRoutingFallsBackToMainTable(t *testing.T) {
+	api, v := perAZ()
+	main := routeTable("rt-main", nil)
+	main.Associations = []*ec2.RouteTableAssociation{{Main: aws.Bool(true)}}
+	api.routeTables = append([]*ec2.RouteTable{main}, api.routeTables[1:]...)
+
+	problems, err := awsverify.VerifyPublicRouting(context.Background(), api, v)
+	require.NoError(t, err)
+	require.Len(t, problems, 2)
+	assert.Contains(t, problems[0].Error(), "pub-a (rt-main) has no 0.0.0.0/0 route")
+}
+
+func TestVerifyPrivateRoutingCrossAZ(t *testing.T) {
+	api, v := perAZ()
+	api.routeTables[2] = routeTable("rt-b", []string{"priv-b"}, toNAT("nat-a"))
+
+	problems, err := awsverify.VerifyPrivateRouting(context.Background(), api, v)
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	assert.Contains(t, problems[0].Error(), "priv-b in us-east-1b routes to NAT nat-a in us-east-1a")
+}
+
+func TestVerifyPrivateRoutingSingleNAT(t *testing.T) {
+	api, v := perAZ()
+	v.SingleNATGateway = true
+	api.routeTables[2] = routeTable("rt-b", []string{"priv-b"}, toNAT("nat-a"))
+
+	problems, err := awsverify.VerifyPrivateRouting(context.Background(), api, v)
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	assert.Contains(t, problems[0].Error(), "found 2 available NAT gateways, want 1")
+
+	api.nats = api.nats[:1]
+	problems, err = awsverify.VerifyPrivateRouting(context.Background(), api, v)
+	require.NoError(t, err)
+	assert.Empty(t, problems, messages(t, problems))
+}
+
+func TestVerifyPrivateRoutingWithoutNAT(t *testing.T) {
+	api, v := perAZ()
+	v.EnableNATGateway = false
+
+	problems, err := awsverify.VerifyPrivateRouting(context.Background(), api, v)
+	require.NoError(t, err)
+	msgs := messages(t, problems)
+	assert.Contains(t, msgs, "found 2 NAT gateways with enable_nat_gateway = false")
+	assert.Contains(t, msgs, "priv-a routes 0.0.0.0/0 to nat-a without a NAT gateway")
+
+	api.nats = nil
+	api.routeTables[1].Routes = nil
+	api.routeTables[2].Routes = nil
+	problems, err = awsverify.VerifyPrivateRouting(context.Background(), api, v)
+	require.NoError(t, err)
+	assert.Empty(t, problems, messages(t, problems))
+}
+
+func TestVerifyEndpoints(t *testing.T) {
+	api, v := perAZ()
+	api.endpoints = api.endpoints[1:]    // drop ecr.api
+	api.endpoints[1].RouteTableIds = nil // s3 not attached
+	api.endpoints[2].SubnetIds = nil     // ssm in no subnets
+	v.SSMEndpoints = false               // but the flag is off
+
+	problems, err := awsverify.VerifyEndpoints(context.Background(), api, v)
+	require.NoError(t, err)
+	msgs := messages(t, problems)
+	assert.Contains(t, msgs, "ecr.api endpoint missing with enable_ecr_vpc_endpoints = true")
+	assert.Contains(t, msgs, "s3 gateway endpoint not attached to route tables rt-a, rt-b")
+	assert.Contains(t, msgs, "ssm endpoint vpce-4 exists with enable_ssm_vpc_endpoints = false")
+	assert.Len(t, problems, 5, msgs)
+}
+
+func TestVerifyFlowLogs(t *testing.T) {
+	api, v := perAZ()
+	api.flowLogs[0].DeliverLogsStatus = aws.String("FAILED")
+	api.flowLogs[0].DeliverLogsErrorMessage = aws.String("Access error")
+	v.FlowLogsTrafficType = "REJECT"
+
+	problems, err := awsverify.VerifyFlowLogs(context.Background(), api, v)
+	require.NoError(t, err)
+	msgs := messages(t, problems)
+	assert.Contains(t, msgs, "fl-1 delivery failed: Access error")
+	assert.Contains(t, msgs, "fl-1 captures ALL traffic, want REJECT")
+
+	api.flowLogs = nil
+	problems, err = awsverify.VerifyFlowLogs(context.Background(), api, v)
+	require.NoError(t, err)
+	assert.Equal(t, []awsverify.Problem{{Check: "flow-logs", Message: "no flow log for vpc-1"}}, problems)
+}
+
+func TestWriteLocalStackProvider(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, awsverify.WriteLocalStackProvider(dir, "http://localhost:4566", "us-east-1"))
+
+	b, err := os.ReadFile(filepath.Join(dir, awsverify.LocalStackProviderFile))
+	require.NoError(t, err)
+	_, diags := hclsyntax.ParseConfig(b, awsverify.LocalStackProviderFile, hcl.InitialPos)
+	require.False(t, diags.HasErrors(), diags.Error())
+	assert.Contains(t, string(b), `ec2            = "http://localhost:4566"`)
+	assert.Contains(t, string(b), `region                      = "us-east-1"`)
+}
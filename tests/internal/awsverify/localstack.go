@@ -0,0 +1,40 @@
+package awsverify
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStackProviderFile is the file WriteLocalStackProvider adds to a
+// module copy.
+const LocalStackProviderFile = "localstack_provider.tf"
+
+// localStackServices are the provider endpoints redirected to LocalStack.
+var localStackServices = []string{
+	"cloudwatch", "cloudwatchlogs", "dynamodb", "ec2", "events", "iam", "kms", "s3", "sqs", "sts",
+}
+
+// WriteLocalStackProvider writes an aws provider block into dir that sends
+// every API call the modules make to endpoint. dir must be a private copy
+// of the module, such as the one isolate makes in the test helpers;
+// modules declare no provider block of their own, so this is a plain file
+// rather than an override.
+func WriteLocalStackProvider(dir, endpoint, region string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "provider \"aws\" {\n")
+	fmt.Fprintf(&b, "  region                      = %q\n", region)
+	fmt.Fprintf(&b, "  access_key                  = \"test\"\n")
+	fmt.Fprintf(&b, "  secret_key                  = \"test\"\n")
+	fmt.Fprintf(&b, "  s3_use_path_style           = true\n")
+	fmt.Fprintf(&b, "  skip_credentials_validation = true\n")
+	fmt.Fprintf(&b, "  skip_metadata_api_check     = true\n")
+	fmt.Fprintf(&b, "  skip_requesting_account_id  = true\n\n")
+	fmt.Fprintf(&b, "  endpoints {\n")
+	for _, svc := range localStackServices {
+		fmt.Fprintf(&b, "    %-14s = %q\n", svc, endpoint)
+	}
+	fmt.Fprintf(&b, "  }\n}\n")
+	return os.WriteFile(filepath.Join(dir, LocalStackProviderFile), []byte(b.String()), 0o644)
+}
@@ -0,0 +1,368 @@
+package awsverify
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// VPC is what modules/aws/vpc was asked to build, usually filled from its
+// outputs and input variables with FromOutputs.
+type VPC struct {
+	ID                string
+	PublicSubnetIDs   []string
+	PrivateSubnetIDs  []string
+	InternetGatewayID string
+
+	EnableNATGateway bool
+	SingleNATGateway bool
+
+	ECREndpoints bool
+	S3Endpoint   bool
+	SSMEndpoints bool
+
+	FlowLogs bool
+	// FlowLogsTrafficType is the expected traffic_type; empty means ALL.
+	FlowLogsTrafficType string
+}
+
+// Problem is one mismatch between the expected and the actual VPC.
+type Problem struct {
+	Check   string
+	Message string
+}
+
+func (p Problem) Error() string {
+	return p.Check + ": " + p.Message
+}
+
+// Verify runs every check and returns the problems found. An error means
+// the EC2 API could not be queried.
+func Verify(ctx context.Context, api EC2API, v VPC) ([]Problem, error) {
+	var out []Problem
+	for _, check := range []func(context.Context, EC2API, VPC) ([]Problem, error){
+		VerifyPublicRouting,
+		VerifyPrivateRouting,
+		VerifyEndpoints,
+		VerifyFlowLogs,
+	} {
+		problems, err := check(ctx, api, v)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, problems...)
+	}
+	return out, nil
+}
+
+// VerifyPublicRouting checks that every public subnet's route table sends
+// 0.0.0.0/0 to the VPC's internet gateway.
+func VerifyPublicRouting(ctx context.Context, api EC2API, v VPC) ([]Problem, error) {
+	const check = "public-routing"
+	var out []Problem
+	for _, subnet := range v.PublicSubnetIDs {
+		rt, err := routeTableFor(ctx, api, v.ID, subnet)
+		if err != nil {
+			return nil, err
+		}
+		if rt == nil {
+			out = append(out, Problem{check, fmt.Sprintf("%s has no route table", subnet)})
+			continue
+		}
+		route := defaultRoute(rt)
+		switch {
+		case route == nil:
+			out = append(out, Problem{check, fmt.Sprintf("%s (%s) has no 0.0.0.0/0 route", subnet, aws.StringValue(rt.RouteTableId))})
+		case aws.StringValue(route.GatewayId) != v.InternetGatewayID:
+			out = append(out, Problem{check, fmt.Sprintf("%s routes 0.0.0.0/0 to %s, want internet gateway %s", subnet, routeTarget(route), v.InternetGatewayID)})
+		case isBlackhole(route):
+			out = append(out, Problem{check, fmt.Sprintf("%s 0.0.0.0/0 route is a blackhole", subnet)})
+		}
+	}
+	return out, nil
+}
+
+// VerifyPrivateRouting checks private subnet egress. With NAT enabled every
+// private subnet routes 0.0.0.0/0 to an available NAT gateway: the single
+// shared one, or the one in its own AZ. Without NAT, private subnets must
+// have no default route at all.
+func VerifyPrivateRouting(ctx context.Context, api EC2API, v VPC) ([]Problem, error) {
+	const check = "private-routing"
+	nats, err := natGateways(ctx, api, v.ID)
+	if err != nil {
+		return nil, err
+	}
+	azs, err := subnetAZs(ctx, api, append(append([]string(nil), v.PublicSubnetIDs...), v.PrivateSubnetIDs...))
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Problem
+	if v.EnableNATGateway && len(v.PrivateSubnetIDs) > 0 {
+		want := 1
+		if !v.SingleNATGateway {
+			want = len(distinct(v.PrivateSubnetIDs, azs))
+		}
+		if len(nats) != want {
+			out = append(out, Problem{check, fmt.Sprintf("found %d available NAT gateways, want %d", len(nats), want)})
+		}
+	} else if len(nats) > 0 {
+		out = append(out, Problem{check, fmt.Sprintf("found %d NAT gateways with enable_nat_gateway = false", len(nats))})
+	}
+
+	for _, subnet := range v.PrivateSubnetIDs {
+		rt, err := routeTableFor(ctx, api, v.ID, subnet)
+		if err != nil {
+			return nil, err
+		}
+		if rt == nil {
+			out = append(out, Problem{check, fmt.Sprintf("%s has no route table", subnet)})
+			continue
+		}
+		route := defaultRoute(rt)
+		if !v.EnableNATGateway {
+			if route != nil {
+				out = append(out, Problem{check, fmt.Sprintf("%s routes 0.0.0.0/0 to %s without a NAT gateway", subnet, routeTarget(route))})
+			}
+			continue
+		}
+		if route == nil || aws.StringValue(route.NatGatewayId) == "" {
+			out = append(out, Problem{check, fmt.Sprintf("%s has no 0.0.0.0/0 route to a NAT gateway", subnet)})
+			continue
+		}
+		nat, ok := nats[aws.StringValue(route.NatGatewayId)]
+		if !ok {
+			out = append(out, Problem{check, fmt.Sprintf("%s routes to %s, which is not an available NAT gateway in %s", subnet, aws.StringValue(route.NatGatewayId), v.ID)})
+			continue
+		}
+		if !v.SingleNATGateway && azs[aws.StringValue(nat.SubnetId)] != azs[subnet] {
+			out = append(out, Problem{check, fmt.Sprintf("%s in %s routes to NAT %s in %s; want one NAT per AZ",
+				subnet, azs[subnet], aws.StringValue(nat.NatGatewayId), azs[aws.StringValue(nat.SubnetId)])})
+		}
+	}
+	return out, nil
+}
+
+// endpointServices maps each module flag to the service name suffixes it
+// creates endpoints for.
+var endpointServices = []struct {
+	flag     func(VPC) bool
+	name     string
+	services []string
+}{
+	{func(v VPC) bool { return v.ECREndpoints }, "enable_ecr_vpc_endpoints", []string{"ecr.api", "ecr.dkr"}},
+	{func(v VPC) bool { return v.S3Endpoint }, "enable_s3_vpc_endpoint", []string{"s3"}},
+	{func(v VPC) bool { return v.SSMEndpoints }, "enable_ssm_vpc_endpoints", []string{"ssm", "ssmmessages", "ec2messages"}},
+}
+
+// VerifyEndpoints checks that each endpoint exists and is available when
+// its flag is on and is absent when it is off. Interface endpoints must sit
+// in every private subnet and the S3 gateway endpoint must be attached to
+// every private route table.
+func VerifyEndpoints(ctx context.Context, api EC2API, v VPC) ([]Problem, error) {
+	const check = "endpoints"
+	resp, err := api.DescribeVpcEndpointsWithContext(ctx, &ec2.DescribeVpcEndpointsInput{
+		Filters: []*ec2.Filter{{Name: aws.String("vpc-id"), Values: aws.StringSlice([]string{v.ID})}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describing VPC endpoints: %w", err)
+	}
+	bySuffix := map[string]*ec2.VpcEndpoint{}
+	for _, ep := range resp.VpcEndpoints {
+		state := strings.ToLower(aws.StringValue(ep.State))
+		if state == "deleted" || state == "deleting" {
+			continue
+		}
+		name := aws.StringValue(ep.ServiceName)
+		// com.amazonaws.<region>.<service>
+		if parts := strings.SplitN(name, ".", 4); len(parts) == 4 {
+			bySuffix[parts[3]] = ep
+		}
+	}
+
+	var privateRTs []string
+	for _, subnet := range v.PrivateSubnetIDs {
+		rt, err := routeTableFor(ctx, api, v.ID, subnet)
+		if err != nil {
+			return nil, err
+		}
+		if rt != nil {
+			privateRTs = append(privateRTs, aws.StringValue(rt.RouteTableId))
+		}
+	}
+
+	var out []Problem
+	for _, es := range endpointServices {
+		on := es.flag(v)
+		for _, svc := range es.services {
+			ep, exists := bySuffix[svc]
+			switch {
+			case on && !exists:
+				out = append(out, Problem{check, fmt.Sprintf("%s endpoint missing with %s = true", svc, es.name)})
+			case !on && exists:
+				out = append(out, Problem{check, fmt.Sprintf("%s endpoint %s exists with %s = false", svc, aws.StringValue(ep.VpcEndpointId), es.name)})
+			case on:
+				if state := strings.ToLower(aws.StringValue(ep.State)); state != "available" {
+					out = append(out, Problem{check, fmt.Sprintf("%s endpoint is %s, want available", svc, state)})
+				}
+				if aws.StringValue(ep.VpcEndpointType) == ec2.VpcEndpointTypeGateway {
+					if missing := missingFrom(privateRTs, aws.StringValueSlice(ep.RouteTableIds)); len(missing) > 0 {
+						out = append(out, Problem{check, fmt.Sprintf("%s gateway endpoint not attached to route tables %s", svc, strings.Join(missing, ", "))})
+					}
+				} else if missing := missingFrom(v.PrivateSubnetIDs, aws.StringValueSlice(ep.SubnetIds)); len(missing) > 0 {
+					out = append(out, Problem{check, fmt.Sprintf("%s interface endpoint not in private subnets %s", svc, strings.Join(missing, ", "))})
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// VerifyFlowLogs checks that the VPC has an active flow log with the
+// expected traffic type when flow logs are enabled, and none otherwise.
+func VerifyFlowLogs(ctx context.Context, api EC2API, v VPC) ([]Problem, error) {
+	const check = "flow-logs"
+	resp, err := api.DescribeFlowLogsWithContext(ctx, &ec2.DescribeFlowLogsInput{
+		Filter: []*ec2.Filter{{Name: aws.String("resource-id"), Values: aws.StringSlice([]string{v.ID})}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describing flow logs: %w", err)
+	}
+	if !v.FlowLogs {
+		if len(resp.FlowLogs) > 0 {
+			return []Problem{{check, fmt.Sprintf("found %d flow logs with enable_flow_logs = false", len(resp.FlowLogs))}}, nil
+		}
+		return nil, nil
+	}
+	if len(resp.FlowLogs) == 0 {
+		return []Problem{{check, "no flow log for " + v.ID}}, nil
+	}
+
+	want := v.FlowLogsTrafficType
+	if want == "" {
+		want = "ALL"
+	}
+	var out []Problem
+	for _, fl := range resp.FlowLogs {
+		id := aws.StringValue(fl.FlowLogId)
+		if status := aws.StringValue(fl.FlowLogStatus); status != "ACTIVE" {
+			out = append(out, Problem{check, fmt.Sprintf("%s status is %s, want ACTIVE", id, status)})
+		}
+		if status := aws.StringValue(fl.DeliverLogsStatus); status == "FAILED" {
+			out = append(out, Problem{check, fmt.Sprintf("%s delivery failed: %s", id, aws.StringValue(fl.DeliverLogsErrorMessage))})
+		}
+		if tt := aws.StringValue(fl.TrafficType); tt != want {
+			out = append(out, Problem{check, fmt.Sprintf("%s captures %s traffic, want %s", id, tt, want)})
+		}
+	}
+	return out, nil
+}
+
+// routeTableFor returns the route table explicitly associated with subnet,
+// falling back to the VPC's main route table as EC2 does.
+func routeTableFor(ctx context.Context, api EC2API, vpcID, subnet string) (*ec2.RouteTable, error) {
+	for _, filters := range [][]*ec2.Filter{
+		{{Name: aws.String("association.subnet-id"), Values: aws.StringSlice([]string{subnet})}},
+		{
+			{Name: aws.String("vpc-id"), Values: aws.StringSlice([]string{vpcID})},
+			{Name: aws.String("association.main"), Values: aws.StringSlice([]string{"true"})},
+		},
+	} {
+		resp, err := api.DescribeRouteTablesWithContext(ctx, &ec2.DescribeRouteTablesInput{Filters: filters})
+		if err != nil {
+			return nil, fmt.Errorf("describing route tables for %s: %w", subnet, err)
+		}
+		if len(resp.RouteTables) > 0 {
+			return resp.RouteTables[0], nil
+		}
+	}
+	return nil, nil
+}
+
+func defaultRoute(rt *ec2.RouteTable) *ec2.Route {
+	for _, r := range rt.Routes {
+		if aws.StringValue(r.DestinationCidrBlock) == "0.0.0.0/0" {
+			return r
+		}
+	}
+	return nil
+}
+
+func isBlackhole(r *ec2.Route) bool {
+	return aws.StringValue(r.State) == ec2.RouteStateBlackhole
+}
+
+func routeTarget(r *ec2.Route) string {
+	for _, id := range []*string{r.GatewayId, r.NatGatewayId, r.TransitGatewayId, r.NetworkInterfaceId, r.VpcPeeringConnectionId} {
+		if s := aws.StringValue(id); s != "" {
+			return s
+		}
+	}
+	return "an unknown target"
+}
+
+// natGateways returns the VPC's available NAT gateways by ID.
+func natGateways(ctx context.Context, api EC2API, vpcID string) (map[string]*ec2.NatGateway, error) {
+	resp, err := api.DescribeNatGatewaysWithContext(ctx, &ec2.DescribeNatGatewaysInput{
+		Filter: []*ec2.Filter{
+			{Name: aws.String("vpc-id"), Values: aws.StringSlice([]string{vpcID})},
+			{Name: aws.String("state"), Values: aws.StringSlice([]string{ec2.NatGatewayStateAvailable})},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describing NAT gateways: %w", err)
+	}
+	out := map[string]*ec2.NatGateway{}
+	for _, n := range resp.NatGateways {
+		out[aws.StringValue(n.NatGatewayId)] = n
+	}
+	return out, nil
+}
+
+// subnetAZs maps subnet IDs to their availability zones.
+func subnetAZs(ctx context.Context, api EC2API, ids []string) (map[string]string, error) {
+	out := map[string]string{}
+	if len(ids) == 0 {
+		return out, nil
+	}
+	resp, err := api.DescribeSubnetsWithContext(ctx, &ec2.DescribeSubnetsInput{SubnetIds: aws.StringSlice(ids)})
+	if err != nil {
+		return nil, fmt.Errorf("describing subnets: %w", err)
+	}
+	for _, s := range resp.Subnets {
+		out[aws.StringValue(s.SubnetId)] = aws.StringValue(s.AvailabilityZone)
+	}
+	return out, nil
+}
+
+func distinct(subnets []string, azs map[string]string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, s := range subnets {
+		if az := azs[s]; !seen[az] {
+			seen[az] = true
+			out = append(out, az)
+		}
+	}
+	return out
+}
+
+// missingFrom returns the elements of want not in have, sorted.
+func missingFrom(want, have []string) []string {
+	set := map[string]bool{}
+	for _, h := range have {
+		set[h] = true
+	}
+	var out []string
+	for _, w := range want {
+		if !set[w] {
+			out = append(out, w)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,264 @@
+package charts_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/charts"
+)
+
+const eksAddons = "../../../modules/aws/eks-addons"
+
+func TestDiscoverEKSAddons(t *testing.T) {
+	releases, err := charts.Discover(eksAddons)
+	require.NoError(t, err)
+
+	byResource := map[string]charts.Release{}
+	for _, r := range releases {
+		byResource[r.Resource] = r
+		assert.NotEmpty(t, r.Flag, "%s has no enable_* flag", r.Address())
+		assert.NotEmpty(t, r.VersionVar, "%s version is not a variable", r.Address())
+		assert.NotEmpty(t, r.Version, r.Address())
+	}
+	assert.Len(t, releases, 9)
+
+	alb := byResource["alb_controller"]
+	assert.Equal(t, charts.Release{
+		Resource:   "alb_controller",
+		Name:       "aws-load-balancer-controller",
+		Namespace:  "kube-system",
+		Repository: "https://aws.github.io/eks-charts",
+		Chart:      "aws-load-balancer-controller",
+		Version:    "1.6.2",
+		VersionVar: "alb_controller_version",
+		Flag:       "enable_alb_controller",
+		File:       "alb-controller.tf",
+		Line:       54,
+	}, alb)
+
+	karpenter := byResource["karpenter"]
+	assert.Equal(t, "oci://public.ecr.aws/karpenter", karpenter.Repository)
+	assert.Equal(t, "kube-system", karpenter.Namespace, "namespace comes from the karpenter_namespace default")
+	assert.Equal(t, "monitoring", byResource["prometheus"].Namespace)
+}
+
+func TestDiscoverRejectsComputedVersion(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(`
+resource "helm_release" "x" {
+  name    = "x"
+  chart   = "x"
+  version = data.external.latest.result.version
+}
+`), 0o644))
+	_, err := charts.Discover(dir)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "helm_release.x: version must be a literal or a variable with a default")
+}
+
+// chartArchive builds a minimal chart .tgz.
+func chartArchive(t *testing.T, name, version string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for file, body := range map[string]string{
+		name + "/Chart.yaml":  fmt.Sprintf("apiVersion: v2\nname: %s\nversion: %s\nappVersion: %q\ndescription: test chart\n", name, version, "1.0"),
+		name + "/values.yaml": "replicaCount: 1\n",
+	} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: file, Mode: 0o644, Size: int64(len(body))}))
+		_, err := tw.Write([]byte(body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+type fakeFetcher struct {
+	t     *testing.T
+	calls []string
+}
+
+func (f *fakeFetcher) Fetch(_ context.Context, repo, chart, version string) ([]byte, error) {
+	f.calls = append(f.calls, chart+" "+version)
+	return chartArchive(f.t, chart, version), nil
+}
+
+func TestSyncAndCheck(t *testing.T) {
+	dir := t.TempDir()
+	releases := []charts.Release{
+		{Resource: "a", Chart: "alpha", Version: "1.0.0", Repository: "https://charts.example.com"},
+		{Resource: "b", Chart: "beta", Version: "v2.1.0", Repository: "oci://registry.example.com/charts"},
+	}
+
+	problems, err := charts.Check(dir, releases)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"helm_release.a: alpha 1.0.0 not in mirror",
+		"helm_release.b: beta v2.1.0 not in mirror",
+	}, problems)
+
+	f := &fakeFetcher{t: t}
+	res, err := charts.Sync(context.Background(), dir, releases, f)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alpha 1.0.0", "beta v2.1.0"}, res.Fetched)
+	problems, err = charts.Check(dir, releases)
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+
+	idx, err := charts.LoadIndex(dir)
+	require.NoError(t, err)
+	cv := idx.Lookup("beta", "2.1.0")
+	require.NotNil(t, cv, "lookup ignores a leading v")
+	assert.Equal(t, []string{"beta-v2.1.0.tgz"}, cv.URLs)
+	assert.Equal(t, []string{"oci://registry.example.com/charts"}, cv.Sources)
+	assert.Equal(t, "1.0", cv.AppVersion)
+
+	// A second sync fetches nothing; a corrupted archive is caught and
+	// re-fetched; a dropped release is pruned.
+	res, err = charts.Sync(context.Background(), dir, releases, f)
+	require.NoError(t, err)
+	assert.Empty(t, res.Fetched)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "alpha-1.0.0.tgz"), []byte("tampered"), 0o644))
+	problems, err = charts.Check(dir, releases)
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	assert.Contains(t, problems[0], "helm_release.a: alpha-1.0.0.tgz digest")
+
+	res, err = charts.Sync(context.Background(), dir, releases[1:], f)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alpha-1.0.0.tgz"}, res.Pruned)
+	assert.Equal(t, []string{"beta v2.1.0"}, res.Kept)
+	assert.Len(t, f.calls, 2)
+
+	problems, err = charts.Check(dir, releases[1:])
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+}
+
+func TestSyncRejectsWrongArchive(t *testing.T) {
+	f := fetcherFunc(func(context.Context, string, string, string) ([]byte, error) {
+		return chartArchive(t, "other", "9.9.9"), nil
+	})
+	_, err := charts.Sync(context.Background(), t.TempDir(),
+		[]charts.Release{{Resource: "a", Chart: "alpha", Version: "1.0.0"}}, f)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "archive contains other 9.9.9")
+}
+
+type fetcherFunc func(context.Context, string, string, string) ([]byte, error)
+
+func (f fetcherFunc) Fetch(ctx context.Context, repo, chart, version string) ([]byte, error) {
+	return f(ctx, repo, chart, version)
+}
+
+func sha(b []byte) string {
+	s := sha256.Sum256(b)
+	return hex.EncodeToString(s[:])
+}
+
+func TestHTTPFetcherRepository(t *testing.T) {
+	archive := chartArchive(t, "alpha", "1.0.0")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stable/index.yaml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "apiVersion: v1\nentries:\n  alpha:\n  - name: alpha\n    version: 1.0.0\n    digest: %s\n    urls: [packages/alpha-1.0.0.tgz]\n", sha(archive))
+	})
+	mux.HandleFunc("/stable/packages/alpha-1.0.0.tgz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(archive)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	got, err := charts.HTTPFetcher{}.Fetch(context.Background(), srv.URL+"/stable", "alpha", "1.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, archive, got)
+
+	_, err = charts.HTTPFetcher{}.Fetch(context.Background(), srv.URL+"/stable", "alpha", "2.0.0")
+	assert.ErrorContains(t, err, "alpha 2.0.0 not in")
+}
+
+func TestHTTPFetcherOCI(t *testing.T) {
+	archive := chartArchive(t, "karpenter", "0.37.0")
+	layer := "sha256:" + sha(archive)
+	var srv *httptest.Server
+	srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			assert.Equal(t, "repository:karpenter/karpenter:pull", r.URL.Query().Get("scope"))
+			_ = json.NewEncoder(w).Encode(map[string]string{"token": "anon"})
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer anon" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:karpenter/karpenter:pull"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/karpenter/karpenter/manifests/0.37.0":
+			_ = json.NewEncoder(w).Encode(map[string]any{"layers": []map[string]string{
+				{"mediaType": "application/vnd.cncf.helm.config.v1+json", "digest": "sha256:00"},
+				{"mediaType": "application/vnd.cncf.helm.chart.content.v1.tar+gzip", "digest": layer},
+			}})
+		case "/v2/karpenter/karpenter/blobs/" + layer:
+			_, _ = w.Write(archive)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	ref := "oci://" + strings.TrimPrefix(srv.URL, "https://") + "/karpenter"
+	got, err := charts.HTTPFetcher{Client: srv.Client()}.Fetch(context.Background(), ref, "karpenter", "0.37.0")
+	require.NoError(t, err)
+	assert.Equal(t, archive, got)
+}
+
+func TestWriteOverride(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, charts.WriteOverride(dir, charts.Override{
+		Kubeconfig: "/tmp/kind.kubeconfig",
+		MirrorURL:  "http://127.0.0.1:8879",
+		Releases:   []charts.Release{{Resource: "karpenter"}, {Resource: "cert_manager"}},
+		NoWait:     map[string]bool{"karpenter": true},
+	}))
+
+	b, err := os.ReadFile(filepath.Join(dir, charts.OverrideFile))
+	require.NoError(t, err)
+	_, diags := hclsyntax.ParseConfig(b, charts.OverrideFile, hcl.InitialPos)
+	require.False(t, diags.HasErrors(), diags.Error())
+	assert.Equal(t, `provider "helm" {
+  kubernetes {
+    config_path = "/tmp/kind.kubeconfig"
+  }
+}
+
+resource "helm_release" "cert_manager" {
+  repository = "http://127.0.0.1:8879"
+}
+
+resource "helm_release" "karpenter" {
+  repository = "http://127.0.0.1:8879"
+  wait       = false
+  atomic     = false
+}
+
+`, string(b))
+}
@@ -0,0 +1,135 @@
+// Package charts reads the helm_release resources a module declares and
+// keeps a local Helm repository mirror of exactly those chart versions, so
+// module tests install pinned, digest-checked charts without reaching the
+// upstream repositories.
+package charts
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Release is one helm_release resource with its attributes evaluated
+// against the module's variable defaults.
+type Release struct {
+	// Resource is the resource name, e.g. alb_controller.
+	Resource   string
+	Name       string
+	Namespace  string
+	Repository string
+	Chart      string
+	Version    string
+	// VersionVar is the variable that sets Version, if any.
+	VersionVar string
+	// Flag is the bool variable in `count = var.<flag> ? 1 : 0`, if any.
+	Flag string
+	File string
+	Line int
+}
+
+// Address is the resource address in a plan or state of the module.
+func (r Release) Address() string {
+	return "helm_release." + r.Resource
+}
+
+// Discover returns the helm_release resources declared in moduleDir,
+// sorted by resource name. Namespaces default to "default" as in the Helm
+// provider.
+func Discover(moduleDir string) ([]Release, error) {
+	files, err := filepath.Glob(filepath.Join(moduleDir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: no .tf files", moduleDir)
+	}
+	var bodies []*hclsyntax.Body
+	for _, path := range files {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		f, diags := hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		bodies = append(bodies, f.Body.(*hclsyntax.Body))
+	}
+
+	vars := map[string]cty.Value{}
+	for _, body := range bodies {
+		for _, b := range body.Blocks {
+			if b.Type != "variable" || len(b.Labels) != 1 {
+				continue
+			}
+			if attr, ok := b.Body.Attributes["default"]; ok {
+				if v, diags := attr.Expr.Value(nil); !diags.HasErrors() {
+					vars[b.Labels[0]] = v
+				}
+			}
+		}
+	}
+	ctx := &hcl.EvalContext{Variables: map[string]cty.Value{"var": cty.ObjectVal(vars)}}
+
+	var out []Release
+	for _, body := range bodies {
+		for _, b := range body.Blocks {
+			if b.Type != "resource" || len(b.Labels) != 2 || b.Labels[0] != "helm_release" {
+				continue
+			}
+			r := Release{
+				Resource:  b.Labels[1],
+				Namespace: "default",
+				File:      filepath.Base(b.DefRange().Filename),
+				Line:      b.DefRange().Start.Line,
+			}
+			for name, dst := range map[string]*string{
+				"name":       &r.Name,
+				"namespace":  &r.Namespace,
+				"repository": &r.Repository,
+				"chart":      &r.Chart,
+				"version":    &r.Version,
+			} {
+				attr, ok := b.Body.Attributes[name]
+				if !ok {
+					continue
+				}
+				v, diags := attr.Expr.Value(ctx)
+				if diags.HasErrors() || v.IsNull() || !v.IsKnown() || v.Type() != cty.String {
+					return nil, fmt.Errorf("%s:%d: helm_release.%s: %s must be a literal or a variable with a default",
+						r.File, attr.SrcRange.Start.Line, r.Resource, name)
+				}
+				*dst = v.AsString()
+			}
+			if attr, ok := b.Body.Attributes["version"]; ok {
+				r.VersionVar = varName(attr.Expr)
+			}
+			if attr, ok := b.Body.Attributes["count"]; ok {
+				if cond, ok := attr.Expr.(*hclsyntax.ConditionalExpr); ok {
+					r.Flag = varName(cond.Condition)
+				}
+			}
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Resource < out[j].Resource })
+	return out, nil
+}
+
+// varName returns X for an expression that is exactly var.X.
+func varName(expr hcl.Expression) string {
+	t, ok := expr.(*hclsyntax.ScopeTraversalExpr)
+	if !ok || len(t.Traversal) != 2 || t.Traversal.RootName() != "var" {
+		return ""
+	}
+	if a, ok := t.Traversal[1].(hcl.TraverseAttr); ok {
+		return a.Name
+	}
+	return ""
+}
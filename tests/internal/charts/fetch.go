@@ -0,0 +1,195 @@
+package charts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ociChartLayer is the media type of the chart archive in an OCI artifact.
+const ociChartLayer = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+
+// HTTPFetcher fetches charts from classic Helm repositories (index.yaml)
+// and from OCI registries (oci://host/path, anonymous pull).
+type HTTPFetcher struct {
+	Client *http.Client
+}
+
+func (f HTTPFetcher) client() *http.Client {
+	if f.Client != nil {
+		return f.Client
+	}
+	return http.DefaultClient
+}
+
+// Fetch returns the archive for chart at version, verified against the
+// digest the repository publishes.
+func (f HTTPFetcher) Fetch(ctx context.Context, repository, chart, version string) ([]byte, error) {
+	if strings.HasPrefix(repository, "oci://") {
+		return f.fetchOCI(ctx, strings.TrimPrefix(repository, "oci://"), chart, version)
+	}
+	return f.fetchRepo(ctx, repository, chart, version)
+}
+
+func (f HTTPFetcher) fetchRepo(ctx context.Context, repository, chart, version string) ([]byte, error) {
+	base, err := url.Parse(strings.TrimSuffix(repository, "/") + "/")
+	if err != nil {
+		return nil, err
+	}
+	b, err := f.get(ctx, base.JoinPath(IndexFile).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var idx Index
+	if err := yaml.Unmarshal(b, &idx); err != nil {
+		return nil, fmt.Errorf("%s: %w", IndexFile, err)
+	}
+	cv := idx.Lookup(chart, version)
+	if cv == nil || len(cv.URLs) == 0 {
+		return nil, fmt.Errorf("%s %s not in %s", chart, version, repository)
+	}
+	u, err := base.Parse(cv.URLs[0])
+	if err != nil {
+		return nil, err
+	}
+	data, err := f.get(ctx, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if cv.Digest != "" {
+		if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != cv.Digest {
+			return nil, fmt.Errorf("%s: digest does not match %s", u, IndexFile)
+		}
+	}
+	return data, nil
+}
+
+func (f HTTPFetcher) fetchOCI(ctx context.Context, ref, chart, version string) ([]byte, error) {
+	host, repo, _ := strings.Cut(strings.TrimSuffix(ref, "/"), "/")
+	repo = strings.TrimPrefix(repo+"/"+chart, "/")
+	registry := "https://" + host + "/v2/" + repo
+
+	header := http.Header{"Accept": {"application/vnd.oci.image.manifest.v1+json"}}
+	b, err := f.getAuthorized(ctx, registry+"/manifests/"+version, header)
+	if err != nil {
+		return nil, err
+	}
+	var manifest struct {
+		Layers []struct {
+			MediaType string `json:"mediaType"`
+			Digest    string `json:"digest"`
+		} `json:"layers"`
+	}
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return nil, fmt.Errorf("manifest: %w", err)
+	}
+	for _, l := range manifest.Layers {
+		if l.MediaType != ociChartLayer {
+			continue
+		}
+		data, err := f.getAuthorized(ctx, registry+"/blobs/"+l.Digest, header)
+		if err != nil {
+			return nil, err
+		}
+		if sum := sha256.Sum256(data); "sha256:"+hex.EncodeToString(sum[:]) != l.Digest {
+			return nil, fmt.Errorf("%s:%s: layer digest mismatch", repo, version)
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("%s:%s has no chart layer", repo, version)
+}
+
+// getAuthorized retries a 401 with an anonymous bearer token from the
+// registry's WWW-Authenticate challenge.
+func (f HTTPFetcher) getAuthorized(ctx context.Context, u string, header http.Header) ([]byte, error) {
+	b, err := f.get(ctx, u, header)
+	var ue *unauthorizedError
+	if !errors.As(err, &ue) {
+		return b, err
+	}
+	params := challengeParams(ue.challenge)
+	if params["realm"] == "" {
+		return nil, err
+	}
+	tokenURL, perr := url.Parse(params["realm"])
+	if perr != nil {
+		return nil, perr
+	}
+	q := tokenURL.Query()
+	for _, k := range []string{"service", "scope"} {
+		if params[k] != "" {
+			q.Set(k, params[k])
+		}
+	}
+	tokenURL.RawQuery = q.Encode()
+	tb, err := f.get(ctx, tokenURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("registry token: %w", err)
+	}
+	var tok struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(tb, &tok); err != nil {
+		return nil, fmt.Errorf("registry token: %w", err)
+	}
+	if tok.Token == "" {
+		tok.Token = tok.AccessToken
+	}
+	h := header.Clone()
+	h.Set("Authorization", "Bearer "+tok.Token)
+	return f.get(ctx, u, h)
+}
+
+type unauthorizedError struct {
+	url       string
+	challenge string
+}
+
+func (e *unauthorizedError) Error() string {
+	return "GET " + e.url + ": 401 Unauthorized"
+}
+
+// challengeParams parses `Bearer realm="...",service="...",scope="..."`.
+func challengeParams(challenge string) map[string]string {
+	out := map[string]string{}
+	_, rest, _ := strings.Cut(challenge, " ")
+	for _, part := range strings.Split(rest, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok {
+			out[strings.ToLower(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return out
+}
+
+func (f HTTPFetcher) get(ctx context.Context, u string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := f.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, &unauthorizedError{url: u, challenge: resp.Header.Get("WWW-Authenticate")}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
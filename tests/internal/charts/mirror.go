@@ -0,0 +1,267 @@
+package charts
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// IndexFile is the Helm repository index in a mirror directory.
+const IndexFile = "index.yaml"
+
+// Index is a Helm repository index.yaml.
+type Index struct {
+	APIVersion string                     `yaml:"apiVersion"`
+	Entries    map[string][]*ChartVersion `yaml:"entries"`
+	Generated  time.Time                  `yaml:"generated"`
+}
+
+// ChartVersion is one chart archive in an Index.
+type ChartVersion struct {
+	APIVersion  string    `yaml:"apiVersion,omitempty"`
+	Name        string    `yaml:"name"`
+	Version     string    `yaml:"version"`
+	AppVersion  string    `yaml:"appVersion,omitempty"`
+	Description string    `yaml:"description,omitempty"`
+	Digest      string    `yaml:"digest,omitempty"`
+	URLs        []string  `yaml:"urls"`
+	Sources     []string  `yaml:"sources,omitempty"`
+	Created     time.Time `yaml:"created,omitempty"`
+}
+
+// sameVersion compares chart versions the way Helm resolves an exact
+// constraint, so "1.13.3" finds cert-manager's "v1.13.3".
+func sameVersion(a, b string) bool {
+	return strings.TrimPrefix(a, "v") == strings.TrimPrefix(b, "v")
+}
+
+// Lookup returns the entry for chart at version, or nil.
+func (idx *Index) Lookup(chart, version string) *ChartVersion {
+	for _, cv := range idx.Entries[chart] {
+		if sameVersion(cv.Version, version) {
+			return cv
+		}
+	}
+	return nil
+}
+
+// LoadIndex reads dir/index.yaml. A missing index is an empty mirror.
+func LoadIndex(dir string) (*Index, error) {
+	idx := &Index{APIVersion: "v1", Entries: map[string][]*ChartVersion{}}
+	b, err := os.ReadFile(filepath.Join(dir, IndexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(b, idx); err != nil {
+		return nil, fmt.Errorf("%s: %w", IndexFile, err)
+	}
+	if idx.Entries == nil {
+		idx.Entries = map[string][]*ChartVersion{}
+	}
+	return idx, nil
+}
+
+// Write stores idx as dir/index.yaml with entries in a stable order.
+func (idx *Index) Write(dir string) error {
+	for _, versions := range idx.Entries {
+		sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	}
+	b, err := yaml.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, IndexFile), b, 0o644)
+}
+
+// Check reports every way the mirror in dir differs from releases: charts
+// missing from the index or disk, archives whose digest does not match,
+// and entries no release uses.
+func Check(dir string, releases []Release) ([]string, error) {
+	idx, err := LoadIndex(dir)
+	if err != nil {
+		return nil, err
+	}
+	var problems []string
+	used := map[*ChartVersion]bool{}
+	for _, r := range releases {
+		cv := idx.Lookup(r.Chart, r.Version)
+		if cv == nil {
+			problems = append(problems, fmt.Sprintf("%s: %s %s not in mirror", r.Address(), r.Chart, r.Version))
+			continue
+		}
+		used[cv] = true
+		if len(cv.URLs) == 0 {
+			problems = append(problems, fmt.Sprintf("%s: %s %s has no archive", r.Address(), r.Chart, r.Version))
+			continue
+		}
+		digest, err := fileDigest(filepath.Join(dir, cv.URLs[0]))
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("%s: %v", r.Address(), err))
+		case digest != cv.Digest:
+			problems = append(problems, fmt.Sprintf("%s: %s digest %s, index says %s", r.Address(), cv.URLs[0], digest, cv.Digest))
+		}
+	}
+	for _, versions := range idx.Entries {
+		for _, cv := range versions {
+			if !used[cv] {
+				problems = append(problems, fmt.Sprintf("%s %s is not used by any release", cv.Name, cv.Version))
+			}
+		}
+	}
+	sort.Strings(problems)
+	return problems, nil
+}
+
+// Fetcher downloads a chart archive from its upstream repository.
+type Fetcher interface {
+	Fetch(ctx context.Context, repository, chart, version string) ([]byte, error)
+}
+
+// SyncResult lists what Sync did, by "chart version".
+type SyncResult struct {
+	Fetched []string
+	Kept    []string
+	Pruned  []string
+}
+
+// Sync makes the mirror in dir hold exactly the charts releases use. Charts
+// already present with a matching digest are kept, missing or corrupt ones
+// are fetched, and unused ones are removed.
+func Sync(ctx context.Context, dir string, releases []Release, f Fetcher) (*SyncResult, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	idx, err := LoadIndex(dir)
+	if err != nil {
+		return nil, err
+	}
+	res := &SyncResult{}
+	next := map[string][]*ChartVersion{}
+	seen := map[string]bool{}
+	for _, r := range releases {
+		key := r.Chart + " " + r.Version
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		if cv := idx.Lookup(r.Chart, r.Version); cv != nil && len(cv.URLs) > 0 {
+			if d, err := fileDigest(filepath.Join(dir, cv.URLs[0])); err == nil && d == cv.Digest {
+				next[r.Chart] = append(next[r.Chart], cv)
+				res.Kept = append(res.Kept, key)
+				continue
+			}
+		}
+
+		data, err := f.Fetch(ctx, r.Repository, r.Chart, r.Version)
+		if err != nil {
+			return nil, fmt.Errorf("fetching %s %s from %s: %w", r.Chart, r.Version, r.Repository, err)
+		}
+		cv, err := chartMetadata(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", r.Chart, r.Version, err)
+		}
+		if cv.Name != r.Chart || !sameVersion(cv.Version, r.Version) {
+			return nil, fmt.Errorf("%s %s: archive contains %s %s", r.Chart, r.Version, cv.Name, cv.Version)
+		}
+		file := fmt.Sprintf("%s-%s.tgz", cv.Name, cv.Version)
+		if err := os.WriteFile(filepath.Join(dir, file), data, 0o644); err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		cv.Digest = hex.EncodeToString(sum[:])
+		cv.URLs = []string{file}
+		cv.Sources = []string{r.Repository}
+		cv.Created = time.Now().UTC().Truncate(time.Second)
+		next[r.Chart] = append(next[r.Chart], cv)
+		res.Fetched = append(res.Fetched, key)
+	}
+
+	keep := map[string]bool{IndexFile: true}
+	for _, versions := range next {
+		for _, cv := range versions {
+			keep[cv.URLs[0]] = true
+		}
+	}
+	archives, err := filepath.Glob(filepath.Join(dir, "*.tgz"))
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range archives {
+		if keep[filepath.Base(a)] {
+			continue
+		}
+		if err := os.Remove(a); err != nil {
+			return nil, err
+		}
+		res.Pruned = append(res.Pruned, filepath.Base(a))
+	}
+
+	idx.Entries = next
+	idx.Generated = time.Now().UTC().Truncate(time.Second)
+	if err := idx.Write(dir); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// chartMetadata reads <chart>/Chart.yaml from a chart archive.
+func chartMetadata(archive []byte) (*ChartVersion, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, fmt.Errorf("not a chart archive: %w", err)
+	}
+	tr := tar.NewReader(zr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil, errors.New("archive has no Chart.yaml")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if path.Base(h.Name) != "Chart.yaml" || strings.Count(path.Clean(h.Name), "/") != 1 {
+			continue
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		cv := &ChartVersion{}
+		if err := yaml.Unmarshal(b, cv); err != nil {
+			return nil, fmt.Errorf("Chart.yaml: %w", err)
+		}
+		return cv, nil
+	}
+}
@@ -0,0 +1,59 @@
+package charts
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// OverrideFile is the Terraform override file WriteOverride creates in a
+// module copy.
+const OverrideFile = "charts_override.tf"
+
+// Override redirects a module's Helm provider and releases for a test.
+type Override struct {
+	// Kubeconfig replaces the module's helm provider connection, e.g. a
+	// kind cluster's kubeconfig.
+	Kubeconfig string
+	// MirrorURL replaces every release's repository.
+	MirrorURL string
+	// Releases are the module's releases, from Discover.
+	Releases []Release
+	// NoWait names releases to install without waiting for their
+	// workloads, for controllers that cannot become Ready off AWS.
+	NoWait map[string]bool
+}
+
+// WriteOverride writes o as dir/charts_override.tf. Terraform merges it
+// into the module: the provider's kubernetes block and the listed release
+// attributes are replaced, everything else (set blocks, counts, versions)
+// stays as the module declares it.
+func WriteOverride(dir string, o Override) error {
+	f := hclwrite.NewEmptyFile()
+	body := f.Body()
+
+	if o.Kubeconfig != "" {
+		provider := body.AppendNewBlock("provider", []string{"helm"}).Body()
+		provider.AppendNewBlock("kubernetes", nil).Body().
+			SetAttributeValue("config_path", cty.StringVal(o.Kubeconfig))
+		body.AppendNewline()
+	}
+
+	releases := append([]Release(nil), o.Releases...)
+	sort.Slice(releases, func(i, j int) bool { return releases[i].Resource < releases[j].Resource })
+	for _, r := range releases {
+		rb := body.AppendNewBlock("resource", []string{"helm_release", r.Resource}).Body()
+		if o.MirrorURL != "" {
+			rb.SetAttributeValue("repository", cty.StringVal(o.MirrorURL))
+		}
+		if o.NoWait[r.Resource] {
+			rb.SetAttributeValue("wait", cty.False)
+			rb.SetAttributeValue("atomic", cty.False)
+		}
+		body.AppendNewline()
+	}
+	return os.WriteFile(filepath.Join(dir, OverrideFile), f.Bytes(), 0o644)
+}
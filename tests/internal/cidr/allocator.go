@@ -0,0 +1,272 @@
+package cidr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/yourorg/tf-modules/tests/internal/filelock"
+)
+
+// Environment variables that configure DefaultAllocator, so CI can give
+// each runner its own pool or share one state directory between jobs.
+const (
+	EnvPool      = "TEST_CIDR_POOL"
+	EnvBlockBits = "TEST_CIDR_BLOCK_BITS"
+	EnvStateDir  = "TEST_CIDR_STATE_DIR"
+)
+
+// Defaults for DefaultAllocator: 64 /16 blocks from 10.64.0.0/10, which
+// stays clear of the 10.0.0.0/16-style ranges in examples/ and environments/.
+const (
+	DefaultPool      = "10.64.0.0/10"
+	DefaultBlockBits = 16
+	// DefaultTTL bounds how long a lease survives a test binary that was
+	// killed before its cleanup ran.
+	DefaultTTL = 6 * time.Hour
+)
+
+// ErrExhausted is returned when every block in the pool is leased.
+var ErrExhausted = errors.New("cidr pool exhausted")
+
+// Allocator leases fixed-size blocks from a pool. State lives in a JSON file
+// guarded by an exclusive file lock, so test binaries running in parallel
+// (go test runs one per package) never lease the same block.
+type Allocator struct {
+	Pool      netip.Prefix
+	BlockBits int
+	// StateFile holds the current leases; StateFile + ".lock" is locked
+	// around every read-modify-write.
+	StateFile string
+	TTL       time.Duration
+	// now is overridden in tests.
+	now func() time.Time
+}
+
+// NewAllocator returns an allocator leasing /blockBits blocks from pool,
+// keeping state in dir.
+func NewAllocator(pool string, blockBits int, dir string) (*Allocator, error) {
+	p, err := netip.ParsePrefix(pool)
+	if err != nil {
+		return nil, fmt.Errorf("parsing pool: %w", err)
+	}
+	if !p.Addr().Is4() || blockBits < p.Bits() || blockBits > 30 {
+		return nil, fmt.Errorf("cannot lease /%d blocks from %s", blockBits, p)
+	}
+	return &Allocator{
+		Pool:      p.Masked(),
+		BlockBits: blockBits,
+		StateFile: filepath.Join(dir, "leases-"+sanitize(p.Masked().String())+".json"),
+		TTL:       DefaultTTL,
+		now:       time.Now,
+	}, nil
+}
+
+// DefaultAllocator returns the allocator configured by TEST_CIDR_POOL,
+// TEST_CIDR_BLOCK_BITS and TEST_CIDR_STATE_DIR, falling back to
+// DefaultPool, DefaultBlockBits and a directory under os.TempDir().
+func DefaultAllocator() (*Allocator, error) {
+	pool := os.Getenv(EnvPool)
+	if pool == "" {
+		pool = DefaultPool
+	}
+	bits := DefaultBlockBits
+	if v := os.Getenv(EnvBlockBits); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", EnvBlockBits, err)
+		}
+		bits = n
+	}
+	dir := os.Getenv(EnvStateDir)
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "tf-modules-cidr")
+	}
+	return NewAllocator(pool, bits, dir)
+}
+
+// leaseRecord is the persisted form of a lease.
+type leaseRecord struct {
+	Block   string    `json:"block"`
+	Owner   string    `json:"owner"`
+	PID     int       `json:"pid"`
+	Expires time.Time `json:"expires"`
+}
+
+// Lease is a block held by one test.
+type Lease struct {
+	Block netip.Prefix
+	Owner string
+	a     *Allocator
+}
+
+// Lease reserves the lowest free block for owner, typically t.Name().
+// Expired leases are reclaimed first.
+func (a *Allocator) Lease(owner string) (*Lease, error) {
+	var leased netip.Prefix
+	err := a.update(func(leases []leaseRecord) ([]leaseRecord, error) {
+		used := map[string]bool{}
+		for _, l := range leases {
+			used[l.Block] = true
+		}
+		count := 1 << (a.BlockBits - a.Pool.Bits())
+		for i := 0; i < count; i++ {
+			block, err := Subnet(a.Pool, a.BlockBits-a.Pool.Bits(), i)
+			if err != nil {
+				return nil, err
+			}
+			if used[block.String()] {
+				continue
+			}
+			leased = block
+			return append(leases, leaseRecord{
+				Block:   block.String(),
+				Owner:   owner,
+				PID:     os.Getpid(),
+				Expires: a.now().Add(a.TTL),
+			}), nil
+		}
+		return nil, fmt.Errorf("%w: all %d /%d blocks of %s are leased", ErrExhausted, count, a.BlockBits, a.Pool)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Lease{Block: leased, Owner: owner, a: a}, nil
+}
+
+// Release returns the block to the pool. Releasing twice is a no-op.
+func (l *Lease) Release() error {
+	return l.a.update(func(leases []leaseRecord) ([]leaseRecord, error) {
+		out := leases[:0]
+		for _, r := range leases {
+			if r.Block != l.Block.String() {
+				out = append(out, r)
+			}
+		}
+		return out, nil
+	})
+}
+
+// CIDR returns the leased block, e.g. "10.64.0.0/16".
+func (l *Lease) CIDR() string {
+	return l.Block.String()
+}
+
+// Subnets returns count consecutive subnets of the block extended by
+// newBits, starting at index first.
+func (l *Lease) Subnets(newBits, first, count int) ([]string, error) {
+	out := make([]string, 0, count)
+	for i := first; i < first+count; i++ {
+		s, err := Subnet(l.Block, newBits, i)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s.String())
+	}
+	return out, nil
+}
+
+// SubnetPrefix is the subnet size Tiers uses when the block is big enough.
+const SubnetPrefix = 24
+
+// Tiers lays out one subnet per AZ for each named tier, e.g.
+// Tiers(2, "public", "private") on 10.64.0.0/16 gives public
+// [10.64.0.0/24 10.64.1.0/24] and private [10.64.2.0/24 10.64.3.0/24].
+// Subnets are /24 when the block has room for them; smaller blocks are
+// split into the fewest equal subnets that fit.
+func (l *Lease) Tiers(azs int, tiers ...string) (map[string][]string, error) {
+	newBits := SubnetPrefix - l.Block.Bits()
+	if newBits < 0 {
+		newBits = 0
+	}
+	for 1<<newBits < azs*len(tiers) {
+		newBits++
+	}
+	out := make(map[string][]string, len(tiers))
+	for i, tier := range tiers {
+		subnets, err := l.Subnets(newBits, i*azs, azs)
+		if err != nil {
+			return nil, err
+		}
+		out[tier] = subnets
+	}
+	return out, nil
+}
+
+// Leases returns the blocks currently leased, keyed by owner, after
+// dropping expired leases.
+func (a *Allocator) Leases() (map[string]string, error) {
+	out := map[string]string{}
+	err := a.update(func(leases []leaseRecord) ([]leaseRecord, error) {
+		for _, l := range leases {
+			out[l.Owner] = l.Block
+		}
+		return leases, nil
+	})
+	return out, err
+}
+
+// update runs fn on the live leases under the file lock and persists its
+// result.
+func (a *Allocator) update(fn func([]leaseRecord) ([]leaseRecord, error)) error {
+	if err := os.MkdirAll(filepath.Dir(a.StateFile), 0o755); err != nil {
+		return err
+	}
+	// A lock file older than a minute, where flock is not available,
+	// belongs to a killed process: no update takes that long.
+	unlock, err := filelock.Lock(a.StateFile+".lock", time.Minute)
+	if err != nil {
+		return fmt.Errorf("locking %s: %w", a.StateFile, err)
+	}
+	defer unlock()
+
+	var leases []leaseRecord
+	data, err := os.ReadFile(a.StateFile)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	case len(data) > 0:
+		if err := json.Unmarshal(data, &leases); err != nil {
+			return fmt.Errorf("parsing %s: %w", a.StateFile, err)
+		}
+	}
+
+	now := a.now()
+	live := leases[:0]
+	for _, l := range leases {
+		if now.Before(l.Expires) {
+			live = append(live, l)
+		}
+	}
+
+	leases, err = fn(live)
+	if err != nil {
+		return err
+	}
+	data, err = json.MarshalIndent(leases, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := a.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, a.StateFile)
+}
+
+func sanitize(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c == '/' || c == ':' {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
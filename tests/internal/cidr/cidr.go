@@ -0,0 +1,42 @@
+// Package cidr leases non-overlapping address blocks to integration tests
+// that run in parallel, across test binaries, and derives subnet CIDRs from
+// them.
+package cidr
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// Subnet returns the index'th subnet of prefix extended by newBits, like
+// Terraform's cidrsubnet(prefix, newbits, netnum).
+func Subnet(prefix netip.Prefix, newBits, index int) (netip.Prefix, error) {
+	if !prefix.Addr().Is4() {
+		return netip.Prefix{}, fmt.Errorf("%s: only IPv4 prefixes are supported", prefix)
+	}
+	bits := prefix.Bits() + newBits
+	if newBits < 0 || bits > 32 {
+		return netip.Prefix{}, fmt.Errorf("cannot extend %s by %d bits", prefix, newBits)
+	}
+	if index < 0 || uint64(index) >= uint64(1)<<newBits {
+		return netip.Prefix{}, fmt.Errorf("%s has no subnet %d of /%d", prefix, index, bits)
+	}
+	base := prefix.Masked().Addr().As4()
+	n := uint32(base[0])<<24 | uint32(base[1])<<16 | uint32(base[2])<<8 | uint32(base[3])
+	n += uint32(index) << (32 - bits)
+	addr := netip.AddrFrom4([4]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)})
+	return netip.PrefixFrom(addr, bits), nil
+}
+
+// Overlaps reports whether any two prefixes overlap, returning the first
+// overlapping pair.
+func Overlaps(prefixes []netip.Prefix) (a, b netip.Prefix, ok bool) {
+	for i := range prefixes {
+		for j := i + 1; j < len(prefixes); j++ {
+			if prefixes[i].Overlaps(prefixes[j]) {
+				return prefixes[i], prefixes[j], true
+			}
+		}
+	}
+	return netip.Prefix{}, netip.Prefix{}, false
+}
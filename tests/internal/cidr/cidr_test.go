@@ -0,0 +1,151 @@
+package cidr_test
+
+import (
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/cidr"
+)
+
+func TestSubnet(t *testing.T) {
+	p := netip.MustParsePrefix("10.64.0.0/10")
+	cases := []struct {
+		newBits, index int
+		want           string
+	}{
+		{6, 0, "10.64.0.0/16"},
+		{6, 1, "10.65.0.0/16"},
+		{6, 63, "10.127.0.0/16"},
+		{14, 257, "10.65.1.0/24"},
+	}
+	for _, tc := range cases {
+		got, err := cidr.Subnet(p, tc.newBits, tc.index)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, got.String())
+	}
+
+	_, err := cidr.Subnet(p, 6, 64)
+	assert.Error(t, err)
+	_, err = cidr.Subnet(p, 23, 0)
+	assert.Error(t, err)
+}
+
+func TestOverlaps(t *testing.T) {
+	prefixes := []netip.Prefix{
+		netip.MustParsePrefix("10.100.0.0/16"),
+		netip.MustParsePrefix("10.200.0.0/16"),
+		netip.MustParsePrefix("10.100.10.0/24"),
+	}
+	a, b, ok := cidr.Overlaps(prefixes)
+	require.True(t, ok)
+	assert.Equal(t, "10.100.0.0/16", a.String())
+	assert.Equal(t, "10.100.10.0/24", b.String())
+
+	_, _, ok = cidr.Overlaps(prefixes[:2])
+	assert.False(t, ok)
+}
+
+func TestLeaseAndRelease(t *testing.T) {
+	a, err := cidr.NewAllocator("10.64.0.0/15", 16, t.TempDir())
+	require.NoError(t, err)
+
+	first, err := a.Lease("TestA")
+	require.NoError(t, err)
+	second, err := a.Lease("TestB")
+	require.NoError(t, err)
+	assert.Equal(t, "10.64.0.0/16", first.CIDR())
+	assert.Equal(t, "10.65.0.0/16", second.CIDR())
+
+	_, err = a.Lease("TestC")
+	assert.ErrorIs(t, err, cidr.ErrExhausted)
+
+	require.NoError(t, first.Release())
+	require.NoError(t, first.Release())
+	third, err := a.Lease("TestC")
+	require.NoError(t, err)
+	assert.Equal(t, "10.64.0.0/16", third.CIDR())
+
+	leases, err := a.Leases()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"TestB": "10.65.0.0/16", "TestC": "10.64.0.0/16"}, leases)
+}
+
+func TestExpiredLeasesAreReclaimed(t *testing.T) {
+	a, err := cidr.NewAllocator("10.64.0.0/16", 16, t.TempDir())
+	require.NoError(t, err)
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	a.SetClock(func() time.Time { return now })
+
+	_, err = a.Lease("Killed")
+	require.NoError(t, err)
+	_, err = a.Lease("Waiting")
+	require.ErrorIs(t, err, cidr.ErrExhausted)
+
+	now = now.Add(cidr.DefaultTTL + time.Second)
+	l, err := a.Lease("Waiting")
+	require.NoError(t, err)
+	assert.Equal(t, "10.64.0.0/16", l.CIDR())
+}
+
+func TestConcurrentLeasesDoNotOverlap(t *testing.T) {
+	dir := t.TempDir()
+	const n = 32
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		blocks []netip.Prefix
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// A separate allocator per goroutine opens its own lock file
+			// descriptor, as separate test binaries would.
+			a, err := cidr.NewAllocator(cidr.DefaultPool, cidr.DefaultBlockBits, dir)
+			if !assert.NoError(t, err) {
+				return
+			}
+			l, err := a.Lease(t.Name())
+			if !assert.NoError(t, err) {
+				return
+			}
+			mu.Lock()
+			blocks = append(blocks, l.Block)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, blocks, n)
+	a, b, ok := cidr.Overlaps(blocks)
+	assert.False(t, ok, "%s overlaps %s", a, b)
+}
+
+func TestTiers(t *testing.T) {
+	a, err := cidr.NewAllocator("10.64.0.0/10", 16, t.TempDir())
+	require.NoError(t, err)
+	l, err := a.Lease("TestVpc")
+	require.NoError(t, err)
+
+	tiers, err := l.Tiers(2, "public", "private")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"public":  {"10.64.0.0/24", "10.64.1.0/24"},
+		"private": {"10.64.2.0/24", "10.64.3.0/24"},
+	}, tiers)
+
+	small, err := cidr.NewAllocator("10.64.0.0/24", 26, t.TempDir())
+	require.NoError(t, err)
+	sl, err := small.Lease("TestSmall")
+	require.NoError(t, err)
+	tiers, err = sl.Tiers(3, "public", "private")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.64.0.0/29", "10.64.0.8/29", "10.64.0.16/29"}, tiers["public"])
+	assert.Equal(t, []string{"10.64.0.24/29", "10.64.0.32/29", "10.64.0.40/29"}, tiers["private"])
+}
@@ -0,0 +1,6 @@
+package cidr
+
+import "time"
+
+// SetClock overrides the allocator's clock for lease-expiry tests.
+func (a *Allocator) SetClock(now func() time.Time) { a.now = now }
@@ -0,0 +1,75 @@
+// Package compliance evaluates planned resources against the controls in
+// docs/compliance-checklist.md and reports a status for every control.
+package compliance
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Control is one checklist item.
+type Control struct {
+	// ID is the stable control ID, e.g. "AWS-EKS-01".
+	ID string
+	// Section is the heading path the item sits under, e.g. "AWS / EKS".
+	Section string
+	// Text is the item text without the ID or automation marker.
+	Text string
+}
+
+var (
+	controlRe   = regexp.MustCompile(`^- \[[ xX]\] \*\*([A-Z]+(?:-[A-Z]+)*-\d+)\*\* (.+)$`)
+	headingRe   = regexp.MustCompile(`^(#{2,3}) (.+)$`)
+	automatedRe = regexp.MustCompile(`\s*\*\(automated\)\*\s*$`)
+)
+
+// LoadChecklist parses the controls from a checklist markdown file.
+func LoadChecklist(path string) ([]Control, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseChecklist(f)
+}
+
+// ParseChecklist reads controls written as
+//
+//   - [ ] **AWS-EKS-01** Private API endpoint only
+//
+// under "## Cloud" and "### Area" headings.
+func ParseChecklist(r io.Reader) ([]Control, error) {
+	var (
+		out        []Control
+		cloud, sub string
+	)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), " ")
+		if m := headingRe.FindStringSubmatch(line); m != nil {
+			if m[1] == "##" {
+				cloud, sub = m[2], ""
+			} else {
+				sub = m[2]
+			}
+			continue
+		}
+		m := controlRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		section := cloud
+		if sub != "" {
+			section += " / " + sub
+		}
+		out = append(out, Control{
+			ID:      m[1],
+			Section: section,
+			Text:    automatedRe.ReplaceAllString(m[2], ""),
+		})
+	}
+	return out, sc.Err()
+}
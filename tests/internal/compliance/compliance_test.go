@@ -0,0 +1,102 @@
+package compliance_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/compliance"
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+	"github.com/yourorg/tf-modules/tests/internal/report"
+)
+
+func TestRepositoryChecklistCoversDefaultRules(t *testing.T) {
+	checklist, err := compliance.LoadChecklist("../../../docs/compliance-checklist.md")
+	require.NoError(t, err)
+
+	ids := map[string]bool{}
+	for _, c := range checklist {
+		assert.False(t, ids[c.ID], "duplicate control ID %s", c.ID)
+		ids[c.ID] = true
+	}
+	for _, r := range compliance.DefaultRules() {
+		assert.True(t, ids[r.Control], "rule %s maps to %s, which is not in the checklist", r.ID, r.Control)
+	}
+}
+
+func TestRun(t *testing.T) {
+	checklist, err := compliance.LoadChecklist("testdata/checklist.md")
+	require.NoError(t, err)
+	plan, err := planjson.Load("testdata/plan.json")
+	require.NoError(t, err)
+
+	report := compliance.Run(compliance.NewContext(plan, ""), checklist, compliance.DefaultRules())
+
+	status := map[string]compliance.Status{}
+	for _, c := range report.Controls {
+		status[c.ID] = c.Status
+	}
+	assert.Equal(t, map[string]compliance.Status{
+		"AWS-EKS-01":  compliance.StatusFail,   // public endpoint open to 0.0.0.0/0
+		"AWS-EKS-02":  compliance.StatusPass,   // encryption_config for secrets
+		"AWS-EKS-03":  compliance.StatusManual, // no rule
+		"AWS-EKS-04":  compliance.StatusFail,   // http_tokens = optional
+		"AWS-ENC-01":  compliance.StatusFail,   // general key without rotation; RSA key skipped
+		"AWS-ENC-02":  compliance.StatusFail,   // logs bucket allows public policies
+		"AWS-COST-03": compliance.StatusFail,   // logs bucket missing tags
+		"AZ-NET-03":   compliance.StatusPass,   // prod AKS is private
+		"AZ-ID-05":    compliance.StatusFail,   // prod Key Vault without purge protection
+		"MC-02":       compliance.StatusPass,   // state bucket versioned
+	}, status)
+	assert.True(t, report.Failed())
+
+	var enc02 []compliance.Finding
+	for _, c := range report.Controls {
+		if c.ID == "AWS-ENC-02" {
+			enc02 = c.Findings
+		}
+	}
+	require.Len(t, enc02, 2, "only state and log buckets are in scope; the assets bucket is not")
+	assert.Equal(t, compliance.StatusFail, enc02[0].Status)
+	assert.Contains(t, enc02[0].Message, "block_public_policy")
+	assert.Equal(t, compliance.StatusPass, enc02[1].Status,
+		"state bucket should match its public access block through configuration references")
+}
+
+func TestEnvironmentOverride(t *testing.T) {
+	checklist, err := compliance.LoadChecklist("testdata/checklist.md")
+	require.NoError(t, err)
+	plan, err := planjson.Load("testdata/plan.json")
+	require.NoError(t, err)
+
+	report := compliance.Run(compliance.NewContext(plan, "dev"), checklist, compliance.DefaultRules())
+	for _, c := range report.Controls {
+		if c.ID == "AZ-ID-05" || c.ID == "AZ-NET-03" {
+			assert.Equal(t, compliance.StatusNA, c.Status, "%s only applies in prod", c.ID)
+		}
+	}
+}
+
+func TestReportFindings(t *testing.T) {
+	checklist, err := compliance.LoadChecklist("testdata/checklist.md")
+	require.NoError(t, err)
+	plan, err := planjson.Load("testdata/plan.json")
+	require.NoError(t, err)
+
+	result := compliance.Run(compliance.NewContext(plan, ""), checklist, compliance.DefaultRules())
+	findings := result.ReportFindings(nil)
+	require.NotEmpty(t, findings)
+
+	levels := map[report.Level]int{}
+	for _, f := range findings {
+		levels[f.Level]++
+		assert.Contains(t, f.RuleID, "/", "rule IDs are prefixed with their control")
+		assert.Nil(t, f.Location)
+	}
+	assert.Zero(t, levels[report.LevelNote], "passing findings are omitted")
+	assert.NotZero(t, levels[report.LevelError])
+
+	rules := compliance.ReportRules(compliance.DefaultRules())
+	assert.Equal(t, "AWS-ENC-01/kms-key-rotation", rules[0].ID)
+}
@@ -0,0 +1,147 @@
+package compliance
+
+import (
+	"sort"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+)
+
+// Status is the outcome of a finding or a control.
+type Status string
+
+const (
+	StatusPass   Status = "PASS"
+	StatusWarn   Status = "WARN"
+	StatusFail   Status = "FAIL"
+	StatusNA     Status = "N/A"
+	StatusManual Status = "MANUAL"
+)
+
+// rank orders statuses so the worst finding decides a control's status.
+var rank = map[Status]int{StatusManual: 0, StatusNA: 1, StatusPass: 2, StatusWarn: 3, StatusFail: 4}
+
+// Finding is the result of one rule against one resource.
+type Finding struct {
+	RuleID  string
+	Control string
+	Address string
+	Type    string
+	// Attribute is the dotted attribute path the finding is about, used to
+	// point reports at the offending line. Empty means the whole resource.
+	Attribute string
+	Status    Status
+	Message   string
+}
+
+// Rule checks one aspect of a control across the plan.
+type Rule struct {
+	// ID identifies the rule, e.g. "kms-key-rotation".
+	ID string
+	// Control is the checklist control ID the rule evidences.
+	Control string
+	// Title is a one-line description shown in reports.
+	Title string
+	// Check returns one finding per resource it applies to. No findings
+	// means the rule did not apply to this plan.
+	Check func(c *Context) []Finding
+}
+
+// Context is the input shared by all rules.
+type Context struct {
+	Plan      *tfjson.Plan
+	Resources []planjson.Resource
+	// Environment overrides environment detection when set, e.g. "prod".
+	Environment string
+}
+
+// NewContext builds a rule context from a parsed plan.
+func NewContext(plan *tfjson.Plan, environment string) *Context {
+	return &Context{Plan: plan, Resources: planjson.Resources(plan), Environment: environment}
+}
+
+// EnvironmentOf returns the environment a resource belongs to: the -environment
+// override, its Environment tag, or the root module's environment variable.
+func (c *Context) EnvironmentOf(r planjson.Resource) string {
+	if c.Environment != "" {
+		return c.Environment
+	}
+	for _, attr := range []string{"tags_all", "tags"} {
+		if env := planjson.String(r.Values, attr+".Environment"); env != "" {
+			return env
+		}
+	}
+	env, _ := planjson.Variable(c.Plan, "environment").(string)
+	return env
+}
+
+// ControlResult is the aggregated status of one checklist control.
+type ControlResult struct {
+	Control
+	Status   Status
+	Findings []Finding
+}
+
+// Report is a compliance report for one plan.
+type Report struct {
+	Controls []ControlResult
+	// Unmapped holds findings whose control is not in the checklist.
+	Unmapped []Finding
+}
+
+// Failed reports whether any control failed.
+func (r *Report) Failed() bool {
+	for _, c := range r.Controls {
+		if c.Status == StatusFail {
+			return true
+		}
+	}
+	for _, f := range r.Unmapped {
+		if f.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+// Run evaluates rules and maps their findings onto the checklist. Controls
+// with rules but no findings are N/A; controls without rules are MANUAL.
+func Run(c *Context, checklist []Control, rules []Rule) *Report {
+	automated := map[string]bool{}
+	byControl := map[string][]Finding{}
+	for _, rule := range rules {
+		automated[rule.Control] = true
+		for _, f := range rule.Check(c) {
+			f.RuleID = rule.ID
+			f.Control = rule.Control
+			byControl[rule.Control] = append(byControl[rule.Control], f)
+		}
+	}
+
+	report := &Report{}
+	known := map[string]bool{}
+	for _, ctl := range checklist {
+		known[ctl.ID] = true
+		res := ControlResult{Control: ctl, Status: StatusManual, Findings: byControl[ctl.ID]}
+		if automated[ctl.ID] {
+			res.Status = StatusNA
+		}
+		for _, f := range res.Findings {
+			if rank[f.Status] > rank[res.Status] {
+				res.Status = f.Status
+			}
+		}
+		report.Controls = append(report.Controls, res)
+	}
+
+	for id, findings := range byControl {
+		if !known[id] {
+			report.Unmapped = append(report.Unmapped, findings...)
+		}
+	}
+	sort.Slice(report.Unmapped, func(i, j int) bool {
+		return report.Unmapped[i].Address < report.Unmapped[j].Address
+	})
+	return report
+}
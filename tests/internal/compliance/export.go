@@ -0,0 +1,54 @@
+package compliance
+
+import (
+	"github.com/yourorg/tf-modules/tests/internal/report"
+)
+
+// ReportRules describes rules for SARIF and JUnit output. Rule IDs are
+// prefixed with their control so code-scanning alerts group by control.
+func ReportRules(rules []Rule) []report.Rule {
+	out := make([]report.Rule, 0, len(rules))
+	for _, r := range rules {
+		out = append(out, report.Rule{
+			ID:               r.Control + "/" + r.ID,
+			Name:             r.ID,
+			ShortDescription: r.Title,
+			HelpURI:          "docs/compliance-checklist.md",
+		})
+	}
+	return out
+}
+
+// ReportFindings converts failing and warning findings for SARIF and JUnit
+// output, resolving source locations through idx when it is non-nil.
+func (r *Report) ReportFindings(idx *report.SourceIndex) []report.Finding {
+	var all []Finding
+	for _, c := range r.Controls {
+		all = append(all, c.Findings...)
+	}
+	all = append(all, r.Unmapped...)
+
+	var out []report.Finding
+	for _, f := range all {
+		var level report.Level
+		switch f.Status {
+		case StatusFail:
+			level = report.LevelError
+		case StatusWarn:
+			level = report.LevelWarning
+		default:
+			continue
+		}
+		rf := report.Finding{
+			RuleID:  f.Control + "/" + f.RuleID,
+			Level:   level,
+			Message: f.Message,
+			Address: f.Address,
+		}
+		if idx != nil {
+			rf.Location = idx.Locate(f.Address, f.Attribute)
+		}
+		out = append(out, rf)
+	}
+	return out
+}
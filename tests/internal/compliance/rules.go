@@ -0,0 +1,293 @@
+package compliance
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+)
+
+// requiredTags mirrors policy/required_tags.rego.
+var requiredTags = []string{"Project", "Environment", "ManagedBy"}
+
+// taggableTypes mirrors taggable_resource_types in policy/required_tags.rego.
+var taggableTypes = []string{
+	"aws_vpc", "aws_subnet", "aws_internet_gateway", "aws_nat_gateway",
+	"aws_eks_cluster", "aws_eks_node_group", "aws_iam_role", "aws_s3_bucket",
+	"aws_kms_key", "aws_cloudwatch_log_group", "aws_cloudtrail", "aws_sns_topic",
+	"aws_budgets_budget",
+}
+
+// DefaultRules returns the built-in rule set.
+func DefaultRules() []Rule {
+	return []Rule{
+		{
+			ID:      "kms-key-rotation",
+			Control: "AWS-ENC-01",
+			Title:   "Symmetric KMS keys have enable_key_rotation = true",
+			Check:   checkKMSRotation,
+		},
+		{
+			ID:      "s3-public-access-block",
+			Control: "AWS-ENC-02",
+			Title:   "State and log buckets have a public access block with all four settings enabled",
+			Check:   checkS3PublicAccessBlock,
+		},
+		{
+			ID:      "eks-public-endpoint",
+			Control: "AWS-EKS-01",
+			Title:   "EKS public endpoint is disabled or restricted to a CIDR allowlist",
+			Check:   checkEKSPublicEndpoint,
+		},
+		{
+			ID:      "eks-secrets-encryption",
+			Control: "AWS-EKS-02",
+			Title:   "EKS clusters encrypt secrets with KMS",
+			Check:   checkEKSSecretsEncryption,
+		},
+		{
+			ID:      "eks-imdsv2",
+			Control: "AWS-EKS-04",
+			Title:   "Launch templates require IMDSv2 (http_tokens = required)",
+			Check:   checkIMDSv2,
+		},
+		{
+			ID:      "required-tags",
+			Control: "AWS-COST-03",
+			Title:   "Taggable resources carry Project, Environment and ManagedBy tags",
+			Check:   checkRequiredTags,
+		},
+		{
+			ID:      "state-bucket-versioning",
+			Control: "MC-02",
+			Title:   "State buckets have versioning enabled",
+			Check:   checkStateBucketVersioning,
+		},
+		{
+			ID:      "keyvault-purge-protection",
+			Control: "AZ-ID-05",
+			Title:   "Key Vaults in prod have purge protection enabled",
+			Check:   checkKeyVaultPurgeProtection,
+		},
+		{
+			ID:      "aks-private-cluster",
+			Control: "AZ-NET-03",
+			Title:   "AKS clusters in prod are private",
+			Check:   checkAKSPrivateCluster,
+		},
+	}
+}
+
+func finding(r planjson.Resource, attr string, status Status, format string, args ...interface{}) Finding {
+	return Finding{Address: r.Address, Type: r.Type, Attribute: attr, Status: status, Message: fmt.Sprintf(format, args...)}
+}
+
+func checkKMSRotation(c *Context) []Finding {
+	var out []Finding
+	for _, r := range planjson.OfType(c.Resources, "aws_kms_key") {
+		if spec := planjson.String(r.Values, "customer_master_key_spec"); spec != "" && spec != "SYMMETRIC_DEFAULT" {
+			continue // rotation is only supported for symmetric keys
+		}
+		if on, _ := planjson.Bool(r.Values, "enable_key_rotation"); on {
+			out = append(out, finding(r, "enable_key_rotation", StatusPass, "key rotation enabled"))
+		} else {
+			out = append(out, finding(r, "enable_key_rotation", StatusFail, "enable_key_rotation is not true"))
+		}
+	}
+	return out
+}
+
+func checkS3PublicAccessBlock(c *Context) []Finding {
+	blocks := planjson.OfType(c.Resources, "aws_s3_bucket_public_access_block")
+	var out []Finding
+	for _, bucket := range planjson.OfType(c.Resources, "aws_s3_bucket") {
+		if !isStateBucket(bucket) && !isLogBucket(bucket) {
+			continue
+		}
+		pab, ok := findBucketChild(c, bucket, blocks)
+		if !ok {
+			out = append(out, finding(bucket, "", StatusFail, "no aws_s3_bucket_public_access_block for this bucket"))
+			continue
+		}
+		var off []string
+		for _, attr := range []string{"block_public_acls", "block_public_policy", "ignore_public_acls", "restrict_public_buckets"} {
+			if on, _ := planjson.Bool(pab.Values, attr); !on {
+				off = append(off, attr)
+			}
+		}
+		if len(off) > 0 {
+			out = append(out, finding(bucket, "", StatusFail, "%s does not set %s", pab.Address, strings.Join(off, ", ")))
+			continue
+		}
+		out = append(out, finding(bucket, "", StatusPass, "public access fully blocked by %s", pab.Address))
+	}
+	return out
+}
+
+// findBucketChild finds the bucket-scoped resource (public access block,
+// versioning, ...) that targets bucket. The bucket name is compared when it
+// is known at plan time; otherwise the child's configuration must reference
+// the bucket resource in the same module.
+func findBucketChild(c *Context, bucket planjson.Resource, children []planjson.Resource) (planjson.Resource, bool) {
+	name := planjson.String(bucket.Values, "bucket")
+	ref := "aws_s3_bucket." + bucket.Name
+	for _, child := range children {
+		if child.ModuleAddress != bucket.ModuleAddress {
+			continue
+		}
+		if name != "" && planjson.String(child.Values, "bucket") == name {
+			return child, true
+		}
+		for _, r := range planjson.References(c.Plan, child, "bucket") {
+			if r == ref || strings.HasPrefix(r, ref+".") || strings.HasPrefix(r, ref+"[") {
+				return child, true
+			}
+		}
+	}
+	return planjson.Resource{}, false
+}
+
+func checkEKSPublicEndpoint(c *Context) []Finding {
+	var out []Finding
+	for _, r := range planjson.OfType(c.Resources, "aws_eks_cluster") {
+		public, _ := planjson.Bool(r.Values, "vpc_config.0.endpoint_public_access")
+		if !public {
+			out = append(out, finding(r, "vpc_config.0.endpoint_public_access", StatusPass, "public endpoint disabled"))
+			continue
+		}
+		cidrs := planjson.Strings(r.Values, "vpc_config.0.public_access_cidrs")
+		if len(cidrs) == 0 {
+			// EKS defaults an unset allowlist to 0.0.0.0/0.
+			cidrs = []string{"0.0.0.0/0"}
+		}
+		open := false
+		for _, cidr := range cidrs {
+			if cidr == "0.0.0.0/0" {
+				open = true
+			}
+		}
+		if open {
+			out = append(out, finding(r, "vpc_config.0.public_access_cidrs", StatusFail, "public endpoint is reachable from 0.0.0.0/0"))
+		} else {
+			out = append(out, finding(r, "vpc_config.0.public_access_cidrs", StatusWarn, "public endpoint restricted to %s", strings.Join(cidrs, ", ")))
+		}
+	}
+	return out
+}
+
+func checkEKSSecretsEncryption(c *Context) []Finding {
+	var out []Finding
+	for _, r := range planjson.OfType(c.Resources, "aws_eks_cluster") {
+		encrypted := false
+		for _, ec := range planjson.Blocks(r.Values, "encryption_config") {
+			for _, res := range planjson.Strings(ec, "resources") {
+				if res == "secrets" {
+					encrypted = true
+				}
+			}
+		}
+		if encrypted {
+			out = append(out, finding(r, "encryption_config", StatusPass, "secrets encrypted with KMS"))
+		} else {
+			out = append(out, finding(r, "encryption_config", StatusFail, "no encryption_config for secrets"))
+		}
+	}
+	return out
+}
+
+func checkIMDSv2(c *Context) []Finding {
+	var out []Finding
+	for _, r := range planjson.OfType(c.Resources, "aws_launch_template") {
+		if tokens := planjson.String(r.Values, "metadata_options.0.http_tokens"); tokens == "required" {
+			out = append(out, finding(r, "metadata_options.0.http_tokens", StatusPass, "IMDSv2 required"))
+		} else {
+			out = append(out, finding(r, "metadata_options.0.http_tokens", StatusFail, "metadata_options.http_tokens is %q, want \"required\"", tokens))
+		}
+	}
+	return out
+}
+
+func checkRequiredTags(c *Context) []Finding {
+	var out []Finding
+	for _, r := range planjson.OfType(c.Resources, taggableTypes...) {
+		tags, _ := r.Values["tags_all"].(map[string]interface{})
+		if tags == nil {
+			tags, _ = r.Values["tags"].(map[string]interface{})
+		}
+		var missing []string
+		for _, key := range requiredTags {
+			if v, _ := tags[key].(string); v == "" {
+				missing = append(missing, key)
+			}
+		}
+		if len(missing) > 0 {
+			out = append(out, finding(r, "tags", StatusFail, "missing or empty tags: %s", strings.Join(missing, ", ")))
+		} else {
+			out = append(out, finding(r, "tags", StatusPass, "required tags present"))
+		}
+	}
+	return out
+}
+
+func checkStateBucketVersioning(c *Context) []Finding {
+	versioning := planjson.OfType(c.Resources, "aws_s3_bucket_versioning")
+	var out []Finding
+	for _, bucket := range planjson.OfType(c.Resources, "aws_s3_bucket") {
+		if !isStateBucket(bucket) {
+			continue
+		}
+		v, ok := findBucketChild(c, bucket, versioning)
+		if !ok {
+			out = append(out, finding(bucket, "", StatusFail, "state bucket has no aws_s3_bucket_versioning"))
+			continue
+		}
+		if status := planjson.String(v.Values, "versioning_configuration.0.status"); status != "Enabled" {
+			out = append(out, finding(bucket, "", StatusFail, "versioning status is %q", status))
+			continue
+		}
+		out = append(out, finding(bucket, "", StatusPass, "versioning enabled"))
+	}
+	return out
+}
+
+// isStateBucket identifies Terraform state buckets by resource or bucket
+// name, which covers modules/aws/s3-state and bootstrap/.
+func isStateBucket(r planjson.Resource) bool {
+	return strings.Contains(r.Name, "state") || strings.Contains(planjson.String(r.Values, "bucket"), "state")
+}
+
+// isLogBucket identifies log archive buckets the same way, which covers
+// modules/aws/logging.
+func isLogBucket(r planjson.Resource) bool {
+	return strings.Contains(r.Name, "log") || strings.Contains(planjson.String(r.Values, "bucket"), "log")
+}
+
+func checkKeyVaultPurgeProtection(c *Context) []Finding {
+	var out []Finding
+	for _, r := range planjson.OfType(c.Resources, "azurerm_key_vault") {
+		if c.EnvironmentOf(r) != "prod" {
+			continue
+		}
+		if on, _ := planjson.Bool(r.Values, "purge_protection_enabled"); on {
+			out = append(out, finding(r, "purge_protection_enabled", StatusPass, "purge protection enabled"))
+		} else {
+			out = append(out, finding(r, "purge_protection_enabled", StatusFail, "purge_protection_enabled is not true in prod"))
+		}
+	}
+	return out
+}
+
+func checkAKSPrivateCluster(c *Context) []Finding {
+	var out []Finding
+	for _, r := range planjson.OfType(c.Resources, "azurerm_kubernetes_cluster") {
+		if c.EnvironmentOf(r) != "prod" {
+			continue
+		}
+		if on, _ := planjson.Bool(r.Values, "private_cluster_enabled"); on {
+			out = append(out, finding(r, "private_cluster_enabled", StatusPass, "private cluster"))
+		} else {
+			out = append(out, finding(r, "private_cluster_enabled", StatusFail, "private_cluster_enabled is not true in prod"))
+		}
+	}
+	return out
+}
@@ -0,0 +1,153 @@
+package cost_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/cost"
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+	"github.com/yourorg/tf-modules/tests/internal/report"
+)
+
+func estimate(t *testing.T, file string, usage cost.Usage) *cost.Estimate {
+	t.Helper()
+	table, err := cost.VendoredTable("2026-10")
+	require.NoError(t, err)
+	plan, err := planjson.Load(file)
+	require.NoError(t, err)
+	return cost.EstimatePlan(planjson.Resources(plan), table, usage)
+}
+
+func moduleTotals(est *cost.Estimate) map[string]float64 {
+	out := map[string]float64{}
+	for _, m := range est.ByModule() {
+		out[m.Module] = m.Monthly
+	}
+	return out
+}
+
+func TestEstimatePlanPerModule(t *testing.T) {
+	est := estimate(t, "testdata/per-az-nat.json", nil)
+	totals := moduleTotals(est)
+
+	// 730 h/month: 3 x (NAT hour + 100 GB processed)
+	assert.InDelta(t, 112.05, totals["module.vpc"], 0.01, "per-AZ NAT gateways")
+	// control plane + 3 x m5.large on-demand + 2 x m5a.xlarge at the spot factor
+	assert.InDelta(t, 73.00+210.24+87.89, totals["module.eks"], 0.01)
+	assert.InDelta(t, 1.00, totals["module.kms"], 0.001)
+	// ACL + 2 rules + 10M requests
+	assert.InDelta(t, 13.00, totals["module.waf"], 0.001)
+	// CloudTrail events + flow/DNS logs + EKS audit logs
+	assert.InDelta(t, 59.60, totals["module.guardduty"], 0.001)
+	assert.NotContains(t, totals, "module.iam", "IAM roles are free and should not be listed")
+
+	require.Len(t, est.Unpriced, 1)
+	assert.Contains(t, est.Unpriced[0].Reason, "aws.ec2.p4d.24xlarge.hour")
+
+	require.Len(t, est.Budgets, 2)
+	assert.Equal(t, 1500.0, est.Budgets[0].Amount)
+	assert.Equal(t, 1500.0, est.Budget(), "actual and forecast budgets of one module count once")
+}
+
+func TestEstimatePlanUsageOverride(t *testing.T) {
+	est := estimate(t, "testdata/single-nat.json", cost.Usage{
+		"module.vpc:aws.nat_gateway.gb_processed": 0,
+		"aws.wafv2.requests.million":              0,
+	})
+	totals := moduleTotals(est)
+	assert.InDelta(t, 32.85, totals["module.vpc"], 0.01, "module-scoped override should zero NAT data processing")
+	assert.InDelta(t, 7.00, totals["module.waf"], 0.001, "global override should zero WAF requests")
+}
+
+func TestEstimatePlanUnknownNodeCount(t *testing.T) {
+	table, err := cost.VendoredTable("2026-10")
+	require.NoError(t, err)
+	est := cost.EstimatePlan([]planjson.Resource{
+		{Address: "module.eks.aws_eks_node_group.this[\"general\"]", Type: "aws_eks_node_group", Values: map[string]interface{}{
+			"capacity_type":  "ON_DEMAND",
+			"instance_types": []interface{}{"m5.large"},
+			"scaling_config": []interface{}{map[string]interface{}{"desired_size": nil}},
+		}},
+		{Address: "module.aks.azurerm_kubernetes_cluster_node_pool.user[\"apps\"]", Type: "azurerm_kubernetes_cluster_node_pool", Values: map[string]interface{}{
+			"vm_size":    "Standard_D4s_v5",
+			"node_count": nil,
+		}},
+	}, table, nil)
+
+	assert.Zero(t, est.Total())
+	require.Len(t, est.Unpriced, 2, "an unknown node count must be reported, not priced at zero")
+	assert.Contains(t, est.Unpriced[0].Reason, "desired_size")
+	assert.Contains(t, est.Unpriced[1].Reason, "node_count")
+}
+
+func TestDiff(t *testing.T) {
+	perAZ := estimate(t, "testdata/per-az-nat.json", nil)
+	single := estimate(t, "testdata/single-nat.json", nil)
+
+	diff := cost.Diff(perAZ, single)
+	require.Len(t, diff, 1, "only the VPC module cost should change")
+	assert.Equal(t, "module.vpc", diff[0].Module)
+	assert.InDelta(t, -74.70, diff[0].Delta(), 0.01)
+}
+
+func TestVendoredVersions(t *testing.T) {
+	versions := cost.VendoredVersions()
+	require.NotEmpty(t, versions)
+
+	_, err := cost.VendoredTable("1999-01")
+	assert.Error(t, err)
+}
+
+func TestRegionWarnings(t *testing.T) {
+	plan, err := planjson.Parse([]byte(`{
+		"format_version": "1.2",
+		"variables": {"region": {"value": "eu-west-1"}},
+		"resource_changes": [
+			{"address": "azurerm_resource_group.this", "mode": "managed", "type": "azurerm_resource_group", "name": "this",
+			 "change": {"actions": ["create"], "after": {"location": "East US"}}},
+			{"address": "google_container_node_pool.this", "mode": "managed", "type": "google_container_node_pool", "name": "this",
+			 "change": {"actions": ["create"], "after": {"location": "europe-west1-b"}}}
+		],
+		"configuration": {"provider_config": {
+			"aws": {"name": "aws", "expressions": {"region": {"references": ["var.region"]}}},
+			"aws.us_east_1": {"name": "aws", "alias": "us_east_1", "expressions": {"region": {"constant_value": "us-east-1"}}}
+		}}
+	}`))
+	require.NoError(t, err)
+
+	regions := cost.PlanRegions(plan)
+	assert.Equal(t, map[string][]string{
+		"aws":   {"eu-west-1", "us-east-1"},
+		"azure": {"eastus"},
+		"gcp":   {"europe-west1"},
+	}, regions)
+
+	table, err := cost.VendoredTable("2026-10")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"aws region eu-west-1 is not priced; the estimate uses us-east-1 list prices",
+		"gcp region europe-west1 is not priced; the estimate uses us-central1 list prices",
+	}, table.RegionWarnings(regions))
+}
+
+func TestReportFindings(t *testing.T) {
+	est := estimate(t, "testdata/per-az-nat.json", nil)
+	require.Len(t, est.Unpriced, 1)
+
+	findings := est.ReportFindings(est.Total()-1, []string{"aws region eu-west-1 is not priced"}, nil)
+	var rules []string
+	for _, f := range findings {
+		rules = append(rules, f.RuleID)
+	}
+	assert.Equal(t, []string{"over-budget", "unpriced", "region-not-priced"}, rules)
+	assert.Equal(t, report.LevelError, findings[0].Level)
+	assert.Equal(t, est.Budgets[0].Address, findings[0].Address)
+	assert.Equal(t, est.Unpriced[0].Address, findings[1].Address)
+
+	findings = est.ReportFindings(est.Total()+1, nil, nil)
+	require.Len(t, findings, 1, "within budget, only the unpriced resource is reported")
+	assert.Equal(t, report.LevelWarning, findings[0].Level)
+	assert.Len(t, cost.ReportRules(), 3)
+}
@@ -0,0 +1,414 @@
+package cost
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+)
+
+// LineItem is one priced component of a planned resource.
+type LineItem struct {
+	Address     string
+	Module      string
+	Type        string
+	Description string
+	Monthly     float64
+}
+
+// Unpriced records a resource the estimator recognises but could not price,
+// usually because an instance size is missing from the table.
+type Unpriced struct {
+	Address string
+	Reason  string
+}
+
+// Estimate is the monthly cost of one plan.
+type Estimate struct {
+	Currency     string
+	PriceVersion string
+	Items        []LineItem
+	Unpriced     []Unpriced
+	// Budgets are the monthly aws_budgets_budget limits found in the plan.
+	Budgets []Budget
+}
+
+// Budget is a monthly cost budget declared in the plan.
+type Budget struct {
+	Address string
+	Module  string
+	Amount  float64
+	Unit    string
+}
+
+// estimator prices one resource type.
+type estimator func(r planjson.Resource, c *calc)
+
+// estimators covers the cost-bearing resource types our modules create.
+// Everything else (IAM, routes, alarms' SNS topics, ...) is free or
+// negligible and is skipped.
+var estimators = map[string]estimator{
+	"aws_nat_gateway": func(r planjson.Resource, c *calc) {
+		c.hourly("aws.nat_gateway.hour", 1, "NAT gateway hours")
+		c.usage("aws.nat_gateway.gb_processed", "NAT data processed (GB)")
+	},
+	"aws_eip": func(r planjson.Resource, c *calc) {
+		c.hourly("aws.public_ipv4.hour", 1, "public IPv4 address")
+	},
+	"aws_vpc_endpoint": func(r planjson.Resource, c *calc) {
+		if planjson.String(r.Values, "vpc_endpoint_type") != "Interface" {
+			return
+		}
+		azs := float64(len(planjson.Strings(r.Values, "subnet_ids")))
+		if azs == 0 {
+			azs = 1
+		}
+		c.hourly("aws.vpc_endpoint.interface.hour", azs, fmt.Sprintf("interface endpoint x %.0f AZ", azs))
+		c.usage("aws.vpc_endpoint.interface.gb_processed", "endpoint data processed (GB)")
+	},
+	"aws_eks_cluster": func(r planjson.Resource, c *calc) {
+		c.hourly("aws.eks.cluster.hour", 1, "EKS control plane")
+	},
+	"aws_eks_node_group": func(r planjson.Resource, c *calc) {
+		types := planjson.Strings(r.Values, "instance_types")
+		if len(types) == 0 {
+			c.missing("instance_types unknown at plan time")
+			return
+		}
+		count, ok := planjson.Number(r.Values, "scaling_config.0.desired_size")
+		if !ok {
+			c.missing("scaling_config desired_size unknown at plan time")
+			return
+		}
+		sku := "aws.ec2." + types[0] + ".hour"
+		desc := fmt.Sprintf("%.0f x %s", count, types[0])
+		if planjson.String(r.Values, "capacity_type") == "SPOT" {
+			factor, ok := c.table.Prices["aws.ec2.spot_factor"]
+			if !ok {
+				factor = 1
+			}
+			c.hourlyScaled(sku, count, factor, desc+" (spot)")
+			return
+		}
+		c.hourly(sku, count, desc)
+	},
+	"aws_kms_key": func(r planjson.Resource, c *calc) {
+		c.monthly("aws.kms.key.month", 1, "KMS key")
+	},
+	"aws_kms_replica_key": func(r planjson.Resource, c *calc) {
+		c.monthly("aws.kms.key.month", 1, "KMS replica key")
+	},
+	"aws_wafv2_web_acl": func(r planjson.Resource, c *calc) {
+		c.monthly("aws.wafv2.web_acl.month", 1, "WAF web ACL")
+		if rules := len(planjson.Blocks(r.Values, "rule")); rules > 0 {
+			c.monthly("aws.wafv2.rule.month", float64(rules), fmt.Sprintf("%d WAF rules", rules))
+		}
+		c.usage("aws.wafv2.requests.million", "WAF requests (millions)")
+	},
+	"aws_guardduty_detector": func(r planjson.Resource, c *calc) {
+		if enabled, ok := planjson.Bool(r.Values, "enable"); ok && !enabled {
+			return
+		}
+		c.usage("aws.guardduty.cloudtrail_events.million", "GuardDuty CloudTrail events (millions)")
+		c.usage("aws.guardduty.flow_dns_logs.gb", "GuardDuty flow/DNS log analysis (GB)")
+		if guarddutyKubernetesEnabled(r.Values) {
+			c.usage("aws.guardduty.eks_audit_events.million", "GuardDuty EKS audit events (millions)")
+		}
+	},
+	"aws_cloudwatch_log_group": func(r planjson.Resource, c *calc) {
+		c.usage("aws.cloudwatch.logs.ingest_gb", "log ingestion (GB)")
+		c.usage("aws.cloudwatch.logs.storage_gb", "log storage (GB)")
+	},
+	"aws_cloudwatch_metric_alarm": func(r planjson.Resource, c *calc) {
+		c.monthly("aws.cloudwatch.alarm.month", 1, "metric alarm")
+	},
+	"aws_cloudwatch_composite_alarm": func(r planjson.Resource, c *calc) {
+		c.monthly("aws.cloudwatch.composite_alarm.month", 1, "composite alarm")
+	},
+	"aws_config_configuration_recorder": func(r planjson.Resource, c *calc) {
+		c.usage("aws.config.configuration_item", "Config configuration items")
+	},
+	"aws_securityhub_account": func(r planjson.Resource, c *calc) {
+		c.usage("aws.securityhub.check", "Security Hub checks")
+	},
+	"aws_route53_health_check": func(r planjson.Resource, c *calc) {
+		c.monthly("aws.route53.health_check.month", 1, "Route 53 health check")
+	},
+	"aws_s3_bucket": func(r planjson.Resource, c *calc) {
+		c.usage("aws.s3.standard.storage_gb", "S3 standard storage (GB)")
+	},
+	"aws_ecr_repository": func(r planjson.Resource, c *calc) {
+		c.usage("aws.ecr.storage_gb", "ECR image storage (GB)")
+	},
+	"aws_dynamodb_table": func(r planjson.Resource, c *calc) {
+		if planjson.String(r.Values, "billing_mode") != "PAY_PER_REQUEST" {
+			c.missing("provisioned capacity is not priced")
+			return
+		}
+		c.usage("aws.dynamodb.on_demand.write_million", "DynamoDB writes (millions)")
+		c.usage("aws.dynamodb.on_demand.read_million", "DynamoDB reads (millions)")
+	},
+	"azurerm_kubernetes_cluster": func(r planjson.Resource, c *calc) {
+		switch planjson.String(r.Values, "sku_tier") {
+		case "Standard":
+			c.hourly("azure.aks.standard_tier.hour", 1, "AKS Standard tier control plane")
+		case "Premium":
+			c.hourly("azure.aks.premium_tier.hour", 1, "AKS Premium tier control plane")
+		}
+		pool := "default_node_pool.0."
+		vmSize := planjson.String(r.Values, pool+"vm_size")
+		count, ok := planjson.Number(r.Values, pool+"node_count")
+		if !ok {
+			c.missing("default_node_pool node_count is null (auto-scaling) or unknown")
+			return
+		}
+		c.hourly("azure.vm."+vmSize+".hour", count, fmt.Sprintf("%.0f x %s (system pool)", count, vmSize))
+	},
+	"azurerm_kubernetes_cluster_node_pool": func(r planjson.Resource, c *calc) {
+		vmSize := planjson.String(r.Values, "vm_size")
+		count, ok := planjson.Number(r.Values, "node_count")
+		if !ok {
+			c.missing("node_count is null (auto-scaling) or unknown")
+			return
+		}
+		c.hourly("azure.vm."+vmSize+".hour", count, fmt.Sprintf("%.0f x %s", count, vmSize))
+	},
+	"azurerm_container_registry": func(r planjson.Resource, c *calc) {
+		sku := planjson.String(r.Values, "sku")
+		c.monthly("azure.acr."+sku+".day", c.table.HoursPerMonth/24, "ACR "+sku)
+	},
+	"azurerm_cdn_frontdoor_profile": func(r planjson.Resource, c *calc) {
+		sku := planjson.String(r.Values, "sku_name")
+		c.monthly("azure.front_door."+sku+".month", 1, "Front Door "+sku)
+	},
+	"azurerm_private_endpoint": func(r planjson.Resource, c *calc) {
+		c.hourly("azure.private_endpoint.hour", 1, "private endpoint")
+	},
+	"azurerm_security_center_subscription_pricing": func(r planjson.Resource, c *calc) {
+		if planjson.String(r.Values, "tier") != "Standard" || planjson.String(r.Values, "resource_type") != "Containers" {
+			return
+		}
+		c.usage("azure.defender.containers.vcore_month", "Defender for Containers (vCores)")
+	},
+	"google_container_cluster": func(r planjson.Resource, c *calc) {
+		c.hourly("gcp.gke.cluster.hour", 1, "GKE cluster management fee")
+	},
+	"google_container_node_pool": func(r planjson.Resource, c *calc) {
+		machine := planjson.String(r.Values, "node_config.0.machine_type")
+		perZone, ok := planjson.Number(r.Values, "node_count")
+		if !ok {
+			c.missing("node_count is null (auto-scaling) or unknown")
+			return
+		}
+		zones := float64(len(planjson.Strings(r.Values, "node_locations")))
+		if zones == 0 {
+			zones = 1
+			if regionalLocation.MatchString(planjson.String(r.Values, "location")) {
+				zones = 3
+			}
+		}
+		count := perZone * zones
+		c.hourly("gcp.compute."+machine+".hour", count, fmt.Sprintf("%.0f x %s", count, machine))
+	},
+	"google_compute_router_nat": func(r planjson.Resource, c *calc) {
+		c.hourly("gcp.cloud_nat.hour", 1, "Cloud NAT gateway")
+	},
+	"google_kms_crypto_key": func(r planjson.Resource, c *calc) {
+		c.monthly("gcp.kms.key_version.month", 1, "Cloud KMS key version")
+	},
+	"google_storage_bucket": func(r planjson.Resource, c *calc) {
+		c.usage("gcp.gcs.standard.storage_gb", "GCS storage (GB)")
+	},
+}
+
+// regionalLocation matches GCP regions (us-central1) but not zones
+// (us-central1-a). Regional node pools run node_count nodes per zone.
+var regionalLocation = regexp.MustCompile(`^[a-z]+-[a-z]+[0-9]+$`)
+
+func guarddutyKubernetesEnabled(values map[string]interface{}) bool {
+	for _, ds := range planjson.Blocks(values, "datasources") {
+		if on, _ := planjson.Bool(ds, "kubernetes.0.audit_logs.0.enable"); on {
+			return true
+		}
+	}
+	return false
+}
+
+// calc accumulates line items for a single resource.
+type calc struct {
+	table     *Table
+	overrides Usage
+	resource  planjson.Resource
+	est       *Estimate
+}
+
+func (c *calc) add(sku string, qty, factor, unitMultiplier float64, desc string) {
+	price, ok := c.table.Prices[sku]
+	if !ok {
+		c.missing(fmt.Sprintf("no price for %s in table %s", sku, c.table.Version))
+		return
+	}
+	c.est.Items = append(c.est.Items, LineItem{
+		Address:     c.resource.Address,
+		Module:      c.resource.Module(),
+		Type:        c.resource.Type,
+		Description: desc,
+		Monthly:     price * qty * factor * unitMultiplier,
+	})
+}
+
+// hourly adds qty units billed per hour for a full month.
+func (c *calc) hourly(sku string, qty float64, desc string) {
+	c.add(sku, qty, 1, c.table.HoursPerMonth, desc)
+}
+
+// hourlyScaled is hourly with a discount factor, e.g. spot pricing.
+func (c *calc) hourlyScaled(sku string, qty, factor float64, desc string) {
+	c.add(sku, qty, factor, c.table.HoursPerMonth, desc)
+}
+
+// monthly adds qty units billed per month (or per unit already scaled to a
+// month by the caller).
+func (c *calc) monthly(sku string, qty float64, desc string) {
+	c.add(sku, qty, 1, 1, desc)
+}
+
+// usage adds a usage-priced SKU at its assumed monthly quantity.
+func (c *calc) usage(sku, desc string) {
+	qty := c.table.quantity(c.overrides, c.resource.Module(), sku)
+	if qty == 0 {
+		return
+	}
+	c.add(sku, qty, 1, 1, fmt.Sprintf("%s: %g", desc, qty))
+}
+
+func (c *calc) missing(reason string) {
+	c.est.Unpriced = append(c.est.Unpriced, Unpriced{Address: c.resource.Address, Reason: reason})
+}
+
+// EstimatePlan prices every planned resource with a known estimator.
+func EstimatePlan(resources []planjson.Resource, table *Table, usage Usage) *Estimate {
+	est := &Estimate{Currency: table.Currency, PriceVersion: table.Version}
+	for _, r := range resources {
+		if r.Type == "aws_budgets_budget" {
+			if b, ok := monthlyBudget(r); ok {
+				est.Budgets = append(est.Budgets, b)
+			}
+			continue
+		}
+		fn, ok := estimators[r.Type]
+		if !ok {
+			continue
+		}
+		fn(r, &calc{table: table, overrides: usage, resource: r, est: est})
+	}
+	return est
+}
+
+func monthlyBudget(r planjson.Resource) (Budget, bool) {
+	if planjson.String(r.Values, "time_unit") != "MONTHLY" || planjson.String(r.Values, "budget_type") != "COST" {
+		return Budget{}, false
+	}
+	amount, ok := planjson.Number(r.Values, "limit_amount")
+	if !ok {
+		return Budget{}, false
+	}
+	return Budget{Address: r.Address, Module: r.Module(), Amount: amount, Unit: planjson.String(r.Values, "limit_unit")}, true
+}
+
+// Budget returns the plan's monthly budget: the largest limit in each
+// module, summed over modules. Budget counts each module once, since
+// modules/aws/budgets declares an actual and a forecast budget with the
+// same limit.
+func (e *Estimate) Budget() float64 {
+	largest := map[string]float64{}
+	for _, b := range e.Budgets {
+		if b.Amount > largest[b.Module] {
+			largest[b.Module] = b.Amount
+		}
+	}
+	var sum float64
+	for _, amount := range largest {
+		sum += amount
+	}
+	return sum
+}
+
+// Total is the estimated monthly cost of the whole plan.
+func (e *Estimate) Total() float64 {
+	var sum float64
+	for _, it := range e.Items {
+		sum += it.Monthly
+	}
+	return sum
+}
+
+// ModuleTotal is the estimated monthly cost of one module.
+type ModuleTotal struct {
+	Module  string
+	Monthly float64
+	Items   []LineItem
+}
+
+// ByModule groups line items by containing module, most expensive first.
+func (e *Estimate) ByModule() []ModuleTotal {
+	idx := map[string]int{}
+	var out []ModuleTotal
+	for _, it := range e.Items {
+		i, ok := idx[it.Module]
+		if !ok {
+			i = len(out)
+			idx[it.Module] = i
+			out = append(out, ModuleTotal{Module: it.Module})
+		}
+		out[i].Monthly += it.Monthly
+		out[i].Items = append(out[i].Items, it)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Monthly != out[j].Monthly {
+			return out[i].Monthly > out[j].Monthly
+		}
+		return out[i].Module < out[j].Module
+	})
+	return out
+}
+
+// ModuleDelta is the change in a module's monthly cost between two plans.
+type ModuleDelta struct {
+	Module string
+	Before float64
+	After  float64
+}
+
+// Delta is After minus Before.
+func (d ModuleDelta) Delta() float64 { return d.After - d.Before }
+
+// Diff compares two estimates module by module. Modules whose cost did not
+// change are omitted.
+func Diff(before, after *Estimate) []ModuleDelta {
+	totals := map[string]*ModuleDelta{}
+	get := func(m string) *ModuleDelta {
+		if d, ok := totals[m]; ok {
+			return d
+		}
+		d := &ModuleDelta{Module: m}
+		totals[m] = d
+		return d
+	}
+	for _, mt := range before.ByModule() {
+		get(mt.Module).Before = mt.Monthly
+	}
+	for _, mt := range after.ByModule() {
+		get(mt.Module).After = mt.Monthly
+	}
+
+	var out []ModuleDelta
+	for _, d := range totals {
+		if fmt.Sprintf("%.2f", d.Before) != fmt.Sprintf("%.2f", d.After) {
+			out = append(out, *d)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Module < out[j].Module })
+	return out
+}
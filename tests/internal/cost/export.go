@@ -0,0 +1,54 @@
+package cost
+
+import (
+	"fmt"
+
+	"github.com/yourorg/tf-modules/tests/internal/report"
+)
+
+// ReportRules describes the estimate's checks for SARIF and JUnit output.
+func ReportRules() []report.Rule {
+	out := []report.Rule{
+		{ID: "over-budget", ShortDescription: "The monthly estimate is within the plan's budget"},
+		{ID: "unpriced", ShortDescription: "Every cost-bearing resource is priced"},
+		{ID: "region-not-priced", ShortDescription: "Every planned region is in the price table"},
+	}
+	for i := range out {
+		out[i].Name = out[i].ID
+		out[i].HelpURI = "docs/aws-cost-governance.md"
+	}
+	return out
+}
+
+// ReportFindings converts the estimate for SARIF and JUnit output: an
+// error when the total exceeds budget (0 means none), a warning for each
+// unpriced resource, resolved to its block through idx when it is non-nil,
+// and a warning for each of regionWarnings (see Table.RegionWarnings).
+func (e *Estimate) ReportFindings(budget float64, regionWarnings []string, idx *report.SourceIndex) []report.Finding {
+	var out []report.Finding
+	if budget > 0 && e.Total() > budget {
+		f := report.Finding{
+			RuleID:  "over-budget",
+			Level:   report.LevelError,
+			Message: fmt.Sprintf("estimate %.2f %s exceeds the monthly budget of %.2f", e.Total(), e.Currency, budget),
+		}
+		if len(e.Budgets) > 0 {
+			f.Address = e.Budgets[0].Address
+			if idx != nil {
+				f.Location = idx.Locate(f.Address, "limit_amount")
+			}
+		}
+		out = append(out, f)
+	}
+	for _, u := range e.Unpriced {
+		f := report.Finding{RuleID: "unpriced", Level: report.LevelWarning, Message: u.Reason, Address: u.Address}
+		if idx != nil {
+			f.Location = idx.Locate(u.Address, "")
+		}
+		out = append(out, f)
+	}
+	for _, w := range regionWarnings {
+		out = append(out, report.Finding{RuleID: "region-not-priced", Level: report.LevelWarning, Message: w})
+	}
+	return out
+}
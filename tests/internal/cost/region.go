@@ -0,0 +1,109 @@
+package cost
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+)
+
+// zoneRe matches a GCP zone such as us-central1-a, whose region is the
+// part before the last dash.
+var zoneRe = regexp.MustCompile(`^[a-z]+-[a-z]+[0-9]+-[a-z]$`)
+
+// PlanRegions returns the regions a plan deploys to, keyed by cloud as in
+// Table.Regions. AWS regions come from the region of each root aws provider
+// configuration, set as a constant or from a root variable. Azure regions
+// come from planned resource locations and GCP regions from planned
+// resource regions and locations. Regions unknown at plan time are left
+// out.
+func PlanRegions(plan *tfjson.Plan) map[string][]string {
+	seen := map[string]map[string]bool{}
+	add := func(cloud, region string) {
+		if region == "" {
+			return
+		}
+		if seen[cloud] == nil {
+			seen[cloud] = map[string]bool{}
+		}
+		seen[cloud][region] = true
+	}
+
+	if plan.Config != nil {
+		for _, p := range plan.Config.ProviderConfigs {
+			if p.Name != "aws" || p.ModuleAddress != "" {
+				continue
+			}
+			expr, ok := p.Expressions["region"]
+			if !ok || expr == nil {
+				continue
+			}
+			if s, ok := expr.ConstantValue.(string); ok {
+				add("aws", s)
+				continue
+			}
+			for _, ref := range expr.References {
+				if name, ok := strings.CutPrefix(ref, "var."); ok {
+					s, _ := planjson.Variable(plan, name).(string)
+					add("aws", s)
+				}
+			}
+		}
+	}
+
+	for _, r := range planjson.Resources(plan) {
+		switch {
+		case strings.HasPrefix(r.Type, "azurerm_"):
+			add("azure", strings.ToLower(strings.ReplaceAll(planjson.String(r.Values, "location"), " ", "")))
+		case strings.HasPrefix(r.Type, "google_"):
+			for _, attr := range []string{"region", "location"} {
+				v := planjson.String(r.Values, attr)
+				if zoneRe.MatchString(v) {
+					v = v[:strings.LastIndex(v, "-")]
+				}
+				if regionalLocation.MatchString(v) {
+					add("gcp", v)
+				}
+			}
+		}
+	}
+
+	out := map[string][]string{}
+	for cloud, regions := range seen {
+		for r := range regions {
+			out[cloud] = append(out[cloud], r)
+		}
+		sort.Strings(out[cloud])
+	}
+	return out
+}
+
+// RegionWarnings reports each of regions, as returned by PlanRegions, that
+// the table's prices are not for. The table holds one region's list prices
+// per cloud, so an estimate for any other region is off by that region's
+// price difference.
+func (t *Table) RegionWarnings(regions map[string][]string) []string {
+	clouds := make([]string, 0, len(regions))
+	for cloud := range regions {
+		clouds = append(clouds, cloud)
+	}
+	sort.Strings(clouds)
+
+	var out []string
+	for _, cloud := range clouds {
+		priced, ok := t.Regions[cloud]
+		for _, r := range regions[cloud] {
+			switch {
+			case !ok:
+				out = append(out, fmt.Sprintf("%s region %s is not priced; table %s has no %s region", cloud, r, t.Version, cloud))
+			case r != priced:
+				out = append(out, fmt.Sprintf("%s region %s is not priced; the estimate uses %s list prices", cloud, r, priced))
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,107 @@
+// Package cost estimates the monthly list-price cost of a Terraform plan
+// from a vendored price table, so environment spend can be compared with
+// the budgets module before anything is applied.
+package cost
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+)
+
+//go:embed prices/*.json
+var vendoredPrices embed.FS
+
+// Table is a versioned price table. Prices are keyed by SKU, e.g.
+// "aws.ec2.m5.large.hour", and Usage holds default usage quantities for
+// usage-priced SKUs such as log ingestion. Regions names the one region
+// per cloud ("aws", "azure", "gcp") whose list prices the table holds.
+type Table struct {
+	Version       string             `json:"version"`
+	Currency      string             `json:"currency"`
+	HoursPerMonth float64            `json:"hours_per_month"`
+	Regions       map[string]string  `json:"regions"`
+	Prices        map[string]float64 `json:"prices"`
+	Usage         map[string]float64 `json:"usage"`
+}
+
+// VendoredVersions lists the price table versions embedded in the binary,
+// oldest first.
+func VendoredVersions() []string {
+	entries, _ := vendoredPrices.ReadDir("prices")
+	var out []string
+	for _, e := range entries {
+		out = append(out, e.Name()[:len(e.Name())-len(path.Ext(e.Name()))])
+	}
+	sort.Strings(out)
+	return out
+}
+
+// VendoredTable returns the embedded table for version, or the newest one
+// when version is empty.
+func VendoredTable(version string) (*Table, error) {
+	if version == "" {
+		versions := VendoredVersions()
+		if len(versions) == 0 {
+			return nil, fmt.Errorf("no vendored price tables")
+		}
+		version = versions[len(versions)-1]
+	}
+	data, err := vendoredPrices.ReadFile("prices/" + version + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("price table %q not vendored (have %v)", version, VendoredVersions())
+	}
+	return parseTable(data)
+}
+
+// LoadTable reads a price table from disk.
+func LoadTable(file string) (*Table, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return parseTable(data)
+}
+
+func parseTable(data []byte) (*Table, error) {
+	var t Table
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("parsing price table: %w", err)
+	}
+	if t.Version == "" || t.HoursPerMonth <= 0 {
+		return nil, fmt.Errorf("price table must set version and hours_per_month")
+	}
+	return &t, nil
+}
+
+// Usage overrides the table's default usage quantities. Keys are either a
+// SKU ("aws.cloudwatch.logs.ingest_gb") applying everywhere, or a module
+// address and SKU joined by a colon ("module.logging:aws.cloudwatch.logs.ingest_gb").
+type Usage map[string]float64
+
+// LoadUsage reads a usage override file.
+func LoadUsage(file string) (Usage, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var u Usage
+	if err := json.Unmarshal(data, &u); err != nil {
+		return nil, fmt.Errorf("parsing usage file: %w", err)
+	}
+	return u, nil
+}
+
+// quantity resolves the usage quantity of sku for a module.
+func (t *Table) quantity(u Usage, module, sku string) float64 {
+	if q, ok := u[module+":"+sku]; ok {
+		return q
+	}
+	if q, ok := u[sku]; ok {
+		return q
+	}
+	return t.Usage[sku]
+}
@@ -0,0 +1,10 @@
+// Package filelock takes exclusive locks on files, so test binaries and
+// commands sharing a directory (the CIDR pool, the plugin cache, run
+// manifests, local state) do not step on each other.
+package filelock
+
+import "errors"
+
+// ErrLocked is returned by TryLock and TryLockRecord for a file another
+// process holds.
+var ErrLocked = errors.New("file is locked")
@@ -0,0 +1,78 @@
+package filelock_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/filelock"
+)
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		holders int
+		most    int
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock, err := filelock.Lock(path, time.Minute)
+			if !assert.NoError(t, err) {
+				return
+			}
+			mu.Lock()
+			holders++
+			if holders > most {
+				most = holders
+			}
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			holders--
+			mu.Unlock()
+			unlock()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, most, "the lock is held by one caller at a time")
+}
+
+func TestTryLock(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("TryLock cannot exclude without flock")
+	}
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	require.NoError(t, os.WriteFile(path, []byte("{}"), 0o600))
+
+	held, err := os.Open(path)
+	require.NoError(t, err)
+	require.NoError(t, filelock.TryLock(held))
+
+	other, err := os.Open(path)
+	require.NoError(t, err)
+	defer other.Close()
+	assert.ErrorIs(t, filelock.TryLock(other), filelock.ErrLocked)
+
+	require.NoError(t, held.Close())
+	assert.NoError(t, filelock.TryLock(other), "closing the file releases the lock")
+}
+
+func TestTryLockRecord(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "terraform.tfstate")
+	unlock, err := filelock.TryLockRecord(path, filepath.Join(dir, ".terraform.tfstate.lock.info"))
+	require.NoError(t, err)
+	assert.FileExists(t, path)
+	unlock()
+}
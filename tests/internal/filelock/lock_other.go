@@ -0,0 +1,52 @@
+//go:build !unix
+
+package filelock
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// Lock creates path exclusively, retrying until it can. A lock file older
+// than stale is assumed to belong to a killed process and is broken.
+func Lock(path string, stale time.Duration) (unlock func(), err error) {
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > stale {
+			os.Remove(path)
+			continue
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// TryLock always succeeds: without flock a file in use cannot be told from
+// one whose owner is gone, so callers must not rely on it to exclude a
+// running process.
+func TryLock(*os.File) error {
+	return nil
+}
+
+// TryLockRecord creates fallback exclusively, returning ErrLocked if it
+// exists. Without fcntl it does not exclude a Terraform process holding
+// path, only other callers of TryLockRecord.
+func TryLockRecord(path, fallback string) (unlock func(), err error) {
+	f, err := os.OpenFile(fallback, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, ErrLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return func() {}, nil
+}
@@ -0,0 +1,64 @@
+//go:build unix
+
+package filelock
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Lock takes an exclusive flock on path, creating it, and blocks until it
+// is free. The kernel drops the lock if the process dies, so a killed test
+// binary never wedges the lock and stale is not needed.
+func Lock(path string, stale time.Duration) (unlock func(), err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN) //nolint:errcheck
+		f.Close()
+	}, nil
+}
+
+// TryLock takes an exclusive flock on f without waiting, and returns
+// ErrLocked if another open file holds it. Closing f releases it, as does
+// the death of the process, which is how a file whose owner is gone is
+// told from one still in use.
+func TryLock(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return ErrLocked
+	}
+	return err
+}
+
+// TryLockRecord takes the fcntl write lock Terraform's local backend takes
+// on its state file, creating path, without waiting. fallback is only used
+// where fcntl is not available. Unlike flock, fcntl locks belong to the
+// process, so they do not exclude other goroutines.
+func TryLockRecord(path, fallback string) (unlock func(), err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	lk := &syscall.Flock_t{Type: syscall.F_WRLCK, Whence: 0, Start: 0, Len: 0}
+	if err := syscall.FcntlFlock(f.Fd(), syscall.F_SETLK, lk); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EACCES) {
+			return nil, ErrLocked
+		}
+		return nil, err
+	}
+	return func() {
+		lk.Type = syscall.F_UNLCK
+		syscall.FcntlFlock(f.Fd(), syscall.F_SETLK, lk) //nolint:errcheck
+		f.Close()
+	}, nil
+}
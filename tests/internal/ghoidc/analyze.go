@@ -0,0 +1,169 @@
+package ghoidc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Expectation is who should be able to assume a role.
+type Expectation struct {
+	// Role matches role addresses by suffix, e.g. aws_iam_role.apply.
+	Role         string
+	Repositories []string
+	// Branch restricts the role to pushes to refs/heads/<Branch>; "" allows
+	// any ref, pull request or environment of Repositories.
+	Branch string
+}
+
+// Want reports whether the expectation allows tok.
+func (e Expectation) Want(tok Token) bool {
+	if tok.Audience != "" && tok.Audience != DefaultAudience {
+		return false
+	}
+	found := false
+	for _, r := range e.Repositories {
+		found = found || r == tok.Repository
+	}
+	if !found {
+		return false
+	}
+	return e.Branch == "" || tok.Sub() == fmt.Sprintf("repo:%s:ref:refs/heads/%s", tok.Repository, e.Branch)
+}
+
+// Case is the evaluation of one role against one simulated token.
+type Case struct {
+	Role     string
+	Token    Token
+	Decision Decision
+	Want     bool
+}
+
+// Finding is a trust policy problem.
+type Finding struct {
+	Role string
+	// Check is unexpected-allow, unexpected-deny, sub-wildcard, missing-sub,
+	// missing-aud, unsupported-claim or missing-role.
+	Check   string
+	Message string
+}
+
+func (f Finding) Error() string {
+	return f.Role + ": " + f.Check + ": " + f.Message
+}
+
+// Result is the outcome of Analyze.
+type Result struct {
+	Roles    []Role
+	Cases    []Case
+	Findings []Finding
+}
+
+// Analyze simulates GitHub tokens against each role an expectation names
+// and lints every GitHub-trusting role's conditions.
+func Analyze(roles []Role, expectations []Expectation) *Result {
+	res := &Result{Roles: roles}
+	for _, e := range expectations {
+		matched := false
+		for _, role := range roles {
+			if !strings.HasSuffix(role.Address, e.Role) {
+				continue
+			}
+			matched = true
+			for _, tok := range Tokens(e.Repositories, branchOrDefault(e.Branch)) {
+				c := Case{Role: role.Address, Token: tok, Decision: Evaluate(role.Policy, tok), Want: e.Want(tok)}
+				res.Cases = append(res.Cases, c)
+				switch {
+				case c.Decision.Allowed && !c.Want:
+					res.Findings = append(res.Findings, Finding{Role: role.Address, Check: "unexpected-allow",
+						Message: fmt.Sprintf("%s can assume the role (%s)", tok, c.Decision.Statement)})
+				case !c.Decision.Allowed && c.Want:
+					res.Findings = append(res.Findings, Finding{Role: role.Address, Check: "unexpected-deny",
+						Message: fmt.Sprintf("%s cannot assume the role", tok)})
+				}
+			}
+		}
+		if !matched {
+			res.Findings = append(res.Findings, Finding{Role: e.Role, Check: "missing-role",
+				Message: "no planned aws_iam_role trusting GitHub matches"})
+		}
+	}
+
+	for _, role := range roles {
+		var branch string
+		restricted := false
+		for _, e := range expectations {
+			if strings.HasSuffix(role.Address, e.Role) && e.Branch != "" {
+				branch, restricted = e.Branch, true
+			}
+		}
+		res.Findings = append(res.Findings, lint(role, restricted, branch)...)
+	}
+	return res
+}
+
+func branchOrDefault(b string) string {
+	if b == "" {
+		return "main"
+	}
+	return b
+}
+
+// lint reports GitHub-trusting Allow statements whose sub or aud
+// conditions are missing or broader than the expectation.
+func lint(role Role, restricted bool, branch string) []Finding {
+	var out []Finding
+	add := func(check, format string, args ...interface{}) {
+		out = append(out, Finding{Role: role.Address, Check: check, Message: fmt.Sprintf(format, args...)})
+	}
+	for i, s := range role.Policy.Statements {
+		if !s.Allow() || !trustsGitHub(s) {
+			continue
+		}
+		id := s.ID(i)
+		var sub, aud bool
+		for _, c := range s.Conditions {
+			op := c.Operator
+			if j := strings.Index(op, ":"); j >= 0 {
+				op = op[j+1:]
+			}
+			positive := strings.HasPrefix(op, "StringEquals") || strings.HasPrefix(op, "StringLike")
+			switch c.Key {
+			case Issuer + ":sub":
+				sub = sub || positive
+				if !strings.HasPrefix(op, "StringLike") {
+					continue
+				}
+				for _, v := range c.Values {
+					repo, rest := splitSub(v)
+					switch {
+					case !strings.HasPrefix(v, "repo:") || strings.ContainsAny(repo, "*?"):
+						add("sub-wildcard", "%s: %q matches repositories other than the ones listed", id, v)
+					case restricted && strings.ContainsAny(rest, "*?"):
+						add("sub-wildcard", "%s: %q matches refs other than refs/heads/%s", id, v, branch)
+					}
+				}
+			case Issuer + ":aud":
+				aud = aud || positive
+			default:
+				if strings.HasPrefix(c.Key, Issuer+":") {
+					add("unsupported-claim", "%s: IAM passes only aud and sub from GitHub tokens; the %s condition sees a missing key", id, strings.TrimPrefix(c.Key, Issuer+":"))
+				}
+			}
+		}
+		if !sub {
+			add("missing-sub", "%s: no sub condition; any GitHub repository can assume the role", id)
+		}
+		if !aud {
+			add("missing-aud", "%s: no aud condition; tokens minted for other audiences are accepted", id)
+		}
+	}
+	return out
+}
+
+// splitSub splits "repo:owner/name:ref:refs/heads/main" into the
+// repository and what follows it.
+func splitSub(v string) (repo, rest string) {
+	v = strings.TrimPrefix(v, "repo:")
+	repo, rest, _ = strings.Cut(v, ":")
+	return repo, rest
+}
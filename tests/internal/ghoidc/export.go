@@ -0,0 +1,47 @@
+package ghoidc
+
+import (
+	"github.com/yourorg/tf-modules/tests/internal/report"
+)
+
+// checks describes each Finding.Check for SARIF and JUnit output.
+var checks = []report.Rule{
+	{ID: "unexpected-allow", ShortDescription: "Only the expected repositories and refs can assume the role"},
+	{ID: "unexpected-deny", ShortDescription: "The expected repositories and refs can assume the role"},
+	{ID: "sub-wildcard", ShortDescription: "sub conditions do not match other repositories or refs"},
+	{ID: "missing-sub", ShortDescription: "GitHub trust statements have a sub condition"},
+	{ID: "missing-aud", ShortDescription: "GitHub trust statements have an aud condition"},
+	{ID: "unsupported-claim", ShortDescription: "Conditions use only the claims IAM passes from GitHub"},
+	{ID: "missing-role", ShortDescription: "Every expected role is planned and trusts GitHub"},
+}
+
+// ReportRules describes the checks Analyze performs for SARIF and JUnit
+// output.
+func ReportRules() []report.Rule {
+	out := make([]report.Rule, len(checks))
+	for i, c := range checks {
+		c.Name = c.ID
+		c.HelpURI = "docs/testing.md"
+		out[i] = c
+	}
+	return out
+}
+
+// ReportFindings converts the findings for SARIF and JUnit output,
+// resolving each role's assume_role_policy through idx when it is non-nil.
+func (r *Result) ReportFindings(idx *report.SourceIndex) []report.Finding {
+	out := make([]report.Finding, 0, len(r.Findings))
+	for _, f := range r.Findings {
+		rf := report.Finding{
+			RuleID:  f.Check,
+			Level:   report.LevelError,
+			Message: f.Message,
+			Address: f.Role,
+		}
+		if idx != nil {
+			rf.Location = idx.Locate(f.Role, "assume_role_policy")
+		}
+		out = append(out, rf)
+	}
+	return out
+}
@@ -0,0 +1,153 @@
+package ghoidc_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/ghoidc"
+	"github.com/yourorg/tf-modules/tests/internal/iampolicy"
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+	"github.com/yourorg/tf-modules/tests/internal/report"
+)
+
+var repos = []string{"acme/infra", "acme/app"}
+
+func TestRoles(t *testing.T) {
+	plan, err := planjson.Load("testdata/plan.json")
+	require.NoError(t, err)
+	roles, err := ghoidc.Roles(plan)
+	require.NoError(t, err)
+
+	// aws_iam_role.ec2 trusts a service, not GitHub.
+	var got []string
+	for _, r := range roles {
+		got = append(got, r.Address+" <- "+r.Source)
+	}
+	assert.Equal(t, []string{
+		"aws_iam_role.apply <- data.aws_iam_policy_document.apply_assume_role",
+		"aws_iam_role.legacy_deploy <- assume_role_policy",
+		"aws_iam_role.plan <- data.aws_iam_policy_document.plan_assume_role",
+	}, got)
+
+	// The plan role's document waits on the provider ARN.
+	plan0 := roles[2].Policy.Statements[0]
+	assert.Equal(t, []string{ghoidc.UnknownValue}, plan0.Principals["Federated"])
+	assert.Equal(t, iampolicy.Condition{Operator: "StringLike", Key: ghoidc.Issuer + ":sub",
+		Values: []string{"repo:acme/infra:*", "repo:acme/app:*"}}, plan0.Conditions[1])
+}
+
+func TestEvaluate(t *testing.T) {
+	p, err := iampolicy.Parse(`{"Statement": {
+		"Effect": "Allow",
+		"Action": "sts:AssumeRoleWithWebIdentity",
+		"Principal": {"Federated": "arn:aws:iam::111111111111:oidc-provider/token.actions.githubusercontent.com"},
+		"Condition": {
+			"StringEquals": {"token.actions.githubusercontent.com:aud": "sts.amazonaws.com"},
+			"StringLike": {"token.actions.githubusercontent.com:sub": ["repo:acme/infra:ref:refs/heads/release-?", "repo:acme/infra:environment:*"]}
+		}
+	}}`)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		tok  ghoidc.Token
+		want bool
+	}{
+		{ghoidc.Token{Repository: "acme/infra", Ref: "refs/heads/release-1"}, true},
+		{ghoidc.Token{Repository: "acme/infra", Ref: "refs/heads/release-10"}, false},
+		{ghoidc.Token{Repository: "acme/infra", Ref: "refs/heads/main", Environment: "prod"}, true},
+		{ghoidc.Token{Repository: "acme/infra", Ref: "refs/heads/release-1", Audience: "https://github.com/acme"}, false},
+		{ghoidc.Token{Repository: "acme/infra", Ref: "refs/heads/release-1", Event: "pull_request"}, false},
+	} {
+		assert.Equal(t, tc.want, ghoidc.Evaluate(p, tc.tok).Allowed, tc.tok.String())
+	}
+}
+
+func TestTokens(t *testing.T) {
+	var subs []string
+	for _, tok := range ghoidc.Tokens([]string{"acme/infra"}, "main") {
+		subs = append(subs, tok.String())
+	}
+	assert.Equal(t, []string{
+		"repo:acme/infra:ref:refs/heads/main",
+		"repo:acme/infra:ref:refs/heads/feature/oidc-probe",
+		"repo:acme/infra:ref:refs/tags/v0.0.0-probe",
+		"repo:acme/infra:pull_request",
+		"repo:acme/infra:environment:production",
+		"repo:acme/infra-fork:ref:refs/heads/main",
+		"repo:acme/probe-infra:ref:refs/heads/main",
+		"repo:acme-probe/infra:ref:refs/heads/main",
+		"repo:probe/infra:ref:refs/heads/main",
+		"repo:acme/oidc-probe:ref:refs/heads/main",
+		"repo:acme/infra:ref:refs/heads/main (aud https://github.com/acme)",
+	}, subs)
+}
+
+func TestAnalyze(t *testing.T) {
+	plan, err := planjson.Load("testdata/plan.json")
+	require.NoError(t, err)
+	roles, err := ghoidc.Roles(plan)
+	require.NoError(t, err)
+
+	res := ghoidc.Analyze(roles, []ghoidc.Expectation{
+		{Role: "aws_iam_role.plan", Repositories: repos},
+		{Role: "aws_iam_role.apply", Repositories: repos, Branch: "main"},
+		{Role: "aws_iam_role.legacy_deploy", Repositories: []string{"acme/infra"}, Branch: "main"},
+		{Role: "aws_iam_role.missing", Repositories: repos},
+	})
+
+	allowed := map[string][]string{}
+	for _, c := range res.Cases {
+		if c.Decision.Allowed {
+			allowed[c.Role] = append(allowed[c.Role], c.Token.String())
+		}
+	}
+	assert.Len(t, allowed["aws_iam_role.plan"], 10, "every ref, pull request and environment of both repositories")
+	assert.Equal(t, []string{"repo:acme/infra:ref:refs/heads/main", "repo:acme/app:ref:refs/heads/main"}, allowed["aws_iam_role.apply"])
+
+	var got []string
+	for _, f := range res.Findings {
+		got = append(got, f.Error())
+	}
+	assert.Equal(t, []string{
+		"aws_iam_role.legacy_deploy: unexpected-allow: repo:acme/infra:ref:refs/heads/feature/oidc-probe can assume the role (GitHubDeploy)",
+		"aws_iam_role.legacy_deploy: unexpected-allow: repo:acme/infra:ref:refs/tags/v0.0.0-probe can assume the role (GitHubDeploy)",
+		"aws_iam_role.legacy_deploy: unexpected-allow: repo:acme/infra:environment:production can assume the role (GitHubDeploy)",
+		"aws_iam_role.legacy_deploy: unexpected-allow: repo:acme/infra-fork:ref:refs/heads/main can assume the role (GitHubDeploy)",
+		"aws_iam_role.legacy_deploy: unexpected-allow: repo:acme/probe-infra:ref:refs/heads/main can assume the role (GitHubDeploy)",
+		"aws_iam_role.legacy_deploy: unexpected-allow: repo:acme/oidc-probe:ref:refs/heads/main can assume the role (GitHubDeploy)",
+		"aws_iam_role.legacy_deploy: unexpected-allow: repo:acme/infra:ref:refs/heads/main (aud https://github.com/acme) can assume the role (GitHubDeploy)",
+		"aws_iam_role.missing: missing-role: no planned aws_iam_role trusting GitHub matches",
+		`aws_iam_role.legacy_deploy: sub-wildcard: GitHubDeploy: "repo:acme/*" matches repositories other than the ones listed`,
+		"aws_iam_role.legacy_deploy: missing-aud: GitHubDeploy: no aud condition; tokens minted for other audiences are accepted",
+		"aws_iam_role.legacy_deploy: unsupported-claim: RepositoryClaim: IAM passes only aud and sub from GitHub tokens; the repository condition sees a missing key",
+	}, got)
+}
+
+func TestReportFindings(t *testing.T) {
+	plan, err := planjson.Load("testdata/plan.json")
+	require.NoError(t, err)
+	roles, err := ghoidc.Roles(plan)
+	require.NoError(t, err)
+	res := ghoidc.Analyze(roles, []ghoidc.Expectation{
+		{Role: "aws_iam_role.legacy_deploy", Repositories: []string{"acme/infra"}, Branch: "main"},
+	})
+
+	findings := res.ReportFindings(nil)
+	require.Len(t, findings, len(res.Findings))
+	assert.Equal(t, report.Finding{
+		RuleID:  "unexpected-allow",
+		Level:   report.LevelError,
+		Message: "repo:acme/infra:ref:refs/heads/feature/oidc-probe can assume the role (GitHubDeploy)",
+		Address: "aws_iam_role.legacy_deploy",
+	}, findings[0])
+
+	ids := map[string]bool{}
+	for _, r := range ghoidc.ReportRules() {
+		ids[r.ID] = true
+	}
+	for _, f := range findings {
+		assert.True(t, ids[f.RuleID], "rule %s should be described", f.RuleID)
+	}
+}
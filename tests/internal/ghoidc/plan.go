@@ -0,0 +1,38 @@
+package ghoidc
+
+import (
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/yourorg/tf-modules/tests/internal/iampolicy"
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+)
+
+// Role is a planned aws_iam_role whose trust policy federates GitHub.
+type Role struct {
+	Address string
+	// Name is the planned role name, "" if it is not known until apply.
+	Name   string
+	Policy *iampolicy.Policy
+	// Source is where the policy came from: assume_role_policy, or the
+	// address of the aws_iam_policy_document that builds it.
+	Source string
+}
+
+// Roles returns the planned IAM roles that trust the GitHub OIDC provider.
+// A role's policy is read from its planned assume_role_policy, or, when
+// that is unknown because the provider is created in the same plan, from
+// the statement blocks of the aws_iam_policy_document it references.
+func Roles(plan *tfjson.Plan) ([]Role, error) {
+	docs := iampolicy.Documents(plan)
+	var out []Role
+	for _, r := range planjson.OfType(planjson.Resources(plan), "aws_iam_role") {
+		p, source, err := iampolicy.Resolve(plan, r, "assume_role_policy", docs)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil && TrustsGitHub(p) {
+			out = append(out, Role{Address: r.Address, Name: planjson.String(r.Values, "name"), Policy: p, Source: source})
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,167 @@
+// Package ghoidc evaluates IAM role trust policies against simulated GitHub
+// Actions OIDC tokens, so a plan can show which repositories, branches,
+// environments and events are able to assume each CI role before anything
+// is applied.
+package ghoidc
+
+import (
+	"strings"
+
+	"github.com/yourorg/tf-modules/tests/internal/iampolicy"
+)
+
+// Issuer is the GitHub Actions OIDC issuer host, which IAM uses as the
+// prefix of the token's condition keys.
+const Issuer = "token.actions.githubusercontent.com"
+
+// UnknownValue stands in for a principal that is known only after apply,
+// typically the ARN of an OIDC provider created in the same plan.
+const UnknownValue = iampolicy.UnknownValue
+
+// trustsGitHub reports whether the statement federates the GitHub OIDC
+// provider, or an identifier not yet known that its conditions tie to it.
+func trustsGitHub(s iampolicy.Statement) bool {
+	for _, id := range s.Principals["Federated"] {
+		if strings.HasSuffix(id, "oidc-provider/"+Issuer) || id == Issuer {
+			return true
+		}
+		if id == UnknownValue {
+			for _, c := range s.Conditions {
+				if strings.HasPrefix(c.Key, Issuer+":") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// TrustsGitHub reports whether any statement of p federates the GitHub
+// OIDC provider.
+func TrustsGitHub(p *iampolicy.Policy) bool {
+	for _, s := range p.Statements {
+		if trustsGitHub(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// appliesTo reports whether the statement covers sts:AssumeRoleWithWebIdentity
+// by the GitHub provider.
+func appliesTo(s iampolicy.Statement) bool {
+	const action = "sts:AssumeRoleWithWebIdentity"
+	if len(s.NotActions) > 0 {
+		for _, a := range s.NotActions {
+			if iampolicy.MatchAction(a, action) {
+				return false
+			}
+		}
+	} else {
+		matched := false
+		for _, a := range s.Actions {
+			matched = matched || iampolicy.MatchAction(a, action)
+		}
+		if !matched {
+			return false
+		}
+	}
+	for _, id := range s.Principals["AWS"] {
+		if id == "*" {
+			return true
+		}
+	}
+	return trustsGitHub(s)
+}
+
+// Decision is the outcome of evaluating a policy for one token.
+type Decision struct {
+	Allowed bool
+	// Statement is the Sid, or index, of the statement that decided:
+	// the matching Deny, or the first matching Allow.
+	Statement string
+}
+
+// Evaluate applies IAM's evaluation logic to a web identity assumption of
+// a role with trust policy p by tok: an explicit Deny wins, otherwise any
+// matching Allow allows.
+func Evaluate(p *iampolicy.Policy, tok Token) Decision {
+	claims := tok.Claims()
+	var allow *Decision
+	for i, s := range p.Statements {
+		if !appliesTo(s) || !conditionsMatch(s, claims) {
+			continue
+		}
+		id := s.ID(i)
+		if !s.Allow() {
+			return Decision{Statement: id}
+		}
+		if allow == nil {
+			allow = &Decision{Allowed: true, Statement: id}
+		}
+	}
+	if allow == nil {
+		return Decision{}
+	}
+	return *allow
+}
+
+func conditionsMatch(s iampolicy.Statement, claims map[string]string) bool {
+	for _, c := range s.Conditions {
+		if !match(c, claims) {
+			return false
+		}
+	}
+	return true
+}
+
+// match evaluates one condition against single-valued claims. Set
+// operators (ForAnyValue:, ForAllValues:) reduce to their base operator
+// for single values; IfExists matches a missing key, as do the negated
+// operators.
+func match(c iampolicy.Condition, claims map[string]string) bool {
+	op := c.Operator
+	if i := strings.Index(op, ":"); i >= 0 {
+		op = op[i+1:]
+	}
+	ifExists := strings.HasSuffix(op, "IfExists")
+	op = strings.TrimSuffix(op, "IfExists")
+
+	v, ok := claims[c.Key]
+	if !ok {
+		switch op {
+		case "StringNotEquals", "StringNotEqualsIgnoreCase", "StringNotLike":
+			return true
+		case "Null":
+			return len(c.Values) > 0 && strings.EqualFold(c.Values[0], "true")
+		}
+		return ifExists
+	}
+
+	anyValue := func(fn func(string) bool) bool {
+		for _, want := range c.Values {
+			if fn(want) {
+				return true
+			}
+		}
+		return false
+	}
+	switch op {
+	case "StringEquals":
+		return anyValue(func(w string) bool { return v == w })
+	case "StringNotEquals":
+		return !anyValue(func(w string) bool { return v == w })
+	case "StringEqualsIgnoreCase":
+		return anyValue(func(w string) bool { return strings.EqualFold(v, w) })
+	case "StringNotEqualsIgnoreCase":
+		return !anyValue(func(w string) bool { return strings.EqualFold(v, w) })
+	case "StringLike":
+		return anyValue(func(w string) bool { return iampolicy.Like(w, v) })
+	case "StringNotLike":
+		return !anyValue(func(w string) bool { return iampolicy.Like(w, v) })
+	case "Null":
+		return len(c.Values) > 0 && strings.EqualFold(c.Values[0], "false")
+	}
+	// Operators that do not apply to string claims never match.
+	return false
+}
@@ -0,0 +1,104 @@
+package ghoidc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultAudience is the audience aws-actions/configure-aws-credentials
+// requests.
+const DefaultAudience = "sts.amazonaws.com"
+
+// Token is a simulated GitHub Actions OIDC token.
+type Token struct {
+	// Repository is owner/name.
+	Repository string
+	// Ref is the full git ref, e.g. refs/heads/main or refs/tags/v1.0.0.
+	Ref string
+	// Environment is the deployment environment of the job, if any.
+	Environment string
+	// Event is the triggering event, e.g. push or pull_request.
+	Event string
+	// Audience defaults to DefaultAudience.
+	Audience string
+}
+
+// Sub returns the token's subject claim in GitHub's default format: the
+// environment wins over the event, and pull_request events carry no ref.
+func (t Token) Sub() string {
+	switch {
+	case t.Environment != "":
+		return fmt.Sprintf("repo:%s:environment:%s", t.Repository, t.Environment)
+	case t.Event == "pull_request":
+		return fmt.Sprintf("repo:%s:pull_request", t.Repository)
+	}
+	return fmt.Sprintf("repo:%s:ref:%s", t.Repository, t.Ref)
+}
+
+// Claims returns the condition keys IAM evaluates for the token. IAM
+// passes only aud and sub from a GitHub token; conditions on any other
+// claim see a missing key.
+func (t Token) Claims() map[string]string {
+	aud := t.Audience
+	if aud == "" {
+		aud = DefaultAudience
+	}
+	return map[string]string{
+		Issuer + ":aud": aud,
+		Issuer + ":sub": t.Sub(),
+	}
+}
+
+func (t Token) String() string {
+	s := t.Sub()
+	if t.Audience != "" && t.Audience != DefaultAudience {
+		s += " (aud " + t.Audience + ")"
+	}
+	return s
+}
+
+// Tokens returns the simulated tokens to check roles against: for each
+// repository, a push to branch, a push to another branch, a tag, a pull
+// request and an environment job; lookalike repositories that only a loose
+// wildcard would accept; and a token with GitHub's default audience.
+func Tokens(repositories []string, branch string) []Token {
+	var out []Token
+	for _, repo := range repositories {
+		out = append(out,
+			Token{Repository: repo, Ref: "refs/heads/" + branch, Event: "push"},
+			Token{Repository: repo, Ref: "refs/heads/feature/oidc-probe", Event: "push"},
+			Token{Repository: repo, Ref: "refs/tags/v0.0.0-probe", Event: "push"},
+			Token{Repository: repo, Ref: "refs/pull/1/merge", Event: "pull_request"},
+			Token{Repository: repo, Ref: "refs/heads/" + branch, Event: "push", Environment: "production"},
+		)
+	}
+
+	known := map[string]bool{}
+	for _, repo := range repositories {
+		known[repo] = true
+	}
+	seen := map[string]bool{}
+	for _, repo := range repositories {
+		owner, name, _ := strings.Cut(repo, "/")
+		for _, other := range []string{
+			owner + "/" + name + "-fork",
+			owner + "/probe-" + name,
+			owner + "-probe/" + name,
+			"probe/" + name,
+			owner + "/oidc-probe",
+		} {
+			if known[other] || seen[other] {
+				continue
+			}
+			seen[other] = true
+			out = append(out, Token{Repository: other, Ref: "refs/heads/" + branch, Event: "push"})
+		}
+	}
+
+	if len(repositories) > 0 {
+		owner, _, _ := strings.Cut(repositories[0], "/")
+		out = append(out, Token{Repository: repositories[0], Ref: "refs/heads/" + branch, Event: "push",
+			Audience: "https://github.com/" + owner})
+	}
+	return out
+}
@@ -0,0 +1,166 @@
+package helmcheck
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"helm.sh/helm/v3/pkg/chart/loader"
+
+	"github.com/yourorg/tf-modules/tests/internal/charts"
+)
+
+// Options locates the inputs Run needs besides the plan.
+type Options struct {
+	// Charts is the chart mirror chartmirror syncs, e.g. testdata/charts.
+	Charts string
+	// Schemas holds the pruned OpenAPI schemas, e.g. testdata/kubernetes.
+	Schemas string
+	// KubeVersion overrides the version taken from the plan.
+	KubeVersion string
+}
+
+// Problem is one finding about a rendered release.
+type Problem struct {
+	// Release is the helm_release address, or "" for IRSA roles no
+	// release matches.
+	Release string
+	// Object is Kind/name of the manifest, or "" for release-level findings.
+	Object string
+	// Check is render, schema, removed-api, deprecated-api or irsa.
+	Check   string
+	Message string
+}
+
+func (p Problem) Error() string {
+	var parts []string
+	for _, s := range []string{p.Release, p.Object, p.Check, p.Message} {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, ": ")
+}
+
+// Rendered is a release and the manifests its chart produced.
+type Rendered struct {
+	Release   Release
+	Manifests []Manifest
+	// Unvalidated lists Kind/name of objects the schema does not cover,
+	// such as custom resources.
+	Unvalidated []string
+}
+
+// Result is the outcome of Run.
+type Result struct {
+	KubeVersion string
+	Releases    []Rendered
+	Problems    []Problem
+}
+
+// Run renders every planned helm_release from the chart mirror and checks
+// the manifests for the targeted Kubernetes version.
+func Run(plan *tfjson.Plan, o Options) (*Result, error) {
+	version := o.KubeVersion
+	if version == "" {
+		version = KubeVersion(plan)
+	}
+	if version == "" {
+		return nil, fmt.Errorf("plan has no aws_eks_cluster version or kubernetes_version variable; set the Kubernetes version explicitly")
+	}
+	schema, err := LoadSchema(o.Schemas, version)
+	if err != nil {
+		return nil, err
+	}
+	releases, err := Releases(plan)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := charts.LoadIndex(o.Charts)
+	if err != nil {
+		return nil, err
+	}
+
+	caps := schema.Capabilities()
+	res := &Result{KubeVersion: schema.Version}
+	for _, r := range releases {
+		cv := idx.Lookup(r.Chart, r.Version)
+		if cv == nil || len(cv.URLs) == 0 {
+			res.Problems = append(res.Problems, Problem{Release: r.Address, Check: "render",
+				Message: fmt.Sprintf("chart %s %s is not in %s; run go run ./cmd/chartmirror sync", r.Chart, r.Version, o.Charts)})
+			continue
+		}
+		ch, err := loader.Load(filepath.Join(o.Charts, cv.URLs[0]))
+		if err != nil {
+			return nil, err
+		}
+		manifests, err := Render(ch, r, caps)
+		if err != nil {
+			res.Problems = append(res.Problems, Problem{Release: r.Address, Check: "render", Message: err.Error()})
+			continue
+		}
+
+		rendered := Rendered{Release: r, Manifests: manifests}
+		for _, m := range manifests {
+			check, msg := Deprecated(m, schema.Version)
+			if check != "" {
+				res.Problems = append(res.Problems, Problem{Release: r.Address, Object: m.String(), Check: check, Message: msg})
+			}
+			if check == "removed-api" {
+				continue
+			}
+			known, problems := schema.Validate(m.Object)
+			if !known {
+				rendered.Unvalidated = append(rendered.Unvalidated, m.String())
+			}
+			for _, p := range problems {
+				res.Problems = append(res.Problems, Problem{Release: r.Address, Object: m.String(), Check: "schema", Message: p})
+			}
+		}
+		res.Releases = append(res.Releases, rendered)
+	}
+
+	res.Problems = append(res.Problems, checkIRSA(IRSASubjects(plan), res.Releases)...)
+	sort.SliceStable(res.Problems, func(i, j int) bool { return res.Problems[i].Release < res.Problems[j].Release })
+	return res, nil
+}
+
+// checkIRSA reports each trusted service account that no release renders
+// with an IRSA annotation.
+func checkIRSA(subjects []string, releases []Rendered) []Problem {
+	annotated := map[string]bool{}
+	rendered := map[string]string{}
+	for _, r := range releases {
+		for _, m := range r.Manifests {
+			if m.APIVersion() != "v1" || m.Kind() != "ServiceAccount" {
+				continue
+			}
+			ns := m.Namespace()
+			if ns == "" {
+				ns = r.Release.Namespace
+			}
+			key := ns + "/" + m.Name()
+			rendered[key] = r.Release.Address
+			if v, _ := m.Annotations()[IRSAAnnotation].(string); v != "" {
+				annotated[key] = true
+			}
+		}
+	}
+
+	var out []Problem
+	for _, s := range subjects {
+		_, name, _ := strings.Cut(s, "/")
+		switch {
+		case annotated[s]:
+		case rendered[s] != "":
+			out = append(out, Problem{Release: rendered[s], Object: "ServiceAccount/" + name, Check: "irsa",
+				Message: fmt.Sprintf("an IAM role trusts %s but the service account has no %s annotation", s, IRSAAnnotation)})
+		default:
+			out = append(out, Problem{Check: "irsa",
+				Message: fmt.Sprintf("an IAM role trusts %s but no release renders that service account", s)})
+		}
+	}
+	return out
+}
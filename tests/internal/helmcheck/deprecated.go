@@ -0,0 +1,69 @@
+package helmcheck
+
+import "fmt"
+
+// deprecation records when an API version stopped being recommended and
+// when the API server stopped serving it. Kind "" covers the whole group
+// version. Versions follow the upstream deprecation guide.
+type deprecation struct {
+	APIVersion  string
+	Kind        string
+	Deprecated  string
+	Removed     string
+	Replacement string
+}
+
+var deprecations = []deprecation{
+	{"extensions/v1beta1", "Deployment", "1.9", "1.16", "apps/v1"},
+	{"extensions/v1beta1", "DaemonSet", "1.9", "1.16", "apps/v1"},
+	{"extensions/v1beta1", "ReplicaSet", "1.9", "1.16", "apps/v1"},
+	{"extensions/v1beta1", "NetworkPolicy", "1.9", "1.16", "networking.k8s.io/v1"},
+	{"extensions/v1beta1", "PodSecurityPolicy", "1.11", "1.16", "policy/v1beta1"},
+	{"extensions/v1beta1", "Ingress", "1.14", "1.22", "networking.k8s.io/v1"},
+	{"apps/v1beta1", "", "1.9", "1.16", "apps/v1"},
+	{"apps/v1beta2", "", "1.9", "1.16", "apps/v1"},
+	{"networking.k8s.io/v1beta1", "", "1.19", "1.22", "networking.k8s.io/v1"},
+	{"admissionregistration.k8s.io/v1beta1", "", "1.16", "1.22", "admissionregistration.k8s.io/v1"},
+	{"apiextensions.k8s.io/v1beta1", "", "1.16", "1.22", "apiextensions.k8s.io/v1"},
+	{"apiregistration.k8s.io/v1beta1", "", "1.19", "1.22", "apiregistration.k8s.io/v1"},
+	{"authentication.k8s.io/v1beta1", "", "1.19", "1.22", "authentication.k8s.io/v1"},
+	{"authorization.k8s.io/v1beta1", "", "1.19", "1.22", "authorization.k8s.io/v1"},
+	{"certificates.k8s.io/v1beta1", "", "1.19", "1.22", "certificates.k8s.io/v1"},
+	{"coordination.k8s.io/v1beta1", "", "1.19", "1.22", "coordination.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "", "1.17", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"scheduling.k8s.io/v1beta1", "", "1.14", "1.22", "scheduling.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "CSIDriver", "1.19", "1.22", "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "CSINode", "1.17", "1.22", "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "StorageClass", "1.19", "1.22", "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "VolumeAttachment", "1.19", "1.22", "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "CSIStorageCapacity", "1.24", "1.27", "storage.k8s.io/v1"},
+	{"batch/v1beta1", "CronJob", "1.21", "1.25", "batch/v1"},
+	{"discovery.k8s.io/v1beta1", "", "1.21", "1.25", "discovery.k8s.io/v1"},
+	{"events.k8s.io/v1beta1", "", "1.19", "1.25", "events.k8s.io/v1"},
+	{"autoscaling/v2beta1", "", "1.22", "1.25", "autoscaling/v2"},
+	{"autoscaling/v2beta2", "", "1.23", "1.26", "autoscaling/v2"},
+	{"node.k8s.io/v1beta1", "", "1.20", "1.25", "node.k8s.io/v1"},
+	{"policy/v1beta1", "PodDisruptionBudget", "1.21", "1.25", "policy/v1"},
+	{"policy/v1beta1", "PodSecurityPolicy", "1.21", "1.25", "Pod Security Admission"},
+	{"flowcontrol.apiserver.k8s.io/v1beta1", "", "1.23", "1.26", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta2", "", "1.26", "1.29", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta3", "", "1.29", "1.32", "flowcontrol.apiserver.k8s.io/v1"},
+}
+
+// Deprecated reports whether m uses an API that version has removed or
+// deprecated. check is "removed-api" or "deprecated-api", and "" if the
+// API is current.
+func Deprecated(m Manifest, version string) (check, message string) {
+	for _, d := range deprecations {
+		if d.APIVersion != m.APIVersion() || d.Kind != "" && d.Kind != m.Kind() {
+			continue
+		}
+		switch {
+		case compareMinor(version, d.Removed) >= 0:
+			return "removed-api", fmt.Sprintf("%s %s was removed in Kubernetes %s; use %s", m.APIVersion(), m.Kind(), d.Removed, d.Replacement)
+		case compareMinor(version, d.Deprecated) >= 0:
+			return "deprecated-api", fmt.Sprintf("%s %s is deprecated since Kubernetes %s and removed in %s; use %s", m.APIVersion(), m.Kind(), d.Deprecated, d.Removed, d.Replacement)
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,51 @@
+package helmcheck
+
+import (
+	"github.com/yourorg/tf-modules/tests/internal/report"
+)
+
+// checks describes each Problem.Check for SARIF and JUnit output.
+var checks = []report.Rule{
+	{ID: "render", ShortDescription: "The chart renders from the mirror with the planned values"},
+	{ID: "schema", ShortDescription: "Manifests validate against the Kubernetes OpenAPI schema"},
+	{ID: "removed-api", ShortDescription: "Manifests use no API the Kubernetes version has removed"},
+	{ID: "deprecated-api", ShortDescription: "Manifests use no API the Kubernetes version deprecates"},
+	{ID: "irsa", ShortDescription: "Service accounts an IAM role trusts carry the IRSA annotation"},
+}
+
+// ReportRules describes the checks Run performs for SARIF and JUnit output.
+func ReportRules() []report.Rule {
+	out := make([]report.Rule, len(checks))
+	for i, c := range checks {
+		c.Name = c.ID
+		c.HelpURI = "docs/testing.md"
+		out[i] = c
+	}
+	return out
+}
+
+// ReportFindings converts the problems for SARIF and JUnit output,
+// resolving each release to its helm_release block through idx when it is
+// non-nil. Deprecated APIs are warnings; every other problem is an error.
+func (r *Result) ReportFindings(idx *report.SourceIndex) []report.Finding {
+	out := make([]report.Finding, 0, len(r.Problems))
+	for _, p := range r.Problems {
+		f := report.Finding{
+			RuleID:  p.Check,
+			Level:   report.LevelError,
+			Message: p.Message,
+			Address: p.Release,
+		}
+		if p.Check == "deprecated-api" {
+			f.Level = report.LevelWarning
+		}
+		if p.Object != "" {
+			f.Message = p.Object + ": " + p.Message
+		}
+		if idx != nil && p.Release != "" {
+			f.Location = idx.Locate(p.Release, "")
+		}
+		out = append(out, f)
+	}
+	return out
+}
@@ -0,0 +1,220 @@
+package helmcheck_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+
+	"github.com/yourorg/tf-modules/tests/internal/charts"
+	"github.com/yourorg/tf-modules/tests/internal/helmcheck"
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+	"github.com/yourorg/tf-modules/tests/internal/report"
+)
+
+// mirror packages testdata/chart/demo into a temporary chart mirror.
+func mirror(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	ch, err := loader.Load("testdata/chart/demo")
+	require.NoError(t, err)
+	archive, err := chartutil.Save(ch, dir)
+	require.NoError(t, err)
+	idx := &charts.Index{APIVersion: "v1", Entries: map[string][]*charts.ChartVersion{
+		"demo": {{Name: "demo", Version: "0.1.0", URLs: []string{filepath.Base(archive)}}},
+	}}
+	require.NoError(t, idx.Write(dir))
+	return dir
+}
+
+func TestReleases(t *testing.T) {
+	plan, err := planjson.Load("testdata/plan.json")
+	require.NoError(t, err)
+
+	releases, err := helmcheck.Releases(plan)
+	require.NoError(t, err)
+	require.Len(t, releases, 2)
+
+	demo := releases[1]
+	assert.Equal(t, "helm_release.demo[0]", demo.Address)
+	assert.Equal(t, "apps", demo.Namespace)
+	assert.Equal(t, map[string]interface{}{
+		"image":     "nginx:1.27",
+		"replicas":  float64(2),
+		"resources": map[string]interface{}{"limits": map[string]interface{}{"memory": "128Mi"}},
+		"serviceAccount": map[string]interface{}{"annotations": map[string]interface{}{
+			"eks.amazonaws.com/role-arn": helmcheck.UnknownValue,
+		}},
+	}, demo.Values)
+	assert.Equal(t, []string{`serviceAccount.annotations.eks\.amazonaws\.com/role-arn`}, demo.Unknown)
+
+	broken := releases[0]
+	assert.Equal(t, true, broken.Values["extraPodSpec"].(map[string]interface{})["hostnetwork"])
+	assert.Equal(t, map[string]interface{}{
+		"team":   int64(7),
+		"owners": []interface{}{"platform", "security"},
+	}, broken.Values["serviceAccount"].(map[string]interface{})["annotations"])
+
+	assert.Equal(t, "1.29", helmcheck.KubeVersion(plan))
+}
+
+func TestRender(t *testing.T) {
+	schema, err := helmcheck.LoadSchema("../../testdata/kubernetes", "v1.29.3")
+	require.NoError(t, err)
+	ch, err := loader.Load("testdata/chart/demo")
+	require.NoError(t, err)
+
+	ms, err := helmcheck.Render(ch, helmcheck.Release{Name: "web", Namespace: "apps", Values: map[string]interface{}{
+		"serviceAccount": map[string]interface{}{"annotations": map[string]interface{}{helmcheck.IRSAAnnotation: "arn:aws:iam::111111111111:role/web"}},
+	}}, schema.Capabilities())
+	require.NoError(t, err)
+
+	var got []string
+	for _, m := range ms {
+		got = append(got, m.APIVersion()+" "+m.String()+" "+m.Source)
+	}
+	assert.Equal(t, []string{
+		"apiextensions.k8s.io/v1 CustomResourceDefinition/widgets.demo.example.com demo/crds/widgets.yaml",
+		"apps/v1 Deployment/web demo/templates/deployment.yaml",
+		"v1 ServiceAccount/web demo/templates/serviceaccount.yaml",
+		"demo.example.com/v1 Widget/web demo/templates/widget.yaml",
+	}, got)
+	assert.Equal(t, "apps", ms[1].Namespace())
+	assert.Equal(t, "arn:aws:iam::111111111111:role/web", ms[2].Annotations()[helmcheck.IRSAAnnotation])
+
+	old := schema.Capabilities()
+	old.KubeVersion = chartutil.KubeVersion{Version: "v1.24.0", Major: "1", Minor: "24"}
+	_, err = helmcheck.Render(ch, helmcheck.Release{Name: "web", Namespace: "apps"}, old)
+	assert.EqualError(t, err, "chart demo requires kubeVersion >=1.25.0-0, not v1.24.0")
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := helmcheck.LoadSchema("../../testdata/kubernetes", "1.29")
+	require.NoError(t, err)
+	assert.Contains(t, schema.APIVersions(), "policy/v1/PodDisruptionBudget")
+	assert.Contains(t, schema.APIVersions(), "apps/v1")
+
+	known, problems := schema.Validate(map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web", "labels": map[string]interface{}{"tier": float64(1)}},
+		"spec": map[string]interface{}{
+			"replicas": 1.5,
+			"template": map[string]interface{}{"spec": map[string]interface{}{
+				"containers": []interface{}{map[string]interface{}{
+					"name":      "web",
+					"resources": map[string]interface{}{"limits": map[string]interface{}{"cpu": float64(1), "memory": "1Gi"}},
+					"ports":     []interface{}{map[string]interface{}{"containerPort": "http"}},
+				}},
+				"hostnetwork": true,
+			}},
+		},
+	})
+	assert.True(t, known)
+	assert.Equal(t, []string{
+		"metadata.labels.tier: expected string, got number",
+		`spec: missing required field "selector"`,
+		"spec.replicas: expected integer, got number",
+		"spec.template.spec.containers[0].ports[0].containerPort: expected integer, got string",
+		"spec.template.spec.hostnetwork: unknown field",
+	}, problems)
+
+	known, _ = schema.Validate(map[string]interface{}{"apiVersion": "demo.example.com/v1", "kind": "Widget"})
+	assert.False(t, known)
+
+	_, err = helmcheck.LoadSchema("../../testdata/kubernetes", "1.30")
+	assert.ErrorContains(t, err, "no OpenAPI schema for Kubernetes 1.30")
+
+	versions, err := helmcheck.SchemaVersions("../../testdata/kubernetes")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.28", "1.29"}, versions)
+}
+
+func TestDeprecated(t *testing.T) {
+	pdb := helmcheck.Manifest{Object: map[string]interface{}{"apiVersion": "policy/v1beta1", "kind": "PodDisruptionBudget"}}
+	check, msg := helmcheck.Deprecated(pdb, "1.23")
+	assert.Equal(t, "deprecated-api", check)
+	assert.Equal(t, "policy/v1beta1 PodDisruptionBudget is deprecated since Kubernetes 1.21 and removed in 1.25; use policy/v1", msg)
+
+	check, _ = helmcheck.Deprecated(pdb, "1.29")
+	assert.Equal(t, "removed-api", check)
+
+	check, _ = helmcheck.Deprecated(pdb, "1.20")
+	assert.Empty(t, check)
+
+	flow := helmcheck.Manifest{Object: map[string]interface{}{"apiVersion": "flowcontrol.apiserver.k8s.io/v1beta3", "kind": "FlowSchema"}}
+	check, _ = helmcheck.Deprecated(flow, "1.29")
+	assert.Equal(t, "deprecated-api", check)
+}
+
+func TestRun(t *testing.T) {
+	plan, err := planjson.Load("testdata/plan.json")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"apps/broken", "apps/demo", "kube-system/other"}, helmcheck.IRSASubjects(plan))
+
+	res, err := helmcheck.Run(plan, helmcheck.Options{Charts: mirror(t), Schemas: "../../testdata/kubernetes"})
+	require.NoError(t, err)
+	assert.Equal(t, "1.29", res.KubeVersion)
+	require.Len(t, res.Releases, 2)
+	assert.Equal(t, []string{"Widget/demo"}, res.Releases[1].Unvalidated)
+
+	var got []string
+	for _, p := range res.Problems {
+		got = append(got, p.Error())
+	}
+	assert.Equal(t, []string{
+		"irsa: an IAM role trusts kube-system/other but no release renders that service account",
+		"helm_release.broken[0]: Deployment/broken: schema: spec.template.spec.hostnetwork: unknown field",
+		"helm_release.broken[0]: PodDisruptionBudget/broken: removed-api: policy/v1beta1 PodDisruptionBudget was removed in Kubernetes 1.25; use policy/v1",
+		"helm_release.broken[0]: ServiceAccount/broken: schema: metadata.annotations.owners: expected string, got array",
+		"helm_release.broken[0]: ServiceAccount/broken: schema: metadata.annotations.team: expected string, got number",
+		"helm_release.broken[0]: ServiceAccount/broken: irsa: an IAM role trusts apps/broken but the service account has no eks.amazonaws.com/role-arn annotation",
+	}, got)
+}
+
+func TestRunMissingChart(t *testing.T) {
+	plan, err := planjson.Load("testdata/plan.json")
+	require.NoError(t, err)
+
+	res, err := helmcheck.Run(plan, helmcheck.Options{Charts: t.TempDir(), Schemas: "../../testdata/kubernetes", KubeVersion: "1.29"})
+	require.NoError(t, err)
+	var render []string
+	for _, p := range res.Problems {
+		if p.Check == "render" {
+			render = append(render, p.Release)
+			assert.Contains(t, p.Message, "chart demo 0.1.0 is not in")
+		}
+	}
+	assert.Equal(t, []string{"helm_release.broken[0]", "helm_release.demo[0]"}, render)
+
+	_, err = helmcheck.Run(plan, helmcheck.Options{Charts: t.TempDir(), Schemas: "../../testdata/kubernetes", KubeVersion: "1.27"})
+	assert.ErrorContains(t, err, "go run ./cmd/helmcheck schemas 1.27")
+}
+
+func TestReportFindings(t *testing.T) {
+	plan, err := planjson.Load("testdata/plan.json")
+	require.NoError(t, err)
+	res, err := helmcheck.Run(plan, helmcheck.Options{Charts: mirror(t), Schemas: "../../testdata/kubernetes"})
+	require.NoError(t, err)
+
+	findings := res.ReportFindings(nil)
+	require.Len(t, findings, len(res.Problems))
+	assert.Equal(t, report.Finding{
+		RuleID:  "removed-api",
+		Level:   report.LevelError,
+		Message: "PodDisruptionBudget/broken: policy/v1beta1 PodDisruptionBudget was removed in Kubernetes 1.25; use policy/v1",
+		Address: "helm_release.broken[0]",
+	}, findings[2])
+
+	ids := map[string]bool{}
+	for _, r := range helmcheck.ReportRules() {
+		ids[r.ID] = true
+	}
+	for _, f := range findings {
+		assert.True(t, ids[f.RuleID], "rule %s should be described", f.RuleID)
+	}
+}
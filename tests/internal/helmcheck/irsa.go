@@ -0,0 +1,81 @@
+package helmcheck
+
+import (
+	"regexp"
+	"sort"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// IRSAAnnotation is the service account annotation EKS uses to hand a pod
+// an IAM role.
+const IRSAAnnotation = "eks.amazonaws.com/role-arn"
+
+var subjectRe = regexp.MustCompile(`system:serviceaccount:([a-z0-9.-]+):([a-z0-9.-]+)`)
+
+// IRSASubjects returns the service accounts, as namespace/name, that the
+// plan's IAM roles trust through an OIDC provider. It reads the planned
+// assume_role_policy of aws_iam_role resources and the aws_iam_policy_document
+// data sources that build them, whether read during plan or deferred to
+// apply.
+func IRSASubjects(plan *tfjson.Plan) []string {
+	seen := map[string]bool{}
+	collect := func(v interface{}) {
+		walkStrings(v, func(s string) {
+			for _, m := range subjectRe.FindAllStringSubmatch(s, -1) {
+				seen[m[1]+"/"+m[2]] = true
+			}
+		})
+	}
+
+	for _, rc := range plan.ResourceChanges {
+		if rc.Change == nil || rc.Change.Actions.Delete() {
+			continue
+		}
+		switch {
+		case rc.Mode == tfjson.ManagedResourceMode && rc.Type == "aws_iam_role":
+			after, _ := rc.Change.After.(map[string]interface{})
+			collect(after["assume_role_policy"])
+		case rc.Mode == tfjson.DataResourceMode && rc.Type == "aws_iam_policy_document":
+			collect(rc.Change.After)
+		}
+	}
+	if plan.PriorState != nil && plan.PriorState.Values != nil {
+		var walk func(m *tfjson.StateModule)
+		walk = func(m *tfjson.StateModule) {
+			for _, r := range m.Resources {
+				if r.Mode == tfjson.DataResourceMode && r.Type == "aws_iam_policy_document" {
+					collect(r.AttributeValues)
+				}
+			}
+			for _, c := range m.ChildModules {
+				walk(c)
+			}
+		}
+		if plan.PriorState.Values.RootModule != nil {
+			walk(plan.PriorState.Values.RootModule)
+		}
+	}
+
+	out := make([]string, 0, len(seen))
+	for s := range seen {
+		out = append(out, s)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func walkStrings(v interface{}, fn func(string)) {
+	switch v := v.(type) {
+	case string:
+		fn(v)
+	case map[string]interface{}:
+		for _, item := range v {
+			walkStrings(item, fn)
+		}
+	case []interface{}:
+		for _, item := range v {
+			walkStrings(item, fn)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package helmcheck
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"sigs.k8s.io/yaml"
+)
+
+// Manifest is one rendered Kubernetes object.
+type Manifest struct {
+	// Source is the chart file the object came from, e.g.
+	// karpenter/templates/deployment.yaml.
+	Source string
+	Object map[string]interface{}
+}
+
+// APIVersion returns the object's apiVersion.
+func (m Manifest) APIVersion() string { s, _ := m.Object["apiVersion"].(string); return s }
+
+// Kind returns the object's kind.
+func (m Manifest) Kind() string { s, _ := m.Object["kind"].(string); return s }
+
+// Name returns metadata.name.
+func (m Manifest) Name() string { s, _ := m.metadata()["name"].(string); return s }
+
+// Namespace returns metadata.namespace, or "" if the chart leaves it to
+// the release namespace.
+func (m Manifest) Namespace() string { s, _ := m.metadata()["namespace"].(string); return s }
+
+// Annotations returns metadata.annotations.
+func (m Manifest) Annotations() map[string]interface{} {
+	a, _ := m.metadata()["annotations"].(map[string]interface{})
+	return a
+}
+
+func (m Manifest) metadata() map[string]interface{} {
+	md, _ := m.Object["metadata"].(map[string]interface{})
+	return md
+}
+
+// String identifies the object as Kind/name, e.g. Deployment/karpenter.
+func (m Manifest) String() string { return m.Kind() + "/" + m.Name() }
+
+// Render renders chart ch with r's values the way helm install would
+// against a cluster with caps, without contacting one. CRDs from the
+// chart's crds/ directory are included; NOTES.txt and partials are not.
+func Render(ch *chart.Chart, r Release, caps *chartutil.Capabilities) ([]Manifest, error) {
+	if c := ch.Metadata.KubeVersion; c != "" && !chartutil.IsCompatibleRange(c, caps.KubeVersion.String()) {
+		return nil, fmt.Errorf("chart %s requires kubeVersion %s, not %s", ch.Name(), c, caps.KubeVersion.String())
+	}
+	vals := chartutil.Values(deepCopy(r.Values))
+	if err := chartutil.ProcessDependenciesWithMerge(ch, vals); err != nil {
+		return nil, err
+	}
+	top, err := chartutil.ToRenderValues(ch, vals, chartutil.ReleaseOptions{
+		Name:      r.Name,
+		Namespace: r.Namespace,
+		Revision:  1,
+		IsInstall: true,
+	}, caps)
+	if err != nil {
+		return nil, err
+	}
+	files, err := engine.Render(ch, top)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Manifest
+	for _, crd := range ch.CRDObjects() {
+		ms, err := split(crd.Filename, string(crd.File.Data))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ms...)
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		if base := path.Base(name); strings.HasPrefix(base, "_") || base == "NOTES.txt" {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ms, err := split(name, files[name])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ms...)
+	}
+	return out, nil
+}
+
+// split decodes the YAML documents of one rendered file, skipping empty
+// ones.
+func split(source, content string) ([]Manifest, error) {
+	docs := releaseutil.SplitManifests(content)
+	keys := make([]string, 0, len(docs))
+	for k := range docs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return docIndex(keys[i]) < docIndex(keys[j]) })
+
+	var out []Manifest
+	for _, k := range keys {
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal([]byte(docs[k]), &obj); err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+		if len(obj) == 0 {
+			continue
+		}
+		out = append(out, Manifest{Source: source, Object: obj})
+	}
+	return out, nil
+}
+
+// docIndex orders SplitManifests keys ("manifest-10" after "manifest-9").
+func docIndex(key string) int {
+	n, _ := strconv.Atoi(strings.TrimPrefix(key, "manifest-"))
+	return n
+}
@@ -0,0 +1,293 @@
+package helmcheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// quantityDef is the definition of resource.Quantity, which the API
+// server accepts as a string or a number.
+const quantityDef = "io.k8s.apimachinery.pkg.api.resource.Quantity"
+
+// node is the subset of an OpenAPI v2 schema that Validate uses. Kept
+// fields are the ones PruneSpec writes to the vendored files.
+type node struct {
+	Type                 string           `json:"type,omitempty"`
+	Format               string           `json:"format,omitempty"`
+	Ref                  string           `json:"$ref,omitempty"`
+	Properties           map[string]*node `json:"properties,omitempty"`
+	AdditionalProperties *node            `json:"additionalProperties,omitempty"`
+	Items                *node            `json:"items,omitempty"`
+	Required             []string         `json:"required,omitempty"`
+	GVK                  []gvk            `json:"x-kubernetes-group-version-kind,omitempty"`
+}
+
+type gvk struct {
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+}
+
+// apiVersion renders the group and version as in a manifest, e.g. "v1"
+// or "apps/v1".
+func (g gvk) apiVersion() string {
+	if g.Group == "" {
+		return g.Version
+	}
+	return g.Group + "/" + g.Version
+}
+
+type spec struct {
+	Definitions map[string]*node `json:"definitions"`
+}
+
+// Schema holds the OpenAPI definitions of one Kubernetes minor version.
+type Schema struct {
+	// Version is the minor version, e.g. "1.29".
+	Version string
+	defs    map[string]*node
+	// kinds maps apiVersion/kind to a definition name.
+	kinds map[string]string
+}
+
+// MinorVersion normalises "v1.29", "1.29" or "1.29.3" to "1.29".
+func MinorVersion(v string) (string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(v, "v"), ".", 3)
+	if len(parts) < 2 {
+		return "", fmt.Errorf("kubernetes version %q is not MAJOR.MINOR", v)
+	}
+	for _, p := range parts[:2] {
+		if _, err := strconv.Atoi(p); err != nil {
+			return "", fmt.Errorf("kubernetes version %q is not MAJOR.MINOR", v)
+		}
+	}
+	return parts[0] + "." + parts[1], nil
+}
+
+// SchemaFile returns the vendored schema path for a minor version.
+func SchemaFile(dir, version string) string {
+	return filepath.Join(dir, "v"+version+".json")
+}
+
+// SchemaVersions lists the minor versions vendored in dir, oldest first.
+func SchemaVersions(dir string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "v*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, m := range matches {
+		v := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(m), "v"), ".json")
+		if _, err := MinorVersion(v); err == nil {
+			out = append(out, v)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return compareMinor(out[i], out[j]) < 0 })
+	return out, nil
+}
+
+// LoadSchema reads the vendored schema for version from dir.
+func LoadSchema(dir, version string) (*Schema, error) {
+	version, err := MinorVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(SchemaFile(dir, version))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no OpenAPI schema for Kubernetes %s in %s; run go run ./cmd/helmcheck schemas %s", version, dir, version)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sp spec
+	if err := json.Unmarshal(b, &sp); err != nil {
+		return nil, fmt.Errorf("%s: %w", SchemaFile(dir, version), err)
+	}
+	s := &Schema{Version: version, defs: sp.Definitions, kinds: map[string]string{}}
+	for name, d := range s.defs {
+		for _, g := range d.GVK {
+			s.kinds[g.apiVersion()+"/"+g.Kind] = name
+		}
+	}
+	if q, ok := s.defs[quantityDef]; ok {
+		q.Format = "quantity"
+	}
+	return s, nil
+}
+
+// PruneSpec reduces an upstream api/openapi-spec/swagger.json to the
+// definitions and fields Validate reads, dropping paths and descriptions.
+func PruneSpec(swagger []byte) ([]byte, error) {
+	var sp spec
+	if err := json.Unmarshal(swagger, &sp); err != nil {
+		return nil, err
+	}
+	if len(sp.Definitions) == 0 {
+		return nil, fmt.Errorf("no definitions in OpenAPI spec")
+	}
+	return json.MarshalIndent(sp, "", " ")
+}
+
+// APIVersions lists the API groups and kinds the version serves, for
+// .Capabilities.APIVersions in templates.
+func (s *Schema) APIVersions() chartutil.VersionSet {
+	seen := map[string]bool{}
+	var out chartutil.VersionSet
+	for k := range s.kinds {
+		gv := k[:strings.LastIndex(k, "/")]
+		for _, v := range []string{gv, k} {
+			if !seen[v] {
+				seen[v] = true
+				out = append(out, v)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Capabilities returns what templates see for a cluster at this version.
+func (s *Schema) Capabilities() *chartutil.Capabilities {
+	caps := chartutil.DefaultCapabilities.Copy()
+	major, minor, _ := strings.Cut(s.Version, ".")
+	caps.KubeVersion = chartutil.KubeVersion{Version: "v" + s.Version + ".0", Major: major, Minor: minor}
+	caps.APIVersions = s.APIVersions()
+	return caps
+}
+
+// Validate checks obj against the definition for its apiVersion and
+// kind. known is false when the version does not serve that kind, as for
+// custom resources; obj is then not checked.
+func (s *Schema) Validate(obj map[string]interface{}) (known bool, problems []string) {
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	name, ok := s.kinds[apiVersion+"/"+kind]
+	if !ok {
+		return false, nil
+	}
+	s.validate(s.defs[name], obj, "", &problems)
+	return true, problems
+}
+
+func (s *Schema) validate(n *node, v interface{}, path string, out *[]string) {
+	if n == nil || v == nil {
+		return
+	}
+	if n.Ref != "" {
+		s.validate(s.defs[strings.TrimPrefix(n.Ref, "#/definitions/")], v, path, out)
+		return
+	}
+	at := path
+	if at == "" {
+		at = "(root)"
+	}
+	mismatch := func(want string) {
+		*out = append(*out, fmt.Sprintf("%s: expected %s, got %s", at, want, jsonType(v)))
+	}
+
+	switch n.Type {
+	case "object", "":
+		if n.Type == "" && n.Properties == nil && n.AdditionalProperties == nil {
+			return // free-form, e.g. RawExtension or JSON
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			mismatch("object")
+			return
+		}
+		for _, req := range n.Required {
+			if _, ok := m[req]; !ok {
+				*out = append(*out, fmt.Sprintf("%s: missing required field %q", at, req))
+			}
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := k
+			if path != "" {
+				child = path + "." + k
+			}
+			switch {
+			case n.Properties[k] != nil:
+				s.validate(n.Properties[k], m[k], child, out)
+			case n.AdditionalProperties != nil:
+				s.validate(n.AdditionalProperties, m[k], child, out)
+			case n.Properties != nil:
+				*out = append(*out, fmt.Sprintf("%s: unknown field", child))
+			}
+		}
+	case "array":
+		list, ok := v.([]interface{})
+		if !ok {
+			mismatch("array")
+			return
+		}
+		for i, item := range list {
+			s.validate(n.Items, item, fmt.Sprintf("%s[%d]", path, i), out)
+		}
+	case "string":
+		if _, ok := v.(string); ok {
+			return
+		}
+		if f, ok := v.(float64); ok && (n.Format == "quantity" || n.Format == "int-or-string" && f == math.Trunc(f)) {
+			return
+		}
+		mismatch("string")
+	case "integer":
+		if f, ok := v.(float64); !ok || f != math.Trunc(f) {
+			mismatch("integer")
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			mismatch("number")
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			mismatch("boolean")
+		}
+	}
+}
+
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// compareMinor orders "1.9" before "1.28".
+func compareMinor(a, b string) int {
+	am, an := splitMinor(a)
+	bm, bn := splitMinor(b)
+	if am != bm {
+		return am - bm
+	}
+	return an - bn
+}
+
+func splitMinor(v string) (int, int) {
+	major, minor, _ := strings.Cut(v, ".")
+	m, _ := strconv.Atoi(major)
+	n, _ := strconv.Atoi(minor)
+	return m, n
+}
@@ -0,0 +1,3 @@
+{{- define "demo.serviceAccountName" -}}
+{{- default .Release.Name .Values.serviceAccount.name }}
+{{- end }}
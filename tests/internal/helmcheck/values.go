@@ -0,0 +1,188 @@
+// Package helmcheck renders the helm_release resources of a Terraform plan
+// offline and checks the resulting manifests before they reach a cluster:
+// against the Kubernetes OpenAPI schema of the targeted version, for
+// deprecated or removed APIs, and for IRSA annotations on the service
+// accounts the plan's IAM roles trust.
+package helmcheck
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"helm.sh/helm/v3/pkg/strvals"
+	"sigs.k8s.io/yaml"
+
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+)
+
+// UnknownValue stands in for set values that are only known after apply,
+// such as IAM role ARNs, so the chart still renders the field.
+const UnknownValue = "known-after-apply"
+
+// Release is a planned helm_release with the values Helm will receive.
+type Release struct {
+	// Address is the resource address, e.g. module.eks_addons.helm_release.karpenter[0].
+	Address    string
+	Name       string
+	Namespace  string
+	Repository string
+	Chart      string
+	Version    string
+	// Values merges the release's values documents, then applies its set,
+	// set_list and set_sensitive entries, the way the Helm provider does.
+	Values map[string]interface{}
+	// Unknown names the entries rendered as UnknownValue.
+	Unknown []string
+}
+
+// Releases returns the helm_release resources the plan creates or
+// updates, sorted by address.
+func Releases(plan *tfjson.Plan) ([]Release, error) {
+	unknown := map[string]map[string]interface{}{}
+	for _, rc := range plan.ResourceChanges {
+		if rc.Change != nil {
+			u, _ := rc.Change.AfterUnknown.(map[string]interface{})
+			unknown[rc.Address] = u
+		}
+	}
+
+	var out []Release
+	for _, r := range planjson.OfType(planjson.Resources(plan), "helm_release") {
+		for _, attr := range []string{"values", "set", "set_list", "set_sensitive"} {
+			if u, _ := unknown[r.Address][attr].(bool); u {
+				return nil, fmt.Errorf("%s: %s is unknown until apply", r.Address, attr)
+			}
+		}
+		rel, err := release(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.Address, err)
+		}
+		out = append(out, rel)
+	}
+	return out, nil
+}
+
+func release(r planjson.Resource) (Release, error) {
+	rel := Release{
+		Address:    r.Address,
+		Name:       planjson.String(r.Values, "name"),
+		Namespace:  planjson.String(r.Values, "namespace"),
+		Repository: planjson.String(r.Values, "repository"),
+		Chart:      planjson.String(r.Values, "chart"),
+		Version:    planjson.String(r.Values, "version"),
+		Values:     map[string]interface{}{},
+	}
+	if rel.Namespace == "" {
+		rel.Namespace = "default"
+	}
+
+	docs, _ := planjson.Get(r.Values, "values").([]interface{})
+	for i, doc := range docs {
+		s, ok := doc.(string)
+		if !ok {
+			rel.Unknown = append(rel.Unknown, fmt.Sprintf("values[%d]", i))
+			continue
+		}
+		var m map[string]interface{}
+		if err := yaml.Unmarshal([]byte(s), &m); err != nil {
+			return rel, fmt.Errorf("values[%d]: %w", i, err)
+		}
+		rel.Values = mergeMaps(rel.Values, m)
+	}
+
+	for _, attr := range []string{"set", "set_sensitive"} {
+		for _, s := range sortedBlocks(r.Values, attr) {
+			name := planjson.String(s, "name")
+			value, ok := s["value"].(string)
+			if !ok {
+				value = UnknownValue
+				rel.Unknown = append(rel.Unknown, name)
+			}
+			parse := strvals.ParseInto
+			if planjson.String(s, "type") == "string" {
+				parse = strvals.ParseIntoString
+			}
+			if err := parse(name+"="+value, rel.Values); err != nil {
+				return rel, fmt.Errorf("%s %q: %w", attr, name, err)
+			}
+		}
+	}
+	for _, s := range sortedBlocks(r.Values, "set_list") {
+		name := planjson.String(s, "name")
+		value := strings.Join(planjson.Strings(s, "value"), ",")
+		if err := strvals.ParseInto(name+"={"+value+"}", rel.Values); err != nil {
+			return rel, fmt.Errorf("set_list %q: %w", name, err)
+		}
+	}
+	sort.Strings(rel.Unknown)
+	return rel, nil
+}
+
+// sortedBlocks returns the set blocks at attr ordered by name. Terraform
+// orders set elements by hash, so sorting keeps the result stable.
+func sortedBlocks(values map[string]interface{}, attr string) []map[string]interface{} {
+	blocks := planjson.Blocks(values, attr)
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return planjson.String(blocks[i], "name") < planjson.String(blocks[j], "name")
+	})
+	return blocks
+}
+
+// mergeMaps deep-merges b into a copy of a, with b winning.
+func mergeMaps(a, b map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(a))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		if bv, ok := v.(map[string]interface{}); ok {
+			if av, ok := out[k].(map[string]interface{}); ok {
+				out[k] = mergeMaps(av, bv)
+				continue
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// deepCopy copies nested maps and lists so rendering cannot alter a
+// release's values.
+func deepCopy(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = copyValue(v)
+	}
+	return out
+}
+
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return deepCopy(v)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = copyValue(item)
+		}
+		return out
+	}
+	return v
+}
+
+// KubeVersion returns the Kubernetes minor version the plan targets: the
+// planned aws_eks_cluster version, or the kubernetes_version root variable.
+// It returns "" if the plan has neither.
+func KubeVersion(plan *tfjson.Plan) string {
+	for _, r := range planjson.OfType(planjson.Resources(plan), "aws_eks_cluster") {
+		if v := planjson.String(r.Values, "version"); v != "" {
+			return v
+		}
+	}
+	if v, ok := planjson.Variable(plan, "kubernetes_version").(string); ok {
+		return v
+	}
+	return ""
+}
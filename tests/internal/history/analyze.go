@@ -0,0 +1,368 @@
+package history
+
+import (
+	"sort"
+	"time"
+)
+
+// Status classifies a test's recent history.
+type Status string
+
+const (
+	// StatusStable tests only passed (or skipped) in the window.
+	StatusStable Status = "stable"
+	// StatusFlaky tests both passed and failed without a sustained failure
+	// streak.
+	StatusFlaky Status = "flaky"
+	// StatusBroken tests failed in every one of the last BrokenStreak runs,
+	// or in every run of the window.
+	StatusBroken Status = "broken"
+)
+
+// Options tune Analyze and Compare.
+type Options struct {
+	// Window limits analysis to the last N runs; 0 means all.
+	Window int
+	// BrokenStreak is how many consecutive trailing failures mark a test
+	// broken rather than flaky. Defaults to 3.
+	BrokenStreak int
+	// Slowdown is the fractional duration increase Compare reports, e.g.
+	// 0.5 for 50% slower. Defaults to 0.5.
+	Slowdown float64
+	// MinSlowdown ignores slowdowns smaller than this many seconds, which
+	// filters noise on short tests. Defaults to 60.
+	MinSlowdown float64
+}
+
+func (o Options) withDefaults() Options {
+	if o.BrokenStreak <= 0 {
+		o.BrokenStreak = 3
+	}
+	if o.Slowdown <= 0 {
+		o.Slowdown = 0.5
+	}
+	if o.MinSlowdown <= 0 {
+		o.MinSlowdown = 60
+	}
+	return o
+}
+
+// RunInfo summarises one run in the store.
+type RunInfo struct {
+	ID     string
+	Time   time.Time
+	Commit string
+	Tests  int
+	Failed int
+}
+
+// Runs lists the runs in recs, oldest first, ordered by their first record.
+func Runs(recs []Record) []RunInfo {
+	index := map[string]int{}
+	var runs []RunInfo
+	for _, r := range recs {
+		i, ok := index[r.RunID]
+		if !ok {
+			i = len(runs)
+			index[r.RunID] = i
+			runs = append(runs, RunInfo{ID: r.RunID, Time: r.Time, Commit: r.Commit})
+		}
+		if r.Time.Before(runs[i].Time) {
+			runs[i].Time = r.Time
+		}
+		runs[i].Tests++
+		if r.Outcome == OutcomeFail {
+			runs[i].Failed++
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].Time.Before(runs[j].Time) })
+	return runs
+}
+
+// Stats is the analysis of one test over the window.
+type Stats struct {
+	Package string
+	Test    string
+	Status  Status
+	Runs    int
+	Passes  int
+	Fails   int
+	Skips   int
+	// FailRate is Fails / (Passes + Fails).
+	FailRate float64
+	// FlipRate is the share of consecutive non-skipped runs whose outcome
+	// differs, the usual signal for flakiness: a broken test fails often
+	// but rarely flips.
+	FlipRate float64
+	// MixedCommits counts commits that both passed and failed the test, the
+	// strongest flakiness evidence since the code did not change.
+	MixedCommits   int
+	MedianDuration float64
+	// MedianPhases is the median seconds per phase across passing runs.
+	MedianPhases map[string]float64
+	// ErrorClasses counts failures per class.
+	ErrorClasses map[string]int
+	Last         Outcome
+}
+
+// Analyze computes per-test statistics over the last o.Window runs, sorted
+// with broken tests first, then flaky tests by flip rate.
+func Analyze(recs []Record, o Options) []Stats {
+	o = o.withDefaults()
+	recs = window(recs, o.Window)
+
+	byTest := map[string][]Record{}
+	var keys []string
+	for _, r := range recs {
+		if _, ok := byTest[r.Key()]; !ok {
+			keys = append(keys, r.Key())
+		}
+		byTest[r.Key()] = append(byTest[r.Key()], r)
+	}
+
+	out := make([]Stats, 0, len(keys))
+	for _, key := range keys {
+		out = append(out, analyzeTest(byTest[key], o))
+	}
+	rank := map[Status]int{StatusBroken: 0, StatusFlaky: 1, StatusStable: 2}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if rank[a.Status] != rank[b.Status] {
+			return rank[a.Status] < rank[b.Status]
+		}
+		if a.FlipRate != b.FlipRate {
+			return a.FlipRate > b.FlipRate
+		}
+		if a.Package != b.Package {
+			return a.Package < b.Package
+		}
+		return a.Test < b.Test
+	})
+	return out
+}
+
+func analyzeTest(recs []Record, o Options) Stats {
+	s := Stats{
+		Package:      recs[0].Package,
+		Test:         recs[0].Test,
+		Runs:         len(recs),
+		ErrorClasses: map[string]int{},
+	}
+	var durations []float64
+	phases := map[string][]float64{}
+	commits := map[string]map[Outcome]bool{}
+	var outcomes []Outcome
+
+	for _, r := range recs {
+		switch r.Outcome {
+		case OutcomePass:
+			s.Passes++
+			durations = append(durations, r.Duration)
+			for p, d := range r.Phases {
+				phases[p] = append(phases[p], d)
+			}
+		case OutcomeFail:
+			s.Fails++
+			s.ErrorClasses[r.ErrorClass]++
+		case OutcomeSkip:
+			s.Skips++
+			continue
+		}
+		outcomes = append(outcomes, r.Outcome)
+		if r.Commit != "" {
+			if commits[r.Commit] == nil {
+				commits[r.Commit] = map[Outcome]bool{}
+			}
+			commits[r.Commit][r.Outcome] = true
+		}
+	}
+	s.Last = recs[len(recs)-1].Outcome
+
+	if n := s.Passes + s.Fails; n > 0 {
+		s.FailRate = float64(s.Fails) / float64(n)
+	}
+	flips := 0
+	for i := 1; i < len(outcomes); i++ {
+		if outcomes[i] != outcomes[i-1] {
+			flips++
+		}
+	}
+	if len(outcomes) > 1 {
+		s.FlipRate = float64(flips) / float64(len(outcomes)-1)
+	}
+	for _, seen := range commits {
+		if seen[OutcomePass] && seen[OutcomeFail] {
+			s.MixedCommits++
+		}
+	}
+
+	// Durations of failing runs are cut short by the failure, so medians
+	// only use passing runs.
+	s.MedianDuration = median(durations)
+	if len(phases) > 0 {
+		s.MedianPhases = map[string]float64{}
+		for p, ds := range phases {
+			s.MedianPhases[p] = median(ds)
+		}
+	}
+
+	streak := 0
+	for i := len(outcomes) - 1; i >= 0 && outcomes[i] == OutcomeFail; i-- {
+		streak++
+	}
+	switch {
+	case s.Fails > 0 && (s.Passes == 0 || streak >= o.BrokenStreak):
+		s.Status = StatusBroken
+	case s.Fails > 0:
+		s.Status = StatusFlaky
+	default:
+		s.Status = StatusStable
+	}
+	return s
+}
+
+// window keeps the records of the last n runs.
+func window(recs []Record, n int) []Record {
+	runs := Runs(recs)
+	if n <= 0 || len(runs) <= n {
+		return recs
+	}
+	keep := map[string]bool{}
+	for _, r := range runs[len(runs)-n:] {
+		keep[r.ID] = true
+	}
+	var out []Record
+	for _, r := range recs {
+		if keep[r.RunID] {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func median(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	s := append([]float64(nil), xs...)
+	sort.Float64s(s)
+	mid := len(s) / 2
+	if len(s)%2 == 1 {
+		return s[mid]
+	}
+	return (s[mid-1] + s[mid]) / 2
+}
+
+// RegressionKind describes how a test changed between two runs.
+type RegressionKind string
+
+const (
+	// KindNewFailure tests passed in the base run and failed in the head run.
+	KindNewFailure RegressionKind = "new-failure"
+	// KindSlower tests passed in both runs but got slower beyond the
+	// Slowdown and MinSlowdown thresholds.
+	KindSlower RegressionKind = "slower"
+	// KindFixed tests failed in the base run and passed in the head run.
+	KindFixed RegressionKind = "fixed"
+	// KindMissing tests ran in the base run but not in the head run.
+	KindMissing RegressionKind = "missing"
+)
+
+// Regression is one test's change between two runs.
+type Regression struct {
+	Package      string
+	Test         string
+	Kind         RegressionKind
+	Base         Outcome
+	Head         Outcome
+	BaseDuration float64
+	HeadDuration float64
+	ErrorClass   string
+	Message      string
+	// Flaky is set when the test's history marks it flaky, so a new
+	// failure is less likely to be caused by the change.
+	Flaky bool
+}
+
+// IsRegression reports whether the change is a regression, as opposed to
+// a fix.
+func (r Regression) IsRegression() bool {
+	return r.Kind != KindFixed
+}
+
+// Compare reports tests whose outcome or duration changed from run base to
+// run head. Flakiness is taken from the history up to and including head.
+func Compare(recs []Record, base, head string, o Options) []Regression {
+	o = o.withDefaults()
+	baseRecs := map[string]Record{}
+	headRecs := map[string]Record{}
+	var upToHead []Record
+	headTime := time.Time{}
+	for _, r := range recs {
+		switch r.RunID {
+		case base:
+			baseRecs[r.Key()] = r
+		case head:
+			headRecs[r.Key()] = r
+			if r.Time.After(headTime) {
+				headTime = r.Time
+			}
+		}
+	}
+	for _, r := range recs {
+		if !r.Time.After(headTime) {
+			upToHead = append(upToHead, r)
+		}
+	}
+	flaky := map[string]bool{}
+	for _, s := range Analyze(upToHead, o) {
+		flaky[s.Package+" "+s.Test] = s.Status == StatusFlaky
+	}
+
+	var out []Regression
+	for key, b := range baseRecs {
+		h, ok := headRecs[key]
+		reg := Regression{Package: b.Package, Test: b.Test, Base: b.Outcome, BaseDuration: b.Duration, Flaky: flaky[key]}
+		if !ok {
+			if b.Outcome != OutcomeSkip {
+				reg.Kind = KindMissing
+				out = append(out, reg)
+			}
+			continue
+		}
+		reg.Head, reg.HeadDuration = h.Outcome, h.Duration
+		switch {
+		case b.Outcome == OutcomePass && h.Outcome == OutcomeFail:
+			reg.Kind = KindNewFailure
+			reg.ErrorClass, reg.Message = h.ErrorClass, h.Message
+		case b.Outcome == OutcomeFail && h.Outcome == OutcomePass:
+			reg.Kind = KindFixed
+		case b.Outcome == OutcomePass && h.Outcome == OutcomePass &&
+			h.Duration > b.Duration*(1+o.Slowdown) && h.Duration-b.Duration >= o.MinSlowdown:
+			reg.Kind = KindSlower
+		default:
+			continue
+		}
+		out = append(out, reg)
+	}
+	for key, h := range headRecs {
+		if _, ok := baseRecs[key]; !ok && h.Outcome == OutcomeFail {
+			out = append(out, Regression{
+				Package: h.Package, Test: h.Test, Kind: KindNewFailure,
+				Head: h.Outcome, HeadDuration: h.Duration,
+				ErrorClass: h.ErrorClass, Message: h.Message, Flaky: flaky[key],
+			})
+		}
+	}
+	kindRank := map[RegressionKind]int{KindNewFailure: 0, KindMissing: 1, KindSlower: 2, KindFixed: 3}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Kind != out[j].Kind {
+			return kindRank[out[i].Kind] < kindRank[out[j].Kind]
+		}
+		if out[i].Package != out[j].Package {
+			return out[i].Package < out[j].Package
+		}
+		return out[i].Test < out[j].Test
+	})
+	return out
+}
@@ -0,0 +1,156 @@
+package history_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/history"
+)
+
+const pkg = "github.com/yourorg/tf-modules/tests/aws"
+
+func TestFromTestEvents(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "run.jsonl"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	recs, err := history.FromTestEvents(f, history.Run{ID: "r1", Commit: "abc", Region: "us-east-1"})
+	require.NoError(t, err)
+	require.Len(t, recs, 4)
+
+	vpc := recs[0]
+	assert.Equal(t, "TestVpcHappyPath", vpc.Test)
+	assert.Equal(t, history.OutcomePass, vpc.Outcome)
+	assert.Equal(t, 217.0, vpc.Duration)
+	assert.Equal(t, "us-east-1", vpc.Region)
+	assert.Equal(t, map[string]float64{
+		history.PhaseInit:     20,
+		history.PhaseApply:    125, // apply output plus the gap before terraform output
+		history.PhaseValidate: 12,
+		history.PhaseDestroy:  60,
+	}, vpc.Phases)
+	assert.Empty(t, vpc.ErrorClass)
+
+	assert.Equal(t, history.OutcomeFail, recs[1].Outcome)
+	assert.Equal(t, "iam-propagation", recs[1].ErrorClass)
+
+	assert.Equal(t, history.OutcomeSkip, recs[2].Outcome)
+
+	timedOut := recs[3]
+	assert.Equal(t, history.OutcomeFail, timedOut.Outcome)
+	assert.Equal(t, "timeout", timedOut.ErrorClass)
+	assert.Equal(t, 1200.0, timedOut.Duration)
+}
+
+func TestClassify(t *testing.T) {
+	cases := map[string]string{
+		"Error: waiting for EKS Node Group: ThrottlingException: Rate exceeded":  "throttling",
+		"azurerm_kubernetes_cluster.this: Code=\"VMExtensionProvisioningError\"": "aks-provisioning",
+		"Error: creating EC2 Instance: VcpuLimitExceeded":                        "quota",
+		"Error Trace:\tvpc_test.go:40\n\tError: Not equal":                       "assertion",
+		"something else entirely":                                                history.ClassUnknown,
+	}
+	for out, want := range cases {
+		assert.Equal(t, want, history.Classify(out), out)
+	}
+}
+
+func rec(run string, day int, commit, test string, outcome history.Outcome, dur float64) history.Record {
+	return history.Record{
+		RunID: run, Time: time.Date(2026, 10, day, 0, 0, 0, 0, time.UTC), Commit: commit,
+		Package: pkg, Test: test, Outcome: outcome, Duration: dur,
+	}
+}
+
+func sampleHistory() []history.Record {
+	var recs []history.Record
+	flaky := []history.Outcome{"pass", "fail", "pass", "pass", "fail", "pass"}
+	broken := []history.Outcome{"pass", "pass", "pass", "fail", "fail", "fail"}
+	for i := range flaky {
+		run := string(rune('a' + i))
+		commit := "c1"
+		if i >= 3 {
+			commit = "c2"
+		}
+		recs = append(recs,
+			rec(run, i+1, commit, "TestAksSmokeTest", flaky[i], float64(600+i*10)),
+			rec(run, i+1, commit, "TestKms", broken[i], 100),
+			rec(run, i+1, commit, "TestVpc", history.OutcomePass, 200),
+		)
+	}
+	return recs
+}
+
+func TestAnalyze(t *testing.T) {
+	stats := history.Analyze(sampleHistory(), history.Options{})
+	require.Len(t, stats, 3)
+
+	assert.Equal(t, "TestKms", stats[0].Test)
+	assert.Equal(t, history.StatusBroken, stats[0].Status)
+
+	aks := stats[1]
+	assert.Equal(t, "TestAksSmokeTest", aks.Test)
+	assert.Equal(t, history.StatusFlaky, aks.Status)
+	assert.Equal(t, 4, aks.Passes)
+	assert.Equal(t, 2, aks.Fails)
+	assert.InDelta(t, 2.0/6, aks.FailRate, 1e-9)
+	assert.InDelta(t, 4.0/5, aks.FlipRate, 1e-9)
+	assert.Equal(t, 2, aks.MixedCommits)
+	assert.Equal(t, 625.0, aks.MedianDuration) // passes: 600, 620, 630, 650
+
+	assert.Equal(t, history.StatusStable, stats[2].Status)
+
+	// A window of the last two runs sees the AKS test fail then pass, and
+	// the KMS test failing throughout.
+	stats = history.Analyze(sampleHistory(), history.Options{Window: 2})
+	assert.Equal(t, 2, stats[0].Runs)
+	assert.Equal(t, history.StatusBroken, stats[0].Status)
+}
+
+func TestCompare(t *testing.T) {
+	recs := sampleHistory()
+	recs = append(recs, rec("g", 7, "c3", "TestAksSmokeTest", history.OutcomePass, 1000),
+		rec("g", 7, "c3", "TestKms", history.OutcomePass, 100))
+
+	regs := history.Compare(recs, "f", "g", history.Options{})
+	require.Len(t, regs, 3)
+	assert.Equal(t, history.KindMissing, regs[0].Kind)
+	assert.Equal(t, "TestVpc", regs[0].Test)
+	assert.Equal(t, history.KindSlower, regs[1].Kind)
+	assert.Equal(t, "TestAksSmokeTest", regs[1].Test)
+	assert.True(t, regs[1].Flaky)
+	assert.Equal(t, history.KindFixed, regs[2].Kind)
+	assert.False(t, regs[2].IsRegression())
+
+	regs = history.Compare(recs, "c", "d", history.Options{})
+	require.Len(t, regs, 1)
+	assert.Equal(t, history.KindNewFailure, regs[0].Kind)
+	assert.Equal(t, "TestKms", regs[0].Test)
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "runs.jsonl")
+	recs, err := history.Load(path)
+	require.NoError(t, err)
+	assert.Empty(t, recs)
+
+	all := sampleHistory()
+	require.NoError(t, history.Append(path, all[3:]))
+	require.NoError(t, history.Append(path, all[:3]))
+
+	loaded, err := history.Load(path)
+	require.NoError(t, err)
+	require.Len(t, loaded, len(all))
+	assert.Equal(t, "a", loaded[0].RunID, "records are ordered by time")
+
+	runs := history.Runs(loaded)
+	require.Len(t, runs, 6)
+	assert.Equal(t, "f", runs[5].ID)
+	assert.Equal(t, 3, runs[5].Tests)
+	assert.Equal(t, 1, runs[5].Failed)
+}
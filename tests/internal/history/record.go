@@ -0,0 +1,219 @@
+// Package history keeps a per-test record of harness runs in a JSONL store
+// and derives flakiness rates, median durations and run-to-run regressions
+// from it.
+package history
+
+import (
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yourorg/tf-modules/tests/internal/report"
+)
+
+// Outcome is a test's terminal result.
+type Outcome string
+
+const (
+	OutcomePass Outcome = "pass"
+	OutcomeFail Outcome = "fail"
+	OutcomeSkip Outcome = "skip"
+)
+
+// Phases tracked per test. Validate covers everything between apply and
+// destroy: terraform output calls and the test's own assertions.
+const (
+	PhaseInit     = "init"
+	PhaseApply    = "apply"
+	PhaseValidate = "validate"
+	PhaseDestroy  = "destroy"
+)
+
+// Record is one test's result in one run.
+type Record struct {
+	RunID    string    `json:"run_id"`
+	Time     time.Time `json:"time"`
+	Commit   string    `json:"commit,omitempty"`
+	Region   string    `json:"region,omitempty"`
+	Package  string    `json:"package"`
+	Test     string    `json:"test"`
+	Outcome  Outcome   `json:"outcome"`
+	Duration float64   `json:"duration_seconds"`
+	// Phases holds seconds spent per phase, for tests that drive terraform
+	// through Terratest.
+	Phases map[string]float64 `json:"phases,omitempty"`
+	// ErrorClass groups failures by likely cause, see Classify.
+	ErrorClass string `json:"error_class,omitempty"`
+	Message    string `json:"message,omitempty"`
+}
+
+// Key identifies a test across runs.
+func (r Record) Key() string {
+	return r.Package + " " + r.Test
+}
+
+// Run is the metadata shared by every record of one harness run.
+type Run struct {
+	ID     string
+	Commit string
+	Region string
+}
+
+var (
+	// commandRe matches Terratest's shell.RunCommand log line, e.g.
+	// "TestVpc 2026-10-01T10:00:01Z command.go:100: Running command terraform with args [apply -input=false]".
+	commandRe = regexp.MustCompile(`Running command terraform with args \[(\S+)`)
+	// terratestLineRe matches lines Terratest logs on behalf of a test,
+	// which includes the streamed terraform output.
+	terratestLineRe = regexp.MustCompile(`^\S+ \d{4}-\d\d-\d\dT\S+ [\w.-]+\.go:\d+: `)
+)
+
+// commandPhase maps terraform subcommands to phases.
+var commandPhase = map[string]string{
+	"init":     PhaseInit,
+	"apply":    PhaseApply,
+	"destroy":  PhaseDestroy,
+	"output":   PhaseValidate,
+	"show":     PhaseValidate,
+	"plan":     PhaseValidate,
+	"validate": PhaseValidate,
+}
+
+type testState struct {
+	rec     Record
+	output  strings.Builder
+	phase   string
+	applied bool
+	last    time.Time
+}
+
+// observe attributes the time since the previous output line to the
+// activity that produced this one.
+func (s *testState) observe(at time.Time, line string) {
+	prev := s.phase
+	if m := commandRe.FindStringSubmatch(line); m != nil {
+		// The gap before a command belongs to whatever ran before it.
+		s.credit(prev, at)
+		s.phase = commandPhase[m[1]]
+		if s.phase == PhaseApply {
+			s.applied = true
+		}
+		return
+	}
+	if !terratestLineRe.MatchString(line) && s.applied && s.phase != PhaseDestroy {
+		// Test code logging between apply and destroy: assertions.
+		s.phase = PhaseValidate
+	}
+	s.credit(s.phase, at)
+}
+
+func (s *testState) credit(phase string, at time.Time) {
+	if phase != "" && !s.last.IsZero() && at.After(s.last) {
+		if s.rec.Phases == nil {
+			s.rec.Phases = map[string]float64{}
+		}
+		s.rec.Phases[phase] += at.Sub(s.last).Seconds()
+	}
+	s.last = at
+}
+
+// FromTestEvents builds one record per test and subtest from `go test
+// -json` output. Tests without a terminal event (the binary timed out or
+// panicked) are recorded as failures.
+func FromTestEvents(r io.Reader, run Run) ([]Record, error) {
+	tests := map[string]*testState{}
+	var order []string
+	var end time.Time
+
+	err := report.ReadTestEvents(r, func(ev report.TestEvent) {
+		if ev.Time.After(end) {
+			end = ev.Time
+		}
+		if ev.Test == "" {
+			return
+		}
+		key := ev.Package + " " + ev.Test
+		s, ok := tests[key]
+		if !ok {
+			s = &testState{rec: Record{
+				RunID:   run.ID,
+				Time:    ev.Time,
+				Commit:  run.Commit,
+				Region:  run.Region,
+				Package: ev.Package,
+				Test:    ev.Test,
+			}, last: ev.Time}
+			tests[key] = s
+			order = append(order, key)
+		}
+		switch ev.Action {
+		case "output":
+			s.output.WriteString(ev.Output)
+			s.observe(ev.Time, strings.TrimRight(ev.Output, "\n"))
+		case "pass", "fail", "skip":
+			s.rec.Outcome = Outcome(ev.Action)
+			s.rec.Duration = ev.Elapsed
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Record, 0, len(order))
+	for _, key := range order {
+		s := tests[key]
+		if s.rec.Outcome == "" {
+			s.rec.Outcome = OutcomeFail
+			s.rec.Duration = end.Sub(s.rec.Time).Seconds()
+		}
+		if s.rec.Outcome == OutcomeFail {
+			text := s.output.String()
+			s.rec.ErrorClass = Classify(text)
+			s.rec.Message = report.FailureMessage(text)
+		}
+		out = append(out, s.rec)
+	}
+	return out, nil
+}
+
+// errorClasses is checked in order; the first match wins, so specific
+// cloud-side causes come before the generic timeout and assertion classes.
+var errorClasses = []struct {
+	class string
+	re    *regexp.Regexp
+}{
+	{"iam-propagation", regexp.MustCompile(`(?i)(role.*(cannot be assumed|is not authorized to perform: sts:AssumeRole)|InvalidParameterValue.*(role|instance profile)|The role defined for the function cannot be assumed|AccessDenied.*(AssumeRole|PassRole)|PrincipalNotFound|does not exist in the directory)`)},
+	{"throttling", regexp.MustCompile(`(?i)(Throttling|ThrottlingException|RequestLimitExceeded|TooManyRequests|Rate exceeded|StatusCode=429)`)},
+	{"quota", regexp.MustCompile(`(?i)(LimitExceeded|QuotaExceeded|InsufficientInstanceCapacity|SkuNotAvailable|OperationNotAllowed.*quota)`)},
+	{"aks-provisioning", regexp.MustCompile(`(?i)(azurerm_kubernetes_cluster.*(Failed|timeout)|ProvisioningState.*Failed|KubernetesAPICallFailed|VMExtensionProvisioningError|ControlPlaneAddOnsNotReady)`)},
+	{"eks-provisioning", regexp.MustCompile(`(?i)(aws_eks_(cluster|node_group).*(error|timeout)|NodeCreationFailure|Ec2SubnetInvalidConfiguration)`)},
+	{"conflict", regexp.MustCompile(`(?i)(AlreadyExists|already exists|ResourceInUse|DependencyViolation|Conflict: )`)},
+	{"timeout", regexp.MustCompile(`(?i)(test timed out|context deadline exceeded|timeout while waiting for state)`)},
+	{"assertion", regexp.MustCompile(`Error Trace:`)},
+}
+
+// ClassUnknown is the error class of failures matching no pattern.
+const ClassUnknown = "unknown"
+
+// Classify returns the error class for a failed test's output.
+func Classify(output string) string {
+	for _, c := range errorClasses {
+		if c.re.MatchString(output) {
+			return c.class
+		}
+	}
+	return ClassUnknown
+}
+
+// sortRecords orders records by time, then package and test, for stable
+// output regardless of store order.
+func sortRecords(recs []Record) {
+	sort.SliceStable(recs, func(i, j int) bool {
+		if !recs[i].Time.Equal(recs[j].Time) {
+			return recs[i].Time.Before(recs[j].Time)
+		}
+		return recs[i].Key() < recs[j].Key()
+	})
+}
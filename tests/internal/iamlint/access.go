@@ -0,0 +1,136 @@
+package iamlint
+
+import (
+	"strings"
+
+	"github.com/yourorg/tf-modules/tests/internal/iampolicy"
+)
+
+// awsManagedPrefix begins the ARN of every AWS managed policy.
+const awsManagedPrefix = "arn:aws:iam::aws:policy/"
+
+// Access levels of an action.
+const (
+	Read  = "read"
+	Write = "write"
+)
+
+// readVerbs begin the names of actions that only read, e.g.
+// ec2:DescribeInstances or s3:GetObject. Everything else is treated as a
+// write, including permission management and wildcards.
+var readVerbs = []string{
+	"BatchGet", "Describe", "Get", "List", "Lookup", "Query", "Scan",
+	"Search", "Select", "View",
+}
+
+// Access returns Read or Write for an action or action pattern. A pattern
+// is a read only if every action it can match is one: ec2:Describe* is,
+// ec2:* and ec2:*Tags are not.
+func Access(action string) string {
+	_, name, ok := strings.Cut(action, ":")
+	if !ok || strings.HasPrefix(name, "*") {
+		return Write
+	}
+	for _, verb := range readVerbs {
+		rest, found := strings.CutPrefix(name, verb)
+		if !found {
+			continue
+		}
+		// The verb must be a whole word: ListTags reads, a Listen action
+		// would not.
+		if rest == "" || rest[0] == '*' || (rest[0] >= 'A' && rest[0] <= 'Z') {
+			return Read
+		}
+	}
+	return Write
+}
+
+// Service returns the service prefix of an action, e.g. ec2.
+func Service(action string) string {
+	service, _, ok := strings.Cut(action, ":")
+	if !ok {
+		return "*"
+	}
+	return strings.ToLower(service)
+}
+
+// managed rates AWS managed policies broad enough to flag. Policies not
+// listed, such as ReadOnlyAccess or AmazonEKSWorkerNodePolicy, are not
+// reported.
+var managed = map[string]struct {
+	Severity string
+	Message  string
+}{
+	"AdministratorAccess": {Error, "grants every action on every resource"},
+	"IAMFullAccess":       {Error, "grants every IAM action, which is enough to grant itself anything"},
+	"PowerUserAccess":     {Warning, "grants every action outside IAM, Organizations and Account on every resource"},
+}
+
+// managedRating returns the severity and message for an AWS managed policy
+// ARN, rating *FullAccess policies not in managed as warnings. ok is false
+// when the policy is not flagged.
+func managedRating(arn string) (severity, message string, ok bool) {
+	name := arn[strings.LastIndex(arn, "/")+1:]
+	if m, found := managed[name]; found {
+		return m.Severity, m.Message, true
+	}
+	if strings.HasSuffix(name, "FullAccess") {
+		return Warning, "grants every action of its service on every resource", true
+	}
+	return "", "", false
+}
+
+// escalation is a set of actions that together let a role raise its own
+// privileges, after Rhino Security Labs' catalogue of IAM privilege
+// escalation methods.
+type escalation struct {
+	Actions []string
+	How     string
+}
+
+var escalations = []escalation{
+	{[]string{"iam:CreatePolicyVersion"}, "can publish a new default version of a policy it is attached to"},
+	{[]string{"iam:SetDefaultPolicyVersion"}, "can switch a policy it is attached to back to a broader version"},
+	{[]string{"iam:AttachRolePolicy"}, "can attach any managed policy to a role"},
+	{[]string{"iam:AttachUserPolicy"}, "can attach any managed policy to a user"},
+	{[]string{"iam:AttachGroupPolicy"}, "can attach any managed policy to a group"},
+	{[]string{"iam:PutRolePolicy"}, "can write an inline policy on a role"},
+	{[]string{"iam:PutUserPolicy"}, "can write an inline policy on a user"},
+	{[]string{"iam:PutGroupPolicy"}, "can write an inline policy on a group"},
+	{[]string{"iam:AddUserToGroup"}, "can join a more privileged group"},
+	{[]string{"iam:CreateAccessKey"}, "can mint access keys for other users"},
+	{[]string{"iam:CreateLoginProfile"}, "can set a console password for other users"},
+	{[]string{"iam:UpdateLoginProfile"}, "can reset other users' console passwords"},
+	{[]string{"iam:UpdateAssumeRolePolicy"}, "can make any role trust it"},
+	{[]string{"lambda:UpdateFunctionCode"}, "can run its own code as any function's role"},
+	{[]string{"glue:UpdateDevEndpoint"}, "can log in to any Glue endpoint and use its role"},
+	{[]string{"iam:PassRole", "ec2:RunInstances"}, "can launch an instance with any role and use its credentials"},
+	{[]string{"iam:PassRole", "lambda:CreateFunction", "lambda:InvokeFunction"}, "can run its own code as any role"},
+	{[]string{"iam:PassRole", "lambda:CreateFunction", "lambda:CreateEventSourceMapping"}, "can run its own code as any role"},
+	{[]string{"iam:PassRole", "ecs:RegisterTaskDefinition", "ecs:RunTask"}, "can run a task as any role"},
+	{[]string{"iam:PassRole", "cloudformation:CreateStack"}, "can have CloudFormation create resources as any role"},
+	{[]string{"iam:PassRole", "glue:CreateDevEndpoint"}, "can create a Glue endpoint with any role"},
+	{[]string{"iam:PassRole", "datapipeline:CreatePipeline", "datapipeline:PutPipelineDefinition"}, "can run a pipeline as any role"},
+}
+
+// allows reports whether s allows action, whatever its resources and
+// conditions.
+func allows(s iampolicy.Statement, action string) bool {
+	if !s.Allow() {
+		return false
+	}
+	if len(s.NotActions) > 0 {
+		for _, a := range s.NotActions {
+			if iampolicy.MatchAction(a, action) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, a := range s.Actions {
+		if iampolicy.MatchAction(a, action) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+// Package iamlint collects the permission policies a Terraform plan grants
+// to IAM roles, flags statements that are broader than they need to be,
+// and renders a per-role permission summary that can be diffed between
+// module versions.
+package iamlint
+
+import (
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/yourorg/tf-modules/tests/internal/iampolicy"
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+)
+
+// Grant is one policy attached to a role.
+type Grant struct {
+	// Address is the resource that grants the policy: an
+	// aws_iam_role_policy, an aws_iam_role_policy_attachment, or the role
+	// itself for inline_policy blocks.
+	Address string
+	// Name is the inline policy name or the attached policy ARN; "" when
+	// not known until apply.
+	Name string
+	// Managed is true for AWS managed policies, which the plan does not
+	// carry a document for.
+	Managed bool
+	// Policy is nil for AWS managed policies and when the document cannot
+	// be resolved.
+	Policy *iampolicy.Policy
+	// Source is where Policy came from: the planned attribute, the address
+	// of the aws_iam_policy_document or aws_iam_policy it references, or
+	// the .tf file it was evaluated from.
+	Source string
+}
+
+// Role is a planned aws_iam_role and the policies granted to it.
+type Role struct {
+	Address string
+	// Name is the planned role name, "" if it is not known until apply.
+	Name   string
+	Grants []Grant
+}
+
+// Collect returns every planned role with its inline policies, inline
+// policy resources and policy attachments. Policy JSON that is unknown at
+// plan time is read from the aws_iam_policy_document it references or,
+// when dir is set, evaluated from the module source under dir, the
+// directory the plan was made in.
+func Collect(plan *tfjson.Plan, dir string) ([]Role, error) {
+	resources := planjson.Resources(plan)
+	docs := iampolicy.Documents(plan)
+	src := newSource(plan, dir)
+
+	var roles []*Role
+	byAddress := map[string]*Role{}
+	byName := map[string]*Role{}
+	for _, r := range planjson.OfType(resources, "aws_iam_role") {
+		role := &Role{Address: r.Address, Name: planjson.String(r.Values, "name")}
+		for _, b := range planjson.Blocks(r.Values, "inline_policy") {
+			g := Grant{Address: r.Address, Name: planjson.String(b, "name")}
+			if doc := planjson.String(b, "policy"); doc != "" {
+				p, err := iampolicy.Parse(doc)
+				if err != nil {
+					return nil, err
+				}
+				g.Policy, g.Source = p, "inline_policy"
+			}
+			role.Grants = append(role.Grants, g)
+		}
+		roles = append(roles, role)
+		byAddress[r.Address] = role
+		if role.Name != "" {
+			byName[role.Name] = role
+		}
+	}
+
+	policies := map[string]planjson.Resource{}
+	for _, r := range planjson.OfType(resources, "aws_iam_policy") {
+		policies[r.Address] = r
+	}
+
+	// owner finds the role a policy or attachment's role argument points
+	// at, by reference or, failing that, by planned name.
+	owner := func(r planjson.Resource) *Role {
+		for _, ref := range planjson.References(plan, r, "role") {
+			if role, ok := byAddress[qualify(r, ref)]; ok {
+				return role
+			}
+		}
+		return byName[planjson.String(r.Values, "role")]
+	}
+
+	for _, r := range planjson.OfType(resources, "aws_iam_role_policy") {
+		role := owner(r)
+		if role == nil {
+			continue
+		}
+		g := Grant{Address: r.Address, Name: planjson.String(r.Values, "name")}
+		p, source, err := iampolicy.Resolve(plan, r, "policy", docs)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			p, source = src.policy(r, "policy")
+		}
+		g.Policy, g.Source = p, source
+		role.Grants = append(role.Grants, g)
+	}
+
+	for _, r := range planjson.OfType(resources, "aws_iam_role_policy_attachment") {
+		role := owner(r)
+		if role == nil {
+			continue
+		}
+		g := Grant{Address: r.Address, Name: planjson.String(r.Values, "policy_arn")}
+		if strings.HasPrefix(g.Name, awsManagedPrefix) {
+			g.Managed = true
+			role.Grants = append(role.Grants, g)
+			continue
+		}
+		for _, ref := range planjson.References(plan, r, "policy_arn") {
+			pr, ok := policies[qualify(r, ref)]
+			if !ok {
+				continue
+			}
+			if g.Name == "" {
+				g.Name = planjson.String(pr.Values, "arn")
+			}
+			if g.Name == "" {
+				g.Name = pr.Address
+			}
+			p, source, err := iampolicy.Resolve(plan, pr, "policy", docs)
+			if err != nil {
+				return nil, err
+			}
+			if p == nil {
+				p, source = src.policy(pr, "policy")
+			} else if source == "policy" {
+				source = pr.Address
+			}
+			g.Policy, g.Source = p, source
+			break
+		}
+		role.Grants = append(role.Grants, g)
+	}
+
+	out := make([]Role, 0, len(roles))
+	for _, role := range roles {
+		sort.SliceStable(role.Grants, func(i, j int) bool { return role.Grants[i].Address < role.Grants[j].Address })
+		out = append(out, *role)
+	}
+	return out, nil
+}
+
+// qualify turns a reference made in r's module into a full address,
+// dropping the attribute: aws_iam_role.this[0].id in module.eks becomes
+// module.eks.aws_iam_role.this[0].
+func qualify(r planjson.Resource, ref string) string {
+	parts := strings.SplitN(ref, ".", 3)
+	if len(parts) < 2 {
+		return ""
+	}
+	addr := parts[0] + "." + parts[1]
+	if r.ModuleAddress != "" {
+		addr = r.ModuleAddress + "." + addr
+	}
+	return addr
+}
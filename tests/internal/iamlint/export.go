@@ -0,0 +1,52 @@
+package iamlint
+
+import (
+	"github.com/yourorg/tf-modules/tests/internal/report"
+)
+
+// checks describes each Finding.Check for SARIF and JUnit output.
+var checks = []report.Rule{
+	{ID: "action-wildcard", ShortDescription: "Statements do not allow every action of AWS or a service"},
+	{ID: "write-any-resource", ShortDescription: "Writes on any resource carry a condition"},
+	{ID: "passrole-unconditioned", ShortDescription: "iam:PassRole is limited by iam:PassedToService or iam:AssociatedResourceArn"},
+	{ID: "privilege-escalation", ShortDescription: "A role's combined permissions cannot escalate its privileges"},
+	{ID: "managed-broad", ShortDescription: "Roles do not attach broad AWS managed policies"},
+	{ID: "unresolved", ShortDescription: "Every policy is known at plan time or from the module source"},
+}
+
+// ReportRules describes the checks Lint performs for SARIF and JUnit output.
+func ReportRules() []report.Rule {
+	out := make([]report.Rule, len(checks))
+	for i, c := range checks {
+		c.Name = c.ID
+		c.HelpURI = "docs/testing.md"
+		out[i] = c
+	}
+	return out
+}
+
+// ReportFindings converts findings for SARIF and JUnit output. Each finding
+// is reported on its policy resource, or on the role for combined
+// permissions, and resolved to that block through idx when it is non-nil.
+func ReportFindings(findings []Finding, idx *report.SourceIndex) []report.Finding {
+	out := make([]report.Finding, 0, len(findings))
+	for _, f := range findings {
+		rf := report.Finding{
+			RuleID:  f.Check,
+			Level:   report.LevelWarning,
+			Message: f.Message,
+			Address: f.Grant,
+		}
+		if f.Severity == Error {
+			rf.Level = report.LevelError
+		}
+		if rf.Address == "" {
+			rf.Address = f.Role
+		}
+		if idx != nil {
+			rf.Location = idx.Locate(rf.Address, "")
+		}
+		out = append(out, rf)
+	}
+	return out
+}
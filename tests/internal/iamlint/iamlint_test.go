@@ -0,0 +1,166 @@
+package iamlint_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/iamlint"
+	"github.com/yourorg/tf-modules/tests/internal/iampolicy"
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+	"github.com/yourorg/tf-modules/tests/internal/report"
+)
+
+func collect(t *testing.T, dir string) []iamlint.Role {
+	t.Helper()
+	plan, err := planjson.Load("testdata/plan.json")
+	require.NoError(t, err)
+	roles, err := iamlint.Collect(plan, dir)
+	require.NoError(t, err)
+	return roles
+}
+
+func TestCollect(t *testing.T) {
+	got := map[string]string{}
+	for _, r := range collect(t, "testdata/root") {
+		for _, g := range r.Grants {
+			got[g.Address] = r.Address + " <- " + g.Source
+		}
+	}
+	assert.Equal(t, map[string]string{
+		// Attached by planned role name rather than reference.
+		"aws_iam_role_policy_attachment.apply_power_user":                "aws_iam_role.apply <- ",
+		"aws_iam_role.break_glass":                                       "aws_iam_role.break_glass <- inline_policy",
+		"aws_iam_role.deployer":                                          "aws_iam_role.deployer <- inline_policy",
+		"aws_iam_role_policy_attachment.deployer":                        "aws_iam_role.deployer <- aws_iam_policy.deployer",
+		"aws_iam_role_policy_attachment.deployer_legacy":                 "aws_iam_role.deployer <- ",
+		"module.addons.aws_iam_role_policy_attachment.alb_controller[0]": "module.addons.aws_iam_role.alb_controller[0] <- ",
+		"module.addons.aws_iam_role_policy.cert_manager[0]":              "module.addons.aws_iam_role.cert_manager[0] <- module.addons.data.aws_iam_policy_document.cert_manager[0]",
+		// The queue ARN leaves the JSON unknown; the rest comes from source.
+		"module.addons.aws_iam_role_policy.karpenter[0]":       "module.addons.aws_iam_role.karpenter[0] <- eks-addons/karpenter.tf",
+		"module.eks.aws_iam_role_policy.cluster_autoscaler[0]": "module.eks.aws_iam_role.cluster_autoscaler[0] <- policy",
+		"module.eks.aws_iam_role_policy.velero[0]":             "module.eks.aws_iam_role.velero[0] <- policy",
+	}, got)
+}
+
+func checks(findings []iamlint.Finding) []string {
+	var out []string
+	for _, f := range findings {
+		out = append(out, f.Severity+" "+f.Role+" "+f.Check)
+	}
+	return out
+}
+
+func TestLint(t *testing.T) {
+	findings := iamlint.Lint(collect(t, "testdata/root"))
+	assert.Equal(t, []string{
+		"warning aws_iam_role.apply managed-broad",
+		"error aws_iam_role.break_glass action-wildcard",
+		"warning aws_iam_role.deployer write-any-resource",
+		"error aws_iam_role.deployer passrole-unconditioned",
+		"warning aws_iam_role.deployer action-wildcard",
+		"warning aws_iam_role.deployer unresolved",
+		"error aws_iam_role.deployer privilege-escalation",
+		"warning module.addons.aws_iam_role.alb_controller[0] managed-broad",
+		"warning module.addons.aws_iam_role.karpenter[0] write-any-resource",
+		"error module.addons.aws_iam_role.karpenter[0] privilege-escalation",
+		"warning module.eks.aws_iam_role.velero[0] write-any-resource",
+	}, checks(findings))
+
+	// A PassedToService condition does not stop Karpenter passing any role
+	// to the instances it launches.
+	assert.Equal(t, "iam:PassRole (karpenter/PassNodeRole) + ec2:RunInstances (karpenter/EC2NodeManagement): can launch an instance with any role and use its credentials",
+		findings[9].Message)
+
+	// Without -dir the Karpenter policy stays unknown.
+	var karpenter []string
+	for _, f := range iamlint.Lint(collect(t, "")) {
+		if f.Role == "module.addons.aws_iam_role.karpenter[0]" {
+			karpenter = append(karpenter, f.Check)
+		}
+	}
+	assert.Equal(t, []string{"unresolved"}, karpenter)
+}
+
+func TestReportFindings(t *testing.T) {
+	findings := iamlint.Lint(collect(t, "testdata/root"))
+	out := iamlint.ReportFindings(findings, nil)
+	require.Len(t, out, len(findings))
+
+	levels := map[report.Level]int{}
+	for _, f := range out {
+		levels[f.Level]++
+	}
+	assert.Equal(t, map[report.Level]int{report.LevelError: 4, report.LevelWarning: 7}, levels)
+	assert.Equal(t, "aws_iam_role.deployer", out[6].Address, "escalation is reported on the role")
+	assert.NotEqual(t, "aws_iam_role.deployer", out[3].Address, "grant findings are reported on the policy")
+
+	ids := map[string]bool{}
+	for _, r := range iamlint.ReportRules() {
+		ids[r.ID] = true
+	}
+	for _, f := range out {
+		assert.True(t, ids[f.RuleID], "rule %s should be described", f.RuleID)
+	}
+}
+
+func TestLintDeny(t *testing.T) {
+	p, err := iampolicy.Parse(`{"Statement": [
+		{"Effect": "Allow", "Action": ["iam:PassRole", "ec2:RunInstances"], "Resource": "*",
+		 "Condition": {"StringEquals": {"iam:PassedToService": "ec2.amazonaws.com"}}},
+		{"Effect": "Deny", "Action": "iam:PassRole", "Resource": "*"}
+	]}`)
+	require.NoError(t, err)
+	role := iamlint.Role{Address: "aws_iam_role.x", Grants: []iamlint.Grant{{Address: "aws_iam_role_policy.x", Policy: p}}}
+	// The condition keeps passrole-unconditioned quiet and the Deny
+	// removes the escalation.
+	assert.Empty(t, iamlint.Lint([]iamlint.Role{role}))
+}
+
+func TestSummary(t *testing.T) {
+	var got []string
+	for _, p := range iamlint.Summary(collect(t, "testdata/root")) {
+		if p.Role == "module.addons.aws_iam_role.karpenter[0]" && p.Service != "ec2" {
+			got = append(got, p.String())
+		}
+	}
+	const role = "module.addons.aws_iam_role.karpenter[0]\t"
+	assert.Equal(t, []string{
+		role + "eks\tread\tallow\teks:DescribeCluster\t*",
+		role + "iam\twrite\tallow\tiam:PassRole\t*\tif StringEquals iam:PassedToService=ec2.amazonaws.com",
+		role + "sqs\tread\tallow\tsqs:GetQueueAttributes\t" + iampolicy.UnknownValue,
+		role + "sqs\tread\tallow\tsqs:GetQueueUrl\t" + iampolicy.UnknownValue,
+		role + "sqs\twrite\tallow\tsqs:DeleteMessage\t" + iampolicy.UnknownValue,
+		role + "sqs\twrite\tallow\tsqs:ReceiveMessage\t" + iampolicy.UnknownValue,
+		role + "ssm\tread\tallow\tssm:GetParameter\tarn:aws:ssm:*:*:parameter/aws/service/eks/optimized-ami/*",
+	}, got)
+
+	var managed []string
+	for _, p := range iamlint.Summary(collect(t, "")) {
+		if p.Access == "managed" {
+			managed = append(managed, p.Role+" "+p.Action)
+		}
+	}
+	assert.Equal(t, []string{
+		"aws_iam_role.apply arn:aws:iam::aws:policy/PowerUserAccess",
+		"module.addons.aws_iam_role.alb_controller[0] arn:aws:iam::aws:policy/ElasticLoadBalancingFullAccess",
+	}, managed)
+}
+
+func TestAccess(t *testing.T) {
+	for action, want := range map[string]string{
+		"ec2:DescribeInstances": iamlint.Read,
+		"ec2:Describe*":         iamlint.Read,
+		"s3:ListBucket":         iamlint.Read,
+		"dynamodb:BatchGetItem": iamlint.Read,
+		"ec2:RunInstances":      iamlint.Write,
+		"ec2:*":                 iamlint.Write,
+		"*":                     iamlint.Write,
+		"iam:PassRole":          iamlint.Write,
+		"codebuild:Listener":    iamlint.Write,
+		"sqs:ReceiveMessage":    iamlint.Write,
+	} {
+		assert.Equal(t, want, iamlint.Access(action), action)
+	}
+}
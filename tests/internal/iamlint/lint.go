@@ -0,0 +1,217 @@
+package iamlint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/yourorg/tf-modules/tests/internal/iampolicy"
+)
+
+// Severities of a Finding. Errors fail cmd/iamlint; warnings are reported
+// for review.
+const (
+	Error   = "error"
+	Warning = "warning"
+)
+
+// passRoleConditions are the keys that limit what iam:PassRole can pass a
+// role to.
+var passRoleConditions = []string{"iam:PassedToService", "iam:AssociatedResourceArn"}
+
+// Finding is a permission problem on one role.
+type Finding struct {
+	Role string `json:"role"`
+	// Grant is the address of the policy resource, "" for findings on the
+	// role's combined permissions.
+	Grant string `json:"grant,omitempty"`
+	// Check is action-wildcard, write-any-resource, passrole-unconditioned,
+	// privilege-escalation, managed-broad or unresolved.
+	Check    string `json:"check"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func (f Finding) Error() string {
+	return f.Role + ": " + f.Check + ": " + f.Message
+}
+
+// Lint checks each role's grants statement by statement, then its combined
+// permissions for privilege escalation. AWS managed policies are rated by
+// name; their documents are not in the plan and are left out of the
+// escalation check, as are roles already allowed every action.
+func Lint(roles []Role) []Finding {
+	var out []Finding
+	for _, role := range roles {
+		for _, g := range role.Grants {
+			out = append(out, lintGrant(role, g)...)
+		}
+		out = append(out, lintEscalation(role)...)
+	}
+	return out
+}
+
+func lintGrant(role Role, g Grant) []Finding {
+	var out []Finding
+	add := func(severity, check, format string, args ...interface{}) {
+		out = append(out, Finding{Role: role.Address, Grant: g.Address, Check: check, Severity: severity,
+			Message: fmt.Sprintf(format, args...)})
+	}
+	switch {
+	case g.Managed:
+		if severity, message, ok := managedRating(g.Name); ok {
+			add(severity, "managed-broad", "%s %s", g.Name[strings.LastIndex(g.Name, "/")+1:], message)
+		}
+		return out
+	case g.Policy == nil:
+		add(Warning, "unresolved", "%s: policy is not known until apply; pass -dir to evaluate it from the module source", grantName(g))
+		return out
+	}
+
+	for i, s := range g.Policy.Statements {
+		if !s.Allow() {
+			continue
+		}
+		id := s.ID(i)
+		if len(s.NotActions) > 0 {
+			add(Error, "action-wildcard", "%s: Allow with NotAction grants every action except %s", id, strings.Join(s.NotActions, ", "))
+			continue
+		}
+		wildcard := false
+		for _, a := range s.Actions {
+			switch {
+			case a == "*":
+				add(Error, "action-wildcard", "%s: Action \"*\" grants every action", id)
+				wildcard = true
+			case strings.HasSuffix(a, ":*"):
+				add(Warning, "action-wildcard", "%s: %s grants every %s action", id, a, Service(a))
+			}
+		}
+		if wildcard {
+			continue
+		}
+
+		anyResource := false
+		for _, r := range s.Resources {
+			anyResource = anyResource || r == "*"
+		}
+		if len(s.NotResources) > 0 {
+			anyResource = true
+		}
+		if anyResource && len(s.Conditions) == 0 {
+			var writes []string
+			for _, a := range s.Actions {
+				if Access(a) == Write && !iampolicy.MatchAction(a, "iam:PassRole") {
+					writes = append(writes, a)
+				}
+			}
+			if len(writes) > 0 {
+				add(Warning, "write-any-resource", "%s: %s on any resource without a condition", id, strings.Join(writes, ", "))
+			}
+		}
+
+		if allows(s, "iam:PassRole") {
+			scoped := false
+			for _, key := range passRoleConditions {
+				scoped = scoped || s.HasCondition(key)
+			}
+			if !scoped {
+				severity := Warning
+				if anyResource || hasWildcard(s.Resources) {
+					severity = Error
+				}
+				add(severity, "passrole-unconditioned", "%s: iam:PassRole without an iam:PassedToService or iam:AssociatedResourceArn condition", id)
+			}
+		}
+	}
+	return out
+}
+
+// lintEscalation reports each escalation whose actions the role's policy
+// documents allow between them, naming the statements that allow each.
+func lintEscalation(role Role) []Finding {
+	for _, g := range role.Grants {
+		if g.Policy == nil {
+			continue
+		}
+		for _, s := range g.Policy.Statements {
+			if s.Allow() && len(s.NotActions) == 0 && allows(s, "*") {
+				return nil
+			}
+		}
+	}
+	var out []Finding
+	for _, e := range escalations {
+		var via []string
+		for _, action := range e.Actions {
+			if denied(role, action) {
+				via = nil
+				break
+			}
+			var grantedBy []string
+			for _, g := range role.Grants {
+				if g.Policy == nil {
+					continue
+				}
+				for i, s := range g.Policy.Statements {
+					if allows(s, action) {
+						grantedBy = append(grantedBy, grantName(g)+"/"+s.ID(i))
+					}
+				}
+			}
+			if len(grantedBy) == 0 {
+				via = nil
+				break
+			}
+			sort.Strings(grantedBy)
+			via = append(via, fmt.Sprintf("%s (%s)", action, strings.Join(grantedBy, ", ")))
+		}
+		if via != nil {
+			out = append(out, Finding{Role: role.Address, Check: "privilege-escalation", Severity: Error,
+				Message: fmt.Sprintf("%s: %s", strings.Join(via, " + "), e.How)})
+		}
+	}
+	return out
+}
+
+// denied reports whether any of the role's policies denies action outright,
+// on any resource and without conditions.
+func denied(role Role, action string) bool {
+	for _, g := range role.Grants {
+		if g.Policy == nil {
+			continue
+		}
+		for _, s := range g.Policy.Statements {
+			if s.Allow() || len(s.Conditions) > 0 || len(s.NotActions) > 0 || len(s.NotResources) > 0 {
+				continue
+			}
+			matched, anyResource := false, false
+			for _, a := range s.Actions {
+				matched = matched || iampolicy.MatchAction(a, action)
+			}
+			for _, r := range s.Resources {
+				anyResource = anyResource || r == "*"
+			}
+			if matched && anyResource {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func grantName(g Grant) string {
+	if g.Name != "" {
+		return g.Name
+	}
+	return g.Address
+}
+
+func hasWildcard(resources []string) bool {
+	for _, r := range resources {
+		if strings.Contains(r, "*") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package iamlint
+
+import (
+	"path/filepath"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+
+	"github.com/yourorg/tf-modules/tests/internal/iampolicy"
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+	"github.com/yourorg/tf-modules/tests/internal/tfconfig"
+)
+
+// source reads policy expressions from module source for policies whose
+// JSON the plan leaves unknown, typically a jsonencode() that mentions the
+// ARN of a queue or bucket created in the same plan.
+type source struct {
+	plan    *tfjson.Plan
+	dir     string
+	modules map[string][]*hclsyntax.Body
+}
+
+func newSource(plan *tfjson.Plan, dir string) *source {
+	return &source{plan: plan, dir: dir, modules: map[string][]*hclsyntax.Body{}}
+}
+
+// functions are the Terraform functions policy expressions in this repo
+// use; a policy that calls anything else stays unresolved.
+var functions = map[string]function.Function{
+	"concat":   stdlib.ConcatFunc,
+	"distinct": stdlib.DistinctFunc,
+	"flatten":  stdlib.FlattenFunc,
+	"format":   stdlib.FormatFunc,
+	"join":     stdlib.JoinFunc,
+	"length":   stdlib.LengthFunc,
+	"lower":    stdlib.LowerFunc,
+	"merge":    stdlib.MergeFunc,
+	"replace":  stdlib.ReplaceFunc,
+	"upper":    stdlib.UpperFunc,
+}
+
+// policy evaluates the argument of jsonencode() in attribute attr of r's
+// resource block, with every variable, local and resource reference
+// unknown. It returns nil when dir is unset, the block cannot be found or
+// the expression is not a jsonencode() call it can evaluate.
+func (s *source) policy(r planjson.Resource, attr string) (*iampolicy.Policy, string) {
+	if s.dir == "" {
+		return nil, ""
+	}
+	dir, ok := planjson.ModuleDir(s.plan, s.dir, r.ModuleAddress)
+	if !ok {
+		return nil, ""
+	}
+	bodies, ok := s.modules[dir]
+	if !ok {
+		if root, err := tfconfig.Load(dir); err == nil {
+			bodies = root.Bodies
+		}
+		s.modules[dir] = bodies
+	}
+
+	for _, b := range tfconfig.Blocks(bodies, "resource") {
+		if len(b.Labels) != 2 || b.Labels[0] != r.Type || b.Labels[1] != r.Name {
+			continue
+		}
+		a, ok := b.Body.Attributes[attr]
+		if !ok {
+			return nil, ""
+		}
+		call, ok := a.Expr.(*hclsyntax.FunctionCallExpr)
+		if !ok || call.Name != "jsonencode" || len(call.Args) != 1 {
+			return nil, ""
+		}
+		ctx := &hcl.EvalContext{Variables: map[string]cty.Value{}, Functions: functions}
+		for _, t := range call.Args[0].Variables() {
+			ctx.Variables[t.RootName()] = cty.DynamicVal
+		}
+		v, diags := call.Args[0].Value(ctx)
+		if diags.HasErrors() || !v.IsKnown() || !(v.Type().IsObjectType() || v.Type().IsMapType()) {
+			return nil, ""
+		}
+		doc, _ := goValue(v).(map[string]interface{})
+		p, err := iampolicy.FromValue(doc)
+		if err != nil {
+			return nil, ""
+		}
+		return p, filepath.Join(filepath.Base(dir), filepath.Base(a.SrcRange.Filename))
+	}
+	return nil, ""
+}
+
+// goValue converts v into the shape json.Unmarshal produces, with
+// UnknownValue in place of unknown values.
+func goValue(v cty.Value) interface{} {
+	switch {
+	case !v.IsKnown():
+		return iampolicy.UnknownValue
+	case v.IsNull():
+		return nil
+	}
+	t := v.Type()
+	switch {
+	case t == cty.String:
+		return v.AsString()
+	case t == cty.Number:
+		f, _ := v.AsBigFloat().Float64()
+		return f
+	case t == cty.Bool:
+		return v.True()
+	case t.IsListType() || t.IsTupleType() || t.IsSetType():
+		var out []interface{}
+		for it := v.ElementIterator(); it.Next(); {
+			_, e := it.Element()
+			out = append(out, goValue(e))
+		}
+		return out
+	case t.IsMapType() || t.IsObjectType():
+		out := map[string]interface{}{}
+		for it := v.ElementIterator(); it.Next(); {
+			k, e := it.Element()
+			out[k.AsString()] = goValue(e)
+		}
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package iamlint
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/yourorg/tf-modules/tests/internal/iampolicy"
+)
+
+// Permission is one action on one resource pattern granted to, or denied
+// a role. Managed policies appear as a single permission whose Action is
+// the policy ARN.
+type Permission struct {
+	Role     string `json:"role"`
+	Service  string `json:"service"`
+	Access   string `json:"access"`
+	Effect   string `json:"effect"`
+	Action   string `json:"action"`
+	Resource string `json:"resource"`
+	// Condition joins the statement's conditions with "; ".
+	Condition string `json:"condition,omitempty"`
+}
+
+// String renders the permission as one tab-separated line. Sorted lines
+// diff cleanly between two plans.
+func (p Permission) String() string {
+	s := strings.Join([]string{p.Role, p.Service, p.Access, p.Effect, p.Action, p.Resource}, "\t")
+	if p.Condition != "" {
+		s += "\tif " + p.Condition
+	}
+	return s
+}
+
+// Summary flattens each role's grants into permissions, sorted by role,
+// service, access level and action, without duplicates. Statements with
+// NotAction or NotResource are written as "NOT a, b". Unresolved policies
+// appear with UnknownValue as the action.
+func Summary(roles []Role) []Permission {
+	seen := map[Permission]bool{}
+	var out []Permission
+	add := func(p Permission) {
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	for _, role := range roles {
+		for _, g := range role.Grants {
+			switch {
+			case g.Managed:
+				add(Permission{Role: role.Address, Service: "*", Access: "managed", Effect: "allow", Action: g.Name, Resource: "*"})
+				continue
+			case g.Policy == nil:
+				add(Permission{Role: role.Address, Service: "*", Access: Write, Effect: "allow", Action: iampolicy.UnknownValue,
+					Resource: grantName(g)})
+				continue
+			}
+			for _, s := range g.Policy.Statements {
+				effect := strings.ToLower(s.Effect)
+				var conds []string
+				for _, c := range s.Conditions {
+					conds = append(conds, c.String())
+				}
+				condition := strings.Join(conds, "; ")
+				resources := s.Resources
+				if len(s.NotResources) > 0 {
+					resources = []string{"NOT " + strings.Join(s.NotResources, ", ")}
+				}
+				if len(s.NotActions) > 0 {
+					for _, r := range resources {
+						add(Permission{Role: role.Address, Service: "*", Access: Write, Effect: effect,
+							Action: "NOT " + strings.Join(s.NotActions, ", "), Resource: r, Condition: condition})
+					}
+					continue
+				}
+				for _, a := range s.Actions {
+					for _, r := range resources {
+						add(Permission{Role: role.Address, Service: Service(a), Access: Access(a), Effect: effect,
+							Action: a, Resource: r, Condition: condition})
+					}
+				}
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		for _, pair := range [][2]string{
+			{a.Role, b.Role}, {a.Service, b.Service}, {a.Access, b.Access}, {a.Action, b.Action},
+			{a.Resource, b.Resource}, {a.Effect, b.Effect}, {a.Condition, b.Condition},
+		} {
+			if pair[0] != pair[1] {
+				return pair[0] < pair[1]
+			}
+		}
+		return false
+	})
+	return out
+}
@@ -0,0 +1,11 @@
+# Root module the testdata plan was made from. Only the module sources
+# matter: iamlint -dir follows them to evaluate policies the plan leaves
+# unknown.
+
+module "eks" {
+  source = "../../../../../modules/aws/eks"
+}
+
+module "addons" {
+  source = "../../../../../modules/aws/eks-addons"
+}
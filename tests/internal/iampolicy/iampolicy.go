@@ -0,0 +1,247 @@
+// Package iampolicy parses IAM policy documents from plan JSON, whether
+// Terraform knows the policy JSON at plan time or only the statement blocks
+// of the aws_iam_policy_document that builds it, for the checks that
+// evaluate policies, such as the GitHub OIDC trust analyzer.
+package iampolicy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// UnknownValue stands in for a value known only after apply, such as the
+// ARN of a resource created in the same plan.
+const UnknownValue = "(known after apply)"
+
+// Condition is one condition operator applied to one key.
+type Condition struct {
+	Operator string
+	Key      string
+	Values   []string
+}
+
+func (c Condition) String() string {
+	return fmt.Sprintf("%s %s=%s", c.Operator, c.Key, strings.Join(c.Values, ","))
+}
+
+// Statement is an IAM policy statement.
+type Statement struct {
+	Sid          string
+	Effect       string
+	Actions      []string
+	NotActions   []string
+	Resources    []string
+	NotResources []string
+	// Principals maps principal type (AWS, Federated, Service) to
+	// identifiers; "*" as a whole principal is stored as AWS: ["*"].
+	Principals map[string][]string
+	Conditions []Condition
+}
+
+// Allow reports whether the statement's effect is Allow.
+func (s Statement) Allow() bool {
+	return strings.EqualFold(s.Effect, "Allow")
+}
+
+// ID returns the Sid, or "statement <i>" when it has none.
+func (s Statement) ID(i int) string {
+	if s.Sid != "" {
+		return s.Sid
+	}
+	return fmt.Sprintf("statement %d", i)
+}
+
+// HasCondition reports whether any condition uses key, ignoring case as
+// IAM does.
+func (s Statement) HasCondition(key string) bool {
+	for _, c := range s.Conditions {
+		if strings.EqualFold(c.Key, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy is an IAM policy document.
+type Policy struct {
+	Statements []Statement
+}
+
+// Parse decodes an IAM policy JSON document. Action, Resource, Principal
+// and condition values may each be a string or a list.
+func Parse(doc string) (*Policy, error) {
+	var v map[string]interface{}
+	if err := json.Unmarshal([]byte(doc), &v); err != nil {
+		return nil, fmt.Errorf("parsing policy: %w", err)
+	}
+	return FromValue(v)
+}
+
+// FromValue converts a decoded policy document, as from json.Unmarshal or
+// a jsonencode() argument, into a Policy.
+func FromValue(v map[string]interface{}) (*Policy, error) {
+	var stmts []interface{}
+	switch s := v["Statement"].(type) {
+	case []interface{}:
+		stmts = s
+	case map[string]interface{}:
+		stmts = []interface{}{s}
+	default:
+		return nil, fmt.Errorf("parsing policy: Statement is neither an object nor a list")
+	}
+
+	p := &Policy{}
+	for _, s := range stmts {
+		s, ok := s.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("parsing policy: statement is not an object")
+		}
+		st := Statement{Principals: map[string][]string{}}
+		st.Sid, _ = s["Sid"].(string)
+		st.Effect, _ = s["Effect"].(string)
+		st.Actions = stringList(s["Action"])
+		st.NotActions = stringList(s["NotAction"])
+		st.Resources = stringList(s["Resource"])
+		st.NotResources = stringList(s["NotResource"])
+		switch pr := s["Principal"].(type) {
+		case string:
+			st.Principals["AWS"] = []string{pr}
+		case map[string]interface{}:
+			for typ, ids := range pr {
+				st.Principals[typ] = stringList(ids)
+			}
+		}
+		if cond, ok := s["Condition"].(map[string]interface{}); ok {
+			for op, keys := range cond {
+				keys, _ := keys.(map[string]interface{})
+				for key, values := range keys {
+					st.Conditions = append(st.Conditions, Condition{Operator: op, Key: key, Values: stringList(values)})
+				}
+			}
+		}
+		sortConditions(st.Conditions)
+		p.Statements = append(p.Statements, st)
+	}
+	return p, nil
+}
+
+// FromDocument builds a policy from the planned values of an
+// aws_iam_policy_document data source. It uses the json attribute when it
+// is known, and the statement blocks otherwise, with UnknownValue for
+// identifiers and resources not yet known.
+func FromDocument(values map[string]interface{}) *Policy {
+	if doc, _ := values["json"].(string); doc != "" {
+		if p, err := Parse(doc); err == nil {
+			return p
+		}
+	}
+
+	p := &Policy{}
+	blocks, _ := values["statement"].([]interface{})
+	for _, b := range blocks {
+		b, _ := b.(map[string]interface{})
+		st := Statement{Principals: map[string][]string{}, Effect: "Allow"}
+		st.Sid, _ = b["sid"].(string)
+		if e, _ := b["effect"].(string); e != "" {
+			st.Effect = e
+		}
+		st.Actions = plannedList(b, "actions")
+		st.NotActions = plannedList(b, "not_actions")
+		st.Resources = plannedList(b, "resources")
+		st.NotResources = plannedList(b, "not_resources")
+		principals, _ := b["principals"].([]interface{})
+		for _, pr := range principals {
+			pr, _ := pr.(map[string]interface{})
+			typ, _ := pr["type"].(string)
+			st.Principals[typ] = append(st.Principals[typ], plannedList(pr, "identifiers")...)
+		}
+		conditions, _ := b["condition"].([]interface{})
+		for _, c := range conditions {
+			c, _ := c.(map[string]interface{})
+			op, _ := c["test"].(string)
+			key, _ := c["variable"].(string)
+			st.Conditions = append(st.Conditions, Condition{Operator: op, Key: key, Values: plannedList(c, "values")})
+		}
+		sortConditions(st.Conditions)
+		p.Statements = append(p.Statements, st)
+	}
+	return p
+}
+
+// plannedList reads a list attribute from planned values. Plan JSON omits
+// attributes that are wholly unknown and nulls out unknown elements; both
+// become UnknownValue.
+func plannedList(values map[string]interface{}, key string) []string {
+	v, ok := values[key]
+	if !ok {
+		return []string{UnknownValue}
+	}
+	items, ok := v.([]interface{})
+	if !ok {
+		return stringList(v)
+	}
+	var out []string
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		} else if item == nil {
+			out = append(out, UnknownValue)
+		}
+	}
+	return out
+}
+
+func sortConditions(cs []Condition) {
+	sort.SliceStable(cs, func(i, j int) bool {
+		if cs[i].Key != cs[j].Key {
+			return cs[i].Key < cs[j].Key
+		}
+		return cs[i].Operator < cs[j].Operator
+	})
+}
+
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	case []string:
+		return v
+	}
+	return nil
+}
+
+// Like matches s against an IAM wildcard pattern, where * matches any run
+// of characters, including ':' and '/', and ? matches one character.
+func Like(pattern, s string) bool {
+	if pattern == "" {
+		return s == ""
+	}
+	switch pattern[0] {
+	case '*':
+		for i := 0; i <= len(s); i++ {
+			if Like(pattern[1:], s[i:]) {
+				return true
+			}
+		}
+		return false
+	case '?':
+		return s != "" && Like(pattern[1:], s[1:])
+	}
+	return s != "" && s[0] == pattern[0] && Like(pattern[1:], s[1:])
+}
+
+// MatchAction reports whether an Action pattern such as "ec2:Describe*"
+// covers action. Action names are case-insensitive.
+func MatchAction(pattern, action string) bool {
+	return Like(strings.ToLower(pattern), strings.ToLower(action))
+}
@@ -0,0 +1,59 @@
+package iampolicy_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/iampolicy"
+)
+
+func TestParse(t *testing.T) {
+	p, err := iampolicy.Parse(`{"Statement": {
+		"Sid": "Pass",
+		"Effect": "Allow",
+		"Action": "iam:PassRole",
+		"Resource": ["arn:aws:iam::111111111111:role/node"],
+		"Condition": {"StringEquals": {"iam:PassedToService": "ec2.amazonaws.com"}}
+	}}`)
+	require.NoError(t, err)
+	require.Len(t, p.Statements, 1)
+	s := p.Statements[0]
+	assert.True(t, s.Allow())
+	assert.Equal(t, "Pass", s.ID(0))
+	assert.Equal(t, []string{"iam:PassRole"}, s.Actions)
+	assert.True(t, s.HasCondition("iam:passedtoservice"))
+	assert.Equal(t, "StringEquals iam:PassedToService=ec2.amazonaws.com", s.Conditions[0].String())
+
+	_, err = iampolicy.Parse(`{"Statement": "Allow"}`)
+	assert.Error(t, err)
+}
+
+func TestFromDocument(t *testing.T) {
+	// A deferred aws_iam_policy_document: json is unknown, resources are
+	// wholly unknown and one identifier is not yet known.
+	p := iampolicy.FromDocument(map[string]interface{}{
+		"statement": []interface{}{map[string]interface{}{
+			"actions":     []interface{}{"sqs:ReceiveMessage"},
+			"not_actions": []interface{}{},
+			"principals": []interface{}{map[string]interface{}{
+				"type":        "AWS",
+				"identifiers": []interface{}{"arn:aws:iam::111111111111:root", nil},
+			}},
+		}},
+	})
+	require.Len(t, p.Statements, 1)
+	s := p.Statements[0]
+	assert.Equal(t, "Allow", s.Effect)
+	assert.Empty(t, s.NotActions)
+	assert.Equal(t, []string{iampolicy.UnknownValue}, s.Resources)
+	assert.Equal(t, []string{"arn:aws:iam::111111111111:root", iampolicy.UnknownValue}, s.Principals["AWS"])
+}
+
+func TestLike(t *testing.T) {
+	assert.True(t, iampolicy.Like("repo:acme/*", "repo:acme/infra:ref:refs/heads/main"))
+	assert.False(t, iampolicy.Like("repo:acme/infra:ref:refs/heads/main", "repo:acme/infra:ref:refs/heads/main2"))
+	assert.True(t, iampolicy.MatchAction("EC2:Describe*", "ec2:DescribeInstances"))
+	assert.False(t, iampolicy.MatchAction("ec2:Describe*", "ec2:RunInstances"))
+}
@@ -0,0 +1,64 @@
+package iampolicy
+
+import (
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+)
+
+// Documents indexes the planned values of aws_iam_policy_document data
+// sources by address, whether read during plan (prior state) or deferred
+// to apply (resource changes).
+func Documents(plan *tfjson.Plan) map[string]map[string]interface{} {
+	out := map[string]map[string]interface{}{}
+	if plan.PriorState != nil && plan.PriorState.Values != nil && plan.PriorState.Values.RootModule != nil {
+		var walk func(m *tfjson.StateModule)
+		walk = func(m *tfjson.StateModule) {
+			for _, r := range m.Resources {
+				if r.Mode == tfjson.DataResourceMode && r.Type == "aws_iam_policy_document" {
+					out[r.Address] = r.AttributeValues
+				}
+			}
+			for _, c := range m.ChildModules {
+				walk(c)
+			}
+		}
+		walk(plan.PriorState.Values.RootModule)
+	}
+	for _, rc := range plan.ResourceChanges {
+		if rc.Mode != tfjson.DataResourceMode || rc.Type != "aws_iam_policy_document" || rc.Change == nil {
+			continue
+		}
+		if after, ok := rc.Change.After.(map[string]interface{}); ok {
+			out[rc.Address] = after
+		}
+	}
+	return out
+}
+
+// Resolve returns the policy in attribute attr of r, e.g. the
+// assume_role_policy of an aws_iam_role or the policy of an
+// aws_iam_role_policy. When the planned JSON is unknown it follows the
+// attribute's reference to an aws_iam_policy_document in docs. source is
+// attr or the document's address; p is nil when neither is available.
+func Resolve(plan *tfjson.Plan, r planjson.Resource, attr string, docs map[string]map[string]interface{}) (p *Policy, source string, err error) {
+	if doc := planjson.String(r.Values, attr); doc != "" {
+		p, err := Parse(doc)
+		return p, attr, err
+	}
+	for _, ref := range planjson.References(plan, r, attr) {
+		if !strings.HasPrefix(ref, "data.aws_iam_policy_document.") {
+			continue
+		}
+		addr := strings.TrimSuffix(strings.TrimSuffix(ref, ".minified_json"), ".json")
+		if r.ModuleAddress != "" {
+			addr = r.ModuleAddress + "." + addr
+		}
+		if values, ok := docs[addr]; ok {
+			return FromDocument(values), addr, nil
+		}
+	}
+	return nil, "", nil
+}
@@ -0,0 +1,63 @@
+package idempotency
+
+import (
+	_ "embed"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed allowlist.yaml
+var allowlistYAML []byte
+
+// Allowlist maps a module directory relative to the repository root, e.g.
+// modules/aws/vpc, to the perpetual diffs accepted in its tests.
+type Allowlist map[string][]Allowance
+
+// DefaultAllowlist returns the allowances in allowlist.yaml.
+func DefaultAllowlist() (Allowlist, error) {
+	return ParseAllowlist(allowlistYAML)
+}
+
+// ParseAllowlist reads an allowlist, requiring every allowance to have an
+// address and a reason.
+func ParseAllowlist(data []byte) (Allowlist, error) {
+	var l Allowlist
+	dec := yaml.NewDecoder(strings.NewReader(string(data)))
+	dec.KnownFields(true)
+	if err := dec.Decode(&l); err != nil {
+		return nil, fmt.Errorf("allowlist: %w", err)
+	}
+	for module, allow := range l {
+		if !strings.HasPrefix(module, "modules/") {
+			return nil, fmt.Errorf("allowlist: %s is not a directory under modules/", module)
+		}
+		for _, a := range allow {
+			if a.Address == "" || a.Reason == "" {
+				return nil, fmt.Errorf("allowlist: %s: every allowance needs an address and a reason", module)
+			}
+		}
+	}
+	return l, nil
+}
+
+// Module returns the allowlist key for a test's TerraformDir: the directory
+// relative to repoRoot, or modules/<cloud>/<name> for a copy outside the
+// repository, since files.CopyTerraformFolderToTemp keeps the module's
+// directory name.
+func Module(repoRoot, dir, cloud string) (string, error) {
+	root, err := filepath.Abs(repoRoot)
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(root, abs); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel), nil
+	}
+	return "modules/" + cloud + "/" + filepath.Base(abs), nil
+}
@@ -0,0 +1,283 @@
+// Package idempotency checks the plan made right after an apply. A module
+// that applied cleanly should plan no changes; anything the follow-up plan
+// still wants to change is a perpetual diff that every later apply, and
+// the drift workflow, would report again.
+//
+// Findings name the attribute paths that keep changing, in the dotted form
+// planjson.Get takes (tags.Name, ingress.0.cidr_blocks), so a known
+// provider bug can be allowed for one attribute without hiding the rest of
+// the resource. Known bugs are listed per module in allowlist.yaml.
+package idempotency
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Hints explaining why a path differs when the values look alike.
+const (
+	HintJSON  = "same JSON, formatted or ordered differently"
+	HintOrder = "same elements in a different order"
+)
+
+// Finding is a resource or output the follow-up plan would still change.
+type Finding struct {
+	// Address is the resource address, or output.<name> for an output.
+	Address string
+	Actions tfjson.Actions
+	// Paths are the attribute paths whose values differ, sorted. They are
+	// empty when the whole resource is created or destroyed.
+	Paths []string
+	// Hints holds, for some paths, why values that look equal still
+	// differ; see HintJSON and HintOrder.
+	Hints map[string]string
+}
+
+func (f Finding) String() string {
+	var action string
+	switch {
+	case f.Actions.Replace():
+		action = "replaced"
+	case f.Actions.Create():
+		action = "created"
+	case f.Actions.Delete():
+		action = "destroyed"
+	default:
+		action = "updated in place"
+	}
+	s := fmt.Sprintf("%s would be %s", f.Address, action)
+	if len(f.Paths) == 0 {
+		return s
+	}
+	paths := make([]string, len(f.Paths))
+	for i, p := range f.Paths {
+		paths[i] = p
+		if h := f.Hints[p]; h != "" {
+			paths[i] += " (" + h + ")"
+		}
+	}
+	return s + ": " + strings.Join(paths, ", ")
+}
+
+// Changes returns every managed resource and output the plan changes, with
+// the attribute paths that differ between before and after. Values that
+// stay unknown until apply count as differing.
+func Changes(plan *tfjson.Plan) []Finding {
+	var out []Finding
+	for _, rc := range plan.ResourceChanges {
+		if rc.Mode != tfjson.ManagedResourceMode || rc.Change == nil {
+			continue
+		}
+		if f, ok := finding(rc.Address, rc.Change); ok {
+			out = append(out, f)
+		}
+	}
+	names := make([]string, 0, len(plan.OutputChanges))
+	for name := range plan.OutputChanges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if f, ok := finding("output."+name, plan.OutputChanges[name]); ok {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func finding(addr string, c *tfjson.Change) (Finding, bool) {
+	if c == nil || len(c.Actions) == 0 || c.Actions.NoOp() || c.Actions.Read() {
+		return Finding{}, false
+	}
+	a := c.Actions
+	f := Finding{Address: addr, Actions: a}
+	if a.Create() || a.Delete() {
+		return f, true
+	}
+	d := differ{hints: map[string]string{}}
+	d.walk("", c.Before, c.After, c.AfterUnknown)
+	sort.Strings(d.paths)
+	f.Paths = d.paths
+	if len(d.hints) > 0 {
+		f.Hints = d.hints
+	}
+	return f, true
+}
+
+type differ struct {
+	paths []string
+	hints map[string]string
+}
+
+func (d *differ) add(path, hint string) {
+	if path == "" {
+		// A scalar output, or a resource that is not an object.
+		path = "(value)"
+	}
+	d.paths = append(d.paths, path)
+	if hint != "" {
+		d.hints[path] = hint
+	}
+}
+
+func join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+func (d *differ) walk(path string, before, after, unknown interface{}) {
+	if u, ok := unknown.(bool); ok && u {
+		d.add(path, "")
+		return
+	}
+	switch b := before.(type) {
+	case map[string]interface{}:
+		a, ok := after.(map[string]interface{})
+		if !ok {
+			break
+		}
+		um, _ := unknown.(map[string]interface{})
+		keys := map[string]bool{}
+		for k := range b {
+			keys[k] = true
+		}
+		for k := range a {
+			keys[k] = true
+		}
+		for k := range um {
+			keys[k] = true
+		}
+		for k := range keys {
+			d.walk(join(path, k), b[k], a[k], um[k])
+		}
+		return
+	case []interface{}:
+		a, ok := after.([]interface{})
+		if !ok {
+			break
+		}
+		ul, _ := unknown.([]interface{})
+		if len(a) != len(b) {
+			d.add(path, "")
+			return
+		}
+		if !reflect.DeepEqual(a, b) && sameElements(a, b) && len(ul) == 0 {
+			d.add(path, HintOrder)
+			return
+		}
+		for i := range b {
+			var u interface{}
+			if i < len(ul) {
+				u = ul[i]
+			}
+			d.walk(join(path, strconv.Itoa(i)), b[i], a[i], u)
+		}
+		return
+	case string:
+		if a, ok := after.(string); ok && a != b && sameJSON(a, b) {
+			d.add(path, HintJSON)
+			return
+		}
+	}
+	if !reflect.DeepEqual(before, after) {
+		d.add(path, "")
+	}
+}
+
+// sameElements reports whether a and b hold the same values as multisets.
+func sameElements(a, b []interface{}) bool {
+	used := make([]bool, len(b))
+next:
+	for _, x := range a {
+		for i, y := range b {
+			if !used[i] && reflect.DeepEqual(x, y) {
+				used[i] = true
+				continue next
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// sameJSON reports whether a and b are JSON objects or arrays that decode
+// to the same value.
+func sameJSON(a, b string) bool {
+	var x, y interface{}
+	for _, s := range []string{a, b} {
+		if t := strings.TrimSpace(s); !strings.HasPrefix(t, "{") && !strings.HasPrefix(t, "[") {
+			return false
+		}
+	}
+	if json.Unmarshal([]byte(a), &x) != nil || json.Unmarshal([]byte(b), &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// Allowance accepts a known perpetual diff. Address and Path may use * for
+// any run of characters; an empty Path accepts every path of the resource,
+// including its creation or destruction.
+type Allowance struct {
+	Address string `yaml:"address"`
+	Path    string `yaml:"path,omitempty"`
+	// Reason is why the diff is accepted, ideally the upstream issue.
+	Reason string `yaml:"reason"`
+}
+
+func glob(pattern, s string) bool {
+	re := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"
+	return regexp.MustCompile(re).MatchString(s)
+}
+
+func (a Allowance) covers(addr, path string) bool {
+	return glob(a.Address, addr) && (a.Path == "" || path != "" && glob(a.Path, path))
+}
+
+// Check returns the plan's changes that no allowance covers, keeping only
+// the uncovered paths of each, and the allowances that covered nothing.
+func Check(plan *tfjson.Plan, allow []Allowance) (findings []Finding, unused []Allowance) {
+	used := make([]bool, len(allow))
+	cover := func(addr, path string) bool {
+		covered := false
+		for i, a := range allow {
+			if a.covers(addr, path) {
+				used[i], covered = true, true
+			}
+		}
+		return covered
+	}
+	for _, f := range Changes(plan) {
+		if len(f.Paths) == 0 {
+			if !cover(f.Address, "") {
+				findings = append(findings, f)
+			}
+			continue
+		}
+		var left []string
+		for _, p := range f.Paths {
+			if !cover(f.Address, p) {
+				left = append(left, p)
+			}
+		}
+		if len(left) > 0 {
+			f.Paths = left
+			findings = append(findings, f)
+		}
+	}
+	for i, a := range allow {
+		if !used[i] {
+			unused = append(unused, a)
+		}
+	}
+	return findings, unused
+}
@@ -0,0 +1,135 @@
+package idempotency_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/idempotency"
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+)
+
+// followUpPlan is a plan made right after applying: the bucket policy comes
+// back from the provider reformatted, a security group's rules come back
+// reordered, a tag and the policy document's ARN never settle, and the VPC
+// and its output have nothing left to do.
+const followUpPlan = `{
+  "format_version": "1.2",
+  "resource_changes": [
+    {
+      "address": "aws_vpc.this", "mode": "managed", "type": "aws_vpc", "name": "this",
+      "change": {"actions": ["no-op"], "before": {"id": "vpc-1"}, "after": {"id": "vpc-1"}}
+    },
+    {
+      "address": "aws_s3_bucket_policy.this", "mode": "managed", "type": "aws_s3_bucket_policy", "name": "this",
+      "change": {
+        "actions": ["update"],
+        "before": {"bucket": "b", "policy": "{\"Version\":\"2012-10-17\",\"Statement\":[]}", "tags": {"Name": "b", "Owner": "x"}},
+        "after": {"bucket": "b", "policy": "{\n  \"Statement\": [],\n  \"Version\": \"2012-10-17\"\n}", "tags": {"Name": "b", "Owner": "y"}},
+        "after_unknown": {"tags": {}}
+      }
+    },
+    {
+      "address": "aws_security_group.this", "mode": "managed", "type": "aws_security_group", "name": "this",
+      "change": {
+        "actions": ["update"],
+        "before": {"ingress": [{"from_port": 443, "cidr_blocks": ["10.0.0.0/16"]}, {"from_port": 80, "cidr_blocks": ["10.0.0.0/16"]}], "arn": "arn:1"},
+        "after": {"ingress": [{"from_port": 80, "cidr_blocks": ["10.0.0.0/16"]}, {"from_port": 443, "cidr_blocks": ["10.0.0.0/16"]}]},
+        "after_unknown": {"arn": true}
+      }
+    },
+    {
+      "address": "data.aws_iam_policy_document.this", "mode": "data", "type": "aws_iam_policy_document", "name": "this",
+      "change": {"actions": ["read"], "before": null, "after": {}}
+    },
+    {
+      "address": "aws_cloudwatch_log_group.this[0]", "mode": "managed", "type": "aws_cloudwatch_log_group", "name": "this", "index": 0,
+      "change": {"actions": ["create"], "before": null, "after": {"name": "x"}}
+    }
+  ],
+  "output_changes": {
+    "vpc_id": {"actions": ["no-op"], "before": "vpc-1", "after": "vpc-1"},
+    "updated_at": {"actions": ["update"], "before": "2026-10-19T10:00:00Z", "after": null, "after_unknown": true}
+  }
+}`
+
+func TestChanges(t *testing.T) {
+	plan, err := planjson.Parse([]byte(followUpPlan))
+	require.NoError(t, err)
+
+	changes := idempotency.Changes(plan)
+	require.Len(t, changes, 4)
+
+	assert.Equal(t, "aws_s3_bucket_policy.this", changes[0].Address)
+	assert.Equal(t, []string{"policy", "tags.Owner"}, changes[0].Paths)
+	assert.Equal(t, idempotency.HintJSON, changes[0].Hints["policy"])
+	assert.Equal(t, "aws_s3_bucket_policy.this would be updated in place: policy (same JSON, formatted or ordered differently), tags.Owner", changes[0].String())
+
+	assert.Equal(t, []string{"arn", "ingress"}, changes[1].Paths)
+	assert.Equal(t, idempotency.HintOrder, changes[1].Hints["ingress"])
+
+	assert.Empty(t, changes[2].Paths)
+	assert.Equal(t, "aws_cloudwatch_log_group.this[0] would be created", changes[2].String())
+
+	assert.Equal(t, "output.updated_at", changes[3].Address)
+	assert.Equal(t, []string{"(value)"}, changes[3].Paths)
+}
+
+func TestCheck(t *testing.T) {
+	plan, err := planjson.Parse([]byte(followUpPlan))
+	require.NoError(t, err)
+
+	findings, unused := idempotency.Check(plan, []idempotency.Allowance{
+		{Address: "aws_s3_bucket_policy.*", Path: "policy", Reason: "provider reformats"},
+		{Address: "aws_security_group.this", Path: "ingress", Reason: "provider reorders"},
+		{Address: "aws_cloudwatch_log_group.this[*]", Reason: "recreated by design"},
+		{Address: "output.updated_at", Reason: "timestamp()"},
+		{Address: "aws_kms_key.this", Path: "policy", Reason: "fixed upstream"},
+	})
+	require.Len(t, findings, 2)
+	assert.Equal(t, []string{"tags.Owner"}, findings[0].Paths, "only the uncovered paths are reported")
+	assert.Equal(t, []string{"arn"}, findings[1].Paths)
+	require.Len(t, unused, 1)
+	assert.Equal(t, "aws_kms_key.this", unused[0].Address)
+
+	// A path allowance never covers the resource being created outright.
+	findings, _ = idempotency.Check(plan, []idempotency.Allowance{
+		{Address: "aws_cloudwatch_log_group.this[0]", Path: "*", Reason: "x"},
+	})
+	assert.Len(t, findings, 4)
+}
+
+func TestAllowlist(t *testing.T) {
+	l, err := idempotency.DefaultAllowlist()
+	require.NoError(t, err)
+	for module := range l {
+		assert.DirExists(t, "../../../"+module)
+	}
+
+	l, err = idempotency.ParseAllowlist([]byte(`
+modules/aws/kms:
+  - address: aws_kms_key.this
+    path: policy
+    reason: provider reorders principals
+`))
+	require.NoError(t, err)
+	assert.Equal(t, "policy", l["modules/aws/kms"][0].Path)
+
+	_, err = idempotency.ParseAllowlist([]byte("modules/aws/kms:\n  - address: aws_kms_key.this\n"))
+	assert.ErrorContains(t, err, "reason")
+	_, err = idempotency.ParseAllowlist([]byte("aws/kms: []\n"))
+	assert.ErrorContains(t, err, "not a directory under modules/")
+	_, err = idempotency.ParseAllowlist([]byte("modules/aws/kms:\n  - adress: x\n"))
+	assert.Error(t, err)
+}
+
+func TestModule(t *testing.T) {
+	m, err := idempotency.Module("../../..", "../../../modules/aws/vpc", "aws")
+	require.NoError(t, err)
+	assert.Equal(t, "modules/aws/vpc", m)
+
+	m, err = idempotency.Module("../../..", t.TempDir()+"/TestVpcLocalStack123/vpc", "aws")
+	require.NoError(t, err)
+	assert.Equal(t, "modules/aws/vpc", m)
+}
@@ -0,0 +1,133 @@
+package karpenter
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+
+	"github.com/yourorg/tf-modules/tests/internal/cost"
+)
+
+// InstanceType is the shape of an EC2 instance type.
+type InstanceType struct {
+	VCPU      int     `json:"vcpu"`
+	MemoryGiB float64 `json:"memory_gib"`
+	Arch      string  `json:"arch"`
+	GPU       int     `json:"gpu"`
+}
+
+//go:embed data/instances.json
+var instancesJSON []byte
+
+var instanceTypes = func() map[string]InstanceType {
+	out := map[string]InstanceType{}
+	if err := json.Unmarshal(instancesJSON, &out); err != nil {
+		panic(fmt.Sprintf("karpenter: data/instances.json: %v", err))
+	}
+	return out
+}()
+
+// Lookup returns the shape of an instance type from the embedded table.
+func Lookup(name string) (InstanceType, bool) {
+	it, ok := instanceTypes[name]
+	return it, ok
+}
+
+// largest returns the most vCPUs and memory of any known type in types.
+func largest(types []string) (cpu int, mem float64, ok bool) {
+	for _, t := range types {
+		it, found := instanceTypes[t]
+		if !found {
+			continue
+		}
+		ok = true
+		if it.VCPU > cpu {
+			cpu = it.VCPU
+		}
+		if it.MemoryGiB > mem {
+			mem = it.MemoryGiB
+		}
+	}
+	return cpu, mem, ok
+}
+
+// Capacity compares a node group with the NodePool that replaces it.
+type Capacity struct {
+	NodeGroup                        string
+	MinNodes, DesiredNodes, MaxNodes int
+	// DesiredVCPU and DesiredMemoryGiB are what the group runs today, on
+	// its first instance type as EKS launches it.
+	DesiredVCPU      int
+	DesiredMemoryGiB float64
+	// MaxVCPU and MaxMemoryGiB are max_size nodes of the largest type,
+	// which the NodePool limits reproduce.
+	MaxVCPU      int
+	MaxMemoryGiB float64
+	// LimitCPU and LimitMemory are the NodePool limits, "" when none of
+	// the group's instance types is known.
+	LimitCPU, LimitMemory string
+	// DesiredMonthly and MaxMonthly are list prices from the cost table;
+	// Priced is false when an instance type has no price.
+	DesiredMonthly, MaxMonthly float64
+	Priced                     bool
+}
+
+// Compare returns the capacity of each node group and its NodePool, priced
+// with table.
+func (m *Migration) Compare(table *cost.Table) []Capacity {
+	var out []Capacity
+	for i, ng := range m.Cluster.NodeGroups {
+		c := Capacity{
+			NodeGroup:    ng.Name,
+			MinNodes:     ng.MinSize,
+			DesiredNodes: ng.DesiredSize,
+			MaxNodes:     ng.MaxSize,
+			LimitCPU:     m.NodePools[i].Spec.Limits["cpu"],
+			LimitMemory:  m.NodePools[i].Spec.Limits["memory"],
+		}
+		if len(ng.InstanceTypes) > 0 {
+			if it, ok := instanceTypes[ng.InstanceTypes[0]]; ok {
+				c.DesiredVCPU = it.VCPU * ng.DesiredSize
+				c.DesiredMemoryGiB = it.MemoryGiB * float64(ng.DesiredSize)
+			}
+		}
+		if cpu, mem, ok := largest(ng.InstanceTypes); ok {
+			c.MaxVCPU = cpu * ng.MaxSize
+			c.MaxMemoryGiB = mem * float64(ng.MaxSize)
+		}
+		c.DesiredMonthly, c.MaxMonthly, c.Priced = price(ng, table)
+		out = append(out, c)
+	}
+	return out
+}
+
+// price costs desired_size nodes of the first instance type and max_size
+// nodes of the most expensive one, with the spot factor for SPOT groups.
+func price(ng NodeGroup, table *cost.Table) (desired, max float64, ok bool) {
+	if table == nil || len(ng.InstanceTypes) == 0 {
+		return 0, 0, false
+	}
+	factor := 1.0
+	if ng.CapacityType == "SPOT" {
+		f, found := table.Prices["aws.ec2.spot_factor"]
+		if !found {
+			return 0, 0, false
+		}
+		factor = f
+	}
+	var highest float64
+	for i, t := range ng.InstanceTypes {
+		hourly, found := table.Prices["aws.ec2."+t+".hour"]
+		if !found {
+			return 0, 0, false
+		}
+		if i == 0 {
+			desired = hourly * factor * table.HoursPerMonth * float64(ng.DesiredSize)
+		}
+		if hourly > highest {
+			highest = hourly
+		}
+	}
+	max = highest * factor * table.HoursPerMonth * float64(ng.MaxSize)
+	return desired, max, true
+}
@@ -0,0 +1,317 @@
+// Package karpenter translates the managed node_groups of an aws/eks
+// module call into Karpenter NodePool and EC2NodeClass manifests, compares
+// their capacity, and lists the settings Karpenter cannot express. It
+// automates docs/karpenter-migration.md.
+package karpenter
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/gocty"
+
+	"github.com/yourorg/tf-modules/tests/internal/tfconfig"
+)
+
+// Taint is a node group taint with the EKS effect name, e.g. NO_SCHEDULE.
+type Taint struct {
+	Key    string
+	Value  string
+	Effect string
+}
+
+// NodeGroup is one entry of the aws/eks node_groups variable with the
+// module's optional() defaults applied.
+type NodeGroup struct {
+	Name          string
+	InstanceTypes []string
+	DesiredSize   int
+	MinSize       int
+	MaxSize       int
+	DiskSize      int
+	CapacityType  string
+	AMIType       string
+	CustomAMIID   string
+	Labels        map[string]string
+	Taints        []Taint
+}
+
+// Cluster is an aws/eks module call in a root module.
+type Cluster struct {
+	// Dir is the root module directory and Module the call name.
+	Dir    string
+	Module string
+	// Name is the EKS cluster name the module derives from project and
+	// environment, or "" if they are not known offline.
+	Name       string
+	NodeGroups []NodeGroup
+	// IMDSv2Required and HopLimit mirror the module's launch template
+	// metadata options.
+	IMDSv2Required        bool
+	HopLimit              int
+	ClusterAutoscalerIRSA bool
+	// AddonsModule is the aws/eks-addons call in the same root module, if any.
+	AddonsModule string
+	File         string
+	Line         int
+}
+
+// NodeRoleName returns the IAM role name aws/eks gives its nodes.
+func (c *Cluster) NodeRoleName() string {
+	return c.clusterName() + "-node-role"
+}
+
+func (c *Cluster) clusterName() string {
+	if c.Name == "" {
+		return "<cluster_name>"
+	}
+	return c.Name
+}
+
+// Load reads the aws/eks module call named module in the root module at
+// dir. module may be empty when dir calls aws/eks exactly once.
+func Load(dir, module string) (*Cluster, error) {
+	root, err := tfconfig.Load(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var calls []tfconfig.ModuleCall
+	var addons string
+	for _, c := range root.ModuleCalls() {
+		switch {
+		case c.SourceHasSuffix("aws/eks") && (module == "" || c.Name == module):
+			calls = append(calls, c)
+		case c.SourceHasSuffix("aws/eks-addons"):
+			addons = c.Name
+		}
+	}
+	switch {
+	case len(calls) == 0 && module != "":
+		return nil, fmt.Errorf("%s: no aws/eks module call named %q", dir, module)
+	case len(calls) == 0:
+		return nil, fmt.Errorf("%s: no aws/eks module call", dir)
+	case len(calls) > 1:
+		return nil, fmt.Errorf("%s: %d aws/eks module calls; choose one with -module", dir, len(calls))
+	}
+	call := calls[0]
+
+	modBodies, err := moduleBodies(filepath.Join(dir, call.Source))
+	if err != nil {
+		return nil, err
+	}
+	defaults := tfconfig.VariableDefaults(modBodies)
+	input := func(name string) cty.Value {
+		if v, ok := root.Eval(call, name); ok {
+			return v
+		}
+		return defaults[name]
+	}
+
+	c := &Cluster{
+		Dir:          dir,
+		Module:       call.Name,
+		AddonsModule: addons,
+		File:         call.Block.TypeRange.Filename,
+		Line:         call.Block.TypeRange.Start.Line,
+	}
+	project, environment := input("project"), input("environment")
+	if isString(project) && isString(environment) {
+		c.Name = project.AsString() + "-" + environment.AsString() + "-eks"
+	}
+	if err := decode(input("imdsv2_required"), &c.IMDSv2Required); err != nil {
+		return nil, fmt.Errorf("imdsv2_required: %w", err)
+	}
+	if err := decode(input("metadata_http_put_response_hop_limit"), &c.HopLimit); err != nil {
+		return nil, fmt.Errorf("metadata_http_put_response_hop_limit: %w", err)
+	}
+	if err := decode(input("enable_cluster_autoscaler_irsa"), &c.ClusterAutoscalerIRSA); err != nil {
+		return nil, fmt.Errorf("enable_cluster_autoscaler_irsa: %w", err)
+	}
+
+	groups := input("node_groups")
+	if groups == cty.NilVal || groups.IsNull() || !groups.CanIterateElements() {
+		return nil, fmt.Errorf("%s: module.%s node_groups cannot be evaluated offline", dir, call.Name)
+	}
+	optional := nodeGroupDefaults(modBodies)
+	for it := groups.ElementIterator(); it.Next(); {
+		k, v := it.Element()
+		ng, err := nodeGroup(k.AsString(), v, optional)
+		if err != nil {
+			return nil, fmt.Errorf("module.%s node_groups[%q]: %w", call.Name, k.AsString(), err)
+		}
+		c.NodeGroups = append(c.NodeGroups, ng)
+	}
+	sort.Slice(c.NodeGroups, func(i, j int) bool { return c.NodeGroups[i].Name < c.NodeGroups[j].Name })
+	return c, nil
+}
+
+func moduleBodies(dir string) ([]*hclsyntax.Body, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: no .tf files", dir)
+	}
+	var out []*hclsyntax.Body
+	for _, f := range files {
+		body, err := tfconfig.ParseFile(f)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, body)
+	}
+	return out, nil
+}
+
+// nodeGroupDefaults reads the optional(type, default) attributes from the
+// module's node_groups type constraint, so groups that omit disk_size or
+// capacity_type get what the module would apply.
+func nodeGroupDefaults(bodies []*hclsyntax.Body) map[string]cty.Value {
+	out := map[string]cty.Value{}
+	for _, b := range tfconfig.Blocks(bodies, "variable") {
+		if len(b.Labels) != 1 || b.Labels[0] != "node_groups" {
+			continue
+		}
+		attr, ok := b.Body.Attributes["type"]
+		if !ok {
+			continue
+		}
+		mapCall, ok := attr.Expr.(*hclsyntax.FunctionCallExpr)
+		if !ok || mapCall.Name != "map" || len(mapCall.Args) != 1 {
+			continue
+		}
+		objCall, ok := mapCall.Args[0].(*hclsyntax.FunctionCallExpr)
+		if !ok || objCall.Name != "object" || len(objCall.Args) != 1 {
+			continue
+		}
+		obj, ok := objCall.Args[0].(*hclsyntax.ObjectConsExpr)
+		if !ok {
+			continue
+		}
+		for _, item := range obj.Items {
+			name := hcl.ExprAsKeyword(item.KeyExpr)
+			opt, ok := item.ValueExpr.(*hclsyntax.FunctionCallExpr)
+			if name == "" || !ok || opt.Name != "optional" || len(opt.Args) != 2 {
+				continue
+			}
+			if v, diags := opt.Args[1].Value(nil); !diags.HasErrors() {
+				out[name] = v
+			}
+		}
+	}
+	return out
+}
+
+func nodeGroup(name string, v cty.Value, optional map[string]cty.Value) (NodeGroup, error) {
+	ng := NodeGroup{Name: name, Labels: map[string]string{}}
+	attr := func(key string) cty.Value {
+		if v.Type().IsObjectType() && v.Type().HasAttribute(key) {
+			if a := v.GetAttr(key); !a.IsNull() {
+				return a
+			}
+		} else if v.Type().IsMapType() {
+			if a := v.Index(cty.StringVal(key)); !a.IsNull() {
+				return a
+			}
+		}
+		if d, ok := optional[key]; ok {
+			return d
+		}
+		return cty.NullVal(cty.DynamicPseudoType)
+	}
+
+	fields := []struct {
+		key      string
+		dst      interface{}
+		required bool
+	}{
+		{"instance_types", &ng.InstanceTypes, true},
+		{"desired_size", &ng.DesiredSize, true},
+		{"min_size", &ng.MinSize, true},
+		{"max_size", &ng.MaxSize, true},
+		{"disk_size", &ng.DiskSize, false},
+		{"capacity_type", &ng.CapacityType, false},
+		{"ami_type", &ng.AMIType, false},
+		{"custom_ami_id", &ng.CustomAMIID, false},
+		{"labels", &ng.Labels, false},
+	}
+	for _, f := range fields {
+		a := attr(f.key)
+		if a.IsNull() {
+			if f.required {
+				return ng, fmt.Errorf("%s is required", f.key)
+			}
+			continue
+		}
+		if err := decode(a, f.dst); err != nil {
+			return ng, fmt.Errorf("%s: %w", f.key, err)
+		}
+	}
+
+	taints := attr("taints")
+	if !taints.IsNull() && taints.CanIterateElements() {
+		for it := taints.ElementIterator(); it.Next(); {
+			_, t := it.Element()
+			var taint Taint
+			for key, dst := range map[string]*string{"key": &taint.Key, "value": &taint.Value, "effect": &taint.Effect} {
+				if t.Type().IsObjectType() && t.Type().HasAttribute(key) && !t.GetAttr(key).IsNull() {
+					if err := decode(t.GetAttr(key), dst); err != nil {
+						return ng, fmt.Errorf("taints.%s: %w", key, err)
+					}
+				}
+			}
+			ng.Taints = append(ng.Taints, taint)
+		}
+	}
+	return ng, nil
+}
+
+// decode converts v into dst, treating a null or missing value as zero.
+func decode(v cty.Value, dst interface{}) error {
+	if v == cty.NilVal || v.IsNull() {
+		return nil
+	}
+	return gocty.FromCtyValue(convert(v, dst), dst)
+}
+
+// convert turns tuple and object literals into the list and map types
+// gocty expects for dst.
+func convert(v cty.Value, dst interface{}) cty.Value {
+	switch dst.(type) {
+	case *[]string:
+		if v.CanIterateElements() {
+			var items []cty.Value
+			for it := v.ElementIterator(); it.Next(); {
+				_, e := it.Element()
+				items = append(items, e)
+			}
+			if len(items) == 0 {
+				return cty.ListValEmpty(cty.String)
+			}
+			return cty.ListVal(items)
+		}
+	case *map[string]string:
+		if v.CanIterateElements() {
+			items := map[string]cty.Value{}
+			for it := v.ElementIterator(); it.Next(); {
+				k, e := it.Element()
+				items[k.AsString()] = e
+			}
+			if len(items) == 0 {
+				return cty.MapValEmpty(cty.String)
+			}
+			return cty.MapVal(items)
+		}
+	}
+	return v
+}
+
+func isString(v cty.Value) bool {
+	return v != cty.NilVal && !v.IsNull() && v.Type() == cty.String
+}
@@ -0,0 +1,96 @@
+package karpenter
+
+import (
+	"sort"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// SystemGroup returns the node group to keep under EKS once Karpenter runs:
+// the first ON_DEMAND group, cut to 1-2 nodes and tainted so only critical
+// add-ons, including Karpenter itself, schedule onto it.
+func (m *Migration) SystemGroup() NodeGroup {
+	groups := m.Cluster.NodeGroups
+	if len(groups) == 0 {
+		return NodeGroup{}
+	}
+	keep := groups[0]
+	for _, ng := range groups {
+		if ng.CapacityType != "SPOT" {
+			keep = ng
+			break
+		}
+	}
+	sys := keep
+	sys.Name = "system"
+	sys.CapacityType = "ON_DEMAND"
+	sys.MinSize, sys.DesiredSize, sys.MaxSize = 1, 1, 2
+	sys.Taints = []Taint{{Key: "CriticalAddonsOnly", Value: "true", Effect: "NO_SCHEDULE"}}
+	return sys
+}
+
+// Inputs returns the module arguments that finish the migration, as HCL to
+// merge into the environment's module blocks.
+func (m *Migration) Inputs() []byte {
+	f := hclwrite.NewEmptyFile()
+	root := f.Body()
+
+	eks := root.AppendNewBlock("module", []string{m.Cluster.Module}).Body()
+	eks.SetAttributeValue("enable_cluster_autoscaler_irsa", cty.False)
+	sys := m.SystemGroup()
+	eks.SetAttributeValue("node_groups", cty.ObjectVal(map[string]cty.Value{sys.Name: nodeGroupValue(sys)}))
+
+	if m.Cluster.AddonsModule != "" {
+		root.AppendNewline()
+		addons := root.AppendNewBlock("module", []string{m.Cluster.AddonsModule}).Body()
+		addons.SetAttributeValue("enable_karpenter", cty.True)
+	}
+	return f.Bytes()
+}
+
+// nodeGroupValue renders ng in the shape of the node_groups variable,
+// leaving out attributes that match the module defaults.
+func nodeGroupValue(ng NodeGroup) cty.Value {
+	var types []cty.Value
+	for _, t := range ng.InstanceTypes {
+		types = append(types, cty.StringVal(t))
+	}
+	attrs := map[string]cty.Value{
+		"instance_types": cty.TupleVal(types),
+		"capacity_type":  cty.StringVal(ng.CapacityType),
+		"min_size":       cty.NumberIntVal(int64(ng.MinSize)),
+		"desired_size":   cty.NumberIntVal(int64(ng.DesiredSize)),
+		"max_size":       cty.NumberIntVal(int64(ng.MaxSize)),
+	}
+	if ng.DiskSize != 0 && ng.DiskSize != 50 {
+		attrs["disk_size"] = cty.NumberIntVal(int64(ng.DiskSize))
+	}
+	if ng.AMIType != "" && ng.AMIType != "AL2_x86_64" {
+		attrs["ami_type"] = cty.StringVal(ng.AMIType)
+	}
+	if len(ng.Labels) > 0 {
+		labels := map[string]cty.Value{}
+		keys := make([]string, 0, len(ng.Labels))
+		for k := range ng.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			labels[k] = cty.StringVal(ng.Labels[k])
+		}
+		attrs["labels"] = cty.ObjectVal(labels)
+	}
+	var taints []cty.Value
+	for _, t := range ng.Taints {
+		taints = append(taints, cty.ObjectVal(map[string]cty.Value{
+			"key":    cty.StringVal(t.Key),
+			"value":  cty.StringVal(t.Value),
+			"effect": cty.StringVal(t.Effect),
+		}))
+	}
+	if len(taints) > 0 {
+		attrs["taints"] = cty.TupleVal(taints)
+	}
+	return cty.ObjectVal(attrs)
+}
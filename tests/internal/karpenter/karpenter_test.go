@@ -0,0 +1,162 @@
+package karpenter_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/yaml"
+
+	"github.com/yourorg/tf-modules/tests/internal/cost"
+	"github.com/yourorg/tf-modules/tests/internal/karpenter"
+)
+
+func TestLoad(t *testing.T) {
+	c, err := karpenter.Load("testdata/env", "")
+	require.NoError(t, err)
+	assert.Equal(t, "eks", c.Module)
+	assert.Equal(t, "demo-stage-eks", c.Name)
+	assert.Equal(t, "eks_addons", c.AddonsModule)
+	assert.True(t, c.IMDSv2Required)
+	assert.Equal(t, 2, c.HopLimit)
+	assert.True(t, c.ClusterAutoscalerIRSA)
+	require.Len(t, c.NodeGroups, 2)
+
+	batch, system := c.NodeGroups[0], c.NodeGroups[1]
+	assert.Equal(t, karpenter.NodeGroup{
+		Name:          "batch",
+		InstanceTypes: []string{"m6g.xlarge", "m5.xlarge", "x9.huge"},
+		DesiredSize:   1,
+		MaxSize:       5,
+		DiskSize:      100,
+		CapacityType:  "SPOT",
+		AMIType:       "AL2_ARM_64",
+		Labels:        map[string]string{"karpenter.sh/provisioner-name": "default", "node.kubernetes.io/lifecycle": "spot"},
+		Taints:        []karpenter.Taint{{Key: "batch", Value: "true", Effect: "NO_SCHEDULE"}},
+	}, batch)
+	// disk_size, capacity_type and ami_type come from the module's optional() defaults.
+	assert.Equal(t, 50, system.DiskSize)
+	assert.Equal(t, "ON_DEMAND", system.CapacityType)
+	assert.Equal(t, "AL2_x86_64", system.AMIType)
+
+	_, err = karpenter.Load("testdata/env", "other")
+	assert.EqualError(t, err, `testdata/env: no aws/eks module call named "other"`)
+}
+
+func TestTranslate(t *testing.T) {
+	c, err := karpenter.Load("testdata/env", "")
+	require.NoError(t, err)
+	m := karpenter.Translate(c)
+	require.Len(t, m.NodePools, 2)
+
+	batch := m.NodePools[0].Spec
+	assert.Equal(t, []karpenter.Requirement{
+		{Key: "node.kubernetes.io/instance-type", Operator: "In", Values: []string{"m5.xlarge", "m6g.xlarge", "x9.huge"}},
+		{Key: "karpenter.sh/capacity-type", Operator: "In", Values: []string{"spot"}},
+		{Key: "kubernetes.io/arch", Operator: "In", Values: []string{"arm64"}},
+	}, batch.Template.Spec.Requirements)
+	assert.Equal(t, []karpenter.KubeTaint{{Key: "batch", Value: "true", Effect: "NoSchedule"}}, batch.Template.Spec.Taints)
+	assert.Equal(t, map[string]string{"node.kubernetes.io/lifecycle": "spot"}, batch.Template.Metadata.Labels)
+	assert.Equal(t, map[string]string{"cpu": "20", "memory": "80Gi"}, batch.Limits)
+
+	class := m.NodeClasses[1].Spec
+	assert.Equal(t, "AL2", class.AMIFamily)
+	assert.Equal(t, "demo-stage-eks-node-role", class.Role)
+	assert.Equal(t, "50Gi", class.BlockDeviceMappings[0].EBS.VolumeSize)
+	assert.Equal(t, karpenter.MetadataOptions{HTTPEndpoint: "enabled", HTTPTokens: "required", HTTPPutResponseHopLimit: 2}, class.MetadataOptions)
+	assert.Equal(t, map[string]string{"karpenter.sh/discovery": "demo-stage-eks"}, class.SubnetSelectorTerms[0].Tags)
+
+	var notes []string
+	for _, n := range m.Notes {
+		notes = append(notes, n.String())
+	}
+	assert.Equal(t, []string{
+		"subnets: aws/vpc does not tag subnets for Karpenter; tag the private subnets karpenter.sh/discovery=demo-stage-eks before applying",
+		"enable_cluster_autoscaler_irsa: Cluster Autoscaler and Karpenter must not manage the same nodes; scale it down before enabling Karpenter",
+		"batch.instance_types: m5.xlarge is amd64 but ami_type AL2_ARM_64 is arm64; Karpenter will not launch it",
+		"batch.instance_types: x9.huge is not in the instance table; capacity and limits ignore it",
+		"batch.labels: karpenter.sh/provisioner-name is in a domain Karpenter manages and was dropped",
+		"batch.desired_size: Karpenter has no desired count; it launches nodes for pending pods (was 1)",
+		"system.desired_size: Karpenter has no desired count; it launches nodes for pending pods (was 2)",
+		"system.min_size: Karpenter keeps no minimum; keep a managed group for the 2 nodes that must always run",
+	}, notes)
+
+	out, err := m.Manifests()
+	require.NoError(t, err)
+	var kinds []string
+	for _, doc := range strings.Split(string(out), "---\n") {
+		var obj map[string]interface{}
+		require.NoError(t, yaml.Unmarshal([]byte(doc), &obj))
+		kinds = append(kinds, obj["kind"].(string)+"/"+obj["metadata"].(map[string]interface{})["name"].(string))
+	}
+	assert.Equal(t, []string{"EC2NodeClass/batch", "NodePool/batch", "EC2NodeClass/system", "NodePool/system"}, kinds)
+}
+
+func TestCompare(t *testing.T) {
+	c, err := karpenter.Load("testdata/env", "")
+	require.NoError(t, err)
+	table, err := cost.VendoredTable("2026-10")
+	require.NoError(t, err)
+
+	caps := karpenter.Translate(c).Compare(table)
+	require.Len(t, caps, 2)
+	// batch has an instance type without a price.
+	assert.False(t, caps[0].Priced)
+	assert.Equal(t, 20, caps[0].MaxVCPU)
+
+	system := caps[1]
+	assert.True(t, system.Priced)
+	assert.Equal(t, 4, system.DesiredVCPU)
+	assert.Equal(t, 16.0, system.DesiredMemoryGiB)
+	assert.Equal(t, 8, system.MaxVCPU)
+	assert.Equal(t, "8", system.LimitCPU)
+	assert.Equal(t, "32Gi", system.LimitMemory)
+	hourly := table.Prices["aws.ec2.m5.large.hour"]
+	assert.InDelta(t, hourly*table.HoursPerMonth*2, system.DesiredMonthly, 0.001)
+	assert.InDelta(t, hourly*table.HoursPerMonth*4, system.MaxMonthly, 0.001)
+}
+
+func TestInputs(t *testing.T) {
+	c, err := karpenter.Load("testdata/env", "")
+	require.NoError(t, err)
+	assert.Equal(t, `module "eks" {
+  enable_cluster_autoscaler_irsa = false
+  node_groups = {
+    system = {
+      capacity_type  = "ON_DEMAND"
+      desired_size   = 1
+      instance_types = ["m5.large"]
+      labels = {
+        role = "system"
+      }
+      max_size = 2
+      min_size = 1
+      taints = [{
+        effect = "NO_SCHEDULE"
+        key    = "CriticalAddonsOnly"
+        value  = "true"
+      }]
+    }
+  }
+}
+
+module "eks_addons" {
+  enable_karpenter = true
+}
+`, string(karpenter.Translate(c).Inputs()))
+}
+
+func TestEnvironments(t *testing.T) {
+	for _, env := range []string{"dev", "prod"} {
+		t.Run(env, func(t *testing.T) {
+			c, err := karpenter.Load("../../../environments/"+env, "")
+			require.NoError(t, err)
+			assert.Equal(t, "tfmodules-"+env+"-eks", c.Name)
+			require.NotEmpty(t, c.NodeGroups)
+			for _, np := range karpenter.Translate(c).NodePools {
+				assert.NotEmpty(t, np.Spec.Limits, np.Metadata.Name)
+			}
+		})
+	}
+}
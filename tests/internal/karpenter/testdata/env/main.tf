@@ -0,0 +1,52 @@
+variable "project" {
+  type    = string
+  default = "demo"
+}
+
+locals {
+  environment = "stage"
+}
+
+module "eks" {
+  source = "../../../../../modules/aws/eks"
+
+  project     = var.project
+  environment = local.environment
+
+  vpc_id     = "vpc-00000000"
+  subnet_ids = ["subnet-00000000"]
+
+  enable_cluster_autoscaler_irsa       = true
+  metadata_http_put_response_hop_limit = 2
+
+  node_groups = {
+    system = {
+      instance_types = ["m5.large"]
+      min_size       = 2
+      max_size       = 4
+      desired_size   = 2
+      labels         = { role = "system" }
+    }
+    batch = {
+      instance_types = ["m6g.xlarge", "m5.xlarge", "x9.huge"]
+      capacity_type  = "SPOT"
+      ami_type       = "AL2_ARM_64"
+      disk_size      = 100
+      min_size       = 0
+      max_size       = 5
+      desired_size   = 1
+      labels         = { "karpenter.sh/provisioner-name" = "default", "node.kubernetes.io/lifecycle" = "spot" }
+      taints = [{
+        key    = "batch"
+        value  = "true"
+        effect = "NO_SCHEDULE"
+      }]
+    }
+  }
+}
+
+module "eks_addons" {
+  source = "../../../../../modules/aws/eks-addons"
+
+  cluster_name = module.eks.cluster_name
+}
@@ -0,0 +1,341 @@
+package karpenter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// APIVersion is the Karpenter API the manifests target; it matches the
+// karpenter_version eks-addons installs.
+const APIVersion = "karpenter.sh/v1beta1"
+
+// Meta is the metadata of a generated manifest.
+type Meta struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Requirement is a NodePool node selector requirement.
+type Requirement struct {
+	Key      string   `json:"key"`
+	Operator string   `json:"operator"`
+	Values   []string `json:"values"`
+}
+
+// KubeTaint is a taint in Kubernetes form, e.g. effect NoSchedule.
+type KubeTaint struct {
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"`
+	Effect string `json:"effect"`
+}
+
+// NodePool is a karpenter.sh/v1beta1 NodePool.
+type NodePool struct {
+	APIVersion string       `json:"apiVersion"`
+	Kind       string       `json:"kind"`
+	Metadata   Meta         `json:"metadata"`
+	Spec       NodePoolSpec `json:"spec"`
+}
+
+// NodePoolSpec is the spec of a NodePool.
+type NodePoolSpec struct {
+	Template   NodeClaimTemplate `json:"template"`
+	Limits     map[string]string `json:"limits,omitempty"`
+	Disruption Disruption        `json:"disruption"`
+}
+
+// NodeClaimTemplate describes the nodes a NodePool launches.
+type NodeClaimTemplate struct {
+	Metadata struct {
+		Labels map[string]string `json:"labels,omitempty"`
+	} `json:"metadata"`
+	Spec NodeClaimSpec `json:"spec"`
+}
+
+// NodeClaimSpec selects the node class, instance requirements and taints.
+type NodeClaimSpec struct {
+	NodeClassRef struct {
+		Name string `json:"name"`
+	} `json:"nodeClassRef"`
+	Requirements []Requirement `json:"requirements"`
+	Taints       []KubeTaint   `json:"taints,omitempty"`
+}
+
+// Disruption controls when Karpenter replaces or removes nodes.
+type Disruption struct {
+	ConsolidationPolicy string `json:"consolidationPolicy"`
+	ExpireAfter         string `json:"expireAfter"`
+}
+
+// EC2NodeClass is a karpenter.k8s.aws/v1beta1 EC2NodeClass.
+type EC2NodeClass struct {
+	APIVersion string           `json:"apiVersion"`
+	Kind       string           `json:"kind"`
+	Metadata   Meta             `json:"metadata"`
+	Spec       EC2NodeClassSpec `json:"spec"`
+}
+
+// EC2NodeClassSpec is the spec of an EC2NodeClass.
+type EC2NodeClassSpec struct {
+	AMIFamily                  string               `json:"amiFamily"`
+	AMISelectorTerms           []map[string]string  `json:"amiSelectorTerms,omitempty"`
+	Role                       string               `json:"role"`
+	SubnetSelectorTerms        []SelectorTerm       `json:"subnetSelectorTerms"`
+	SecurityGroupSelectorTerms []SelectorTerm       `json:"securityGroupSelectorTerms"`
+	BlockDeviceMappings        []BlockDeviceMapping `json:"blockDeviceMappings"`
+	MetadataOptions            MetadataOptions      `json:"metadataOptions"`
+}
+
+// SelectorTerm matches subnets or security groups by tag.
+type SelectorTerm struct {
+	Tags map[string]string `json:"tags"`
+}
+
+// BlockDeviceMapping is the root volume of launched nodes.
+type BlockDeviceMapping struct {
+	DeviceName string `json:"deviceName"`
+	EBS        struct {
+		VolumeSize string `json:"volumeSize"`
+		VolumeType string `json:"volumeType"`
+		Encrypted  bool   `json:"encrypted"`
+	} `json:"ebs"`
+}
+
+// MetadataOptions are the instance metadata service settings.
+type MetadataOptions struct {
+	HTTPEndpoint            string `json:"httpEndpoint"`
+	HTTPTokens              string `json:"httpTokens"`
+	HTTPPutResponseHopLimit int    `json:"httpPutResponseHopLimit"`
+}
+
+// Note is a node group setting the translation could not carry over, or
+// something to do by hand. NodeGroup is "" for cluster-level notes.
+type Note struct {
+	NodeGroup string
+	Setting   string
+	Message   string
+}
+
+func (n Note) String() string {
+	if n.NodeGroup == "" {
+		return n.Setting + ": " + n.Message
+	}
+	return n.NodeGroup + "." + n.Setting + ": " + n.Message
+}
+
+// Migration is the Karpenter equivalent of a cluster's node groups.
+type Migration struct {
+	Cluster     *Cluster
+	NodePools   []NodePool
+	NodeClasses []EC2NodeClass
+	Notes       []Note
+}
+
+// DiscoveryTag is the tag the generated subnet selectors match. aws/vpc
+// does not set it, so it has to be added to the private subnets.
+const DiscoveryTag = "karpenter.sh/discovery"
+
+var taintEffects = map[string]string{
+	"NO_SCHEDULE":        "NoSchedule",
+	"NO_EXECUTE":         "NoExecute",
+	"PREFER_NO_SCHEDULE": "PreferNoSchedule",
+}
+
+// amiFamilies maps EKS ami_type to the Karpenter amiFamily and the
+// architecture it implies.
+var amiFamilies = map[string]struct{ family, arch string }{
+	"AL2_x86_64":                 {"AL2", "amd64"},
+	"AL2_ARM_64":                 {"AL2", "arm64"},
+	"AL2023_x86_64_STANDARD":     {"AL2023", "amd64"},
+	"AL2023_ARM_64_STANDARD":     {"AL2023", "arm64"},
+	"BOTTLEROCKET_x86_64":        {"Bottlerocket", "amd64"},
+	"BOTTLEROCKET_ARM_64":        {"Bottlerocket", "arm64"},
+	"CUSTOM":                     {"Custom", ""},
+	"AL2_x86_64_GPU":             {"AL2", "amd64"},
+	"BOTTLEROCKET_x86_64_NVIDIA": {"Bottlerocket", "amd64"},
+}
+
+// restrictedLabelDomains are label domains Karpenter refuses in a NodePool
+// template because it manages them itself; labelDomainExceptions are the
+// subdomains it still allows.
+var (
+	restrictedLabelDomains = []string{"kubernetes.io", "k8s.io", "karpenter.sh", "karpenter.k8s.aws"}
+	labelDomainExceptions  = []string{"node.kubernetes.io", "node-restriction.kubernetes.io", "kops.k8s.io"}
+)
+
+// Translate builds one NodePool and EC2NodeClass per node group.
+func Translate(c *Cluster) *Migration {
+	m := &Migration{Cluster: c}
+	cluster := c.clusterName()
+
+	if c.Name == "" {
+		m.note("", "cluster_name", "project or environment is not known offline; replace <cluster_name> in the manifests")
+	}
+	m.note("", "subnets", fmt.Sprintf("aws/vpc does not tag subnets for Karpenter; tag the private subnets %s=%s before applying", DiscoveryTag, cluster))
+	if c.ClusterAutoscalerIRSA {
+		m.note("", "enable_cluster_autoscaler_irsa", "Cluster Autoscaler and Karpenter must not manage the same nodes; scale it down before enabling Karpenter")
+	}
+	if c.AddonsModule == "" {
+		m.note("", "enable_karpenter", "no aws/eks-addons call found; Karpenter itself must be installed separately")
+	}
+
+	for _, ng := range c.NodeGroups {
+		m.NodePools = append(m.NodePools, m.nodePool(ng))
+		m.NodeClasses = append(m.NodeClasses, m.nodeClass(ng, cluster))
+	}
+	return m
+}
+
+func (m *Migration) note(group, setting, msg string) {
+	m.Notes = append(m.Notes, Note{NodeGroup: group, Setting: setting, Message: msg})
+}
+
+func (m *Migration) nodePool(ng NodeGroup) NodePool {
+	np := NodePool{APIVersion: APIVersion, Kind: "NodePool", Metadata: Meta{Name: ng.Name}}
+	spec := &np.Spec
+	spec.Template.Spec.NodeClassRef.Name = ng.Name
+	spec.Disruption = Disruption{ConsolidationPolicy: "WhenUnderutilized", ExpireAfter: "720h"}
+
+	types := append([]string(nil), ng.InstanceTypes...)
+	sort.Strings(types)
+	spec.Template.Spec.Requirements = append(spec.Template.Spec.Requirements,
+		Requirement{Key: "node.kubernetes.io/instance-type", Operator: "In", Values: types})
+
+	capacity := "on-demand"
+	switch ng.CapacityType {
+	case "SPOT":
+		capacity = "spot"
+	case "ON_DEMAND", "":
+	default:
+		m.note(ng.Name, "capacity_type", fmt.Sprintf("unknown capacity type %q; using on-demand", ng.CapacityType))
+	}
+	spec.Template.Spec.Requirements = append(spec.Template.Spec.Requirements,
+		Requirement{Key: "karpenter.sh/capacity-type", Operator: "In", Values: []string{capacity}})
+
+	arch := amiFamilies[ng.AMIType].arch
+	for _, t := range ng.InstanceTypes {
+		it, ok := instanceTypes[t]
+		switch {
+		case !ok:
+			m.note(ng.Name, "instance_types", fmt.Sprintf("%s is not in the instance table; capacity and limits ignore it", t))
+		case arch != "" && it.Arch != arch:
+			m.note(ng.Name, "instance_types", fmt.Sprintf("%s is %s but ami_type %s is %s; Karpenter will not launch it", t, it.Arch, ng.AMIType, arch))
+		}
+	}
+	if arch != "" {
+		spec.Template.Spec.Requirements = append(spec.Template.Spec.Requirements,
+			Requirement{Key: "kubernetes.io/arch", Operator: "In", Values: []string{arch}})
+	}
+
+	labels := map[string]string{}
+	for k, v := range ng.Labels {
+		if restrictedLabel(k) {
+			m.note(ng.Name, "labels", fmt.Sprintf("%s is in a domain Karpenter manages and was dropped", k))
+			continue
+		}
+		labels[k] = v
+	}
+	if len(labels) > 0 {
+		spec.Template.Metadata.Labels = labels
+	}
+
+	for _, t := range ng.Taints {
+		effect, ok := taintEffects[t.Effect]
+		if !ok {
+			m.note(ng.Name, "taints", fmt.Sprintf("taint %s has unknown effect %q and was dropped", t.Key, t.Effect))
+			continue
+		}
+		spec.Template.Spec.Taints = append(spec.Template.Spec.Taints, KubeTaint{Key: t.Key, Value: t.Value, Effect: effect})
+	}
+
+	if cpu, mem, ok := largest(ng.InstanceTypes); ok {
+		spec.Limits = map[string]string{
+			"cpu":    fmt.Sprint(cpu * ng.MaxSize),
+			"memory": fmt.Sprintf("%gGi", mem*float64(ng.MaxSize)),
+		}
+	}
+
+	m.note(ng.Name, "desired_size", fmt.Sprintf("Karpenter has no desired count; it launches nodes for pending pods (was %d)", ng.DesiredSize))
+	if ng.MinSize > 0 {
+		m.note(ng.Name, "min_size", fmt.Sprintf("Karpenter keeps no minimum; keep a managed group for the %d nodes that must always run", ng.MinSize))
+	}
+	return np
+}
+
+func (m *Migration) nodeClass(ng NodeGroup, cluster string) EC2NodeClass {
+	nc := EC2NodeClass{APIVersion: "karpenter.k8s.aws/v1beta1", Kind: "EC2NodeClass", Metadata: Meta{Name: ng.Name}}
+	spec := &nc.Spec
+
+	family, ok := amiFamilies[ng.AMIType]
+	if !ok {
+		m.note(ng.Name, "ami_type", fmt.Sprintf("%s has no Karpenter AMI family; using AL2", ng.AMIType))
+		family.family = "AL2"
+	}
+	spec.AMIFamily = family.family
+	switch {
+	case ng.CustomAMIID != "":
+		spec.AMIFamily = "Custom"
+		spec.AMISelectorTerms = []map[string]string{{"id": ng.CustomAMIID}}
+		m.note(ng.Name, "custom_ami_id", "the module's launch template bootstrap is not carried over; set spec.userData to join the cluster")
+	case strings.Contains(ng.AMIType, "GPU") || strings.Contains(ng.AMIType, "NVIDIA"):
+		m.note(ng.Name, "ami_type", fmt.Sprintf("%s: Karpenter picks the GPU variant only for GPU instance types; install the NVIDIA device plugin separately", ng.AMIType))
+	case strings.HasPrefix(ng.AMIType, "WINDOWS"):
+		m.note(ng.Name, "ami_type", fmt.Sprintf("%s: Windows nodes need a Windows2019 or Windows2022 amiFamily and kubernetes.io/os requirement", ng.AMIType))
+	}
+
+	spec.Role = cluster + "-node-role"
+	spec.SubnetSelectorTerms = []SelectorTerm{{Tags: map[string]string{DiscoveryTag: cluster}}}
+	spec.SecurityGroupSelectorTerms = []SelectorTerm{{Tags: map[string]string{"kubernetes.io/cluster/" + cluster: "owned"}}}
+
+	bdm := BlockDeviceMapping{DeviceName: "/dev/xvda"}
+	if spec.AMIFamily == "Bottlerocket" {
+		bdm.DeviceName = "/dev/xvdb"
+	}
+	bdm.EBS.VolumeSize = fmt.Sprintf("%dGi", ng.DiskSize)
+	bdm.EBS.VolumeType = "gp3"
+	bdm.EBS.Encrypted = true
+	spec.BlockDeviceMappings = []BlockDeviceMapping{bdm}
+
+	spec.MetadataOptions = MetadataOptions{HTTPEndpoint: "enabled", HTTPTokens: "optional", HTTPPutResponseHopLimit: m.Cluster.HopLimit}
+	if m.Cluster.IMDSv2Required {
+		spec.MetadataOptions.HTTPTokens = "required"
+	}
+	return nc
+}
+
+func restrictedLabel(key string) bool {
+	domain, _, ok := strings.Cut(key, "/")
+	if !ok {
+		return false
+	}
+	for _, d := range labelDomainExceptions {
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return false
+		}
+	}
+	for _, d := range restrictedLabelDomains {
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// Manifests returns the NodeClasses and NodePools as a multi-document YAML
+// stream, ready for kubectl apply.
+func (m *Migration) Manifests() ([]byte, error) {
+	var docs []string
+	for i := range m.NodeClasses {
+		for _, obj := range []interface{}{m.NodeClasses[i], m.NodePools[i]} {
+			out, err := yaml.Marshal(obj)
+			if err != nil {
+				return nil, err
+			}
+			docs = append(docs, string(out))
+		}
+	}
+	return []byte(strings.Join(docs, "---\n")), nil
+}
@@ -0,0 +1,88 @@
+package keypolicy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Want is what the planned keys should look like.
+type Want struct {
+	// Account is the account whose root must administer every key.
+	Account string
+	// Services maps a service principal, e.g. logs.amazonaws.com, to the
+	// address suffixes of the only keys it may use.
+	Services map[string][]string
+	Rotation bool
+	// DeletionWindow is the expected deletion_window_in_days.
+	DeletionWindow int
+}
+
+// Finding is a key that does not match Want.
+type Finding struct {
+	Key string
+	// Check is root-admin, service-use, rotation or deletion-window.
+	Check   string
+	Message string
+}
+
+func (f Finding) Error() string {
+	return f.Key + ": " + f.Check + ": " + f.Message
+}
+
+// Check compares keys with want. Keys whose policy is unknown are checked
+// for their settings only.
+func Check(keys []Key, want Want) []Finding {
+	services := make([]string, 0, len(want.Services))
+	for s := range want.Services {
+		services = append(services, s)
+	}
+	sort.Strings(services)
+
+	var out []Finding
+	for _, k := range keys {
+		add := func(check, format string, args ...interface{}) {
+			out = append(out, Finding{Key: k.Address, Check: check, Message: fmt.Sprintf(format, args...)})
+		}
+
+		if k.Policy != nil {
+			root := Root(want.Account)
+			var missing []string
+			for _, a := range AdminActions {
+				if d := Allows(k.Policy, root, a); !d.Allowed || d.Conditional {
+					missing = append(missing, a)
+				}
+			}
+			if len(missing) > 0 {
+				add("root-admin", "%s cannot %s", root.ID, strings.Join(missing, ", "))
+			}
+
+			for _, svc := range services {
+				allowed := false
+				for _, suffix := range want.Services[svc] {
+					allowed = allowed || k.Is(suffix)
+				}
+				var can []string
+				for _, a := range UseActions {
+					if Allows(k.Policy, Service(svc), a).Allowed {
+						can = append(can, a)
+					}
+				}
+				switch {
+				case !allowed && len(can) > 0:
+					add("service-use", "%s can %s but may use only %s", svc, strings.Join(can, ", "), strings.Join(want.Services[svc], ", "))
+				case allowed && len(can) == 0:
+					add("service-use", "%s cannot use the key", svc)
+				}
+			}
+		}
+
+		if k.Rotation != nil && *k.Rotation != want.Rotation {
+			add("rotation", "enable_key_rotation is %t, want %t", *k.Rotation, want.Rotation)
+		}
+		if k.DeletionWindow != want.DeletionWindow {
+			add("deletion-window", "deletion_window_in_days is %d, want %d", k.DeletionWindow, want.DeletionWindow)
+		}
+	}
+	return out
+}
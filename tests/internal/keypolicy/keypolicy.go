@@ -0,0 +1,197 @@
+// Package keypolicy evaluates the key policies and settings of planned KMS
+// keys: which principals can use or administer each key, and whether
+// rotation and the deletion window match the module inputs.
+package keypolicy
+
+import (
+	"regexp"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+
+	"github.com/yourorg/tf-modules/tests/internal/iampolicy"
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+)
+
+// UseActions are the cryptographic operations a service needs to encrypt
+// with a key.
+var UseActions = []string{
+	"kms:Encrypt",
+	"kms:Decrypt",
+	"kms:ReEncryptFrom",
+	"kms:ReEncryptTo",
+	"kms:GenerateDataKey",
+	"kms:GenerateDataKeyWithoutPlaintext",
+}
+
+// AdminActions are the operations the account root must keep so that IAM
+// policies in the account can manage the key and it cannot be locked out.
+var AdminActions = []string{
+	"kms:PutKeyPolicy",
+	"kms:GetKeyPolicy",
+	"kms:DescribeKey",
+	"kms:EnableKeyRotation",
+	"kms:ScheduleKeyDeletion",
+	"kms:CancelKeyDeletion",
+	"kms:CreateGrant",
+	"kms:RevokeGrant",
+	"kms:TagResource",
+}
+
+// Key is a planned aws_kms_key or aws_kms_replica_key.
+type Key struct {
+	Address string
+	Replica bool
+	// Policy is nil when the key policy is not known until apply, as for a
+	// replica key that inherits the default policy.
+	Policy *iampolicy.Policy
+	// Rotation is nil for replica keys, which follow their primary.
+	Rotation       *bool
+	DeletionWindow int
+}
+
+var indexRe = regexp.MustCompile(`\[[^\]]*\]$`)
+
+// Is reports whether the key's address, without its index, ends in
+// suffix, e.g. aws_kms_key.logs for module.kms.aws_kms_key.logs[0].
+func (k Key) Is(suffix string) bool {
+	return strings.HasSuffix(indexRe.ReplaceAllString(k.Address, ""), suffix)
+}
+
+// Keys returns the planned KMS keys, sorted by address.
+func Keys(plan *tfjson.Plan) ([]Key, error) {
+	var out []Key
+	for _, r := range planjson.OfType(planjson.Resources(plan), "aws_kms_key", "aws_kms_replica_key") {
+		k := Key{Address: r.Address, Replica: r.Type == "aws_kms_replica_key"}
+		if doc := planjson.String(r.Values, "policy"); doc != "" {
+			p, err := iampolicy.Parse(doc)
+			if err != nil {
+				return nil, err
+			}
+			k.Policy = p
+		}
+		if b, ok := planjson.Bool(r.Values, "enable_key_rotation"); ok && !k.Replica {
+			k.Rotation = &b
+		}
+		if n, ok := planjson.Number(r.Values, "deletion_window_in_days"); ok {
+			k.DeletionWindow = int(n)
+		}
+		out = append(out, k)
+	}
+	return out, nil
+}
+
+// Account returns the account ID data.aws_caller_identity read during
+// plan, or "" if the plan has none.
+func Account(plan *tfjson.Plan) string {
+	if plan.PriorState == nil || plan.PriorState.Values == nil || plan.PriorState.Values.RootModule == nil {
+		return ""
+	}
+	var walk func(m *tfjson.StateModule) string
+	walk = func(m *tfjson.StateModule) string {
+		for _, r := range m.Resources {
+			if r.Mode == tfjson.DataResourceMode && r.Type == "aws_caller_identity" {
+				if id, _ := r.AttributeValues["account_id"].(string); id != "" {
+					return id
+				}
+			}
+		}
+		for _, c := range m.ChildModules {
+			if id := walk(c); id != "" {
+				return id
+			}
+		}
+		return ""
+	}
+	return walk(plan.PriorState.Values.RootModule)
+}
+
+// Principal is who a key policy statement applies to.
+type Principal struct {
+	// Type is AWS or Service.
+	Type string
+	ID   string
+}
+
+// Root returns the principal for the root of account.
+func Root(account string) Principal {
+	return Principal{Type: "AWS", ID: "arn:aws:iam::" + account + ":root"}
+}
+
+// Service returns the principal for an AWS service, e.g.
+// logs.amazonaws.com.
+func Service(name string) Principal {
+	return Principal{Type: "Service", ID: name}
+}
+
+// names reports whether the statement's principals include who. An AWS
+// account ID is the same principal as its root ARN; "*" names everyone.
+func names(s iampolicy.Statement, who Principal) bool {
+	for _, id := range s.Principals["AWS"] {
+		if id == "*" {
+			return true
+		}
+	}
+	for _, id := range s.Principals[who.Type] {
+		if id == who.ID {
+			return true
+		}
+		if who.Type == "AWS" && "arn:aws:iam::"+id+":root" == who.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// Decision is the outcome of evaluating one action by one principal.
+type Decision struct {
+	Allowed bool
+	// Statement is the ID of the deciding statement: the matching Deny,
+	// or the first matching Allow, preferring one without conditions.
+	Statement string
+	// Conditional is true when the deciding Allow has conditions, which
+	// Allows does not evaluate.
+	Conditional bool
+}
+
+// Allows evaluates the key policy for who calling action. An unconditional
+// Deny wins; a Deny with conditions is assumed not to apply, and an Allow
+// with conditions to apply, so the result errs towards access.
+func Allows(p *iampolicy.Policy, who Principal, action string) Decision {
+	var allow *Decision
+	for i, s := range p.Statements {
+		if !names(s, who) || !covers(s, action) {
+			continue
+		}
+		if !s.Allow() {
+			if len(s.Conditions) == 0 {
+				return Decision{Statement: s.ID(i)}
+			}
+			continue
+		}
+		if allow == nil || (allow.Conditional && len(s.Conditions) == 0) {
+			allow = &Decision{Allowed: true, Statement: s.ID(i), Conditional: len(s.Conditions) > 0}
+		}
+	}
+	if allow == nil {
+		return Decision{}
+	}
+	return *allow
+}
+
+func covers(s iampolicy.Statement, action string) bool {
+	if len(s.NotActions) > 0 {
+		for _, a := range s.NotActions {
+			if iampolicy.MatchAction(a, action) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, a := range s.Actions {
+		if iampolicy.MatchAction(a, action) {
+			return true
+		}
+	}
+	return false
+}
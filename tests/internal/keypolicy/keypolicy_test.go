@@ -0,0 +1,78 @@
+package keypolicy_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/keypolicy"
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+)
+
+func load(t *testing.T) ([]keypolicy.Key, string) {
+	t.Helper()
+	plan, err := planjson.Load("testdata/plan.json")
+	require.NoError(t, err)
+	keys, err := keypolicy.Keys(plan)
+	require.NoError(t, err)
+	return keys, keypolicy.Account(plan)
+}
+
+func TestKeys(t *testing.T) {
+	keys, account := load(t)
+	assert.Equal(t, "111111111111", account)
+	require.Len(t, keys, 4)
+
+	assert.Equal(t, "aws_kms_key.general[0]", keys[0].Address)
+	assert.True(t, keys[1].Is("aws_kms_key.logs"))
+	assert.False(t, keys[1].Is("aws_kms_key.state"))
+
+	// The replica inherits its policy and rotation from the primary.
+	replica := keys[3]
+	assert.True(t, replica.Replica)
+	assert.Nil(t, replica.Policy)
+	assert.Nil(t, replica.Rotation)
+	assert.Equal(t, 7, replica.DeletionWindow)
+}
+
+func TestAllows(t *testing.T) {
+	keys, account := load(t)
+	general, logs := keys[0].Policy, keys[1].Policy
+
+	d := keypolicy.Allows(logs, keypolicy.Service("logs.amazonaws.com"), "kms:ReEncryptFrom")
+	assert.Equal(t, keypolicy.Decision{Allowed: true, Statement: "AllowCloudWatchLogs"}, d)
+	assert.False(t, keypolicy.Allows(logs, keypolicy.Service("cloudtrail.amazonaws.com"), "kms:Decrypt").Allowed)
+	assert.False(t, keypolicy.Allows(logs, keypolicy.Service("s3.amazonaws.com"), "kms:Encrypt").Allowed)
+
+	// The account root keeps key administration.
+	assert.True(t, keypolicy.Allows(logs, keypolicy.Root(account), "kms:PutKeyPolicy").Allowed)
+
+	// Deny on "*" wins over the root's kms:*.
+	d = keypolicy.Allows(general, keypolicy.Root(account), "kms:ScheduleKeyDeletion")
+	assert.Equal(t, keypolicy.Decision{Statement: "NoDelete"}, d)
+}
+
+func TestCheck(t *testing.T) {
+	keys, account := load(t)
+	findings := keypolicy.Check(keys, keypolicy.Want{
+		Account: account,
+		Services: map[string][]string{
+			"logs.amazonaws.com":       {"aws_kms_key.logs"},
+			"cloudtrail.amazonaws.com": {"aws_kms_key.logs"},
+		},
+		Rotation:       true,
+		DeletionWindow: 7,
+	})
+	var got []string
+	for _, f := range findings {
+		got = append(got, f.Error())
+	}
+	assert.Equal(t, []string{
+		"aws_kms_key.general[0]: root-admin: arn:aws:iam::111111111111:root cannot kms:ScheduleKeyDeletion",
+		"aws_kms_key.general[0]: service-use: logs.amazonaws.com can kms:Encrypt, kms:Decrypt, kms:ReEncryptFrom, kms:ReEncryptTo, kms:GenerateDataKey, kms:GenerateDataKeyWithoutPlaintext but may use only aws_kms_key.logs",
+		"aws_kms_key.state[0]: root-admin: arn:aws:iam::111111111111:root cannot kms:PutKeyPolicy, kms:GetKeyPolicy, kms:DescribeKey, kms:EnableKeyRotation, kms:ScheduleKeyDeletion, kms:CancelKeyDeletion, kms:CreateGrant, kms:RevokeGrant, kms:TagResource",
+		"aws_kms_key.state[0]: rotation: enable_key_rotation is false, want true",
+		"aws_kms_key.state[0]: deletion-window: deletion_window_in_days is 30, want 7",
+	}, got)
+}
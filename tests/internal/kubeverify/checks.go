@@ -0,0 +1,404 @@
+package kubeverify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Problem is one way the cluster differs from what the test expects.
+type Problem struct {
+	Check   string
+	Message string
+}
+
+func (p Problem) Error() string {
+	return p.Check + ": " + p.Message
+}
+
+// Check inspects the cluster once.
+type Check func(ctx context.Context) ([]Problem, error)
+
+// Poll runs check every interval until it reports no problems or ctx is
+// done, and returns the last result. New clusters converge over minutes,
+// so callers bound ctx rather than the number of attempts. API errors are
+// retried too; the last one is returned if nothing ever succeeds.
+func Poll(ctx context.Context, interval time.Duration, check Check) ([]Problem, error) {
+	var (
+		problems []Problem
+		lastErr  error
+	)
+	for {
+		p, err := check(ctx)
+		if err == nil {
+			if len(p) == 0 {
+				return nil, nil
+			}
+			problems, lastErr = p, nil
+		} else if ctx.Err() == nil {
+			lastErr = err
+		}
+		select {
+		case <-ctx.Done():
+			if problems == nil && lastErr == nil {
+				lastErr = ctx.Err()
+			}
+			return problems, lastErr
+		case <-time.After(interval):
+		}
+	}
+}
+
+type objectMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	OwnerReferences []struct {
+		Kind string `json:"kind"`
+	} `json:"ownerReferences,omitempty"`
+}
+
+type condition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// NodesReady returns a Check that wants at least min nodes, all Ready.
+func (c *Client) NodesReady(min int) Check {
+	return func(ctx context.Context) ([]Problem, error) {
+		const check = "nodes"
+		var list struct {
+			Items []struct {
+				Metadata objectMeta `json:"metadata"`
+				Status   struct {
+					Conditions []condition `json:"conditions"`
+				} `json:"status"`
+			} `json:"items"`
+		}
+		if err := c.get(ctx, "/api/v1/nodes", &list); err != nil {
+			return nil, err
+		}
+		var out []Problem
+		if len(list.Items) < min {
+			out = append(out, Problem{check, fmt.Sprintf("%d nodes registered, want at least %d", len(list.Items), min)})
+		}
+		for _, n := range list.Items {
+			ready := readyCondition(n.Status.Conditions)
+			switch {
+			case ready == nil:
+				out = append(out, Problem{check, n.Metadata.Name + " has no Ready condition"})
+			case ready.Status != "True":
+				out = append(out, Problem{check, fmt.Sprintf("%s not Ready: %s %s", n.Metadata.Name, ready.Reason, ready.Message)})
+			}
+		}
+		return out, nil
+	}
+}
+
+func readyCondition(conds []condition) *condition {
+	for i := range conds {
+		if conds[i].Type == "Ready" {
+			return &conds[i]
+		}
+	}
+	return nil
+}
+
+// SystemPods is a Check that every kube-system pod is Running with all
+// containers ready, or has Succeeded if it belongs to a Job.
+func (c *Client) SystemPods(ctx context.Context) ([]Problem, error) {
+	const check = "system-pods"
+	var list struct {
+		Items []struct {
+			Metadata objectMeta `json:"metadata"`
+			Status   struct {
+				Phase             string `json:"phase"`
+				ContainerStatuses []struct {
+					Name         string `json:"name"`
+					Ready        bool   `json:"ready"`
+					RestartCount int    `json:"restartCount"`
+					State        struct {
+						Waiting *struct {
+							Reason string `json:"reason"`
+						} `json:"waiting"`
+					} `json:"state"`
+				} `json:"containerStatuses"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := c.get(ctx, "/api/v1/namespaces/kube-system/pods", &list); err != nil {
+		return nil, err
+	}
+	if len(list.Items) == 0 {
+		return []Problem{{check, "no pods in kube-system"}}, nil
+	}
+	var out []Problem
+	for _, p := range list.Items {
+		name := p.Metadata.Name
+		switch p.Status.Phase {
+		case "Running":
+		case "Succeeded":
+			if !ownedBy(p.Metadata, "Job") {
+				out = append(out, Problem{check, name + " exited"})
+			}
+			continue
+		default:
+			out = append(out, Problem{check, fmt.Sprintf("%s is %s", name, p.Status.Phase)})
+			continue
+		}
+		for _, cs := range p.Status.ContainerStatuses {
+			if cs.Ready {
+				continue
+			}
+			msg := fmt.Sprintf("%s container %s not ready", name, cs.Name)
+			if w := cs.State.Waiting; w != nil && w.Reason != "" {
+				msg += " (" + w.Reason + ")"
+			}
+			if cs.RestartCount > 0 {
+				msg += fmt.Sprintf(", %d restarts", cs.RestartCount)
+			}
+			out = append(out, Problem{check, msg})
+		}
+	}
+	return out, nil
+}
+
+func ownedBy(m objectMeta, kind string) bool {
+	for _, o := range m.OwnerReferences {
+		if o.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// addonWorkloads maps EKS managed addon names to the kube-system workload
+// and container whose image tag carries the addon version.
+var addonWorkloads = map[string]struct {
+	resource, name, container string
+}{
+	"vpc-cni":    {"daemonsets", "aws-node", "aws-node"},
+	"coredns":    {"deployments", "coredns", "coredns"},
+	"kube-proxy": {"daemonsets", "kube-proxy", "kube-proxy"},
+}
+
+// AddonVersions returns a Check that each addon's workload runs the wanted
+// version and is fully rolled out. want maps addon name (vpc-cni, coredns,
+// kube-proxy) to an addon version such as v1.10.1-eksbuild.6; empty
+// versions mean "latest" and only the rollout is checked.
+func (c *Client) AddonVersions(want map[string]string) Check {
+	return func(ctx context.Context) ([]Problem, error) {
+		const check = "addons"
+		names := make([]string, 0, len(want))
+		for name := range want {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var out []Problem
+		for _, addon := range names {
+			w, ok := addonWorkloads[addon]
+			if !ok {
+				out = append(out, Problem{check, fmt.Sprintf("no workload known for addon %s", addon)})
+				continue
+			}
+			var obj struct {
+				Spec struct {
+					Template struct {
+						Spec struct {
+							Containers []struct {
+								Name  string `json:"name"`
+								Image string `json:"image"`
+							} `json:"containers"`
+						} `json:"spec"`
+					} `json:"template"`
+				} `json:"spec"`
+				Status struct {
+					DesiredNumberScheduled int `json:"desiredNumberScheduled"`
+					NumberReady            int `json:"numberReady"`
+					Replicas               int `json:"replicas"`
+					ReadyReplicas          int `json:"readyReplicas"`
+				} `json:"status"`
+			}
+			path := fmt.Sprintf("/apis/apps/v1/namespaces/kube-system/%s/%s", w.resource, w.name)
+			if err := c.get(ctx, path, &obj); err != nil {
+				if IsNotFound(err) {
+					out = append(out, Problem{check, fmt.Sprintf("%s: %s/%s not found", addon, w.resource, w.name)})
+					continue
+				}
+				return nil, err
+			}
+
+			image := ""
+			for _, ct := range obj.Spec.Template.Spec.Containers {
+				if ct.Name == w.container {
+					image = ct.Image
+				}
+			}
+			if image == "" {
+				out = append(out, Problem{check, fmt.Sprintf("%s: no %s container in %s", addon, w.container, w.name)})
+				continue
+			}
+			if version := want[addon]; version != "" && !tagMatches(imageTag(image), version) {
+				out = append(out, Problem{check, fmt.Sprintf("%s runs %s, want %s", addon, image, version)})
+			}
+
+			desired, ready := obj.Status.Replicas, obj.Status.ReadyReplicas
+			if w.resource == "daemonsets" {
+				desired, ready = obj.Status.DesiredNumberScheduled, obj.Status.NumberReady
+			}
+			if ready < desired || desired == 0 {
+				out = append(out, Problem{check, fmt.Sprintf("%s: %d/%d ready", addon, ready, desired)})
+			}
+		}
+		return out, nil
+	}
+}
+
+func imageTag(image string) string {
+	if i := strings.LastIndex(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[i+1:]
+	}
+	return ""
+}
+
+// tagMatches compares an image tag with an addon version. EKS ships
+// kube-proxy as a -minimal- image, so v1.29.0-minimal-eksbuild.1
+// satisfies addon version v1.29.0-eksbuild.1.
+func tagMatches(tag, version string) bool {
+	return tag == version || strings.Replace(tag, "-minimal-", "-", 1) == version
+}
+
+// podSecurityEnforce is the Pod Security Admission enforce label.
+const podSecurityEnforce = "pod-security.kubernetes.io/enforce"
+
+// ApplyPodSecurity labels each namespace in levels with its enforce level,
+// creating namespaces that do not exist. The EKS module records the
+// desired levels in pod_security_standards but leaves labelling to the
+// caller, as a Kubernetes provider or GitOps tool would.
+func (c *Client) ApplyPodSecurity(ctx context.Context, levels map[string]string) error {
+	for ns, level := range levels {
+		if err := c.labelNamespace(ctx, ns, map[string]string{podSecurityEnforce: level}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyNamespaceLabels applies labels as the EKS module's
+// psa_namespace_labels output gives them: namespace to comma-separated
+// key=value pairs. Namespaces that do not exist are created.
+func (c *Client) ApplyNamespaceLabels(ctx context.Context, labels map[string]string) error {
+	for ns, pairs := range labels {
+		parsed := map[string]string{}
+		for _, pair := range strings.Split(pairs, ",") {
+			k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || k == "" {
+				return fmt.Errorf("namespace %s: label %q is not key=value", ns, pair)
+			}
+			parsed[k] = v
+		}
+		if err := c.labelNamespace(ctx, ns, parsed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) labelNamespace(ctx context.Context, ns string, labels map[string]string) error {
+	path := "/api/v1/namespaces/" + url.PathEscape(ns)
+	err := c.patch(ctx, path, map[string]any{"metadata": map[string]any{"labels": labels}}, nil)
+	if IsNotFound(err) {
+		err = c.post(ctx, "/api/v1/namespaces", map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   objectMeta{Name: ns, Labels: labels},
+		}, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("labelling namespace %s: %w", ns, err)
+	}
+	return nil
+}
+
+// PodSecurity returns a Check that each namespace carries the wanted
+// enforce label and that the API server acts on it: a server-side dry run
+// of a privileged pod must be refused in baseline and restricted
+// namespaces.
+func (c *Client) PodSecurity(levels map[string]string) Check {
+	return func(ctx context.Context) ([]Problem, error) {
+		const check = "pod-security"
+		names := make([]string, 0, len(levels))
+		for ns := range levels {
+			names = append(names, ns)
+		}
+		sort.Strings(names)
+
+		var out []Problem
+		for _, ns := range names {
+			level := levels[ns]
+			var obj struct {
+				Metadata objectMeta `json:"metadata"`
+			}
+			if err := c.get(ctx, "/api/v1/namespaces/"+url.PathEscape(ns), &obj); err != nil {
+				if IsNotFound(err) {
+					out = append(out, Problem{check, fmt.Sprintf("namespace %s does not exist", ns)})
+					continue
+				}
+				return nil, err
+			}
+			if got := obj.Metadata.Labels[podSecurityEnforce]; got != level {
+				out = append(out, Problem{check, fmt.Sprintf("namespace %s enforces %q, want %q", ns, got, level)})
+				continue
+			}
+			if level == "privileged" {
+				continue
+			}
+			err := c.post(ctx, "/api/v1/namespaces/"+url.PathEscape(ns)+"/pods?dryRun=All", privilegedPod(ns), nil)
+			switch se := statusError(err); {
+			case err == nil:
+				out = append(out, Problem{check, fmt.Sprintf("namespace %s (%s) admitted a privileged pod", ns, level)})
+			case se != nil && se.Code == http.StatusForbidden && strings.Contains(se.Message, "PodSecurity"):
+			default:
+				// Often the default service account not existing yet in
+				// a fresh namespace; Poll retries.
+				out = append(out, Problem{check, fmt.Sprintf("namespace %s: privileged pod dry run: %v", ns, err)})
+			}
+		}
+		return out, nil
+	}
+}
+
+func statusError(err error) *StatusError {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se
+	}
+	return nil
+}
+
+func privilegedPod(ns string) map[string]any {
+	return map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   objectMeta{Name: "kubeverify-psa-probe", Namespace: ns},
+		"spec": map[string]any{
+			"automountServiceAccountToken": false,
+			"containers": []map[string]any{{
+				"name":            "probe",
+				"image":           "registry.k8s.io/pause:3.9",
+				"securityContext": map[string]any{"privileged": true},
+			}},
+		},
+	}
+}
@@ -0,0 +1,202 @@
+package kubeverify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client is a minimal Kubernetes API client: JSON GET, POST and merge
+// PATCH with the cluster's credentials.
+type Client struct {
+	cluster Cluster
+	server  string
+	http    *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// NewClient returns a Client for c.
+func NewClient(c Cluster) (*Client, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(c.CAData) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(c.CAData) {
+			return nil, fmt.Errorf("cluster %s: certificate authority is not PEM", c.Name)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if len(c.ClientCert) > 0 {
+		cert, err := tls.X509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %s: client certificate: %w", c.Name, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return &Client{
+		cluster: c,
+		server:  strings.TrimSuffix(serverURL(c.Server), "/"),
+		http: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+		},
+		token: c.Token,
+	}, nil
+}
+
+// StatusError is a non-2xx API response.
+type StatusError struct {
+	Code    int
+	Reason  string
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%d %s: %s", e.Code, e.Reason, e.Message)
+	}
+	return fmt.Sprintf("%d %s", e.Code, http.StatusText(e.Code))
+}
+
+// IsNotFound reports whether err is a 404 from the API server.
+func IsNotFound(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.Code == http.StatusNotFound
+}
+
+func (c *Client) get(ctx context.Context, path string, out any) error {
+	return c.do(ctx, http.MethodGet, path, "", nil, out)
+}
+
+func (c *Client) post(ctx context.Context, path string, body, out any) error {
+	return c.do(ctx, http.MethodPost, path, "application/json", body, out)
+}
+
+func (c *Client) patch(ctx context.Context, path string, body, out any) error {
+	return c.do(ctx, http.MethodPatch, path, "application/merge-patch+json", body, out)
+}
+
+func (c *Client) do(ctx context.Context, method, path, contentType string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.server+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	token, err := c.bearer(ctx)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		se := &StatusError{Code: resp.StatusCode}
+		var status struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &status) == nil {
+			se.Reason, se.Message = status.Reason, status.Message
+		}
+		return fmt.Errorf("%s %s: %w", method, path, se)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("%s %s: decoding response: %w", method, path, err)
+	}
+	return nil
+}
+
+// bearer returns the static token, or runs the exec plugin when the cached
+// token is missing or within a minute of expiring.
+func (c *Client) bearer(ctx context.Context) (string, error) {
+	if c.cluster.Exec == nil {
+		return c.token, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && (c.expiry.IsZero() || time.Until(c.expiry) > time.Minute) {
+		return c.token, nil
+	}
+
+	e := c.cluster.Exec
+	cmd := exec.CommandContext(ctx, e.Command, e.Args...)
+	cmd.Env = os.Environ()
+	for k, v := range e.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	info, _ := json.Marshal(map[string]any{
+		"apiVersion": execAPIVersion,
+		"kind":       "ExecCredential",
+		"spec":       map[string]any{"interactive": false},
+	})
+	cmd.Env = append(cmd.Env, "KUBERNETES_EXEC_INFO="+string(info))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("exec credential %s: %w: %s", e.Command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var cred struct {
+		Status struct {
+			Token               string    `json:"token"`
+			ExpirationTimestamp time.Time `json:"expirationTimestamp"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(out, &cred); err != nil {
+		return "", fmt.Errorf("exec credential %s: %w", e.Command, err)
+	}
+	if cred.Status.Token == "" {
+		return "", fmt.Errorf("exec credential %s returned no token", e.Command)
+	}
+	c.token, c.expiry = cred.Status.Token, cred.Status.ExpirationTimestamp
+	return c.token, nil
+}
+
+// ServerVersion returns the API server's gitVersion, e.g. v1.29.2.
+func (c *Client) ServerVersion(ctx context.Context) (string, error) {
+	var v struct {
+		GitVersion string `json:"gitVersion"`
+	}
+	if err := c.get(ctx, "/version", &v); err != nil {
+		return "", err
+	}
+	return v.GitVersion, nil
+}
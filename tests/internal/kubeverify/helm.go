@@ -0,0 +1,145 @@
+package kubeverify
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+)
+
+// HelmRelease is the latest revision of a Helm release as Helm itself
+// recorded it in the cluster.
+type HelmRelease struct {
+	Name         string
+	Namespace    string
+	Revision     int
+	Status       string
+	Chart        string
+	ChartVersion string
+	AppVersion   string
+}
+
+// HelmReleases returns the latest revision of every release in namespace,
+// read from Helm's release secrets, sorted by name.
+func (c *Client) HelmReleases(ctx context.Context, namespace string) ([]HelmRelease, error) {
+	var list struct {
+		Items []struct {
+			Data struct {
+				Release []byte `json:"release"`
+			} `json:"data"`
+		} `json:"items"`
+	}
+	path := "/api/v1/namespaces/" + url.PathEscape(namespace) + "/secrets?labelSelector=" + url.QueryEscape("owner=helm")
+	if err := c.get(ctx, path, &list); err != nil {
+		return nil, err
+	}
+	latest := map[string]HelmRelease{}
+	for _, item := range list.Items {
+		r, err := decodeHelmRelease(item.Data.Release)
+		if err != nil {
+			return nil, err
+		}
+		if prev, ok := latest[r.Name]; !ok || r.Revision > prev.Revision {
+			latest[r.Name] = r
+		}
+	}
+	out := make([]HelmRelease, 0, len(latest))
+	for _, r := range latest {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// decodeHelmRelease undoes Helm's storage encoding: base64 of gzipped
+// release JSON.
+func decodeHelmRelease(data []byte) (HelmRelease, error) {
+	raw, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return HelmRelease{}, fmt.Errorf("helm release: %w", err)
+	}
+	if len(raw) > 2 && raw[0] == 0x1f && raw[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return HelmRelease{}, fmt.Errorf("helm release: %w", err)
+		}
+		if raw, err = io.ReadAll(zr); err != nil {
+			return HelmRelease{}, fmt.Errorf("helm release: %w", err)
+		}
+	}
+	var rel struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+		Version   int    `json:"version"`
+		Info      struct {
+			Status string `json:"status"`
+		} `json:"info"`
+		Chart struct {
+			Metadata struct {
+				Name       string `json:"name"`
+				Version    string `json:"version"`
+				AppVersion string `json:"appVersion"`
+			} `json:"metadata"`
+		} `json:"chart"`
+	}
+	if err := json.Unmarshal(raw, &rel); err != nil {
+		return HelmRelease{}, fmt.Errorf("helm release: %w", err)
+	}
+	return HelmRelease{
+		Name:         rel.Name,
+		Namespace:    rel.Namespace,
+		Revision:     rel.Version,
+		Status:       rel.Info.Status,
+		Chart:        rel.Chart.Metadata.Name,
+		ChartVersion: rel.Chart.Metadata.Version,
+		AppVersion:   rel.Chart.Metadata.AppVersion,
+	}, nil
+}
+
+// Workloads returns a Check that the deployments, daemonsets and
+// statefulsets in namespace matching selector exist and are fully ready.
+// Helm charts label theirs app.kubernetes.io/instance=<release>.
+func (c *Client) Workloads(namespace, selector string) Check {
+	return func(ctx context.Context) ([]Problem, error) {
+		const check = "workloads"
+		var out []Problem
+		found := 0
+		for _, resource := range []string{"deployments", "daemonsets", "statefulsets"} {
+			var list struct {
+				Items []struct {
+					Metadata objectMeta `json:"metadata"`
+					Status   struct {
+						DesiredNumberScheduled int `json:"desiredNumberScheduled"`
+						NumberReady            int `json:"numberReady"`
+						Replicas               int `json:"replicas"`
+						ReadyReplicas          int `json:"readyReplicas"`
+					} `json:"status"`
+				} `json:"items"`
+			}
+			path := fmt.Sprintf("/apis/apps/v1/namespaces/%s/%s?labelSelector=%s",
+				url.PathEscape(namespace), resource, url.QueryEscape(selector))
+			if err := c.get(ctx, path, &list); err != nil {
+				return nil, err
+			}
+			for _, w := range list.Items {
+				found++
+				desired, ready := w.Status.Replicas, w.Status.ReadyReplicas
+				if resource == "daemonsets" {
+					desired, ready = w.Status.DesiredNumberScheduled, w.Status.NumberReady
+				}
+				if ready < desired || desired == 0 {
+					out = append(out, Problem{check, fmt.Sprintf("%s/%s/%s: %d/%d ready", namespace, resource, w.Metadata.Name, ready, desired)})
+				}
+			}
+		}
+		if found == 0 {
+			out = append(out, Problem{check, fmt.Sprintf("no workloads in %s match %s", namespace, selector)})
+		}
+		return out, nil
+	}
+}
@@ -0,0 +1,276 @@
+// Package kubeverify checks a test cluster from the Kubernetes side once
+// Terraform has finished: nodes Ready, kube-system healthy, managed addon
+// versions and Pod Security Admission labels as requested. It talks to the
+// API server over plain HTTPS so the same checks run against EKS, AKS, GKE
+// and a local kind cluster without client-go.
+package kubeverify
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// execAPIVersion is the client.authentication.k8s.io version exec plugins
+// are invoked with.
+const execAPIVersion = "client.authentication.k8s.io/v1beta1"
+
+// Cluster is everything needed to reach an API server.
+type Cluster struct {
+	Name   string
+	Server string
+	// CAData is the PEM cluster CA. Empty means the system roots.
+	CAData []byte
+
+	// Exactly one of Token, ClientCert/ClientKey or Exec authenticates.
+	Token      string
+	ClientCert []byte
+	ClientKey  []byte
+	Exec       *Exec
+}
+
+// Exec is a kubeconfig exec credential plugin such as aws eks get-token.
+type Exec struct {
+	Command string
+	Args    []string
+	Env     map[string]string
+}
+
+// EKS builds a Cluster from the aws/eks cluster_name, cluster_endpoint and
+// cluster_certificate_authority outputs. Tokens come from aws eks get-token,
+// so the AWS CLI must be on PATH.
+func EKS(name, endpoint, caData, region string) (Cluster, error) {
+	ca, err := base64.StdEncoding.DecodeString(caData)
+	if err != nil {
+		return Cluster{}, fmt.Errorf("decoding certificate authority: %w", err)
+	}
+	return Cluster{
+		Name:   name,
+		Server: endpoint,
+		CAData: ca,
+		Exec: &Exec{
+			Command: "aws",
+			Args:    []string{"eks", "get-token", "--cluster-name", name, "--region", region, "--output", "json"},
+		},
+	}, nil
+}
+
+// GKE builds a Cluster from the gcp/gke cluster_name, cluster_endpoint and
+// cluster_ca_certificate outputs. Tokens come from gke-gcloud-auth-plugin.
+func GKE(name, endpoint, caData string) (Cluster, error) {
+	ca, err := base64.StdEncoding.DecodeString(caData)
+	if err != nil {
+		return Cluster{}, fmt.Errorf("decoding certificate authority: %w", err)
+	}
+	return Cluster{
+		Name:   name,
+		Server: endpoint,
+		CAData: ca,
+		Exec:   &Exec{Command: "gke-gcloud-auth-plugin"},
+	}, nil
+}
+
+// kubeconfig is the subset of the kubeconfig file format used here.
+type kubeconfig struct {
+	APIVersion     string         `yaml:"apiVersion"`
+	Kind           string         `yaml:"kind"`
+	Clusters       []namedCluster `yaml:"clusters"`
+	Users          []namedUser    `yaml:"users"`
+	Contexts       []namedContext `yaml:"contexts"`
+	CurrentContext string         `yaml:"current-context"`
+}
+
+type namedCluster struct {
+	Name    string `yaml:"name"`
+	Cluster struct {
+		Server                   string `yaml:"server"`
+		CertificateAuthorityData string `yaml:"certificate-authority-data,omitempty"`
+	} `yaml:"cluster"`
+}
+
+type namedUser struct {
+	Name string `yaml:"name"`
+	User struct {
+		Token                 string     `yaml:"token,omitempty"`
+		ClientCertificateData string     `yaml:"client-certificate-data,omitempty"`
+		ClientKeyData         string     `yaml:"client-key-data,omitempty"`
+		Exec                  *execBlock `yaml:"exec,omitempty"`
+	} `yaml:"user"`
+}
+
+type execBlock struct {
+	APIVersion      string    `yaml:"apiVersion"`
+	Command         string    `yaml:"command"`
+	Args            []string  `yaml:"args,omitempty"`
+	Env             []execEnv `yaml:"env,omitempty"`
+	InteractiveMode string    `yaml:"interactiveMode,omitempty"`
+}
+
+type execEnv struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+type namedContext struct {
+	Name    string `yaml:"name"`
+	Context struct {
+		Cluster string `yaml:"cluster"`
+		User    string `yaml:"user"`
+	} `yaml:"context"`
+}
+
+// Kubeconfig renders c as a single-context kubeconfig for kubectl and
+// helm.
+func (c Cluster) Kubeconfig() ([]byte, error) {
+	if c.Name == "" || c.Server == "" {
+		return nil, errors.New("cluster needs a name and server")
+	}
+	var cl namedCluster
+	cl.Name = c.Name
+	cl.Cluster.Server = serverURL(c.Server)
+	if len(c.CAData) > 0 {
+		cl.Cluster.CertificateAuthorityData = base64.StdEncoding.EncodeToString(c.CAData)
+	}
+
+	var u namedUser
+	u.Name = c.Name
+	u.User.Token = c.Token
+	if len(c.ClientCert) > 0 {
+		u.User.ClientCertificateData = base64.StdEncoding.EncodeToString(c.ClientCert)
+		u.User.ClientKeyData = base64.StdEncoding.EncodeToString(c.ClientKey)
+	}
+	if c.Exec != nil {
+		e := &execBlock{APIVersion: execAPIVersion, Command: c.Exec.Command, Args: c.Exec.Args, InteractiveMode: "Never"}
+		names := make([]string, 0, len(c.Exec.Env))
+		for k := range c.Exec.Env {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			e.Env = append(e.Env, execEnv{k, c.Exec.Env[k]})
+		}
+		u.User.Exec = e
+	}
+
+	var ctx namedContext
+	ctx.Name = c.Name
+	ctx.Context.Cluster = c.Name
+	ctx.Context.User = c.Name
+
+	return yaml.Marshal(kubeconfig{
+		APIVersion:     "v1",
+		Kind:           "Config",
+		Clusters:       []namedCluster{cl},
+		Users:          []namedUser{u},
+		Contexts:       []namedContext{ctx},
+		CurrentContext: c.Name,
+	})
+}
+
+// WriteKubeconfig writes c's kubeconfig to path with owner-only
+// permissions, since it may hold a token or client key.
+func (c Cluster) WriteKubeconfig(path string) error {
+	b, err := c.Kubeconfig()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o600)
+}
+
+// ParseKubeconfig returns the current context of a kubeconfig, such as
+// the azure/aks kube_config output or kind get kubeconfig.
+func ParseKubeconfig(data []byte) (Cluster, error) {
+	var kc kubeconfig
+	if err := yaml.Unmarshal(data, &kc); err != nil {
+		return Cluster{}, fmt.Errorf("parsing kubeconfig: %w", err)
+	}
+	name := kc.CurrentContext
+	if name == "" && len(kc.Contexts) == 1 {
+		name = kc.Contexts[0].Name
+	}
+	var ctx *namedContext
+	for i := range kc.Contexts {
+		if kc.Contexts[i].Name == name {
+			ctx = &kc.Contexts[i]
+		}
+	}
+	if ctx == nil {
+		return Cluster{}, fmt.Errorf("kubeconfig has no context %q", name)
+	}
+
+	c := Cluster{Name: ctx.Context.Cluster}
+	found := false
+	for _, cl := range kc.Clusters {
+		if cl.Name != ctx.Context.Cluster {
+			continue
+		}
+		found = true
+		c.Server = cl.Cluster.Server
+		if cl.Cluster.CertificateAuthorityData != "" {
+			ca, err := base64.StdEncoding.DecodeString(cl.Cluster.CertificateAuthorityData)
+			if err != nil {
+				return Cluster{}, fmt.Errorf("cluster %s: certificate-authority-data: %w", cl.Name, err)
+			}
+			c.CAData = ca
+		}
+	}
+	if !found {
+		return Cluster{}, fmt.Errorf("kubeconfig has no cluster %q", ctx.Context.Cluster)
+	}
+
+	for _, u := range kc.Users {
+		if u.Name != ctx.Context.User {
+			continue
+		}
+		c.Token = u.User.Token
+		for _, f := range []struct {
+			data string
+			dst  *[]byte
+		}{
+			{u.User.ClientCertificateData, &c.ClientCert},
+			{u.User.ClientKeyData, &c.ClientKey},
+		} {
+			if f.data == "" {
+				continue
+			}
+			b, err := base64.StdEncoding.DecodeString(f.data)
+			if err != nil {
+				return Cluster{}, fmt.Errorf("user %s: client credentials: %w", u.Name, err)
+			}
+			*f.dst = b
+		}
+		if e := u.User.Exec; e != nil {
+			c.Exec = &Exec{Command: e.Command, Args: e.Args}
+			if len(e.Env) > 0 {
+				c.Exec.Env = map[string]string{}
+				for _, kv := range e.Env {
+					c.Exec.Env[kv.Name] = kv.Value
+				}
+			}
+		}
+		return c, nil
+	}
+	return Cluster{}, fmt.Errorf("kubeconfig has no user %q", ctx.Context.User)
+}
+
+// ReadKubeconfig is ParseKubeconfig for a file.
+func ReadKubeconfig(path string) (Cluster, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Cluster{}, err
+	}
+	return ParseKubeconfig(b)
+}
+
+// serverURL adds the https scheme GKE's endpoint output (a bare IP) lacks.
+func serverURL(s string) string {
+	if strings.Contains(s, "://") {
+		return s
+	}
+	return "https://" + s
+}
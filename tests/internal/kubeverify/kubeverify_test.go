@@ -0,0 +1,468 @@
+package kubeverify_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/kubeverify"
+)
+
+// fakeAPI serves GETs from testdata/api/<path>.json, with per-test
+// overrides, and implements just enough namespace and pod admission
+// behaviour for the Pod Security checks.
+type fakeAPI struct {
+	t        *testing.T
+	token    string
+	admitAll bool // PodSecurity admission disabled
+
+	mu         sync.Mutex
+	overrides  map[string]string
+	namespaces map[string]map[string]string
+}
+
+func newFakeAPI(t *testing.T) (*fakeAPI, kubeverify.Cluster) {
+	f := &fakeAPI{t: t, token: "static-token", overrides: map[string]string{}, namespaces: map[string]map[string]string{}}
+	srv := httptest.NewTLSServer(f)
+	t.Cleanup(srv.Close)
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	return f, kubeverify.Cluster{Name: "fake", Server: srv.URL, CAData: ca, Token: f.token}
+}
+
+func (f *fakeAPI) set(path, body string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.overrides[path] = body
+}
+
+func writeStatus(w http.ResponseWriter, code int, reason, msg string) {
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]any{"kind": "Status", "reason": reason, "message": msg})
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+f.token {
+		writeStatus(w, http.StatusUnauthorized, "Unauthorized", "bad token")
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	const nsPrefix = "/api/v1/namespaces/"
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/namespaces":
+		var ns struct {
+			Metadata struct {
+				Name   string            `json:"name"`
+				Labels map[string]string `json:"labels"`
+			} `json:"metadata"`
+		}
+		require.NoError(f.t, json.NewDecoder(r.Body).Decode(&ns))
+		f.namespaces[ns.Metadata.Name] = ns.Metadata.Labels
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("{}"))
+		return
+
+	case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, nsPrefix):
+		assert.Equal(f.t, "application/merge-patch+json", r.Header.Get("Content-Type"))
+		name := strings.TrimPrefix(r.URL.Path, nsPrefix)
+		labels, ok := f.namespaces[name]
+		if !ok {
+			writeStatus(w, http.StatusNotFound, "NotFound", "namespaces \""+name+"\" not found")
+			return
+		}
+		var patch struct {
+			Metadata struct {
+				Labels map[string]string `json:"labels"`
+			} `json:"metadata"`
+		}
+		require.NoError(f.t, json.NewDecoder(r.Body).Decode(&patch))
+		for k, v := range patch.Metadata.Labels {
+			labels[k] = v
+		}
+		_, _ = w.Write([]byte("{}"))
+		return
+
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/pods"):
+		assert.Equal(f.t, "All", r.URL.Query().Get("dryRun"))
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, nsPrefix), "/pods")
+		switch level := f.namespaces[name]["pod-security.kubernetes.io/enforce"]; {
+		case f.admitAll:
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte("{}"))
+		case level == "baseline" || level == "restricted":
+			writeStatus(w, http.StatusForbidden, "Forbidden",
+				`pods "kubeverify-psa-probe" is forbidden: violates PodSecurity "`+level+`:latest": privileged`)
+		default:
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte("{}"))
+		}
+		return
+
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, nsPrefix) && !strings.Contains(strings.TrimPrefix(r.URL.Path, nsPrefix), "/"):
+		name := strings.TrimPrefix(r.URL.Path, nsPrefix)
+		if labels, ok := f.namespaces[name]; ok {
+			_ = json.NewEncoder(w).Encode(map[string]any{"metadata": map[string]any{"name": name, "labels": labels}})
+			return
+		}
+	}
+
+	if r.Method != http.MethodGet {
+		writeStatus(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method+" "+r.URL.Path)
+		return
+	}
+	if body, ok := f.overrides[r.URL.Path]; ok {
+		_, _ = w.Write([]byte(body))
+		return
+	}
+	b, err := os.ReadFile(filepath.Join("testdata", "api", filepath.FromSlash(r.URL.Path)+".json"))
+	if err != nil {
+		writeStatus(w, http.StatusNotFound, "NotFound", r.URL.Path+" not found")
+		return
+	}
+	_, _ = w.Write(b)
+}
+
+func newClient(t *testing.T) (*fakeAPI, *kubeverify.Client) {
+	t.Helper()
+	f, cluster := newFakeAPI(t)
+	c, err := kubeverify.NewClient(cluster)
+	require.NoError(t, err)
+	return f, c
+}
+
+func messages(problems []kubeverify.Problem) []string {
+	out := make([]string, len(problems))
+	for i, p := range problems {
+		out[i] = p.Error()
+	}
+	return out
+}
+
+func TestHealthyCluster(t *testing.T) {
+	_, c := newClient(t)
+	ctx := context.Background()
+
+	for name, check := range map[string]kubeverify.Check{
+		"nodes":       c.NodesReady(2),
+		"system-pods": c.SystemPods,
+		"addons": c.AddonVersions(map[string]string{
+			"vpc-cni":    "v1.18.1-eksbuild.3",
+			"coredns":    "v1.11.1-eksbuild.9",
+			"kube-proxy": "v1.29.3-eksbuild.2",
+		}),
+	} {
+		problems, err := check(ctx)
+		require.NoError(t, err, name)
+		assert.Empty(t, messages(problems), name)
+	}
+
+	version, err := c.ServerVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "v1.29.4-eks-036c24b", version)
+}
+
+func TestNodesReady(t *testing.T) {
+	f, c := newClient(t)
+	f.set("/api/v1/nodes", `{"items": [
+		{"metadata": {"name": "n1"}, "status": {"conditions": [{"type": "Ready", "status": "False", "reason": "KubeletNotReady", "message": "container runtime network not ready"}]}},
+		{"metadata": {"name": "n2"}, "status": {}}
+	]}`)
+
+	problems, err := c.NodesReady(3)(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"nodes: 2 nodes registered, want at least 3",
+		"nodes: n1 not Ready: KubeletNotReady container runtime network not ready",
+		"nodes: n2 has no Ready condition",
+	}, messages(problems))
+}
+
+func TestSystemPods(t *testing.T) {
+	f, c := newClient(t)
+	f.set("/api/v1/namespaces/kube-system/pods", `{"items": [
+		{"metadata": {"name": "coredns-1"}, "status": {"phase": "Running", "containerStatuses": [
+			{"name": "coredns", "ready": false, "restartCount": 4, "state": {"waiting": {"reason": "CrashLoopBackOff"}}}]}},
+		{"metadata": {"name": "ebs-csi-node-1"}, "status": {"phase": "Pending"}},
+		{"metadata": {"name": "one-off"}, "status": {"phase": "Succeeded"}}
+	]}`)
+
+	problems, err := c.SystemPods(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"system-pods: coredns-1 container coredns not ready (CrashLoopBackOff), 4 restarts",
+		"system-pods: ebs-csi-node-1 is Pending",
+		"system-pods: one-off exited",
+	}, messages(problems))
+}
+
+func TestAddonVersions(t *testing.T) {
+	f, c := newClient(t)
+	f.set("/apis/apps/v1/namespaces/kube-system/deployments/coredns", `{
+		"spec": {"template": {"spec": {"containers": [{"name": "coredns", "image": "registry.k8s.io/coredns/coredns:v1.11.1@sha256:abc"}]}}},
+		"status": {"replicas": 2, "readyReplicas": 1}
+	}`)
+
+	problems, err := c.AddonVersions(map[string]string{
+		"coredns":    "v1.10.1-eksbuild.6",
+		"kube-proxy": "",
+		"vpc-cni":    "v1.16.0-eksbuild.1",
+		"ebs-csi":    "v1.30.0-eksbuild.1",
+	})(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"addons: coredns runs registry.k8s.io/coredns/coredns:v1.11.1@sha256:abc, want v1.10.1-eksbuild.6",
+		"addons: coredns: 1/2 ready",
+		"addons: no workload known for addon ebs-csi",
+		"addons: vpc-cni runs 602401143452.dkr.ecr.us-east-1.amazonaws.com/amazon-k8s-cni:v1.18.1-eksbuild.3, want v1.16.0-eksbuild.1",
+	}, messages(problems))
+}
+
+func TestPodSecurity(t *testing.T) {
+	f, c := newClient(t)
+	ctx := context.Background()
+	levels := map[string]string{"apps": "restricted", "ingress": "baseline", "kube-system": "privileged"}
+
+	problems, err := c.PodSecurity(levels)(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"pod-security: namespace apps does not exist",
+		"pod-security: namespace ingress does not exist",
+		`pod-security: namespace kube-system enforces "", want "privileged"`,
+	}, messages(problems))
+
+	f.namespaces["kube-system"] = map[string]string{"kubernetes.io/metadata.name": "kube-system"}
+	require.NoError(t, c.ApplyPodSecurity(ctx, levels))
+	assert.Equal(t, "kube-system", f.namespaces["kube-system"]["kubernetes.io/metadata.name"], "patch keeps other labels")
+
+	problems, err = c.PodSecurity(levels)(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, messages(problems))
+
+	// A label the API server does not act on is caught by the dry run.
+	f.admitAll = true
+	problems, err = c.PodSecurity(map[string]string{"apps": "restricted"})(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"pod-security: namespace apps (restricted) admitted a privileged pod"}, messages(problems))
+}
+
+func TestApplyNamespaceLabels(t *testing.T) {
+	f, c := newClient(t)
+	ctx := context.Background()
+
+	// As modules/aws/eks renders psa_namespace_labels.
+	require.NoError(t, c.ApplyNamespaceLabels(ctx, map[string]string{
+		"apps":    "pod-security.kubernetes.io/enforce=restricted",
+		"ingress": "pod-security.kubernetes.io/enforce=baseline, team=edge",
+	}))
+	assert.Equal(t, map[string]string{"pod-security.kubernetes.io/enforce": "restricted"}, f.namespaces["apps"])
+	assert.Equal(t, map[string]string{"pod-security.kubernetes.io/enforce": "baseline", "team": "edge"}, f.namespaces["ingress"])
+
+	// A wrong label key in the output leaves the level unenforced.
+	require.NoError(t, c.ApplyNamespaceLabels(ctx, map[string]string{"batch": "pod-security.kubernetes.io/enforce-level=restricted"}))
+	problems, err := c.PodSecurity(map[string]string{"batch": "restricted"})(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{`pod-security: namespace batch enforces "", want "restricted"`}, messages(problems))
+
+	assert.ErrorContains(t, c.ApplyNamespaceLabels(ctx, map[string]string{"apps": "restricted"}), `label "restricted" is not key=value`)
+}
+
+func TestPoll(t *testing.T) {
+	calls := 0
+	problems, err := kubeverify.Poll(context.Background(), time.Millisecond, func(context.Context) ([]kubeverify.Problem, error) {
+		calls++
+		if calls < 3 {
+			return []kubeverify.Problem{{Check: "x", Message: "not yet"}}, nil
+		}
+		return nil, nil
+	})
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+	assert.Equal(t, 3, calls)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	problems, err = kubeverify.Poll(ctx, time.Millisecond, func(context.Context) ([]kubeverify.Problem, error) {
+		return []kubeverify.Problem{{Check: "x", Message: "never"}}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"x: never"}, messages(problems))
+}
+
+func TestExecCredential(t *testing.T) {
+	f, cluster := newFakeAPI(t)
+	f.token = "exec-token"
+	cluster.Token = ""
+	cluster.Exec = &kubeverify.Exec{
+		Command: "sh",
+		Args:    []string{"-c", `printf '{"kind":"ExecCredential","status":{"token":"%s"}}' "$TOKEN"`},
+		Env:     map[string]string{"TOKEN": "exec-token"},
+	}
+	c, err := kubeverify.NewClient(cluster)
+	require.NoError(t, err)
+
+	_, err = c.ServerVersion(context.Background())
+	require.NoError(t, err)
+
+	f.token = "rotated"
+	_, err = c.ServerVersion(context.Background())
+	require.Error(t, err, "cached token without expiry is reused")
+	assert.Contains(t, err.Error(), "401")
+}
+
+func TestParseKubeconfig(t *testing.T) {
+	cluster, err := kubeverify.ReadKubeconfig(filepath.Join("testdata", "kind-kubeconfig.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "kind-tfmodules", cluster.Name)
+	assert.Equal(t, "https://127.0.0.1:40123", cluster.Server)
+	assert.Contains(t, string(cluster.CAData), "ca")
+	assert.Contains(t, string(cluster.ClientCert), "client")
+	assert.Contains(t, string(cluster.ClientKey), "RSA PRIVATE KEY")
+	assert.Empty(t, cluster.Token)
+	assert.Nil(t, cluster.Exec)
+}
+
+func TestKubeconfigRoundTrip(t *testing.T) {
+	eks, err := kubeverify.EKS("test-1234-dev-eks", "https://ABC.gr7.us-east-1.eks.amazonaws.com",
+		"LS0tLS1CRUdJTiBDRVJUSUZJQ0FURS0tLS0tCmNhCi0tLS0tRU5EIENFUlRJRklDQVRFLS0tLS0K", "us-east-1")
+	require.NoError(t, err)
+	gke, err := kubeverify.GKE("test-gke", "34.1.2.3",
+		"LS0tLS1CRUdJTiBDRVJUSUZJQ0FURS0tLS0tCmNhCi0tLS0tRU5EIENFUlRJRklDQVRFLS0tLS0K")
+	require.NoError(t, err)
+	gke.Exec.Env = map[string]string{"USE_GKE_GCLOUD_AUTH_PLUGIN": "True"}
+
+	for _, c := range []kubeverify.Cluster{eks, gke} {
+		path := filepath.Join(t.TempDir(), "kubeconfig")
+		require.NoError(t, c.WriteKubeconfig(path))
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+		got, err := kubeverify.ReadKubeconfig(path)
+		require.NoError(t, err)
+		if !strings.Contains(c.Server, "://") {
+			c.Server = "https://" + c.Server
+		}
+		assert.Equal(t, c, got)
+	}
+	assert.Equal(t, []string{"eks", "get-token", "--cluster-name", "test-1234-dev-eks", "--region", "us-east-1", "--output", "json"}, eks.Exec.Args)
+
+	_, err = kubeverify.EKS("x", "https://x", "not base64!", "us-east-1")
+	assert.Error(t, err)
+}
+
+// TestKindCluster runs every check against a real cluster. Create one with
+//
+//	kind create cluster --name tfmodules
+//	kind get kubeconfig --name tfmodules > /tmp/kind.kubeconfig
+//	KIND_KUBECONFIG=/tmp/kind.kubeconfig go test ./internal/kubeverify/ -run Kind -v
+func TestKindCluster(t *testing.T) {
+	path := os.Getenv("KIND_KUBECONFIG")
+	if path == "" {
+		t.Skip("Skipping kind test (KIND_KUBECONFIG not set)")
+	}
+	cluster, err := kubeverify.ReadKubeconfig(path)
+	require.NoError(t, err)
+	c, err := kubeverify.NewClient(cluster)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
+	defer cancel()
+
+	version, err := c.ServerVersion(ctx)
+	require.NoError(t, err)
+
+	levels := map[string]string{"kubeverify-restricted": "restricted", "kubeverify-baseline": "baseline"}
+	require.NoError(t, c.ApplyPodSecurity(ctx, levels))
+
+	for _, check := range []kubeverify.Check{
+		c.NodesReady(1),
+		c.SystemPods,
+		// kind tags kube-proxy with the Kubernetes version.
+		c.AddonVersions(map[string]string{"kube-proxy": version, "coredns": ""}),
+		c.PodSecurity(levels),
+	} {
+		problems, err := kubeverify.Poll(ctx, 5*time.Second, check)
+		require.NoError(t, err)
+		for _, p := range problems {
+			t.Error(p)
+		}
+	}
+}
+
+// helmSecret encodes a release the way Helm's secret storage driver does.
+func helmSecret(t *testing.T, name string, revision int, status, chart, version string) map[string]any {
+	t.Helper()
+	rel, err := json.Marshal(map[string]any{
+		"name": name, "namespace": "kube-system", "version": revision,
+		"info":  map[string]any{"status": status},
+		"chart": map[string]any{"metadata": map[string]any{"name": chart, "version": version, "appVersion": "v" + version}},
+	})
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err = zw.Write(rel)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	// Helm base64-encodes the gzip; the API server base64-encodes that
+	// again as secret data, which json.Marshal of []byte reproduces.
+	helm := base64.StdEncoding.EncodeToString(buf.Bytes())
+	return map[string]any{
+		"metadata": map[string]any{"name": fmt.Sprintf("sh.helm.release.v1.%s.v%d", name, revision)},
+		"data":     map[string]any{"release": []byte(helm)},
+	}
+}
+
+func TestHelmReleases(t *testing.T) {
+	f, c := newClient(t)
+	list, err := json.Marshal(map[string]any{"items": []any{
+		helmSecret(t, "sealed-secrets", 1, "superseded", "sealed-secrets", "2.14.0"),
+		helmSecret(t, "sealed-secrets", 2, "deployed", "sealed-secrets", "2.15.0"),
+		helmSecret(t, "aws-load-balancer-controller", 1, "failed", "aws-load-balancer-controller", "1.6.2"),
+	}})
+	require.NoError(t, err)
+	f.set("/api/v1/namespaces/kube-system/secrets", string(list))
+
+	releases, err := c.HelmReleases(context.Background(), "kube-system")
+	require.NoError(t, err)
+	assert.Equal(t, []kubeverify.HelmRelease{
+		{Name: "aws-load-balancer-controller", Namespace: "kube-system", Revision: 1, Status: "failed",
+			Chart: "aws-load-balancer-controller", ChartVersion: "1.6.2", AppVersion: "v1.6.2"},
+		{Name: "sealed-secrets", Namespace: "kube-system", Revision: 2, Status: "deployed",
+			Chart: "sealed-secrets", ChartVersion: "2.15.0", AppVersion: "v2.15.0"},
+	}, releases)
+}
+
+func TestWorkloads(t *testing.T) {
+	f, c := newClient(t)
+	f.set("/apis/apps/v1/namespaces/monitoring/deployments",
+		`{"items": [{"metadata": {"name": "grafana"}, "status": {"replicas": 1, "readyReplicas": 1}}]}`)
+	f.set("/apis/apps/v1/namespaces/monitoring/daemonsets",
+		`{"items": [{"metadata": {"name": "promtail"}, "status": {"desiredNumberScheduled": 3, "numberReady": 2}}]}`)
+	f.set("/apis/apps/v1/namespaces/monitoring/statefulsets", `{"items": []}`)
+
+	problems, err := c.Workloads("monitoring", "app.kubernetes.io/instance=grafana")(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"workloads: monitoring/daemonsets/promtail: 2/3 ready"}, messages(problems))
+
+	f.set("/apis/apps/v1/namespaces/monitoring/deployments", `{"items": []}`)
+	f.set("/apis/apps/v1/namespaces/monitoring/daemonsets", `{"items": []}`)
+	problems, err = c.Workloads("monitoring", "app.kubernetes.io/instance=loki")(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"workloads: no workloads in monitoring match app.kubernetes.io/instance=loki"}, messages(problems))
+}
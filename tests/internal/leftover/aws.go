@@ -0,0 +1,171 @@
+package leftover
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi"
+)
+
+// TaggingAPI is the subset of the Resource Groups Tagging API AWS uses.
+type TaggingAPI interface {
+	GetResourcesPagesWithContext(aws.Context, *resourcegroupstaggingapi.GetResourcesInput, func(*resourcegroupstaggingapi.GetResourcesOutput, bool) bool, ...request.Option) error
+}
+
+// LogsAPI is the subset of the CloudWatch Logs API AWS uses.
+type LogsAPI interface {
+	DescribeLogGroupsPagesWithContext(aws.Context, *cloudwatchlogs.DescribeLogGroupsInput, func(*cloudwatchlogs.DescribeLogGroupsOutput, bool) bool, ...request.Option) error
+	DeleteLogGroupWithContext(aws.Context, *cloudwatchlogs.DeleteLogGroupInput, ...request.Option) (*cloudwatchlogs.DeleteLogGroupOutput, error)
+}
+
+// EC2API is the subset of the EC2 API AWS uses.
+type EC2API interface {
+	DeleteNetworkInterfaceWithContext(aws.Context, *ec2.DeleteNetworkInterfaceInput, ...request.Option) (*ec2.DeleteNetworkInterfaceOutput, error)
+}
+
+// KMSAPI is the subset of the KMS API AWS uses.
+type KMSAPI interface {
+	DescribeKeyWithContext(aws.Context, *kms.DescribeKeyInput, ...request.Option) (*kms.DescribeKeyOutput, error)
+}
+
+// AWS finds a run's leftovers in one region.
+type AWS struct {
+	Tagging TaggingAPI
+	Logs    LogsAPI
+	EC2     EC2API
+	KMS     KMSAPI
+	// Tag is the run tag.
+	Tag string
+	// LogGroupPrefixes are checked whether tagged or not, e.g.
+	// /aws/eks/<cluster>/, whose log group EKS recreates, untagged, when
+	// the cluster logs while it is being deleted.
+	LogGroupPrefixes []string
+}
+
+// NewAWS returns an AWS finder using sess's region and credentials.
+func NewAWS(sess *session.Session, tag string, logGroupPrefixes ...string) *AWS {
+	return &AWS{
+		Tagging:          resourcegroupstaggingapi.New(sess),
+		Logs:             cloudwatchlogs.New(sess),
+		EC2:              ec2.New(sess),
+		KMS:              kms.New(sess),
+		Tag:              tag,
+		LogGroupPrefixes: logGroupPrefixes,
+	}
+}
+
+// Find returns the resources still tagged with the run tag, except KMS keys
+// already scheduled for deletion, and the log groups under
+// LogGroupPrefixes.
+func (a *AWS) Find(ctx context.Context) ([]Resource, error) {
+	var arns []string
+	err := a.Tagging.GetResourcesPagesWithContext(ctx, &resourcegroupstaggingapi.GetResourcesInput{
+		TagFilters: []*resourcegroupstaggingapi.TagFilter{{Key: aws.String(TagKey), Values: aws.StringSlice([]string{a.Tag})}},
+	}, func(out *resourcegroupstaggingapi.GetResourcesOutput, _ bool) bool {
+		for _, m := range out.ResourceTagMappingList {
+			arns = append(arns, aws.StringValue(m.ResourceARN))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing resources tagged %s=%s: %w", TagKey, a.Tag, err)
+	}
+
+	var out []Resource
+	seen := map[string]bool{}
+	for _, id := range arns {
+		typ := arnType(id)
+		if typ == "kms:key" {
+			pending, err := a.keyPendingDeletion(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if pending {
+				continue
+			}
+		}
+		seen[id] = true
+		out = append(out, Resource{ID: id, Type: typ, Purgeable: purgeableAWS[typ]})
+	}
+
+	for _, prefix := range a.LogGroupPrefixes {
+		err := a.Logs.DescribeLogGroupsPagesWithContext(ctx, &cloudwatchlogs.DescribeLogGroupsInput{
+			LogGroupNamePrefix: aws.String(prefix),
+		}, func(page *cloudwatchlogs.DescribeLogGroupsOutput, _ bool) bool {
+			for _, g := range page.LogGroups {
+				// DescribeLogGroups ARNs end in :*, tagging API ones do not.
+				id := strings.TrimSuffix(aws.StringValue(g.Arn), ":*")
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+				out = append(out, Resource{
+					ID: id, Type: "logs:log-group", Purgeable: true,
+					Note: fmt.Sprintf("log group under %s, recreated after destroy", prefix),
+				})
+			}
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("listing log groups under %s: %w", prefix, err)
+		}
+	}
+	return out, nil
+}
+
+// purgeableAWS are the resource types Purge deletes: log groups services
+// recreate and network interfaces they leave detached.
+var purgeableAWS = map[string]bool{
+	"logs:log-group":        true,
+	"ec2:network-interface": true,
+}
+
+// Purge deletes a log group or a detached network interface.
+func (a *AWS) Purge(ctx context.Context, r Resource) error {
+	parsed, err := arn.Parse(r.ID)
+	if err != nil {
+		return err
+	}
+	switch r.Type {
+	case "logs:log-group":
+		name := strings.TrimPrefix(parsed.Resource, "log-group:")
+		_, err = a.Logs.DeleteLogGroupWithContext(ctx, &cloudwatchlogs.DeleteLogGroupInput{LogGroupName: aws.String(name)})
+	case "ec2:network-interface":
+		id := strings.TrimPrefix(parsed.Resource, "network-interface/")
+		_, err = a.EC2.DeleteNetworkInterfaceWithContext(ctx, &ec2.DeleteNetworkInterfaceInput{NetworkInterfaceId: aws.String(id)})
+	default:
+		return ErrNotPurgeable
+	}
+	return err
+}
+
+func (a *AWS) keyPendingDeletion(ctx context.Context, id string) (bool, error) {
+	out, err := a.KMS.DescribeKeyWithContext(ctx, &kms.DescribeKeyInput{KeyId: aws.String(id)})
+	if err != nil {
+		return false, fmt.Errorf("describing %s: %w", id, err)
+	}
+	state := aws.StringValue(out.KeyMetadata.KeyState)
+	return state == kms.KeyStatePendingDeletion || state == kms.KeyStatePendingReplicaDeletion, nil
+}
+
+// arnType returns service:resource-type for an ARN, e.g.
+// ec2:network-interface, or just the service when the resource has no type
+// (S3 buckets).
+func arnType(id string) string {
+	parsed, err := arn.Parse(id)
+	if err != nil {
+		return "unknown"
+	}
+	if i := strings.IndexAny(parsed.Resource, "/:"); i >= 0 {
+		return parsed.Service + ":" + parsed.Resource[:i]
+	}
+	return parsed.Service
+}
@@ -0,0 +1,248 @@
+package leftover
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultARMEndpoint is the public-cloud Resource Manager endpoint.
+const DefaultARMEndpoint = "https://management.azure.com"
+
+const (
+	resourceGraphAPIVersion = "2021-03-01"
+	keyVaultAPIVersion      = "2022-07-01"
+	deletedVaultType        = "Microsoft.KeyVault/deletedVaults"
+)
+
+// Azure finds a run's leftovers in a subscription.
+type Azure struct {
+	Client *http.Client
+	// Endpoint is the Resource Manager endpoint; DefaultARMEndpoint if
+	// empty.
+	Endpoint     string
+	Subscription string
+	// Token returns a bearer token for Endpoint.
+	Token func(ctx context.Context) (string, error)
+	// Tag is the run tag.
+	Tag string
+}
+
+// NewAzure returns an Azure finder for the subscription and service
+// principal in ARM_SUBSCRIPTION_ID, ARM_TENANT_ID, ARM_CLIENT_ID and
+// ARM_CLIENT_SECRET, the variables the azurerm provider reads.
+func NewAzure(tag string) (*Azure, error) {
+	env := map[string]string{}
+	for _, k := range []string{"ARM_SUBSCRIPTION_ID", "ARM_TENANT_ID", "ARM_CLIENT_ID", "ARM_CLIENT_SECRET"} {
+		if env[k] = os.Getenv(k); env[k] == "" {
+			return nil, fmt.Errorf("%s is not set", k)
+		}
+	}
+	client := &http.Client{Timeout: time.Minute}
+	return &Azure{
+		Client:       client,
+		Subscription: env["ARM_SUBSCRIPTION_ID"],
+		Token:        clientCredentials(client, env["ARM_TENANT_ID"], env["ARM_CLIENT_ID"], env["ARM_CLIENT_SECRET"]),
+		Tag:          tag,
+	}, nil
+}
+
+// clientCredentials returns a token source for the service principal,
+// caching each token until shortly before it expires.
+func clientCredentials(client *http.Client, tenant, id, secret string) func(context.Context) (string, error) {
+	var (
+		mu      sync.Mutex
+		token   string
+		expires time.Time
+	)
+	return func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if token != "" && time.Now().Before(expires) {
+			return token, nil
+		}
+		form := url.Values{
+			"grant_type":    {"client_credentials"},
+			"client_id":     {id},
+			"client_secret": {secret},
+			"scope":         {DefaultARMEndpoint + "/.default"},
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+			"https://login.microsoftonline.com/"+url.PathEscape(tenant)+"/oauth2/v2.0/token", strings.NewReader(form.Encode()))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		var out struct {
+			AccessToken string `json:"access_token"`
+			ExpiresIn   int    `json:"expires_in"`
+		}
+		if err := do(client, req, &out); err != nil {
+			return "", fmt.Errorf("getting a token for %s: %w", id, err)
+		}
+		token, expires = out.AccessToken, time.Now().Add(time.Duration(out.ExpiresIn)*time.Second-time.Minute)
+		return token, nil
+	}
+}
+
+// Find returns the resources and resource groups Resource Graph still
+// lists with the run tag, and the soft-deleted Key Vaults that carried it.
+func (a *Azure) Find(ctx context.Context) ([]Resource, error) {
+	tagged, err := a.graph(ctx)
+	if err != nil {
+		return nil, err
+	}
+	vaults, err := a.deletedVaults(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append(tagged, vaults...), nil
+}
+
+func (a *Azure) graph(ctx context.Context) ([]Resource, error) {
+	query := fmt.Sprintf("resourcecontainers | union resources | where tags[%s] == %s | project id, type",
+		kqlString(TagKey), kqlString(a.Tag))
+	var out []Resource
+	skip := ""
+	for {
+		body := map[string]interface{}{"subscriptions": []string{a.Subscription}, "query": query}
+		if skip != "" {
+			body["options"] = map[string]string{"$skipToken": skip}
+		}
+		var page struct {
+			Data []struct {
+				ID   string `json:"id"`
+				Type string `json:"type"`
+			} `json:"data"`
+			SkipToken string `json:"$skipToken"`
+		}
+		if err := a.call(ctx, http.MethodPost, "/providers/Microsoft.ResourceGraph/resources?api-version="+resourceGraphAPIVersion, body, &page); err != nil {
+			return nil, fmt.Errorf("querying Resource Graph for %s=%s: %w", TagKey, a.Tag, err)
+		}
+		for _, r := range page.Data {
+			out = append(out, Resource{ID: r.ID, Type: r.Type})
+		}
+		if skip = page.SkipToken; skip == "" {
+			return out, nil
+		}
+	}
+}
+
+func (a *Azure) deletedVaults(ctx context.Context) ([]Resource, error) {
+	var out []Resource
+	next := "/subscriptions/" + url.PathEscape(a.Subscription) + "/providers/Microsoft.KeyVault/deletedVaults?api-version=" + keyVaultAPIVersion
+	for next != "" {
+		var page struct {
+			Value []struct {
+				ID         string `json:"id"`
+				Properties struct {
+					Tags                   map[string]string `json:"tags"`
+					ScheduledPurgeDate     string            `json:"scheduledPurgeDate"`
+					PurgeProtectionEnabled bool              `json:"purgeProtectionEnabled"`
+				} `json:"properties"`
+			} `json:"value"`
+			NextLink string `json:"nextLink"`
+		}
+		if err := a.call(ctx, http.MethodGet, next, nil, &page); err != nil {
+			return nil, fmt.Errorf("listing deleted Key Vaults: %w", err)
+		}
+		for _, v := range page.Value {
+			if v.Properties.Tags[TagKey] != a.Tag {
+				continue
+			}
+			note := "soft-deleted Key Vault"
+			if v.Properties.PurgeProtectionEnabled {
+				note += " with purge protection"
+			}
+			if v.Properties.ScheduledPurgeDate != "" {
+				note += ", purged by Azure on " + v.Properties.ScheduledPurgeDate
+			}
+			out = append(out, Resource{ID: v.ID, Type: deletedVaultType, Purgeable: !v.Properties.PurgeProtectionEnabled, Note: note})
+		}
+		next = strings.TrimPrefix(page.NextLink, a.endpoint())
+	}
+	return out, nil
+}
+
+// Purge purges a soft-deleted Key Vault.
+func (a *Azure) Purge(ctx context.Context, r Resource) error {
+	if r.Type != deletedVaultType {
+		return ErrNotPurgeable
+	}
+	return a.call(ctx, http.MethodPost, r.ID+"/purge?api-version="+keyVaultAPIVersion, nil, nil)
+}
+
+func (a *Azure) endpoint() string {
+	if a.Endpoint != "" {
+		return strings.TrimSuffix(a.Endpoint, "/")
+	}
+	return DefaultARMEndpoint
+}
+
+// call sends a Resource Manager request to path, which includes the query,
+// and decodes the JSON response into out if it is not nil.
+func (a *Azure) call(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.endpoint()+path, body)
+	if err != nil {
+		return err
+	}
+	token, err := a.Token(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return do(a.Client, req, out)
+}
+
+func do(client *http.Client, req *http.Request, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(data, &e) == nil && e.Error.Code != "" {
+			return fmt.Errorf("%s: %s: %s", resp.Status, e.Error.Code, e.Error.Message)
+		}
+		return errors.New(resp.Status)
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// kqlString quotes s as a Kusto string literal.
+func kqlString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
@@ -0,0 +1,140 @@
+// Package leftover finds what a test left behind although terraform
+// destroy succeeded. Every test tags its resources with a run tag unique
+// to the test and run; afterwards the cloud inventories (the AWS Resource
+// Groups Tagging API, Azure Resource Graph) are asked for anything still
+// carrying it, along with the stragglers the tag does not reach: Key Vaults
+// held in soft-delete and log groups EKS recreates while a cluster is
+// deleted.
+//
+// The inventories lag behind deletes, so Check polls until nothing is left
+// or its context ends, and only then reports or purges.
+package leftover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// TagKey is the tag every test resource carries its run tag under.
+const TagKey = "TestRun"
+
+// maxTagValue is the shorter of the AWS and Azure tag value limits.
+const maxTagValue = 256
+
+var unsafeTagChars = regexp.MustCompile(`[^A-Za-z0-9_.:/=+@-]+`)
+
+// RunTag returns the run tag for a test: its name, with characters AWS
+// does not allow in tag values replaced, followed by suffix, which should
+// differ between runs.
+func RunTag(testName, suffix string) string {
+	name := unsafeTagChars.ReplaceAllString(testName, "-")
+	if limit := maxTagValue - len(suffix) - 1; len(name) > limit {
+		name = name[:limit]
+	}
+	return name + "-" + suffix
+}
+
+// Tag returns vars with TagKey set to value in its tags input, keeping the
+// tags already there. vars itself is not modified.
+func Tag(vars map[string]interface{}, value string) (map[string]interface{}, error) {
+	tags := map[string]interface{}{}
+	switch existing := vars["tags"].(type) {
+	case nil:
+	case map[string]string:
+		for k, v := range existing {
+			tags[k] = v
+		}
+	case map[string]interface{}:
+		for k, v := range existing {
+			tags[k] = v
+		}
+	default:
+		return nil, fmt.Errorf("tags input is a %T, not a map", existing)
+	}
+	tags[TagKey] = value
+
+	out := make(map[string]interface{}, len(vars)+1)
+	for k, v := range vars {
+		out[k] = v
+	}
+	out["tags"] = tags
+	return out, nil
+}
+
+// Resource is something found after destroy.
+type Resource struct {
+	// ID is the ARN or Azure resource ID.
+	ID string
+	// Type is service:resource-type for AWS, e.g. ec2:network-interface,
+	// and the resource provider type for Azure.
+	Type string
+	// Purgeable reports whether Purge can remove it.
+	Purgeable bool
+	// Note says why a known straggler outlived destroy.
+	Note string
+}
+
+func (r Resource) String() string {
+	s := fmt.Sprintf("%s (%s)", r.ID, r.Type)
+	if r.Note != "" {
+		s += ": " + r.Note
+	}
+	return s
+}
+
+// Finder lists what is left of a test run in one inventory and removes it.
+type Finder interface {
+	Find(ctx context.Context) ([]Resource, error)
+	Purge(ctx context.Context, r Resource) error
+}
+
+// ErrNotPurgeable is returned by Purge for resources it cannot remove.
+var ErrNotPurgeable = errors.New("no purge for this resource type")
+
+// Check asks f every interval until nothing is left or ctx ends, then, if
+// purge is set, purges whatever it can. It returns what is still there and
+// what was purged; err is the last Find error, or a joined purge error.
+func Check(ctx context.Context, f Finder, interval time.Duration, purge bool) (left, purged []Resource, err error) {
+	for done := false; !done; {
+		found, ferr := f.Find(ctx)
+		switch {
+		case ferr == nil && len(found) == 0:
+			return nil, nil, nil
+		case ferr == nil:
+			left, err = found, nil
+		case ctx.Err() == nil || left == nil:
+			// Keep the last answer over an error caused by ctx ending.
+			err = ferr
+		}
+		select {
+		case <-ctx.Done():
+			done = true
+		case <-time.After(interval):
+		}
+	}
+	if !purge || len(left) == 0 {
+		return left, nil, err
+	}
+
+	// The wait used up ctx; purging gets its own.
+	pctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Minute)
+	defer cancel()
+	var remaining []Resource
+	var errs []error
+	for _, r := range left {
+		if !r.Purgeable {
+			remaining = append(remaining, r)
+			continue
+		}
+		if perr := f.Purge(pctx, r); perr != nil {
+			remaining = append(remaining, r)
+			errs = append(errs, fmt.Errorf("purging %s: %w", r.ID, perr))
+			continue
+		}
+		purged = append(purged, r)
+	}
+	return remaining, purged, errors.Join(append([]error{err}, errs...)...)
+}
@@ -0,0 +1,249 @@
+package leftover_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/leftover"
+)
+
+func TestRunTag(t *testing.T) {
+	assert.Equal(t, "TestKmsKeyPolicies/logs=true-state=false-1234", leftover.RunTag("TestKmsKeyPolicies/logs=true,state=false", "1234"))
+	assert.Len(t, leftover.RunTag(strings.Repeat("x", 300), "1234"), 256)
+}
+
+func TestTag(t *testing.T) {
+	vars := map[string]interface{}{"project": "p", "tags": map[string]string{"ManagedBy": "terratest"}}
+	tagged, err := leftover.Tag(vars, "run-1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"ManagedBy": "terratest", leftover.TagKey: "run-1"}, tagged["tags"])
+	assert.Equal(t, "p", tagged["project"])
+	assert.Equal(t, map[string]string{"ManagedBy": "terratest"}, vars["tags"], "the input is left alone")
+
+	tagged, err = leftover.Tag(nil, "run-1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{leftover.TagKey: "run-1"}, tagged["tags"])
+
+	_, err = leftover.Tag(map[string]interface{}{"tags": "x"}, "run-1")
+	assert.Error(t, err)
+}
+
+type fakeTagging struct{ arns []string }
+
+func (f *fakeTagging) GetResourcesPagesWithContext(_ aws.Context, in *resourcegroupstaggingapi.GetResourcesInput, fn func(*resourcegroupstaggingapi.GetResourcesOutput, bool) bool, _ ...request.Option) error {
+	if aws.StringValue(in.TagFilters[0].Key) != leftover.TagKey || aws.StringValue(in.TagFilters[0].Values[0]) != "run-1" {
+		return nil
+	}
+	out := &resourcegroupstaggingapi.GetResourcesOutput{}
+	for _, a := range f.arns {
+		out.ResourceTagMappingList = append(out.ResourceTagMappingList, &resourcegroupstaggingapi.ResourceTagMapping{ResourceARN: aws.String(a)})
+	}
+	fn(out, true)
+	return nil
+}
+
+type fakeLogs struct {
+	groups  []string
+	deleted []string
+}
+
+func (f *fakeLogs) DescribeLogGroupsPagesWithContext(_ aws.Context, in *cloudwatchlogs.DescribeLogGroupsInput, fn func(*cloudwatchlogs.DescribeLogGroupsOutput, bool) bool, _ ...request.Option) error {
+	out := &cloudwatchlogs.DescribeLogGroupsOutput{}
+	for _, g := range f.groups {
+		if strings.HasPrefix(g, aws.StringValue(in.LogGroupNamePrefix)) {
+			out.LogGroups = append(out.LogGroups, &cloudwatchlogs.LogGroup{
+				LogGroupName: aws.String(g),
+				Arn:          aws.String("arn:aws:logs:us-east-1:111111111111:log-group:" + g + ":*"),
+			})
+		}
+	}
+	fn(out, true)
+	return nil
+}
+
+func (f *fakeLogs) DeleteLogGroupWithContext(_ aws.Context, in *cloudwatchlogs.DeleteLogGroupInput, _ ...request.Option) (*cloudwatchlogs.DeleteLogGroupOutput, error) {
+	f.deleted = append(f.deleted, aws.StringValue(in.LogGroupName))
+	return &cloudwatchlogs.DeleteLogGroupOutput{}, nil
+}
+
+type fakeEC2 struct{ deleted []string }
+
+func (f *fakeEC2) DeleteNetworkInterfaceWithContext(_ aws.Context, in *ec2.DeleteNetworkInterfaceInput, _ ...request.Option) (*ec2.DeleteNetworkInterfaceOutput, error) {
+	f.deleted = append(f.deleted, aws.StringValue(in.NetworkInterfaceId))
+	return &ec2.DeleteNetworkInterfaceOutput{}, nil
+}
+
+type fakeKMS struct{ states map[string]string }
+
+func (f *fakeKMS) DescribeKeyWithContext(_ aws.Context, in *kms.DescribeKeyInput, _ ...request.Option) (*kms.DescribeKeyOutput, error) {
+	return &kms.DescribeKeyOutput{KeyMetadata: &kms.KeyMetadata{KeyState: aws.String(f.states[aws.StringValue(in.KeyId)])}}, nil
+}
+
+func TestAWS(t *testing.T) {
+	const (
+		eni     = "arn:aws:ec2:us-east-1:111111111111:network-interface/eni-0abc"
+		bucket  = "arn:aws:s3:::tf-state-test-1234"
+		key     = "arn:aws:kms:us-east-1:111111111111:key/1111"
+		retired = "arn:aws:kms:us-east-1:111111111111:key/2222"
+		group   = "arn:aws:logs:us-east-1:111111111111:log-group:/aws/eks/test-1234-dev-eks/cluster"
+	)
+	logs := &fakeLogs{groups: []string{"/aws/eks/test-1234-dev-eks/cluster", "/aws/eks/other/cluster"}}
+	ec2Fake := &fakeEC2{}
+	finder := &leftover.AWS{
+		Tagging: &fakeTagging{arns: []string{eni, bucket, key, retired, group}},
+		Logs:    logs,
+		EC2:     ec2Fake,
+		KMS:     &fakeKMS{states: map[string]string{key: "Enabled", retired: "PendingDeletion"}},
+		Tag:     "run-1",
+		// Tagged or not, the group is reported once.
+		LogGroupPrefixes: []string{"/aws/eks/test-1234-dev-eks/"},
+	}
+
+	found, err := finder.Find(context.Background())
+	require.NoError(t, err)
+	require.Len(t, found, 4, "keys pending deletion are as gone as Terraform can make them")
+	assert.Equal(t, leftover.Resource{ID: eni, Type: "ec2:network-interface", Purgeable: true}, found[0])
+	assert.Equal(t, "s3", found[1].Type)
+	assert.Equal(t, "kms:key", found[2].Type)
+	assert.False(t, found[2].Purgeable)
+	assert.Equal(t, "logs:log-group", found[3].Type)
+
+	finder.Tagging = &fakeTagging{}
+	found, err = finder.Find(context.Background())
+	require.NoError(t, err)
+	require.Len(t, found, 1, "an untagged group under a watched prefix is still found")
+	assert.Equal(t, group, found[0].ID)
+	assert.Contains(t, found[0].String(), "recreated after destroy")
+
+	require.NoError(t, finder.Purge(context.Background(), found[0]))
+	assert.Equal(t, []string{"/aws/eks/test-1234-dev-eks/cluster"}, logs.deleted)
+	require.NoError(t, finder.Purge(context.Background(), leftover.Resource{ID: eni, Type: "ec2:network-interface"}))
+	assert.Equal(t, []string{"eni-0abc"}, ec2Fake.deleted)
+	assert.ErrorIs(t, finder.Purge(context.Background(), leftover.Resource{ID: bucket, Type: "s3"}), leftover.ErrNotPurgeable)
+}
+
+func TestAzure(t *testing.T) {
+	var purged []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		switch {
+		case r.URL.Path == "/providers/Microsoft.ResourceGraph/resources":
+			var body struct {
+				Query   string            `json:"query"`
+				Options map[string]string `json:"options"`
+			}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			assert.Contains(t, body.Query, `where tags['TestRun'] == 'run-\'1'`)
+			if body.Options["$skipToken"] == "" {
+				w.Write([]byte(`{"data": [{"id": "/subscriptions/sub/resourceGroups/test-rg", "type": "microsoft.resources/subscriptions/resourcegroups"}], "$skipToken": "next"}`))
+				return
+			}
+			w.Write([]byte(`{"data": [{"id": "/subscriptions/sub/resourceGroups/test-rg/providers/Microsoft.Network/networkInterfaces/nic", "type": "microsoft.network/networkinterfaces"}]}`))
+		case r.URL.Path == "/subscriptions/sub/providers/Microsoft.KeyVault/deletedVaults":
+			w.Write([]byte(`{"value": [
+			  {"id": "/subscriptions/sub/providers/Microsoft.KeyVault/locations/eastus/deletedVaults/kv-a", "properties": {"tags": {"TestRun": "run-'1"}, "scheduledPurgeDate": "2026-10-26T00:00:00Z"}},
+			  {"id": "/subscriptions/sub/providers/Microsoft.KeyVault/locations/eastus/deletedVaults/kv-b", "properties": {"tags": {"TestRun": "run-'1"}, "purgeProtectionEnabled": true}},
+			  {"id": "/subscriptions/sub/providers/Microsoft.KeyVault/locations/eastus/deletedVaults/kv-c", "properties": {"tags": {"TestRun": "other"}}}
+			]}`))
+		case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/purge"):
+			purged = append(purged, r.URL.Path)
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	finder := &leftover.Azure{
+		Client:       srv.Client(),
+		Endpoint:     srv.URL,
+		Subscription: "sub",
+		Token:        func(context.Context) (string, error) { return "token", nil },
+		Tag:          "run-'1",
+	}
+	found, err := finder.Find(context.Background())
+	require.NoError(t, err)
+	require.Len(t, found, 4)
+	assert.Equal(t, "microsoft.resources/subscriptions/resourcegroups", found[0].Type)
+	assert.Equal(t, "microsoft.network/networkinterfaces", found[1].Type)
+	assert.False(t, found[1].Purgeable)
+	assert.True(t, found[2].Purgeable)
+	assert.Equal(t, "soft-deleted Key Vault, purged by Azure on 2026-10-26T00:00:00Z", found[2].Note)
+	assert.False(t, found[3].Purgeable, "purge protection cannot be overridden")
+
+	require.NoError(t, finder.Purge(context.Background(), found[2]))
+	assert.Equal(t, []string{"/subscriptions/sub/providers/Microsoft.KeyVault/locations/eastus/deletedVaults/kv-a/purge"}, purged)
+	assert.ErrorIs(t, finder.Purge(context.Background(), found[1]), leftover.ErrNotPurgeable)
+}
+
+// fakeFinder reports its resources until the inventory catches up after
+// lag calls, and removes what is purged.
+type fakeFinder struct {
+	left  []leftover.Resource
+	lag   int
+	calls int
+}
+
+func (f *fakeFinder) Find(context.Context) ([]leftover.Resource, error) {
+	f.calls++
+	if f.calls > f.lag {
+		var out []leftover.Resource
+		for _, r := range f.left {
+			if !strings.HasPrefix(r.ID, "deleted/") {
+				out = append(out, r)
+			}
+		}
+		return out, nil
+	}
+	return f.left, nil
+}
+
+func (f *fakeFinder) Purge(_ context.Context, r leftover.Resource) error {
+	for i := range f.left {
+		if f.left[i].ID == r.ID {
+			f.left = append(f.left[:i], f.left[i+1:]...)
+			return nil
+		}
+	}
+	return leftover.ErrNotPurgeable
+}
+
+func TestCheck(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// Deleted resources the inventory still lists are waited out.
+	f := &fakeFinder{left: []leftover.Resource{{ID: "deleted/bucket"}}, lag: 2}
+	left, purged, err := leftover.Check(ctx, f, time.Millisecond, true)
+	require.NoError(t, err)
+	assert.Empty(t, left)
+	assert.Empty(t, purged)
+	assert.Equal(t, 3, f.calls)
+
+	short, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	f = &fakeFinder{left: []leftover.Resource{{ID: "log-group", Purgeable: true}, {ID: "bucket"}}}
+	left, purged, err = leftover.Check(short, f, time.Millisecond, false)
+	require.NoError(t, err)
+	assert.Len(t, left, 2)
+	assert.Empty(t, purged, "nothing is purged unless asked")
+
+	left, purged, err = leftover.Check(short, f, time.Millisecond, true)
+	require.NoError(t, err)
+	assert.Equal(t, []leftover.Resource{{ID: "bucket"}}, left)
+	assert.Equal(t, []leftover.Resource{{ID: "log-group", Purgeable: true}}, purged)
+}
@@ -0,0 +1,304 @@
+// Package moved pairs the resources a refactor would destroy with the ones
+// it would create in their place, and renders the pairs as moved blocks or
+// terraform state mv commands so the refactor applies without recreating
+// anything.
+package moved
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Instance is one resource instance on either side of a refactor.
+type Instance struct {
+	// Address is the full instance address, e.g.
+	// module.vpc.aws_route_table_association.private["0"].
+	Address       string
+	ModuleAddress string
+	Type          string
+	Name          string
+	// Key is the count index (an int) or for_each key (a string), nil for
+	// a single instance.
+	Key interface{}
+	// Values are the known attribute values: before the change for old
+	// instances, after it for new ones.
+	Values map[string]interface{}
+}
+
+// Move is a matched pair.
+type Move struct {
+	From string
+	To   string
+	// By says how the pair was matched: the identifying attributes that
+	// agree, or "key" when only the instance keys correspond.
+	By string
+}
+
+// Result is the outcome of Match.
+type Result struct {
+	Moves []Move
+	// Unmatched are the instances still destroyed or created. Ambiguous
+	// pairs, where an old instance matches several new ones, land here
+	// too.
+	UnmatchedOld []Instance
+	UnmatchedNew []Instance
+}
+
+// Identity lists the attributes that identify a resource of a type. Types
+// not listed are matched on every attribute known on both sides except
+// the provider-assigned ones in ignored.
+var Identity = map[string][]string{
+	"aws_route_table_association":    {"subnet_id", "route_table_id", "gateway_id"},
+	"aws_route":                      {"route_table_id", "destination_cidr_block", "destination_ipv6_cidr_block", "destination_prefix_list_id"},
+	"aws_subnet":                     {"vpc_id", "cidr_block"},
+	"aws_nat_gateway":                {"subnet_id", "connectivity_type"},
+	"aws_eip":                        {"domain", "tags"},
+	"aws_route_table":                {"vpc_id", "tags"},
+	"aws_vpc_endpoint":               {"vpc_id", "service_name"},
+	"aws_security_group_rule":        {"security_group_id", "type", "protocol", "from_port", "to_port", "cidr_blocks", "source_security_group_id"},
+	"aws_iam_role_policy_attachment": {"role", "policy_arn"},
+	"aws_eks_node_group":             {"cluster_name", "node_group_name"},
+	"aws_kms_alias":                  {"name"},
+	"azurerm_subnet":                 {"virtual_network_name", "address_prefixes"},
+	"azurerm_role_assignment":        {"scope", "role_definition_name", "principal_id"},
+	"azurerm_private_dns_zone_virtual_network_link": {"private_dns_zone_name", "virtual_network_id"},
+}
+
+// ignored attributes are assigned by the provider, so they never agree
+// between an existing instance and a planned one.
+var ignored = map[string]bool{"id": true, "arn": true, "tags_all": true, "owner_id": true}
+
+// FromPlan returns the instances a plan destroys without recreating them at
+// the same address, and the ones it creates. Replacements are neither.
+func FromPlan(plan *tfjson.Plan) (old, created []Instance) {
+	for _, rc := range plan.ResourceChanges {
+		if rc.Mode != tfjson.ManagedResourceMode || rc.Change == nil {
+			continue
+		}
+		in := Instance{Address: rc.Address, ModuleAddress: rc.ModuleAddress, Type: rc.Type, Name: rc.Name, Key: instanceKey(rc.Index)}
+		switch a := rc.Change.Actions; {
+		case a.Delete():
+			in.Values, _ = rc.Change.Before.(map[string]interface{})
+			old = append(old, in)
+		case a.Create():
+			in.Values, _ = rc.Change.After.(map[string]interface{})
+			created = append(created, in)
+		}
+	}
+	return old, created
+}
+
+// FromStates returns the instances only in the old state and the ones only
+// in the new state, e.g. from `terraform show -json` before and after the
+// refactor is applied to a scratch copy.
+func FromStates(oldState, newState *tfjson.State) (old, created []Instance) {
+	before, after := stateInstances(oldState), stateInstances(newState)
+	for addr, in := range before {
+		if _, ok := after[addr]; !ok {
+			old = append(old, in)
+		}
+	}
+	for addr, in := range after {
+		if _, ok := before[addr]; !ok {
+			created = append(created, in)
+		}
+	}
+	sortInstances(old)
+	sortInstances(created)
+	return old, created
+}
+
+func stateInstances(s *tfjson.State) map[string]Instance {
+	out := map[string]Instance{}
+	if s == nil || s.Values == nil {
+		return out
+	}
+	var walk func(m *tfjson.StateModule)
+	walk = func(m *tfjson.StateModule) {
+		for _, r := range m.Resources {
+			if r.Mode != tfjson.ManagedResourceMode {
+				continue
+			}
+			out[r.Address] = Instance{
+				Address:       r.Address,
+				ModuleAddress: m.Address,
+				Type:          r.Type,
+				Name:          r.Name,
+				Key:           instanceKey(r.Index),
+				Values:        r.AttributeValues,
+			}
+		}
+		for _, c := range m.ChildModules {
+			walk(c)
+		}
+	}
+	walk(s.Values.RootModule)
+	return out
+}
+
+// instanceKey normalises a JSON index to an int or a string.
+func instanceKey(index interface{}) interface{} {
+	switch k := index.(type) {
+	case float64:
+		return int(k)
+	case json.Number:
+		if i, err := k.Int64(); err == nil {
+			return int(i)
+		}
+		return k.String()
+	}
+	return index
+}
+
+func sortInstances(in []Instance) {
+	sort.Slice(in, func(i, j int) bool { return in[i].Address < in[j].Address })
+}
+
+// Match pairs old and new instances of the same type in the same module.
+// A pair matches when the identifying attributes known on both sides agree.
+// When an old instance agrees with several new ones, or no attribute can
+// be compared because the new values are still unknown, the instance keys
+// decide: count index 0 corresponds to for_each key "0" and to the same
+// key under another name.
+func Match(old, created []Instance) Result {
+	var res Result
+	taken := map[string]bool{}
+	type group struct{ old, created []Instance }
+	groups := map[string]*group{}
+	var order []string
+	add := func(in Instance) *group {
+		k := in.ModuleAddress + "|" + in.Type
+		g := groups[k]
+		if g == nil {
+			g = &group{}
+			groups[k] = g
+			order = append(order, k)
+		}
+		return g
+	}
+	for _, in := range old {
+		g := add(in)
+		g.old = append(g.old, in)
+	}
+	for _, in := range created {
+		g := add(in)
+		g.created = append(g.created, in)
+	}
+	sort.Strings(order)
+
+	for _, k := range order {
+		g := groups[k]
+		for _, o := range g.old {
+			var candidates []Instance
+			var by []string
+			for _, n := range g.created {
+				if taken[n.Address] {
+					continue
+				}
+				if attrs, ok := agree(o, n); ok {
+					candidates = append(candidates, n)
+					by = append(by, "attributes "+strings.Join(attrs, ", "))
+				}
+			}
+			if len(candidates) != 1 {
+				// Narrow by key, among the attribute matches or, with
+				// none, among everything created.
+				pool, reason := candidates, by
+				if len(pool) == 0 {
+					for _, n := range g.created {
+						if !taken[n.Address] && compared(o, n) == nil {
+							pool = append(pool, n)
+							reason = append(reason, "key")
+						}
+					}
+				}
+				candidates, by = nil, nil
+				for i, n := range pool {
+					if sameKey(o.Key, n.Key) {
+						candidates = append(candidates, n)
+						by = append(by, reason[i])
+					}
+				}
+			}
+			if len(candidates) != 1 {
+				res.UnmatchedOld = append(res.UnmatchedOld, o)
+				continue
+			}
+			taken[candidates[0].Address] = true
+			res.Moves = append(res.Moves, Move{From: o.Address, To: candidates[0].Address, By: by[0]})
+		}
+		for _, n := range g.created {
+			if !taken[n.Address] {
+				res.UnmatchedNew = append(res.UnmatchedNew, n)
+			}
+		}
+	}
+	sort.Slice(res.Moves, func(i, j int) bool { return res.Moves[i].From < res.Moves[j].From })
+	sortInstances(res.UnmatchedOld)
+	sortInstances(res.UnmatchedNew)
+	return res
+}
+
+// compared returns the attributes to compare between o and n: the
+// type's identity attributes, or every attribute set on both. Attributes
+// unknown in n are absent from its values and so skipped.
+func compared(o, n Instance) []string {
+	var attrs []string
+	if id, ok := Identity[o.Type]; ok {
+		for _, a := range id {
+			if _, ok := n.Values[a]; ok && o.Values[a] != nil {
+				attrs = append(attrs, a)
+			}
+		}
+		return attrs
+	}
+	for a, v := range o.Values {
+		if ignored[a] || v == nil {
+			continue
+		}
+		if _, ok := n.Values[a]; ok {
+			attrs = append(attrs, a)
+		}
+	}
+	sort.Strings(attrs)
+	return attrs
+}
+
+// agree reports whether every compared attribute is equal, and which
+// ones were compared. With nothing to compare it reports false.
+func agree(o, n Instance) ([]string, bool) {
+	attrs := compared(o, n)
+	if len(attrs) == 0 {
+		return nil, false
+	}
+	for _, a := range attrs {
+		if !reflect.DeepEqual(o.Values[a], n.Values[a]) {
+			return nil, false
+		}
+	}
+	return attrs, true
+}
+
+// sameKey reports whether two instance keys correspond across a change of
+// count to for_each or back: 0 and "0" do.
+func sameKey(a, b interface{}) bool {
+	return keyString(a) == keyString(b)
+}
+
+func keyString(k interface{}) string {
+	switch k := k.(type) {
+	case nil:
+		return ""
+	case int:
+		return strconv.Itoa(k)
+	case string:
+		return k
+	}
+	return fmt.Sprint(k)
+}
@@ -0,0 +1,225 @@
+package moved_test
+
+import (
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/moved"
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+)
+
+// refactorPlan is the plan of module.vpc after aws_route_table_association.private
+// moved from count to for_each, with the private subnets also renamed from
+// aws_subnet.private to aws_subnet.this so their new IDs are unknown, and a
+// NAT gateway dropped for good.
+const refactorPlan = `{
+  "format_version": "1.2",
+  "resource_changes": [
+    {
+      "address": "module.vpc.aws_route_table_association.private[0]",
+      "module_address": "module.vpc", "mode": "managed",
+      "type": "aws_route_table_association", "name": "private", "index": 0,
+      "change": {"actions": ["delete"], "before": {"id": "rtbassoc-a", "subnet_id": "subnet-a", "route_table_id": "rtb-1", "gateway_id": null}, "after": null}
+    },
+    {
+      "address": "module.vpc.aws_route_table_association.private[1]",
+      "module_address": "module.vpc", "mode": "managed",
+      "type": "aws_route_table_association", "name": "private", "index": 1,
+      "change": {"actions": ["delete"], "before": {"id": "rtbassoc-b", "subnet_id": "subnet-b", "route_table_id": "rtb-1", "gateway_id": null}, "after": null}
+    },
+    {
+      "address": "module.vpc.aws_route_table_association.private[\"0\"]",
+      "module_address": "module.vpc", "mode": "managed",
+      "type": "aws_route_table_association", "name": "private", "index": "0",
+      "change": {"actions": ["create"], "before": null, "after": {"subnet_id": "subnet-a", "route_table_id": "rtb-1", "gateway_id": null}}
+    },
+    {
+      "address": "module.vpc.aws_route_table_association.private[\"1\"]",
+      "module_address": "module.vpc", "mode": "managed",
+      "type": "aws_route_table_association", "name": "private", "index": "1",
+      "change": {"actions": ["create"], "before": null, "after": {"subnet_id": "subnet-b", "route_table_id": "rtb-1", "gateway_id": null}}
+    },
+    {
+      "address": "module.vpc.aws_subnet.private[0]",
+      "module_address": "module.vpc", "mode": "managed",
+      "type": "aws_subnet", "name": "private", "index": 0,
+      "change": {"actions": ["delete"], "before": {"id": "subnet-a", "vpc_id": "vpc-1", "cidr_block": "10.0.10.0/24"}, "after": null}
+    },
+    {
+      "address": "module.vpc.aws_subnet.this[\"private-a\"]",
+      "module_address": "module.vpc", "mode": "managed",
+      "type": "aws_subnet", "name": "this", "index": "private-a",
+      "change": {"actions": ["create"], "before": null, "after": {"vpc_id": "vpc-1", "cidr_block": "10.0.10.0/24"}}
+    },
+    {
+      "address": "module.vpc.aws_subnet.this[\"private-b\"]",
+      "module_address": "module.vpc", "mode": "managed",
+      "type": "aws_subnet", "name": "this", "index": "private-b",
+      "change": {"actions": ["create"], "before": null, "after": {"vpc_id": "vpc-1", "cidr_block": "10.0.11.0/24"}}
+    },
+    {
+      "address": "module.vpc.aws_nat_gateway.this[0]",
+      "module_address": "module.vpc", "mode": "managed",
+      "type": "aws_nat_gateway", "name": "this", "index": 0,
+      "change": {"actions": ["delete"], "before": {"id": "nat-1", "subnet_id": "subnet-p"}, "after": null}
+    },
+    {
+      "address": "module.vpc.aws_route_table.private[0]",
+      "module_address": "module.vpc", "mode": "managed",
+      "type": "aws_route_table", "name": "private", "index": 0,
+      "change": {"actions": ["delete", "create"], "before": {"id": "rtb-1"}, "after": {}}
+    }
+  ]
+}`
+
+// movedPlan is the same refactor planned again with the generated blocks:
+// the moved instances are no-ops and only the NAT gateway goes.
+const movedPlan = `{
+  "format_version": "1.2",
+  "resource_changes": [
+    {
+      "address": "module.vpc.aws_route_table_association.private[\"0\"]",
+      "module_address": "module.vpc", "mode": "managed",
+      "type": "aws_route_table_association", "name": "private", "index": "0",
+      "change": {"actions": ["no-op"], "before": {"subnet_id": "subnet-a"}, "after": {"subnet_id": "subnet-a"}}
+    },
+    {
+      "address": "module.vpc.aws_nat_gateway.this[0]",
+      "module_address": "module.vpc", "mode": "managed",
+      "type": "aws_nat_gateway", "name": "this", "index": 0,
+      "change": {"actions": ["delete"], "before": {"id": "nat-1"}, "after": null}
+    }
+  ]
+}`
+
+func TestMatch(t *testing.T) {
+	plan, err := planjson.Parse([]byte(refactorPlan))
+	require.NoError(t, err)
+
+	old, created := moved.FromPlan(plan)
+	require.Len(t, old, 4, "replacements are neither old nor new")
+	require.Len(t, created, 4)
+	assert.Equal(t, 0, old[0].Key)
+	assert.Equal(t, "0", created[0].Key)
+
+	res := moved.Match(old, created)
+	assert.Equal(t, []moved.Move{
+		{
+			From: `module.vpc.aws_route_table_association.private[0]`,
+			To:   `module.vpc.aws_route_table_association.private["0"]`,
+			By:   "attributes subnet_id, route_table_id",
+		},
+		{
+			From: `module.vpc.aws_route_table_association.private[1]`,
+			To:   `module.vpc.aws_route_table_association.private["1"]`,
+			By:   "attributes subnet_id, route_table_id",
+		},
+		{
+			From: `module.vpc.aws_subnet.private[0]`,
+			To:   `module.vpc.aws_subnet.this["private-a"]`,
+			By:   "attributes vpc_id, cidr_block",
+		},
+	}, res.Moves)
+	require.Len(t, res.UnmatchedOld, 1)
+	assert.Equal(t, "module.vpc.aws_nat_gateway.this[0]", res.UnmatchedOld[0].Address)
+	require.Len(t, res.UnmatchedNew, 1)
+	assert.Equal(t, `module.vpc.aws_subnet.this["private-b"]`, res.UnmatchedNew[0].Address)
+}
+
+func TestMatchByKey(t *testing.T) {
+	// The new subnet IDs are unknown, so only the keys can pair these.
+	old := []moved.Instance{
+		{Address: "aws_route_table_association.private[0]", Type: "aws_route_table_association", Key: 0, Values: map[string]interface{}{"subnet_id": "subnet-a"}},
+		{Address: "aws_route_table_association.private[1]", Type: "aws_route_table_association", Key: 1, Values: map[string]interface{}{"subnet_id": "subnet-b"}},
+	}
+	created := []moved.Instance{
+		{Address: `aws_route_table_association.private["1"]`, Type: "aws_route_table_association", Key: "1", Values: map[string]interface{}{}},
+		{Address: `aws_route_table_association.private["0"]`, Type: "aws_route_table_association", Key: "0", Values: map[string]interface{}{}},
+	}
+	res := moved.Match(old, created)
+	require.Len(t, res.Moves, 2)
+	assert.Equal(t, `aws_route_table_association.private["0"]`, res.Moves[0].To)
+	assert.Equal(t, "key", res.Moves[0].By)
+	assert.Equal(t, `aws_route_table_association.private["1"]`, res.Moves[1].To)
+
+	// Known attributes that disagree are never overridden by the key.
+	created[1].Values = map[string]interface{}{"subnet_id": "subnet-z"}
+	res = moved.Match(old[:1], created[1:])
+	assert.Empty(t, res.Moves)
+	assert.Len(t, res.UnmatchedOld, 1)
+}
+
+func TestMatchAmbiguous(t *testing.T) {
+	// Two associations share a route table and nothing else is known: with
+	// no key in common neither pair can be chosen.
+	values := map[string]interface{}{"route_table_id": "rtb-1"}
+	old := []moved.Instance{{Address: "aws_route_table_association.a", Type: "aws_route_table_association", Values: values}}
+	created := []moved.Instance{
+		{Address: `aws_route_table_association.b["x"]`, Type: "aws_route_table_association", Key: "x", Values: values},
+		{Address: `aws_route_table_association.b["y"]`, Type: "aws_route_table_association", Key: "y", Values: values},
+	}
+	res := moved.Match(old, created)
+	assert.Empty(t, res.Moves)
+	assert.Len(t, res.UnmatchedOld, 1)
+	assert.Len(t, res.UnmatchedNew, 2)
+}
+
+func TestFromStates(t *testing.T) {
+	state := func(addr string, index interface{}) *tfjson.State {
+		return &tfjson.State{Values: &tfjson.StateValues{RootModule: &tfjson.StateModule{
+			ChildModules: []*tfjson.StateModule{{
+				Address: "module.vpc",
+				Resources: []*tfjson.StateResource{{
+					Address: addr, Mode: tfjson.ManagedResourceMode, Type: "aws_route_table_association", Name: "private",
+					Index: index, AttributeValues: map[string]interface{}{"id": "x", "subnet_id": "subnet-a"},
+				}},
+			}},
+		}}}
+	}
+	old, created := moved.FromStates(
+		state("module.vpc.aws_route_table_association.private[0]", float64(0)),
+		state(`module.vpc.aws_route_table_association.private["0"]`, "0"))
+	res := moved.Match(old, created)
+	require.Len(t, res.Moves, 1)
+	assert.Equal(t, "attributes subnet_id", res.Moves[0].By)
+}
+
+func TestRender(t *testing.T) {
+	moves := []moved.Move{{
+		From: "module.vpc.aws_route_table_association.private[0]",
+		To:   `module.vpc.aws_route_table_association.private["0"]`,
+		By:   "attributes subnet_id, route_table_id",
+	}}
+
+	hcl, err := moved.HCL(moves, "module.vpc")
+	require.NoError(t, err)
+	assert.Equal(t, moved.Header+`
+# Matched by attributes subnet_id, route_table_id.
+moved {
+  from = aws_route_table_association.private[0]
+  to   = aws_route_table_association.private["0"]
+}
+`, hcl)
+
+	_, err = moved.HCL(moves, "module.eks")
+	assert.Error(t, err)
+
+	assert.Contains(t, moved.Script(moves),
+		`terraform state mv 'module.vpc.aws_route_table_association.private[0]' 'module.vpc.aws_route_table_association.private["0"]'`)
+}
+
+func TestVerify(t *testing.T) {
+	plan, err := planjson.Parse([]byte(refactorPlan))
+	require.NoError(t, err)
+	err = moved.Verify(plan)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `destroys module.vpc.aws_route_table_association.private[0], module.vpc.aws_route_table_association.private[1] and creates`)
+	assert.NotContains(t, err.Error(), "aws_nat_gateway", "a plain destroy is not a recreation")
+
+	plan, err = planjson.Parse([]byte(movedPlan))
+	require.NoError(t, err)
+	assert.NoError(t, moved.Verify(plan))
+}
@@ -0,0 +1,91 @@
+package moved
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Header starts every generated moved.tf.
+const Header = "# Generated by tests/cmd/movedgen. Keep these blocks for at least one\n" +
+	"# release so every consumer's state is moved before they are removed.\n"
+
+// Relative returns addr relative to the module at moduleAddress, the form
+// moved blocks written inside that module use. The root module is "".
+func Relative(addr, moduleAddress string) (string, error) {
+	if moduleAddress == "" {
+		return addr, nil
+	}
+	rel := strings.TrimPrefix(addr, moduleAddress+".")
+	if rel == addr {
+		return "", fmt.Errorf("%s is not in %s", addr, moduleAddress)
+	}
+	return rel, nil
+}
+
+// HCL renders moves as moved blocks for the module at moduleAddress.
+func HCL(moves []Move, moduleAddress string) (string, error) {
+	var b strings.Builder
+	b.WriteString(Header)
+	for _, m := range moves {
+		from, err := Relative(m.From, moduleAddress)
+		if err != nil {
+			return "", err
+		}
+		to, err := Relative(m.To, moduleAddress)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "\n# Matched by %s.\nmoved {\n  from = %s\n  to   = %s\n}\n", m.By, from, to)
+	}
+	return b.String(), nil
+}
+
+// Script renders moves as a shell script of terraform state mv commands,
+// for states that cannot wait for a release carrying the moved blocks.
+func Script(moves []Move) string {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n# Generated by tests/cmd/movedgen.\nset -eu\n")
+	for _, m := range moves {
+		fmt.Fprintf(&b, "terraform state mv %s %s\n", shellQuote(m.From), shellQuote(m.To))
+	}
+	return b.String()
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Verify returns an error naming every type and module in which the plan
+// still destroys one instance and creates another.
+func Verify(plan *tfjson.Plan) error {
+	old, created := FromPlan(plan)
+	pending := map[string][2][]string{}
+	for _, in := range old {
+		k := in.ModuleAddress + "|" + in.Type
+		p := pending[k]
+		p[0] = append(p[0], in.Address)
+		pending[k] = p
+	}
+	for _, in := range created {
+		k := in.ModuleAddress + "|" + in.Type
+		if p, ok := pending[k]; ok {
+			p[1] = append(p[1], in.Address)
+			pending[k] = p
+		}
+	}
+	var problems []string
+	for _, p := range pending {
+		if len(p[1]) > 0 {
+			problems = append(problems, fmt.Sprintf("destroys %s and creates %s",
+				strings.Join(p[0], ", "), strings.Join(p[1], ", ")))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("plan still recreates resources:\n  %s", strings.Join(problems, "\n  "))
+}
@@ -0,0 +1,207 @@
+package netplan
+
+import (
+	"fmt"
+	"net/netip"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/yourorg/tf-modules/tests/internal/tfconfig"
+)
+
+// Network is the address space one module call or resource declares in a
+// root module.
+type Network struct {
+	// Dir is the root module directory, relative to the repository root.
+	Dir string
+	// Name is "module.<name>" or "<type>.<name>".
+	Name  string
+	CIDRs []netip.Prefix
+	File  string
+	Line  int
+}
+
+func (n Network) String() string {
+	return n.Dir + ":" + n.Name
+}
+
+// networkAttrs names the address-space attributes per module source suffix
+// or resource type. GCP networks have no CIDR of their own, so their
+// subnets' ip_cidr_range values are used instead.
+var networkAttrs = map[string]string{
+	"aws/vpc":                   "vpc_cidr",
+	"azure/vnet":                "address_space",
+	"gcp/vpc-network":           "subnets",
+	"aws_vpc":                   "cidr_block",
+	"azurerm_virtual_network":   "address_space",
+	"google_compute_subnetwork": "ip_cidr_range",
+}
+
+// Discover finds the networks declared in each root module directory.
+// Attributes are evaluated against variable defaults overridden by
+// terraform.tfvars and *.auto.tfvars; values that depend on anything else
+// (data sources, other modules) are skipped.
+func Discover(repoRoot string, dirs ...string) ([]Network, error) {
+	var out []Network
+	for _, dir := range dirs {
+		nets, err := discoverDir(repoRoot, dir)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, nets...)
+	}
+	return out, nil
+}
+
+func discoverDir(repoRoot, dir string) ([]Network, error) {
+	root, err := tfconfig.Load(filepath.Join(repoRoot, dir))
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Network
+	for _, body := range root.Bodies {
+		for _, b := range body.Blocks {
+			var key, name string
+			switch {
+			case b.Type == "module" && len(b.Labels) == 1:
+				src, ok := b.Body.Attributes["source"]
+				if !ok {
+					continue
+				}
+				v, diags := src.Expr.Value(nil)
+				if diags.HasErrors() || v.Type() != cty.String {
+					continue
+				}
+				for suffix := range networkAttrs {
+					if strings.HasSuffix(strings.TrimSuffix(v.AsString(), "/"), suffix) {
+						key = suffix
+					}
+				}
+				name = "module." + b.Labels[0]
+			case b.Type == "resource" && len(b.Labels) == 2:
+				key = b.Labels[0]
+				name = b.Labels[0] + "." + b.Labels[1]
+			}
+			attrName, ok := networkAttrs[key]
+			if !ok {
+				continue
+			}
+			attr, ok := b.Body.Attributes[attrName]
+			if !ok {
+				continue
+			}
+			v, diags := attr.Expr.Value(root.Ctx)
+			if diags.HasErrors() {
+				continue
+			}
+			var cidrs []netip.Prefix
+			if attrName == "subnets" {
+				collectNamed(v, "ip_cidr_range", &cidrs)
+			} else {
+				collectStrings(v, &cidrs)
+			}
+			if len(cidrs) == 0 {
+				continue
+			}
+			rel, err := filepath.Rel(repoRoot, attr.SrcRange.Filename)
+			if err != nil {
+				rel = attr.SrcRange.Filename
+			}
+			out = append(out, Network{
+				Dir:   filepath.ToSlash(dir),
+				Name:  name,
+				CIDRs: cidrs,
+				File:  filepath.ToSlash(rel),
+				Line:  attr.SrcRange.Start.Line,
+			})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func collectStrings(v cty.Value, out *[]netip.Prefix) {
+	if v.IsNull() || !v.IsWhollyKnown() {
+		return
+	}
+	switch {
+	case v.Type() == cty.String:
+		if p, err := netip.ParsePrefix(v.AsString()); err == nil {
+			*out = append(*out, p.Masked())
+		}
+	case v.CanIterateElements():
+		for it := v.ElementIterator(); it.Next(); {
+			_, ev := it.Element()
+			collectStrings(ev, out)
+		}
+	}
+}
+
+// collectNamed walks nested maps and objects for attributes named attr.
+func collectNamed(v cty.Value, attr string, out *[]netip.Prefix) {
+	if v.IsNull() || !v.IsWhollyKnown() || !v.CanIterateElements() {
+		return
+	}
+	if v.Type().IsObjectType() || v.Type().IsMapType() {
+		for it := v.ElementIterator(); it.Next(); {
+			k, ev := it.Element()
+			if k.AsString() == attr {
+				collectStrings(ev, out)
+			} else {
+				collectNamed(ev, attr, out)
+			}
+		}
+		return
+	}
+	for it := v.ElementIterator(); it.Next(); {
+		_, ev := it.Element()
+		collectNamed(ev, attr, out)
+	}
+}
+
+// Overlap is a pair of networks whose address space intersects.
+type Overlap struct {
+	A, B         Network
+	ACIDR, BCIDR netip.Prefix
+}
+
+func (o Overlap) String() string {
+	return fmt.Sprintf("%s (%s, %s:%d) overlaps %s (%s, %s:%d)",
+		o.A, o.ACIDR, o.A.File, o.A.Line, o.B, o.BCIDR, o.B.File, o.B.Line)
+}
+
+// Overlaps returns every overlapping pair of distinct networks. Ranges
+// within one network (e.g. two subnets of one GCP VPC) are not compared.
+func Overlaps(nets []Network) []Overlap {
+	var out []Overlap
+	for i := range nets {
+		for j := i + 1; j < len(nets); j++ {
+			for _, a := range nets[i].CIDRs {
+				for _, b := range nets[j].CIDRs {
+					if a.Overlaps(b) {
+						out = append(out, Overlap{A: nets[i], B: nets[j], ACIDR: a, BCIDR: b})
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+// OverlapsWith returns the networks that intersect p.
+func OverlapsWith(nets []Network, p netip.Prefix) []Network {
+	var out []Network
+	for _, n := range nets {
+		for _, c := range n.CIDRs {
+			if c.Overlaps(p) {
+				out = append(out, n)
+				break
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,34 @@
+package netplan
+
+import (
+	"fmt"
+
+	"github.com/yourorg/tf-modules/tests/internal/report"
+)
+
+// ReportRules describes the overlap check for SARIF and JUnit output.
+func ReportRules() []report.Rule {
+	return []report.Rule{{
+		ID:               "overlap",
+		Name:             "overlap",
+		ShortDescription: "Networks that would be peered do not share address space",
+		HelpURI:          "docs/multi-cloud-architecture.md",
+	}}
+}
+
+// ReportFindings converts overlaps for SARIF and JUnit output, each
+// reported on the attribute that declares its first network.
+func ReportFindings(overlaps []Overlap) []report.Finding {
+	out := make([]report.Finding, 0, len(overlaps))
+	for _, o := range overlaps {
+		out = append(out, report.Finding{
+			RuleID: "overlap",
+			Level:  report.LevelError,
+			Message: fmt.Sprintf("%s (%s) overlaps %s (%s, %s:%d)",
+				o.A, o.ACIDR, o.B, o.BCIDR, o.B.File, o.B.Line),
+			Address:  o.A.Name,
+			Location: &report.Location{File: o.A.File, StartLine: o.A.Line},
+		})
+	}
+	return out
+}
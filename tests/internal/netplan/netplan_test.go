@@ -0,0 +1,157 @@
+package netplan_test
+
+import (
+	"bytes"
+	"net/netip"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/netplan"
+	"github.com/yourorg/tf-modules/tests/internal/report"
+)
+
+func TestPlanAWS(t *testing.T) {
+	l, err := netplan.Plan(netplan.Request{
+		Cloud: netplan.CloudAWS,
+		CIDR:  netip.MustParsePrefix("10.16.0.0/16"),
+		Zones: []string{"us-east-1a", "us-east-1b"},
+		Tiers: []netplan.Tier{{Name: "public", Prefix: 24}, {Name: "private", Prefix: 20}},
+	})
+	require.NoError(t, err)
+
+	// Private is larger, so it is placed first; both tiers have room for
+	// the vpc module's three AZs, rounded up to four.
+	assert.Equal(t, "10.16.64.0/22", l.TierBlocks[0].String())
+	assert.Equal(t, "10.16.0.0/18", l.TierBlocks[1].String())
+	assert.Equal(t, []string{"10.16.64.0/24", "10.16.65.0/24"}, l.TierSubnets("public"))
+	assert.Equal(t, []string{"10.16.0.0/20", "10.16.16.0/20"}, l.TierSubnets("private"))
+	assert.InDelta(t, 1-0.25-1.0/64, l.FreeFraction(), 1e-9)
+
+	var buf bytes.Buffer
+	require.NoError(t, l.WriteTFVars(&buf))
+	assert.Contains(t, buf.String(), `vpc_cidr             = "10.16.0.0/16"`)
+	assert.Contains(t, buf.String(), `availability_zones   = ["us-east-1a", "us-east-1b"]`)
+	assert.Contains(t, buf.String(), `private_subnet_cidrs = ["10.16.0.0/20", "10.16.16.0/20"]`)
+}
+
+func TestPlanAzureAndGCP(t *testing.T) {
+	l, err := netplan.Plan(netplan.Request{
+		Cloud: netplan.CloudAzure,
+		CIDR:  netip.MustParsePrefix("10.17.0.0/16"),
+		Tiers: []netplan.Tier{{Name: "aks-system", Prefix: 22}, {Name: "endpoints", Prefix: 26}, {Name: "aks-user", Prefix: 20}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.17.16.0/22"}, l.TierSubnets("aks-system"))
+	assert.Equal(t, []string{"10.17.20.0/26"}, l.TierSubnets("endpoints"))
+	assert.Equal(t, []string{"10.17.0.0/20"}, l.TierSubnets("aks-user"))
+
+	var buf bytes.Buffer
+	require.NoError(t, l.WriteTFVars(&buf))
+	assert.Contains(t, buf.String(), `address_space = ["10.17.0.0/16"]`)
+	assert.Contains(t, buf.String(), "  aks-system = {\n    address_prefixes = [\"10.17.16.0/22\"]\n  }")
+
+	l, err = netplan.Plan(netplan.Request{
+		Cloud: netplan.CloudGCP,
+		CIDR:  netip.MustParsePrefix("10.18.0.0/16"),
+		Zones: []string{"us-central1", "europe-west1"},
+		Tiers: []netplan.Tier{{Name: "main", Prefix: 20}},
+	})
+	require.NoError(t, err)
+	buf.Reset()
+	require.NoError(t, l.WriteTFVars(&buf))
+	assert.Contains(t, buf.String(), "main-europe-west1 = {")
+	assert.Contains(t, buf.String(), `ip_cidr_range            = "10.18.16.0/20"`)
+}
+
+func TestPlanErrors(t *testing.T) {
+	base := netplan.Request{
+		Cloud: netplan.CloudAWS,
+		CIDR:  netip.MustParsePrefix("10.16.0.0/16"),
+		Zones: []string{"us-east-1a"},
+		Tiers: []netplan.Tier{{Name: "public", Prefix: 24}},
+	}
+	cases := map[string]func(r *netplan.Request){
+		"unknown cloud":     func(r *netplan.Request) { r.Cloud = "oci" },
+		"aws extra tier":    func(r *netplan.Request) { r.Tiers = append(r.Tiers, netplan.Tier{Name: "database", Prefix: 24}) },
+		"aws too many AZs":  func(r *netplan.Request) { r.Zones = []string{"a", "b", "c", "d"} },
+		"aws vpc too large": func(r *netplan.Request) { r.CIDR = netip.MustParsePrefix("10.0.0.0/8") },
+		"duplicate tier":    func(r *netplan.Request) { r.Tiers = append(r.Tiers, r.Tiers[0]) },
+		"tier too large":    func(r *netplan.Request) { r.Tiers[0].Prefix = 16 },
+		"does not fit": func(r *netplan.Request) {
+			r.Tiers = []netplan.Tier{{Name: "public", Prefix: 18}, {Name: "private", Prefix: 18}}
+		},
+		"reserve not met": func(r *netplan.Request) {
+			r.Tiers = []netplan.Tier{{Name: "public", Prefix: 19}, {Name: "private", Prefix: 19}}
+			r.Reserve = 0.25
+		},
+	}
+	for name, mutate := range cases {
+		r := base
+		r.Tiers = append([]netplan.Tier(nil), base.Tiers...)
+		mutate(&r)
+		_, err := netplan.Plan(r)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestParseTiers(t *testing.T) {
+	tiers, err := netplan.ParseTiers("public:24, private:/20")
+	require.NoError(t, err)
+	assert.Equal(t, []netplan.Tier{{Name: "public", Prefix: 24}, {Name: "private", Prefix: 20}}, tiers)
+
+	_, err = netplan.ParseTiers("public")
+	assert.Error(t, err)
+}
+
+func TestDiscoverAndOverlaps(t *testing.T) {
+	nets, err := netplan.Discover("testdata", "env-a", "env-b")
+	require.NoError(t, err)
+
+	got := map[string][]string{}
+	for _, n := range nets {
+		for _, c := range n.CIDRs {
+			got[n.String()] = append(got[n.String()], c.String())
+		}
+	}
+	assert.Equal(t, map[string][]string{
+		"env-a:module.vpc":                  {"10.1.0.0/16"}, // tfvars overrides the default
+		"env-a:azurerm_virtual_network.hub": {"10.9.0.0/16"},
+		"env-b:module.network":              {"10.2.0.0/20", "10.1.128.0/20"}, // subnet key order
+	}, got)
+
+	overlaps := netplan.Overlaps(nets)
+	require.Len(t, overlaps, 1)
+	assert.Equal(t, "10.1.0.0/16", overlaps[0].ACIDR.String())
+	assert.Equal(t, "10.1.128.0/20", overlaps[0].BCIDR.String())
+	assert.Equal(t, filepath.ToSlash(filepath.Join("env-a", "main.tf")), overlaps[0].A.File)
+
+	assert.Len(t, netplan.OverlapsWith(nets, netip.MustParsePrefix("10.0.0.0/8")), 3)
+
+	findings := netplan.ReportFindings(overlaps)
+	require.Len(t, findings, 1)
+	assert.Equal(t, "module.vpc", findings[0].Address)
+	assert.Equal(t, &report.Location{File: overlaps[0].A.File, StartLine: overlaps[0].A.Line}, findings[0].Location)
+	assert.Contains(t, findings[0].Message, "env-b:module.network (10.1.128.0/20")
+}
+
+// TestRepositoryNetworksDoNotOverlap guards the environments and the
+// multi-cloud-ha example, which would share one routing domain.
+func TestRepositoryNetworksDoNotOverlap(t *testing.T) {
+	repo := filepath.Join("..", "..", "..")
+	dirs, err := filepath.Glob(filepath.Join(repo, "environments", "*"))
+	require.NoError(t, err)
+	for i, d := range dirs {
+		dirs[i], _ = filepath.Rel(repo, d)
+	}
+	dirs = append(dirs, filepath.Join("examples", "multi-cloud-ha"))
+
+	nets, err := netplan.Discover(repo, dirs...)
+	require.NoError(t, err)
+	require.NotEmpty(t, nets)
+	for _, o := range netplan.Overlaps(nets) {
+		t.Error(o)
+	}
+}
@@ -0,0 +1,258 @@
+// Package netplan lays out subnets for the aws/vpc, azure/vnet and
+// gcp/vpc-network modules from a parent CIDR, tiers and zones, renders the
+// result as tfvars, and finds overlapping address space across root
+// modules that are (or may become) peered.
+package netplan
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"github.com/yourorg/tf-modules/tests/internal/cidr"
+)
+
+// Clouds supported by Plan, named after the modules/ directory.
+const (
+	CloudAWS   = "aws"
+	CloudAzure = "azure"
+	CloudGCP   = "gcp"
+)
+
+// Tier is a class of subnet, e.g. public or private, and the prefix length
+// of each of its subnets.
+type Tier struct {
+	Name   string
+	Prefix int
+}
+
+// Request describes the network to lay out.
+type Request struct {
+	Cloud string
+	CIDR  netip.Prefix
+	// Zones are availability zones for AWS, one subnet per tier and zone,
+	// or regions for GCP, one subnet per tier and region. Azure subnets
+	// are regional, so Azure gets one subnet per tier and ignores Zones.
+	Zones []string
+	Tiers []Tier
+	// MaxZones reserves room in every tier for this many zones, so adding
+	// an AZ later does not renumber existing subnets. Defaults to 3 for
+	// AWS (the vpc module's limit), len(Zones) for GCP and 1 for Azure.
+	MaxZones int
+	// Reserve is the fraction of the parent CIDR that must stay
+	// unallocated for future tiers, e.g. 0.25.
+	Reserve float64
+}
+
+// Subnet is one planned subnet.
+type Subnet struct {
+	Tier string
+	// Zone is empty for Azure.
+	Zone string
+	CIDR netip.Prefix
+}
+
+// Layout is a planned network.
+type Layout struct {
+	Request
+	// TierBlocks holds the block reserved for each tier, in request order.
+	TierBlocks []netip.Prefix
+	Subnets    []Subnet
+	// Free lists the unallocated ranges left for growth.
+	Free []netip.Prefix
+}
+
+// awsTiers are the only tiers modules/aws/vpc accepts.
+var awsTiers = map[string]bool{"public": true, "private": true}
+
+func (r Request) validate() error {
+	if !r.CIDR.IsValid() || !r.CIDR.Addr().Is4() {
+		return errors.New("an IPv4 parent CIDR is required")
+	}
+	if len(r.Tiers) == 0 {
+		return errors.New("at least one tier is required")
+	}
+	seen := map[string]bool{}
+	for _, t := range r.Tiers {
+		if t.Name == "" || seen[t.Name] {
+			return fmt.Errorf("tier names must be unique and non-empty, got %q", t.Name)
+		}
+		seen[t.Name] = true
+		if t.Prefix <= r.CIDR.Bits() || t.Prefix > 29 {
+			return fmt.Errorf("tier %s: /%d subnets do not fit in %s", t.Name, t.Prefix, r.CIDR)
+		}
+	}
+	if r.Reserve < 0 || r.Reserve >= 1 {
+		return fmt.Errorf("reserve must be in [0, 1), got %v", r.Reserve)
+	}
+
+	switch r.Cloud {
+	case CloudAWS:
+		if b := r.CIDR.Bits(); b < 16 || b > 24 {
+			return fmt.Errorf("aws/vpc requires a /16 to /24 vpc_cidr, got %s", r.CIDR)
+		}
+		if n := len(r.Zones); n < 1 || n > 3 {
+			return fmt.Errorf("aws/vpc requires 1 to 3 availability zones, got %d", n)
+		}
+		for _, t := range r.Tiers {
+			if !awsTiers[t.Name] {
+				return fmt.Errorf("aws/vpc only has public and private subnets, got tier %q", t.Name)
+			}
+		}
+	case CloudGCP:
+		if len(r.Zones) == 0 {
+			return errors.New("gcp requires at least one region")
+		}
+	case CloudAzure:
+	default:
+		return fmt.Errorf("unknown cloud %q (want aws, azure or gcp)", r.Cloud)
+	}
+	return nil
+}
+
+func (r Request) slots() (zones []string, slots int) {
+	switch r.Cloud {
+	case CloudAzure:
+		return []string{""}, 1
+	case CloudAWS:
+		slots = 3
+	}
+	if r.MaxZones > slots {
+		slots = r.MaxZones
+	}
+	if len(r.Zones) > slots {
+		slots = len(r.Zones)
+	}
+	return r.Zones, slots
+}
+
+// Plan lays out req. Each tier gets an aligned block sized for MaxZones
+// subnets; larger tiers are placed first so blocks stay aligned, and the
+// lowest free addresses are used so the remaining space stays contiguous.
+func Plan(req Request) (*Layout, error) {
+	req.CIDR = req.CIDR.Masked()
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	zones, slots := req.slots()
+	req.MaxZones = slots
+	// Round slots up to a power of two so each tier block is a CIDR.
+	slotBits := bits.Len(uint(slots - 1))
+
+	order := make([]int, len(req.Tiers))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return req.Tiers[order[a]].Prefix < req.Tiers[order[b]].Prefix
+	})
+
+	free := []netip.Prefix{req.CIDR}
+	blocks := make([]netip.Prefix, len(req.Tiers))
+	for _, i := range order {
+		t := req.Tiers[i]
+		want := t.Prefix - slotBits
+		if want < req.CIDR.Bits() {
+			return nil, fmt.Errorf("tier %s: %d /%d subnets need a /%d, larger than %s", t.Name, slots, t.Prefix, want, req.CIDR)
+		}
+		var ok bool
+		blocks[i], free, ok = allocate(free, want)
+		if !ok {
+			return nil, fmt.Errorf("tier %s: no free /%d left in %s", t.Name, want, req.CIDR)
+		}
+	}
+
+	l := &Layout{Request: req, TierBlocks: blocks, Free: free}
+	for i, t := range req.Tiers {
+		for z, zone := range zones {
+			s, err := cidr.Subnet(blocks[i], t.Prefix-blocks[i].Bits(), z)
+			if err != nil {
+				return nil, err
+			}
+			l.Subnets = append(l.Subnets, Subnet{Tier: t.Name, Zone: zone, CIDR: s})
+		}
+	}
+
+	if req.Reserve > 0 {
+		if got := l.FreeFraction(); got < req.Reserve {
+			return nil, fmt.Errorf("layout leaves %.0f%% of %s free, want at least %.0f%%", got*100, req.CIDR, req.Reserve*100)
+		}
+	}
+	return l, nil
+}
+
+// allocate takes the lowest-addressed /bits block from free, splitting a
+// larger block when needed. free is kept sorted by address.
+func allocate(free []netip.Prefix, bits int) (netip.Prefix, []netip.Prefix, bool) {
+	best := -1
+	for i, f := range free {
+		if f.Bits() > bits {
+			continue
+		}
+		// Prefer the smallest block that fits so big blocks survive for
+		// big tiers; ties go to the lowest address.
+		if best < 0 || f.Bits() > free[best].Bits() {
+			best = i
+		}
+	}
+	if best < 0 {
+		return netip.Prefix{}, free, false
+	}
+	block := free[best]
+	rest := append([]netip.Prefix(nil), free[:best]...)
+	var tail []netip.Prefix
+	for block.Bits() < bits {
+		lo, _ := cidr.Subnet(block, 1, 0)
+		hi, _ := cidr.Subnet(block, 1, 1)
+		tail = append([]netip.Prefix{hi}, tail...)
+		block = lo
+	}
+	rest = append(rest, tail...)
+	rest = append(rest, free[best+1:]...)
+	sort.Slice(rest, func(i, j int) bool { return rest[i].Addr().Less(rest[j].Addr()) })
+	return block, rest, true
+}
+
+// FreeFraction is the share of the parent CIDR left unallocated.
+func (l *Layout) FreeFraction() float64 {
+	var free float64
+	for _, f := range l.Free {
+		free += float64(uint64(1) << (32 - f.Bits()))
+	}
+	return free / float64(uint64(1)<<(32-l.CIDR.Bits()))
+}
+
+// TierSubnets returns the CIDRs of one tier in zone order.
+func (l *Layout) TierSubnets(tier string) []string {
+	var out []string
+	for _, s := range l.Subnets {
+		if s.Tier == tier {
+			out = append(out, s.CIDR.String())
+		}
+	}
+	return out
+}
+
+// ParseTiers parses "public:24,private:20" into tiers.
+func ParseTiers(s string) ([]Tier, error) {
+	var tiers []Tier
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, size, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("tier %q: want name:prefix, e.g. private:20", part)
+		}
+		var prefix int
+		if _, err := fmt.Sscanf(strings.TrimPrefix(size, "/"), "%d", &prefix); err != nil {
+			return nil, fmt.Errorf("tier %q: bad prefix length: %w", part, err)
+		}
+		tiers = append(tiers, Tier{Name: name, Prefix: prefix})
+	}
+	return tiers, nil
+}
@@ -0,0 +1,22 @@
+variable "vpc_cidr" {
+  type    = string
+  default = "10.0.0.0/16"
+}
+
+locals {
+  hub_cidr = "10.9.0.0/16"
+}
+
+module "vpc" {
+  source   = "../../modules/aws/vpc"
+  vpc_cidr = var.vpc_cidr
+}
+
+resource "azurerm_virtual_network" "hub" {
+  address_space = [local.hub_cidr]
+}
+
+module "unknown" {
+  source   = "../../modules/aws/vpc"
+  vpc_cidr = module.ipam.cidr
+}
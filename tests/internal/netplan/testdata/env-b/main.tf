@@ -0,0 +1,14 @@
+module "network" {
+  source = "../../modules/gcp/vpc-network"
+
+  subnets = {
+    main = {
+      region        = "us-central1"
+      ip_cidr_range = "10.2.0.0/20"
+    }
+    overlapping = {
+      region        = "us-east1"
+      ip_cidr_range = "10.1.128.0/20"
+    }
+  }
+}
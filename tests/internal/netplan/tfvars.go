@@ -0,0 +1,84 @@
+package netplan
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// WriteTFVars renders the layout as tfvars for the cloud's network module:
+// vpc_cidr, availability_zones and public/private_subnet_cidrs for aws/vpc;
+// address_space and subnets for azure/vnet; subnets for gcp/vpc-network.
+// A leading comment records the tier blocks and free ranges.
+func (l *Layout) WriteTFVars(w io.Writer) error {
+	f := hclwrite.NewEmptyFile()
+	body := f.Body()
+
+	switch l.Cloud {
+	case CloudAWS:
+		body.SetAttributeValue("vpc_cidr", cty.StringVal(l.CIDR.String()))
+		body.SetAttributeValue("availability_zones", stringList(l.Zones))
+		for _, tier := range []string{"public", "private"} {
+			body.SetAttributeValue(tier+"_subnet_cidrs", stringList(l.TierSubnets(tier)))
+		}
+	case CloudAzure:
+		body.SetAttributeValue("address_space", stringList([]string{l.CIDR.String()}))
+		subnets := map[string]cty.Value{}
+		for _, s := range l.Subnets {
+			subnets[s.Tier] = cty.ObjectVal(map[string]cty.Value{
+				"address_prefixes": stringList([]string{s.CIDR.String()}),
+			})
+		}
+		body.SetAttributeValue("subnets", cty.ObjectVal(subnets))
+	case CloudGCP:
+		subnets := map[string]cty.Value{}
+		for _, s := range l.Subnets {
+			name := s.Tier
+			if len(l.Zones) > 1 {
+				name = s.Tier + "-" + s.Zone
+			}
+			subnets[name] = cty.ObjectVal(map[string]cty.Value{
+				"region":                   cty.StringVal(s.Zone),
+				"ip_cidr_range":            cty.StringVal(s.CIDR.String()),
+				"private_ip_google_access": cty.True,
+			})
+		}
+		body.SetAttributeValue("subnets", cty.ObjectVal(subnets))
+	default:
+		return fmt.Errorf("unknown cloud %q", l.Cloud)
+	}
+
+	if _, err := io.WriteString(w, l.header()); err != nil {
+		return err
+	}
+	_, err := w.Write(hclwrite.Format(f.Bytes()))
+	return err
+}
+
+func (l *Layout) header() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by tests/cmd/netplan for %s %s.\n", l.Cloud, l.CIDR)
+	for i, t := range l.Tiers {
+		fmt.Fprintf(&b, "# tier %-10s %-18s (/%d subnets, room for %d)\n", t.Name, l.TierBlocks[i], t.Prefix, l.MaxZones)
+	}
+	var free []string
+	for _, p := range l.Free {
+		free = append(free, p.String())
+	}
+	fmt.Fprintf(&b, "# free (%.0f%%): %s\n\n", l.FreeFraction()*100, strings.Join(free, " "))
+	return b.String()
+}
+
+func stringList(ss []string) cty.Value {
+	if len(ss) == 0 {
+		return cty.ListValEmpty(cty.String)
+	}
+	vals := make([]cty.Value, len(ss))
+	for i, s := range ss {
+		vals[i] = cty.StringVal(s)
+	}
+	return cty.ListVal(vals)
+}
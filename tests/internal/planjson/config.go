@@ -0,0 +1,82 @@
+package planjson
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// moduleCallRe extracts call names from a module address such as
+// module.stack["aws"].module.vpc.
+var moduleCallRe = regexp.MustCompile(`module\.([^.\[]+)`)
+
+// ConfigResource returns the configuration block that declared r, or nil
+// if the plan carries no configuration for it. Every instance of a counted
+// or for_each resource shares the same block.
+func ConfigResource(plan *tfjson.Plan, r Resource) *tfjson.ConfigResource {
+	if plan.Config == nil || plan.Config.RootModule == nil {
+		return nil
+	}
+	mod := plan.Config.RootModule
+	for _, m := range moduleCallRe.FindAllStringSubmatch(r.ModuleAddress, -1) {
+		call, ok := mod.ModuleCalls[m[1]]
+		if !ok || call.Module == nil {
+			return nil
+		}
+		mod = call.Module
+	}
+	for _, cr := range mod.Resources {
+		if cr.Mode == tfjson.ManagedResourceMode && cr.Type == r.Type && cr.Name == r.Name {
+			return cr
+		}
+	}
+	return nil
+}
+
+// References returns the references made by attribute attr in r's
+// configuration, e.g. ["aws_s3_bucket.state.id", "aws_s3_bucket.state"].
+// They are relative to the module that declares r.
+func References(plan *tfjson.Plan, r Resource, attr string) []string {
+	cr := ConfigResource(plan, r)
+	if cr == nil {
+		return nil
+	}
+	expr, ok := cr.Expressions[attr]
+	if !ok || expr == nil {
+		return nil
+	}
+	return expr.References
+}
+
+// Variable returns the value of a root module input variable, or nil.
+func Variable(plan *tfjson.Plan, name string) interface{} {
+	if v, ok := plan.Variables[name]; ok && v != nil {
+		return v.Value
+	}
+	return nil
+}
+
+// ModuleDir returns the directory holding the source of the module at
+// moduleAddress, resolving each call's local source path relative to its
+// parent starting from rootDir, the directory the plan was made in. ok is
+// false when a call is missing from the configuration or its source is
+// not a local path.
+func ModuleDir(plan *tfjson.Plan, rootDir, moduleAddress string) (dir string, ok bool) {
+	if plan.Config == nil || plan.Config.RootModule == nil {
+		return "", false
+	}
+	dir, mod := rootDir, plan.Config.RootModule
+	for _, m := range moduleCallRe.FindAllStringSubmatch(moduleAddress, -1) {
+		call, found := mod.ModuleCalls[m[1]]
+		if !found || call.Module == nil {
+			return "", false
+		}
+		if !strings.HasPrefix(call.Source, "./") && !strings.HasPrefix(call.Source, "../") {
+			return "", false
+		}
+		dir, mod = filepath.Join(dir, call.Source), call.Module
+	}
+	return dir, true
+}
@@ -0,0 +1,161 @@
+// Package planjson loads `terraform show -json` plan output and flattens
+// its resource changes into a shape the offline checkers can walk without
+// caring about module nesting.
+package planjson
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Resource is a managed resource as it will exist after the plan applies.
+type Resource struct {
+	// Address is the full resource address, e.g.
+	// module.vpc.aws_nat_gateway.this["us-east-1a"].
+	Address string
+	// ModuleAddress is the containing module address, "" for the root module.
+	ModuleAddress string
+	Type          string
+	Name          string
+	Actions       tfjson.Actions
+	// Values are the planned attribute values. Unknown values are absent.
+	Values map[string]interface{}
+}
+
+// Module returns the containing module address, or "root".
+func (r Resource) Module() string {
+	if r.ModuleAddress == "" {
+		return "root"
+	}
+	return r.ModuleAddress
+}
+
+// Load reads and validates a plan JSON file.
+func Load(path string) (*tfjson.Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse decodes plan JSON produced by `terraform show -json`.
+func Parse(data []byte) (*tfjson.Plan, error) {
+	var plan tfjson.Plan
+	if err := plan.UnmarshalJSON(data); err != nil {
+		return nil, fmt.Errorf("parsing plan JSON: %w", err)
+	}
+	return &plan, nil
+}
+
+// Resources returns the managed resources that exist once the plan is
+// applied: creates, updates, replacements and no-ops. Deletions and data
+// sources are skipped. The result is sorted by address.
+func Resources(plan *tfjson.Plan) []Resource {
+	var out []Resource
+	for _, rc := range plan.ResourceChanges {
+		if rc.Mode != tfjson.ManagedResourceMode || rc.Change == nil || rc.Change.Actions.Delete() {
+			continue
+		}
+		values, _ := rc.Change.After.(map[string]interface{})
+		out = append(out, Resource{
+			Address:       rc.Address,
+			ModuleAddress: rc.ModuleAddress,
+			Type:          rc.Type,
+			Name:          rc.Name,
+			Actions:       rc.Change.Actions,
+			Values:        values,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Address < out[j].Address })
+	return out
+}
+
+// OfType filters resources down to the given types.
+func OfType(resources []Resource, types ...string) []Resource {
+	var out []Resource
+	for _, r := range resources {
+		for _, t := range types {
+			if r.Type == t {
+				out = append(out, r)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// Get walks a dotted attribute path through nested objects and lists, e.g.
+// "scaling_config.0.desired_size". It returns nil if any step is missing.
+func Get(values map[string]interface{}, path string) interface{} {
+	var cur interface{} = values
+	for _, part := range strings.Split(path, ".") {
+		switch v := cur.(type) {
+		case map[string]interface{}:
+			cur = v[part]
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil
+			}
+			cur = v[i]
+		default:
+			return nil
+		}
+	}
+	return cur
+}
+
+// String returns the string at path, or "" if it is missing or not a string.
+func String(values map[string]interface{}, path string) string {
+	s, _ := Get(values, path).(string)
+	return s
+}
+
+// Bool returns the bool at path and whether it was present.
+func Bool(values map[string]interface{}, path string) (bool, bool) {
+	b, ok := Get(values, path).(bool)
+	return b, ok
+}
+
+// Number returns the number at path and whether it was present. Numeric
+// strings such as Budgets' limit_amount are accepted.
+func Number(values map[string]interface{}, path string) (float64, bool) {
+	switch v := Get(values, path).(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Strings returns the list of strings at path, skipping non-string items.
+func Strings(values map[string]interface{}, path string) []string {
+	list, _ := Get(values, path).([]interface{})
+	out := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Blocks returns the nested blocks at path as attribute maps.
+func Blocks(values map[string]interface{}, path string) []map[string]interface{} {
+	list, _ := Get(values, path).([]interface{})
+	out := make([]map[string]interface{}, 0, len(list))
+	for _, item := range list {
+		if m, ok := item.(map[string]interface{}); ok {
+			out = append(out, m)
+		}
+	}
+	return out
+}
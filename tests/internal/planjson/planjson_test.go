@@ -0,0 +1,79 @@
+package planjson_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+)
+
+const samplePlan = `{
+  "format_version": "1.2",
+  "resource_changes": [
+    {
+      "address": "module.eks.aws_eks_node_group.this[\"default\"]",
+      "module_address": "module.eks",
+      "mode": "managed",
+      "type": "aws_eks_node_group",
+      "name": "this",
+      "change": {
+        "actions": ["create"],
+        "after": {
+          "instance_types": ["m5.large"],
+          "scaling_config": [{"desired_size": 3}]
+        }
+      }
+    },
+    {
+      "address": "aws_budgets_budget.monthly",
+      "mode": "managed",
+      "type": "aws_budgets_budget",
+      "name": "monthly",
+      "change": {"actions": ["no-op"], "after": {"limit_amount": "500.00"}}
+    },
+    {
+      "address": "aws_nat_gateway.old",
+      "mode": "managed",
+      "type": "aws_nat_gateway",
+      "name": "old",
+      "change": {"actions": ["delete"], "after": null}
+    },
+    {
+      "address": "data.aws_caller_identity.current",
+      "mode": "data",
+      "type": "aws_caller_identity",
+      "name": "current",
+      "change": {"actions": ["read"], "after": {}}
+    }
+  ]
+}`
+
+func TestResources(t *testing.T) {
+	plan, err := planjson.Parse([]byte(samplePlan))
+	require.NoError(t, err)
+
+	resources := planjson.Resources(plan)
+	require.Len(t, resources, 2, "deletes and data sources should be skipped")
+	assert.Equal(t, "root", resources[0].Module())
+	assert.Equal(t, "module.eks", resources[1].Module())
+
+	ng := resources[1].Values
+	assert.Equal(t, []string{"m5.large"}, planjson.Strings(ng, "instance_types"))
+	n, ok := planjson.Number(ng, "scaling_config.0.desired_size")
+	assert.True(t, ok)
+	assert.Equal(t, 3.0, n)
+	assert.Nil(t, planjson.Get(ng, "scaling_config.5.desired_size"))
+
+	amount, ok := planjson.Number(resources[0].Values, "limit_amount")
+	assert.True(t, ok, "numeric strings should parse")
+	assert.Equal(t, 500.0, amount)
+
+	assert.Len(t, planjson.OfType(resources, "aws_eks_node_group"), 1)
+}
+
+func TestParseRejectsNonPlan(t *testing.T) {
+	_, err := planjson.Parse([]byte(`{"resource_changes": []}`))
+	assert.Error(t, err, "missing format_version should be rejected")
+}
@@ -0,0 +1,300 @@
+package report
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// JUnit is a JUnit XML document.
+type JUnit struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []JUnitSuite `xml:"testsuite"`
+}
+
+// JUnitSuite is one package (for go test) or one tool (for checkers).
+type JUnitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      string      `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr,omitempty"`
+	Cases     []JUnitCase `xml:"testcase"`
+}
+
+// JUnitCase is one test or one rule.
+type JUnitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *JUnitFailure `xml:"failure,omitempty"`
+	Skipped   *JUnitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+// JUnitFailure marks a failed case.
+type JUnitFailure struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// JUnitSkipped marks a skipped case with its reason.
+type JUnitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// Write encodes the document with an XML header.
+func (j *JUnit) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(j); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// TestEvent is one line of `go test -json` (test2json) output.
+type TestEvent struct {
+	Time    time.Time
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+var (
+	// logLineRe matches t.Log/t.Skip output: "    vpc_test.go:21: message".
+	logLineRe = regexp.MustCompile(`^\s+[\w.-]+\.go:\d+: (.+)$`)
+	// errorLineRe matches testify's "Error:" line in a failure trace.
+	errorLineRe = regexp.MustCompile(`^\s+Error:\s+(.+)$`)
+)
+
+// ReadTestEvents decodes `go test -json` output and calls fn for each
+// event. Non-JSON lines, such as build errors interleaved by go test, are
+// ignored.
+func ReadTestEvents(r io.Reader, fn func(TestEvent)) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for sc.Scan() {
+		line := sc.Bytes()
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var ev TestEvent
+		if err := json.Unmarshal(line, &ev); err != nil {
+			return fmt.Errorf("decoding test event: %w", err)
+		}
+		fn(ev)
+	}
+	return sc.Err()
+}
+
+type caseState struct {
+	start   time.Time
+	elapsed float64
+	action  string
+	output  strings.Builder
+}
+
+// ParseTestEvents converts `go test -json` output into JUnit, one suite
+// per package and one case per test or subtest. Each case carries its
+// duration, skip reason and full output, which includes the terraform
+// command output Terratest logs for that test.
+func ParseTestEvents(r io.Reader) (*JUnit, error) {
+	type pkgState struct {
+		start   time.Time
+		elapsed float64
+		order   []string
+		cases   map[string]*caseState
+	}
+	pkgs := map[string]*pkgState{}
+	var pkgOrder []string
+
+	err := ReadTestEvents(r, func(ev TestEvent) {
+		p, ok := pkgs[ev.Package]
+		if !ok {
+			p = &pkgState{start: ev.Time, cases: map[string]*caseState{}}
+			pkgs[ev.Package] = p
+			pkgOrder = append(pkgOrder, ev.Package)
+		}
+		if ev.Test == "" {
+			if ev.Action == "pass" || ev.Action == "fail" || ev.Action == "skip" {
+				p.elapsed = ev.Elapsed
+			}
+			return
+		}
+		c, ok := p.cases[ev.Test]
+		if !ok {
+			c = &caseState{start: ev.Time}
+			p.cases[ev.Test] = c
+			p.order = append(p.order, ev.Test)
+		}
+		switch ev.Action {
+		case "output":
+			c.output.WriteString(ev.Output)
+		case "pass", "fail", "skip":
+			c.action = ev.Action
+			c.elapsed = ev.Elapsed
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &JUnit{}
+	for _, name := range pkgOrder {
+		p := pkgs[name]
+		suite := JUnitSuite{Name: name, Time: seconds(p.elapsed)}
+		if !p.start.IsZero() {
+			suite.Timestamp = p.start.UTC().Format(time.RFC3339)
+		}
+		for _, test := range p.order {
+			c := p.cases[test]
+			out := c.output.String()
+			jc := JUnitCase{Name: test, Classname: name, Time: seconds(c.elapsed), SystemOut: out}
+			switch c.action {
+			case "fail":
+				jc.Failure = &JUnitFailure{Message: FailureMessage(out), Body: out}
+				suite.Failures++
+			case "skip":
+				jc.Skipped = &JUnitSkipped{Message: lastLogLine(out)}
+				suite.Skipped++
+			case "":
+				// No terminal event: the binary panicked or timed out mid-test.
+				jc.Failure = &JUnitFailure{Message: "test did not complete (timeout or panic)", Body: out}
+				suite.Failures++
+			}
+			suite.Cases = append(suite.Cases, jc)
+		}
+		suite.Tests = len(suite.Cases)
+		doc.Suites = append(doc.Suites, suite)
+	}
+	return doc, nil
+}
+
+// AttachLogs appends a JUnit attachment marker ([[ATTACHMENT|path]], as
+// understood by Jenkins and GitLab) to each case for every file in dir
+// named after the test, e.g. TestVpcHappyPath.log or
+// TestVpcHappyPath-apply.log. Subtest slashes map to underscores.
+func (j *JUnit) AttachLogs(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for si := range j.Suites {
+		for ci := range j.Suites[si].Cases {
+			c := &j.Suites[si].Cases[ci]
+			prefix := strings.ReplaceAll(c.Name, "/", "_")
+			var files []string
+			for _, e := range entries {
+				n := e.Name()
+				if !e.IsDir() && (strings.TrimSuffix(n, filepath.Ext(n)) == prefix || strings.HasPrefix(n, prefix+"-")) {
+					files = append(files, n)
+				}
+			}
+			sort.Strings(files)
+			for _, f := range files {
+				abs, err := filepath.Abs(filepath.Join(dir, f))
+				if err != nil {
+					return err
+				}
+				c.SystemOut += fmt.Sprintf("[[ATTACHMENT|%s]]\n", abs)
+			}
+		}
+	}
+	return nil
+}
+
+// FindingsJUnit renders checker findings as a suite with one case per rule.
+// A rule fails when it has error-level findings; warnings and notes are
+// listed in the case output.
+func FindingsJUnit(tool Tool, rules []Rule, findings []Finding) *JUnit {
+	byRule := map[string][]Finding{}
+	for _, f := range findings {
+		byRule[f.RuleID] = append(byRule[f.RuleID], f)
+	}
+	suite := JUnitSuite{Name: tool.Name, Time: seconds(0)}
+	seen := map[string]bool{}
+	addCase := func(id, name string) {
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+		jc := JUnitCase{Name: id, Classname: tool.Name, Time: seconds(0)}
+		var errs, other []string
+		for _, f := range byRule[id] {
+			line := fmt.Sprintf("%s: %s", f.Address, f.Message)
+			if f.Location != nil {
+				line = fmt.Sprintf("%s:%d: %s", f.Location.File, f.Location.StartLine, line)
+			}
+			if f.Level == LevelError {
+				errs = append(errs, line)
+			} else {
+				other = append(other, fmt.Sprintf("[%s] %s", f.Level, line))
+			}
+		}
+		if len(errs) > 0 {
+			msg := name
+			if msg == "" {
+				msg = id
+			}
+			jc.Failure = &JUnitFailure{Message: fmt.Sprintf("%s: %d violation(s)", msg, len(errs)), Body: strings.Join(errs, "\n")}
+			suite.Failures++
+		}
+		if len(other) > 0 {
+			jc.SystemOut = strings.Join(other, "\n") + "\n"
+		}
+		suite.Cases = append(suite.Cases, jc)
+	}
+	for _, r := range rules {
+		addCase(r.ID, r.ShortDescription)
+	}
+	for _, f := range findings {
+		addCase(f.RuleID, "")
+	}
+	suite.Tests = len(suite.Cases)
+	return &JUnit{Suites: []JUnitSuite{suite}}
+}
+
+func seconds(s float64) string {
+	return fmt.Sprintf("%.3f", s)
+}
+
+// FailureMessage extracts a one-line failure reason from a test's output:
+// testify's Error: line, else the last t.Log/t.Fatal line.
+func FailureMessage(out string) string {
+	lines := strings.Split(out, "\n")
+	for _, l := range lines {
+		if m := errorLineRe.FindStringSubmatch(l); m != nil {
+			return strings.TrimSpace(m[1])
+		}
+	}
+	if msg := lastLogLine(out); msg != "" {
+		return msg
+	}
+	return "test failed"
+}
+
+func lastLogLine(out string) string {
+	lines := strings.Split(out, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if m := logLineRe.FindStringSubmatch(lines[i]); m != nil {
+			return strings.TrimSpace(m[1])
+		}
+	}
+	return ""
+}
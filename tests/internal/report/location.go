@@ -0,0 +1,229 @@
+package report
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Location is a source range relative to the repository root.
+type Location struct {
+	File        string
+	StartLine   int
+	StartColumn int
+	EndLine     int
+	EndColumn   int
+}
+
+// SourceIndex resolves plan resource addresses to the HCL that declares
+// them, following local module_calls sources from the root module.
+type SourceIndex struct {
+	repoRoot string
+	// dirs maps a module call path ("" for root, "vpc", "stack.vpc") to
+	// its directory.
+	dirs   map[string]string
+	bodies map[string][]*hclsyntax.Body
+}
+
+// NewSourceIndex indexes the modules reachable from rootDir, the directory
+// the plan was created in. plan may be nil, in which case only resources
+// in the root module resolve.
+func NewSourceIndex(repoRoot, rootDir string, plan *tfjson.Plan) *SourceIndex {
+	if abs, err := filepath.Abs(repoRoot); err == nil {
+		repoRoot = abs
+	}
+	s := &SourceIndex{
+		repoRoot: repoRoot,
+		dirs:     map[string]string{"": rootDir},
+		bodies:   map[string][]*hclsyntax.Body{},
+	}
+	if plan != nil && plan.Config != nil && plan.Config.RootModule != nil {
+		s.addCalls("", rootDir, plan.Config.RootModule)
+	}
+	return s
+}
+
+func (s *SourceIndex) addCalls(prefix, dir string, mod *tfjson.ConfigModule) {
+	for name, call := range mod.ModuleCalls {
+		if call == nil || !(strings.HasPrefix(call.Source, "./") || strings.HasPrefix(call.Source, "../")) {
+			continue // registry and git sources have no local HCL
+		}
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		child := filepath.Join(dir, filepath.FromSlash(call.Source))
+		s.dirs[key] = child
+		if call.Module != nil {
+			s.addCalls(key, child, call.Module)
+		}
+	}
+}
+
+// Locate returns the range of attribute within the resource block for
+// address, falling back to the block header when attribute is empty or not
+// set literally in the block. Nested attributes use dotted paths with list
+// indexes, e.g. "vpc_config.0.endpoint_public_access". It returns nil when
+// the block cannot be found.
+func (s *SourceIndex) Locate(address, attribute string) *Location {
+	calls, mode, typ, name, ok := ParseAddress(address)
+	if !ok {
+		return nil
+	}
+	dir, ok := s.dirs[strings.Join(calls, ".")]
+	if !ok {
+		return nil
+	}
+
+	blockType := "resource"
+	if mode == "data" {
+		blockType = "data"
+	}
+	for _, body := range s.load(dir) {
+		for _, block := range body.Blocks {
+			if block.Type != blockType || len(block.Labels) != 2 || block.Labels[0] != typ || block.Labels[1] != name {
+				continue
+			}
+			if attribute != "" {
+				if rng, ok := attributeRange(block.Body, attribute); ok {
+					return s.location(rng)
+				}
+			}
+			return s.location(block.DefRange())
+		}
+	}
+	return nil
+}
+
+func attributeRange(body *hclsyntax.Body, path string) (hcl.Range, bool) {
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		if _, err := strconv.Atoi(part); err == nil {
+			continue // list index into a nested block; blocks are matched by type
+		}
+		if i == len(parts)-1 {
+			if attr, ok := body.Attributes[part]; ok {
+				return attr.SrcRange, true
+			}
+			for _, b := range body.Blocks {
+				if b.Type == part {
+					return b.DefRange(), true
+				}
+			}
+			return hcl.Range{}, false
+		}
+		var next *hclsyntax.Body
+		for _, b := range body.Blocks {
+			if b.Type == part {
+				next = b.Body
+				break
+			}
+		}
+		if next == nil {
+			return hcl.Range{}, false
+		}
+		body = next
+	}
+	return hcl.Range{}, false
+}
+
+func (s *SourceIndex) location(rng hcl.Range) *Location {
+	file := rng.Filename
+	if rel, err := filepath.Rel(s.repoRoot, rng.Filename); err == nil {
+		file = filepath.ToSlash(rel)
+	}
+	return &Location{
+		File:        file,
+		StartLine:   rng.Start.Line,
+		StartColumn: rng.Start.Column,
+		EndLine:     rng.End.Line,
+		EndColumn:   rng.End.Column,
+	}
+}
+
+// load parses and caches every .tf file in dir. Files that fail to parse
+// are skipped; a checker report should not fail on a syntax error that
+// terraform validate will already catch.
+func (s *SourceIndex) load(dir string) []*hclsyntax.Body {
+	if bodies, ok := s.bodies[dir]; ok {
+		return bodies
+	}
+	var bodies []*hclsyntax.Body
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.tf"))
+	for _, path := range matches {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		abs, _ := filepath.Abs(path)
+		file, diags := hclsyntax.ParseConfig(src, abs, hcl.InitialPos)
+		if diags.HasErrors() {
+			continue
+		}
+		if body, ok := file.Body.(*hclsyntax.Body); ok {
+			bodies = append(bodies, body)
+		}
+	}
+	s.bodies[dir] = bodies
+	return bodies
+}
+
+// ParseAddress splits a resource address such as
+// module.stack["aws"].module.vpc.aws_subnet.private["us-east-1a"] into its
+// module call names, mode ("managed" or "data"), type and name. Instance
+// keys are dropped.
+func ParseAddress(address string) (calls []string, mode, typ, name string, ok bool) {
+	parts := splitAddress(address)
+	for len(parts) >= 2 && parts[0] == "module" {
+		calls = append(calls, parts[1])
+		parts = parts[2:]
+	}
+	mode = "managed"
+	if len(parts) > 0 && parts[0] == "data" {
+		mode = "data"
+		parts = parts[1:]
+	}
+	if len(parts) != 2 {
+		return nil, "", "", "", false
+	}
+	return calls, mode, parts[0], parts[1], true
+}
+
+// splitAddress splits on dots outside of [...] instance keys and strips the
+// keys, so ["a.b"] inside a key does not break the split.
+func splitAddress(address string) []string {
+	var (
+		parts   []string
+		cur     strings.Builder
+		depth   int
+		inQuote bool
+	)
+	for i := 0; i < len(address); i++ {
+		ch := address[i]
+		switch {
+		case inQuote:
+			if ch == '\\' {
+				i++
+			} else if ch == '"' {
+				inQuote = false
+			}
+		case ch == '"' && depth > 0:
+			inQuote = true
+		case ch == '[':
+			depth++
+		case ch == ']':
+			depth--
+		case ch == '.' && depth == 0:
+			parts = append(parts, cur.String())
+			cur.Reset()
+		case depth == 0:
+			cur.WriteByte(ch)
+		}
+	}
+	return append(parts, cur.String())
+}
@@ -0,0 +1,209 @@
+package report_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/report"
+)
+
+func TestParseAddress(t *testing.T) {
+	cases := []struct {
+		address string
+		calls   []string
+		mode    string
+		typ     string
+		name    string
+	}{
+		{"aws_kms_key.main", nil, "managed", "aws_kms_key", "main"},
+		{"data.aws_caller_identity.current", nil, "data", "aws_caller_identity", "current"},
+		{`module.stack["aws"].module.vpc.aws_subnet.private["us-east-1.a"]`, []string{"stack", "vpc"}, "managed", "aws_subnet", "private"},
+		{"module.eks.aws_eks_node_group.this[0]", []string{"eks"}, "managed", "aws_eks_node_group", "this"},
+	}
+	for _, tc := range cases {
+		calls, mode, typ, name, ok := report.ParseAddress(tc.address)
+		require.True(t, ok, tc.address)
+		assert.Equal(t, tc.calls, calls, tc.address)
+		assert.Equal(t, tc.mode, mode, tc.address)
+		assert.Equal(t, tc.typ, typ, tc.address)
+		assert.Equal(t, tc.name, name, tc.address)
+	}
+
+	_, _, _, _, ok := report.ParseAddress("module.vpc")
+	assert.False(t, ok)
+}
+
+func sourceIndex() *report.SourceIndex {
+	plan := &tfjson.Plan{Config: &tfjson.Config{RootModule: &tfjson.ConfigModule{
+		ModuleCalls: map[string]*tfjson.ModuleCall{
+			"logs":     {Source: "../modules/bucket", Module: &tfjson.ConfigModule{}},
+			"registry": {Source: "terraform-aws-modules/vpc/aws"},
+		},
+	}}}
+	return report.NewSourceIndex("testdata", filepath.Join("testdata", "root"), plan)
+}
+
+func TestLocate(t *testing.T) {
+	idx := sourceIndex()
+
+	loc := idx.Locate("aws_kms_key.main", "enable_key_rotation")
+	require.NotNil(t, loc)
+	assert.Equal(t, "root/main.tf", loc.File)
+	assert.Equal(t, 8, loc.StartLine)
+	assert.Equal(t, 3, loc.StartColumn)
+
+	loc = idx.Locate("module.logs.aws_launch_template.nodes", "metadata_options.0.http_tokens")
+	require.NotNil(t, loc)
+	assert.Equal(t, "modules/bucket/main.tf", loc.File)
+	assert.Equal(t, 14, loc.StartLine)
+
+	// Unset attributes fall back to the block header.
+	loc = idx.Locate(`module.logs.aws_s3_bucket.this["x"]`, "tags")
+	require.NotNil(t, loc)
+	assert.Equal(t, 5, loc.StartLine)
+
+	assert.Nil(t, idx.Locate("module.registry.aws_vpc.this", ""))
+	assert.Nil(t, idx.Locate("aws_kms_key.missing", ""))
+}
+
+func TestWriteSARIF(t *testing.T) {
+	idx := sourceIndex()
+	rules := []report.Rule{{ID: "AWS-ENC-01/kms-key-rotation", Name: "kms-key-rotation", ShortDescription: "KMS rotation"}}
+	findings := []report.Finding{
+		{RuleID: "AWS-ENC-01/kms-key-rotation", Level: report.LevelError, Message: "enable_key_rotation is not true",
+			Address: "aws_kms_key.main", Location: idx.Locate("aws_kms_key.main", "enable_key_rotation")},
+		{RuleID: "unlisted", Level: report.LevelWarning, Message: "no location"},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteSARIF(&buf, report.Tool{Name: "test"}, rules, findings))
+
+	var doc struct {
+		Version string
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Name  string
+					Rules []struct{ ID string }
+				}
+			}
+			Results []struct {
+				RuleID    string
+				RuleIndex int
+				Level     string
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct{ URI, URIBaseID string }
+						Region           struct{ StartLine int }
+					}
+					LogicalLocations []struct{ FullyQualifiedName string }
+				}
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, "2.1.0", doc.Version)
+	require.Len(t, doc.Runs, 1)
+	run := doc.Runs[0]
+	require.Len(t, run.Tool.Driver.Rules, 2)
+	require.Len(t, run.Results, 2)
+
+	res := run.Results[0]
+	assert.Equal(t, "AWS-ENC-01/kms-key-rotation", res.RuleID)
+	assert.Equal(t, 0, res.RuleIndex)
+	assert.Equal(t, "error", res.Level)
+	require.Len(t, res.Locations, 1)
+	assert.Equal(t, "root/main.tf", res.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	assert.Equal(t, "%SRCROOT%", res.Locations[0].PhysicalLocation.ArtifactLocation.URIBaseID)
+	assert.Equal(t, 8, res.Locations[0].PhysicalLocation.Region.StartLine)
+	assert.Equal(t, "aws_kms_key.main", res.Locations[0].LogicalLocations[0].FullyQualifiedName)
+
+	assert.Equal(t, 1, run.Results[1].RuleIndex)
+	assert.Empty(t, run.Results[1].Locations)
+}
+
+func loadEvents(t *testing.T) *report.JUnit {
+	f, err := os.Open(filepath.Join("testdata", "test2json.jsonl"))
+	require.NoError(t, err)
+	defer f.Close()
+	doc, err := report.ParseTestEvents(f)
+	require.NoError(t, err)
+	return doc
+}
+
+func TestParseTestEvents(t *testing.T) {
+	doc := loadEvents(t)
+	require.Len(t, doc.Suites, 1)
+	suite := doc.Suites[0]
+	assert.Equal(t, "github.com/yourorg/tf-modules/tests/aws", suite.Name)
+	assert.Equal(t, 4, suite.Tests)
+	assert.Equal(t, 2, suite.Failures)
+	assert.Equal(t, 1, suite.Skipped)
+	assert.Equal(t, "1325.100", suite.Time)
+	assert.Equal(t, "2026-10-01T10:00:00Z", suite.Timestamp)
+
+	byName := map[string]report.JUnitCase{}
+	for _, c := range suite.Cases {
+		byName[c.Name] = c
+	}
+
+	pass := byName["TestVpcHappyPath"]
+	assert.Equal(t, "120.500", pass.Time)
+	assert.Nil(t, pass.Failure)
+	assert.Contains(t, pass.SystemOut, "Apply complete!")
+
+	assert.Equal(t, "SKIP_EKS_TESTS is set", byName["TestEksSmokeTest"].Skipped.Message)
+	assert.Equal(t, "Should be true", byName["TestKmsKeyRotation"].Failure.Message)
+	assert.Contains(t, byName["TestS3StateBucket"].Failure.Message, "did not complete")
+}
+
+func TestAttachLogsAndWrite(t *testing.T) {
+	doc := loadEvents(t)
+	dir := t.TempDir()
+	for _, name := range []string{"TestVpcHappyPath.log", "TestVpcHappyPath-apply.log", "TestVpcHappyPathExtra.log"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("log"), 0o644))
+	}
+	require.NoError(t, doc.AttachLogs(dir))
+
+	var out string
+	for _, c := range doc.Suites[0].Cases {
+		if c.Name == "TestVpcHappyPath" {
+			out = c.SystemOut
+		}
+	}
+	assert.Equal(t, 2, strings.Count(out, "[[ATTACHMENT|"))
+	assert.NotContains(t, out, "Extra")
+
+	var buf bytes.Buffer
+	require.NoError(t, doc.Write(&buf))
+	assert.True(t, strings.HasPrefix(buf.String(), xml.Header))
+	var decoded report.JUnit
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &decoded))
+	assert.Len(t, decoded.Suites[0].Cases, 4)
+}
+
+func TestFindingsJUnit(t *testing.T) {
+	rules := []report.Rule{{ID: "a", ShortDescription: "rule a"}, {ID: "b"}}
+	findings := []report.Finding{
+		{RuleID: "a", Level: report.LevelError, Address: "x.y", Message: "bad", Location: &report.Location{File: "main.tf", StartLine: 3}},
+		{RuleID: "b", Level: report.LevelWarning, Address: "x.z", Message: "meh"},
+		{RuleID: "c", Level: report.LevelError, Address: "x.w", Message: "unlisted"},
+	}
+	doc := report.FindingsJUnit(report.Tool{Name: "checker"}, rules, findings)
+	suite := doc.Suites[0]
+	assert.Equal(t, 3, suite.Tests)
+	assert.Equal(t, 2, suite.Failures)
+	assert.Equal(t, "rule a: 1 violation(s)", suite.Cases[0].Failure.Message)
+	assert.Equal(t, "main.tf:3: x.y: bad", suite.Cases[0].Failure.Body)
+	assert.Nil(t, suite.Cases[1].Failure)
+	assert.Contains(t, suite.Cases[1].SystemOut, "[warning] x.z: meh")
+}
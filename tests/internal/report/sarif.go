@@ -0,0 +1,173 @@
+// Package report writes checker findings as SARIF 2.1.0 and test results
+// as JUnit XML, so CI can annotate pull requests and chart test history
+// from every tool in tests/ the same way.
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// Level is a SARIF result level.
+type Level string
+
+const (
+	LevelError   Level = "error"
+	LevelWarning Level = "warning"
+	LevelNote    Level = "note"
+	LevelNone    Level = "none"
+)
+
+// Tool identifies the checker producing findings.
+type Tool struct {
+	Name           string
+	Version        string
+	InformationURI string
+}
+
+// Rule describes one check a tool can report.
+type Rule struct {
+	ID               string
+	Name             string
+	ShortDescription string
+	HelpURI          string
+}
+
+// Finding is one tool-agnostic result.
+type Finding struct {
+	RuleID  string
+	Level   Level
+	Message string
+	// Address is the Terraform resource address, reported as a SARIF
+	// logical location.
+	Address string
+	// Location is the source range, if it could be resolved.
+	Location *Location
+}
+
+// SARIF 2.1.0 document shapes; only the fields we populate are modelled.
+type (
+	sarifLog struct {
+		Schema  string     `json:"$schema"`
+		Version string     `json:"version"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool    sarifTool     `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name           string      `json:"name"`
+		Version        string      `json:"version,omitempty"`
+		InformationURI string      `json:"informationUri,omitempty"`
+		Rules          []sarifRule `json:"rules"`
+	}
+	sarifRule struct {
+		ID               string        `json:"id"`
+		Name             string        `json:"name,omitempty"`
+		ShortDescription *sarifMessage `json:"shortDescription,omitempty"`
+		HelpURI          string        `json:"helpUri,omitempty"`
+	}
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+	sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		RuleIndex int             `json:"ruleIndex"`
+		Level     Level           `json:"level"`
+		Message   sarifMessage    `json:"message"`
+		Locations []sarifLocation `json:"locations,omitempty"`
+	}
+	sarifLocation struct {
+		PhysicalLocation *sarifPhysical `json:"physicalLocation,omitempty"`
+		LogicalLocations []sarifLogical `json:"logicalLocations,omitempty"`
+	}
+	sarifPhysical struct {
+		ArtifactLocation sarifArtifact `json:"artifactLocation"`
+		Region           *sarifRegion  `json:"region,omitempty"`
+	}
+	sarifArtifact struct {
+		URI       string `json:"uri"`
+		URIBaseID string `json:"uriBaseId,omitempty"`
+	}
+	sarifRegion struct {
+		StartLine   int `json:"startLine"`
+		StartColumn int `json:"startColumn,omitempty"`
+		EndLine     int `json:"endLine,omitempty"`
+		EndColumn   int `json:"endColumn,omitempty"`
+	}
+	sarifLogical struct {
+		FullyQualifiedName string `json:"fullyQualifiedName"`
+		Kind               string `json:"kind"`
+	}
+)
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+// WriteSARIF writes a single-run SARIF 2.1.0 log. Findings whose rule is
+// not listed in rules get a bare rule entry so the log stays valid.
+// Locations are emitted relative to %SRCROOT%, the repository root.
+func WriteSARIF(w io.Writer, tool Tool, rules []Rule, findings []Finding) error {
+	driver := sarifDriver{Name: tool.Name, Version: tool.Version, InformationURI: tool.InformationURI}
+	index := map[string]int{}
+	addRule := func(r Rule) {
+		if _, ok := index[r.ID]; ok {
+			return
+		}
+		index[r.ID] = len(driver.Rules)
+		sr := sarifRule{ID: r.ID, Name: r.Name, HelpURI: r.HelpURI}
+		if r.ShortDescription != "" {
+			sr.ShortDescription = &sarifMessage{Text: r.ShortDescription}
+		}
+		driver.Rules = append(driver.Rules, sr)
+	}
+	for _, r := range rules {
+		addRule(r)
+	}
+
+	sorted := append([]Finding(nil), findings...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].RuleID < sorted[j].RuleID })
+
+	results := make([]sarifResult, 0, len(sorted))
+	for _, f := range sorted {
+		addRule(Rule{ID: f.RuleID})
+		res := sarifResult{
+			RuleID:    f.RuleID,
+			RuleIndex: index[f.RuleID],
+			Level:     f.Level,
+			Message:   sarifMessage{Text: f.Message},
+		}
+		var loc sarifLocation
+		if f.Location != nil {
+			loc.PhysicalLocation = &sarifPhysical{
+				ArtifactLocation: sarifArtifact{URI: f.Location.File, URIBaseID: "%SRCROOT%"},
+				Region: &sarifRegion{
+					StartLine:   f.Location.StartLine,
+					StartColumn: f.Location.StartColumn,
+					EndLine:     f.Location.EndLine,
+					EndColumn:   f.Location.EndColumn,
+				},
+			}
+		}
+		if f.Address != "" {
+			loc.LogicalLocations = []sarifLogical{{FullyQualifiedName: f.Address, Kind: "resource"}}
+		}
+		if loc.PhysicalLocation != nil || loc.LogicalLocations != nil {
+			res.Locations = []sarifLocation{loc}
+		}
+		results = append(results, res)
+	}
+
+	doc := sarifLog{
+		Schema:  sarifSchema,
+		Version: "2.1.0",
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
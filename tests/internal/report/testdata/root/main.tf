@@ -0,0 +1,9 @@
+module "logs" {
+  source = "../modules/bucket"
+  name   = "example-logs"
+}
+
+resource "aws_kms_key" "main" {
+  description         = "example"
+  enable_key_rotation = false
+}
@@ -0,0 +1,237 @@
+package selection
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// sourceRe matches local module sources such as source = "../../gcp/gke".
+// Registry and git sources are ignored since they never change in-tree.
+var sourceRe = regexp.MustCompile(`(?m)^\s*source\s*=\s*"(\.{1,2}/[^"]+)"`)
+
+// ModuleGraph records which in-repo modules call which other in-repo
+// modules through relative source paths. Keys and values are
+// repository-relative module directories.
+type ModuleGraph struct {
+	root    string
+	callers map[string][]string
+}
+
+// LoadModuleGraph scans every .tf file under the given repository-relative
+// directories (typically "modules") and records local module calls.
+func LoadModuleGraph(repoRoot string, dirs ...string) (*ModuleGraph, error) {
+	g := &ModuleGraph{root: repoRoot, callers: map[string][]string{}}
+	for _, dir := range dirs {
+		err := filepath.WalkDir(filepath.Join(repoRoot, dir), func(p string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if strings.HasPrefix(d.Name(), ".") && d.Name() != "." {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if filepath.Ext(p) != ".tf" {
+				return nil
+			}
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			caller, err := relPath(repoRoot, filepath.Dir(p))
+			if err != nil {
+				return err
+			}
+			for _, m := range sourceRe.FindAllStringSubmatch(string(data), -1) {
+				callee := path.Clean(path.Join(caller, m[1]))
+				g.callers[callee] = appendUnique(g.callers[callee], caller)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// Affected expands a set of changed modules to include every module that
+// calls one of them, directly or transitively.
+func (g *ModuleGraph) Affected(changed []string) map[string]bool {
+	out := map[string]bool{}
+	queue := append([]string(nil), changed...)
+	for len(queue) > 0 {
+		mod := queue[0]
+		queue = queue[1:]
+		if out[mod] {
+			continue
+		}
+		out[mod] = true
+		queue = append(queue, g.callers[mod]...)
+	}
+	return out
+}
+
+// ModuleForFile returns the module directory that owns a changed file: the
+// nearest ancestor directory containing .tf files. Files that live outside
+// any module (docs, workflows) return "".
+func (g *ModuleGraph) ModuleForFile(file string) string {
+	file = filepath.ToSlash(path.Clean(file))
+	if strings.HasSuffix(file, ".md") {
+		return ""
+	}
+	for dir := path.Dir(file); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if hasTerraformFiles(filepath.Join(g.root, filepath.FromSlash(dir))) {
+			return dir
+		}
+	}
+	return ""
+}
+
+func hasTerraformFiles(dir string) bool {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	return err == nil && len(matches) > 0
+}
+
+// GoGraph records which in-module Go packages import which others, so a
+// change to shared harness code selects only the tests that depend on it.
+// Keys and values are repository-relative package directories.
+type GoGraph struct {
+	importers map[string][]string
+	// embedded maps the files and directories //go:embed directives name
+	// to the package that embeds them.
+	embedded map[string]string
+}
+
+// LoadGoGraph parses the imports and //go:embed directives of every
+// non-test .go file under testsDir.
+func LoadGoGraph(repoRoot, testsDir string) (*GoGraph, error) {
+	modPath, err := modulePath(testsDir)
+	if err != nil {
+		return nil, err
+	}
+	testsRel, err := relPath(repoRoot, testsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &GoGraph{importers: map[string][]string{}, embedded: map[string]string{}}
+	fset := token.NewFileSet()
+	err = filepath.WalkDir(testsDir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != testsDir && (strings.HasPrefix(d.Name(), ".") || d.Name() == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(p) != ".go" || strings.HasSuffix(p, "_test.go") {
+			return nil
+		}
+		file, err := parser.ParseFile(fset, p, nil, parser.ImportsOnly)
+		if err != nil {
+			return err
+		}
+		importer, err := relPath(repoRoot, filepath.Dir(p))
+		if err != nil {
+			return err
+		}
+		for _, imported := range localImports(file, modPath, testsRel) {
+			g.importers[imported] = appendUnique(g.importers[imported], importer)
+		}
+		if !importsEmbed(file) {
+			return nil
+		}
+		full, err := parser.ParseFile(fset, p, nil, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+		for _, pattern := range embedPatterns(full) {
+			matches, err := filepath.Glob(filepath.Join(filepath.Dir(p), filepath.FromSlash(pattern)))
+			if err != nil {
+				return err
+			}
+			for _, m := range matches {
+				rel, err := relPath(repoRoot, m)
+				if err != nil {
+					return err
+				}
+				g.embedded[rel] = importer
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Affected expands a set of changed package directories to include every
+// package that imports one of them, directly or transitively.
+func (g *GoGraph) Affected(changed []string) map[string]bool {
+	out := map[string]bool{}
+	queue := append([]string(nil), changed...)
+	for len(queue) > 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+		if out[pkg] {
+			continue
+		}
+		out[pkg] = true
+		queue = append(queue, g.importers[pkg]...)
+	}
+	return out
+}
+
+// PackageForFile returns the package that embeds a changed file with
+// //go:embed, directly or through an embedded directory, or "".
+func (g *GoGraph) PackageForFile(file string) string {
+	file = filepath.ToSlash(path.Clean(file))
+	for p := file; p != "." && p != "/"; p = path.Dir(p) {
+		if pkg, ok := g.embedded[p]; ok {
+			return pkg
+		}
+	}
+	return ""
+}
+
+func importsEmbed(file *ast.File) bool {
+	for _, imp := range file.Imports {
+		if imp.Path.Value == `"embed"` {
+			return true
+		}
+	}
+	return false
+}
+
+// embedPatterns returns the patterns of the file's //go:embed directives,
+// without quotes or the all: prefix.
+func embedPatterns(file *ast.File) []string {
+	var out []string
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			args, ok := strings.CutPrefix(c.Text, "//go:embed ")
+			if !ok {
+				continue
+			}
+			for _, f := range strings.Fields(args) {
+				if unquoted, err := strconv.Unquote(f); err == nil {
+					f = unquoted
+				}
+				out = append(out, strings.TrimPrefix(f, "all:"))
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,97 @@
+package selection
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Selection is the set of tests to run in one package.
+type Selection struct {
+	// Package is the repository-relative test package, e.g. "tests/aws".
+	Package string
+	// Tests are the selected test function names, sorted.
+	Tests []string
+}
+
+// RunRegex returns an anchored regular expression for go test -run that
+// matches exactly the selected tests.
+func (s Selection) RunRegex() string {
+	quoted := make([]string, len(s.Tests))
+	for i, name := range s.Tests {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	return "^(" + strings.Join(quoted, "|") + ")$"
+}
+
+// Select returns the minimal per-package test selection for a list of
+// repository-relative changed files. A test is selected when:
+//
+//   - any module in its TerraformDir chain, or a module those call, changed
+//   - the file that declares it changed
+//   - another file in its package (helpers_test.go) changed
+//   - a Go package its file imports changed, directly or transitively,
+//     including a file that package embeds with //go:embed
+//   - go.mod or go.sum changed, since any test may depend on them
+//   - its TerraformDir could not be resolved statically
+func Select(specs []TestSpec, modules *ModuleGraph, pkgs *GoGraph, testsDir string, changed []string) []Selection {
+	testFiles := map[string]bool{}
+	testPkgs := map[string]bool{}
+	for _, s := range specs {
+		testFiles[s.File] = true
+		testPkgs[s.Package] = true
+	}
+
+	var changedModules, changedGo []string
+	changedFiles := map[string]bool{}
+	changedPkgs := map[string]bool{}
+	all := false
+	for _, f := range changed {
+		f = path.Clean(strings.TrimPrefix(f, "./"))
+		changedFiles[f] = true
+		switch {
+		case testFiles[f]:
+			// Handled per test below.
+		case strings.HasPrefix(f, testsDir+"/") && strings.HasSuffix(f, "_test.go") && testPkgs[path.Dir(f)]:
+			changedPkgs[path.Dir(f)] = true
+		case f == testsDir+"/go.mod" || f == testsDir+"/go.sum":
+			all = true
+		case strings.HasPrefix(f, testsDir+"/") && strings.HasSuffix(f, ".go"):
+			changedGo = append(changedGo, path.Dir(f))
+		case pkgs.PackageForFile(f) != "":
+			changedGo = append(changedGo, pkgs.PackageForFile(f))
+		default:
+			if mod := modules.ModuleForFile(f); mod != "" {
+				changedModules = append(changedModules, mod)
+			}
+		}
+	}
+	affectedModules := modules.Affected(changedModules)
+	affectedGo := pkgs.Affected(changedGo)
+
+	byPkg := map[string][]string{}
+	for _, s := range specs {
+		if all || s.Unresolved || changedFiles[s.File] || changedPkgs[s.Package] ||
+			affectedGo[s.Package] || anyIn(s.Imports, affectedGo) || anyIn(s.Modules, affectedModules) {
+			byPkg[s.Package] = append(byPkg[s.Package], s.Name)
+		}
+	}
+
+	out := make([]Selection, 0, len(byPkg))
+	for pkg, tests := range byPkg {
+		sort.Strings(tests)
+		out = append(out, Selection{Package: pkg, Tests: tests})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Package < out[j].Package })
+	return out
+}
+
+func anyIn(list []string, set map[string]bool) bool {
+	for _, v := range list {
+		if set[v] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package selection_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/selection"
+)
+
+const fixtureRepo = "testdata/repo"
+
+func loadFixture(t *testing.T) ([]selection.TestSpec, *selection.ModuleGraph, *selection.GoGraph) {
+	t.Helper()
+	testsDir := filepath.Join(fixtureRepo, "tests")
+
+	specs, err := selection.LoadSpecs(fixtureRepo, testsDir)
+	require.NoError(t, err)
+	modules, err := selection.LoadModuleGraph(fixtureRepo, "modules")
+	require.NoError(t, err)
+	pkgs, err := selection.LoadGoGraph(fixtureRepo, testsDir)
+	require.NoError(t, err)
+	return specs, modules, pkgs
+}
+
+func TestLoadSpecsExtractsModuleChains(t *testing.T) {
+	specs, _, _ := loadFixture(t)
+
+	byName := map[string]selection.TestSpec{}
+	for _, s := range specs {
+		byName[s.Name] = s
+	}
+	require.Len(t, byName, 4)
+
+	assert.Equal(t, []string{"modules/cloud/vpc", "modules/cloud/eks"}, byName["TestChain"].Modules,
+		"literal and constant TerraformDir values should both resolve, in order")
+	assert.Equal(t, "tests/cloud", byName["TestChain"].Package)
+	assert.Equal(t, "tests/cloud/chain_test.go", byName["TestChain"].File)
+	assert.True(t, byName["TestDynamic"].Unresolved, "function-call TerraformDir cannot be resolved statically")
+	assert.Equal(t, []string{"tests/internal/harness"}, byName["TestVpc"].Imports)
+}
+
+func TestSelect(t *testing.T) {
+	specs, modules, pkgs := loadFixture(t)
+
+	cases := []struct {
+		name    string
+		changed []string
+		want    []string
+	}{
+		{
+			name:    "chained module selects every test in the chain",
+			changed: []string{"modules/cloud/eks/main.tf"},
+			want:    []string{"TestChain", "TestDynamic"},
+		},
+		{
+			name:    "called module selects tests of its callers",
+			changed: []string{"modules/cloud/vpc/variables.tf"},
+			want:    []string{"TestBlueprint", "TestChain", "TestDynamic", "TestVpc"},
+		},
+		{
+			name:    "module readme is ignored",
+			changed: []string{"modules/cloud/eks/README.md"},
+			want:    []string{"TestDynamic"},
+		},
+		{
+			name:    "test file selects its own tests",
+			changed: []string{"tests/cloud/chain_test.go"},
+			want:    []string{"TestBlueprint", "TestChain", "TestDynamic", "TestVpc"},
+		},
+		{
+			name:    "imported harness package selects importing packages",
+			changed: []string{"tests/internal/harness/harness.go"},
+			want:    []string{"TestBlueprint", "TestChain", "TestDynamic", "TestVpc"},
+		},
+		{
+			name:    "embedded data selects importers of the embedding package",
+			changed: []string{"tests/internal/harness/prices/us-east-1.json"},
+			want:    []string{"TestBlueprint", "TestChain", "TestDynamic", "TestVpc"},
+		},
+		{
+			name:    "data the harness does not embed is ignored",
+			changed: []string{"tests/internal/harness/notes.txt"},
+			want:    []string{"TestDynamic"},
+		},
+		{
+			name:    "unrelated docs select only unresolved tests",
+			changed: []string{"docs/testing.md"},
+			want:    []string{"TestDynamic"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got := selection.Select(specs, modules, pkgs, "tests", tc.changed)
+			require.Len(t, got, 1)
+			assert.Equal(t, "tests/cloud", got[0].Package)
+			assert.Equal(t, tc.want, got[0].Tests)
+		})
+	}
+}
+
+func TestRunRegex(t *testing.T) {
+	s := selection.Selection{Package: "tests/aws", Tests: []string{"TestEksSmokeTest", "TestVpcHappyPath"}}
+	assert.Equal(t, "^(TestEksSmokeTest|TestVpcHappyPath)$", s.RunRegex())
+}
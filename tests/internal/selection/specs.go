@@ -0,0 +1,276 @@
+// Package selection maps changed files to the Terratest functions that
+// exercise them, so CI can run only the tests a change can affect.
+package selection
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TestSpec describes a single Test* function and the Terraform modules it
+// applies, in the order they appear in the function body.
+type TestSpec struct {
+	// Package is the test package directory relative to the repository
+	// root, e.g. "tests/aws".
+	Package string
+	// Name is the test function name, e.g. "TestEksSmokeTest".
+	Name string
+	// File is the repository-relative path of the file declaring the test.
+	File string
+	// Modules are repository-relative module directories taken from
+	// TerraformDir values, e.g. "modules/aws/vpc".
+	Modules []string
+	// Imports are repository-relative directories of in-module Go packages
+	// imported by any test file in the package, e.g. "tests/internal/harness".
+	// The whole package is used because helpers_test.go may do the importing.
+	Imports []string
+	// Unresolved is set when a TerraformDir value is not a string constant.
+	// Such tests are always selected because their chain cannot be known.
+	Unresolved bool
+}
+
+// LoadSpecs parses every *_test.go file in each directory under testsDir
+// and returns the Test* functions it finds. repoRoot is used to express
+// paths relative to the repository.
+func LoadSpecs(repoRoot, testsDir string) ([]TestSpec, error) {
+	modPath, err := modulePath(testsDir)
+	if err != nil {
+		return nil, err
+	}
+	testsRel, err := relPath(repoRoot, testsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var specs []TestSpec
+	err = filepath.WalkDir(testsDir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if name := d.Name(); p != testsDir && (strings.HasPrefix(name, ".") || name == "testdata") {
+			return filepath.SkipDir
+		}
+		pkgSpecs, err := ParsePackage(repoRoot, p, modPath, testsRel)
+		if err != nil {
+			return err
+		}
+		specs = append(specs, pkgSpecs...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return specs, nil
+}
+
+// ParsePackage extracts TestSpecs from the *_test.go files in a single
+// directory. Package-level string constants are resolved so that
+// TerraformDir: vpcModuleDir works as well as a literal. Imports of
+// modPath are recorded relative to the repository via testsRel.
+func ParsePackage(repoRoot, dir, modPath, testsRel string) ([]TestSpec, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", dir, err)
+	}
+
+	relDir, err := relPath(repoRoot, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var specs []TestSpec
+	for _, pkg := range pkgs {
+		consts := stringConsts(pkg)
+		var imports []string
+		for _, file := range pkg.Files {
+			for _, imp := range localImports(file, modPath, testsRel) {
+				imports = appendUnique(imports, imp)
+			}
+		}
+		sort.Strings(imports)
+
+		for fileName, file := range pkg.Files {
+			relFile, err := relPath(repoRoot, fileName)
+			if err != nil {
+				return nil, err
+			}
+			for _, decl := range file.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if !ok || fn.Recv != nil || fn.Body == nil || !isTestFunc(fn) {
+					continue
+				}
+				spec := TestSpec{Package: relDir, Name: fn.Name.Name, File: relFile, Imports: imports}
+				for _, v := range terraformDirs(fn.Body) {
+					s, ok := stringValue(v, consts)
+					if !ok {
+						spec.Unresolved = true
+						continue
+					}
+					mod, err := relPath(repoRoot, filepath.Join(dir, filepath.FromSlash(s)))
+					if err != nil {
+						return nil, err
+					}
+					spec.Modules = appendUnique(spec.Modules, mod)
+				}
+				specs = append(specs, spec)
+			}
+		}
+	}
+
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+	return specs, nil
+}
+
+// localImports returns the repository-relative directories of the packages
+// under modPath that file imports.
+func localImports(file *ast.File, modPath, testsRel string) []string {
+	var out []string
+	for _, imp := range file.Imports {
+		p, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		if p == modPath || strings.HasPrefix(p, modPath+"/") {
+			out = appendUnique(out, path.Join(testsRel, strings.TrimPrefix(p, modPath)))
+		}
+	}
+	return out
+}
+
+// modulePath reads the module directive from dir/go.mod.
+func modulePath(dir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if f := strings.Fields(line); len(f) == 2 && f[0] == "module" {
+			return f[1], nil
+		}
+	}
+	return "", fmt.Errorf("%s/go.mod: no module directive", dir)
+}
+
+// isTestFunc reports whether fn has the shape func TestXxx(t *testing.T).
+func isTestFunc(fn *ast.FuncDecl) bool {
+	name := fn.Name.Name
+	if !strings.HasPrefix(name, "Test") || name == "TestMain" {
+		return false
+	}
+	params := fn.Type.Params.List
+	if len(params) != 1 {
+		return false
+	}
+	star, ok := params[0].Type.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	return ok && sel.Sel.Name == "T"
+}
+
+// terraformDirs returns every expression assigned to a TerraformDir field,
+// either in a composite literal or via opts.TerraformDir = ... .
+func terraformDirs(body *ast.BlockStmt) []ast.Expr {
+	var out []ast.Expr
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.KeyValueExpr:
+			if id, ok := n.Key.(*ast.Ident); ok && id.Name == "TerraformDir" {
+				out = append(out, n.Value)
+			}
+		case *ast.AssignStmt:
+			for i, lhs := range n.Lhs {
+				sel, ok := lhs.(*ast.SelectorExpr)
+				if ok && sel.Sel.Name == "TerraformDir" && i < len(n.Rhs) {
+					out = append(out, n.Rhs[i])
+				}
+			}
+		}
+		return true
+	})
+	return out
+}
+
+// stringConsts collects package-level string constants declared in pkg.
+func stringConsts(pkg *ast.Package) map[string]string {
+	consts := map[string]string{}
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				vs := spec.(*ast.ValueSpec)
+				for i, name := range vs.Names {
+					if i >= len(vs.Values) {
+						continue
+					}
+					if s, ok := stringValue(vs.Values[i], nil); ok {
+						consts[name.Name] = s
+					}
+				}
+			}
+		}
+	}
+	return consts
+}
+
+// stringValue resolves a string literal or a reference to a known constant.
+func stringValue(expr ast.Expr, consts map[string]string) (string, bool) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.STRING {
+			return "", false
+		}
+		s, err := strconv.Unquote(e.Value)
+		return s, err == nil
+	case *ast.Ident:
+		s, ok := consts[e.Name]
+		return s, ok
+	case *ast.ParenExpr:
+		return stringValue(e.X, consts)
+	}
+	return "", false
+}
+
+// relPath returns target relative to root using forward slashes.
+func relPath(root, target string) (string, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absRoot, absTarget)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
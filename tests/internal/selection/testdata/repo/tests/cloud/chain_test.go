@@ -0,0 +1,32 @@
+package cloud_test
+
+import (
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+)
+
+const eksModuleDir = "../../modules/cloud/eks"
+
+func TestVpc(t *testing.T) {
+	opts := &terraform.Options{TerraformDir: "../../modules/cloud/vpc"}
+	terraform.InitAndApply(t, opts)
+}
+
+func TestChain(t *testing.T) {
+	vpcOpts := &terraform.Options{TerraformDir: "../../modules/cloud/vpc"}
+	eksOpts := &terraform.Options{}
+	eksOpts.TerraformDir = eksModuleDir
+	terraform.InitAndApply(t, vpcOpts)
+	terraform.InitAndApply(t, eksOpts)
+}
+
+func TestBlueprint(t *testing.T) {
+	opts := &terraform.Options{TerraformDir: "../../modules/multi/blueprint"}
+	terraform.InitAndApply(t, opts)
+}
+
+func TestDynamic(t *testing.T) {
+	opts := &terraform.Options{TerraformDir: moduleDir(t)}
+	terraform.InitAndApply(t, opts)
+}
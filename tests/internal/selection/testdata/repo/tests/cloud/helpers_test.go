@@ -0,0 +1,11 @@
+package cloud_test
+
+import (
+	"testing"
+
+	"example.com/repo/tests/internal/harness"
+)
+
+func moduleDir(t *testing.T) string {
+	return harness.Dir(t)
+}
@@ -0,0 +1,3 @@
+module example.com/repo/tests
+
+go 1.21
@@ -0,0 +1,6 @@
+package harness
+
+import "testing"
+
+// Dir returns a module directory.
+func Dir(t *testing.T) string { return "../../modules/cloud/vpc" }
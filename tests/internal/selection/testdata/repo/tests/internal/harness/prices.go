@@ -0,0 +1,8 @@
+package harness
+
+import "embed"
+
+// Prices holds the price tables.
+//
+//go:embed prices
+var Prices embed.FS
@@ -0,0 +1,271 @@
+// Package teardown keeps a run manifest of the fixtures a test binary has
+// applied, so they are still destroyed when its deferred destroys never
+// run: when go test -timeout expires, the testing package panics, and on
+// Ctrl-C the binary is killed.
+//
+// A test records each fixture before applying it and removes it once
+// destroyed. Watch destroys whatever is still recorded, newest first, on
+// SIGINT or SIGTERM and shortly before the test deadline, and tests/cmd/cleanup
+// destroys what a binary that died anyway left in its manifest.
+package teardown
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yourorg/tf-modules/tests/internal/filelock"
+)
+
+// EnvDir overrides the directory manifests are written to.
+const EnvDir = "TEST_MANIFEST_DIR"
+
+// ErrInUse is returned by Open for a manifest a live test binary holds.
+var ErrInUse = errors.New("manifest is in use by a running test binary")
+
+// Dir returns the manifest directory: $TEST_MANIFEST_DIR, or def.
+func Dir(def string) string {
+	if d := os.Getenv(EnvDir); d != "" {
+		return d
+	}
+	return def
+}
+
+// Fixture is one applied Terraform working directory and what it takes to
+// destroy it again.
+type Fixture struct {
+	ID   int    `json:"id"`
+	Test string `json:"test"`
+	// Dir is the absolute working directory, holding the local state.
+	Dir      string                 `json:"dir"`
+	Vars     map[string]interface{} `json:"vars,omitempty"`
+	VarFiles []string               `json:"var_files,omitempty"`
+	Env      map[string]string      `json:"env,omitempty"`
+	// Tag is the run tag the fixture's resources carry, for finding them
+	// if the fixture cannot be destroyed.
+	Tag     string    `json:"tag,omitempty"`
+	Applied time.Time `json:"applied"`
+}
+
+func (f Fixture) String() string {
+	return fmt.Sprintf("%s %s", f.Test, f.Dir)
+}
+
+// Manifest is a run manifest file.
+type Manifest struct {
+	Host     string    `json:"host"`
+	PID      int       `json:"pid"`
+	Started  time.Time `json:"started"`
+	Fixtures []Fixture `json:"fixtures"`
+}
+
+// List returns the manifest files in dir, oldest first.
+func List(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Run is a manifest held by this process. Its methods are safe for
+// concurrent use by parallel tests.
+type Run struct {
+	// Terraform is the binary Teardown runs; terraform if empty.
+	Terraform string
+	// Log receives terraform's output and progress during Teardown;
+	// os.Stderr if nil.
+	Log io.Writer
+
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	m    Manifest
+	next int
+}
+
+// NewRun returns an empty run whose manifest, named after prefix, this
+// process and the time, is written to dir once a fixture is added.
+func NewRun(dir, prefix string) (*Run, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	now := time.Now().UTC()
+	name := fmt.Sprintf("%s-%s-%d.json", prefix, now.Format("20060102T150405"), os.Getpid())
+	return &Run{
+		path: filepath.Join(dir, name),
+		m:    Manifest{Host: host, PID: os.Getpid(), Started: now},
+		next: 1,
+	}, nil
+}
+
+// Open takes over the manifest at path, left by a binary that is no
+// longer running. It returns ErrInUse if the binary still holds it.
+func Open(path string) (*Run, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockManifest(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r := &Run{path: path, f: f, next: 1}
+	if err := json.Unmarshal(data, &r.m); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, fx := range r.m.Fixtures {
+		if fx.ID >= r.next {
+			r.next = fx.ID + 1
+		}
+	}
+	return r, nil
+}
+
+// Path returns the manifest file.
+func (r *Run) Path() string { return r.path }
+
+// Manifest returns a copy of the manifest as it stands.
+func (r *Run) Manifest() Manifest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := r.m
+	m.Fixtures = append([]Fixture(nil), r.m.Fixtures...)
+	return m
+}
+
+// Add records f, with Dir made absolute, and returns it with its ID.
+func (r *Run) Add(f Fixture) (Fixture, error) {
+	dir, err := filepath.Abs(f.Dir)
+	if err != nil {
+		return Fixture{}, err
+	}
+	f.Dir = dir
+	if f.Applied.IsZero() {
+		f.Applied = time.Now().UTC()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f.ID = r.next
+	r.next++
+	r.m.Fixtures = append(r.m.Fixtures, f)
+	return f, r.write()
+}
+
+// Remove forgets the fixture with id, once destroyed. Unknown IDs are
+// ignored, so a test and Teardown can both remove a fixture.
+func (r *Run) Remove(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, f := range r.m.Fixtures {
+		if f.ID == id {
+			r.m.Fixtures = append(r.m.Fixtures[:i], r.m.Fixtures[i+1:]...)
+			return r.write()
+		}
+	}
+	return nil
+}
+
+// write saves the manifest in place, so the lock on the open file holds,
+// or deletes it when no fixture is left. r.mu must be held.
+func (r *Run) write() error {
+	if len(r.m.Fixtures) == 0 {
+		if r.f == nil {
+			return nil
+		}
+		err := os.Remove(r.path)
+		r.f.Close()
+		r.f = nil
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if r.f == nil {
+		f, err := os.OpenFile(r.path, os.O_CREATE|os.O_RDWR, 0o600)
+		if err != nil {
+			return err
+		}
+		if err := lockManifest(f); err != nil {
+			f.Close()
+			return err
+		}
+		r.f = f
+	}
+	data, err := json.MarshalIndent(r.m, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if err := r.f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := r.f.WriteAt(data, 0); err != nil {
+		return err
+	}
+	return r.f.Sync()
+}
+
+// lockManifest locks an open manifest without waiting. The lock dies with
+// the test binary, which is how cleanup tells a manifest left behind from
+// one still being written.
+func lockManifest(f *os.File) error {
+	err := filelock.TryLock(f)
+	if errors.Is(err, filelock.ErrLocked) {
+		return ErrInUse
+	}
+	return err
+}
+
+// Close releases the manifest without changing it.
+func (r *Run) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+func (r *Run) log() io.Writer {
+	if r.Log != nil {
+		return r.Log
+	}
+	return os.Stderr
+}
+
+func (r *Run) terraform() string {
+	if r.Terraform != "" {
+		return r.Terraform
+	}
+	return "terraform"
+}
+
+// Owner names the test binary that wrote the manifest.
+func (m Manifest) Owner() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "pid %d", m.PID)
+	if m.Host != "" {
+		fmt.Fprintf(&b, " on %s", m.Host)
+	}
+	fmt.Fprintf(&b, ", started %s", m.Started.Format(time.RFC3339))
+	return b.String()
+}
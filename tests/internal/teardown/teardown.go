@@ -0,0 +1,204 @@
+package teardown
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// EnvReserve overrides how long before the test deadline Watch starts
+// tearing down, as a Go duration.
+const EnvReserve = "TEARDOWN_RESERVE"
+
+// DefaultReserve is the teardown reserve without TEARDOWN_RESERVE: enough
+// to destroy an EKS cluster and its VPC.
+const DefaultReserve = 15 * time.Minute
+
+// margin is kept between the end of a teardown and the test deadline, so
+// interrupted terraform processes can still write their state.
+const margin = 30 * time.Second
+
+// ErrDirGone is returned by Destroy when the fixture's working directory,
+// and so its local state, no longer exists.
+var ErrDirGone = errors.New("working directory no longer exists")
+
+// Reserve returns the teardown reserve: $TEARDOWN_RESERVE or
+// DefaultReserve.
+func Reserve() (time.Duration, error) {
+	v := os.Getenv(EnvReserve)
+	if v == "" {
+		return DefaultReserve, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", EnvReserve, err)
+	}
+	return d, nil
+}
+
+// Destroy runs terraform destroy for f with bin (terraform or tofu),
+// running init first if the directory never was. If ctx has a deadline,
+// destroy waits until then for the state lock, which a test's own apply
+// may still hold. When ctx ends terraform is interrupted, as by Ctrl-C, so
+// it stops cleanly and keeps its state.
+func Destroy(ctx context.Context, bin string, f Fixture, log io.Writer) error {
+	if _, err := os.Stat(f.Dir); errors.Is(err, fs.ErrNotExist) {
+		return ErrDirGone
+	} else if err != nil {
+		return err
+	}
+
+	varFile, err := os.CreateTemp("", "teardown-*.tfvars.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(varFile.Name())
+	vars := f.Vars
+	if vars == nil {
+		vars = map[string]interface{}{}
+	}
+	if err := json.NewEncoder(varFile).Encode(vars); err != nil {
+		varFile.Close()
+		return err
+	}
+	if err := varFile.Close(); err != nil {
+		return err
+	}
+
+	env := os.Environ()
+	for k, v := range f.Env {
+		env = append(env, k+"="+v)
+	}
+	run := func(args ...string) error {
+		cmd := exec.CommandContext(ctx, bin, append([]string{"-chdir=" + f.Dir}, args...)...)
+		cmd.Env = env
+		cmd.Stdout, cmd.Stderr = log, log
+		cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+		cmd.WaitDelay = margin
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s %s: %w", bin, args[0], err)
+		}
+		return nil
+	}
+
+	if _, err := os.Stat(filepath.Join(f.Dir, ".terraform")); errors.Is(err, fs.ErrNotExist) {
+		if err := run("init", "-input=false"); err != nil {
+			return err
+		}
+	}
+	args := []string{"destroy", "-auto-approve", "-input=false", "-var-file=" + varFile.Name()}
+	if d, ok := ctx.Deadline(); ok {
+		args = append(args, fmt.Sprintf("-lock-timeout=%ds", int(time.Until(d).Seconds())))
+	}
+	for _, vf := range f.VarFiles {
+		args = append(args, "-var-file="+vf)
+	}
+	return run(args...)
+}
+
+// Teardown destroys every recorded fixture, newest first, removing each
+// once destroyed. It carries on past failures and returns them joined.
+func (r *Run) Teardown(ctx context.Context) error {
+	fixtures := r.Manifest().Fixtures
+	var errs []error
+	for i := len(fixtures) - 1; i >= 0; i-- {
+		f := fixtures[i]
+		if ctx.Err() != nil {
+			errs = append(errs, fmt.Errorf("%s: not destroyed: %w", f, ctx.Err()))
+			continue
+		}
+		fmt.Fprintf(r.log(), "teardown: destroying %s\n", f)
+		if err := Destroy(ctx, r.terraform(), f, r.log()); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f, err))
+			continue
+		}
+		if err := r.Remove(f.ID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Watch tears the run down when the process gets SIGINT or SIGTERM and
+// then exits with status 1; a second signal exits at once. With a deadline
+// more than reserve away it also tears down once the deadline is reserve
+// away, and lets the test time out as it would have. What is not destroyed
+// in time stays in the manifest for tests/cmd/cleanup. stop ends the
+// watch.
+func (r *Run) Watch(deadline time.Time, reserve time.Duration) (stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+
+	var (
+		timer *time.Timer
+		alarm <-chan time.Time
+	)
+	if !deadline.IsZero() {
+		if left := time.Until(deadline); reserve < left {
+			timer = time.NewTimer(left - reserve)
+			alarm = timer.C
+		} else {
+			fmt.Fprintf(r.log(), "teardown: %s reserve does not fit the %s left before the test deadline; fixtures left at the deadline stay in %s\n",
+				reserve, left.Round(time.Second), r.path)
+		}
+	}
+
+	budget := func() (context.Context, context.CancelFunc) {
+		if deadline.IsZero() {
+			return context.WithCancel(context.Background())
+		}
+		return context.WithDeadline(context.Background(), deadline.Add(-margin))
+	}
+
+	go func() {
+		select {
+		case <-done:
+			return
+		case sig := <-signals:
+			ctx, cancel := budget()
+			go func() {
+				select {
+				case <-signals:
+					fmt.Fprintf(r.log(), "teardown: interrupted again; run go run ./cmd/cleanup to finish %s\n", r.path)
+					os.Exit(1)
+				case <-ctx.Done():
+				}
+			}()
+			fmt.Fprintf(r.log(), "teardown: %s, destroying %d fixture(s)\n", sig, len(r.Manifest().Fixtures))
+			if err := r.Teardown(ctx); err != nil {
+				fmt.Fprintf(r.log(), "teardown: %v\nteardown: run go run ./cmd/cleanup to finish %s\n", err, r.path)
+			}
+			cancel()
+			os.Exit(1)
+		case <-alarm:
+			ctx, cancel := budget()
+			defer cancel()
+			fmt.Fprintf(r.log(), "teardown: test deadline in %s, destroying %d fixture(s)\n",
+				time.Until(deadline).Round(time.Second), len(r.Manifest().Fixtures))
+			if err := r.Teardown(ctx); err != nil {
+				fmt.Fprintf(r.log(), "teardown: %v\nteardown: run go run ./cmd/cleanup to finish %s\n", err, r.path)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			if timer != nil {
+				timer.Stop()
+			}
+			close(done)
+		})
+	}
+}
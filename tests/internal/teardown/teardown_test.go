@@ -0,0 +1,185 @@
+package teardown_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/teardown"
+)
+
+func TestDir(t *testing.T) {
+	t.Setenv(teardown.EnvDir, "")
+	assert.Equal(t, "def", teardown.Dir("def"))
+	t.Setenv(teardown.EnvDir, "/tmp/manifests")
+	assert.Equal(t, "/tmp/manifests", teardown.Dir("def"))
+}
+
+func TestReserve(t *testing.T) {
+	t.Setenv(teardown.EnvReserve, "")
+	d, err := teardown.Reserve()
+	require.NoError(t, err)
+	assert.Equal(t, teardown.DefaultReserve, d)
+
+	t.Setenv(teardown.EnvReserve, "5m")
+	d, err = teardown.Reserve()
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, d)
+
+	t.Setenv(teardown.EnvReserve, "soon")
+	_, err = teardown.Reserve()
+	assert.Error(t, err)
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	r, err := teardown.NewRun(dir, "aws")
+	require.NoError(t, err)
+	defer r.Close()
+	assert.True(t, strings.HasPrefix(filepath.Base(r.Path()), "aws-"))
+	assert.NoFileExists(t, r.Path(), "nothing is written before a fixture is added")
+
+	a, err := r.Add(teardown.Fixture{Test: "TestA", Dir: "fixture-a", Vars: map[string]interface{}{"project": "a"}})
+	require.NoError(t, err)
+	b, err := r.Add(teardown.Fixture{Test: "TestB", Dir: "fixture-b", Tag: "TestB-1"})
+	require.NoError(t, err)
+	assert.NotEqual(t, a.ID, b.ID)
+	assert.True(t, filepath.IsAbs(a.Dir))
+	assert.False(t, a.Applied.IsZero())
+
+	var m teardown.Manifest
+	data, err := os.ReadFile(r.Path())
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &m))
+	assert.Equal(t, os.Getpid(), m.PID)
+	require.Len(t, m.Fixtures, 2)
+	assert.Equal(t, "TestB-1", m.Fixtures[1].Tag)
+
+	paths, err := teardown.List(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{r.Path()}, paths)
+
+	require.NoError(t, r.Remove(a.ID))
+	require.NoError(t, r.Remove(a.ID), "removing twice is fine")
+	assert.Len(t, r.Manifest().Fixtures, 1)
+	require.NoError(t, r.Remove(b.ID))
+	assert.NoFileExists(t, r.Path(), "the manifest goes with its last fixture")
+}
+
+func TestOpen(t *testing.T) {
+	r, err := teardown.NewRun(t.TempDir(), "azure")
+	require.NoError(t, err)
+	_, err = r.Add(teardown.Fixture{Test: "TestA", Dir: "a"})
+	require.NoError(t, err)
+	_, err = r.Add(teardown.Fixture{Test: "TestB", Dir: "b"})
+	require.NoError(t, err)
+
+	if runtime.GOOS != "windows" {
+		_, err = teardown.Open(r.Path())
+		assert.ErrorIs(t, err, teardown.ErrInUse)
+	}
+	require.NoError(t, r.Close())
+
+	o, err := teardown.Open(r.Path())
+	require.NoError(t, err)
+	defer o.Close()
+	assert.Len(t, o.Manifest().Fixtures, 2)
+	c, err := o.Add(teardown.Fixture{Test: "TestC", Dir: "c"})
+	require.NoError(t, err)
+	assert.Equal(t, 3, c.ID, "IDs carry on from the ones on disk")
+}
+
+// fakeTerraform writes a terraform stand-in that appends its arguments to
+// calls and fails destroy in directories named fail-*.
+func fakeTerraform(t *testing.T) (bin, calls string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake terraform is a shell script")
+	}
+	dir := t.TempDir()
+	calls = filepath.Join(dir, "calls")
+	bin = filepath.Join(dir, "terraform")
+	script := `#!/bin/sh
+echo "$@" >> ` + calls + `
+case "$1 $2" in
+  -chdir=*/fail-*\ destroy) exit 1 ;;
+esac
+`
+	require.NoError(t, os.WriteFile(bin, []byte(script), 0o755))
+	return bin, calls
+}
+
+func TestDestroy(t *testing.T) {
+	bin, calls := fakeTerraform(t)
+	dir := t.TempDir()
+	f := teardown.Fixture{Dir: dir, Vars: map[string]interface{}{"project": "p"}, VarFiles: []string{"extra.tfvars"}}
+
+	require.NoError(t, teardown.Destroy(context.Background(), bin, f, &bytes.Buffer{}))
+	data, err := os.ReadFile(calls)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2, "init runs where .terraform is missing")
+	assert.Equal(t, "-chdir="+dir+" init -input=false", lines[0])
+	assert.Contains(t, lines[1], "destroy -auto-approve -input=false -var-file=")
+	assert.True(t, strings.HasSuffix(lines[1], " -var-file=extra.tfvars"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	require.NoError(t, os.Remove(calls))
+	require.NoError(t, teardown.Destroy(ctx, bin, f, &bytes.Buffer{}))
+	data, err = os.ReadFile(calls)
+	require.NoError(t, err)
+	assert.Regexp(t, `destroy .* -lock-timeout=35\d\ds `, string(data),
+		"destroy waits for the state lock until the deadline")
+
+	err = teardown.Destroy(context.Background(), bin, teardown.Fixture{Dir: filepath.Join(dir, "gone")}, &bytes.Buffer{})
+	assert.ErrorIs(t, err, teardown.ErrDirGone)
+}
+
+func TestTeardown(t *testing.T) {
+	bin, calls := fakeTerraform(t)
+	root := t.TempDir()
+	for _, d := range []string{"a", "fail-b", "c"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, d, ".terraform"), 0o755))
+	}
+
+	var log bytes.Buffer
+	r, err := teardown.NewRun(t.TempDir(), "aws")
+	require.NoError(t, err)
+	defer r.Close()
+	r.Terraform, r.Log = bin, &log
+	for _, d := range []string{"a", "fail-b", "c"} {
+		_, err := r.Add(teardown.Fixture{Test: "Test" + d, Dir: filepath.Join(root, d)})
+		require.NoError(t, err)
+	}
+
+	err = r.Teardown(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "fail-b")
+
+	data, err := os.ReadFile(calls)
+	require.NoError(t, err)
+	var order []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		order = append(order, filepath.Base(strings.Fields(line)[0]))
+	}
+	assert.Equal(t, []string{"c", "fail-b", "a"}, order, "newest first, carrying on past failures")
+
+	left := r.Manifest().Fixtures
+	require.Len(t, left, 1)
+	assert.Equal(t, filepath.Join(root, "fail-b"), left[0].Dir)
+	assert.FileExists(t, r.Path())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = r.Teardown(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,183 @@
+// Package tfconfig evaluates a Terraform root module's configuration
+// offline, as far as variable defaults, tfvars files and locals allow.
+// Tools that read environments/* and examples/* share it instead of each
+// re-implementing variable and local resolution.
+package tfconfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Root is a parsed root module.
+type Root struct {
+	Dir    string
+	Bodies []*hclsyntax.Body
+	// Ctx resolves var.* from variable defaults overridden by
+	// terraform.tfvars and *.auto.tfvars, and local.* from locals that
+	// depend only on variables and other locals.
+	Ctx *hcl.EvalContext
+}
+
+// ModuleCall is a module block with a literal source.
+type ModuleCall struct {
+	Name   string
+	Source string
+	Block  *hclsyntax.Block
+}
+
+// Load parses every .tf file in dir and builds its evaluation context.
+func Load(dir string) (*Root, error) {
+	tfFiles, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	if len(tfFiles) == 0 {
+		return nil, fmt.Errorf("%s: no .tf files", dir)
+	}
+
+	r := &Root{Dir: dir}
+	for _, path := range tfFiles {
+		body, err := ParseFile(path)
+		if err != nil {
+			return nil, err
+		}
+		r.Bodies = append(r.Bodies, body)
+	}
+
+	vars := VariableDefaults(r.Bodies)
+	tfvars, _ := filepath.Glob(filepath.Join(dir, "*.auto.tfvars"))
+	tfvars = append([]string{filepath.Join(dir, "terraform.tfvars")}, tfvars...)
+	for _, path := range tfvars {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		body, err := ParseFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for name, attr := range body.Attributes {
+			if v, diags := attr.Expr.Value(nil); !diags.HasErrors() {
+				vars[name] = v
+			}
+		}
+	}
+	r.Ctx = &hcl.EvalContext{Variables: map[string]cty.Value{"var": cty.ObjectVal(vars)}}
+	r.Ctx.Variables["local"] = evalLocals(r.Bodies, r.Ctx)
+	return r, nil
+}
+
+// ParseFile parses one native-syntax HCL file.
+func ParseFile(path string) (*hclsyntax.Body, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file, diags := hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return file.Body.(*hclsyntax.Body), nil
+}
+
+// VariableDefaults returns the literal defaults of the variable blocks in
+// bodies.
+func VariableDefaults(bodies []*hclsyntax.Body) map[string]cty.Value {
+	vars := map[string]cty.Value{}
+	for _, b := range Blocks(bodies, "variable") {
+		if len(b.Labels) != 1 {
+			continue
+		}
+		if attr, ok := b.Body.Attributes["default"]; ok {
+			if v, diags := attr.Expr.Value(nil); !diags.HasErrors() {
+				vars[b.Labels[0]] = v
+			}
+		}
+	}
+	return vars
+}
+
+// Blocks returns the top-level blocks of the given type across bodies.
+func Blocks(bodies []*hclsyntax.Body, typ string) []*hclsyntax.Block {
+	var out []*hclsyntax.Block
+	for _, body := range bodies {
+		for _, b := range body.Blocks {
+			if b.Type == typ {
+				out = append(out, b)
+			}
+		}
+	}
+	return out
+}
+
+// ModuleCalls returns the module blocks whose source is a literal string.
+func (r *Root) ModuleCalls() []ModuleCall {
+	var out []ModuleCall
+	for _, b := range Blocks(r.Bodies, "module") {
+		if len(b.Labels) != 1 {
+			continue
+		}
+		src, ok := b.Body.Attributes["source"]
+		if !ok {
+			continue
+		}
+		v, diags := src.Expr.Value(nil)
+		if diags.HasErrors() || v.Type() != cty.String {
+			continue
+		}
+		out = append(out, ModuleCall{Name: b.Labels[0], Source: v.AsString(), Block: b})
+	}
+	return out
+}
+
+// SourceHasSuffix reports whether the call's source ends in suffix, e.g.
+// "aws/eks" for "../../modules/aws/eks".
+func (c ModuleCall) SourceHasSuffix(suffix string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(c.Source, "/"), suffix)
+}
+
+// Eval evaluates the call's attribute name. ok is false if the attribute
+// is absent or depends on something Ctx cannot resolve.
+func (r *Root) Eval(c ModuleCall, name string) (v cty.Value, ok bool) {
+	attr, found := c.Block.Body.Attributes[name]
+	if !found {
+		return cty.NilVal, false
+	}
+	v, diags := attr.Expr.Value(r.Ctx)
+	if diags.HasErrors() || !v.IsWhollyKnown() {
+		return cty.NilVal, false
+	}
+	return v, true
+}
+
+// evalLocals evaluates locals that depend only on variables and other
+// locals, in as many passes as it takes to stop making progress.
+func evalLocals(bodies []*hclsyntax.Body, ctx *hcl.EvalContext) cty.Value {
+	exprs := map[string]hcl.Expression{}
+	for _, b := range Blocks(bodies, "locals") {
+		for name, attr := range b.Body.Attributes {
+			exprs[name] = attr.Expr
+		}
+	}
+	locals := map[string]cty.Value{}
+	for progress := true; progress; {
+		progress = false
+		ctx.Variables["local"] = cty.ObjectVal(locals)
+		for name, expr := range exprs {
+			if _, done := locals[name]; done {
+				continue
+			}
+			if v, diags := expr.Value(ctx); !diags.HasErrors() && v.IsWhollyKnown() {
+				locals[name] = v
+				progress = true
+			}
+		}
+	}
+	return cty.ObjectVal(locals)
+}
@@ -0,0 +1,47 @@
+package tfstate
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// AuditRecord is one released lock in the audit log.
+type AuditRecord struct {
+	Time       time.Time `json:"time"`
+	Table      string    `json:"table"`
+	LockID     string    `json:"lock_id"`
+	Lock       LockInfo  `json:"lock"`
+	Reason     string    `json:"reason"`
+	RunURL     string    `json:"run_url,omitempty"`
+	ReleasedBy string    `json:"released_by"`
+	// Result is released, or the error that kept the lock.
+	Result string `json:"result"`
+}
+
+// AppendAudit adds records to the JSONL audit log at path, creating it if
+// needed.
+func AppendAudit(path string, recs ...AuditRecord) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, r := range recs {
+		if err := enc.Encode(r); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
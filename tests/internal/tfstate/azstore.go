@@ -0,0 +1,354 @@
+package tfstate
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Azurite's well-known development account. EnvAzuriteEndpoint holds its
+// blob endpoint, e.g. http://127.0.0.1:10000/devstoreaccount1.
+const (
+	EnvAzuriteEndpoint = "AZURITE_BLOB_ENDPOINT"
+	AzuriteAccount     = "devstoreaccount1"
+	AzuriteKey         = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+)
+
+// lockMetaKey is the blob metadata key the azurerm backend stores the
+// base64 JSON lock info under while it holds the lease.
+const lockMetaKey = "terraformlockid"
+
+const azureAPIVersion = "2020-10-02"
+
+// AzureBlob is a minimal Blob service client authenticated with a storage
+// account key.
+type AzureBlob struct {
+	Account string
+	// Key is the base64 account key.
+	Key string
+	// Endpoint defaults to https://<account>.blob.core.windows.net.
+	Endpoint string
+	Client   *http.Client
+}
+
+// AzureError is an unexpected Blob service response.
+type AzureError struct {
+	Status int
+	Code   string
+	Op     string
+}
+
+func (e *AzureError) Error() string {
+	return fmt.Sprintf("%s: %d %s", e.Op, e.Status, e.Code)
+}
+
+func (c AzureBlob) url(path string, query url.Values) (*url.URL, error) {
+	base := c.Endpoint
+	if base == "" {
+		base = "https://" + c.Account + ".blob.core.windows.net"
+	}
+	u, err := url.Parse(strings.TrimSuffix(base, "/"))
+	if err != nil {
+		return nil, err
+	}
+	u.Path += "/" + path
+	u.RawQuery = query.Encode()
+	return u, nil
+}
+
+// do sends a request signed with the account key. Statuses in ok are
+// returned; any other is an *AzureError.
+func (c AzureBlob) do(ctx context.Context, op, method, path string, query url.Values, header http.Header, body []byte, ok ...int) (*http.Response, []byte, error) {
+	u, err := c.url(path, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azureAPIVersion)
+	req.ContentLength = int64(len(body))
+	if err := c.sign(req, u); err != nil {
+		return nil, nil, err
+	}
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+	for _, s := range ok {
+		if res.StatusCode == s {
+			return res, data, nil
+		}
+	}
+	return res, data, &AzureError{Status: res.StatusCode, Code: res.Header.Get("x-ms-error-code"), Op: op}
+}
+
+// sign adds the SharedKey Authorization header.
+func (c AzureBlob) sign(req *http.Request, u *url.URL) error {
+	key, err := base64.StdEncoding.DecodeString(c.Key)
+	if err != nil {
+		return fmt.Errorf("account key: %w", err)
+	}
+	length := ""
+	if req.ContentLength > 0 {
+		length = strconv.FormatInt(req.ContentLength, 10)
+	}
+	msHeaders := map[string]string{}
+	var names []string
+	for name, vs := range req.Header {
+		if l := strings.ToLower(name); strings.HasPrefix(l, "x-ms-") {
+			msHeaders[l] = strings.TrimSpace(strings.Join(vs, ","))
+			names = append(names, l)
+		}
+	}
+	sort.Strings(names)
+	var canon strings.Builder
+	for _, n := range names {
+		canon.WriteString(n + ":" + msHeaders[n] + "\n")
+	}
+	canon.WriteString("/" + c.Account + u.EscapedPath())
+	q := u.Query()
+	var params []string
+	for p := range q {
+		params = append(params, p)
+	}
+	sort.Strings(params)
+	for _, p := range params {
+		vs := q[p]
+		sort.Strings(vs)
+		canon.WriteString("\n" + strings.ToLower(p) + ":" + strings.Join(vs, ","))
+	}
+
+	toSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		length,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date; x-ms-date is used instead
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		canon.String(),
+	}, "\n")
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(toSign))
+	req.Header.Set("Authorization", "SharedKey "+c.Account+":"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	return nil
+}
+
+// CreateContainer creates a private container. An existing one is not an
+// error.
+func (c AzureBlob) CreateContainer(ctx context.Context, name string) error {
+	_, _, err := c.do(ctx, "creating container "+name, http.MethodPut, name,
+		url.Values{"restype": {"container"}}, nil, nil, http.StatusCreated, http.StatusConflict)
+	return err
+}
+
+// AzureStore is the state of an azurerm backend: one blob in a container.
+// It locks the state as the backend does, with an infinite lease on the
+// blob and the lock info in its metadata.
+type AzureStore struct {
+	Blob      AzureBlob
+	Container string
+	Key       string
+
+	leaseID string
+}
+
+func (s *AzureStore) String() string {
+	return "azurerm://" + s.Blob.Account + "/" + s.Container + "/" + s.Key
+}
+
+func (s *AzureStore) path() string { return s.Container + "/" + s.Key }
+
+func (s *AzureStore) leaseHeader() http.Header {
+	h := http.Header{}
+	if s.leaseID != "" {
+		h.Set("x-ms-lease-id", s.leaseID)
+	}
+	return h
+}
+
+// metadata returns the blob's metadata, or nil if the blob is missing.
+func (s *AzureStore) metadata(ctx context.Context) (map[string]string, error) {
+	res, _, err := s.Blob.do(ctx, "reading "+s.String(), http.MethodHead, s.path(), nil, nil, nil, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	meta := map[string]string{}
+	for name := range res.Header {
+		if l := strings.ToLower(name); strings.HasPrefix(l, "x-ms-meta-") {
+			meta[strings.TrimPrefix(l, "x-ms-meta-")] = res.Header.Get(name)
+		}
+	}
+	return meta, nil
+}
+
+func (s *AzureStore) setMetadata(ctx context.Context, meta map[string]string) error {
+	h := s.leaseHeader()
+	for k, v := range meta {
+		h.Set("x-ms-meta-"+k, v)
+	}
+	_, _, err := s.Blob.do(ctx, "writing metadata of "+s.String(), http.MethodPut, s.path(),
+		url.Values{"comp": {"metadata"}}, h, nil, http.StatusOK)
+	return err
+}
+
+// Lock leases the blob with info.ID as the lease ID, creating an empty
+// blob first if needed, and records info in its metadata.
+func (s *AzureStore) Lock(ctx context.Context, info LockInfo) error {
+	meta, err := s.metadata(ctx)
+	if err != nil {
+		return err
+	}
+	if meta == nil {
+		h := http.Header{}
+		h.Set("x-ms-blob-type", "BlockBlob")
+		if _, _, err := s.Blob.do(ctx, "creating "+s.String(), http.MethodPut, s.path(), nil, h, nil, http.StatusCreated); err != nil {
+			return err
+		}
+		meta = map[string]string{}
+	}
+
+	h := http.Header{}
+	h.Set("x-ms-lease-action", "acquire")
+	h.Set("x-ms-lease-duration", "-1")
+	h.Set("x-ms-proposed-lease-id", info.ID)
+	res, _, err := s.Blob.do(ctx, "leasing "+s.String(), http.MethodPut, s.path(),
+		url.Values{"comp": {"lease"}}, h, nil, http.StatusCreated, http.StatusConflict)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode == http.StatusConflict {
+		lerr := &LockedError{Store: s.String()}
+		if meta, err := s.metadata(ctx); err == nil {
+			lerr.Lock = decodeAzureLock(meta[lockMetaKey])
+		}
+		return lerr
+	}
+	s.leaseID = info.ID
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	meta[lockMetaKey] = base64.StdEncoding.EncodeToString(data)
+	if err := s.setMetadata(ctx, meta); err != nil {
+		s.releaseLease(ctx) //nolint:errcheck
+		return err
+	}
+	return nil
+}
+
+func decodeAzureLock(v string) *LockInfo {
+	data, err := base64.StdEncoding.DecodeString(v)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	var l LockInfo
+	if json.Unmarshal(data, &l) != nil {
+		return nil
+	}
+	return &l
+}
+
+// Unlock clears the lock info and releases the lease taken with id. A
+// blob deleted while locked has no lease left to release.
+func (s *AzureStore) Unlock(ctx context.Context, id string) error {
+	if s.leaseID != id {
+		return fmt.Errorf("unlocking %s: lock %s is not held", s, id)
+	}
+	meta, err := s.metadata(ctx)
+	if err != nil {
+		return err
+	}
+	if meta == nil {
+		s.leaseID = ""
+		return nil
+	}
+	delete(meta, lockMetaKey)
+	if err := s.setMetadata(ctx, meta); err != nil {
+		return err
+	}
+	return s.releaseLease(ctx)
+}
+
+func (s *AzureStore) releaseLease(ctx context.Context) error {
+	h := http.Header{}
+	h.Set("x-ms-lease-action", "release")
+	h.Set("x-ms-lease-id", s.leaseID)
+	_, _, err := s.Blob.do(ctx, "releasing lease on "+s.String(), http.MethodPut, s.path(),
+		url.Values{"comp": {"lease"}}, h, nil, http.StatusOK)
+	if err == nil {
+		s.leaseID = ""
+	}
+	return err
+}
+
+// Get returns the blob, or nil if it is missing or empty.
+func (s *AzureStore) Get(ctx context.Context) ([]byte, error) {
+	res, data, err := s.Blob.do(ctx, "reading "+s.String(), http.MethodGet, s.path(), nil, nil, nil, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound || len(data) == 0 {
+		return nil, nil
+	}
+	return data, nil
+}
+
+// Put writes the blob under the lease, keeping its metadata and so the
+// lock info.
+func (s *AzureStore) Put(ctx context.Context, data []byte) error {
+	meta, err := s.metadata(ctx)
+	if err != nil {
+		return err
+	}
+	h := s.leaseHeader()
+	h.Set("x-ms-blob-type", "BlockBlob")
+	h.Set("Content-Type", "application/json")
+	for k, v := range meta {
+		h.Set("x-ms-meta-"+k, v)
+	}
+	_, _, err = s.Blob.do(ctx, "writing "+s.String(), http.MethodPut, s.path(), nil, h, data, http.StatusCreated)
+	return err
+}
+
+// Delete removes the blob under the lease.
+func (s *AzureStore) Delete(ctx context.Context) error {
+	_, _, err := s.Blob.do(ctx, "deleting "+s.String(), http.MethodDelete, s.path(), nil, s.leaseHeader(), nil, http.StatusAccepted, http.StatusNotFound)
+	return err
+}
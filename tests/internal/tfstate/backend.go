@@ -0,0 +1,110 @@
+package tfstate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BackendFile is the file WriteBackend adds to a configuration.
+const BackendFile = "backend.tf"
+
+// Backend is a backend configuration WriteBackend can render.
+type Backend interface {
+	// Type is the backend label, e.g. s3.
+	Type() string
+	// HCL renders the terraform block that configures the backend.
+	HCL() string
+}
+
+// S3Backend is an S3 backend with DynamoDB locking, as environments/*
+// configure it.
+type S3Backend struct {
+	Bucket    string
+	Key       string
+	Region    string
+	LockTable string
+	// KMSKeyID is the key state objects are encrypted with. Empty uses the
+	// bucket's default encryption.
+	KMSKeyID string
+	// Endpoint, when set, sends S3, DynamoDB and STS calls to LocalStack
+	// with its static credentials.
+	Endpoint string
+}
+
+// Type returns s3.
+func (S3Backend) Type() string { return "s3" }
+
+// LockID returns the DynamoDB LockID of the lock Terraform takes on the
+// state.
+func (b S3Backend) LockID() string {
+	return b.Bucket + "/" + b.Key
+}
+
+// DigestID returns the DynamoDB LockID of the item holding the MD5 digest
+// of the state, which Terraform checks on every read.
+func (b S3Backend) DigestID() string {
+	return b.LockID() + "-md5"
+}
+
+// HCL renders the terraform block that configures the backend. The
+// endpoints syntax needs Terraform 1.6 or later.
+func (b S3Backend) HCL() string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "terraform {\n  backend \"s3\" {\n")
+	fmt.Fprintf(&s, "    bucket         = %q\n", b.Bucket)
+	fmt.Fprintf(&s, "    key            = %q\n", b.Key)
+	fmt.Fprintf(&s, "    region         = %q\n", b.Region)
+	fmt.Fprintf(&s, "    dynamodb_table = %q\n", b.LockTable)
+	fmt.Fprintf(&s, "    encrypt        = true\n")
+	if b.KMSKeyID != "" {
+		fmt.Fprintf(&s, "    kms_key_id     = %q\n", b.KMSKeyID)
+	}
+	if b.Endpoint != "" {
+		fmt.Fprintf(&s, "\n")
+		fmt.Fprintf(&s, "    access_key                  = \"test\"\n")
+		fmt.Fprintf(&s, "    secret_key                  = \"test\"\n")
+		fmt.Fprintf(&s, "    use_path_style              = true\n")
+		fmt.Fprintf(&s, "    skip_credentials_validation = true\n")
+		fmt.Fprintf(&s, "    skip_metadata_api_check     = true\n")
+		fmt.Fprintf(&s, "    skip_requesting_account_id  = true\n\n")
+		fmt.Fprintf(&s, "    endpoints = {\n")
+		for _, svc := range []string{"dynamodb", "s3", "sts"} {
+			fmt.Fprintf(&s, "      %-8s = %q\n", svc, b.Endpoint)
+		}
+		fmt.Fprintf(&s, "    }\n")
+	}
+	fmt.Fprintf(&s, "  }\n}\n")
+	return s.String()
+}
+
+// AzureBackend is an azurerm backend in a storage account container, as
+// bootstrap/azure creates it. Blob leases lock the state.
+type AzureBackend struct {
+	ResourceGroup  string
+	StorageAccount string
+	Container      string
+	Key            string
+}
+
+// Type returns azurerm.
+func (AzureBackend) Type() string { return "azurerm" }
+
+// HCL renders the terraform block that configures the backend.
+func (b AzureBackend) HCL() string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "terraform {\n  backend \"azurerm\" {\n")
+	fmt.Fprintf(&s, "    resource_group_name  = %q\n", b.ResourceGroup)
+	fmt.Fprintf(&s, "    storage_account_name = %q\n", b.StorageAccount)
+	fmt.Fprintf(&s, "    container_name       = %q\n", b.Container)
+	fmt.Fprintf(&s, "    key                  = %q\n", b.Key)
+	fmt.Fprintf(&s, "  }\n}\n")
+	return s.String()
+}
+
+// WriteBackend writes the backend block into dir, which must not declare
+// a backend of its own.
+func WriteBackend(dir string, b Backend) error {
+	return os.WriteFile(filepath.Join(dir, BackendFile), []byte(b.HCL()), 0o644)
+}
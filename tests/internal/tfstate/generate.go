@@ -0,0 +1,190 @@
+package tfstate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// GeneratedHeader starts every backend file PlanBackend writes.
+const GeneratedHeader = "# Generated by tests/cmd/bootstrap from the bootstrap outputs. Re-run it\n# rather than editing this file.\n\n"
+
+// S3BackendFromOutputs builds the backend of the bootstrap/ outputs. Key
+// is left for the caller to set per environment.
+func S3BackendFromOutputs(outputs map[string]interface{}) (S3Backend, error) {
+	var b S3Backend
+	var err error
+	get := func(name string, required bool) string {
+		v, _ := outputs[name].(string)
+		if v == "" && required && err == nil {
+			err = fmt.Errorf("bootstrap output %s is missing or unknown", name)
+		}
+		return v
+	}
+	b.Bucket = get("state_bucket_name", true)
+	b.Region = get("region", true)
+	b.LockTable = get("lock_table_name", true)
+	b.KMSKeyID = get("kms_key_arn", false)
+	return b, err
+}
+
+// AzureBackendFromOutputs builds the backend of the bootstrap/azure
+// outputs. Key is left for the caller to set per environment.
+func AzureBackendFromOutputs(outputs map[string]interface{}) (AzureBackend, error) {
+	var b AzureBackend
+	for _, o := range []struct {
+		name string
+		dst  *string
+	}{
+		{"resource_group_name", &b.ResourceGroup},
+		{"storage_account_name", &b.StorageAccount},
+		{"container_name", &b.Container},
+	} {
+		v, _ := outputs[o.name].(string)
+		if v == "" {
+			return b, fmt.Errorf("bootstrap output %s is missing or unknown", o.name)
+		}
+		*o.dst = v
+	}
+	return b, nil
+}
+
+// FileChange is the old and new content of one file. Old is nil for a
+// file that does not exist yet.
+type FileChange struct {
+	Path string
+	Old  []byte
+	New  []byte
+}
+
+// Changed reports whether writing the change would modify the file.
+func (c FileChange) Changed() bool {
+	return c.Old == nil || !bytes.Equal(c.Old, c.New)
+}
+
+// Diff returns a unified diff of the change, or "" if there is none.
+func (c FileChange) Diff() string {
+	if !c.Changed() {
+		return ""
+	}
+	from := c.Path
+	if c.Old == nil {
+		from = "/dev/null"
+	}
+	d, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        lines(c.Old),
+		B:        lines(c.New),
+		FromFile: from,
+		ToFile:   c.Path,
+		Context:  3,
+	})
+	return d
+}
+
+func lines(b []byte) []string {
+	if len(b) == 0 {
+		return nil
+	}
+	l := strings.SplitAfter(string(b), "\n")
+	if l[len(l)-1] == "" {
+		l = l[:len(l)-1]
+	}
+	return l
+}
+
+// Write writes the new content if it changed.
+func (c FileChange) Write() error {
+	if !c.Changed() {
+		return nil
+	}
+	return os.WriteFile(c.Path, c.New, 0o644)
+}
+
+// PlanBackend returns the changes that make b the backend of the root
+// module in dir: BackendFile holds b, and empty placeholder blocks of the
+// same backend type, such as `backend "s3" {}` left for -backend-config,
+// are removed from the other files. A non-empty backend block elsewhere
+// is an error, since it would conflict with BackendFile. Running it again
+// after writing the changes returns no changed files.
+func PlanBackend(dir string, b Backend) ([]FileChange, error) {
+	path := filepath.Join(dir, BackendFile)
+	old, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	changes := []FileChange{{Path: path, Old: old, New: []byte(GeneratedHeader + b.HCL())}}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		if filepath.Base(f) == BackendFile {
+			continue
+		}
+		src, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		out, err := removePlaceholderBackend(f, src, b.Type())
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(src, out) {
+			changes = append(changes, FileChange{Path: f, Old: src, New: out})
+		}
+	}
+	return changes, nil
+}
+
+// removePlaceholderBackend cuts empty backend blocks of type typ out of
+// src, together with a blank line before them.
+func removePlaceholderBackend(path string, src []byte, typ string) ([]byte, error) {
+	f, diags := hclsyntax.ParseConfig(src, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	var cuts []hcl.Range
+	for _, tf := range f.Body.(*hclsyntax.Body).Blocks {
+		if tf.Type != "terraform" {
+			continue
+		}
+		for _, be := range tf.Body.Blocks {
+			if be.Type != "backend" {
+				continue
+			}
+			label := ""
+			if len(be.Labels) > 0 {
+				label = be.Labels[0]
+			}
+			if label != typ || len(be.Body.Attributes) > 0 || len(be.Body.Blocks) > 0 {
+				return nil, fmt.Errorf("%s: already configures a %q backend; remove it so %s is the only one", path, label, BackendFile)
+			}
+			cuts = append(cuts, be.Range())
+		}
+	}
+
+	out := src
+	for i := len(cuts) - 1; i >= 0; i-- {
+		start := bytes.LastIndexByte(out[:cuts[i].Start.Byte], '\n') + 1
+		end := cuts[i].End.Byte
+		if nl := bytes.IndexByte(out[end:], '\n'); nl >= 0 {
+			end += nl + 1
+		}
+		if start >= 2 && out[start-1] == '\n' && out[start-2] == '\n' {
+			start--
+		}
+		out = append(append([]byte{}, out[:start]...), out[end:]...)
+	}
+	return out, nil
+}
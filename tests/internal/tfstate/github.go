@@ -0,0 +1,155 @@
+package tfstate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// GitHubRuns looks up workflow runs with the GitHub Actions REST API.
+type GitHubRuns struct {
+	// Repo is owner/name.
+	Repo  string
+	Token string
+	// Workflows limits the lookup to these workflow files, e.g.
+	// terraform-apply.yml. Empty means every workflow in Repo, so a lock
+	// is kept while any run that overlaps it is executing.
+	Workflows []string
+	// BaseURL defaults to https://api.github.com.
+	BaseURL string
+	Client  *http.Client
+}
+
+type githubRun struct {
+	ID         int64     `json:"id"`
+	Path       string    `json:"path"`
+	Status     string    `json:"status"`
+	Conclusion string    `json:"conclusion"`
+	HTMLURL    string    `json:"html_url"`
+	Started    time.Time `json:"run_started_at"`
+	Updated    time.Time `json:"updated_at"`
+}
+
+// RunFor returns the run that was executing when l was created. If runs
+// overlap it, an active one wins over the last to complete.
+func (g GitHubRuns) RunFor(ctx context.Context, l LockInfo) (*Run, error) {
+	lists := []string{"actions/runs"}
+	if len(g.Workflows) > 0 {
+		lists = lists[:0]
+		for _, w := range g.Workflows {
+			lists = append(lists, "actions/workflows/"+url.PathEscape(w)+"/runs")
+		}
+	}
+
+	var best *Run
+	for _, list := range lists {
+		runs, err := g.runs(ctx, list, l.Created)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range runs {
+			if r.Started.After(l.Created) || (r.Status == "completed" && r.Updated.Before(l.Created)) {
+				continue
+			}
+			run := &Run{
+				ID:         r.ID,
+				Workflow:   r.Path,
+				Status:     r.Status,
+				Conclusion: r.Conclusion,
+				URL:        r.HTMLURL,
+				Started:    r.Started,
+				Updated:    r.Updated,
+			}
+			switch {
+			case best == nil,
+				run.Active() && !best.Active(),
+				run.Active() == best.Active() && run.Updated.After(best.Updated):
+				best = run
+			}
+		}
+	}
+	return best, nil
+}
+
+// runs returns the runs in list created no later than before, newest
+// first. GitHub pages them 100 at a time; runs follows the pages until it
+// reaches a run that had already completed at before, since the runs
+// created ahead of it are unlikely to still be executing then.
+func (g GitHubRuns) runs(ctx context.Context, list string, before time.Time) ([]githubRun, error) {
+	base := g.BaseURL
+	if base == "" {
+		base = "https://api.github.com"
+	}
+	q := url.Values{
+		"created":  {"<=" + before.UTC().Format(time.RFC3339)},
+		"per_page": {"100"},
+	}
+	next := strings.TrimSuffix(base, "/") + "/repos/" + g.Repo + "/" + list + "?" + q.Encode()
+
+	var out []githubRun
+	for next != "" {
+		page, link, err := g.get(ctx, list, next)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, page...)
+		if len(page) == 0 {
+			break
+		}
+		if last := page[len(page)-1]; last.Status == "completed" && last.Updated.Before(before) {
+			break
+		}
+		next = nextLink(link)
+	}
+	return out, nil
+}
+
+// get fetches one page of runs and returns it with the Link header.
+func (g GitHubRuns) get(ctx context.Context, list, u string) ([]githubRun, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+	client := g.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return nil, "", fmt.Errorf("GET %s: %s: %s", list, res.Status, strings.TrimSpace(string(body)))
+	}
+	var page struct {
+		WorkflowRuns []githubRun `json:"workflow_runs"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&page); err != nil {
+		return nil, "", fmt.Errorf("GET %s: %w", list, err)
+	}
+	return page.WorkflowRuns, res.Header.Get("Link"), nil
+}
+
+// nextLink returns the rel="next" URL of a GitHub Link header, or "".
+func nextLink(header string) string {
+	for _, part := range strings.Split(header, ",") {
+		target, params, ok := strings.Cut(part, ";")
+		if !ok || !strings.Contains(params, `rel="next"`) {
+			continue
+		}
+		return strings.Trim(strings.TrimSpace(target), "<>")
+	}
+	return ""
+}
@@ -0,0 +1,45 @@
+// Package tfstate describes the repo's remote state layout: S3 state keys
+// of the form <environment>/<component>/terraform.tfstate, the backend
+// block that points a configuration at them, and the DynamoDB items
+// Terraform uses to lock them.
+package tfstate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Environments are the environments a state key may start with.
+var Environments = []string{"dev", "staging", "prod"}
+
+// StateFile is the object name at the end of every state key.
+const StateFile = "terraform.tfstate"
+
+var componentRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// Key returns the state key for a component of an environment, e.g.
+// dev/platform/terraform.tfstate.
+func Key(environment, component string) string {
+	return environment + "/" + component + "/" + StateFile
+}
+
+// ParseKey splits a state key into its environment and component. It
+// rejects keys that do not follow <environment>/<component>/terraform.tfstate.
+func ParseKey(key string) (environment, component string, err error) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 3 || parts[2] != StateFile {
+		return "", "", fmt.Errorf("state key %q: want <environment>/<component>/%s", key, StateFile)
+	}
+	known := false
+	for _, e := range Environments {
+		known = known || parts[0] == e
+	}
+	if !known {
+		return "", "", fmt.Errorf("state key %q: environment %q is not one of %s", key, parts[0], strings.Join(Environments, ", "))
+	}
+	if !componentRe.MatchString(parts[1]) {
+		return "", "", fmt.Errorf("state key %q: component %q must be lower-case letters, digits and hyphens", key, parts[1])
+	}
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,81 @@
+package tfstate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// DynamoDBAPI is the subset of the DynamoDB API the lock helpers use.
+// *dynamodb.DynamoDB satisfies it.
+type DynamoDBAPI interface {
+	GetItemWithContext(aws.Context, *dynamodb.GetItemInput, ...request.Option) (*dynamodb.GetItemOutput, error)
+	ScanPagesWithContext(aws.Context, *dynamodb.ScanInput, func(*dynamodb.ScanOutput, bool) bool, ...request.Option) error
+	DeleteItemWithContext(aws.Context, *dynamodb.DeleteItemInput, ...request.Option) (*dynamodb.DeleteItemOutput, error)
+	PutItemWithContext(aws.Context, *dynamodb.PutItemInput, ...request.Option) (*dynamodb.PutItemOutput, error)
+}
+
+// LockInfo is the lock record Terraform stores in the Info attribute of
+// the lock item while an operation holds the state.
+type LockInfo struct {
+	ID        string    `json:"ID"`
+	Operation string    `json:"Operation"`
+	Info      string    `json:"Info"`
+	Who       string    `json:"Who"`
+	Version   string    `json:"Version"`
+	Created   time.Time `json:"Created"`
+	Path      string    `json:"Path"`
+}
+
+// GetLock returns the lock held on b's state, or nil if it is unlocked.
+func GetLock(ctx context.Context, client DynamoDBAPI, b S3Backend) (*LockInfo, error) {
+	_, l, err := getLockItem(ctx, client, b)
+	return l, err
+}
+
+// getLockItem returns the lock on b's state and its Info attribute as
+// stored.
+func getLockItem(ctx context.Context, client DynamoDBAPI, b S3Backend) (string, *LockInfo, error) {
+	out, err := client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(b.LockTable),
+		Key:            map[string]*dynamodb.AttributeValue{"LockID": {S: aws.String(b.LockID())}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("reading lock %s: %w", b.LockID(), err)
+	}
+	if out.Item == nil {
+		return "", nil, nil
+	}
+	info := out.Item["Info"]
+	if info == nil || info.S == nil {
+		return "", nil, fmt.Errorf("lock %s has no Info attribute", b.LockID())
+	}
+	raw := aws.StringValue(info.S)
+	var l LockInfo
+	if err := json.Unmarshal([]byte(raw), &l); err != nil {
+		return "", nil, fmt.Errorf("parsing lock %s: %w", b.LockID(), err)
+	}
+	return raw, &l, nil
+}
+
+// WaitForLock polls until b's state is locked and returns the lock, or
+// fails when ctx is done.
+func WaitForLock(ctx context.Context, client DynamoDBAPI, b S3Backend, interval time.Duration) (*LockInfo, error) {
+	for {
+		l, err := GetLock(ctx, client, b)
+		if err != nil || l != nil {
+			return l, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for lock %s: %w", b.LockID(), ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package tfstate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// MigrateOperation is the Operation of the locks Migrate takes.
+const MigrateOperation = "OperationTypeMigrate"
+
+// MigrateOptions tune Migrate.
+type MigrateOptions struct {
+	// BackupDir receives a copy of the source state, and of any state the
+	// destination already holds, before anything is written.
+	BackupDir string
+	// DeleteSource removes the source state once the copy is verified.
+	DeleteSource bool
+	// Force overwrites destination state of another lineage or with a
+	// serial not older than the source's, as terraform state push -force.
+	Force bool
+}
+
+// MigrateResult describes a finished migration.
+type MigrateResult struct {
+	Source      string   `json:"source"`
+	Destination string   `json:"destination"`
+	Lineage     string   `json:"lineage"`
+	Serial      uint64   `json:"serial"`
+	Resources   int      `json:"resources"`
+	Instances   int      `json:"instances"`
+	Backups     []string `json:"backups"`
+	// Unchanged is set when the destination already held the same state.
+	Unchanged     bool `json:"unchanged"`
+	SourceDeleted bool `json:"source_deleted"`
+}
+
+// Migrate copies the state in src to dst while holding both locks. The
+// source is backed up first. The destination is refused if it holds state
+// of another lineage or a serial at least the source's, unless
+// opts.Force is set. The copy is read back and its lineage, serial and
+// resource and instance counts compared with the source before the source
+// is optionally deleted. Both locks are always released.
+func Migrate(ctx context.Context, src, dst Store, opts MigrateOptions) (res *MigrateResult, err error) {
+	if src.String() == dst.String() {
+		return nil, fmt.Errorf("source and destination are both %s", src)
+	}
+	res = &MigrateResult{Source: src.String(), Destination: dst.String()}
+	desc := "migrating " + src.String() + " to " + dst.String()
+
+	for _, s := range []Store{src, dst} {
+		info := NewLockInfo(MigrateOperation, desc, s.String())
+		if err := s.Lock(ctx, info); err != nil {
+			return nil, err
+		}
+		s := s
+		defer func() {
+			if uerr := s.Unlock(context.WithoutCancel(ctx), info.ID); uerr != nil {
+				err = errors.Join(err, uerr)
+			}
+		}()
+	}
+
+	data, err := src.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("%s has no state", src)
+	}
+	snap, err := ParseSnapshot(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", src, err)
+	}
+	res.Lineage, res.Serial = snap.Lineage, snap.Serial
+	res.Resources, res.Instances = snap.Counts()
+
+	backup, err := writeBackup(opts.BackupDir, src, data)
+	if err != nil {
+		return nil, err
+	}
+	res.Backups = append(res.Backups, backup)
+
+	existing, err := dst.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(existing, data) {
+		res.Unchanged = true
+	} else {
+		if existing != nil {
+			if err := checkDestination(dst, existing, snap, opts.Force); err != nil {
+				return nil, err
+			}
+			backup, err := writeBackup(opts.BackupDir, dst, existing)
+			if err != nil {
+				return nil, err
+			}
+			res.Backups = append(res.Backups, backup)
+		}
+		if err := dst.Put(ctx, data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := verify(ctx, dst, snap); err != nil {
+		return nil, err
+	}
+	if opts.DeleteSource {
+		if err := src.Delete(ctx); err != nil {
+			return nil, err
+		}
+		res.SourceDeleted = true
+	}
+	return res, nil
+}
+
+func checkDestination(dst Store, existing []byte, src *Snapshot, force bool) error {
+	if force {
+		return nil
+	}
+	have, err := ParseSnapshot(existing)
+	if err != nil {
+		return fmt.Errorf("%s holds state that cannot be checked (%v); use force to overwrite it", dst, err)
+	}
+	if have.Lineage != src.Lineage {
+		return fmt.Errorf("%s holds state of lineage %s, not %s; use force to overwrite it", dst, have.Lineage, src.Lineage)
+	}
+	if have.Serial >= src.Serial {
+		return fmt.Errorf("%s holds serial %d, not older than the source's %d; use force to overwrite it", dst, have.Serial, src.Serial)
+	}
+	return nil
+}
+
+// verify reads dst back and compares it with the source snapshot.
+func verify(ctx context.Context, dst Store, want *Snapshot) error {
+	data, err := dst.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("verifying %s: %w", dst, err)
+	}
+	if data == nil {
+		return fmt.Errorf("verifying %s: no state after writing it", dst)
+	}
+	got, err := ParseSnapshot(data)
+	if err != nil {
+		return fmt.Errorf("verifying %s: %w", dst, err)
+	}
+	if got.Lineage != want.Lineage || got.Serial != want.Serial {
+		return fmt.Errorf("verifying %s: lineage %s serial %d, want %s serial %d", dst, got.Lineage, got.Serial, want.Lineage, want.Serial)
+	}
+	gr, gi := got.Counts()
+	wr, wi := want.Counts()
+	if gr != wr || gi != wi {
+		return fmt.Errorf("verifying %s: %d resources with %d instances, want %d with %d", dst, gr, gi, wr, wi)
+	}
+	return nil
+}
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// writeBackup saves data under dir, named after the store, the serial
+// where known and the time.
+func writeBackup(dir string, s Store, data []byte) (string, error) {
+	if dir == "" {
+		return "", errors.New("no backup directory")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	name := unsafeName.ReplaceAllString(s.String(), "_")
+	if snap, err := ParseSnapshot(data); err == nil {
+		name += fmt.Sprintf(".serial-%d", snap.Serial)
+	}
+	path := filepath.Join(dir, name+"."+time.Now().UTC().Format("20060102T150405.000000000Z")+".tfstate")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
@@ -0,0 +1,180 @@
+package tfstate
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" //nolint:gosec // Terraform's state digest is MD5
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// S3API is the subset of the S3 API S3Store uses. *s3.S3 satisfies it.
+type S3API interface {
+	GetObjectWithContext(aws.Context, *s3.GetObjectInput, ...request.Option) (*s3.GetObjectOutput, error)
+	PutObjectWithContext(aws.Context, *s3.PutObjectInput, ...request.Option) (*s3.PutObjectOutput, error)
+	DeleteObjectWithContext(aws.Context, *s3.DeleteObjectInput, ...request.Option) (*s3.DeleteObjectOutput, error)
+}
+
+// S3Store is the state of an S3 backend. With a LockTable it locks the
+// state and keeps its digest item current, as the backend does.
+type S3Store struct {
+	S3       S3API
+	DynamoDB DynamoDBAPI
+	Backend  S3Backend
+}
+
+func (s *S3Store) String() string { return "s3://" + s.Backend.Bucket + "/" + s.Backend.Key }
+
+func (s *S3Store) locking() bool { return s.Backend.LockTable != "" }
+
+// Lock puts the lock item, failing if one exists. Without a lock table it
+// does nothing, like the backend.
+func (s *S3Store) Lock(ctx context.Context, info LockInfo) error {
+	if !s.locking() {
+		return nil
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	_, err = s.DynamoDB.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.Backend.LockTable),
+		Item: map[string]*dynamodb.AttributeValue{
+			"LockID": {S: aws.String(s.Backend.LockID())},
+			"Info":   {S: aws.String(string(data))},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(LockID)"),
+	})
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		held, _ := GetLock(ctx, s.DynamoDB, s.Backend)
+		return &LockedError{Store: s.String(), Lock: held}
+	}
+	if err != nil {
+		return fmt.Errorf("locking %s: %w", s, err)
+	}
+	return nil
+}
+
+// Unlock deletes the lock item if it is still the lock taken with id.
+func (s *S3Store) Unlock(ctx context.Context, id string) error {
+	if !s.locking() {
+		return nil
+	}
+	raw, held, err := getLockItem(ctx, s.DynamoDB, s.Backend)
+	if err != nil {
+		return err
+	}
+	if held == nil || held.ID != id {
+		return fmt.Errorf("unlocking %s: lock %s is no longer held", s, id)
+	}
+	return ReleaseLock(ctx, s.DynamoDB, s.Backend.LockTable, Lock{LockID: s.Backend.LockID(), Info: *held, rawInfo: raw})
+}
+
+// Get returns the state object, checking it against the digest item.
+func (s *S3Store) Get(ctx context.Context) ([]byte, error) {
+	out, err := s.S3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Backend.Bucket),
+		Key:    aws.String(s.Backend.Key),
+	})
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && (aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NotFound") {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", s, err)
+	}
+	defer out.Body.Close()
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", s, err)
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	if s.locking() {
+		d, err := s.DynamoDB.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+			TableName:      aws.String(s.Backend.LockTable),
+			Key:            map[string]*dynamodb.AttributeValue{"LockID": {S: aws.String(s.Backend.DigestID())}},
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("reading digest of %s: %w", s, err)
+		}
+		if v := d.Item["Digest"]; v != nil && aws.StringValue(v.S) != "" && aws.StringValue(v.S) != digest(data) {
+			return nil, fmt.Errorf("%s does not match its digest in %s", s, s.Backend.LockTable)
+		}
+	}
+	return data, nil
+}
+
+// Put writes the state object, encrypted as encrypt = true does, and
+// records its digest.
+func (s *S3Store) Put(ctx context.Context, data []byte) error {
+	in := &s3.PutObjectInput{
+		Bucket:               aws.String(s.Backend.Bucket),
+		Key:                  aws.String(s.Backend.Key),
+		Body:                 bytes.NewReader(data),
+		ContentType:          aws.String("application/json"),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAes256),
+	}
+	if s.Backend.KMSKeyID != "" {
+		in.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+		in.SSEKMSKeyId = aws.String(s.Backend.KMSKeyID)
+	}
+	if _, err := s.S3.PutObjectWithContext(ctx, in); err != nil {
+		return fmt.Errorf("writing %s: %w", s, err)
+	}
+	if !s.locking() {
+		return nil
+	}
+	_, err := s.DynamoDB.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.Backend.LockTable),
+		Item: map[string]*dynamodb.AttributeValue{
+			"LockID": {S: aws.String(s.Backend.DigestID())},
+			"Digest": {S: aws.String(digest(data))},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("writing digest of %s: %w", s, err)
+	}
+	return nil
+}
+
+// Delete removes the state object and its digest item. With bucket
+// versioning the object stays recoverable.
+func (s *S3Store) Delete(ctx context.Context) error {
+	_, err := s.S3.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.Backend.Bucket),
+		Key:    aws.String(s.Backend.Key),
+	})
+	if err != nil {
+		return fmt.Errorf("deleting %s: %w", s, err)
+	}
+	if !s.locking() {
+		return nil
+	}
+	_, err = s.DynamoDB.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.Backend.LockTable),
+		Key:       map[string]*dynamodb.AttributeValue{"LockID": {S: aws.String(s.Backend.DigestID())}},
+	})
+	if err != nil {
+		return fmt.Errorf("deleting digest of %s: %w", s, err)
+	}
+	return nil
+}
+
+func digest(data []byte) string {
+	sum := md5.Sum(data) //nolint:gosec
+	return hex.EncodeToString(sum[:])
+}
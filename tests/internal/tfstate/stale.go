@@ -0,0 +1,109 @@
+package tfstate
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Run is a CI workflow run.
+type Run struct {
+	ID         int64     `json:"id"`
+	Workflow   string    `json:"workflow"`
+	Status     string    `json:"status"`
+	Conclusion string    `json:"conclusion,omitempty"`
+	URL        string    `json:"url"`
+	Started    time.Time `json:"started"`
+	Updated    time.Time `json:"updated"`
+}
+
+// Active reports whether the run has not completed.
+func (r Run) Active() bool {
+	return r.Status != "completed"
+}
+
+// RunLookup finds the CI run that took a lock.
+type RunLookup interface {
+	// RunFor returns the run that was executing when l was created, or
+	// nil if none was.
+	RunFor(ctx context.Context, l LockInfo) (*Run, error)
+}
+
+// State is what Assess concluded about a lock.
+type State string
+
+const (
+	// StateHeld locks belong to a running operation and must be kept.
+	StateHeld State = "held"
+	// StateStale locks outlived the operation that took them.
+	StateStale State = "stale"
+	// StateUnknown locks could not be tied to a run. They are kept.
+	StateUnknown State = "unknown"
+)
+
+// Assessment is a lock with the reason it is held, stale or unknown.
+type Assessment struct {
+	Lock   Lock   `json:"lock"`
+	State  State  `json:"state"`
+	Reason string `json:"reason"`
+	Run    *Run   `json:"run,omitempty"`
+}
+
+// AssessOptions tune Assess.
+type AssessOptions struct {
+	Now time.Time
+	// MinAge keeps locks younger than this, whatever the lookup says.
+	MinAge time.Duration
+	// CIUsers are the Who users of CI runners, e.g. runner on GitHub
+	// hosted runners. Locks taken by anyone else are unknown.
+	CIUsers []string
+}
+
+// Assess decides which locks are stale. A lock is stale when its TTL has
+// passed, or when it was taken on a CI runner and the run that was
+// executing at the time has completed. CI locks whose run is not found
+// are unknown, as are all CI locks when lookup is nil.
+func Assess(ctx context.Context, locks []Lock, lookup RunLookup, opts AssessOptions) []Assessment {
+	out := make([]Assessment, 0, len(locks))
+	for _, l := range locks {
+		out = append(out, assess(ctx, l, lookup, opts))
+	}
+	return out
+}
+
+func assess(ctx context.Context, l Lock, lookup RunLookup, opts AssessOptions) Assessment {
+	a := Assessment{Lock: l, State: StateUnknown}
+	if l.Expired(opts.Now) {
+		a.State, a.Reason = StateStale, "TTL expired at "+l.Expires.Format(time.RFC3339)
+		return a
+	}
+	if age := l.Age(opts.Now); age < opts.MinAge {
+		a.State, a.Reason = StateHeld, fmt.Sprintf("taken %s ago, within %s", age.Round(time.Second), opts.MinAge)
+		return a
+	}
+	ci := false
+	for _, u := range opts.CIUsers {
+		ci = ci || l.Holder() == u
+	}
+	if !ci {
+		a.Reason = fmt.Sprintf("taken by %s, not a CI runner", l.Info.Who)
+		return a
+	}
+	if lookup == nil {
+		a.Reason = "no run lookup configured"
+		return a
+	}
+	run, err := lookup.RunFor(ctx, l.Info)
+	switch {
+	case err != nil:
+		a.Reason = "run lookup failed: " + err.Error()
+	case run == nil:
+		a.Reason = "no run executing at " + l.Info.Created.Format(time.RFC3339) + " was found"
+	case run.Active():
+		a.State, a.Reason, a.Run = StateHeld, fmt.Sprintf("run %d is %s", run.ID, run.Status), run
+	default:
+		a.State, a.Run = StateStale, run
+		a.Reason = fmt.Sprintf("run %d completed (%s) at %s", run.ID, run.Conclusion, run.Updated.Format(time.RFC3339))
+	}
+	return a
+}
@@ -0,0 +1,50 @@
+package tfstate
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Snapshot is the part of a version 4 state file the migration checks.
+type Snapshot struct {
+	Version          int    `json:"version"`
+	TerraformVersion string `json:"terraform_version"`
+	Serial           uint64 `json:"serial"`
+	Lineage          string `json:"lineage"`
+	Resources        []struct {
+		Module    string            `json:"module,omitempty"`
+		Mode      string            `json:"mode"`
+		Type      string            `json:"type"`
+		Name      string            `json:"name"`
+		Instances []json.RawMessage `json:"instances"`
+	} `json:"resources"`
+}
+
+// ParseSnapshot parses a state file. Only format version 4, written by
+// Terraform 0.12 and later, is accepted.
+func ParseSnapshot(data []byte) (*Snapshot, error) {
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parsing state: %w", err)
+	}
+	if s.Version != 4 {
+		return nil, fmt.Errorf("state format version %d, want 4", s.Version)
+	}
+	if s.Lineage == "" {
+		return nil, fmt.Errorf("state has no lineage")
+	}
+	return &s, nil
+}
+
+// Counts returns the number of managed resources and of their instances.
+// Data sources are not counted.
+func (s *Snapshot) Counts() (resources, instances int) {
+	for _, r := range s.Resources {
+		if r.Mode != "managed" {
+			continue
+		}
+		resources++
+		instances += len(r.Instances)
+	}
+	return resources, instances
+}
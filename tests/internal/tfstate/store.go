@@ -0,0 +1,167 @@
+package tfstate
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/yourorg/tf-modules/tests/internal/filelock"
+)
+
+// Store is a place a state file lives: a local file, an S3 object or an
+// Azure blob. Locks follow the protocol of the matching Terraform backend,
+// so Terraform and the migration exclude each other.
+type Store interface {
+	// String describes the store in messages, e.g. s3://bucket/key.
+	String() string
+	// Lock takes the state lock, or returns a *LockedError if someone
+	// else holds it.
+	Lock(ctx context.Context, info LockInfo) error
+	// Unlock releases the lock taken with id.
+	Unlock(ctx context.Context, id string) error
+	// Get returns the state, or nil if there is none.
+	Get(ctx context.Context) ([]byte, error)
+	Put(ctx context.Context, data []byte) error
+	Delete(ctx context.Context) error
+}
+
+// LockedError is returned by Store.Lock when the state is already locked.
+type LockedError struct {
+	Store string
+	// Lock is the holder's lock, if it could be read.
+	Lock *LockInfo
+}
+
+func (e *LockedError) Error() string {
+	if e.Lock == nil {
+		return e.Store + " is locked"
+	}
+	return fmt.Sprintf("%s is locked by %s (%s) since %s, lock ID %s",
+		e.Store, e.Lock.Who, e.Lock.Operation, e.Lock.Created.Format(time.RFC3339), e.Lock.ID)
+}
+
+// NewLockInfo returns a lock for operation on path with a fresh ID, held
+// by the current user and host.
+func NewLockInfo(operation, info, path string) LockInfo {
+	return LockInfo{
+		ID:        newLockID(),
+		Operation: operation,
+		Info:      info,
+		Who:       who(),
+		Created:   time.Now().UTC(),
+		Path:      path,
+	}
+}
+
+// newLockID returns a random UUID, the form Terraform uses for lock IDs.
+func newLockID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func who() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, _ := os.Hostname()
+	return name + "@" + host
+}
+
+// LocalStore is a local state file, as the local backend keeps it.
+type LocalStore struct {
+	Path string
+
+	unlock func()
+}
+
+func (s *LocalStore) String() string { return s.Path }
+
+// lockInfoPath is where the local backend records who holds the lock.
+func (s *LocalStore) lockInfoPath() string {
+	return filepath.Join(filepath.Dir(s.Path), "."+filepath.Base(s.Path)+".lock.info")
+}
+
+// Lock locks the state file as the local backend does, creating it empty
+// if needed, and records info next to it.
+func (s *LocalStore) Lock(_ context.Context, info LockInfo) error {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+		return err
+	}
+	unlock, err := filelock.TryLockRecord(s.Path, s.lockInfoPath())
+	if errors.Is(err, filelock.ErrLocked) {
+		lerr := &LockedError{Store: s.Path}
+		if data, err := os.ReadFile(s.lockInfoPath()); err == nil {
+			var held LockInfo
+			if json.Unmarshal(data, &held) == nil {
+				lerr.Lock = &held
+			}
+		}
+		return lerr
+	}
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(info)
+	if err == nil {
+		err = os.WriteFile(s.lockInfoPath(), data, 0o644)
+	}
+	if err != nil {
+		unlock()
+		return err
+	}
+	s.unlock = unlock
+	return nil
+}
+
+// Unlock releases the lock and removes a state file that Lock created
+// and nothing was written to.
+func (s *LocalStore) Unlock(_ context.Context, _ string) error {
+	if s.unlock == nil {
+		return fmt.Errorf("%s is not locked", s.Path)
+	}
+	if fi, err := os.Stat(s.Path); err == nil && fi.Size() == 0 {
+		os.Remove(s.Path)
+	}
+	err := os.Remove(s.lockInfoPath())
+	s.unlock()
+	s.unlock = nil
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil
+	}
+	return err
+}
+
+// Get returns the state file, or nil if it is missing or empty.
+func (s *LocalStore) Get(_ context.Context) ([]byte, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, fs.ErrNotExist) || len(data) == 0 {
+		return nil, nil
+	}
+	return data, err
+}
+
+// Put rewrites the state file in place, keeping the lock on it.
+func (s *LocalStore) Put(_ context.Context, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(s.Path, data, 0o644)
+}
+
+// Delete empties the state file; Unlock then removes it.
+func (s *LocalStore) Delete(_ context.Context) error {
+	return os.Truncate(s.Path, 0)
+}
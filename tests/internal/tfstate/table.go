@@ -0,0 +1,130 @@
+package tfstate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// DefaultTTLAttribute is the ttl_attribute default of aws/dynamodb-lock.
+const DefaultTTLAttribute = "ExpiresAt"
+
+// ErrLockChanged is returned by ReleaseLock when the lock was released or
+// taken again after it was listed.
+var ErrLockChanged = errors.New("lock changed since it was listed")
+
+// Lock is a lock item in a lock table.
+type Lock struct {
+	// LockID is the item key, <bucket>/<state key>.
+	LockID string   `json:"lock_id"`
+	Info   LockInfo `json:"info"`
+	// Expires is the item's TTL, if the table's TTL attribute is set on it.
+	Expires *time.Time `json:"expires,omitempty"`
+
+	// rawInfo is the Info attribute as stored, so ReleaseLock deletes only
+	// the lock that was listed.
+	rawInfo string
+}
+
+// Age returns how long the lock has been held at now.
+func (l Lock) Age(now time.Time) time.Duration {
+	return now.Sub(l.Info.Created)
+}
+
+// Expired reports whether the lock's TTL has passed. DynamoDB deletes
+// expired items only eventually, so they can linger for a day or more.
+func (l Lock) Expired(now time.Time) bool {
+	return l.Expires != nil && !now.Before(*l.Expires)
+}
+
+// Holder returns the user part of Who, e.g. runner for runner@fv-az12-34.
+func (l Lock) Holder() string {
+	user, _, _ := strings.Cut(l.Info.Who, "@")
+	return user
+}
+
+// ListLocks returns the locks held in table, ordered by LockID. Digest
+// items are skipped. ttlAttribute names the numeric TTL attribute, or is
+// empty if the table has none.
+func ListLocks(ctx context.Context, client DynamoDBAPI, table, ttlAttribute string) ([]Lock, error) {
+	var locks []Lock
+	var perr error
+	err := client.ScanPagesWithContext(ctx, &dynamodb.ScanInput{
+		TableName:      aws.String(table),
+		ConsistentRead: aws.Bool(true),
+	}, func(out *dynamodb.ScanOutput, _ bool) bool {
+		for _, item := range out.Items {
+			l, ok, err := lockFromItem(item, ttlAttribute)
+			if err != nil {
+				perr = fmt.Errorf("%s: %w", table, err)
+				return false
+			}
+			if ok {
+				locks = append(locks, l)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning %s: %w", table, err)
+	}
+	if perr != nil {
+		return nil, perr
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].LockID < locks[j].LockID })
+	return locks, nil
+}
+
+func lockFromItem(item map[string]*dynamodb.AttributeValue, ttlAttribute string) (Lock, bool, error) {
+	var id string
+	if key := item["LockID"]; key != nil {
+		id = aws.StringValue(key.S)
+	}
+	info := item["Info"]
+	if info == nil || info.S == nil {
+		// The <LockID>-md5 digest item, which is not a lock.
+		return Lock{}, false, nil
+	}
+	l := Lock{LockID: id, rawInfo: aws.StringValue(info.S)}
+	if err := json.Unmarshal([]byte(l.rawInfo), &l.Info); err != nil {
+		return Lock{}, false, fmt.Errorf("parsing lock %s: %w", id, err)
+	}
+	if ttl := item[ttlAttribute]; ttlAttribute != "" && ttl != nil && ttl.N != nil {
+		secs, err := strconv.ParseInt(aws.StringValue(ttl.N), 10, 64)
+		if err != nil {
+			return Lock{}, false, fmt.Errorf("lock %s: %s: %w", id, ttlAttribute, err)
+		}
+		exp := time.Unix(secs, 0).UTC()
+		l.Expires = &exp
+	}
+	return l, true, nil
+}
+
+// ReleaseLock deletes l from table, as terraform force-unlock does. It
+// returns ErrLockChanged instead of deleting a lock that is no longer the
+// one listed.
+func ReleaseLock(ctx context.Context, client DynamoDBAPI, table string, l Lock) error {
+	_, err := client.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName:                 aws.String(table),
+		Key:                       map[string]*dynamodb.AttributeValue{"LockID": {S: aws.String(l.LockID)}},
+		ConditionExpression:       aws.String("Info = :info"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":info": {S: aws.String(l.rawInfo)}},
+	})
+	var aerr awserr.Error
+	if errors.As(err, &aerr) && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return fmt.Errorf("releasing %s: %w", l.LockID, ErrLockChanged)
+	}
+	if err != nil {
+		return fmt.Errorf("releasing %s: %w", l.LockID, err)
+	}
+	return nil
+}
@@ -0,0 +1,623 @@
+package tfstate_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/tfstate"
+)
+
+func TestParseKey(t *testing.T) {
+	assert.Equal(t, "dev/platform/terraform.tfstate", tfstate.Key("dev", "platform"))
+
+	env, component, err := tfstate.ParseKey("prod/eks-addons/terraform.tfstate")
+	require.NoError(t, err)
+	assert.Equal(t, "prod", env)
+	assert.Equal(t, "eks-addons", component)
+
+	for _, key := range []string{
+		"terraform.tfstate",
+		"dev/terraform.tfstate",
+		"qa/platform/terraform.tfstate",
+		"dev/Platform/terraform.tfstate",
+		"dev/platform/state.json",
+		"env:/dev/platform/terraform.tfstate",
+	} {
+		_, _, err := tfstate.ParseKey(key)
+		assert.Error(t, err, key)
+	}
+}
+
+func TestBackendHCL(t *testing.T) {
+	b := tfstate.S3Backend{
+		Bucket:    "acme-dev-tfstate",
+		Key:       tfstate.Key("dev", "platform"),
+		Region:    "us-east-1",
+		LockTable: "acme-dev-tflock",
+		Endpoint:  "http://localhost:4566",
+	}
+	assert.Equal(t, "acme-dev-tfstate/dev/platform/terraform.tfstate", b.LockID())
+	assert.Equal(t, "acme-dev-tfstate/dev/platform/terraform.tfstate-md5", b.DigestID())
+
+	kms := tfstate.S3Backend{Bucket: "b", Key: "k", Region: "r", LockTable: "t", KMSKeyID: "arn:aws:kms:us-east-1:111122223333:key/abc"}
+	for _, b := range []tfstate.S3Backend{b, {Bucket: "b", Key: "k", Region: "r", LockTable: "t"}, kms} {
+		f, diags := hclsyntax.ParseConfig([]byte(b.HCL()), tfstate.BackendFile, hcl.InitialPos)
+		require.False(t, diags.HasErrors(), diags.Error())
+		backend := f.Body.(*hclsyntax.Body).Blocks[0].Body.Blocks[0]
+		assert.Equal(t, []string{"s3"}, backend.Labels)
+		_, endpoints := backend.Body.Attributes["endpoints"]
+		assert.Equal(t, b.Endpoint != "", endpoints)
+		_, kmsKey := backend.Body.Attributes["kms_key_id"]
+		assert.Equal(t, b.KMSKeyID != "", kmsKey)
+	}
+
+	azure := tfstate.AzureBackend{ResourceGroup: "rg-tfstate", StorageAccount: "sttfstate1234", Container: "tfstate", Key: "dev/platform/terraform.tfstate"}
+	f, diags := hclsyntax.ParseConfig([]byte(azure.HCL()), tfstate.BackendFile, hcl.InitialPos)
+	require.False(t, diags.HasErrors(), diags.Error())
+	backend := f.Body.(*hclsyntax.Body).Blocks[0].Body.Blocks[0]
+	assert.Equal(t, []string{"azurerm"}, backend.Labels)
+	assert.Len(t, backend.Body.Attributes, 4)
+}
+
+func TestBackendFromOutputs(t *testing.T) {
+	b, err := tfstate.S3BackendFromOutputs(map[string]interface{}{
+		"state_bucket_name": "tfmodules-terraform-state-us-east-1",
+		"state_bucket_arn":  "arn:aws:s3:::tfmodules-terraform-state-us-east-1",
+		"lock_table_name":   "tfmodules-terraform-lock",
+		"region":            "us-east-1",
+		"kms_key_arn":       nil,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, tfstate.S3Backend{Bucket: "tfmodules-terraform-state-us-east-1", Region: "us-east-1", LockTable: "tfmodules-terraform-lock"}, b)
+
+	_, err = tfstate.S3BackendFromOutputs(map[string]interface{}{"state_bucket_name": "b", "region": "r"})
+	assert.ErrorContains(t, err, "lock_table_name")
+
+	a, err := tfstate.AzureBackendFromOutputs(map[string]interface{}{
+		"resource_group_name":  "rg-tfstate",
+		"storage_account_name": "sttfstate1234",
+		"container_name":       "tfstate",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "sttfstate1234", a.StorageAccount)
+	_, err = tfstate.AzureBackendFromOutputs(map[string]interface{}{"resource_group_name": "rg-tfstate"})
+	assert.ErrorContains(t, err, "storage_account_name")
+}
+
+func TestPlanBackend(t *testing.T) {
+	dir := t.TempDir()
+	main := `terraform {
+  required_version = ">= 1.4.0, < 2.0.0"
+
+  backend "s3" {
+    # Configure via -backend-config or environment variables
+    # key = "dev/platform/terraform.tfstate"
+  }
+}
+
+locals {
+  environment = "dev"
+}
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(main), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "variables.tf"), []byte("variable \"region\" {}\n"), 0o644))
+	b := tfstate.S3Backend{Bucket: "state", Key: tfstate.Key("dev", "platform"), Region: "us-east-1", LockTable: "lock"}
+
+	changes, err := tfstate.PlanBackend(dir, b)
+	require.NoError(t, err)
+	require.Len(t, changes, 2, "backend.tf and main.tf change; variables.tf does not")
+	assert.Nil(t, changes[0].Old)
+	assert.Contains(t, changes[0].Diff(), "+++ "+filepath.Join(dir, tfstate.BackendFile))
+	assert.Contains(t, changes[0].Diff(), `+    bucket         = "state"`)
+	assert.Equal(t, `terraform {
+  required_version = ">= 1.4.0, < 2.0.0"
+}
+
+locals {
+  environment = "dev"
+}
+`, string(changes[1].New))
+	for _, c := range changes {
+		require.NoError(t, c.Write())
+	}
+
+	changes, err = tfstate.PlanBackend(dir, b)
+	require.NoError(t, err)
+	for _, c := range changes {
+		assert.False(t, c.Changed(), c.Path)
+		assert.Empty(t, c.Diff())
+	}
+
+	b.Region = "eu-west-1"
+	changes, err = tfstate.PlanBackend(dir, b)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Contains(t, changes[0].Diff(), `-    region         = "us-east-1"`)
+	assert.Contains(t, changes[0].Diff(), `+    region         = "eu-west-1"`)
+
+	_, err = tfstate.PlanBackend(dir, tfstate.AzureBackend{Key: "k"})
+	require.NoError(t, err, "backend.tf itself is replaced")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte("terraform {\n  backend \"s3\" {}\n}\n"), 0o644))
+	_, err = tfstate.PlanBackend(dir, tfstate.AzureBackend{Key: "k"})
+	assert.ErrorContains(t, err, `already configures a "s3" backend`)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte("terraform {\n  backend \"s3\" {\n    bucket = \"other\"\n  }\n}\n"), 0o644))
+	_, err = tfstate.PlanBackend(dir, b)
+	assert.ErrorContains(t, err, `already configures a "s3" backend`)
+}
+
+type fakeDynamoDB map[string]map[string]*dynamodb.AttributeValue
+
+func (f fakeDynamoDB) GetItemWithContext(_ aws.Context, in *dynamodb.GetItemInput, _ ...request.Option) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: f[aws.StringValue(in.Key["LockID"].S)]}, nil
+}
+
+func (f fakeDynamoDB) ScanPagesWithContext(_ aws.Context, _ *dynamodb.ScanInput, fn func(*dynamodb.ScanOutput, bool) bool, _ ...request.Option) error {
+	// One item per page, to exercise paging.
+	for id, item := range f {
+		item["LockID"] = &dynamodb.AttributeValue{S: aws.String(id)}
+		if !fn(&dynamodb.ScanOutput{Items: []map[string]*dynamodb.AttributeValue{item}}, false) {
+			break
+		}
+	}
+	return nil
+}
+
+// PutItemWithContext supports only the attribute_not_exists(LockID)
+// condition S3Store.Lock uses.
+func (f fakeDynamoDB) PutItemWithContext(_ aws.Context, in *dynamodb.PutItemInput, _ ...request.Option) (*dynamodb.PutItemOutput, error) {
+	id := aws.StringValue(in.Item["LockID"].S)
+	if in.ConditionExpression != nil && f[id] != nil {
+		return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+	}
+	f[id] = in.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+// DeleteItemWithContext supports the Info = :info condition ReleaseLock
+// uses, and no condition.
+func (f fakeDynamoDB) DeleteItemWithContext(_ aws.Context, in *dynamodb.DeleteItemInput, _ ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	id := aws.StringValue(in.Key["LockID"].S)
+	item := f[id]
+	if in.ConditionExpression == nil {
+		delete(f, id)
+		return &dynamodb.DeleteItemOutput{}, nil
+	}
+	want := aws.StringValue(in.ExpressionAttributeValues[":info"].S)
+	if item == nil || item["Info"] == nil || aws.StringValue(item["Info"].S) != want {
+		return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil)
+	}
+	delete(f, id)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func TestGetLock(t *testing.T) {
+	b := tfstate.S3Backend{Bucket: "state", Key: tfstate.Key("dev", "platform"), LockTable: "lock"}
+	db := fakeDynamoDB{
+		b.DigestID(): {"Digest": {S: aws.String("d41d8cd98f00b204e9800998ecf8427e")}},
+	}
+	l, err := tfstate.GetLock(context.Background(), db, b)
+	require.NoError(t, err)
+	assert.Nil(t, l, "the digest item is not a lock")
+
+	db[b.LockID()] = map[string]*dynamodb.AttributeValue{"Info": {S: aws.String(
+		`{"ID":"2b6a6738-5dd5-a8c5-2f5d-1b0c2f7e3f5a","Operation":"OperationTypeApply","Info":"","Who":"ci@runner","Version":"1.7.5","Created":"2026-10-19T09:15:00Z","Path":"state/dev/platform/terraform.tfstate"}`)}}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	l, err = tfstate.WaitForLock(ctx, db, b, 10*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, "OperationTypeApply", l.Operation)
+	assert.Equal(t, "ci@runner", l.Who)
+	assert.Equal(t, time.Date(2026, 10, 19, 9, 15, 0, 0, time.UTC), l.Created)
+}
+
+func lockItem(info tfstate.LockInfo) map[string]*dynamodb.AttributeValue {
+	b, err := json.Marshal(info)
+	if err != nil {
+		panic(err)
+	}
+	return map[string]*dynamodb.AttributeValue{"Info": {S: aws.String(string(b))}}
+}
+
+func TestListAndReleaseLocks(t *testing.T) {
+	ctx := context.Background()
+	created := time.Date(2026, 10, 19, 9, 15, 0, 0, time.UTC)
+	dev := tfstate.S3Backend{Bucket: "state", Key: tfstate.Key("dev", "platform")}
+	prod := tfstate.S3Backend{Bucket: "state", Key: tfstate.Key("prod", "platform")}
+	db := fakeDynamoDB{
+		dev.DigestID():  {"Digest": {S: aws.String("d41d8cd98f00b204e9800998ecf8427e")}},
+		prod.LockID():   lockItem(tfstate.LockInfo{ID: "b", Operation: "OperationTypePlan", Who: "alice@laptop", Created: created}),
+		dev.LockID():    lockItem(tfstate.LockInfo{ID: "a", Operation: "OperationTypeApply", Who: "runner@fv-az12-34", Created: created}),
+		prod.DigestID(): {"Digest": {S: aws.String("9e107d9d372bb6826bd81d3542a419d6")}},
+	}
+	db[prod.LockID()]["ExpiresAt"] = &dynamodb.AttributeValue{N: aws.String(fmt.Sprint(created.Add(time.Hour).Unix()))}
+
+	locks, err := tfstate.ListLocks(ctx, db, "lock", tfstate.DefaultTTLAttribute)
+	require.NoError(t, err)
+	require.Len(t, locks, 2, "digest items are not locks")
+	assert.Equal(t, dev.LockID(), locks[0].LockID)
+	assert.Equal(t, "runner", locks[0].Holder())
+	assert.Nil(t, locks[0].Expires)
+	require.NotNil(t, locks[1].Expires)
+	assert.False(t, locks[1].Expired(created))
+	assert.True(t, locks[1].Expired(created.Add(2*time.Hour)))
+
+	// The dev lock is released and taken again before the release.
+	db[dev.LockID()] = lockItem(tfstate.LockInfo{ID: "c", Operation: "OperationTypeApply", Who: "runner@fv-az56-78", Created: created.Add(time.Minute)})
+	err = tfstate.ReleaseLock(ctx, db, "lock", locks[0])
+	assert.ErrorIs(t, err, tfstate.ErrLockChanged)
+	assert.Contains(t, db, dev.LockID())
+
+	require.NoError(t, tfstate.ReleaseLock(ctx, db, "lock", locks[1]))
+	assert.NotContains(t, db, prod.LockID())
+	assert.Contains(t, db, prod.DigestID(), "releasing a lock keeps the digest")
+}
+
+type fakeLookup map[string]*tfstate.Run
+
+func (f fakeLookup) RunFor(_ context.Context, l tfstate.LockInfo) (*tfstate.Run, error) {
+	if l.ID == "broken" {
+		return nil, fmt.Errorf("API rate limit exceeded")
+	}
+	return f[l.ID], nil
+}
+
+func TestAssess(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	lock := func(id, who string, age time.Duration) tfstate.Lock {
+		return tfstate.Lock{LockID: "state/" + id, Info: tfstate.LockInfo{ID: id, Who: who, Created: now.Add(-age)}}
+	}
+	expired := lock("expired", "alice@laptop", 5*time.Minute)
+	exp := now.Add(-time.Minute)
+	expired.Expires = &exp
+
+	locks := []tfstate.Lock{
+		expired,
+		lock("young", "runner@fv-az1", 10*time.Minute),
+		lock("local", "alice@laptop", 3*time.Hour),
+		lock("running", "runner@fv-az2", 3*time.Hour),
+		lock("cancelled", "runner@fv-az3", 3*time.Hour),
+		lock("orphan", "runner@fv-az4", 3*time.Hour),
+		lock("broken", "runner@fv-az5", 3*time.Hour),
+	}
+	lookup := fakeLookup{
+		"young":     {ID: 1, Status: "completed", Conclusion: "cancelled"},
+		"running":   {ID: 2, Status: "in_progress"},
+		"cancelled": {ID: 3, Status: "completed", Conclusion: "cancelled", Updated: now.Add(-2 * time.Hour)},
+	}
+	opts := tfstate.AssessOptions{Now: now, MinAge: time.Hour, CIUsers: []string{"runner"}}
+
+	got := map[string]tfstate.State{}
+	for _, a := range tfstate.Assess(context.Background(), locks, lookup, opts) {
+		got[a.Lock.Info.ID] = a.State
+		assert.NotEmpty(t, a.Reason, a.Lock.Info.ID)
+	}
+	assert.Equal(t, map[string]tfstate.State{
+		"expired":   tfstate.StateStale,
+		"young":     tfstate.StateHeld,
+		"local":     tfstate.StateUnknown,
+		"running":   tfstate.StateHeld,
+		"cancelled": tfstate.StateStale,
+		"orphan":    tfstate.StateUnknown,
+		"broken":    tfstate.StateUnknown,
+	}, got)
+
+	for _, a := range tfstate.Assess(context.Background(), locks, nil, opts) {
+		if a.Lock.Expires == nil {
+			assert.NotEqual(t, tfstate.StateStale, a.State, "without a lookup only expired locks are stale: %s", a.Lock.Info.ID)
+		}
+	}
+}
+
+func TestGitHubRuns(t *testing.T) {
+	created := time.Date(2026, 10, 19, 9, 15, 0, 0, time.UTC)
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Path+" created"+r.URL.Query().Get("created")+" page"+r.URL.Query().Get("page"))
+		assert.Equal(t, "Bearer t0ken", r.Header.Get("Authorization"))
+		if r.URL.Path == "/repos/acme/infra/actions/workflows/terraform-apply.yml/runs" && r.URL.Query().Get("page") == "" {
+			q := r.URL.Query()
+			q.Set("page", "2")
+			w.Header().Set("Link", fmt.Sprintf(`<http://%s%s?%s>; rel="next", <http://%s%s?page=9>; rel="last"`, r.Host, r.URL.Path, q.Encode(), r.Host, r.URL.Path))
+			// Queued when the lock was taken, so it neither owns the
+			// lock nor ends the search.
+			fmt.Fprint(w, `{"workflow_runs": [
+				{"id": 4, "path": ".github/workflows/terraform-apply.yml", "status": "in_progress", "html_url": "https://github.com/acme/infra/actions/runs/4", "run_started_at": "2026-10-19T09:16:00Z", "updated_at": "2026-10-19T09:16:00Z"}
+			]}`)
+			return
+		}
+		runs := map[string]string{
+			"/repos/acme/infra/actions/workflows/terraform-apply.yml/runs": `{"workflow_runs": [
+				{"id": 3, "path": ".github/workflows/terraform-apply.yml", "status": "completed", "conclusion": "cancelled", "html_url": "https://github.com/acme/infra/actions/runs/3", "run_started_at": "2026-10-19T09:10:00Z", "updated_at": "2026-10-19T09:20:00Z"},
+				{"id": 2, "path": ".github/workflows/terraform-apply.yml", "status": "completed", "conclusion": "success", "html_url": "https://github.com/acme/infra/actions/runs/2", "run_started_at": "2026-10-19T08:00:00Z", "updated_at": "2026-10-19T08:10:00Z"}
+			]}`,
+			"/repos/acme/infra/actions/workflows/terraform-drift.yml/runs": `{"workflow_runs": []}`,
+		}
+		body, ok := runs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+
+	g := tfstate.GitHubRuns{Repo: "acme/infra", Token: "t0ken", BaseURL: srv.URL, Workflows: []string{"terraform-apply.yml", "terraform-drift.yml"}}
+	run, err := g.RunFor(context.Background(), tfstate.LockInfo{Created: created})
+	require.NoError(t, err)
+	require.NotNil(t, run)
+	assert.Equal(t, int64(3), run.ID, "run 2 had finished before the lock was taken")
+	assert.Equal(t, "cancelled", run.Conclusion)
+	assert.False(t, run.Active())
+	assert.Equal(t, []string{
+		"/repos/acme/infra/actions/workflows/terraform-apply.yml/runs created<=2026-10-19T09:15:00Z page",
+		"/repos/acme/infra/actions/workflows/terraform-apply.yml/runs created<=2026-10-19T09:15:00Z page2",
+		"/repos/acme/infra/actions/workflows/terraform-drift.yml/runs created<=2026-10-19T09:15:00Z page",
+	}, queries, "run 3 is on the second page; run 2 ended before the lock, so the search stops there")
+
+	run, err = g.RunFor(context.Background(), tfstate.LockInfo{Created: created.Add(-20 * time.Minute)})
+	require.NoError(t, err)
+	assert.Nil(t, run)
+
+	g.Workflows = nil
+	_, err = g.RunFor(context.Background(), tfstate.LockInfo{Created: created})
+	assert.ErrorContains(t, err, "404")
+}
+
+func TestAppendAudit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "locks.jsonl")
+	rec := tfstate.AuditRecord{Table: "lock", LockID: "state/dev/platform/terraform.tfstate", ReleasedBy: "alice", Result: "released"}
+	require.NoError(t, tfstate.AppendAudit(path, rec))
+	require.NoError(t, tfstate.AppendAudit(path, rec))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(data), "\n"))
+}
+
+type fakeS3 map[string][]byte
+
+func (f fakeS3) GetObjectWithContext(_ aws.Context, in *s3.GetObjectInput, _ ...request.Option) (*s3.GetObjectOutput, error) {
+	data, ok := f[aws.StringValue(in.Bucket)+"/"+aws.StringValue(in.Key)]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil)
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (f fakeS3) PutObjectWithContext(_ aws.Context, in *s3.PutObjectInput, _ ...request.Option) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(in.Body)
+	f[aws.StringValue(in.Bucket)+"/"+aws.StringValue(in.Key)] = data
+	return &s3.PutObjectOutput{}, err
+}
+
+func (f fakeS3) DeleteObjectWithContext(_ aws.Context, in *s3.DeleteObjectInput, _ ...request.Option) (*s3.DeleteObjectOutput, error) {
+	delete(f, aws.StringValue(in.Bucket)+"/"+aws.StringValue(in.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func TestParseSnapshot(t *testing.T) {
+	data, err := os.ReadFile("../../testdata/state/terraform.tfstate")
+	require.NoError(t, err)
+	snap, err := tfstate.ParseSnapshot(data)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(12), snap.Serial)
+	assert.Equal(t, "3f1c2a9e-7b4d-4e21-9c55-0d8f6a2b1e47", snap.Lineage)
+	resources, instances := snap.Counts()
+	assert.Equal(t, 2, resources, "data sources are not counted")
+	assert.Equal(t, 3, instances)
+
+	_, err = tfstate.ParseSnapshot([]byte(`{"version": 3, "serial": 1, "lineage": "x"}`))
+	assert.ErrorContains(t, err, "version 3")
+}
+
+// withSerial returns the fixture state with another serial and lineage.
+func withSerial(t *testing.T, serial uint64, lineage string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("../../testdata/state/terraform.tfstate")
+	require.NoError(t, err)
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &m))
+	m["serial"] = serial
+	if lineage != "" {
+		m["lineage"] = lineage
+	}
+	out, err := json.MarshalIndent(m, "", "  ")
+	require.NoError(t, err)
+	return out
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	src := &tfstate.LocalStore{Path: filepath.Join(dir, "local", "terraform.tfstate")}
+	require.NoError(t, src.Put(ctx, withSerial(t, 12, "")))
+
+	db, objects := fakeDynamoDB{}, fakeS3{}
+	dst := &tfstate.S3Store{S3: objects, DynamoDB: db, Backend: tfstate.S3Backend{Bucket: "state", Key: tfstate.Key("dev", "platform"), LockTable: "lock"}}
+	opts := tfstate.MigrateOptions{BackupDir: filepath.Join(dir, "backups")}
+
+	res, err := tfstate.Migrate(ctx, src, dst, opts)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(12), res.Serial)
+	assert.Equal(t, 2, res.Resources)
+	assert.Equal(t, 3, res.Instances)
+	assert.False(t, res.Unchanged)
+	require.Len(t, res.Backups, 1)
+	backup, err := os.ReadFile(res.Backups[0])
+	require.NoError(t, err)
+	assert.Equal(t, withSerial(t, 12, ""), backup)
+
+	assert.Equal(t, withSerial(t, 12, ""), objects["state/dev/platform/terraform.tfstate"])
+	assert.Contains(t, db, dst.Backend.DigestID(), "the digest is written with the state")
+	assert.NotContains(t, db, dst.Backend.LockID(), "the lock is released")
+	_, err = os.Stat(filepath.Join(dir, "local", ".terraform.tfstate.lock.info"))
+	assert.ErrorIs(t, err, fs.ErrNotExist, "the local lock info is removed")
+
+	res, err = tfstate.Migrate(ctx, src, dst, opts)
+	require.NoError(t, err)
+	assert.True(t, res.Unchanged, "migrating twice changes nothing")
+
+	// The destination moved on, so the source is older.
+	require.NoError(t, dst.Put(ctx, withSerial(t, 13, "")))
+	_, err = tfstate.Migrate(ctx, src, dst, opts)
+	assert.ErrorContains(t, err, "holds serial 13, not older than the source's 12")
+
+	require.NoError(t, dst.Put(ctx, withSerial(t, 1, "00000000-0000-4000-8000-000000000000")))
+	_, err = tfstate.Migrate(ctx, src, dst, opts)
+	assert.ErrorContains(t, err, "lineage 00000000-0000-4000-8000-000000000000")
+	opts.Force = true
+	res, err = tfstate.Migrate(ctx, src, dst, opts)
+	require.NoError(t, err)
+	assert.Len(t, res.Backups, 2, "the overwritten destination is backed up")
+	opts.Force = false
+
+	// Someone else holds the destination lock.
+	other := tfstate.NewLockInfo("OperationTypeApply", "", dst.String())
+	require.NoError(t, dst.Lock(ctx, other))
+	_, err = tfstate.Migrate(ctx, src, dst, opts)
+	var locked *tfstate.LockedError
+	require.ErrorAs(t, err, &locked)
+	assert.Equal(t, other.ID, locked.Lock.ID)
+	require.NoError(t, dst.Unlock(ctx, other.ID))
+	assert.Error(t, dst.Unlock(ctx, other.ID), "the lock is already released")
+}
+
+// fakeBlobService is an in-memory Blob service with the lease semantics
+// the azurerm backend relies on. It does not check signatures; Azurite
+// does in TestStateMigrateAzurite.
+type fakeBlobService struct {
+	blobs map[string]*fakeBlob
+}
+
+type fakeBlob struct {
+	data  []byte
+	meta  http.Header
+	lease string
+}
+
+func (f *fakeBlobService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "SharedKey "+tfstate.AzuriteAccount+":") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	b := f.blobs[r.URL.Path]
+	// Reads need no lease; writes to a leased blob need its ID.
+	leaseOK := b == nil || b.lease == "" || b.lease == r.Header.Get("x-ms-lease-id") ||
+		r.Method == http.MethodGet || r.Method == http.MethodHead
+	fail := func(status int, code string) {
+		w.Header().Set("x-ms-error-code", code)
+		w.WriteHeader(status)
+	}
+	meta := func() http.Header {
+		m := http.Header{}
+		for k, v := range r.Header {
+			if strings.HasPrefix(strings.ToLower(k), "x-ms-meta-") {
+				m[k] = v
+			}
+		}
+		return m
+	}
+	q := r.URL.Query()
+	switch {
+	case q.Get("restype") == "container":
+		w.WriteHeader(http.StatusCreated)
+	case b == nil && r.Method != http.MethodPut:
+		fail(http.StatusNotFound, "BlobNotFound")
+	case q.Get("comp") == "lease":
+		switch action := r.Header.Get("x-ms-lease-action"); {
+		case b == nil:
+			fail(http.StatusNotFound, "BlobNotFound")
+		case action == "acquire" && b.lease != "":
+			fail(http.StatusConflict, "LeaseAlreadyPresent")
+		case action == "acquire":
+			b.lease = r.Header.Get("x-ms-proposed-lease-id")
+			w.WriteHeader(http.StatusCreated)
+		case action == "release" && b.lease == r.Header.Get("x-ms-lease-id"):
+			b.lease = ""
+			w.WriteHeader(http.StatusOK)
+		default:
+			fail(http.StatusConflict, "LeaseIdMismatchWithLeaseOperation")
+		}
+	case !leaseOK:
+		fail(http.StatusPreconditionFailed, "LeaseIdMissing")
+	case q.Get("comp") == "metadata":
+		b.meta = meta()
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		if b == nil {
+			b = &fakeBlob{}
+			f.blobs[r.URL.Path] = b
+		}
+		b.data, b.meta = data, meta()
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodHead:
+		for k, v := range b.meta {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet:
+		w.Write(b.data) //nolint:errcheck
+	case r.Method == http.MethodDelete:
+		delete(f.blobs, r.URL.Path)
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func TestAzureStore(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(&fakeBlobService{blobs: map[string]*fakeBlob{}})
+	defer srv.Close()
+	blob := tfstate.AzureBlob{Account: tfstate.AzuriteAccount, Key: tfstate.AzuriteKey, Endpoint: srv.URL + "/" + tfstate.AzuriteAccount}
+	require.NoError(t, blob.CreateContainer(ctx, "tfstate"))
+
+	dir := t.TempDir()
+	src := &tfstate.LocalStore{Path: filepath.Join(dir, "terraform.tfstate")}
+	require.NoError(t, src.Put(ctx, withSerial(t, 12, "")))
+	dst := &tfstate.AzureStore{Blob: blob, Container: "tfstate", Key: tfstate.Key("dev", "platform")}
+	assert.Equal(t, "azurerm://devstoreaccount1/tfstate/dev/platform/terraform.tfstate", dst.String())
+
+	_, err := tfstate.Migrate(ctx, src, dst, tfstate.MigrateOptions{BackupDir: dir, DeleteSource: true})
+	require.NoError(t, err)
+	got, err := dst.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, withSerial(t, 12, ""), got)
+	_, err = os.Stat(src.Path)
+	assert.ErrorIs(t, err, fs.ErrNotExist, "the source is deleted")
+
+	// A second client cannot lock while the first holds the lease, and
+	// sees who holds it.
+	held := tfstate.NewLockInfo("OperationTypeApply", "", dst.String())
+	require.NoError(t, dst.Lock(ctx, held))
+	other := &tfstate.AzureStore{Blob: blob, Container: "tfstate", Key: dst.Key}
+	err = other.Lock(ctx, tfstate.NewLockInfo(tfstate.MigrateOperation, "", other.String()))
+	var locked *tfstate.LockedError
+	require.ErrorAs(t, err, &locked)
+	require.NotNil(t, locked.Lock)
+	assert.Equal(t, held.ID, locked.Lock.ID)
+	assert.Error(t, other.Put(ctx, []byte("{}")), "writes need the lease")
+
+	require.NoError(t, dst.Put(ctx, withSerial(t, 13, "")))
+	require.NoError(t, dst.Unlock(ctx, held.ID))
+	require.NoError(t, other.Lock(ctx, tfstate.NewLockInfo(tfstate.MigrateOperation, "", other.String())), "the lease is released")
+}
@@ -0,0 +1,220 @@
+// Package upgrade checks that a module upgrades in place: state applied
+// with the module from the previous release must plan against HEAD's
+// module without replacing or destroying anything unexpected.
+//
+// The module is called from a generated root configuration, so that the
+// same state, under module.under_test, can be pointed first at the
+// previous release exported from git and then at the working tree.
+package upgrade
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// EnvFromRef overrides the git ref treated as the previous release.
+const EnvFromRef = "UPGRADE_FROM_REF"
+
+// ModuleName is the name the generated root configuration gives the module.
+const ModuleName = "under_test"
+
+// RootFile is the generated root configuration.
+const RootFile = "main.tf.json"
+
+// RepoRoot returns the top of the git work tree containing dir.
+func RepoRoot(dir string) (string, error) {
+	out, err := git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// PreviousRelease returns the newest v* tag reachable from HEAD that does
+// not point at HEAD itself, or the ref in UPGRADE_FROM_REF if set. It
+// returns "" if there is none, e.g. in a shallow clone without tags.
+func PreviousRelease(repoRoot string) (string, error) {
+	if ref := os.Getenv(EnvFromRef); ref != "" {
+		return ref, nil
+	}
+	merged, err := git(repoRoot, "tag", "--merged", "HEAD", "--list", "v*", "--sort=-v:refname")
+	if err != nil {
+		return "", err
+	}
+	atHead, err := git(repoRoot, "tag", "--points-at", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	skip := map[string]bool{}
+	for _, t := range strings.Fields(string(atHead)) {
+		skip[t] = true
+	}
+	for _, t := range strings.Fields(string(merged)) {
+		if !skip[t] {
+			return t, nil
+		}
+	}
+	return "", nil
+}
+
+// HasPath reports whether path, relative to the repository root, exists at
+// ref.
+func HasPath(repoRoot, ref, path string) (bool, error) {
+	if _, err := git(repoRoot, "rev-parse", "--verify", "--quiet", ref+"^{commit}"); err != nil {
+		return false, fmt.Errorf("unknown ref %s", ref)
+	}
+	_, err := git(repoRoot, "cat-file", "-e", ref+":"+filepath.ToSlash(path))
+	return err == nil, nil
+}
+
+// Export writes the tree under path at ref into dest, keeping its
+// repository-relative layout so relative module sources still resolve.
+func Export(repoRoot, ref, path, dest string) error {
+	out, err := git(repoRoot, "archive", "--format=tar", ref, filepath.ToSlash(path))
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(bytes.NewReader(out))
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading archive of %s: %w", ref, err)
+		}
+		target := filepath.Join(dest, filepath.FromSlash(h.Name))
+		if !strings.HasPrefix(target, filepath.Clean(dest)+string(filepath.Separator)) {
+			return fmt.Errorf("archive of %s: %s escapes %s", ref, h.Name, dest)
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(target, data, os.FileMode(h.Mode)&0o777); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// WriteRoot writes a root configuration in dir calling the module in
+// moduleDir with vars. Rewriting it with another moduleDir keeps the state
+// addresses, since the module is always module.under_test.
+func WriteRoot(dir, moduleDir string, vars map[string]interface{}) error {
+	source, err := filepath.Rel(dir, moduleDir)
+	if err != nil {
+		return err
+	}
+	source = filepath.ToSlash(source)
+	if !strings.HasPrefix(source, "../") {
+		// Terraform only treats ./ and ../ paths as local modules.
+		source = "./" + source
+	}
+	call := map[string]interface{}{"source": source}
+	for k, v := range vars {
+		if k == "source" {
+			return errors.New("a module input cannot be called source")
+		}
+		call[k] = v
+	}
+	data, err := json.MarshalIndent(map[string]interface{}{
+		"module": map[string]interface{}{ModuleName: call},
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, RootFile), append(data, '\n'), 0o644)
+}
+
+// Allowance permits a replace or destroy across the upgrade. Address is
+// relative to the module and may use * for any run of characters, e.g.
+// aws_eip.nat[*].
+type Allowance struct {
+	Address string
+	// Reason is why the change is acceptable, for the release notes.
+	Reason string
+}
+
+func (a Allowance) match(addr string) bool {
+	re := "^" + strings.ReplaceAll(regexp.QuoteMeta(a.Address), `\*`, ".*") + "$"
+	return regexp.MustCompile(re).MatchString(addr)
+}
+
+// Finding is a planned replace or destroy no allowance covers.
+type Finding struct {
+	// Address is relative to the module.
+	Address string
+	Actions tfjson.Actions
+}
+
+func (f Finding) String() string {
+	action := "destroyed"
+	if f.Actions.Replace() {
+		action = "replaced"
+	}
+	return fmt.Sprintf("%s would be %s", f.Address, action)
+}
+
+// Check returns the managed resources the plan replaces or destroys that no
+// allowance covers, and the allowances that covered nothing.
+func Check(plan *tfjson.Plan, allow []Allowance) (findings []Finding, unused []Allowance) {
+	used := make([]bool, len(allow))
+	prefix := "module." + ModuleName + "."
+	for _, rc := range plan.ResourceChanges {
+		if rc.Mode != tfjson.ManagedResourceMode || rc.Change == nil {
+			continue
+		}
+		if a := rc.Change.Actions; !a.Delete() && !a.Replace() {
+			continue
+		}
+		addr := strings.TrimPrefix(rc.Address, prefix)
+		covered := false
+		for i, al := range allow {
+			if al.match(addr) {
+				used[i], covered = true, true
+			}
+		}
+		if !covered {
+			findings = append(findings, Finding{Address: addr, Actions: rc.Change.Actions})
+		}
+	}
+	for i, al := range allow {
+		if !used[i] {
+			unused = append(unused, al)
+		}
+	}
+	return findings, unused
+}
+
+func git(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
@@ -0,0 +1,167 @@
+package upgrade_test
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/planjson"
+	"github.com/yourorg/tf-modules/tests/internal/upgrade"
+)
+
+// gitRepo creates a repository with modules/aws/thing at v0.1.0 and v0.2.0
+// and HEAD one commit later.
+func gitRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false", "-c", "tag.gpgsign=false"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, "%s", out)
+	}
+	write := func(name, content string) {
+		t.Helper()
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+
+	run("init", "-q")
+	write("modules/aws/thing/main.tf", "# v0.1.0\n")
+	run("add", "-A")
+	run("commit", "-qm", "one")
+	run("tag", "v0.1.0")
+	write("modules/aws/thing/main.tf", "# v0.2.0\n")
+	write("modules/aws/thing/nested/child.tf", "# child\n")
+	run("add", "-A")
+	run("commit", "-qm", "two")
+	run("tag", "v0.2.0")
+	write("modules/aws/thing/main.tf", "# head\n")
+	write("modules/aws/new/main.tf", "# new\n")
+	run("add", "-A")
+	run("commit", "-qm", "three")
+	return dir
+}
+
+func TestPreviousRelease(t *testing.T) {
+	repo := gitRepo(t)
+	ref, err := upgrade.PreviousRelease(repo)
+	require.NoError(t, err)
+	assert.Equal(t, "v0.2.0", ref)
+
+	// A release commit upgrades from the release before it.
+	cmd := exec.Command("git", "tag", "v0.3.0")
+	cmd.Dir = repo
+	require.NoError(t, cmd.Run())
+	ref, err = upgrade.PreviousRelease(repo)
+	require.NoError(t, err)
+	assert.Equal(t, "v0.2.0", ref)
+
+	t.Setenv(upgrade.EnvFromRef, "v0.1.0")
+	ref, err = upgrade.PreviousRelease(repo)
+	require.NoError(t, err)
+	assert.Equal(t, "v0.1.0", ref)
+
+	root, err := upgrade.RepoRoot(filepath.Join(repo, "modules"))
+	require.NoError(t, err)
+	want, err := filepath.EvalSymlinks(repo)
+	require.NoError(t, err)
+	assert.Equal(t, want, root)
+}
+
+func TestExport(t *testing.T) {
+	repo := gitRepo(t)
+
+	ok, err := upgrade.HasPath(repo, "v0.2.0", "modules/aws/thing")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = upgrade.HasPath(repo, "v0.2.0", "modules/aws/new")
+	require.NoError(t, err)
+	assert.False(t, ok, "modules added since the release have nothing to upgrade from")
+	_, err = upgrade.HasPath(repo, "v9.9.9", "modules/aws/thing")
+	assert.Error(t, err)
+
+	dest := t.TempDir()
+	require.NoError(t, upgrade.Export(repo, "v0.2.0", "modules", dest))
+	data, err := os.ReadFile(filepath.Join(dest, "modules", "aws", "thing", "main.tf"))
+	require.NoError(t, err)
+	assert.Equal(t, "# v0.2.0\n", string(data))
+	assert.FileExists(t, filepath.Join(dest, "modules", "aws", "thing", "nested", "child.tf"))
+	assert.NoFileExists(t, filepath.Join(dest, "modules", "aws", "new", "main.tf"))
+}
+
+func TestWriteRoot(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	require.NoError(t, os.MkdirAll(root, 0o755))
+	module := filepath.Join(base, "modules", "aws", "vpc")
+
+	require.NoError(t, upgrade.WriteRoot(root, module, map[string]interface{}{
+		"project":            "test",
+		"availability_zones": []string{"us-east-1a"},
+	}))
+	data, err := os.ReadFile(filepath.Join(root, upgrade.RootFile))
+	require.NoError(t, err)
+	var cfg struct {
+		Module map[string]map[string]interface{} `json:"module"`
+	}
+	require.NoError(t, json.Unmarshal(data, &cfg))
+	call := cfg.Module[upgrade.ModuleName]
+	assert.Equal(t, "../modules/aws/vpc", call["source"])
+	assert.Equal(t, "test", call["project"])
+	assert.Equal(t, []interface{}{"us-east-1a"}, call["availability_zones"])
+
+	require.NoError(t, upgrade.WriteRoot(base, module, nil))
+	data, err = os.ReadFile(filepath.Join(base, upgrade.RootFile))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"source": "./modules/aws/vpc"`)
+
+	assert.Error(t, upgrade.WriteRoot(root, module, map[string]interface{}{"source": "x"}))
+}
+
+const upgradePlan = `{
+  "format_version": "1.2",
+  "resource_changes": [
+    {"address": "module.under_test.aws_vpc.this", "module_address": "module.under_test", "mode": "managed", "type": "aws_vpc", "name": "this",
+     "change": {"actions": ["update"]}},
+    {"address": "module.under_test.aws_subnet.private[0]", "module_address": "module.under_test", "mode": "managed", "type": "aws_subnet", "name": "private", "index": 0,
+     "change": {"actions": ["delete", "create"]}},
+    {"address": "module.under_test.aws_eip.nat[0]", "module_address": "module.under_test", "mode": "managed", "type": "aws_eip", "name": "nat", "index": 0,
+     "change": {"actions": ["create", "delete"]}},
+    {"address": "module.under_test.aws_flow_log.this[0]", "module_address": "module.under_test", "mode": "managed", "type": "aws_flow_log", "name": "this", "index": 0,
+     "change": {"actions": ["delete"]}},
+    {"address": "module.under_test.aws_route_table_association.private[\"0\"]", "module_address": "module.under_test", "mode": "managed", "type": "aws_route_table_association", "name": "private", "index": "0",
+     "change": {"actions": ["no-op"]}},
+    {"address": "module.under_test.data.aws_region.current", "module_address": "module.under_test", "mode": "data", "type": "aws_region", "name": "current",
+     "change": {"actions": ["read"]}}
+  ]
+}`
+
+func TestCheck(t *testing.T) {
+	plan, err := planjson.Parse([]byte(upgradePlan))
+	require.NoError(t, err)
+
+	findings, unused := upgrade.Check(plan, nil)
+	require.Len(t, findings, 3, "updates, moves and data reads are fine")
+	assert.Equal(t, "aws_subnet.private[0] would be replaced", findings[0].String())
+	assert.Equal(t, "aws_eip.nat[0] would be replaced", findings[1].String())
+	assert.Equal(t, "aws_flow_log.this[0] would be destroyed", findings[2].String())
+	assert.Empty(t, unused)
+
+	findings, unused = upgrade.Check(plan, []upgrade.Allowance{
+		{Address: "aws_eip.nat[*]", Reason: "EIPs are tagged per AZ since v1.1"},
+		{Address: "aws_flow_log.this[0]", Reason: "flow logs moved to their own file"},
+		{Address: "aws_nat_gateway.this[*]", Reason: "no longer replaced"},
+	})
+	require.Len(t, findings, 1)
+	assert.Equal(t, "aws_subnet.private[0]", findings[0].Address)
+	require.Len(t, unused, 1)
+	assert.Equal(t, "aws_nat_gateway.this[*]", unused[0].Address)
+}
@@ -0,0 +1,204 @@
+// Package workdir gives each test its own working copy of a module, so
+// parallel tests applying the same module never share a .terraform
+// directory or a local state file, and points every copy at one provider
+// plugin cache so each provider is downloaded once per machine.
+package workdir
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yourorg/tf-modules/tests/internal/filelock"
+	"github.com/yourorg/tf-modules/tests/internal/tfconfig"
+)
+
+// EnvPluginCache is Terraform's plugin cache variable; when it is already
+// set, PluginCache uses it.
+const EnvPluginCache = "TF_PLUGIN_CACHE_DIR"
+
+// envBreakLockFile lets Terraform link providers from the cache into a
+// module without a .terraform.lock.hcl; the modules do not commit one.
+const envBreakLockFile = "TF_PLUGIN_CACHE_MAY_BREAK_DEPENDENCY_LOCK_FILE"
+
+// Copy copies the module in dir, and every local module it calls directly
+// or not, into parent at the same paths relative to repoRoot, so relative
+// module sources resolve in the copy. It returns the copy of dir, which
+// keeps dir's name. Working files (.terraform, local state, crash logs)
+// are not copied.
+func Copy(repoRoot, dir, parent string) (string, error) {
+	root, err := filepath.Abs(repoRoot)
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if _, err := within(root, abs); err != nil {
+		return "", err
+	}
+
+	dirs, err := closure(root, abs)
+	if err != nil {
+		return "", err
+	}
+	for _, d := range dirs {
+		if nested(d, dirs) {
+			continue
+		}
+		rel, _ := within(root, d)
+		if err := copyTree(d, filepath.Join(parent, rel)); err != nil {
+			return "", err
+		}
+	}
+	rel, _ := within(root, abs)
+	return filepath.Join(parent, rel), nil
+}
+
+// closure returns dir and the local modules it calls, directly or not.
+func closure(root, dir string) ([]string, error) {
+	seen := map[string]bool{dir: true}
+	queue := []string{dir}
+	for i := 0; i < len(queue); i++ {
+		mod, err := tfconfig.Load(queue[i])
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range mod.ModuleCalls() {
+			if !strings.HasPrefix(c.Source, "./") && !strings.HasPrefix(c.Source, "../") {
+				continue
+			}
+			called := filepath.Join(queue[i], filepath.FromSlash(c.Source))
+			if _, err := within(root, called); err != nil {
+				return nil, fmt.Errorf("module %q in %s: %w", c.Name, queue[i], err)
+			}
+			if !seen[called] {
+				seen[called] = true
+				queue = append(queue, called)
+			}
+		}
+	}
+	return queue, nil
+}
+
+// nested reports whether dir lies inside another of dirs, which copies it.
+func nested(dir string, dirs []string) bool {
+	for _, d := range dirs {
+		if d != dir && strings.HasPrefix(dir, d+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// within returns path relative to root, or an error if it is outside.
+func within(root, path string) (string, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside %s", path, root)
+	}
+	return rel, nil
+}
+
+// skipped reports whether a file or directory is Terraform working state
+// rather than configuration.
+func skipped(name string, isDir bool) bool {
+	if isDir {
+		return name == ".terraform"
+	}
+	return strings.HasPrefix(name, "terraform.tfstate") ||
+		name == ".terraform.tfstate.lock.info" ||
+		name == "crash.log"
+}
+
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != src && skipped(d.Name(), d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, 0o755)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			return copyFile(path, target)
+		}
+		return nil
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// PluginCache returns the absolute plugin cache directory, $TF_PLUGIN_CACHE_DIR
+// or def, creating it if needed.
+func PluginCache(def string) (string, error) {
+	dir := os.Getenv(EnvPluginCache)
+	if dir == "" {
+		dir = def
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	return dir, os.MkdirAll(dir, 0o755)
+}
+
+// Env returns a copy of env that points Terraform at the plugin cache.
+func Env(env map[string]string, cache string) map[string]string {
+	out := make(map[string]string, len(env)+2)
+	for k, v := range env {
+		out[k] = v
+	}
+	out[EnvPluginCache] = cache
+	out[envBreakLockFile] = "true"
+	return out
+}
+
+// LockCache takes an exclusive lock on the plugin cache, blocking until it
+// is free. Terraform does not guard the cache against concurrent installs,
+// so terraform init runs under it; unlock releases it.
+func LockCache(cache string) (unlock func(), err error) {
+	// Where flock is not available, a lock file older than any init
+	// belongs to a killed process.
+	return filelock.Lock(filepath.Join(cache, ".init.lock"), 10*time.Minute)
+}
@@ -0,0 +1,103 @@
+package workdir_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/yourorg/tf-modules/tests/internal/workdir"
+)
+
+// writeTree writes files, keyed by slash path, under root.
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+}
+
+func TestCopy(t *testing.T) {
+	repo := t.TempDir()
+	writeTree(t, repo, map[string]string{
+		"modules/aws/app/main.tf":                  "module \"net\" {\n  source = \"../net\"\n}\nmodule \"sub\" {\n  source = \"./sub\"\n}\nmodule \"registry\" {\n  source = \"terraform-aws-modules/vpc/aws\"\n}\n",
+		"modules/aws/app/sub/main.tf":              "module \"shared\" {\n  source = \"../../../shared/tags\"\n}\n",
+		"modules/aws/app/templates/user-data.sh":   "#!/bin/sh\n",
+		"modules/aws/app/terraform.tfstate":        "{}",
+		"modules/aws/app/terraform.tfstate.backup": "{}",
+		"modules/aws/app/.terraform/modules/x":     "x",
+		"modules/aws/net/main.tf":                  "",
+		"modules/shared/tags/main.tf":              "",
+		"modules/aws/unrelated/main.tf":            "",
+	})
+
+	parent := t.TempDir()
+	dir, err := workdir.Copy(repo, filepath.Join(repo, "modules/aws/app"), parent)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(parent, "modules/aws/app"), dir)
+	assert.Equal(t, "app", filepath.Base(dir), "the copy keeps the module's name")
+
+	for _, name := range []string{
+		"modules/aws/app/main.tf",
+		"modules/aws/app/sub/main.tf",
+		"modules/aws/app/templates/user-data.sh",
+		"modules/aws/net/main.tf",
+		"modules/shared/tags/main.tf",
+	} {
+		assert.FileExists(t, filepath.Join(parent, filepath.FromSlash(name)))
+	}
+	for _, name := range []string{
+		"modules/aws/app/terraform.tfstate",
+		"modules/aws/app/terraform.tfstate.backup",
+		"modules/aws/app/.terraform",
+		"modules/aws/unrelated",
+	} {
+		assert.NoFileExists(t, filepath.Join(parent, filepath.FromSlash(name)))
+		assert.NoDirExists(t, filepath.Join(parent, filepath.FromSlash(name)))
+	}
+}
+
+func TestCopyOutsideRepo(t *testing.T) {
+	repo := t.TempDir()
+	writeTree(t, repo, map[string]string{
+		"modules/aws/app/main.tf": "module \"escape\" {\n  source = \"../../../../elsewhere\"\n}\n",
+	})
+	_, err := workdir.Copy(repo, filepath.Join(repo, "modules/aws/app"), t.TempDir())
+	assert.ErrorContains(t, err, "outside")
+
+	_, err = workdir.Copy(filepath.Join(repo, "modules/aws"), repo, t.TempDir())
+	assert.ErrorContains(t, err, "outside")
+}
+
+func TestPluginCache(t *testing.T) {
+	def := filepath.Join(t.TempDir(), "cache")
+	t.Setenv(workdir.EnvPluginCache, "")
+	dir, err := workdir.PluginCache(def)
+	require.NoError(t, err)
+	assert.Equal(t, def, dir)
+	assert.DirExists(t, dir)
+
+	shared := t.TempDir()
+	t.Setenv(workdir.EnvPluginCache, shared)
+	dir, err = workdir.PluginCache(def)
+	require.NoError(t, err)
+	assert.Equal(t, shared, dir)
+
+	in := map[string]string{"AWS_DEFAULT_REGION": "eu-west-1"}
+	env := workdir.Env(in, shared)
+	assert.Equal(t, shared, env[workdir.EnvPluginCache])
+	assert.Equal(t, "true", env["TF_PLUGIN_CACHE_MAY_BREAK_DEPENDENCY_LOCK_FILE"])
+	assert.Equal(t, "eu-west-1", env["AWS_DEFAULT_REGION"])
+	assert.Len(t, in, 1, "the input is left alone")
+
+	unlock, err := workdir.LockCache(shared)
+	require.NoError(t, err)
+	unlock()
+	unlock, err = workdir.LockCache(shared)
+	require.NoError(t, err, "the lock can be taken again once released")
+	unlock()
+}
@@ -0,0 +1,33 @@
+# Scratch configuration for TestStateBackendLocalStack. The test copies it,
+# adds a backend.tf pointing at the s3-state bucket and dynamodb-lock table,
+# and applies it with a new revision each time to write state versions.
+# hold_seconds keeps the apply, and so the state lock, running long enough
+# for a second apply to collide with it.
+
+terraform {
+  required_version = ">= 1.6.0, < 2.0.0"
+}
+
+variable "revision" {
+  description = "Value recorded in state; changing it replaces the resource"
+  type        = string
+}
+
+variable "hold_seconds" {
+  description = "Seconds the apply sleeps while holding the state lock"
+  type        = number
+  default     = 0
+}
+
+resource "terraform_data" "revision" {
+  input            = var.revision
+  triggers_replace = [var.revision]
+
+  provisioner "local-exec" {
+    command = "sleep ${var.hold_seconds}"
+  }
+}
+
+output "revision" {
+  value = terraform_data.revision.output
+}